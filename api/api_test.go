@@ -32,8 +32,11 @@ import (
 	"github.com/cneill/utask/models/resolution"
 	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/archive"
+	"github.com/cneill/utask/pkg/archive/filesystem"
 	"github.com/cneill/utask/pkg/auth"
 	compress "github.com/cneill/utask/pkg/compress/init"
+	"github.com/cneill/utask/pkg/notify"
 	"github.com/cneill/utask/pkg/now"
 	"github.com/cneill/utask/pkg/plugins/builtin/echo"
 	"github.com/cneill/utask/pkg/plugins/builtin/script"
@@ -173,11 +176,105 @@ func TestUtils(t *testing.T) {
 		Headers(regularHeaders).
 		Checkers(iffy.ExpectStatus(401))
 
-	utask.FMaintenanceMode = true
+	tester.AddCall("testKeyRotateStatus", http.MethodGet, "/key-rotate/status", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(200))
+
+	tester.AddCall("testKeyRotateStatusIsAdmin", http.MethodGet, "/key-rotate/status", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(401))
+
+	utask.SetMaintenanceMode(true)
 
 	tester.Run()
 
-	utask.FMaintenanceMode = false
+	utask.SetMaintenanceMode(false)
+}
+
+func TestMaintenanceModeToggle(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+	defer utask.SetMaintenanceMode(false)
+
+	tester.AddCall("enableIsAdmin", http.MethodPut, "/maintenance", `{"enabled":true}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(401))
+
+	tester.AddCall("enableMissingState", http.MethodPut, "/maintenance", `{}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("enable", http.MethodPut, "/maintenance", `{"enabled":true}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("enabled", "true"),
+		)
+
+	tester.AddCall("metaEnabled", http.MethodGet, "/meta", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("maintenance_mode", "true"),
+		)
+
+	tester.AddCall("createTaskEnabled", http.MethodPost, "/task", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(405))
+
+	tester.AddCall("enableInvalidScope", http.MethodPut, "/maintenance", `{"enabled":true,"scope":"foo"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("enableCreate", http.MethodPut, "/maintenance", `{"enabled":true,"scope":"create"}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("scope", "create"),
+		)
+
+	tester.AddCall("metaCreate", http.MethodGet, "/meta", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("maintenance_scope", "create"),
+		)
+
+	tester.AddCall("createTaskCreate", http.MethodPost, "/task", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(405))
+
+	// out of the scope, the request goes through and fails on its empty body
+	tester.AddCall("createResolutionCreate", http.MethodPost, "/resolution", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("enableExecute", http.MethodPut, "/maintenance", `{"enabled":true,"scope":"execute"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(200))
+
+	tester.AddCall("createTaskExecute", http.MethodPost, "/task", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("createResolutionExecute", http.MethodPost, "/resolution", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(405))
+
+	tester.AddCall("disable", http.MethodPut, "/maintenance", `{"enabled":false}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("enabled", "false"),
+		)
+
+	tester.AddCall("metaDisabled", http.MethodGet, "/meta", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("maintenance_mode", "false"),
+		)
+
+	tester.Run()
 }
 
 func TestPasswordInput(t *testing.T) {
@@ -233,7 +330,7 @@ func TestPasswordInput(t *testing.T) {
 			iffy.ExpectJSONBranch("input", "verysecret", "abracadabra"),
 		)
 
-	tester.AddCall("ignoreUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"verysecret":"**__SECRET__**"}}`).
+	tester.AddCall("ignoreUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"verysecret":"**__SECRET__**"},"revision":{{.newTask.revision}}}`).
 		Headers(regularHeaders).
 		Checkers(iffy.ExpectStatus(200))
 
@@ -244,7 +341,7 @@ func TestPasswordInput(t *testing.T) {
 			iffy.ExpectJSONBranch("input", "verysecret", "abracadabra"),
 		)
 
-	tester.AddCall("realUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"verysecret":"expectopatronum"}}`).
+	tester.AddCall("realUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"verysecret":"expectopatronum"},"revision":{{.ignoreUpdate.revision}}}`).
 		Headers(regularHeaders).
 		Checkers(iffy.ExpectStatus(200))
 
@@ -289,6 +386,77 @@ func TestPasswordInput(t *testing.T) {
 	tester.Run()
 }
 
+func TestSecretInput(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := templateWithSecretInput()
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"input-secret","input":{"verysecret":"abracadabra"}}`).
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(201),
+			iffy.ExpectJSONBranch("input", "verysecret", "**__SECRET__**"),
+		)
+
+	tester.AddCall("getObfuscated", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("input", "verysecret", "**__SECRET__**"),
+		)
+
+	tester.AddCall("getObfuscatedAdmin", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("input", "verysecret", "**__SECRET__**"),
+		)
+
+	tester.AddCall("ignoreUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"verysecret":"**__SECRET__**"},"revision":{{.newTask.revision}}}`).
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("input", "verysecret", "**__SECRET__**"),
+		)
+
+	tester.AddCall("createResolution", http.MethodPost, "/resolution", `{"task_id":"{{.newTask.id}}"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("runResolution", http.MethodPost, "/resolution/{{.createResolution.id}}/run", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(204),
+			waitChecker(time.Second), // fugly... need to give resolution manager some time to asynchronously finish running
+		)
+
+	tester.AddCall("getTaskResult", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", "DONE"),
+			iffy.ExpectJSONBranch("result", "length", "11"),
+			iffy.ExpectJSONBranch("result", "revealed", "***"),
+		)
+
+	tester.Run()
+}
+
 func TestResolutionEdit(t *testing.T) {
 	tester := iffy.NewTester(t, hdl)
 
@@ -319,10 +487,18 @@ func TestResolutionEdit(t *testing.T) {
 		Headers(regularHeaders).
 		Checkers(iffy.ExpectStatus(201))
 
-	tester.AddCall("jsonUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"id":"bar-json"}}`).
+	tester.AddCall("missingRevision", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"id":"bar-json"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("jsonUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"id":"bar-json"},"revision":{{.newTask.revision}}}`).
 		Headers(regularHeaders).
 		Checkers(iffy.ExpectStatus(200))
 
+	tester.AddCall("staleUpdate", http.MethodPut, "/task/{{.newTask.id}}", `{"input":{"id":"bar-stale"},"revision":{{.newTask.revision}}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(409))
+
 	tester.AddCall("getAfterJson", http.MethodGet, "/task/{{.newTask.id}}", "").
 		Headers(adminHeaders).
 		Checkers(
@@ -331,7 +507,10 @@ func TestResolutionEdit(t *testing.T) {
 		)
 
 	tester.AddCall("yamlUpdate", http.MethodPut, "/task/{{.newTask.id}}", "input:\n  id: bar-yaml").
-		Headers(regularHeaders).
+		Headers(iffy.Headers{
+			usernameHeaderKey: regularUser,
+			"If-Match":        `"{{.jsonUpdate.revision}}"`,
+		}).
 		Checkers(iffy.ExpectStatus(200))
 
 	tester.AddCall("getAfterYaml", http.MethodGet, "/task/{{.newTask.id}}", "").
@@ -472,7 +651,7 @@ func TestPagination(t *testing.T) {
 	cnt := 20
 	var midTask task.Task
 	for i := 0; i < cnt; i++ {
-		tsk, err := task.Create(dbp, tmpl, regularUser, nil, nil, nil, nil, nil, map[string]interface{}{"id": strconv.Itoa(i)}, nil, nil, false)
+		tsk, err := task.Create(dbp, tmpl, regularUser, task.CreateOptions{Input: map[string]interface{}{"id": strconv.Itoa(i)}})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -528,6 +707,115 @@ func TestPagination(t *testing.T) {
 	}
 }
 
+func TestCommentPagination(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dummy := dummyTemplate()
+
+	tmpl, err := tasktemplate.LoadFromName(dbp, dummy.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&dummy); err != nil {
+			t.Fatal(err)
+		}
+		tmpl = &dummy
+	}
+
+	tsk, err := task.Create(dbp, tmpl, regularUser, task.CreateOptions{Input: map[string]interface{}{"id": "comments"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one comment out of five records an action of the admin
+	for i := 0; i < 15; i++ {
+		create := task.CreateComment
+		author := regularUser
+		if i%5 == 0 {
+			create = task.CreateSystemComment
+			author = adminUser
+		}
+		if _, err := create(dbp, tsk, author, fmt.Sprintf("comment %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commentsPath := "/task/" + tsk.PublicID + "/comment"
+
+	tester := iffy.NewTester(t, hdl)
+
+	var all, firstPage []*task.Comment
+	tester.AddCall("list all comments", http.MethodGet, commentsPath, "").
+		Headers(regularHeaders).
+		ResponseObject(&all).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(15),
+		)
+
+	tester.AddCall("list first page", http.MethodGet, commentsPath+"?page_size=10", "").
+		Headers(regularHeaders).
+		ResponseObject(&firstPage).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(10),
+		)
+
+	tester.AddCall("list comments by author", http.MethodGet, commentsPath+"?author="+adminUser, "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(3),
+		)
+
+	tester.AddCall("list comments by type", http.MethodGet, commentsPath+"?type="+task.CommentTypeSystem, "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(3),
+		)
+
+	tester.AddCall("list comments by unknown type", http.MethodGet, commentsPath+"?type=chitchat", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+
+	for i, c := range all {
+		if c.Content != fmt.Sprintf("comment %d", i) {
+			t.Fatal("comments should be listed oldest first")
+		}
+	}
+
+	tester2 := iffy.NewTester(t, hdl)
+
+	var secondPage []*task.Comment
+	tester2.AddCall("list second page", http.MethodGet, commentsPath+"?page_size=10&last="+firstPage[9].PublicID, "").
+		Headers(regularHeaders).
+		ResponseObject(&secondPage).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(5),
+		)
+
+	tester2.AddCall("list comments after", http.MethodGet, commentsPath+"?after="+url.QueryEscape(all[11].Created.Format(time.RFC3339Nano)), "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(3),
+		)
+
+	tester2.Run()
+
+	if secondPage[0].PublicID != all[10].PublicID {
+		t.Fatal("second page should start right after the first one")
+	}
+}
+
 const (
 	blockedTemplate          = "blocked-template"
 	hiddenTemplate           = "hidden-template"
@@ -610,56 +898,1404 @@ func TestBlockedHiddenTemplates(t *testing.T) {
 	}
 }
 
-func waitChecker(dur time.Duration) iffy.Checker {
-	return func(r *http.Response, body string, respObject interface{}) error {
-		time.Sleep(dur)
-		return nil
-	}
-}
+func TestImportExportTemplates(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
 
-func templatesWithInvalidInputs() []tasktemplate.TaskTemplate {
-	var tt []tasktemplate.TaskTemplate
-	for _, inp := range []input.Input{
-		{
-			Name:        "input-with-redundant-regex",
-			LegalValues: []interface{}{"a", "b", "c"},
-			Regex:       strPtr("^d.+$"),
-		},
-		{
-			Name:  "input-with-bad-regex",
-			Regex: strPtr("^^[d.+$"),
-		},
-		{
-			Name: "input-with-bad-type",
-			Type: "bad-type",
-		},
-		{
-			Name:        "input-with-bad-legal-values",
-			Type:        "number",
-			LegalValues: []interface{}{"a", "b", "c"},
-		},
-	} {
-		tt = append(tt, tasktemplate.TaskTemplate{
-			Name:        "invalid-template",
-			Description: "Invalid template",
-			TitleFormat: "Invalid template",
-			Inputs: []input.Input{
-				inp,
-			},
-		})
-	}
-	return tt
-}
+	imported := `
+templates:
+  - name: import-template-a
+    description: does nothing
+    title_format: this task does nothing at all
+  - name: import-template-b
+    description: does nothing either
+    title_format: this task does nothing at all
+`
+	invalid := `
+templates:
+  - name: import-template-c
+    description: does nothing
+    title_format: this task does nothing at all
+  - name: import-template-a
+    description: does nothing
+    title_format: "{{ .input.unknown }}"
+`
+	allInvalid := `
+templates:
+  - name: import-template-d
+    description: does nothing
+    title_format: "{{ .input.unknown }}"
+`
+
+	tester.AddCall("regular import templates", http.MethodPost, "/template/import", imported).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(401))
 
-func templateWithPasswordInput() tasktemplate.TaskTemplate {
-	return tasktemplate.TaskTemplate{
-		Name:        "input-password",
-		Description: "input-password",
-		TitleFormat: "input-password",
-		ResultFormat: map[string]interface{}{
-			"revealed": "{{.step.stepOne.output.showSecret}}",
-		},
-		Inputs: []input.Input{
+	tester.AddCall("admin import templates", http.MethodPost, "/template/import", imported).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"status":"created"`),
+		)
+
+	tester.AddCall("admin import templates again", http.MethodPost, "/template/import", imported).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"status":"updated"`),
+			expectStringNotPresent(`"status":"created"`),
+		)
+
+	tester.AddCall("admin import invalid templates", http.MethodPost, "/template/import", invalid).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(400),
+			expectStringPresent(`{"name":"import-template-c","status":"skipped"}`),
+			expectStringPresent(`"name":"import-template-a","status":"error"`),
+		)
+
+	tester.AddCall("admin import only invalid templates", http.MethodPost, "/template/import", allInvalid).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(400),
+			expectStringPresent(`"name":"import-template-d","status":"error"`),
+		)
+
+	tester.AddCall("template from invalid import not created", http.MethodGet, "/template/import-template-c", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(404))
+
+	tester.AddCall("export templates", http.MethodGet, "/template/export", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent("name: import-template-a"),
+			expectStringPresent("name: import-template-b"),
+		)
+
+	tester.Run()
+}
+
+func TestAssignTask(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "assign-template"
+	tmpl.AllowedResolverUsernames = []string{regularUser}
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"assign-template","input":{"id":"foo"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("assign to a user not allowed to resolve", http.MethodPost, "/task/{{.newTask.id}}/assign", `{"resolver_username":"nobody"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("admin assigns to regular", http.MethodPost, "/task/{{.newTask.id}}/assign", `{"resolver_username":"regular"}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("assignee", regularUser),
+		)
+
+	tester.AddCall("admin can't resolve a task assigned to regular", http.MethodPost, "/resolution", `{"task_id":"{{.newTask.id}}"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("regular unassigns", http.MethodDelete, "/task/{{.newTask.id}}/assign", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(204))
+
+	tester.AddCall("unassign again", http.MethodDelete, "/task/{{.newTask.id}}/assign", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("regular claims the task", http.MethodPost, "/task/{{.newTask.id}}/assign", `{}`).
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("assignee", regularUser),
+		)
+
+	tester.AddCall("regular resolves the task", http.MethodPost, "/resolution", `{"task_id":"{{.newTask.id}}"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("can't assign a task being resolved", http.MethodPost, "/task/{{.newTask.id}}/assign", `{}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestArchiveRestoreTask(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "archive-template"
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"archive-template","input":{"id":"archived"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("restore without archive storage", http.MethodPost, "/task/restore", `{"archive":"{{.newTask.id}}.json.gzip"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(501))
+
+	tester.Run()
+
+	sink, err := filesystem.NewSink(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.RegisterSink(sink, "gzip", false); err != nil {
+		t.Fatal(err)
+	}
+	defer archive.UnregisterSink()
+
+	tester.Reset()
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"archive-template","input":{"id":"restored"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("comment", http.MethodPost, "/task/{{.newTask.id}}/comment", `{"content":"before archival"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("archive", http.MethodPost, "/task/{{.newTask.id}}/archive", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONFields("archive"),
+		)
+
+	tester.AddCall("archived task is deleted", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(404))
+
+	tester.AddCall("restore is admin only", http.MethodPost, "/task/restore", `{"archive":"{{.archive.archive}}"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(401))
+
+	tester.AddCall("restore missing archive", http.MethodPost, "/task/restore", `{"archive":"missing.json.gzip"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(404))
+
+	tester.AddCall("restore", http.MethodPost, "/task/restore", `{"archive":"{{.archive.archive}}"}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(201),
+			iffy.ExpectJSONBranch("input", "id", "restored"),
+		)
+
+	tester.AddCall("restored task", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(200))
+
+	tester.AddCall("restored comments", http.MethodGet, "/task/{{.newTask.id}}/comment", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectListLength(1),
+		)
+
+	tester.AddCall("restore existing task", http.MethodPost, "/task/restore", `{"archive":"{{.archive.archive}}"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(409))
+
+	tester.Run()
+}
+
+func TestListTasksByResolverAndWatcher(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "resolver-watcher-template"
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"resolver-watcher-template","input":{"id":"foo"},"resolver_groups":["resolver-team"],"watcher_usernames":["watcher-user"]}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("list by resolver group", http.MethodGet, "/task?type=all&template=resolver-watcher-template&resolver=resolver-team", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"template_name":"resolver-watcher-template"`),
+		)
+
+	tester.AddCall("list by another resolver", http.MethodGet, "/task?type=all&template=resolver-watcher-template&resolver=watcher-user", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringNotPresent(`"template_name":"resolver-watcher-template"`),
+		)
+
+	tester.AddCall("list by watcher username", http.MethodGet, "/task?type=all&template=resolver-watcher-template&watcher=watcher-user", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"template_name":"resolver-watcher-template"`),
+		)
+
+	tester.AddCall("list by another watcher", http.MethodGet, "/task?type=all&template=resolver-watcher-template&watcher=resolver-team", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringNotPresent(`"template_name":"resolver-watcher-template"`),
+		)
+
+	tester.Run()
+}
+
+func TestListTasksPeriod(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "period-template"
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"period-template","input":{"id":"foo"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("list created in the period", http.MethodGet, "/task?type=all&template=period-template&created_after=2000-01-01T00:00:00Z&created_before=2100-01-01T00:00:00Z", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"template_name":"period-template"`),
+		)
+
+	tester.AddCall("list created later", http.MethodGet, "/task?type=all&template=period-template&created_after=2100-01-01T00:00:00Z", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringNotPresent(`"template_name":"period-template"`),
+		)
+
+	tester.AddCall("a task not over has not ended", http.MethodGet, "/task?type=all&template=period-template&ended_after=2000-01-01T00:00:00Z", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringNotPresent(`"template_name":"period-template"`),
+		)
+
+	tester.AddCall("stats of the tasks created later", http.MethodGet, "/unsecured/stats?created_after=2100-01-01T00:00:00Z", "").
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("task_states", "TODO", "0"),
+			expectStringPresent(`"by_group":{}`),
+		)
+
+	tester.Run()
+}
+
+func TestListMyResolutions(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "my-resolutions-template"
+	tmpl.AllowedResolverUsernames = []string{regularUser}
+	tmpl.Steps["step"].Action.Configuration = json.RawMessage(`{
+		"error_message": "bad request",
+		"error_type": "client"
+	}`)
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"my-resolutions-template","input":{"id":"foo"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("createResolution", http.MethodPost, "/resolution", `{"task_id":"{{.newTask.id}}"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("runResolution", http.MethodPost, "/resolution/{{.createResolution.id}}/run", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(204),
+			waitChecker(time.Second), // fugly... need to give resolution manager some time to asynchronously finish running
+		)
+
+	tester.AddCall("blocked resolution is actionable by template resolver", http.MethodGet, "/resolution/mine?template=my-resolutions-template", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"state":"BLOCKED_BADREQUEST"`),
+			expectStringPresent(`"template_name":"my-resolutions-template"`),
+		)
+
+	tester.AddCall("filter on any blocked state", http.MethodGet, "/resolution/mine?template=my-resolutions-template&state=BLOCKED", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringPresent(`"template_name":"my-resolutions-template"`),
+		)
+
+	tester.AddCall("filter on another state", http.MethodGet, "/resolution/mine?template=my-resolutions-template&state=PAUSED", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectStringNotPresent(`"template_name":"my-resolutions-template"`),
+		)
+
+	tester.AddCall("filter on a non actionable state", http.MethodGet, "/resolution/mine?state=RUNNING", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestApprovalStep(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "approval-template"
+	tmpl.AllowedResolverUsernames = []string{regularUser}
+	tmpl.Steps["step"].Action = executor.Executor{
+		Type:          "approval",
+		Configuration: json.RawMessage(`{"message": "go ahead?"}`),
+	}
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one resolution gets approved, the other one rejected
+	for _, name := range []string{"Approved", "Rejected"} {
+		tester.AddCall("newTask"+name, http.MethodPost, "/task", `{"template_name":"approval-template","input":{"id":"`+name+`"}}`).
+			Headers(regularHeaders).
+			Checkers(iffy.ExpectStatus(201))
+
+		tester.AddCall("createResolution"+name, http.MethodPost, "/resolution", `{"task_id":"{{.newTask`+name+`.id}}"}`).
+			Headers(regularHeaders).
+			Checkers(iffy.ExpectStatus(201))
+
+		tester.AddCall("approve before the step runs", http.MethodPost, "/resolution/{{.createResolution"+name+".id}}/step/step/approve", "{}").
+			Headers(regularHeaders).
+			Checkers(iffy.ExpectStatus(400))
+
+		tester.AddCall("runResolution", http.MethodPost, "/resolution/{{.createResolution"+name+".id}}/run", "").
+			Headers(regularHeaders).
+			Checkers(
+				iffy.ExpectStatus(204),
+				waitChecker(time.Second), // fugly... need to give resolution manager some time to asynchronously finish running
+			)
+
+		tester.AddCall("resolution waits for approval", http.MethodGet, "/resolution/{{.createResolution"+name+".id}}", "").
+			Headers(regularHeaders).
+			Checkers(
+				iffy.ExpectStatus(200),
+				iffy.ExpectJSONBranch("state", "BLOCKED_APPROVAL"),
+				iffy.ExpectJSONBranch("steps", "step", "state", "WAITING"),
+			)
+
+		tester.AddCall("admin is not a resolution manager", http.MethodPost, "/resolution/{{.createResolution"+name+".id}}/step/step/approve", "{}").
+			Headers(adminHeaders).
+			Checkers(iffy.ExpectStatus(403))
+	}
+
+	tester.AddCall("approve", http.MethodPost, "/resolution/{{.createResolutionApproved.id}}/step/step/approve", `{"reason":"lgtm"}`).
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(204),
+			waitChecker(time.Second),
+		)
+
+	tester.AddCall("approved resolution is done", http.MethodGet, "/resolution/{{.createResolutionApproved.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", "DONE"),
+			iffy.ExpectJSONBranch("steps", "step", "output", "approved", "true"),
+			iffy.ExpectJSONBranch("steps", "step", "output", "username", regularUser),
+		)
+
+	tester.AddCall("reject without reason", http.MethodPost, "/resolution/{{.createResolutionRejected.id}}/step/step/reject", "{}").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("reject", http.MethodPost, "/resolution/{{.createResolutionRejected.id}}/step/step/reject", `{"reason":"not today"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(204))
+
+	tester.AddCall("rejected step fails", http.MethodGet, "/resolution/{{.createResolutionRejected.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", "BLOCKED_BADREQUEST"),
+			iffy.ExpectJSONBranch("steps", "step", "state", "CLIENT_ERROR"),
+			iffy.ExpectJSONBranch("steps", "step", "error", "rejected by regular: not today"),
+			iffy.ExpectJSONBranch("steps", "step", "output", "approved", "false"),
+		)
+
+	tester.Run()
+}
+
+func TestScheduleResolution(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "schedule-template"
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("newTask", http.MethodPost, "/task", `{"template_name":"schedule-template","input":{"id":"foo"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("createResolution", http.MethodPost, "/resolution", `{"task_id":"{{.newTask.id}}"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("neither time nor delay", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("both time and delay", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{"at":"2100-01-01T00:00:00Z","delay":"1h"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("invalid delay", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{"delay":"soon"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("time in the past", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{"at":"2000-01-01T00:00:00Z"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("not a resolution manager", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{"delay":"1h"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("schedule", http.MethodPost, "/resolution/{{.createResolution.id}}/schedule", `{"at":"2100-01-01T00:00:00Z"}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(204))
+
+	tester.AddCall("getResolution", http.MethodGet, "/resolution/{{.createResolution.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", resolution.StateToAutorunDelayed),
+		)
+
+	tester.AddCall("getTask", http.MethodGet, "/task/{{.newTask.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", task.StateDelayed),
+		)
+
+	tester.Run()
+
+	// resolutions resumed on their own, such as the ones waiting for a callback
+	// or an approval, can't be scheduled
+	tmpl2, err := tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []string{resolution.StateWaiting, resolution.StateBlockedApproval, resolution.StateAutorunning} {
+		tsk, err := task.Create(dbp, tmpl2, regularUser, task.CreateOptions{Input: map[string]interface{}{"id": state}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := resolution.Create(dbp, tsk, nil, adminUser, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.SetState(state)
+		if err := res.Update(dbp); err != nil {
+			t.Fatal(err)
+		}
+
+		tester := iffy.NewTester(t, hdl)
+		tester.AddCall("schedule "+state, http.MethodPost, "/resolution/"+res.PublicID+"/schedule", `{"delay":"1h"}`).
+			Headers(adminHeaders).
+			Checkers(iffy.ExpectStatus(400))
+		tester.Run()
+	}
+}
+
+func TestInputSchema(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "input-schema-template"
+	tmpl.Inputs = append(tmpl.Inputs, input.Input{
+		Name:    "count",
+		Type:    "number",
+		Default: 1,
+	})
+	tmpl.InputSchema = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"id"},
+		"properties": map[string]interface{}{
+			"id":    map[string]interface{}{"type": "string", "pattern": "^[a-z]+$"},
+			"count": map[string]interface{}{"type": "integer", "maximum": 10},
+		},
+	}
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("validInput", http.MethodPost, "/task", `{"template_name":"input-schema-template","input":{"id":"foo","count":3}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("validInputWithDefault", http.MethodPost, "/task", `{"template_name":"input-schema-template","input":{"id":"foo"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("invalidInput", http.MethodPost, "/task", `{"template_name":"input-schema-template","input":{"id":"foo","count":42}}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(400),
+			iffy.ExpectJSONBranch("error", "Invalid input: /count: must be <= 10 but found 42"),
+		)
+
+	tester.AddCall("invalidBatchInput", http.MethodPost, "/batch", `{"template_name":"input-schema-template","inputs":[{"id":"foo"},{"id":"BAR"}]}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+type recordingSender struct {
+	messages chan *notify.Message
+}
+
+func (rs *recordingSender) Send(m *notify.Message, name string) {
+	rs.messages <- m
+}
+
+func TestNotifyBackendsOverride(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "notify-backends-template"
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	strategy := map[string]string{notify.TaskStateUpdateKey: utask.NotificationStrategyAlways}
+	incident := &recordingSender{messages: make(chan *notify.Message, 100)}
+	notify.RegisterSender("incident-channel", incident, strategy, nil)
+
+	tester.AddCall("unknownBackend", http.MethodPost, "/task", `{"template_name":"notify-backends-template","input":{"id":"foo"},"notify_backends":["unknown-channel"]}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("overriddenBackends", http.MethodPost, "/task", `{"template_name":"notify-backends-template","input":{"id":"foo"},"notify_backends":["incident-channel"]}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(201),
+			iffy.ExpectJSONBranch("notify_backends", "[incident-channel]"),
+		)
+
+	tester.Run()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-incident.messages:
+			if m.Fields["template"] == tmpl.Name {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no notification received on the overridden backend")
+		}
+	}
+}
+
+func TestComputedInputDefaults(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "computed-defaults-template"
+	tmpl.Inputs = append(tmpl.Inputs,
+		input.Input{
+			Name:    "label",
+			Default: "{{.input.id}}-label",
+		},
+		input.Input{
+			Name:    "replicas",
+			Type:    input.InputTypeNumber,
+			Default: `{{ if eq .input.id "big" }}3{{ else }}1{{ end }}`,
+		},
+	)
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("computed", http.MethodPost, "/task", `{"template_name":"computed-defaults-template","input":{"id":"big"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("getComputed", http.MethodGet, "/task/{{.computed.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("input", "label", "big-label"),
+			iffy.ExpectJSONBranch("input", "replicas", "3"),
+		)
+
+	tester.AddCall("provided", http.MethodPost, "/task", `{"template_name":"computed-defaults-template","input":{"id":"small","label":"mine"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("getProvided", http.MethodGet, "/task/{{.provided.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("input", "label", "mine"),
+			iffy.ExpectJSONBranch("input", "replicas", "1"),
+		)
+
+	tester.AddCall("missingRequired", http.MethodPost, "/task", `{"template_name":"computed-defaults-template","input":{}}`).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(400),
+			iffy.ExpectJSONBranch("error", "Missing input 'id'"),
+		)
+
+	tester.Run()
+}
+
+func TestBatchStatusAndCancel(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "batch-template"
+
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tester.AddCall("createBatch", http.MethodPost, "/batch", `{"template_name":"batch-template","inputs":[{"id":"a"},{"id":"b"}]}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("getBatch", http.MethodGet, "/batch/{{.createBatch.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("tasks_total", "2"),
+			iffy.ExpectJSONBranch("tasks_running", "2"),
+			iffy.ExpectJSONBranch("tasks_by_state", task.StateTODO, "2"),
+		)
+
+	tester.AddCall("createBatchWithoutInputs", http.MethodPost, "/batch", `{"template_name":"batch-template"}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("createBatchWithTasks", http.MethodPost, "/batch", `{"template_name":"batch-template","tags":{"team":"ops"},"tasks":[{"input":{"id":"d"}},{"input":{"id":"e"},"tags":{"team":"dev"}}]}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("getBatchWithTasks", http.MethodGet, "/batch/{{.createBatchWithTasks.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("tasks_total", "2"),
+		)
+
+	tester.AddCall("createAdminBatch", http.MethodPost, "/batch", `{"template_name":"batch-template","inputs":[{"id":"c"}]}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("getForbiddenBatch", http.MethodGet, "/batch/{{.createAdminBatch.id}}", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("cancelForbiddenBatch", http.MethodPost, "/batch/{{.createAdminBatch.id}}/cancel", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("cancelBatch", http.MethodPost, "/batch/{{.createBatch.id}}/cancel", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(200))
+
+	tester.AddCall("getCancelledBatch", http.MethodGet, "/batch/{{.createBatch.id}}", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("tasks_running", "0"),
+			iffy.ExpectJSONBranch("tasks_by_state", task.StateWontfix, "2"),
+		)
+
+	tester.Run()
+}
+
+func TestBatchGetTasks(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tmpl := range []tasktemplate.TaskTemplate{dummyTemplate(), templateWithPasswordInput()} {
+		_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if err := dbp.DB().Insert(&tmpl); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tmpl, err := tasktemplate.LoadFromName(dbp, dummyTemplate().Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordTmpl, err := tasktemplate.LoadFromName(dbp, templateWithPasswordInput().Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the regular user sees the tasks it requested, watches or may resolve, but not the others
+	create := func(tt *tasktemplate.TaskTemplate, requester string, opts task.CreateOptions) string {
+		tsk, err := task.Create(dbp, tt, requester, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tsk.PublicID
+	}
+	requested := create(tmpl, regularUser, task.CreateOptions{Input: map[string]interface{}{"id": "batch-get-requested"}})
+	watched := create(tmpl, adminUser, task.CreateOptions{Input: map[string]interface{}{"id": "batch-get-watched"}, WatcherUsernames: []string{regularUser}})
+	resolvable := create(tmpl, adminUser, task.CreateOptions{Input: map[string]interface{}{"id": "batch-get-resolvable"}, ResolverUsernames: []string{regularUser}})
+	denied := create(tmpl, adminUser, task.CreateOptions{Input: map[string]interface{}{"id": "batch-get-denied"}})
+	password := create(passwordTmpl, regularUser, task.CreateOptions{Input: map[string]interface{}{"verysecret": "abracadabra"}})
+	missing := "00000000-0000-0000-0000-000000000000"
+
+	body := marshalJSON(t, map[string]interface{}{
+		"ids": []string{requested, watched, resolvable, denied, password, missing, requested},
+	})
+
+	tester.AddCall("batchGetRegular", http.MethodPost, "/task/batch-get", body).
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectBatchGetTasks([]string{requested, watched, resolvable, password}, []string{denied, missing}),
+			// inputs are obfuscated as by GetTask
+			expectStringPresent(`"verysecret":"**__SECRET__**"`),
+			expectStringNotPresent("abracadabra"),
+		)
+
+	tester.AddCall("batchGetAdmin", http.MethodPost, "/task/batch-get", body).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			expectBatchGetTasks([]string{requested, watched, resolvable, denied, password}, []string{missing}),
+			expectStringPresent(`"verysecret":"abracadabra"`),
+		)
+
+	tester.AddCall("batchGetWithoutAuth", http.MethodPost, "/task/batch-get", body).
+		Checkers(iffy.ExpectStatus(401))
+
+	// short IDs, for the body to stay under its size limit
+	tooMany := make([]string, utask.MaxPageSize+1)
+	for i := range tooMany {
+		tooMany[i] = "x"
+	}
+	tester.AddCall("batchGetTooMany", http.MethodPost, "/task/batch-get", marshalJSON(t, map[string]interface{}{"ids": tooMany})).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestExtendResolutions(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tt, err := tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// resolutions blocked by their retry limit, tagged for this test only
+	tags := map[string]string{"extend-test": strconv.FormatInt(time.Now().UnixNano(), 10)}
+	blocked := func(id string) *resolution.Resolution {
+		tsk, err := task.Create(dbp, tt, adminUser, task.CreateOptions{Input: map[string]interface{}{"id": id}, Tags: tags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := resolution.Create(dbp, tsk, nil, adminUser, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.SetState(resolution.StateBlockedMaxRetries)
+		if err := res.Update(dbp); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	first := blocked("extend-first")
+	second := blocked("extend-second")
+
+	// the second resolution fails to load, once the first one is extended
+	if _, err := dbp.DB().Exec(`UPDATE "resolution" SET steps_compression_alg = 'unknown' WHERE id = $1`, second.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	body := marshalJSON(t, map[string]interface{}{"template": tmpl.Name, "tags": tags})
+
+	tester.AddCall("extendNotAdmin", http.MethodPost, "/resolution/extend", body).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("extendInvalidState", http.MethodPost, "/resolution/extend", marshalJSON(t, map[string]interface{}{"tags": tags, "state": resolution.StateDone})).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.AddCall("extendPartiallyInvalid", http.MethodPost, "/resolution/extend", body).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(500))
+
+	tester.Run()
+
+	// nothing was extended: the changes made to the first resolution were rolled back along with the rest
+	reloaded, err := resolution.LoadFromPublicID(dbp, first.PublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.State != resolution.StateBlockedMaxRetries || reloaded.RunMax != first.RunMax {
+		t.Fatalf("resolution extended despite the failure: state %s, run_max %d", reloaded.State, reloaded.RunMax)
+	}
+	comments, err := dbp.DB().SelectInt(`SELECT count(*) FROM "task_comment" WHERE id_task = $1`, first.TaskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments != 0 {
+		t.Fatalf("%d comments left on the task despite the failure", comments)
+	}
+
+	// once the invalid resolution is out of the way, the others are extended together
+	if _, err := dbp.DB().Exec(`UPDATE "resolution" SET state = $1 WHERE id = $2`, resolution.StateDone, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	third := blocked("extend-third")
+
+	tester = iffy.NewTester(t, hdl)
+	tester.AddCall("extend", http.MethodPost, "/resolution/extend", body).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("extended", "2"),
+		)
+	tester.AddCall("extendAgain", http.MethodPost, "/resolution/extend", body).
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("extended", "0"),
+		)
+	tester.Run()
+
+	for _, res := range []*resolution.Resolution{first, third} {
+		reloaded, err := resolution.LoadFromPublicID(dbp, res.PublicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.RunMax <= res.RunMax {
+			t.Fatalf("resolution %s not extended: run_max %d", res.PublicID, reloaded.RunMax)
+		}
+		if reloaded.State == resolution.StateBlockedMaxRetries {
+			t.Fatalf("resolution %s still blocked", res.PublicID)
+		}
+	}
+}
+
+func TestBlockUnblockTemplate(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "block-template"
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.AddCall("blockNotAdmin", http.MethodPost, "/template/block-template/block", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("blockUnknown", http.MethodPost, "/template/no-such-template/block", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(404))
+
+	tester.AddCall("createBeforeBlock", http.MethodPost, "/task", `{"template_name":"block-template","input":{"id":"block-before"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.AddCall("block", http.MethodPost, "/template/block-template/block", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("blocked", "true"),
+		)
+
+	tester.AddCall("blockAgain", http.MethodPost, "/template/block-template/block", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("blocked", "true"),
+		)
+
+	tester.AddCall("getBlocked", http.MethodGet, "/template/block-template", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("blocked", "true"),
+		)
+
+	tester.AddCall("createBlocked", http.MethodPost, "/task", `{"template_name":"block-template","input":{"id":"block-during"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	// the tasks created before the block are not affected
+	tester.AddCall("getTaskBeforeBlock", http.MethodGet, "/task/{{.createBeforeBlock.id}}", "").
+		Headers(regularHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("state", task.StateTODO),
+		)
+
+	tester.AddCall("unblockNotAdmin", http.MethodPost, "/template/block-template/unblock", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("unblock", http.MethodPost, "/template/block-template/unblock", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("blocked", "false"),
+		)
+
+	tester.AddCall("createUnblocked", http.MethodPost, "/task", `{"template_name":"block-template","input":{"id":"block-after"}}`).
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(201))
+
+	tester.Run()
+
+	// blocking doesn't change the content of the template, nor its version
+	tt, err := tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.Blocked {
+		t.Fatal("template should have been unblocked")
+	}
+	if tt.Version != before.Version {
+		t.Fatalf("template version changed from %d to %d", before.Version, tt.Version)
+	}
+}
+
+func TestHaltTemplate(t *testing.T) {
+	tester := iffy.NewTester(t, hdl)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := dummyTemplate()
+	tmpl.Name = "halt-template"
+	_, err = tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if err := dbp.DB().Insert(&tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tt, err := tasktemplate.LoadFromName(dbp, tmpl.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unresolved := func(id string) *task.Task {
+		tsk, err := task.Create(dbp, tt, adminUser, task.CreateOptions{Input: map[string]interface{}{"id": id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tsk
+	}
+	withState := func(id, state string) *resolution.Resolution {
+		res, err := resolution.Create(dbp, unresolved(id), nil, adminUser, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.SetState(state)
+		if err := res.Update(dbp); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	blocked := withState("halt-blocked", resolution.StateBlockedMaxRetries)
+	paused := withState("halt-paused", resolution.StatePaused)
+	running := withState("halt-running", resolution.StateRunning)
+	done := withState("halt-done", resolution.StateDone)
+	todo := unresolved("halt-todo")
+
+	expectState := func(res *resolution.Resolution, resState, taskState string) {
+		t.Helper()
+		reloaded, err := resolution.LoadFromPublicID(dbp, res.PublicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reloaded.State != resState {
+			t.Fatalf("resolution %s in state %s, expected %s", res.PublicID, reloaded.State, resState)
+		}
+		tsk, err := task.LoadFromID(dbp, res.TaskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tsk.State != taskState {
+			t.Fatalf("task %s in state %s, expected %s", tsk.PublicID, tsk.State, taskState)
+		}
+	}
+	expectHalt := func(res *resolution.Resolution, state string) {
+		t.Helper()
+		halt, err := resolution.LoadHalt(dbp, res.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if halt != state {
+			t.Fatalf("resolution %s halted in state %q, expected %q", res.PublicID, halt, state)
+		}
+	}
+
+	tester.AddCall("haltNotAdmin", http.MethodPost, "/template/halt-template/halt", "").
+		Headers(regularHeaders).
+		Checkers(iffy.ExpectStatus(403))
+
+	tester.AddCall("haltUnknownAction", http.MethodPost, "/template/halt-template/halt?action=stop", "").
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	// the running resolution is halted at the end of its run, the task without a resolution is left as is
+	tester.AddCall("pause", http.MethodPost, "/template/halt-template/halt?action=pause&block=true", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("halted", "1"),
+			iffy.ExpectJSONBranch("halting", "1"),
+			iffy.ExpectJSONBranch("unresolved", "1"),
+			iffy.ExpectJSONBranch("skipped", "0"),
+			iffy.ExpectJSONBranch("blocked", "true"),
+		)
+
+	tester.AddCall("createBlocked", http.MethodPost, "/task", `{"template_name":"halt-template","input":{"id":"halt-new"}}`).
+		Headers(adminHeaders).
+		Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+
+	expectState(blocked, resolution.StatePaused, task.StateTODO)
+	expectState(paused, resolution.StatePaused, task.StateTODO)
+	expectState(running, resolution.StateRunning, task.StateTODO)
+	expectHalt(running, resolution.StatePaused)
+	expectState(done, resolution.StateDone, task.StateTODO)
+
+	// cancelling takes over the pause, and closes the task without a resolution
+	tester = iffy.NewTester(t, hdl)
+	tester.AddCall("cancel", http.MethodPost, "/template/halt-template/halt", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("halted", "2"),
+			iffy.ExpectJSONBranch("halting", "1"),
+			iffy.ExpectJSONBranch("unresolved", "1"),
+			iffy.ExpectJSONBranch("skipped", "0"),
+		)
+	tester.AddCall("cancelAgain", http.MethodPost, "/template/halt-template/halt", "").
+		Headers(adminHeaders).
+		Checkers(
+			iffy.ExpectStatus(200),
+			iffy.ExpectJSONBranch("halted", "0"),
+			iffy.ExpectJSONBranch("halting", "1"),
+			iffy.ExpectJSONBranch("unresolved", "0"),
+		)
+	tester.Run()
+
+	expectState(blocked, resolution.StateCancelled, task.StateCancelled)
+	expectState(paused, resolution.StateCancelled, task.StateCancelled)
+	expectState(running, resolution.StateRunning, task.StateTODO)
+	expectHalt(running, resolution.StateCancelled)
+	expectState(done, resolution.StateDone, task.StateTODO)
+
+	tsk, err := task.LoadFromPublicID(dbp, todo.PublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tsk.State != task.StateWontfix {
+		t.Fatalf("task without a resolution in state %s, expected %s", tsk.State, task.StateWontfix)
+	}
+
+	// the resolution isn't running anymore, for the other tests
+	if _, err := dbp.DB().Exec(`UPDATE "resolution" SET state = $1 WHERE id = $2`, resolution.StateDone, running.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectBatchGetTasks checks the tasks returned by BatchGetTasks, and the ones skipped, in order
+func expectBatchGetTasks(tasks, skipped []string) iffy.Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		var out struct {
+			Tasks []struct {
+				PublicID string `json:"id"`
+			} `json:"tasks"`
+			Skipped []struct {
+				PublicID string `json:"id"`
+				Reason   string `json:"reason"`
+			} `json:"skipped"`
+		}
+		if err := json.Unmarshal([]byte(body), &out); err != nil {
+			return err
+		}
+		var gotTasks, gotSkipped []string
+		for _, t := range out.Tasks {
+			gotTasks = append(gotTasks, t.PublicID)
+		}
+		for _, s := range out.Skipped {
+			if s.Reason == "" {
+				return fmt.Errorf("task %q skipped without a reason", s.PublicID)
+			}
+			gotSkipped = append(gotSkipped, s.PublicID)
+		}
+		if strings.Join(gotTasks, ",") != strings.Join(tasks, ",") {
+			return fmt.Errorf("unexpected tasks: expected %v, got %v", tasks, gotTasks)
+		}
+		if strings.Join(gotSkipped, ",") != strings.Join(skipped, ",") {
+			return fmt.Errorf("unexpected skipped tasks: expected %v, got %v", skipped, gotSkipped)
+		}
+		return nil
+	}
+}
+
+func waitChecker(dur time.Duration) iffy.Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		time.Sleep(dur)
+		return nil
+	}
+}
+
+func templatesWithInvalidInputs() []tasktemplate.TaskTemplate {
+	var tt []tasktemplate.TaskTemplate
+	for _, inp := range []input.Input{
+		{
+			Name:        "input-with-redundant-regex",
+			LegalValues: []interface{}{"a", "b", "c"},
+			Regex:       strPtr("^d.+$"),
+		},
+		{
+			Name:  "input-with-bad-regex",
+			Regex: strPtr("^^[d.+$"),
+		},
+		{
+			Name: "input-with-bad-type",
+			Type: "bad-type",
+		},
+		{
+			Name:        "input-with-bad-legal-values",
+			Type:        "number",
+			LegalValues: []interface{}{"a", "b", "c"},
+		},
+	} {
+		tt = append(tt, tasktemplate.TaskTemplate{
+			Name:        "invalid-template",
+			Description: "Invalid template",
+			TitleFormat: "Invalid template",
+			Inputs: []input.Input{
+				inp,
+			},
+		})
+	}
+	return tt
+}
+
+func templateWithPasswordInput() tasktemplate.TaskTemplate {
+	return tasktemplate.TaskTemplate{
+		Name:        "input-password",
+		Description: "input-password",
+		TitleFormat: "input-password",
+		ResultFormat: map[string]interface{}{
+			"revealed": "{{.step.stepOne.output.showSecret}}",
+		},
+		Inputs: []input.Input{
 			{
 				Name: "verysecret",
 				Type: "password",
@@ -678,6 +2314,34 @@ func templateWithPasswordInput() tasktemplate.TaskTemplate {
 	}
 }
 
+func templateWithSecretInput() tasktemplate.TaskTemplate {
+	return tasktemplate.TaskTemplate{
+		Name:        "input-secret",
+		Description: "input-secret",
+		TitleFormat: "input-secret",
+		ResultFormat: map[string]interface{}{
+			"length":   "{{.step.stepOne.output.length}}",
+			"revealed": "{{.step.stepOne.output.showSecret}}",
+		},
+		Inputs: []input.Input{
+			{
+				Name:   "verysecret",
+				Secret: true,
+			},
+		},
+		Steps: map[string]*step.Step{
+			"stepOne": {
+				Action: executor.Executor{
+					Type: "echo",
+					Configuration: json.RawMessage(`{
+						"output": {"showSecret":"{{.input.verysecret}}", "length":"{{len .input.verysecret}}"}
+					}`),
+				},
+			},
+		},
+	}
+}
+
 func resolverInputTemplate() tasktemplate.TaskTemplate {
 	return tasktemplate.TaskTemplate{
 		Name:        "resolver-input-template",
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/wI2L/fizz"
+
+	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/correlation"
+	"github.com/cneill/utask/pkg/metadata"
+)
+
+// AuditRecord describes a mutating action performed through the API
+type AuditRecord struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	Actor         string                 `json:"actor"`
+	Action        string                 `json:"action"`
+	TargetID      string                 `json:"target_id,omitempty"`
+	Success       bool                   `json:"success"`
+	Status        int                    `json:"status"`
+	SUDO          bool                   `json:"sudo,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// AuditSink receives the audit records of the mutating actions.
+// Emit is called synchronously at the end of each request: implementations
+// shipping records to a remote system (kafka, syslog...) should buffer them
+// rather than block the response
+type AuditSink interface {
+	Emit(record *AuditRecord) error
+}
+
+// WriterAuditSink writes the audit records to an io.Writer, one json document per line
+type WriterAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterAuditSink returns an AuditSink writing to w, e.g. an opened file
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+// NewStdoutAuditSink returns an AuditSink writing to the standard output
+func NewStdoutAuditSink() *WriterAuditSink {
+	return NewWriterAuditSink(os.Stdout)
+}
+
+// Emit implements AuditSink
+func (s *WriterAuditSink) Emit(record *AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// WithAuditSink adds a sink receiving an audit record for each mutating action
+// (any request other than GET, HEAD or OPTIONS) handled by the Server
+func (s *Server) WithAuditSink(sink AuditSink) {
+	if sink != nil {
+		s.auditSinks = append(s.auditSinks, sink)
+	}
+}
+
+// auditTargetKeys are the action metadata identifying the target of an action,
+// from the most specific to the least specific
+var auditTargetKeys = []string{
+	metadata.CommentID,
+	metadata.ResolutionID,
+	metadata.TaskID,
+	metadata.BatchID,
+	metadata.TemplateName,
+	metadata.FunctionName,
+}
+
+func auditSinksMiddleware(sinks []AuditSink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		record := newAuditRecord(c)
+		for _, sink := range sinks {
+			if err := sink.Emit(record); err != nil {
+				correlation.Logger(c.Request.Context()).WithError(err).WithFields(logrus.Fields{
+					"action":    record.Action,
+					"target_id": record.TargetID,
+				}).Error("failed to emit audit record")
+			}
+		}
+	}
+}
+
+func newAuditRecord(c *gin.Context) *AuditRecord {
+	record := &AuditRecord{
+		Timestamp:     time.Now(),
+		Actor:         auth.GetIdentity(c),
+		Action:        c.Request.Method + " " + c.FullPath(),
+		Success:       len(c.Errors) == 0 && c.Writer.Status() < http.StatusBadRequest,
+		Status:        c.Writer.Status(),
+		SUDO:          metadata.IsSUDO(c),
+		CorrelationID: correlation.FromContext(c.Request.Context()),
+		Metadata:      metadata.GetActionMetadata(c),
+	}
+	if op, _ := fizz.OperationFromContext(c); op != nil && op.ID != "" {
+		record.Action = op.ID
+	}
+	for _, key := range auditTargetKeys {
+		if v, ok := record.Metadata[key]; ok {
+			if id, ok := v.(string); ok && id != "" {
+				record.TargetID = id
+				break
+			}
+		}
+	}
+	return record
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/tonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wI2L/fizz"
+
+	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/metadata"
+)
+
+type auditIn struct {
+	ID string `path:"id"`
+}
+
+func TestAuditSinksMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	router := fizz.New()
+	router.Use(correlationMiddleware, func(c *gin.Context) {
+		c.Set(auth.IdentityProviderCtxKey, "admin")
+		c.Next()
+	}, auditSinksMiddleware([]AuditSink{NewWriterAuditSink(&buf)}))
+
+	router.GET("/task/:id", []fizz.OperationOption{fizz.ID("GetTask")}, tonic.Handler(func(c *gin.Context, in *auditIn) error {
+		return nil
+	}, 200))
+	router.DELETE("/task/:id", []fizz.OperationOption{fizz.ID("DeleteTask")}, tonic.Handler(func(c *gin.Context, in *auditIn) error {
+		metadata.AddActionMetadata(c, metadata.TaskID, in.ID)
+		if in.ID == "missing" {
+			return errors.NotFoundf("task")
+		}
+		return nil
+	}, 204))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/task/foo", nil),
+		httptest.NewRequest(http.MethodDelete, "/task/foo", nil),
+		httptest.NewRequest(http.MethodDelete, "/task/missing", nil),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// reads are not audited
+	dec := json.NewDecoder(&buf)
+	var records []AuditRecord
+	for dec.More() {
+		var record AuditRecord
+		require.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+
+	assert.Equal(t, "admin", records[0].Actor)
+	assert.Equal(t, "DeleteTask", records[0].Action)
+	assert.Equal(t, "foo", records[0].TargetID)
+	assert.True(t, records[0].Success)
+	assert.Equal(t, http.StatusNoContent, records[0].Status)
+	assert.NotEmpty(t, records[0].CorrelationID)
+	assert.False(t, records[0].Timestamp.IsZero())
+
+	assert.Equal(t, "missing", records[1].TargetID)
+	assert.False(t, records[1].Success)
+	assert.NotEqual(t, records[0].CorrelationID, records[1].CorrelationID)
+}
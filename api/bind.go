@@ -1,11 +1,14 @@
 package api
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"sigs.k8s.io/yaml"
@@ -21,8 +24,19 @@ const (
 
 	// absolute lower limit for configuration max body bytes: 1KB
 	lowerLimitMaxBodyBytes = 1024
+
+	// default max compressed body bytes, before decompression: 1MB
+	// this can be overridden via configuration, within the same absolute limits
+	defaultMaxCompressedBodyBytes = 1024 * 1024
 )
 
+// defaultRouteMaxBodyBytes lists the routes legitimately receiving bigger bodies than the others,
+// they can be overridden via configuration as well
+var defaultRouteMaxBodyBytes = map[string]int64{
+	"/batch":           upperLimitMaxBodyBytes,
+	"/template/import": upperLimitMaxBodyBytes,
+}
+
 var yamlBind = yamlBinding{}
 
 type yamlBinding struct{}
@@ -40,20 +54,35 @@ func (yamlBinding) Bind(req *http.Request, obj interface{}) error {
 // defaultBindingHook is a wrapper around the yaml binding.
 // It adds the possibility to bind a specific field in an object rather than
 // unconditionally binding the whole object.
-func defaultBindingHook(maxBodyBytes int64) func(*gin.Context, interface{}) error {
-	if maxBodyBytes == 0 {
-		maxBodyBytes = defaultMaxBodyBytes
-	} else if maxBodyBytes > upperLimitMaxBodyBytes {
-		maxBodyBytes = upperLimitMaxBodyBytes
-	} else if maxBodyBytes < lowerLimitMaxBodyBytes {
-		maxBodyBytes = lowerLimitMaxBodyBytes
+// The body size is limited by maxBodyBytes, unless the route has its own limit in routeMaxBodyBytes
+// (keyed by route path, e.g. "/task/:id/comment") or in defaultRouteMaxBodyBytes.
+// A body compressed with gzip or deflate (Content-Encoding) is decompressed: its decompressed size
+// is limited as any other body, so that a small compressed body can't expand indefinitely, and
+// its compressed size is limited by maxCompressedBodyBytes as well.
+func defaultBindingHook(maxBodyBytes, maxCompressedBodyBytes int64, routeMaxBodyBytes map[string]int64) func(*gin.Context, interface{}) error {
+	maxBodyBytes = boundMaxBodyBytes(maxBodyBytes)
+	maxCompressedBodyBytes = boundMaxCompressedBodyBytes(maxCompressedBodyBytes)
+
+	routeLimits := make(map[string]int64, len(defaultRouteMaxBodyBytes)+len(routeMaxBodyBytes))
+	for route, max := range defaultRouteMaxBodyBytes {
+		routeLimits[route] = max
+	}
+	for route, max := range routeMaxBodyBytes {
+		routeLimits[route] = boundMaxBodyBytes(max)
 	}
 
 	return func(c *gin.Context, v interface{}) error {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+		limit := maxBodyBytes
+		if routeLimit, ok := routeLimits[c.FullPath()]; ok {
+			limit = routeLimit
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 		if c.Request.ContentLength == 0 || c.Request.Method == http.MethodGet {
 			return nil
 		}
+		if err := decompressBody(c, min(limit, maxCompressedBodyBytes), limit); err != nil {
+			return err
+		}
 
 		val := reflect.ValueOf(v)
 		typ := reflect.TypeOf(v).Elem()
@@ -87,6 +116,66 @@ func defaultBindingHook(maxBodyBytes int64) func(*gin.Context, interface{}) erro
 	}
 }
 
+// decompressedBody closes both the decompressor and the compressed body it reads from
+type decompressedBody struct {
+	io.ReadCloser
+	compressed io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.compressed.Close()
+}
+
+// decompressBody replaces a request body compressed with gzip or deflate by its decompressed content,
+// limited to maxBodyBytes, the compressed content being limited to maxCompressedBodyBytes
+func decompressBody(c *gin.Context, maxCompressedBodyBytes, maxBodyBytes int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+
+	var newDecompressor func(io.Reader) (io.ReadCloser, error)
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		newDecompressor = func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+	case "deflate":
+		newDecompressor = zlib.NewReader
+	default:
+		return fmt.Errorf("unsupported Content-Encoding %q: expected gzip or deflate", encoding)
+	}
+
+	compressed := http.MaxBytesReader(c.Writer, c.Request.Body, maxCompressedBodyBytes)
+	decompressor, err := newDecompressor(compressed)
+	if err != nil {
+		return fmt.Errorf("error decompressing request body: %s", err.Error())
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, decompressedBody{ReadCloser: decompressor, compressed: compressed}, maxBodyBytes)
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.ContentLength = -1
+	return nil
+}
+
+// boundMaxBodyBytes applies the default and absolute limits to a configured max body bytes
+func boundMaxBodyBytes(maxBodyBytes int64) int64 {
+	if maxBodyBytes == 0 {
+		return defaultMaxBodyBytes
+	} else if maxBodyBytes > upperLimitMaxBodyBytes {
+		return upperLimitMaxBodyBytes
+	} else if maxBodyBytes < lowerLimitMaxBodyBytes {
+		return lowerLimitMaxBodyBytes
+	}
+	return maxBodyBytes
+}
+
+// boundMaxCompressedBodyBytes applies the default and absolute limits to a configured max compressed body bytes
+func boundMaxCompressedBodyBytes(maxCompressedBodyBytes int64) int64 {
+	if maxCompressedBodyBytes == 0 {
+		return defaultMaxCompressedBodyBytes
+	}
+	return boundMaxBodyBytes(maxCompressedBodyBytes)
+}
+
 func jsonNumberOpt(dec *json.Decoder) *json.Decoder {
 	dec.UseNumber()
 	return dec
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bindTestIn struct {
+	Content string `json:"content"`
+}
+
+// bindTestRouter binds the body of the requests to a few routes with the given hook,
+// answering 400 when the binding fails
+func bindTestRouter(hook func(*gin.Context, interface{}) error) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		var in bindTestIn
+		if err := hook(c, &in); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%d", len(in.Content))
+	}
+	router.POST("/task", handler)
+	router.POST("/task/:id/comment", handler)
+	router.POST("/batch", handler)
+	return router
+}
+
+func bindBody(router *gin.Engine, path string, size int) *httptest.ResponseRecorder {
+	body := `{"content":"` + strings.Repeat("a", size) + `"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+func Test_defaultBindingHookRouteLimits(t *testing.T) {
+	router := bindTestRouter(defaultBindingHook(4096, 0, map[string]int64{
+		"/task/:id/comment": 1024,
+	}))
+
+	// the comment route hits its own limit, below the global one
+	w := bindBody(router, "/task/foo/comment", 2048)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request body too large")
+	assert.Equal(t, http.StatusOK, bindBody(router, "/task/foo/comment", 512).Code)
+
+	// while the other routes keep the global limit
+	assert.Equal(t, http.StatusOK, bindBody(router, "/task", 2048).Code)
+	assert.Equal(t, http.StatusBadRequest, bindBody(router, "/task", 8192).Code)
+
+	// batch creation has a bigger limit by default, not shared with the other routes
+	assert.Equal(t, http.StatusOK, bindBody(router, "/batch", 64*1024).Code)
+	assert.Equal(t, http.StatusBadRequest, bindBody(router, "/task", 64*1024).Code)
+}
+
+func Test_defaultBindingHookRouteOverride(t *testing.T) {
+	// a route can be given a bigger limit than the global one, or a smaller default one
+	router := bindTestRouter(defaultBindingHook(2048, 0, map[string]int64{
+		"/task/:id/comment": 16 * 1024,
+		"/batch":            4096,
+	}))
+
+	assert.Equal(t, http.StatusOK, bindBody(router, "/task/foo/comment", 8192).Code)
+	assert.Equal(t, http.StatusBadRequest, bindBody(router, "/task", 8192).Code)
+	assert.Equal(t, http.StatusBadRequest, bindBody(router, "/batch", 8192).Code)
+
+	// route limits are bounded as the global one
+	router = bindTestRouter(defaultBindingHook(2048, 0, map[string]int64{
+		"/task/:id/comment": 1,
+	}))
+	assert.Equal(t, http.StatusOK, bindBody(router, "/task/foo/comment", lowerLimitMaxBodyBytes/2).Code)
+	assert.Equal(t, http.StatusBadRequest, bindBody(router, "/task/foo/comment", lowerLimitMaxBodyBytes).Code)
+}
+
+func TestServerMaxBodyBytes(t *testing.T) {
+	s := NewServer()
+	s.SetMaxBodyBytes(2048)
+	s.SetRouteMaxBodyBytes("/task/:id/comment", 1024)
+
+	assert.Equal(t, int64(1024), s.MaxBodyBytes("/task/:id/comment"))
+	assert.Equal(t, int64(2048), s.MaxBodyBytes("/task"))
+	assert.Equal(t, int64(upperLimitMaxBodyBytes), s.MaxBodyBytes("/batch"))
+
+	// overriding a route leaves the global limit untouched
+	s.SetRouteMaxBodyBytes("/batch", 4096)
+	assert.Equal(t, int64(4096), s.MaxBodyBytes("/batch"))
+	assert.Equal(t, int64(2048), s.MaxBodyBytes("/task"))
+}
+
+func compressBody(t *testing.T, encoding, content string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		w = gzip.NewWriter(&buf)
+	}
+	_, err := io.WriteString(w, `{"content":"`+content+`"}`)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func bindCompressedBody(router *gin.Engine, path, encoding string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", encoding)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func Test_defaultBindingHookCompressedBody(t *testing.T) {
+	router := bindTestRouter(defaultBindingHook(16*1024, 4096, nil))
+
+	// compressed bodies are decompressed before being bound
+	for _, encoding := range []string{"gzip", "x-gzip", "deflate"} {
+		w := bindCompressedBody(router, "/task", encoding, compressBody(t, encoding, strings.Repeat("a", 8192)))
+		assert.Equal(t, http.StatusOK, w.Code, encoding)
+		assert.Equal(t, "8192", w.Body.String(), encoding)
+	}
+
+	// a gzip bomb is cut at the max body bytes once decompressed
+	bomb := compressBody(t, "gzip", strings.Repeat("a", 1024*1024))
+	require.Less(t, len(bomb), 4096)
+	w := bindCompressedBody(router, "/task", "gzip", bomb)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request body too large")
+
+	// the compressed size has its own limit: an incompressible content accepted as is
+	// is refused once compressed beyond the max compressed body bytes
+	random := make([]byte, 8192)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+	content := base64.RawStdEncoding.EncodeToString(random)
+	compressed := compressBody(t, "gzip", content)
+	require.Greater(t, len(compressed), 4096)
+	w = bindCompressedBody(router, "/task", "gzip", compressed)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request body too large")
+	assert.Equal(t, http.StatusOK, bindBody(router, "/task", len(content)).Code)
+
+	// unsupported or corrupted encodings are refused
+	w = bindCompressedBody(router, "/task", "br", []byte(`{"content":"a"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unsupported Content-Encoding "br"`)
+
+	w = bindCompressedBody(router, "/task", "gzip", []byte(`{"content":"a"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "error decompressing request body")
+}
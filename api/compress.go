@@ -0,0 +1,234 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask/pkg/compress"
+)
+
+// compressionMinBytes is the size under which a response is sent as is,
+// the compression overhead not being worth it
+const compressionMinBytes = 1024
+
+// compressedContentTypes lists the prefixes of the content types already compressed
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/octet-stream",
+}
+
+// compressionMiddleware compresses the responses with the algorithm of pkg/compress preferred by the client
+// (Accept-Encoding), skipping the small and already compressed ones. Responses are streamed: only their
+// first compressionMinBytes are held, to decide whether they are worth compressing
+func compressionMiddleware(c *gin.Context) {
+	encoding, algorithm := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+	// the connections upgraded to websockets are taken over by their handler
+	if algorithm == nil || strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		c.Next()
+		return
+	}
+
+	originalWriter := c.Writer
+	cw := &compressWriter{
+		ResponseWriter: originalWriter,
+		encoding:       encoding,
+		algorithm:      algorithm,
+		status:         defaultStatus,
+		size:           notWrittenSize,
+	}
+	cw.Header().Add("Vary", "Accept-Encoding")
+	c.Writer = cw
+	c.Next()
+	c.Writer = originalWriter
+
+	if err := cw.close(); err != nil {
+		logrus.WithError(err).Error("unable to write response")
+	}
+}
+
+// compressWriter holds the beginning of a response until it is big enough to be compressed,
+// then compresses the rest of it on the fly, or sends it as is
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding  string
+	algorithm compress.StreamCompression
+	status    int
+	size      int
+	buffer    []byte
+	started   bool                  // the headers were sent, the response is being streamed
+	stream    compress.StreamWriter // set when the response is compressed
+}
+
+// WriteHeader records the status of the response, sent along with its first bytes
+func (w *compressWriter) WriteHeader(code int) {
+	if code <= 0 || w.started {
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow marks the response as written, its headers being sent along with its first bytes
+func (w *compressWriter) WriteHeaderNow() {
+	if w.size == notWrittenSize {
+		w.size = 0
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(data)
+	if !w.started {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < compressionMinBytes {
+			return len(data), nil
+		}
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.stream != nil {
+		return w.stream.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Status() int {
+	return w.status
+}
+
+func (w *compressWriter) Size() int {
+	return w.size
+}
+
+func (w *compressWriter) Written() bool {
+	return w.size != notWrittenSize
+}
+
+// Flush sends the response written so far
+func (w *compressWriter) Flush() {
+	if err := w.start(); err != nil {
+		logrus.WithError(err).Error("unable to flush response")
+		return
+	}
+	if w.stream != nil {
+		if err := w.stream.Flush(); err != nil {
+			logrus.WithError(err).Error("unable to flush compressed response")
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start sends the headers of the response, compressing it if it is worth it, along with its first bytes
+func (w *compressWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	header := w.ResponseWriter.Header()
+	if compressible(header, len(w.buffer)) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.stream = w.algorithm.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	if w.stream != nil {
+		_, err := w.stream.Write(buffer)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffer)
+	return err
+}
+
+// close sends what is left of the response once the handler is done
+func (w *compressWriter) close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.stream != nil {
+		return w.stream.Close()
+	}
+	return nil
+}
+
+// negotiateEncoding returns the encoding of an Accept-Encoding header with a registered compression algorithm
+// able to compress a stream, preferred by the client: the highest quality value (q) wins, the first one
+// listed in case of a tie. The encodings refused with q=0 are ignored
+func negotiateEncoding(acceptEncoding string) (string, compress.StreamCompression) {
+	var (
+		bestEncoding  string
+		bestAlgorithm compress.StreamCompression
+		bestQuality   float64
+	)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(entry, ";")
+		encoding := strings.ToLower(strings.TrimSpace(params[0]))
+		if encoding == "" || encoding == "*" || encoding == "identity" || encoding == "noop" {
+			continue
+		}
+		quality := encodingQuality(params[1:])
+		if quality <= bestQuality {
+			continue
+		}
+		algorithm, err := compress.Get(encoding)
+		if err != nil {
+			continue
+		}
+		if streamAlgorithm, ok := algorithm.(compress.StreamCompression); ok {
+			bestEncoding, bestAlgorithm, bestQuality = encoding, streamAlgorithm, quality
+		}
+	}
+	return bestEncoding, bestAlgorithm
+}
+
+// encodingQuality returns the quality value (q) of an entry of an Accept-Encoding header, 1 by default
+// an invalid quality value refuses the encoding, as q=0 does
+func encodingQuality(params []string) float64 {
+	for _, param := range params {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || strings.TrimSpace(name) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 {
+			return 0
+		}
+		return min(q, 1)
+	}
+	return 1
+}
+
+func compressible(header http.Header, size int) bool {
+	if size < compressionMinBytes || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/compress"
+	"github.com/cneill/utask/pkg/compress/gzip"
+)
+
+func registerGzip(t *testing.T) {
+	if _, err := compress.Get(gzip.AlgorithmName); err != nil {
+		require.NoError(t, compress.RegisterAlgorithm(gzip.AlgorithmName, gzip.New()))
+	}
+}
+
+// deflateCompression is a stream compression algorithm, to negotiate between several of them
+type deflateCompression struct{}
+
+func (deflateCompression) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCompression) Decompress(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (deflateCompression) NewWriter(w io.Writer) compress.StreamWriter {
+	return zlib.NewWriter(w)
+}
+
+func registerDeflate(t *testing.T) {
+	if _, err := compress.Get("deflate"); err != nil {
+		require.NoError(t, compress.RegisterAlgorithm("deflate", deflateCompression{}))
+	}
+}
+
+func Test_negotiateEncoding(t *testing.T) {
+	registerGzip(t)
+	registerDeflate(t)
+
+	for _, tc := range []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"br, gzip;q=0.8", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip; q=0.0", ""},
+		{"gzip;q=invalid", ""},
+		{"gzip;level=1;q=0.5", "gzip"},
+		{"*", ""},
+		{"*, gzip", "gzip"},
+		{"identity", ""},
+		{"identity, gzip;q=1", "gzip"},
+		{"noop", ""},
+		{"br", ""},
+		{"gzip, deflate", "gzip"},
+		{"deflate, gzip", "deflate"},
+		{"gzip;q=0.5, deflate;q=0.9", "deflate"},
+		{"deflate;q=0.5, gzip", "gzip"},
+		{"deflate;q=0, gzip;q=0.1", "gzip"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br;q=1, gzip;q=0.2, deflate;q=0.1", "gzip"},
+	} {
+		encoding, algorithm := negotiateEncoding(tc.acceptEncoding)
+		assert.Equal(t, tc.expected, encoding, tc.acceptEncoding)
+		if tc.expected == "" {
+			assert.Nil(t, algorithm, tc.acceptEncoding)
+		} else {
+			assert.NotNil(t, algorithm, tc.acceptEncoding)
+		}
+	}
+}
+
+func Test_encodingQuality(t *testing.T) {
+	assert.Equal(t, 1.0, encodingQuality(nil))
+	assert.Equal(t, 1.0, encodingQuality([]string{"q=1"}))
+	assert.Equal(t, 1.0, encodingQuality([]string{"q=2"}))
+	assert.Equal(t, 0.001, encodingQuality([]string{" q = 0.001 "}))
+	assert.Equal(t, 1.0, encodingQuality([]string{"level=0"}))
+	assert.Equal(t, 0.5, encodingQuality([]string{"level=1", "q=0.5"}))
+	assert.Equal(t, 0.0, encodingQuality([]string{"q=0"}))
+	assert.Equal(t, 0.0, encodingQuality([]string{"q=0.000"}))
+	assert.Equal(t, 0.0, encodingQuality([]string{"q=-1"}))
+	assert.Equal(t, 0.0, encodingQuality([]string{"q="}))
+}
+
+func Test_compressible(t *testing.T) {
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+
+	assert.True(t, compressible(header("Content-Type", "application/json"), compressionMinBytes))
+	assert.True(t, compressible(header(), 10*compressionMinBytes))
+
+	// small bodies are sent as is
+	assert.False(t, compressible(header("Content-Type", "application/json"), compressionMinBytes-1))
+	assert.False(t, compressible(header(), 0))
+
+	// as are the ones already compressed
+	assert.False(t, compressible(header("Content-Encoding", "gzip"), 10*compressionMinBytes))
+	for _, contentType := range []string{"image/png", "video/mp4", "audio/ogg", "application/zip", "application/gzip", "application/x-gzip", "application/octet-stream", "IMAGE/JPEG"} {
+		assert.False(t, compressible(header("Content-Type", contentType), 10*compressionMinBytes), contentType)
+	}
+	assert.True(t, compressible(header("Content-Type", "text/plain; charset=utf-8"), 10*compressionMinBytes))
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registerGzip(t)
+
+	large := strings.Repeat("a", 2*compressionMinBytes)
+	router := gin.New()
+	router.Use(compressionMiddleware)
+	router.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "small") })
+	router.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	router.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/large", "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	body, err := gzip.New().Decompress(w.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	for _, tc := range []struct{ path, acceptEncoding string }{
+		{"/large", "gzip;q=0"},
+		{"/large", "identity"},
+		{"/small", "gzip"},
+		{"/image", "gzip"},
+	} {
+		w := get(tc.path, tc.acceptEncoding)
+		assert.Empty(t, w.Header().Get("Content-Encoding"), tc)
+		if tc.path == "/small" {
+			assert.Equal(t, "small", w.Body.String())
+		} else {
+			assert.Equal(t, large, w.Body.String(), tc)
+		}
+	}
+}
+
+func TestCompressionMiddlewareStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registerGzip(t)
+
+	chunk := strings.Repeat("b", compressionMinBytes)
+	flushed := make(chan int, 4)
+	router := gin.New()
+	router.Use(compressionMiddleware)
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		c.Status(http.StatusAccepted)
+		for i := 0; i < 4; i++ {
+			_, err := c.Writer.WriteString(chunk)
+			require.NoError(t, err)
+			c.Writer.Flush()
+			flushed <- i
+		}
+		// the handler sees what it wrote, not what was sent
+		assert.Equal(t, 4*len(chunk), c.Writer.Size())
+		assert.Equal(t, http.StatusAccepted, c.Writer.Status())
+	})
+	router.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	close(flushed)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.True(t, w.Flushed)
+	assert.Len(t, flushed, 4)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	body, err := gzip.New().Decompress(w.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(chunk, 4), string(body))
+
+	// a response too small to be compressed is sent as is
+	req = httptest.NewRequest(http.MethodGet, "/empty", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Body.String())
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/tonic/utils/jujerr"
+
+	"github.com/cneill/utask/api/handler"
+	"github.com/cneill/utask/pkg/taskutils"
+)
+
+// errorHook maps the errors returned by the handlers to http status codes,
+// on top of the juju error types handled by jujerr
+func errorHook(c *gin.Context, e error) (int, interface{}) {
+	var quotaErr *taskutils.QuotaExceededError
+	if errors.As(e, &quotaErr) {
+		return http.StatusTooManyRequests, gin.H{`error`: e.Error()}
+	}
+	var conflictErr *handler.RevisionConflictError
+	if errors.As(e, &conflictErr) {
+		return http.StatusConflict, gin.H{`error`: e.Error()}
+	}
+	return jujerr.ErrHook(c, e)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cneill/utask/api/handler"
+	"github.com/cneill/utask/pkg/taskutils"
+)
+
+func TestErrorHook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	quotaErr := &taskutils.QuotaExceededError{Requester: "foo", Max: 3, Window: time.Hour}
+	status, body := errorHook(c, errors.Annotate(quotaErr, "Failed to create task"))
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, gin.H{"error": "Failed to create task: " + quotaErr.Error()}, body)
+
+	status, _ = errorHook(c, &handler.RevisionConflictError{Resource: "task", Given: 1, Current: 2})
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, _ = errorHook(c, errors.NotFoundf("task"))
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask/api/handler"
+)
+
+// etagMiddleware tags the successful responses of a GET route with an ETag,
+// hashing their serialized content (which carries the update timestamps of the resource),
+// prefixed by the revision of the resource when the handler gives it,
+// and answers 304 Not Modified to the requests whose If-None-Match header matches it
+func etagMiddleware(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.Next()
+		return
+	}
+
+	buffer := &bytes.Buffer{}
+	originalWriter := c.Writer
+	wb := &responseWriter{
+		ResponseWriter: originalWriter,
+		status:         defaultStatus,
+		size:           notWrittenSize,
+		bufwriter:      buffer,
+	}
+	c.Writer = wb
+	c.Next()
+	c.Writer = originalWriter
+
+	body := buffer.Bytes()
+	status := wb.Status()
+	if status == http.StatusOK && !originalWriter.Written() {
+		sum := sha256.Sum256(body)
+		digest := hex.EncodeToString(sum[:16])
+		etag := `"` + digest + `"`
+		// a resource with a revision gets an ETag its edits accept in their If-Match header
+		if revision, ok := c.Get(handler.RevisionContextKey); ok {
+			if rev, ok := revision.(int); ok {
+				etag = handler.RevisionETag(rev, digest)
+			}
+		}
+		wb.Header().Set("ETag", etag)
+		if etagMatch(c.GetHeader("If-None-Match"), etag) {
+			wb.Header().Del("Content-Type")
+			wb.Header().Del("Content-Length")
+			originalWriter.WriteHeader(http.StatusNotModified)
+			originalWriter.WriteHeaderNow()
+			return
+		}
+	}
+
+	if len(body) > 0 {
+		wb.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	originalWriter.WriteHeader(status)
+	originalWriter.WriteHeaderNow()
+	if len(body) == 0 {
+		return
+	}
+	if _, err := originalWriter.Write(body); err != nil {
+		logrus.WithError(err).Error("unable to write response")
+	}
+}
+
+// etagMatch tells if an If-None-Match header matches an ETag,
+// using the weak comparison of RFC 7232
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
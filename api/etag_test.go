@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/api/handler"
+)
+
+func Test_etagMatch(t *testing.T) {
+	const etag = `"abc"`
+
+	assert.True(t, etagMatch(`"abc"`, etag))
+	assert.True(t, etagMatch(`W/"abc"`, etag))
+	assert.True(t, etagMatch(`"foo", W/"abc"`, etag))
+	assert.True(t, etagMatch(`*`, etag))
+	assert.False(t, etagMatch(``, etag))
+	assert.False(t, etagMatch(`"foo"`, etag))
+	assert.False(t, etagMatch(`abc`, etag))
+	assert.False(t, etagMatch(`W/"abcd"`, etag))
+
+	// weak ETags match as well, with or without their prefix
+	assert.True(t, etagMatch(`W/"3-abc"`, `W/"3-abc"`))
+	assert.True(t, etagMatch(`"3-abc"`, `W/"3-abc"`))
+	assert.False(t, etagMatch(`W/"4-abc"`, `W/"3-abc"`))
+}
+
+func TestEtagMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content := "foo"
+	router := gin.New()
+	router.Use(etagMiddleware)
+	router.GET("/resource", func(c *gin.Context) { c.String(http.StatusOK, content) })
+	router.GET("/missing", func(c *gin.Context) { c.String(http.StatusNotFound, "not found") })
+	router.POST("/resource", func(c *gin.Context) { c.String(http.StatusOK, content) })
+
+	do := func(method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/resource", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "foo", w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// the same content gets the same etag, answered with 304 when the client holds it
+	w = do(http.MethodGet, "/resource", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	// weak validators match as well
+	w = do(http.MethodGet, "/resource", `"outdated", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// a new content gets a new etag
+	content = "bar"
+	w = do(http.MethodGet, "/resource", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bar", w.Body.String())
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// other responses and methods are passed through as is
+	w = do(http.MethodGet, "/missing", "*")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "not found", w.Body.String())
+	assert.Empty(t, w.Header().Get("ETag"))
+
+	w = do(http.MethodPost, "/resource", "*")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bar", w.Body.String())
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestEtagMiddlewareRevision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content, revision := "foo", 3
+	router := gin.New()
+	router.Use(etagMiddleware)
+	router.GET("/resource", func(c *gin.Context) {
+		c.Set(handler.RevisionContextKey, revision)
+		c.String(http.StatusOK, content)
+	})
+
+	do := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the ETag starts with the revision of the resource, for its edits to accept it in If-Match
+	w := do("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"3-`), etag)
+
+	w = do(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// a content changed without a new revision, such as a new comment, gets a new ETag
+	content = "bar"
+	w = do(etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"3-`))
+
+	revision = 4
+	w = do("")
+	assert.True(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"4-`))
+}
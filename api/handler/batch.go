@@ -2,27 +2,52 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
 
 	"github.com/cneill/utask"
+	"github.com/cneill/utask/engine"
+	"github.com/cneill/utask/models/resolution"
 	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/auth"
 	"github.com/cneill/utask/pkg/batch"
+	"github.com/cneill/utask/pkg/batchutils"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/metadata"
+	"github.com/cneill/utask/pkg/taskutils"
 	"github.com/cneill/utask/pkg/utils"
 )
 
 type createBatchIn struct {
-	TemplateName     string                   `json:"template_name" binding:"required"`
-	CommonInput      map[string]interface{}   `json:"common_input"`
-	Inputs           []map[string]interface{} `json:"inputs" binding:"required"`
-	Comment          string                   `json:"comment"`
-	WatcherUsernames []string                 `json:"watcher_usernames"`
-	WatcherGroups    []string                 `json:"watcher_groups"`
-	Tags             map[string]string        `json:"tags"`
+	TemplateName      string                   `json:"template_name" binding:"required"`
+	CommonInput       map[string]interface{}   `json:"common_input"`
+	Inputs            []map[string]interface{} `json:"inputs"`
+	Tasks             []*batchTaskIn           `json:"tasks"`
+	Comment           string                   `json:"comment"`
+	WatcherUsernames  []string                 `json:"watcher_usernames"`
+	WatcherGroups     []string                 `json:"watcher_groups"`
+	ResolverUsernames []string                 `json:"resolver_usernames"`
+	ResolverGroups    []string                 `json:"resolver_groups"`
+	Tags              map[string]string        `json:"tags"`
+	Priority          *int                     `json:"priority"`
+}
+
+// batchTaskIn describes a single task of a batch, with the settings overriding the batch's ones
+type batchTaskIn struct {
+	Input             map[string]interface{} `json:"input" binding:"required"`
+	WatcherUsernames  []string               `json:"watcher_usernames"`
+	WatcherGroups     []string               `json:"watcher_groups"`
+	ResolverUsernames []string               `json:"resolver_usernames"`
+	ResolverGroups    []string               `json:"resolver_groups"`
+	Tags              map[string]string      `json:"tags"`
 }
 
 // CreateBatch handles the creation of a collection of tasks based on the same template
-// one task is created for each element in the "inputs" slice
+// one task is created for each element in the "inputs" slice, or in the "tasks" slice
+// watchers, resolvers and tags of the batch apply to all its tasks:
+// the ones given for a single task in the "tasks" slice take precedence
 // all tasks share a common "batchID" which can be used as a listing filter on /task
 func CreateBatch(c *gin.Context, in *createBatchIn) (*task.Batch, error) {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
@@ -36,6 +61,33 @@ func CreateBatch(c *gin.Context, in *createBatchIn) (*task.Batch, error) {
 		return nil, err
 	}
 
+	if (in.Inputs == nil) == (in.Tasks == nil) {
+		return nil, errors.BadRequestf("Exactly one of inputs or tasks must be provided")
+	}
+
+	inputs := in.Inputs
+	var overrides []*batch.TaskOverride
+	if in.Tasks != nil {
+		inputs = make([]map[string]interface{}, 0, len(in.Tasks))
+		overrides = make([]*batch.TaskOverride, 0, len(in.Tasks))
+		for _, t := range in.Tasks {
+			if t == nil || t.Input == nil {
+				return nil, errors.BadRequestf("Missing input of a task")
+			}
+			if err := utils.ValidateTags(t.Tags); err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, t.Input)
+			overrides = append(overrides, &batch.TaskOverride{
+				WatcherUsernames:  t.WatcherUsernames,
+				WatcherGroups:     t.WatcherGroups,
+				ResolverUsernames: t.ResolverUsernames,
+				ResolverGroups:    t.ResolverGroups,
+				Tags:              t.Tags,
+			})
+		}
+	}
+
 	if err := dbp.Tx(); err != nil {
 		return nil, err
 	}
@@ -49,13 +101,17 @@ func CreateBatch(c *gin.Context, in *createBatchIn) (*task.Batch, error) {
 	metadata.AddActionMetadata(c, metadata.BatchID, b.PublicID)
 
 	_, err = batch.Populate(c, b, dbp, batch.TaskArgs{
-		TemplateName:     in.TemplateName,
-		Inputs:           in.Inputs,
-		CommonInput:      in.CommonInput,
-		Comment:          in.Comment,
-		WatcherUsernames: in.WatcherUsernames,
-		WatcherGroups:    in.WatcherGroups,
-		Tags:             in.Tags,
+		TemplateName:      in.TemplateName,
+		Inputs:            inputs,
+		CommonInput:       in.CommonInput,
+		Comment:           in.Comment,
+		WatcherUsernames:  in.WatcherUsernames,
+		WatcherGroups:     in.WatcherGroups,
+		ResolverUsernames: in.ResolverUsernames,
+		ResolverGroups:    in.ResolverGroups,
+		Tags:              in.Tags,
+		Priority:          in.Priority,
+		Overrides:         overrides,
 	})
 	if err != nil {
 		_ = dbp.Rollback()
@@ -69,3 +125,220 @@ func CreateBatch(c *gin.Context, in *createBatchIn) (*task.Batch, error) {
 
 	return b, nil
 }
+
+type getBatchIn struct {
+	PublicID string `path:"id,required"`
+}
+
+type getBatchOut struct {
+	*task.Batch
+	TasksTotal   int64            `json:"tasks_total"`
+	TasksRunning int64            `json:"tasks_running"`
+	TasksByState map[string]int64 `json:"tasks_by_state"`
+	Tasks        []*task.Task     `json:"tasks"`
+}
+
+// GetBatch returns a batch, with the state of its tasks
+// the batch is only displayed to users allowed to see each of its tasks
+func GetBatch(c *gin.Context, in *getBatchIn) (*getBatchOut, error) {
+	metadata.AddActionMetadata(c, metadata.BatchID, in.PublicID)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := task.LoadBatchFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := b.ListTasks(dbp)
+	if err != nil {
+		return nil, err
+	}
+
+	admin := auth.IsAdmin(c) == nil
+	if !admin {
+		templates := make(map[int64]*tasktemplate.TaskTemplate)
+		for _, t := range tasks {
+			tt, err := batchTemplate(dbp, templates, t.TemplateID)
+			if err != nil {
+				return nil, err
+			}
+
+			requester := auth.IsRequester(c, t) == nil
+			watcher := auth.IsWatcher(c, t) == nil
+			resolutionManager := auth.IsResolutionManager(c, tt, t, nil) == nil
+
+			if !requester && !watcher && !resolutionManager {
+				return nil, errors.Forbiddenf("Can't display batch details")
+			}
+		}
+	}
+
+	running, err := batchutils.RunningTasks(dbp, b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := batchutils.TasksByState(dbp, b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &getBatchOut{
+		Batch:        b,
+		TasksTotal:   int64(len(tasks)),
+		TasksRunning: running,
+		TasksByState: states,
+		Tasks:        tasks,
+	}, nil
+}
+
+type cancelBatchIn struct {
+	PublicID string `path:"id,required"`
+}
+
+type cancelBatchOut struct {
+	Cancelled []string `json:"cancelled"`
+	Running   []string `json:"running,omitempty"`
+}
+
+// CancelBatch changes the state of every task of a batch which is not over yet to WONTFIX,
+// cancelling their resolution if any, all at once
+// tasks whose resolution is currently running are left untouched, and listed as such
+// the caller must be allowed to cancel each of the tasks, otherwise none is cancelled
+func CancelBatch(c *gin.Context, in *cancelBatchIn) (*cancelBatchOut, error) {
+	metadata.AddActionMetadata(c, metadata.BatchID, in.PublicID)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := task.LoadBatchFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+
+	tasks, err := b.ListTasks(dbp)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	admin := auth.IsAdmin(c) == nil
+	reqUsername := auth.GetIdentity(c)
+	templates := make(map[int64]*tasktemplate.TaskTemplate)
+	out := &cancelBatchOut{Cancelled: []string{}}
+	cancelled := make([]*task.Task, 0, len(tasks))
+
+	for _, t := range tasks {
+		if utils.ListContainsString(batchutils.FinalStates, t.State) {
+			continue
+		}
+
+		tt, err := batchTemplate(dbp, templates, t.TemplateID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		var r *resolution.Resolution
+		if t.Resolution != nil {
+			r, err = resolution.LoadLockedNoWaitFromPublicID(dbp, *t.Resolution)
+			if err != nil {
+				dbp.Rollback()
+				return nil, err
+			}
+		}
+
+		requester := auth.IsRequester(c, t) == nil
+		resolutionManager := auth.IsResolutionManager(c, tt, t, r) == nil
+
+		if !admin && !requester && !resolutionManager {
+			dbp.Rollback()
+			return nil, errors.Forbiddenf("Can't cancel task %s of the batch", t.PublicID)
+		} else if !requester && !resolutionManager {
+			metadata.SetSUDO(c)
+		}
+
+		if r != nil {
+			switch r.State {
+			case resolution.StateRunning:
+				out.Running = append(out.Running, t.PublicID)
+				continue
+			case resolution.StateCancelled, resolution.StateDone:
+			default:
+				r.SetState(resolution.StateCancelled)
+				if err := r.Update(dbp); err != nil {
+					dbp.Rollback()
+					return nil, err
+				}
+			}
+		}
+
+		t.SetState(task.StateWontfix)
+
+		err = t.Update(dbp,
+			false, // skip validation of task contents, task is dead anyway
+			true,  // do record mark change with last activity timestamp
+		)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		_, err = task.CreateSystemComment(dbp, t, reqUsername, "changed task state to WONTFIX: batch cancelled")
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		out.Cancelled = append(out.Cancelled, t.PublicID)
+		cancelled = append(cancelled, t)
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	// c can't be used once the request is over, only its context is kept for the logs
+	ctx := c.Request.Context()
+	resumed := make(map[string]bool)
+	for _, t := range cancelled {
+		parentTask, err := taskutils.ShouldResumeParentTask(dbp, t)
+		if err == nil && parentTask != nil && !resumed[parentTask.PublicID] {
+			resumed[parentTask.PublicID] = true
+			resolutionID := *parentTask.Resolution
+			go func() {
+				correlation.Logger(ctx).WithFields(logrus.Fields{"task_id": parentTask.PublicID, "resolution_id": resolutionID}).Debugf("resuming resolution %q as batch %q was cancelled", resolutionID, b.PublicID)
+
+				_ = engine.GetEngine().ResolveWithContext(ctx, resolutionID, nil)
+			}()
+		}
+
+		resumeDependentTasks(ctx, dbp, t)
+	}
+
+	return out, nil
+}
+
+// batchTemplate loads the template of a task of a batch, once for all the tasks sharing it
+func batchTemplate(dbp zesty.DBProvider, templates map[int64]*tasktemplate.TaskTemplate, id int64) (*tasktemplate.TaskTemplate, error) {
+	if tt, ok := templates[id]; ok {
+		return tt, nil
+	}
+	tt, err := tasktemplate.LoadFromID(dbp, id)
+	if err != nil {
+		return nil, err
+	}
+	templates[id] = tt
+	return tt, nil
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
@@ -128,10 +131,17 @@ func GetComment(c *gin.Context, in *getCommentIn) (*task.Comment, error) {
 }
 
 type listCommentsIn struct {
-	TaskID string `path:"id, required"`
+	TaskID   string     `path:"id, required"`
+	Author   *string    `query:"author"`
+	Type     *string    `query:"type" enum:"user,system,error"`
+	After    *time.Time `query:"after"`
+	PageSize uint64     `query:"page_size"`
+	Last     *string    `query:"last"`
 }
 
-// ListComments return a list of comments related to a task
+// ListComments return a list of comments related to a task, oldest first
+// comments can be filtered by author, type and creation time (after)
+// a full page is followed by a link to the next one, starting after its last comment
 func ListComments(c *gin.Context, in *listCommentsIn) ([]*task.Comment, error) {
 	metadata.AddActionMetadata(c, metadata.TaskID, in.TaskID)
 
@@ -173,11 +183,29 @@ func ListComments(c *gin.Context, in *listCommentsIn) ([]*task.Comment, error) {
 		metadata.SetSUDO(c)
 	}
 
-	comments, err := task.LoadCommentsFromTaskID(dbp, t.ID)
+	filter := task.CommentFilter{
+		Author:   in.Author,
+		Type:     in.Type,
+		After:    in.After,
+		Last:     in.Last,
+		PageSize: normalizePageSize(in.PageSize),
+	}
+
+	comments, err := task.ListComments(dbp, t.ID, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	if uint64(len(comments)) == filter.PageSize {
+		lastC := comments[len(comments)-1].PublicID
+		c.Header(
+			linkHeader,
+			buildCommentNextLink(t.PublicID, in.Author, in.Type, in.After, filter.PageSize, lastC),
+		)
+	}
+
+	c.Header(pageSizeHeader, fmt.Sprintf("%v", filter.PageSize))
+
 	return comments, nil
 }
 
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/engine/input"
+	"github.com/cneill/utask/models/task"
 )
 
 const (
@@ -24,6 +26,16 @@ func obfuscateInput(defs []input.Input, inputs map[string]interface{}) map[strin
 	return inputs
 }
 
+// obfuscateSecretInput hides the sealed values of secret inputs, to every user
+func obfuscateSecretInput(inputs map[string]interface{}) map[string]interface{} {
+	for k, v := range inputs {
+		if input.IsSealed(v) {
+			inputs[k] = obfuscatedValue
+		}
+	}
+	return inputs
+}
+
 func deobfuscateNewInput(old, new map[string]interface{}) map[string]interface{} {
 	for k, v := range new {
 		if s, ok := v.(string); ok && s == obfuscatedValue {
@@ -33,21 +45,30 @@ func deobfuscateNewInput(old, new map[string]interface{}) map[string]interface{}
 	return new
 }
 
-func buildTemplateNextLink(pageSize uint64, last string) string {
+func buildTemplateNextLink(tags []string, pageSize uint64, last string) string {
 	values := &url.Values{}
+	for _, t := range tags {
+		values.Add("tag", t)
+	}
 	values.Add("page_size", strconv.FormatUint(pageSize, 10))
 	values.Add("last", last)
 	return buildLink("next", "/template", values.Encode())
 }
 
-func buildFunctionNextLink(pageSize uint64, last string) string {
+func buildFunctionNextLink(namePrefix, plugin *string, pageSize uint64, last string) string {
 	values := &url.Values{}
+	if namePrefix != nil {
+		values.Add("name_prefix", *namePrefix)
+	}
+	if plugin != nil {
+		values.Add("plugin", *plugin)
+	}
 	values.Add("page_size", strconv.FormatUint(pageSize, 10))
 	values.Add("last", last)
 	return buildLink("next", "/function", values.Encode())
 }
 
-func buildTaskNextLink(typ string, state, batch *string, pageSize uint64, last string) string {
+func buildTaskNextLink(typ string, state, batch *string, priority *int, resolver, watcher *string, period task.Period, pageSize uint64, last string) string {
 	values := &url.Values{}
 	values.Add("type", typ)
 	if state != nil {
@@ -56,6 +77,25 @@ func buildTaskNextLink(typ string, state, batch *string, pageSize uint64, last s
 	if batch != nil {
 		values.Add("batch", *batch)
 	}
+	if priority != nil {
+		values.Add("priority", strconv.Itoa(*priority))
+	}
+	if resolver != nil {
+		values.Add("resolver", *resolver)
+	}
+	if watcher != nil {
+		values.Add("watcher", *watcher)
+	}
+	for name, t := range map[string]*time.Time{
+		"created_after":  period.CreatedAfter,
+		"created_before": period.CreatedBefore,
+		"ended_after":    period.EndedAfter,
+		"ended_before":   period.EndedBefore,
+	} {
+		if t != nil {
+			values.Add(name, t.Format(time.RFC3339Nano))
+		}
+	}
 	values.Add("page_size", strconv.FormatUint(pageSize, 10))
 	values.Add("last", last)
 	return buildLink("next", "/task", values.Encode())
@@ -75,6 +115,35 @@ func buildResolutionNextLink(typ string, state *string, instID *uint64, pageSize
 	return buildLink("next", "/resolution", values.Encode())
 }
 
+func buildMyResolutionsNextLink(state, template *string, pageSize uint64, last string) string {
+	values := &url.Values{}
+	if state != nil {
+		values.Add("state", *state)
+	}
+	if template != nil {
+		values.Add("template", *template)
+	}
+	values.Add("page_size", strconv.FormatUint(pageSize, 10))
+	values.Add("last", last)
+	return buildLink("next", "/resolution/mine", values.Encode())
+}
+
+func buildCommentNextLink(taskID string, author, typ *string, after *time.Time, pageSize uint64, last string) string {
+	values := &url.Values{}
+	if author != nil {
+		values.Add("author", *author)
+	}
+	if typ != nil {
+		values.Add("type", *typ)
+	}
+	if after != nil {
+		values.Add("after", after.Format(time.RFC3339Nano))
+	}
+	values.Add("page_size", strconv.FormatUint(pageSize, 10))
+	values.Add("last", last)
+	return buildLink("next", "/task/"+taskID+"/comment", values.Encode())
+}
+
 func buildLink(label, path, query string) string {
 	u := &url.URL{
 		Path:     path,
@@ -10,40 +10,29 @@ import (
 )
 
 type listFunctionsIn struct {
-	PageSize uint64  `query:"page_size"`
-	Last     *string `query:"last"`
+	NamePrefix *string `query:"name_prefix"`
+	Plugin     *string `query:"plugin"`
+	PageSize   uint64  `query:"page_size"`
+	Last       *string `query:"last"`
 }
 
-// ListFunctions returns a list of available functions in simplified format (steps not included)
+// ListFunctions returns a list of available functions, which can be filtered
+// by name prefix and by the plugins they wrap
 func ListFunctions(c *gin.Context, in *listFunctionsIn) ([]*functions.Function, error) {
-	var ret = []*functions.Function{}
-
 	in.PageSize = normalizePageSize(in.PageSize)
 
-	list := functions.List()
-
-	// Get the offset on which get the functions
-	from := 0
-	if in.Last != nil && *in.Last != "" {
-		var value string
-		for from, value = range list {
-			if value == *in.Last {
-				from++
-				break
-			}
-		}
-	}
-
-	for i := from; i < len(list) && i < from+int(in.PageSize); i++ {
-		f, _ := functions.Get(list[i])
-		ret = append(ret, f)
-	}
+	ret := functions.ListFunctions(functions.ListFilter{
+		NamePrefix: in.NamePrefix,
+		Plugin:     in.Plugin,
+		Last:       in.Last,
+		PageSize:   in.PageSize,
+	})
 
 	if uint64(len(ret)) == in.PageSize {
 		last := ret[len(ret)-1].Name
 		c.Header(
 			linkHeader,
-			buildFunctionNextLink(in.PageSize, last),
+			buildFunctionNextLink(in.NamePrefix, in.Plugin, in.PageSize, last),
 		)
 	}
 
@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +20,11 @@ import (
 	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
 	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/metadata"
+	"github.com/cneill/utask/pkg/now"
+	pluginapproval "github.com/cneill/utask/pkg/plugins/builtin/approval"
+	"github.com/cneill/utask/pkg/utils"
 )
 
 type createResolutionIn struct {
@@ -79,6 +87,7 @@ func CreateResolution(c *gin.Context, in *createResolutionIn) (*resolution.Resol
 		}
 	}
 
+	var previous *resolution.Resolution
 	if in.StartOver {
 		if !admin && resolutionManager && !tt.AllowTaskStartOver {
 			_ = dbp.Rollback()
@@ -96,12 +105,13 @@ func CreateResolution(c *gin.Context, in *createResolutionIn) (*resolution.Resol
 			return nil, errors.BadRequestf("can't start over a task that isn't in status %q, %q or %q", resolution.StatePaused, resolution.StateBlockedBadRequest, resolution.StateCancelled)
 		}
 
-		logrus.WithFields(logrus.Fields{"resolution_id": res.PublicID, "task_id": t.PublicID}).Debugf("Handler CreateResolution: start-over the resolution, deleting old resolution %s", res.PublicID)
+		correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": res.PublicID, "task_id": t.PublicID}).Debugf("Handler CreateResolution: start-over the resolution, deleting old resolution %s", res.PublicID)
 
 		if err := res.Delete(dbp); err != nil {
 			_ = dbp.Rollback()
 			return nil, err
 		}
+		previous = res
 	}
 
 	r, err := resolution.Create(dbp, t, in.ResolverInputs, resUser, true, nil) // TODO accept delay in handler
@@ -111,13 +121,19 @@ func CreateResolution(c *gin.Context, in *createResolutionIn) (*resolution.Resol
 	}
 
 	metadata.AddActionMetadata(c, metadata.ResolutionID, r.PublicID)
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler CreateResolution: created resolution %s", r.PublicID)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler CreateResolution: created resolution %s", r.PublicID)
 
 	if err := dbp.Commit(); err != nil {
 		dbp.Rollback()
 		return nil, err
 	}
 
+	if previous != nil {
+		if err := previous.DeleteOutputs(c); err != nil {
+			correlation.Logger(c.Request.Context()).WithError(err).Warnf("Handler CreateResolution: failed to delete the stored outputs of resolution %s", previous.PublicID)
+		}
+	}
+
 	return r, nil
 }
 
@@ -176,6 +192,71 @@ func ListResolutions(c *gin.Context, in *listResolutionsIn) (rr []*resolution.Re
 	return rr, nil
 }
 
+// stateBlocked matches any of the BLOCKED_* resolution states when listing actionable resolutions
+const stateBlocked = "BLOCKED"
+
+type listMyResolutionsIn struct {
+	State    *string `query:"state"`
+	Template *string `query:"template"`
+	PageSize uint64  `query:"page_size"`
+	Last     *string `query:"last"`
+}
+
+// ListMyResolutions returns the resolutions waiting for a human action (TODO, PAUSED or BLOCKED_*),
+// for which the user is an allowed resolver
+// they can be filtered by template, and by state: BLOCKED matches any of the BLOCKED_* states
+// the resolutions are simplified and do not include the content of steps
+func ListMyResolutions(c *gin.Context, in *listMyResolutionsIn) (rr []*resolution.Resolution, err error) {
+	if in.Template != nil {
+		metadata.AddActionMetadata(c, metadata.TemplateName, *in.Template)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := resolution.ActionableFilter{
+		ResolverUsername: auth.GetIdentity(c),
+		ResolverGroups:   auth.GetGroups(c),
+		Template:         in.Template,
+		PageSize:         normalizePageSize(in.PageSize),
+		Last:             in.Last,
+	}
+
+	if in.State != nil {
+		switch {
+		case *in.State == stateBlocked:
+			for _, s := range resolution.ActionableStates {
+				if strings.HasPrefix(s, stateBlocked+"_") {
+					filter.States = append(filter.States, s)
+				}
+			}
+		case utils.ListContainsString(resolution.ActionableStates, *in.State):
+			filter.States = []string{*in.State}
+		default:
+			return nil, errors.BadRequestf("Unknown state for listing: '%s'. Was expecting '%s' or one of %s", *in.State, stateBlocked, strings.Join(resolution.ActionableStates, ", "))
+		}
+	}
+
+	rr, err = resolution.ListActionable(dbp, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(rr)) == filter.PageSize {
+		lastRes := rr[len(rr)-1].PublicID
+		c.Header(
+			linkHeader,
+			buildMyResolutionsNextLink(in.State, in.Template, filter.PageSize, lastRes),
+		)
+	}
+
+	c.Header(pageSizeHeader, fmt.Sprintf("%v", filter.PageSize))
+
+	return rr, nil
+}
+
 type getResolutionIn struct {
 	PublicID string `path:"id, required"`
 }
@@ -220,11 +301,14 @@ func GetResolution(c *gin.Context, in *getResolutionIn) (*resolution.Resolution,
 	if !resolutionManager && !admin {
 		r.ClearOutputs()
 	}
+	r.RedactSecrets()
 
 	if !resolutionManager && !requester && !watcher {
 		metadata.SetSUDO(c)
 	}
 
+	setRevision(c, r.Revision)
+
 	return r, nil
 }
 
@@ -232,12 +316,13 @@ type updateResolutionIn struct {
 	PublicID       string                 `path:"id, required"`
 	Steps          map[string]*step.Step  `json:"steps"` // persisted in encrypted blob
 	ResolverInputs map[string]interface{} `json:"resolver_inputs"`
+	Revision       *int                   `json:"revision"` // or given by the If-Match header
 }
 
 // UpdateResolution is a special handler reserved to administrators, which allows the
 // edition of a live resolution, in case a template mistake needs to be hotfixed
 // use sparingly, this opens the door to completely breaking execution
-// can only be called when resolution is in state PAUSED
+// can only be called when resolution is in state PAUSED, with its current revision
 func UpdateResolution(c *gin.Context, in *updateResolutionIn) error {
 	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
 
@@ -284,6 +369,11 @@ func UpdateResolution(c *gin.Context, in *updateResolutionIn) error {
 
 	metadata.SetSUDO(c)
 
+	if err := checkRevision(c, "resolution", in.Revision, r.Revision); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
 	if in.Steps != nil {
 		r.Steps = in.Steps
 
@@ -317,7 +407,7 @@ func UpdateResolution(c *gin.Context, in *updateResolutionIn) error {
 		r.SetInput(in.ResolverInputs)
 	}
 
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolution: manual update of resolution %s", r.PublicID)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolution: manual update of resolution %s", r.PublicID)
 
 	if err := r.Update(dbp); err != nil {
 		dbp.Rollback()
@@ -325,7 +415,7 @@ func UpdateResolution(c *gin.Context, in *updateResolutionIn) error {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually updated resolution")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually updated resolution")
 	if err != nil {
 		dbp.Rollback()
 		return err
@@ -341,10 +431,13 @@ func UpdateResolution(c *gin.Context, in *updateResolutionIn) error {
 
 type runResolutionIn struct {
 	PublicID string `path:"id, required"`
+	DryRun   bool   `query:"dry_run" description:"Describe what the resolution would do, without running it"`
 }
 
 // RunResolution launches the asynchronous execution of a resolution
 // the engine determines if resolution is eligible for execution
+// with dry_run, the engine describes the actions of the resolution instead,
+// rendered right away without running anything
 func RunResolution(c *gin.Context, in *runResolutionIn) error {
 	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
 
@@ -382,17 +475,36 @@ func RunResolution(c *gin.Context, in *runResolutionIn) error {
 		metadata.SetSUDO(c)
 	}
 
+	if in.DryRun {
+		metadata.AddActionMetadata(c, metadata.DryRun, true)
+		report, err := engine.DryRun(dbp, r.PublicID)
+		if err != nil {
+			return err
+		}
+		// the route renders no content for real runs
+		c.JSON(http.StatusOK, report)
+		return nil
+	}
+
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually ran resolution")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually ran resolution")
 	if err != nil {
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler RunResolution: manual resolve %s", r.PublicID)
+	// c can't be used once the request is over, only its context is kept for the logs
+	ctx := c.Request.Context()
+	correlation.Logger(ctx).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler RunResolution: manual resolve %s", r.PublicID)
+
+	return resolveInBackground(ctx, in.PublicID)
+}
 
+// resolveInBackground runs a resolution, returning its launch error if any
+func resolveInBackground(ctx context.Context, publicID string) error {
+	var err error
 	ch := make(chan struct{})
 	go func() {
-		err = engine.GetEngine().Resolve(in.PublicID, nil)
+		err = engine.GetEngine().ResolveWithContext(ctx, publicID, nil)
 		close(ch)
 	}()
 
@@ -465,10 +577,104 @@ func ExtendResolution(c *gin.Context, in *extendResolutionIn) error {
 		return errors.BadRequestf("Cannot extend a resolution which is not in state '%s'", resolution.StateBlockedMaxRetries)
 	}
 
-	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually extended resolution")
+	if err := extendResolution(dbp, r, t, tt, auth.GetIdentity(c)); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+type extendResolutionsIn struct {
+	Template *string           `json:"template"`
+	Tags     map[string]string `json:"tags"`
+	State    *string           `json:"state"`
+}
+
+type extendResolutionsOut struct {
+	Extended int `json:"extended"`
+}
+
+// ExtendResolutions increments the remaining execution retries of all the resolutions
+// matching a template, tags and a state (BLOCKED_MAXRETRIES by default), all at once
+// resolutions currently locked, e.g. running, are left untouched
+func ExtendResolutions(c *gin.Context, in *extendResolutionsIn) (*extendResolutionsOut, error) {
+	filter := resolution.ExtendableFilter{
+		Template: in.Template,
+		Tags:     in.Tags,
+	}
+
+	if in.State != nil {
+		if !utils.ListContainsString(resolution.ExtendableStates, *in.State) {
+			return nil, errors.BadRequestf("Cannot extend resolutions in state '%s'. Was expecting one of %s", *in.State, strings.Join(resolution.ExtendableStates, ", "))
+		}
+		filter.States = []string{*in.State}
+	}
+
+	if in.Template != nil {
+		metadata.AddActionMetadata(c, metadata.TemplateName, *in.Template)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+
+	rr, err := resolution.ListExtendable(dbp, filter)
 	if err != nil {
 		dbp.Rollback()
+		return nil, err
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	templates := make(map[int64]*tasktemplate.TaskTemplate)
+
+	for _, simplified := range rr {
+		r, err := resolution.LoadLockedFromPublicID(dbp, simplified.PublicID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		t, err := task.LoadFromID(dbp, r.TaskID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		tt, err := batchTemplate(dbp, templates, t.TemplateID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		if err := extendResolution(dbp, r, t, tt, reqUsername); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	return &extendResolutionsOut{Extended: len(rr)}, nil
+}
+
+// extendResolution grants a resolution as many executions as a new run of its template,
+// and resumes it right away if it was blocked by its retry limit
+func extendResolution(dbp zesty.DBProvider, r *resolution.Resolution, t *task.Task, tt *tasktemplate.TaskTemplate, reqUsername string) error {
+	if _, err := task.CreateSystemComment(dbp, t, reqUsername, "manually extended resolution"); err != nil {
 		return err
 	}
 
@@ -478,14 +684,130 @@ func ExtendResolution(c *gin.Context, in *extendResolutionIn) error {
 		r.ExtendRunMax(utask.DefaultRetryMax)
 	}
 
-	r.SetState(resolution.StateError)
-	r.SetNextRetry(time.Now())
+	if r.State == resolution.StateBlockedMaxRetries {
+		r.SetState(resolution.StateError)
+		r.SetNextRetry(time.Now())
+	}
+
+	return r.Update(dbp)
+}
+
+type scheduleResolutionIn struct {
+	PublicID string     `path:"id, required"`
+	At       *time.Time `json:"at"`
+	Delay    string     `json:"delay"`
+}
+
+// schedulableStates lists the states of the resolutions which can be scheduled:
+// the ones waiting for a callback, a dependency or an approval are resumed on their own,
+// and must not be run before
+var schedulableStates = []string{
+	resolution.StateTODO,
+	resolution.StatePaused,
+	resolution.StateError,
+	resolution.StateToAutorun,
+	resolution.StateToAutorunDelayed,
+	resolution.StateBlockedToCheck,
+	resolution.StateBlockedBadRequest,
+	resolution.StateBlockedDeadlock,
+	resolution.StateBlockedMaxRetries,
+	resolution.StateBlockedFatal,
+}
+
+// ScheduleResolution defers the next execution of a resolution to a given point in time,
+// either absolute or relative to now
+// the resolution is handed over to the retry collector, which runs it once that time is reached
+func ScheduleResolution(c *gin.Context, in *scheduleResolutionIn) error {
+	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
+
+	if (in.At == nil) == (in.Delay == "") {
+		return errors.BadRequestf("Exactly one of 'at' and 'delay' must be provided")
+	}
+
+	var at time.Time
+	if in.At != nil {
+		at = *in.At
+	} else {
+		delay, err := time.ParseDuration(in.Delay)
+		if err != nil {
+			return errors.NewBadRequest(err, "Invalid delay")
+		}
+		at = now.Get().Add(delay)
+	}
+	if !at.After(now.Get()) {
+		return errors.BadRequestf("Can't schedule a resolution in the past")
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return err
+	}
+
+	r, err := resolution.LoadLockedNoWaitFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	t, err := task.LoadFromID(dbp, r.TaskID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	admin := auth.IsAdmin(c) == nil
+	resolutionManager := auth.IsResolutionManager(c, tt, t, r) == nil
+
+	if !admin && !resolutionManager {
+		dbp.Rollback()
+		return errors.Forbiddenf("You are not allowed to schedule this resolution")
+	} else if !resolutionManager {
+		metadata.SetSUDO(c)
+	}
+
+	if !utils.ListContainsString(schedulableStates, r.State) {
+		dbp.Rollback()
+		return errors.BadRequestf("Can't schedule resolution while in state %s", r.State)
+	}
+
+	// delayed resolutions are picked up by the retry collector once next_retry is reached
+	r.SetState(resolution.StateToAutorunDelayed)
+	r.SetNextRetry(at)
+
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler ScheduleResolution: resolution %s scheduled at %s", r.PublicID, at)
 
 	if err := r.Update(dbp); err != nil {
 		dbp.Rollback()
 		return err
 	}
 
+	t.SetState(task.StateDelayed)
+	if err := t.Update(dbp, true, true); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, fmt.Sprintf("manually scheduled resolution at %s", at.Format(time.RFC3339)))
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
 	if err := dbp.Commit(); err != nil {
 		dbp.Rollback()
 		return err
@@ -565,7 +887,7 @@ func CancelResolution(c *gin.Context, in *cancelResolutionIn) error {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "cancelled resolution")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "cancelled resolution")
 	if err != nil {
 		dbp.Rollback()
 		return err
@@ -576,6 +898,8 @@ func CancelResolution(c *gin.Context, in *cancelResolutionIn) error {
 		return err
 	}
 
+	resumeDependentTasks(c.Request.Context(), dbp, t)
+
 	return nil
 }
 
@@ -647,7 +971,7 @@ func PauseResolution(c *gin.Context, in *pauseResolutionIn) error {
 
 	r.SetState(resolution.StatePaused)
 
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler PauseResolution: pause of resolution %s", r.PublicID)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler PauseResolution: pause of resolution %s", r.PublicID)
 
 	if err := r.Update(dbp); err != nil {
 		dbp.Rollback()
@@ -655,7 +979,7 @@ func PauseResolution(c *gin.Context, in *pauseResolutionIn) error {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually paused resolution")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually paused resolution")
 	if err != nil {
 		dbp.Rollback()
 		return err
@@ -721,11 +1045,15 @@ func GetResolutionStep(c *gin.Context, in *getResolutionStepIn) (*step.Step, err
 	if !resolutionManager && !admin {
 		r.ClearOutputs()
 	}
+	r.RedactSecrets()
 
 	if !resolutionManager && !requester && !watcher {
 		metadata.SetSUDO(c)
 	}
 
+	// the edits of a step are checked against the revision of its resolution
+	setRevision(c, r.Revision)
+
 	return step, nil
 }
 
@@ -733,12 +1061,13 @@ type updateResolutionStepIn struct {
 	step.Step
 	PublicID string `path:"id" validate:"required"`
 	StepName string `path:"stepName" validate:"required"`
+	Revision *int   `json:"revision"` // of the resolution, or given by the If-Match header
 }
 
 // UpdateResolutionStep is a special handler reserved to administrators, which allows the
 // edition of a live resolution. It's equivalent to UpdateResolution, but focus on a singular step
 // instead of live patch the whole resolution.
-// can only be called when resolution is in state PAUSED
+// can only be called when resolution is in state PAUSED, with its current revision
 func UpdateResolutionStep(c *gin.Context, in *updateResolutionStepIn) error {
 	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
 
@@ -784,6 +1113,11 @@ func UpdateResolutionStep(c *gin.Context, in *updateResolutionStepIn) error {
 
 	metadata.SetSUDO(c)
 
+	if err := checkRevision(c, "resolution", in.Revision, r.Revision); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
 	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
 	if err != nil {
 		dbp.Rollback()
@@ -792,6 +1126,8 @@ func UpdateResolutionStep(c *gin.Context, in *updateResolutionStepIn) error {
 
 	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
 
+	// the input override of the step is only edited through its own route, which records its author
+	in.Step.InputOverride = r.Steps[in.StepName].InputOverride
 	r.Steps[in.StepName] = &in.Step
 
 	if err := r.Steps[in.StepName].ValidAndNormalize(in.StepName, tt.BaseConfigurations, r.Steps); err != nil {
@@ -810,7 +1146,7 @@ func UpdateResolutionStep(c *gin.Context, in *updateResolutionStepIn) error {
 		return errors.NewBadRequest(nil, fmt.Sprintf("invalid state provided: %q is not allowed", in.State))
 	}
 
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolutionStep: manual update of resolution %s step %s", r.PublicID, in.StepName)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolutionStep: manual update of resolution %s step %s", r.PublicID, in.StepName)
 
 	if err := r.Update(dbp); err != nil {
 		dbp.Rollback()
@@ -818,7 +1154,126 @@ func UpdateResolutionStep(c *gin.Context, in *updateResolutionStepIn) error {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually updated resolution step "+in.StepName)
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually updated resolution step "+in.StepName)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+type overrideResolutionStepInputIn struct {
+	PublicID      string          `path:"id" validate:"required"`
+	StepName      string          `path:"stepName" validate:"required"`
+	Configuration json.RawMessage `json:"configuration" validate:"required"`
+}
+
+// OverrideResolutionStepInput is reserved to administrators: it sets the configuration of the action
+// of a step, used as is on its next runs instead of templating the configuration from the template.
+// Can only be called when resolution is in state PAUSED
+func OverrideResolutionStepInput(c *gin.Context, in *overrideResolutionStepInputIn) error {
+	return overrideResolutionStepInput(c, in.PublicID, in.StepName, in.Configuration)
+}
+
+type removeResolutionStepInputOverrideIn struct {
+	PublicID string `path:"id" validate:"required"`
+	StepName string `path:"stepName" validate:"required"`
+}
+
+// RemoveResolutionStepInputOverride is reserved to administrators: the configuration of the action
+// of a step is templated again on its next runs.
+// Can only be called when resolution is in state PAUSED
+func RemoveResolutionStepInputOverride(c *gin.Context, in *removeResolutionStepInputOverrideIn) error {
+	return overrideResolutionStepInput(c, in.PublicID, in.StepName, nil)
+}
+
+func overrideResolutionStepInput(c *gin.Context, publicID, stepName string, configuration json.RawMessage) error {
+	metadata.AddActionMetadata(c, metadata.ResolutionID, publicID)
+	metadata.AddActionMetadata(c, metadata.StepName, stepName)
+
+	if string(configuration) == "null" {
+		return errors.BadRequestf("A configuration is required to override the input of a step")
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return err
+	}
+
+	r, err := resolution.LoadLockedNoWaitFromPublicID(dbp, publicID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	s, ok := r.Steps[stepName]
+	if !ok {
+		dbp.Rollback()
+		return errors.NotFoundf("given stepName %q for this resolution", stepName)
+	}
+
+	t, err := task.LoadFromID(dbp, r.TaskID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
+
+	if r.State != resolution.StatePaused {
+		dbp.Rollback()
+		return errors.BadRequestf("Cannot update a resolution which is not in state '%s'", resolution.StatePaused)
+	}
+
+	if err := auth.IsAdmin(c); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.SetSUDO(c)
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	if configuration == nil && s.InputOverride == nil {
+		dbp.Rollback()
+		return errors.BadRequestf("The input of step %q is not overridden", stepName)
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	if err := s.SetInputOverride(r.BaseConfigurations, configuration, reqUsername); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	comment := "overrode the input of resolution step " + stepName
+	if configuration == nil {
+		comment = "removed the input override of resolution step " + stepName
+	}
+
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler overrideResolutionStepInput: %s", comment)
+
+	if err := r.Update(dbp); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, comment)
 	if err != nil {
 		dbp.Rollback()
 		return err
@@ -910,7 +1365,7 @@ func UpdateResolutionStepState(c *gin.Context, in *updateResolutionStepStateIn)
 		return errors.NewBadRequest(nil, fmt.Sprintf("invalid state provided: %q is not allowed", in.State))
 	}
 
-	logrus.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolutionStepState: manual update of resolution %s step %s state switched from %s to %s", r.PublicID, in.StepName, oldState, in.State)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler UpdateResolutionStepState: manual update of resolution %s step %s state switched from %s to %s", r.PublicID, in.StepName, oldState, in.State)
 	metadata.AddActionMetadata(c, metadata.OldState, oldState)
 	metadata.AddActionMetadata(c, metadata.NewState, s.State)
 
@@ -920,7 +1375,7 @@ func UpdateResolutionStepState(c *gin.Context, in *updateResolutionStepStateIn)
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually updated resolution step "+in.StepName+" state from "+oldState+" to "+in.State)
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually updated resolution step "+in.StepName+" state from "+oldState+" to "+in.State)
 	if err != nil {
 		dbp.Rollback()
 		return err
@@ -933,3 +1388,243 @@ func UpdateResolutionStepState(c *gin.Context, in *updateResolutionStepStateIn)
 
 	return nil
 }
+
+type decideResolutionStepIn struct {
+	PublicID string `path:"id" validate:"required"`
+	StepName string `path:"stepName" validate:"required"`
+	Reason   string `json:"reason"`
+}
+
+// ApproveResolutionStep approves a step of type approval waiting for a decision,
+// and resumes its resolution. Only the resolution managers can approve a step.
+func ApproveResolutionStep(c *gin.Context, in *decideResolutionStepIn) error {
+	return decideResolutionStep(c, in, true)
+}
+
+// RejectResolutionStep rejects a step of type approval waiting for a decision:
+// the step fails with the reason of the rejection, blocking its resolution.
+// Only the resolution managers can reject a step.
+func RejectResolutionStep(c *gin.Context, in *decideResolutionStepIn) error {
+	return decideResolutionStep(c, in, false)
+}
+
+func decideResolutionStep(c *gin.Context, in *decideResolutionStepIn, approved bool) error {
+	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
+	metadata.AddActionMetadata(c, metadata.StepName, in.StepName)
+
+	if !approved && strings.TrimSpace(in.Reason) == "" {
+		return errors.BadRequestf("A reason is required to reject a step")
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return err
+	}
+
+	r, err := resolution.LoadLockedNoWaitFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	s, ok := r.Steps[in.StepName]
+	if !ok {
+		dbp.Rollback()
+		return errors.NotFoundf("given stepName %q for this resolution", in.StepName)
+	}
+
+	t, err := task.LoadFromID(dbp, r.TaskID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	// the decision is recorded in the name of its author:
+	// admins can't take it on behalf of the resolution managers
+	if auth.IsResolutionManager(c, tt, t, r) != nil {
+		dbp.Rollback()
+		return errors.Forbiddenf("Only the resolution managers can approve or reject a step")
+	}
+
+	if s.Action.Type != pluginapproval.Plugin.PluginName() {
+		dbp.Rollback()
+		return errors.BadRequestf("Step %q is not an approval step", in.StepName)
+	}
+
+	if s.State != step.StateWaiting {
+		dbp.Rollback()
+		return errors.BadRequestf("Step %q is not waiting for approval", in.StepName)
+	}
+
+	switch r.State {
+	case resolution.StateBlockedApproval, resolution.StateWaiting:
+	default:
+		dbp.Rollback()
+		return errors.BadRequestf("Cannot approve or reject a step of a resolution in state '%s'", r.State)
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	oldState := s.State
+
+	s.Output = pluginapproval.Output(approved, reqUsername, in.Reason, now.Get())
+	r.Values.SetOutput(in.StepName, s.Output)
+
+	comment := "approved resolution step " + in.StepName
+	if approved {
+		s.Error = ""
+		r.SetStepState(in.StepName, step.StateDone)
+	} else {
+		comment = "rejected resolution step " + in.StepName
+		s.Error = pluginapproval.RejectionError(reqUsername, in.Reason)
+		r.SetStepState(in.StepName, step.StateClientError)
+		r.SetState(resolution.StateBlockedBadRequest)
+		t.SetState(task.StateBlocked)
+		if err := t.Update(dbp, false, true); err != nil {
+			dbp.Rollback()
+			return err
+		}
+	}
+	if in.Reason != "" {
+		comment += ": " + in.Reason
+	}
+
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler decideResolutionStep: %s", comment)
+	metadata.AddActionMetadata(c, metadata.OldState, oldState)
+	metadata.AddActionMetadata(c, metadata.NewState, s.State)
+
+	if err := r.Update(dbp); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if _, err := task.CreateSystemComment(dbp, t, reqUsername, comment); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if !approved {
+		return nil
+	}
+	return resolveInBackground(c.Request.Context(), r.PublicID)
+}
+
+type replayResolutionIn struct {
+	PublicID string `path:"id, required"`
+	From     string `query:"from" validate:"required"`
+}
+
+// ReplayResolution resets a step of a resolution and all the steps depending on it,
+// and runs the resolution again: the outputs of the other steps are kept.
+// Only the resolution managers, or admins, can replay a resolution.
+func ReplayResolution(c *gin.Context, in *replayResolutionIn) error {
+	metadata.AddActionMetadata(c, metadata.ResolutionID, in.PublicID)
+	metadata.AddActionMetadata(c, metadata.StepName, in.From)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return err
+	}
+
+	r, err := resolution.LoadLockedNoWaitFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	t, err := task.LoadFromID(dbp, r.TaskID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	admin := auth.IsAdmin(c) == nil
+	resolutionManager := auth.IsResolutionManager(c, tt, t, r) == nil
+
+	if !admin && !resolutionManager {
+		dbp.Rollback()
+		return errors.Forbiddenf("You are not allowed to replay this resolution")
+	} else if !resolutionManager {
+		metadata.SetSUDO(c)
+	}
+
+	switch r.State {
+	case resolution.StateCancelled, resolution.StateRunning, resolution.StateAutorunning:
+		dbp.Rollback()
+		return errors.BadRequestf("Can't replay resolution: state %s", r.State)
+	}
+
+	reset, err := r.ReplayFrom(in.From)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	oldState := r.State
+	r.SetState(resolution.StateTODO)
+	r.NextRetry = nil
+
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("Handler ReplayResolution: replay of resolution %s from step %s, resetting steps %s", r.PublicID, in.From, strings.Join(reset, ", "))
+	metadata.AddActionMetadata(c, metadata.OldState, oldState)
+	metadata.AddActionMetadata(c, metadata.NewState, r.State)
+
+	if err := r.Update(dbp); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	// a task already done is brought back to life
+	if t.State == task.StateDone {
+		t.SetState(task.StateTODO)
+		if err := t.Update(dbp, true, true); err != nil {
+			dbp.Rollback()
+			return err
+		}
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "replayed resolution from step "+in.From+", resetting steps "+strings.Join(reset, ", "))
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	return resolveInBackground(c.Request.Context(), r.PublicID)
+}
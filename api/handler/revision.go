@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+)
+
+// RevisionConflictError is returned when an edit is based on an outdated revision of a task or resolution,
+// which was updated in the meantime
+type RevisionConflictError struct {
+	Resource string
+	Given    int
+	Current  int
+}
+
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("Conflict: %s updated since revision %d, its current revision is %d", e.Resource, e.Given, e.Current)
+}
+
+// RevisionContextKey holds the revision of the resource returned by a GET handler,
+// from which the ETag middleware derives the ETag of the response
+const RevisionContextKey = "revision"
+
+// RevisionETag returns the weak ETag of a resource, made of its revision and a digest of its content:
+// it changes along with the content, and is accepted as is by the If-Match header of its edits
+func RevisionETag(revision int, digest string) string {
+	return fmt.Sprintf(`W/"%d-%s"`, revision, digest)
+}
+
+// setRevision gives the revision of the resource returned to the ETag middleware
+func setRevision(c *gin.Context, revision int) {
+	c.Set(RevisionContextKey, revision)
+}
+
+// checkRevision ensures that an edit is based on the current revision of a resource,
+// given either in the body of the request or in its If-Match header,
+// as the revision itself or as the ETag returned along with the resource
+func checkRevision(c *gin.Context, resource string, given *int, current int) error {
+	if given == nil {
+		ifMatch := strings.Trim(strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/"), `"`)
+		if ifMatch == "" {
+			return errors.BadRequestf("Missing revision of the %s, expected in the body or the If-Match header", resource)
+		}
+		rev, _, _ := strings.Cut(ifMatch, "-")
+		revision, err := strconv.Atoi(rev)
+		if err != nil {
+			return errors.BadRequestf("Invalid If-Match header %q, expected the revision or the ETag of the %s", ifMatch, resource)
+		}
+		given = &revision
+	}
+
+	if *given != current {
+		return &RevisionConflictError{Resource: resource, Given: *given, Current: current}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkRevision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	check := func(ifMatch string, given *int) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPut, "/task/foo", nil)
+		if ifMatch != "" {
+			c.Request.Header.Set("If-Match", ifMatch)
+		}
+		return checkRevision(c, "task", given, 3)
+	}
+
+	// the revision, or the ETag returned along with the resource
+	for _, ifMatch := range []string{`3`, `"3"`, `W/"3"`, RevisionETag(3, "5d41402abc4b2a76b9719d911017c592")} {
+		assert.NoError(t, check(ifMatch, nil), ifMatch)
+	}
+
+	var conflict *RevisionConflictError
+	for _, ifMatch := range []string{`"2"`, RevisionETag(2, "5d41402abc4b2a76b9719d911017c592")} {
+		err := check(ifMatch, nil)
+		if assert.ErrorAs(t, err, &conflict, ifMatch) {
+			assert.Equal(t, 2, conflict.Given)
+			assert.Equal(t, 3, conflict.Current)
+		}
+	}
+
+	// a hash alone doesn't tell the revision
+	for _, ifMatch := range []string{``, `"5d41402abc4b2a76b9719d911017c592"`, `W/"-3"`} {
+		assert.True(t, errors.IsBadRequest(check(ifMatch, nil)), ifMatch)
+	}
+
+	// the revision of the body takes precedence
+	revision := 3
+	assert.NoError(t, check(RevisionETag(2, "5d41402abc4b2a76b9719d911017c592"), &revision))
+}
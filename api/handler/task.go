@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -16,8 +17,10 @@ import (
 	"github.com/cneill/utask/models/resolution"
 	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/archive"
 	"github.com/cneill/utask/pkg/auth"
 	"github.com/cneill/utask/pkg/constants"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/metadata"
 	"github.com/cneill/utask/pkg/taskutils"
 	"github.com/cneill/utask/pkg/utils"
@@ -25,6 +28,7 @@ import (
 
 type createTaskIn struct {
 	TemplateName      string                 `json:"template_name" binding:"required"`
+	TemplateVersion   *int                   `json:"template_version"`
 	Input             map[string]interface{} `json:"input" binding:"required"`
 	Comment           string                 `json:"comment"`
 	WatcherUsernames  []string               `json:"watcher_usernames"`
@@ -33,6 +37,10 @@ type createTaskIn struct {
 	ResolverGroups    []string               `json:"resolver_groups"`
 	Delay             *string                `json:"delay"`
 	Tags              map[string]string      `json:"tags"`
+	TTL               *string                `json:"ttl"`
+	Priority          *int                   `json:"priority"`
+	DependsOn         []string               `json:"depends_on"`
+	NotifyBackends    []string               `json:"notify_backends"`
 }
 
 // CreateTask handles the creation of a new task based on an existing template
@@ -44,6 +52,9 @@ type createTaskIn struct {
 // A duration string is a possibly signed sequence of decimal numbers,
 // each with optional fraction and a unit suffix, such as "300ms", "-1.5h" or "2h45m".
 // Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+// a ttl can be set, with the same format, to delete the task that long after its completion
+// notify_backends restricts the notification backends receiving this task's notifications
+// template_version pins a previous version of the template, the latest one being used by default
 func CreateTask(c *gin.Context, in *createTaskIn) (*task.Task, error) {
 	metadata.AddActionMetadata(c, metadata.TemplateName, in.TemplateName)
 
@@ -57,6 +68,13 @@ func CreateTask(c *gin.Context, in *createTaskIn) (*task.Task, error) {
 		return nil, err
 	}
 
+	if in.TemplateVersion != nil {
+		tt, err = tasktemplate.LoadVersion(dbp, tt.ID, *in.TemplateVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := dbp.Tx(); err != nil {
 		return nil, err
 	}
@@ -80,7 +98,20 @@ func CreateTask(c *gin.Context, in *createTaskIn) (*task.Task, error) {
 		}
 	}
 
-	t, err := taskutils.CreateTask(c, dbp, tt, in.WatcherUsernames, in.WatcherGroups, in.ResolverUsernames, in.ResolverGroups, in.Input, nil, in.Comment, in.Delay, in.Tags)
+	t, err := taskutils.CreateTask(c, dbp, tt, taskutils.CreateTaskOptions{
+		WatcherUsernames:  in.WatcherUsernames,
+		WatcherGroups:     in.WatcherGroups,
+		ResolverUsernames: in.ResolverUsernames,
+		ResolverGroups:    in.ResolverGroups,
+		Input:             in.Input,
+		Comment:           in.Comment,
+		Delay:             in.Delay,
+		Tags:              in.Tags,
+		TTL:               in.TTL,
+		Priority:          in.Priority,
+		DependsOn:         in.DependsOn,
+		NotifyBackends:    in.NotifyBackends,
+	})
 	if err != nil {
 		dbp.Rollback()
 		return nil, err
@@ -93,9 +124,36 @@ func CreateTask(c *gin.Context, in *createTaskIn) (*task.Task, error) {
 
 	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
 
+	t.Input = obfuscateSecretInput(t.Input)
+
 	return t, nil
 }
 
+type getQuotaIn struct {
+	Template *string `query:"template"`
+}
+
+// GetQuota returns how many tasks the user created over the quota window, against the caps of the quota,
+// for a given template if specified
+func GetQuota(c *gin.Context, in *getQuotaIn) (*taskutils.QuotaUsage, error) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	var tt *tasktemplate.TaskTemplate
+	if in.Template != nil {
+		metadata.AddActionMetadata(c, metadata.TemplateName, *in.Template)
+
+		tt, err = tasktemplate.LoadFromName(dbp, *in.Template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return taskutils.GetQuotaUsage(c, dbp, tt)
+}
+
 const (
 	taskTypeOwn        = "own"
 	taskTypeResolvable = "resolvable"
@@ -112,10 +170,17 @@ type listTasksIn struct {
 	After         *time.Time `query:"after"`
 	Before        *time.Time `query:"before"`
 	Tags          []string   `query:"tag" explode:"true"`
+	Priority      *int       `query:"priority"`
+	Resolver      *string    `query:"resolver"`
+	Watcher       *string    `query:"watcher"`
+	CreatedAfter  *time.Time `query:"created_after"`
+	CreatedBefore *time.Time `query:"created_before"`
+	EndedAfter    *time.Time `query:"ended_after"`
+	EndedBefore   *time.Time `query:"ended_before"`
 }
 
 // ListTasks returns a list of tasks, which can be filtered by state, batch ID,
-// and last activity time (before and/or after)
+// last activity time (before and/or after), creation or completion time, and resolver or watcher (a username or a group)
 // type=own (default) returns tasks for which the user is the requester
 // type=resolvable returns tasks for which the user is a potential resolver
 // type=all returns every task (only available to administrator users)
@@ -147,6 +212,15 @@ func ListTasks(c *gin.Context, in *listTasksIn) (t []*task.Task, err error) {
 		Before:   in.Before,
 		Template: in.Template,
 		Tags:     tags,
+		Priority: in.Priority,
+		Resolver: in.Resolver,
+		Watcher:  in.Watcher,
+		Period: task.Period{
+			CreatedAfter:  in.CreatedAfter,
+			CreatedBefore: in.CreatedBefore,
+			EndedAfter:    in.EndedAfter,
+			EndedBefore:   in.EndedBefore,
+		},
 	}
 
 	var b *task.Batch
@@ -158,25 +232,8 @@ func ListTasks(c *gin.Context, in *listTasksIn) (t []*task.Task, err error) {
 		filter.Batch = b
 	}
 
-	reqUsername := auth.GetIdentity(c)
-	var user *string
-	if reqUsername != "" {
-		user = &reqUsername
-	}
-
-	switch in.Type {
-	case taskTypeOwn:
-		filter.RequesterUser = user
-	case taskTypeResolvable:
-		filter.PotentialResolverUser = user
-		filter.PotentialResolverGroups = auth.GetGroups(c)
-	case taskTypeAll:
-		if err2 := auth.IsAdmin(c); err2 != nil {
-			filter.RequesterOrPotentialResolverUser = user
-			filter.RequesterOrPotentialResolverGroups = auth.GetGroups(c)
-		}
-	default:
-		return nil, errors.BadRequestf("Unknown type for listing: '%s'. Was expecting '%s', '%s' or '%s'", in.Type, taskTypeOwn, taskTypeResolvable, taskTypeAll)
+	if err := restrictListType(c, in.Type, &filter); err != nil {
+		return nil, err
 	}
 
 	t, err = task.ListTasks(dbp, filter)
@@ -188,7 +245,7 @@ func ListTasks(c *gin.Context, in *listTasksIn) (t []*task.Task, err error) {
 		lastT := t[len(t)-1].PublicID
 		c.Header(
 			linkHeader,
-			buildTaskNextLink(in.Type, in.State, in.BatchPublicID, filter.PageSize, lastT),
+			buildTaskNextLink(in.Type, in.State, in.BatchPublicID, in.Priority, in.Resolver, in.Watcher, filter.Period, filter.PageSize, lastT),
 		)
 	}
 
@@ -197,12 +254,38 @@ func ListTasks(c *gin.Context, in *listTasksIn) (t []*task.Task, err error) {
 	return t, nil
 }
 
+// restrictListType restricts a listing of tasks to the ones the user may see for a type of listing
+func restrictListType(c *gin.Context, typ string, filter *task.ListFilter) error {
+	reqUsername := auth.GetIdentity(c)
+	var user *string
+	if reqUsername != "" {
+		user = &reqUsername
+	}
+
+	switch typ {
+	case taskTypeOwn:
+		filter.RequesterUser = user
+	case taskTypeResolvable:
+		filter.PotentialResolverUser = user
+		filter.PotentialResolverGroups = auth.GetGroups(c)
+	case taskTypeAll:
+		if err := auth.IsAdmin(c); err != nil {
+			filter.RequesterOrPotentialResolverUser = user
+			filter.RequesterOrPotentialResolverGroups = auth.GetGroups(c)
+		}
+	default:
+		return errors.BadRequestf("Unknown type for listing: '%s'. Was expecting '%s', '%s' or '%s'", typ, taskTypeOwn, taskTypeResolvable, taskTypeAll)
+	}
+	return nil
+}
+
 type getTaskIn struct {
 	PublicID string `path:"id,required"`
 }
 
 // GetTask returns a single task
-// inputs of type password are obfuscated to every user except administrators
+// inputs of type password are obfuscated to every user except administrators,
+// secret inputs are obfuscated to every user
 func GetTask(c *gin.Context, in *getTaskIn) (*task.Task, error) {
 	metadata.AddActionMetadata(c, metadata.TaskID, in.PublicID)
 
@@ -211,23 +294,37 @@ func GetTask(c *gin.Context, in *getTaskIn) (*task.Task, error) {
 		return nil, err
 	}
 
-	t, err := task.LoadFromPublicID(dbp, in.PublicID)
+	t, tt, err := loadTaskDetails(c, dbp, in.PublicID)
+	if tt != nil {
+		metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	setRevision(c, t.Revision)
+
+	return t, nil
+}
+
+// loadTaskDetails loads a task as displayed to the user making the request,
+// along with its template, returned even when the user is not allowed to see the task
+func loadTaskDetails(c *gin.Context, dbp zesty.DBProvider, publicID string) (*task.Task, *tasktemplate.TaskTemplate, error) {
+	t, err := task.LoadFromPublicID(dbp, publicID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	var res *resolution.Resolution
 	if t.Resolution != nil {
 		res, err = resolution.LoadFromPublicID(dbp, *t.Resolution)
 		if err != nil {
-			return nil, err
+			return nil, tt, err
 		}
 	}
 
@@ -237,8 +334,9 @@ func GetTask(c *gin.Context, in *getTaskIn) (*task.Task, error) {
 	resolutionManager := auth.IsResolutionManager(c, tt, t, res) == nil
 
 	if !admin && !requester && !watcher && !resolutionManager {
-		return nil, errors.Forbiddenf("Can't display task details")
+		return nil, tt, errors.Forbiddenf("Can't display task details")
 	}
+	t.Input = obfuscateSecretInput(t.Input)
 	if !admin {
 		t.Input = obfuscateInput(tt.Inputs, t.Input)
 	}
@@ -254,7 +352,58 @@ func GetTask(c *gin.Context, in *getTaskIn) (*task.Task, error) {
 		}
 	}
 
-	return t, nil
+	return t, tt, nil
+}
+
+type batchGetTasksIn struct {
+	PublicIDs []string `json:"ids" binding:"required"`
+}
+
+type batchGetTasksOut struct {
+	Tasks   []*task.Task  `json:"tasks"`
+	Skipped []skippedTask `json:"skipped"`
+}
+
+type skippedTask struct {
+	PublicID string `json:"id"`
+	Reason   string `json:"reason"`
+}
+
+// BatchGetTasks returns several tasks at once, as GetTask would return them,
+// skipping the tasks missing or which the user is not allowed to see
+func BatchGetTasks(c *gin.Context, in *batchGetTasksIn) (*batchGetTasksOut, error) {
+	if len(in.PublicIDs) > int(utask.MaxPageSize) {
+		return nil, errors.BadRequestf("Can't get more than %d tasks at once", utask.MaxPageSize)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &batchGetTasksOut{
+		Tasks:   []*task.Task{},
+		Skipped: []skippedTask{},
+	}
+	seen := make(map[string]bool, len(in.PublicIDs))
+	for _, publicID := range in.PublicIDs {
+		if seen[publicID] {
+			continue
+		}
+		seen[publicID] = true
+
+		t, _, err := loadTaskDetails(c, dbp, publicID)
+		switch {
+		case err == nil:
+			out.Tasks = append(out.Tasks, t)
+		case errors.IsNotFound(err), errors.IsForbidden(err), errors.IsBadRequest(err), errors.IsNotValid(err):
+			out.Skipped = append(out.Skipped, skippedTask{PublicID: publicID, Reason: err.Error()})
+		default:
+			return nil, err
+		}
+	}
+
+	return out, nil
 }
 
 type updateTaskIn struct {
@@ -263,10 +412,12 @@ type updateTaskIn struct {
 	WatcherUsernames []string               `json:"watcher_usernames"`
 	WatcherGroups    []string               `json:"watcher_groups"`
 	Tags             map[string]string      `json:"tags"`
+	Revision         *int                   `json:"revision"` // or given by the If-Match header
 }
 
 // UpdateTask modifies a task, allowing it's requester or an administrator
 // to fix a broken input, or to add/remove watchers
+// the edit must be based on the current revision of the task
 func UpdateTask(c *gin.Context, in *updateTaskIn) (*task.Task, error) {
 	metadata.AddActionMetadata(c, metadata.TaskID, in.PublicID)
 
@@ -279,7 +430,7 @@ func UpdateTask(c *gin.Context, in *updateTaskIn) (*task.Task, error) {
 		return nil, err
 	}
 
-	t, err := task.LoadFromPublicID(dbp, in.PublicID)
+	t, err := task.LoadLockedFromPublicID(dbp, in.PublicID)
 	if err != nil {
 		dbp.Rollback()
 		return nil, err
@@ -304,6 +455,11 @@ func UpdateTask(c *gin.Context, in *updateTaskIn) (*task.Task, error) {
 		metadata.SetSUDO(c)
 	}
 
+	if err := checkRevision(c, "task", in.Revision, t.Revision); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
 	var res *resolution.Resolution
 	if t.Resolution != nil {
 		res, err = resolution.LoadFromPublicID(dbp, *t.Resolution)
@@ -346,7 +502,7 @@ func UpdateTask(c *gin.Context, in *updateTaskIn) (*task.Task, error) {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "manually edited task")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "manually edited task")
 	if err != nil {
 		dbp.Rollback()
 		return nil, err
@@ -357,6 +513,8 @@ func UpdateTask(c *gin.Context, in *updateTaskIn) (*task.Task, error) {
 		return nil, err
 	}
 
+	t.Input = obfuscateSecretInput(t.Input)
+
 	return t, nil
 }
 
@@ -396,7 +554,275 @@ func DeleteTask(c *gin.Context, in *deleteTaskIn) error {
 		return errors.BadRequestf("Task can't be deleted while in state %q", t.State)
 	}
 
-	return t.Delete(dbp)
+	if archive.Enabled() {
+		if _, err := archive.Archive(c, dbp, t); err != nil {
+			return err
+		}
+	}
+
+	if err := taskutils.DeleteTask(c.Request.Context(), dbp, t); err != nil {
+		return err
+	}
+
+	resumeDeletedDependencyTasks(c.Request.Context(), dbp, t)
+
+	return nil
+}
+
+type archiveTaskIn struct {
+	PublicID string `path:"id,required"`
+}
+
+type archiveTaskOut struct {
+	Archive string `json:"archive"`
+}
+
+// ArchiveTask stores a task, its resolution and comments in the archive storage,
+// then deletes them from the database
+func ArchiveTask(c *gin.Context, in *archiveTaskIn) (*archiveTaskOut, error) {
+	metadata.AddActionMetadata(c, metadata.TaskID, in.PublicID)
+
+	if !archive.Enabled() {
+		return nil, errors.NotImplementedf("Task archival is not configured")
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := task.LoadFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	if err := auth.IsAdmin(c); err != nil {
+		return nil, err
+	}
+
+	metadata.SetSUDO(c)
+
+	switch t.State {
+	case task.StateRunning, task.StateBlocked:
+		return nil, errors.BadRequestf("Task can't be archived while in state %q", t.State)
+	}
+
+	name, err := archive.Archive(c, dbp, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := taskutils.DeleteTask(c.Request.Context(), dbp, t); err != nil {
+		return nil, err
+	}
+
+	resumeDeletedDependencyTasks(c.Request.Context(), dbp, t)
+
+	return &archiveTaskOut{Archive: name}, nil
+}
+
+type restoreTaskIn struct {
+	Archive string `json:"archive" binding:"required"`
+}
+
+// RestoreTask inserts back a task, its resolution and comments from the archive storage
+// the task must not exist anymore, and its template must still exist
+func RestoreTask(c *gin.Context, in *restoreTaskIn) (*task.Task, error) {
+	metadata.AddActionMetadata(c, metadata.ArchiveName, in.Archive)
+
+	if !archive.Enabled() {
+		return nil, errors.NotImplementedf("Task archival is not configured")
+	}
+
+	if err := auth.IsAdmin(c); err != nil {
+		return nil, err
+	}
+
+	metadata.SetSUDO(c)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := archive.Import(c, dbp, in.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TaskID, t.PublicID)
+	metadata.AddActionMetadata(c, metadata.TemplateName, t.TemplateName)
+
+	t.Input = obfuscateSecretInput(t.Input)
+
+	return t, nil
+}
+
+type assignTaskIn struct {
+	PublicID         string `path:"id,required"`
+	ResolverUsername string `json:"resolver_username"` // defaults to the caller
+}
+
+// AssignTask lets a resolver claim a task before running it, so that other resolvers see it's taken
+// only the assignee can then create a resolution for the task
+func AssignTask(c *gin.Context, in *assignTaskIn) (*task.Task, error) {
+	metadata.AddActionMetadata(c, metadata.TaskID, in.PublicID)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+
+	t, err := task.LoadLockedFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if t.Resolution != nil || t.State != task.StateTODO {
+		dbp.Rollback()
+		return nil, errors.BadRequestf("Can't assign a task in state %s: only tasks which haven't been resolved yet can be assigned", t.State)
+	}
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	reqUsername := auth.GetIdentity(c)
+	admin := auth.IsAdmin(c) == nil
+	resolutionManager := auth.IsResolutionManager(c, tt, t, nil) == nil
+
+	if !admin && !resolutionManager {
+		dbp.Rollback()
+		return nil, errors.Forbiddenf("You are not allowed to resolve this task")
+	} else if !resolutionManager {
+		metadata.SetSUDO(c)
+	}
+
+	assignee := in.ResolverUsername
+	if assignee == "" {
+		assignee = reqUsername
+	}
+
+	// claimed tasks can only be reassigned by their assignee
+	if t.Assignee != nil && *t.Assignee != reqUsername && *t.Assignee != assignee {
+		if !admin {
+			dbp.Rollback()
+			return nil, errors.Forbiddenf("Task is already assigned to %s", *t.Assignee)
+		}
+		metadata.SetSUDO(c)
+	}
+
+	// the caller may claim the task for themselves,
+	// others have to be explicitly allowed to resolve it
+	if assignee != reqUsername &&
+		!utils.ListContainsString(tt.AllowedResolverUsernames, assignee) &&
+		!utils.ListContainsString(t.ResolverUsernames, assignee) {
+		dbp.Rollback()
+		return nil, errors.BadRequestf("%s is not allowed to resolve this task", assignee)
+	}
+
+	metadata.AddActionMetadata(c, metadata.Assignee, assignee)
+
+	t.Assignee = &assignee
+	if err := t.Update(dbp,
+		true, // skip validation, only the assignee changes
+		true, // do record the change with last activity timestamp
+	); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if _, err := task.CreateSystemComment(dbp, t, reqUsername, "assigned task to "+assignee); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	t.Input = obfuscateSecretInput(t.Input)
+
+	return t, nil
+}
+
+type unassignTaskIn struct {
+	PublicID string `path:"id,required"`
+}
+
+// UnassignTask releases the claim on a task, letting any of its resolvers run it
+func UnassignTask(c *gin.Context, in *unassignTaskIn) error {
+	metadata.AddActionMetadata(c, metadata.TaskID, in.PublicID)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return err
+	}
+
+	t, err := task.LoadLockedFromPublicID(dbp, in.PublicID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if t.Assignee == nil {
+		dbp.Rollback()
+		return errors.BadRequestf("Task is not assigned")
+	}
+
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	metadata.AddActionMetadata(c, metadata.TemplateName, tt.Name)
+
+	reqUsername := auth.GetIdentity(c)
+	if *t.Assignee != reqUsername {
+		if auth.IsAdmin(c) != nil {
+			dbp.Rollback()
+			return errors.Forbiddenf("Task is assigned to %s", *t.Assignee)
+		}
+		metadata.SetSUDO(c)
+	}
+
+	t.Assignee = nil
+	if err := t.Update(dbp,
+		true, // skip validation, only the assignee changes
+		true, // do record the change with last activity timestamp
+	); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	if _, err := task.CreateSystemComment(dbp, t, reqUsername, "unassigned task"); err != nil {
+		dbp.Rollback()
+		return err
+	}
+
+	return dbp.Commit()
 }
 
 type wontfixTaskIn struct {
@@ -458,19 +884,21 @@ func WontfixTask(c *gin.Context, in *wontfixTaskIn) error {
 	}
 
 	reqUsername := auth.GetIdentity(c)
-	_, err = task.CreateComment(dbp, t, reqUsername, "changed task state to WONTFIX")
+	_, err = task.CreateSystemComment(dbp, t, reqUsername, "changed task state to WONTFIX")
 	if err != nil {
 		dbp.Rollback()
 		return err
 	}
 
+	// c can't be used once the request is over, only its context is kept for the logs
+	ctx := c.Request.Context()
 	parentTask, err := taskutils.ShouldResumeParentTask(dbp, t)
 	if err == nil && parentTask != nil {
 		go func() {
-			logrus.Debugf("resuming parent task %q resolution %q", parentTask.PublicID, *parentTask.Resolution)
-			logrus.WithFields(logrus.Fields{"task_id": parentTask.PublicID, "resolution_id": *parentTask.Resolution}).Debugf("resuming resolution %q as child task %q state changed", *parentTask.Resolution, t.PublicID)
+			correlation.Logger(ctx).Debugf("resuming parent task %q resolution %q", parentTask.PublicID, *parentTask.Resolution)
+			correlation.Logger(ctx).WithFields(logrus.Fields{"task_id": parentTask.PublicID, "resolution_id": *parentTask.Resolution}).Debugf("resuming resolution %q as child task %q state changed", *parentTask.Resolution, t.PublicID)
 
-			err = engine.GetEngine().Resolve(*parentTask.Resolution, nil)
+			err = engine.GetEngine().ResolveWithContext(ctx, *parentTask.Resolution, nil)
 		}()
 	}
 
@@ -479,5 +907,41 @@ func WontfixTask(c *gin.Context, in *wontfixTaskIn) error {
 		return err
 	}
 
+	resumeDependentTasks(ctx, dbp, t)
+
 	return nil
 }
+
+// resumeDependentTasks resumes the tasks which were only waiting for a task to be over
+func resumeDependentTasks(ctx context.Context, dbp zesty.DBProvider, t *task.Task) {
+	dependentTasks, err := taskutils.DependentTasksToResume(dbp, t)
+	if err != nil {
+		correlation.Logger(ctx).WithError(err).Warnf("failed to list tasks depending on task %q", t.PublicID)
+		return
+	}
+
+	resumeTasks(ctx, dependentTasks, t)
+}
+
+// resumeDeletedDependencyTasks resumes the tasks which were only waiting for a deleted task,
+// which will never reach a final state
+func resumeDeletedDependencyTasks(ctx context.Context, dbp zesty.DBProvider, t *task.Task) {
+	dependentTasks, err := taskutils.DeletedDependencyTasksToResume(dbp, t.PublicID)
+	if err != nil {
+		correlation.Logger(ctx).WithError(err).Warnf("failed to list tasks depending on deleted task %q", t.PublicID)
+		return
+	}
+
+	resumeTasks(ctx, dependentTasks, t)
+}
+
+func resumeTasks(ctx context.Context, dependentTasks []*task.Task, t *task.Task) {
+	for _, dependentTask := range dependentTasks {
+		resolutionID := *dependentTask.Resolution
+		go func() {
+			correlation.Logger(ctx).WithFields(logrus.Fields{"task_id": dependentTask.PublicID, "resolution_id": resolutionID}).Debugf("resuming resolution %q as dependency task %q is over", resolutionID, t.PublicID)
+
+			_ = engine.GetEngine().ResolveWithContext(ctx, resolutionID, nil)
+		}()
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/tonic/utils/jujerr"
+	"github.com/loopfz/gadgeto/zesty"
+	"golang.org/x/net/websocket"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/taskfeed"
+)
+
+const (
+	// taskFeedWriteTimeout is how long a client may take to receive an event before being disconnected
+	taskFeedWriteTimeout = 10 * time.Second
+	// taskFeedMaxReceivedBytes bounds the messages sent by the clients, which are ignored
+	taskFeedMaxReceivedBytes = 1024
+
+	taskFeedEventTask   = "task"
+	taskFeedEventResync = "resync"
+)
+
+type taskFeedEvent struct {
+	Type string     `json:"type"`
+	Task *task.Task `json:"task,omitempty"`
+}
+
+// SubscribeTasks upgrades the connection to a websocket, pushing the tasks as they are updated
+// the tasks can be filtered by state, template and tags, the same way as by ListTasks
+// type=own (default), type=resolvable and type=all select the tasks the user may see as in ListTasks
+// each updated task is pushed as a "task" event; when too many tasks were updated at once,
+// a single "resync" event tells the client to list the tasks again
+func SubscribeTasks(c *gin.Context) {
+	typ := c.DefaultQuery("type", taskTypeOwn)
+
+	filter := task.ListFilter{
+		PageSize: utask.MaxPageSize,
+	}
+	if state, ok := c.GetQuery("state"); ok {
+		filter.State = &state
+	}
+	if template, ok := c.GetQuery("template"); ok {
+		filter.Template = &template
+	}
+	tags := map[string]string{}
+	for _, t := range c.QueryArray("tag") {
+		parts := strings.Split(t, "=")
+		if len(parts) != 2 {
+			c.AbortWithStatusJSON(jujerr.ErrHook(c, errors.BadRequestf("invalid tag %s", t)))
+			return
+		}
+		if parts[0] == "" || parts[1] == "" {
+			c.AbortWithStatusJSON(jujerr.ErrHook(c, errors.BadRequestf("invalid tag %s", t)))
+			return
+		}
+		tags[parts[0]] = parts[1]
+	}
+	filter.Tags = tags
+
+	if err := restrictListType(c, typ, &filter); err != nil {
+		c.AbortWithStatusJSON(jujerr.ErrHook(c, err))
+		return
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		c.AbortWithStatusJSON(jujerr.ErrHook(c, err))
+		return
+	}
+
+	// only the tasks updated after the subscription are pushed,
+	// the client lists the current ones by itself
+	cursor, err := task.LatestActivity(dbp)
+	if err != nil {
+		c.AbortWithStatusJSON(jujerr.ErrHook(c, err))
+		return
+	}
+
+	list := func(after *time.Time) ([]*task.Task, error) {
+		filter.After = after
+		return task.ListTasks(dbp, filter)
+	}
+
+	websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   taskFeed(list, filter.PageSize, cursor),
+	}.ServeHTTP(c.Writer, c.Request)
+}
+
+// taskFeed pushes the tasks listed after cursor on each change of the live task list,
+// until the client disconnects: its subscription lasts as long as its connection
+func taskFeed(list func(after *time.Time) ([]*task.Task, error), pageSize uint64, cursor *time.Time) websocket.Handler {
+	return func(ws *websocket.Conn) {
+		defer ws.Close()
+		ws.MaxPayloadBytes = taskFeedMaxReceivedBytes
+
+		sub := taskfeed.Subscribe()
+		defer sub.Close()
+
+		// the client sends nothing: reading only detects its disconnection
+		disconnected := make(chan struct{})
+		go func() {
+			defer close(disconnected)
+			var msg []byte
+			for {
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-disconnected:
+				return
+			case <-sub.Done():
+				return
+			case <-sub.Changes():
+				tasks, err := list(cursor)
+				if err != nil {
+					return
+				}
+				if len(tasks) == 0 {
+					continue
+				}
+				// listed from the most recent activity
+				cursor = &tasks[0].LastActivity
+
+				for _, e := range taskFeedEvents(tasks, pageSize) {
+					if err := ws.SetWriteDeadline(time.Now().Add(taskFeedWriteTimeout)); err != nil {
+						return
+					}
+					if err := websocket.JSON.Send(ws, e); err != nil {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// taskFeedEvents pushes the tasks listed from the most recent activity in the order they were updated,
+// or a single resync event when a full page was listed, some updates being left out
+func taskFeedEvents(tasks []*task.Task, pageSize uint64) []taskFeedEvent {
+	if uint64(len(tasks)) == pageSize {
+		return []taskFeedEvent{{Type: taskFeedEventResync}}
+	}
+	events := make([]taskFeedEvent, 0, len(tasks))
+	for i := len(tasks) - 1; i >= 0; i-- {
+		events = append(events, taskFeedEvent{Type: taskFeedEventTask, Task: tasks[i]})
+	}
+	return events
+}
+
+// checkSameOrigin refuses the websockets opened by the pages of other sites,
+// which would be authenticated by the cookies of the user
+func checkSameOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host != req.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	config.Origin = u
+	return nil
+}
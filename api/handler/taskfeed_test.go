@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/taskfeed"
+)
+
+func Test_taskFeedEvents(t *testing.T) {
+	older := &task.Task{DBModel: task.DBModel{PublicID: "older"}}
+	newer := &task.Task{DBModel: task.DBModel{PublicID: "newer"}}
+
+	// pushed in the order they were updated
+	assert.Equal(t, []taskFeedEvent{
+		{Type: taskFeedEventTask, Task: older},
+		{Type: taskFeedEventTask, Task: newer},
+	}, taskFeedEvents([]*task.Task{newer, older}, 3))
+
+	// a full page may have left updates out
+	assert.Equal(t, []taskFeedEvent{
+		{Type: taskFeedEventResync},
+	}, taskFeedEvents([]*task.Task{newer, older}, 2))
+}
+
+func TestTaskFeed(t *testing.T) {
+	start := time.Now()
+	older := &task.Task{DBModel: task.DBModel{PublicID: "older", LastActivity: start.Add(time.Second)}}
+	newer := &task.Task{DBModel: task.DBModel{PublicID: "newer", LastActivity: start.Add(2 * time.Second)}}
+
+	var mu sync.Mutex
+	var cursors []*time.Time
+	listed := [][]*task.Task{
+		{newer, older},
+		{},
+		{newer, older, newer},
+	}
+	list := func(after *time.Time) ([]*task.Task, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cursors = append(cursors, after)
+		tasks := listed[0]
+		listed = listed[1:]
+		return tasks, nil
+	}
+
+	server := httptest.NewServer(taskFeed(list, 3, &start))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	// the client is subscribed once connected
+	require.Eventually(t, func() bool { return taskfeed.Subscribers() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	receive := func() taskFeedEvent {
+		require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var e taskFeedEvent
+		require.NoError(t, websocket.JSON.Receive(ws, &e))
+		return e
+	}
+
+	taskfeed.Notify()
+	e := receive()
+	assert.Equal(t, taskFeedEventTask, e.Type)
+	assert.Equal(t, "older", e.Task.PublicID)
+	e = receive()
+	assert.Equal(t, taskFeedEventTask, e.Type)
+	assert.Equal(t, "newer", e.Task.PublicID)
+
+	// nothing is pushed when nothing matches, and the overflow asks the client to resync
+	taskfeed.Notify()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(cursors) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	taskfeed.Notify()
+	e = receive()
+	assert.Equal(t, taskFeedEventResync, e.Type)
+	assert.Nil(t, e.Task)
+
+	// the tasks are listed from the latest activity pushed
+	mu.Lock()
+	require.Len(t, cursors, 3)
+	assert.Equal(t, start, *cursors[0])
+	assert.Equal(t, newer.LastActivity, *cursors[1])
+	assert.Equal(t, newer.LastActivity, *cursors[2])
+	mu.Unlock()
+
+	// and the subscription ends with the connection
+	require.NoError(t, ws.Close())
+	assert.Eventually(t, func() bool { return taskfeed.Subscribers() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
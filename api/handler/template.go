@@ -2,33 +2,57 @@ package handler
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
 
 	"github.com/cneill/utask"
+	"github.com/cneill/utask/engine"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
 	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/metadata"
+	"github.com/cneill/utask/pkg/taskutils"
 )
 
 type listTemplatesIn struct {
-	PageSize uint64  `query:"page_size"`
-	Last     *string `query:"last"`
+	PageSize uint64   `query:"page_size"`
+	Last     *string  `query:"last"`
+	Tags     []string `query:"tag" explode:"true"`
 }
 
-// ListTemplates returns a list of available templates in simplified format (steps not included)
+// ListTemplates returns a list of available templates in simplified format (steps not included),
+// which can be filtered by tags
 func ListTemplates(c *gin.Context, in *listTemplatesIn) ([]*tasktemplate.TaskTemplate, error) {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
 	if err != nil {
 		return nil, err
 	}
 
+	tags := make(map[string]string, len(in.Tags))
+	for _, t := range in.Tags {
+		parts := strings.Split(t, "=")
+		if len(parts) != 2 {
+			return nil, errors.BadRequestf("invalid tag %s", t)
+		}
+		if parts[0] == "" || parts[1] == "" {
+			return nil, errors.BadRequestf("invalid tag %s", t)
+		}
+		tags[parts[0]] = parts[1]
+	}
+
 	in.PageSize = normalizePageSize(in.PageSize)
 
 	tt, err := tasktemplate.ListTemplates(dbp,
 		auth.IsAdmin(c) == nil, // if admin: display hidden templates
-		in.PageSize, in.Last)
+		tags, in.PageSize, in.Last)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +61,7 @@ func ListTemplates(c *gin.Context, in *listTemplatesIn) ([]*tasktemplate.TaskTem
 		lastT := tt[len(tt)-1].Name
 		c.Header(
 			linkHeader,
-			buildTemplateNextLink(in.PageSize, lastT),
+			buildTemplateNextLink(in.Tags, in.PageSize, lastT),
 		)
 	}
 
@@ -61,3 +85,356 @@ func GetTemplate(c *gin.Context, in *getTemplateIn) (*tasktemplate.TaskTemplate,
 	return tasktemplate.LoadFromName(dbp, in.Name)
 
 }
+
+type getTemplateDiffIn struct {
+	Name string `path:"name, required"`
+	From *int   `query:"from"`
+	To   *int   `query:"to"`
+}
+
+// GetTemplateDiff returns the changes between two versions of a template,
+// by default between its latest version and the previous one
+func GetTemplateDiff(c *gin.Context, in *getTemplateDiffIn) (*tasktemplate.Diff, error) {
+	metadata.AddActionMetadata(c, metadata.TemplateName, in.Name)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	tt, err := tasktemplate.LoadFromName(dbp, in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	to := tt.Version
+	if in.To != nil {
+		to = *in.To
+	}
+	from := to - 1
+	if in.From != nil {
+		from = *in.From
+	}
+	if to < 1 || (in.From != nil && from < 1) {
+		return nil, errors.BadRequestf("Template versions start at 1")
+	}
+	if from < 1 {
+		return nil, errors.BadRequestf("Template %q has a single version", tt.Name)
+	}
+
+	return tasktemplate.DiffVersions(dbp, tt, from, to)
+}
+
+// actions available to halt the resolutions of a template
+const (
+	haltActionCancel = "cancel"
+	haltActionPause  = "pause"
+)
+
+type haltTemplateIn struct {
+	Name   string `path:"name, required"`
+	Action string `query:"action,default=cancel" enum:"cancel,pause"`
+	Block  bool   `query:"block"`
+}
+
+type haltTemplateOut struct {
+	Action     string `json:"action"`
+	Halted     int    `json:"halted"`
+	Halting    int    `json:"halting"`
+	Unresolved int    `json:"unresolved"`
+	Skipped    int64  `json:"skipped"`
+	Blocked    bool   `json:"blocked"`
+}
+
+// HaltTemplate cancels (or pauses) all the unfinished resolutions of a template at once,
+// and optionally blocks the template from new task creation
+// running resolutions, held by their engine, are halted at the end of their current run and reported as halting
+// the tasks still waiting for a resolution are set to WONTFIX when cancelling, and left as they are when pausing
+// resolutions locked by another operation are left untouched and reported as skipped
+func HaltTemplate(c *gin.Context, in *haltTemplateIn) (*haltTemplateOut, error) {
+	metadata.AddActionMetadata(c, metadata.TemplateName, in.Name)
+
+	states := resolution.HaltableStates
+	excludedStates := []string{resolution.StateDone, resolution.StateCancelled}
+	haltState := resolution.StateCancelled
+	switch in.Action {
+	case haltActionCancel:
+	case haltActionPause:
+		states = make([]string, 0, len(resolution.HaltableStates))
+		for _, s := range resolution.HaltableStates {
+			if s != resolution.StatePaused {
+				states = append(states, s)
+			}
+		}
+		excludedStates = append(excludedStates, resolution.StatePaused)
+		haltState = resolution.StatePaused
+	default:
+		return nil, errors.BadRequestf("Unknown action '%s'. Was expecting one of %s, %s", in.Action, haltActionCancel, haltActionPause)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+
+	tt, err := tasktemplate.LoadFromName(dbp, in.Name)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if in.Block && !tt.Blocked {
+		if err := tt.SetBlocked(dbp, true); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+	}
+
+	rr, err := resolution.ListHaltable(dbp, tt.Name, states)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	cancelled := make([]*task.Task, 0, len(rr))
+
+	for _, simplified := range rr {
+		r, err := resolution.LoadLockedFromPublicID(dbp, simplified.PublicID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		t, err := task.LoadFromID(dbp, r.TaskID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		comment := "paused resolution while halting its template"
+		if in.Action == haltActionCancel {
+			comment = "cancelled resolution while halting its template"
+		}
+		r.SetState(haltState)
+
+		if err := r.Update(dbp); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		if in.Action == haltActionCancel {
+			t.SetState(task.StateCancelled)
+			if err := t.Update(dbp, true, true); err != nil {
+				dbp.Rollback()
+				return nil, err
+			}
+			cancelled = append(cancelled, t)
+		}
+
+		if _, err := task.CreateSystemComment(dbp, t, reqUsername, comment); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+	}
+
+	// the engine applies the halt once the steps already running are over
+	running, err := resolution.ListHaltable(dbp, tt.Name, resolution.RunningStates)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	for _, r := range running {
+		if err := resolution.RequestHalt(dbp, r.ID, haltState); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		t, err := task.LoadFromID(dbp, r.TaskID)
+		if err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+
+		comment := "resolution to be paused at the end of its current run, while halting its template"
+		if in.Action == haltActionCancel {
+			comment = "resolution to be cancelled at the end of its current run, while halting its template"
+		}
+		if _, err := task.CreateSystemComment(dbp, t, reqUsername, comment); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+	}
+
+	unresolved, err := task.ListUnresolved(dbp, tt.ID)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if in.Action == haltActionCancel {
+		for _, t := range unresolved {
+			t.SetState(task.StateWontfix)
+			if err := t.Update(dbp,
+				false, // skip validation of task contents, task is dead anyway
+				true,  // do record mark change with last activity timestamp
+			); err != nil {
+				dbp.Rollback()
+				return nil, err
+			}
+
+			if _, err := task.CreateSystemComment(dbp, t, reqUsername, "changed task state to WONTFIX while halting its template"); err != nil {
+				dbp.Rollback()
+				return nil, err
+			}
+			cancelled = append(cancelled, t)
+		}
+	}
+
+	count, err := resolution.CountFromTemplate(dbp, tt.Name, excludedStates)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	// c can't be used once the request is over, only its context is kept for the logs
+	ctx := c.Request.Context()
+	resumed := make(map[string]bool)
+	for _, t := range cancelled {
+		parentTask, err := taskutils.ShouldResumeParentTask(dbp, t)
+		if err == nil && parentTask != nil && !resumed[parentTask.PublicID] {
+			resumed[parentTask.PublicID] = true
+			resolutionID := *parentTask.Resolution
+			go func() {
+				correlation.Logger(ctx).WithFields(logrus.Fields{"task_id": parentTask.PublicID, "resolution_id": resolutionID}).Debugf("resuming resolution %q as template %q was halted", resolutionID, tt.Name)
+
+				_ = engine.GetEngine().ResolveWithContext(ctx, resolutionID, nil)
+			}()
+		}
+
+		resumeDependentTasks(ctx, dbp, t)
+	}
+
+	return &haltTemplateOut{
+		Action:     in.Action,
+		Halted:     len(rr),
+		Halting:    len(running),
+		Unresolved: len(unresolved),
+		Skipped:    count - int64(len(running)),
+		Blocked:    tt.Blocked,
+	}, nil
+}
+
+type blockTemplateIn struct {
+	Name string `path:"name, required"`
+}
+
+// BlockTemplate refuses the creation of new tasks from a template,
+// existing tasks and their resolutions are not affected
+func BlockTemplate(c *gin.Context, in *blockTemplateIn) (*tasktemplate.TaskTemplate, error) {
+	return setTemplateBlocked(c, in.Name, true)
+}
+
+// UnblockTemplate allows again the creation of new tasks from a template
+func UnblockTemplate(c *gin.Context, in *blockTemplateIn) (*tasktemplate.TaskTemplate, error) {
+	return setTemplateBlocked(c, in.Name, false)
+}
+
+func setTemplateBlocked(c *gin.Context, name string, blocked bool) (*tasktemplate.TaskTemplate, error) {
+	metadata.AddActionMetadata(c, metadata.TemplateName, name)
+
+	if err := auth.IsAdmin(c); err != nil {
+		return nil, err
+	}
+
+	metadata.SetSUDO(c)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	tt, err := tasktemplate.LoadFromName(dbp, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if tt.Blocked != blocked {
+		if err := tt.SetBlocked(dbp, blocked); err != nil {
+			return nil, err
+		}
+	}
+
+	return tt, nil
+}
+
+type templatesDocument struct {
+	Templates []*tasktemplate.TaskTemplate `json:"templates" binding:"required"`
+}
+
+// ExportTemplates returns the full representation of every template, as a single YAML document
+// which can be fed back to ImportTemplates
+func ExportTemplates(c *gin.Context) error {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	tt, err := tasktemplate.ListAll(dbp,
+		auth.IsAdmin(c) == nil, // if admin: export hidden templates
+	)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(templatesDocument{Templates: tt})
+	if err != nil {
+		return err
+	}
+
+	c.Data(http.StatusOK, "application/yaml", out)
+	return nil
+}
+
+type importTemplatesOut struct {
+	Templates []tasktemplate.ImportResult `json:"templates"`
+}
+
+// ImportTemplates creates or updates a set of templates, all at once:
+// if a single template is invalid, none of them is imported, and the outcome
+// of each template is reported along with a 400 status
+func ImportTemplates(c *gin.Context, in *templatesDocument) (*importTemplatesOut, error) {
+	if err := auth.IsAdmin(c); err != nil {
+		return nil, err
+	}
+
+	metadata.SetSUDO(c)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	results, committed, err := tasktemplate.Import(dbp, in.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	if !committed {
+		// rendered right away, tonic only renders a payload along with the status of the route
+		c.JSON(http.StatusBadRequest, &importTemplatesOut{Templates: results})
+		return nil, nil
+	}
+
+	return &importTemplatesOut{Templates: results}, nil
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,15 +14,29 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/resolution"
 	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/leader"
 )
 
 var (
-	metrics = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "utask_task_state"}, []string{"status", "template", "group"})
+	metrics         = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "utask_task_state"}, []string{"status", "template", "group"})
+	priorityMetrics = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "utask_task_priority_state"}, []string{"status", "template", "priority"})
+	runningMetrics  = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "utask_template_running_resolutions"}, []string{"template"})
+	orphanMetric    = promauto.NewGauge(prometheus.GaugeOpts{Name: "utask_orphan_resolutions", Help: "Resolutions owned by a dead instance, awaiting a takeover"})
 )
 
 func updateMetrics(dbp zesty.DBProvider) {
-	stats, err := task.LoadStateCountResolverGroup(dbp)
+	// the metrics computed from the database are exposed by the leader only
+	if !leader.IsLeader() {
+		metrics.Reset()
+		priorityMetrics.Reset()
+		runningMetrics.Reset()
+		orphanMetric.Set(0)
+		return
+	}
+
+	stats, err := task.LoadStateCountResolverGroup(dbp, nil, task.Period{})
 	if err != nil {
 		logrus.Warn(err)
 	}
@@ -33,6 +48,35 @@ func updateMetrics(dbp zesty.DBProvider) {
 			}
 		}
 	}
+
+	priorityStats, err := task.LoadStateCountPriority(dbp)
+	if err != nil {
+		logrus.Warn(err)
+	}
+
+	for priority, groupStats := range priorityStats {
+		for template, templateStats := range groupStats {
+			for state, count := range templateStats {
+				priorityMetrics.WithLabelValues(state, template, strconv.Itoa(priority)).Set(count)
+			}
+		}
+	}
+
+	runningStats, err := resolution.LoadRunningCountByTemplate(dbp)
+	if err != nil {
+		logrus.Warn(err)
+	}
+
+	for template, count := range runningStats {
+		runningMetrics.WithLabelValues(template).Set(count)
+	}
+
+	orphans, err := resolution.LoadOrphanCount(dbp)
+	if err != nil {
+		logrus.Warn(err)
+	} else {
+		orphanMetric.Set(float64(orphans))
+	}
 }
 
 func collectMetrics(ctx context.Context) {
@@ -60,13 +104,21 @@ func collectMetrics(ctx context.Context) {
 }
 
 type StatsIn struct {
-	Tags []string `query:"tag" explode:"true"`
+	Tags          []string   `query:"tag" explode:"true"`
+	CreatedAfter  *time.Time `query:"created_after"`
+	CreatedBefore *time.Time `query:"created_before"`
+	EndedAfter    *time.Time `query:"ended_after"`
+	EndedBefore   *time.Time `query:"ended_before"`
 }
 
 // StatsOut aggregates different business stats:
 // - a map of task states and their count
+// - the same counts for each template, along with the durations of their resolutions
+// - the same counts for each resolver group, the tasks without any group being counted under ""
 type StatsOut struct {
-	TaskStates map[string]float64 `json:"task_states"`
+	TaskStates  map[string]float64             `json:"task_states"`
+	PerTemplate map[string]*task.TemplateStats `json:"per_template"`
+	ByGroup     map[string]map[string]float64  `json:"by_group"`
 }
 
 // Stats handles the http request to fetch µtask statistics
@@ -89,10 +141,35 @@ func Stats(c *gin.Context, in *StatsIn) (*StatsOut, error) {
 		tags[parts[0]] = parts[1]
 	}
 
+	period := task.Period{
+		CreatedAfter:  in.CreatedAfter,
+		CreatedBefore: in.CreatedBefore,
+		EndedAfter:    in.EndedAfter,
+		EndedBefore:   in.EndedBefore,
+	}
+
 	out := StatsOut{}
-	out.TaskStates, err = task.LoadStateCount(dbp, tags)
+	out.TaskStates, err = task.LoadStateCount(dbp, tags, period)
 	if err != nil {
 		return nil, err
 	}
+	out.PerTemplate, err = task.LoadTemplateStats(dbp, tags, period)
+	if err != nil {
+		return nil, err
+	}
+
+	groupStats, err := task.LoadStateCountResolverGroup(dbp, tags, period)
+	if err != nil {
+		return nil, err
+	}
+	out.ByGroup = make(map[string]map[string]float64, len(groupStats))
+	for group, templateStats := range groupStats {
+		out.ByGroup[group] = make(map[string]float64)
+		for _, stateCounts := range templateStats {
+			for state, count := range stateCounts {
+				out.ByGroup[group][state] += count
+			}
+		}
+	}
 	return &out, nil
 }
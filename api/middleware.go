@@ -12,11 +12,24 @@ import (
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/metadata"
 	"github.com/wI2L/fizz"
 )
 
-var requestIDHeader = http.CanonicalHeaderKey("X-Request-Id")
+var requestIDHeader = http.CanonicalHeaderKey(correlation.Header)
+
+// correlationMiddleware attaches a correlation ID to the request context,
+// shared by all the logs of the request and of the resolutions it runs
+func correlationMiddleware(c *gin.Context) {
+	id := c.Request.Header.Get(requestIDHeader)
+	if id == "" {
+		id = correlation.NewID()
+	}
+	c.Request = c.Request.WithContext(correlation.NewContext(c.Request.Context(), id))
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
 
 func auditLogsMiddleware(c *gin.Context) {
 	now := time.Now()
@@ -57,12 +70,12 @@ func auditLogsMiddleware(c *gin.Context) {
 
 	if len(errs) > 0 {
 		fields["success"] = false
-		logrus.WithFields(fields).WithError(
+		correlation.Logger(c.Request.Context()).WithFields(fields).WithError(
 			errors.New(strings.Join(errs, "\n")),
 		).Error("error")
 	} else {
 		fields["success"] = true
-		logrus.WithFields(fields).Info("success")
+		correlation.Logger(c.Request.Context()).WithFields(fields).Info("success")
 	}
 }
 
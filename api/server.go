@@ -7,14 +7,15 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"sort"
 	"strings"
 	"syscall"
 
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/tonic"
-	"github.com/loopfz/gadgeto/tonic/utils/jujerr"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/wI2L/fizz"
@@ -22,10 +23,10 @@ import (
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/api/handler"
-	"github.com/cneill/utask/db"
-	"github.com/cneill/utask/models/resolution"
-	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/keyrotation"
+	"github.com/cneill/utask/pkg/notify"
+	"github.com/cneill/utask/pkg/taskfeed"
 )
 
 type PluginRoute struct {
@@ -53,7 +54,10 @@ type Server struct {
 	dashboardAPIPathPrefix string
 	dashboardSentryDSN     string
 	maxBodyBytes           int64
+	maxCompressedBodyBytes int64
+	routeMaxBodyBytes      map[string]int64
 	customMiddlewares      []gin.HandlerFunc
+	auditSinks             []AuditSink
 	pluginRoutes           []PluginRouterGroup
 }
 
@@ -111,6 +115,33 @@ func (s *Server) SetMaxBodyBytes(max int64) {
 	s.maxBodyBytes = max
 }
 
+// MaxBodyBytes returns the max body bytes of a route, given by its path, for the handlers
+// reading the request body before it gets bound, such as the handlers of plugin routes
+func (s *Server) MaxBodyBytes(route string) int64 {
+	if max, ok := s.routeMaxBodyBytes[route]; ok {
+		return boundMaxBodyBytes(max)
+	}
+	if max, ok := defaultRouteMaxBodyBytes[route]; ok {
+		return max
+	}
+	return boundMaxBodyBytes(s.maxBodyBytes)
+}
+
+// SetMaxCompressedBodyBytes limits the size of the compressed request bodies, before they are decompressed
+// and limited by the max body bytes of their route
+func (s *Server) SetMaxCompressedBodyBytes(max int64) {
+	s.maxCompressedBodyBytes = max
+}
+
+// SetRouteMaxBodyBytes overrides the max body bytes for a single route, given by its path
+// (e.g. "/batch" or "/task/:id/comment"), whatever its method
+func (s *Server) SetRouteMaxBodyBytes(route string, max int64) {
+	if s.routeMaxBodyBytes == nil {
+		s.routeMaxBodyBytes = map[string]int64{}
+	}
+	s.routeMaxBodyBytes[route] = max
+}
+
 // ListenAndServe launches an http server and stays blocked until
 // the server is shut down by a system signal
 func (s *Server) ListenAndServe() error {
@@ -196,7 +227,14 @@ func (s *Server) build(ctx context.Context) {
 			StaticFS("/ui/swagger", http.Dir("./static/swagger-ui"))
 
 		collectMetrics(ctx)
-		ginEngine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		if err := taskfeed.Start(ctx); err != nil {
+			logrus.Warn(err)
+		}
+		// OpenMetrics exposes the exemplars, such as the ID of the latest attempt of the steps
+		ginEngine.GET("/metrics", gin.WrapH(promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		)))
 
 		router := fizz.NewFromEngine(ginEngine)
 
@@ -211,11 +249,15 @@ func (s *Server) build(ctx context.Context) {
 			},
 		})
 
+		router.Use(compressionMiddleware, correlationMiddleware)
 		router.Use(s.customMiddlewares...)
 		router.Use(ajaxHeadersMiddleware, auditLogsMiddleware)
+		if len(s.auditSinks) > 0 {
+			router.Use(auditSinksMiddleware(s.auditSinks))
+		}
 
-		tonic.SetErrorHook(jujerr.ErrHook)
-		tonic.SetBindHook(defaultBindingHook(s.maxBodyBytes))
+		tonic.SetErrorHook(errorHook)
+		tonic.SetBindHook(defaultBindingHook(s.maxBodyBytes, s.maxCompressedBodyBytes, s.routeMaxBodyBytes))
 		tonic.SetRenderHook(yamljsonRenderHook, "application/json")
 
 		authRoutes := router.Group("/", "x-misc", "Misc authenticated routes", s.authMiddleware)
@@ -234,7 +276,54 @@ func (s *Server) build(ctx context.Context) {
 						fizz.ID("GetTemplate"),
 						fizz.Summary("Get task template details"),
 					},
+					etagMiddleware,
 					tonic.Handler(handler.GetTemplate, 200))
+				templateRoutes.GET("/template/:name/diff",
+					[]fizz.OperationOption{
+						fizz.ID("GetTemplateDiff"),
+						fizz.Summary("Get the changes between two versions of a task template"),
+						fizz.Description("Compares the versions given as from and to, by default the latest version and the previous one"),
+					},
+					tonic.Handler(handler.GetTemplateDiff, 200))
+				templateRoutes.POST("/template/:name/halt",
+					[]fizz.OperationOption{
+						fizz.ID("HaltTemplate"),
+						fizz.Summary("Cancel or pause all the unfinished resolutions of a task template"),
+						fizz.Description("Running resolutions are halted at the end of their current run, the tasks without a resolution are set to WONTFIX when cancelling. The template can be blocked from new task creation at the same time. Admin rights required"),
+					},
+					requireAdmin,
+					tonic.Handler(handler.HaltTemplate, 200))
+				templateRoutes.POST("/template/:name/block",
+					[]fizz.OperationOption{
+						fizz.ID("BlockTemplate"),
+						fizz.Summary("Refuse the creation of new tasks from a task template"),
+						fizz.Description("Existing tasks are not affected. Admin rights required"),
+					},
+					requireAdmin,
+					tonic.Handler(handler.BlockTemplate, 200))
+				templateRoutes.POST("/template/:name/unblock",
+					[]fizz.OperationOption{
+						fizz.ID("UnblockTemplate"),
+						fizz.Summary("Allow again the creation of new tasks from a task template"),
+						fizz.Description("Admin rights required"),
+					},
+					requireAdmin,
+					tonic.Handler(handler.UnblockTemplate, 200))
+				templateRoutes.GET("/template/export",
+					[]fizz.OperationOption{
+						fizz.ID("ExportTemplates"),
+						fizz.Summary("Export all task templates as a single YAML document"),
+					},
+					tonic.Handler(handler.ExportTemplates, 200))
+				templateRoutes.POST("/template/import",
+					[]fizz.OperationOption{
+						fizz.ID("ImportTemplates"),
+						fizz.Summary("Create or update a set of task templates"),
+						fizz.Description("All templates are validated before being imported in a single transaction. Admin rights required"),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.ImportTemplates, 200))
 			}
 
 			functionRoutes := authRoutes.Group("/", "05 - function", "Manage uTask task functions")
@@ -263,14 +352,29 @@ func (s *Server) build(ctx context.Context) {
 						fizz.ID("BatchCreateTask"),
 						fizz.Summary("Create a batch of tasks"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeCreate),
 					tonic.Handler(handler.CreateBatch, 201))
+				taskRoutes.GET("/batch/:id",
+					[]fizz.OperationOption{
+						fizz.ID("GetBatch"),
+						fizz.Summary("Get batch details"),
+						fizz.Description("Count the tasks of a batch by state, and list them."),
+					},
+					tonic.Handler(handler.GetBatch, 200))
+				taskRoutes.POST("/batch/:id/cancel",
+					[]fizz.OperationOption{
+						fizz.ID("CancelBatch"),
+						fizz.Summary("Cancel batch"),
+						fizz.Description("Set all the tasks of a batch which are not over yet to WONTFIX, except the ones being run."),
+					},
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.CancelBatch, 200))
 				taskRoutes.POST("/task",
 					[]fizz.OperationOption{
 						fizz.ID("CreateTask"),
 						fizz.Summary("Create new task"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeCreate),
 					tonic.Handler(handler.CreateTask, 201))
 				taskRoutes.GET("/task",
 					[]fizz.OperationOption{
@@ -278,25 +382,63 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Summary("List tasks"),
 					},
 					tonic.Handler(handler.ListTasks, 200))
+				taskRoutes.GET("/task/subscribe",
+					[]fizz.OperationOption{
+						fizz.ID("SubscribeTasks"),
+						fizz.Summary("Subscribe to the live task list"),
+						fizz.Description("Upgrades the connection to a websocket, pushing the tasks as they are updated. The tasks are filtered by type, state, template and tags as by ListTasks. Each updated task is pushed as a 'task' event; a 'resync' event tells the client to list the tasks again, when too many were updated at once."),
+					},
+					handler.SubscribeTasks)
+				taskRoutes.POST("/task/batch-get",
+					[]fizz.OperationOption{
+						fizz.ID("BatchGetTasks"),
+						fizz.Summary("Get the details of several tasks"),
+						fizz.Description("Tasks are returned as by GetTask. The missing ones and the ones the user is not allowed to see are skipped, and reported."),
+					},
+					tonic.Handler(handler.BatchGetTasks, 200))
+				taskRoutes.GET("/quota",
+					[]fizz.OperationOption{
+						fizz.ID("GetQuota"),
+						fizz.Summary("Get the usage of the task creation quota"),
+						fizz.Description("Count the tasks created by the user over the quota window, for all templates and for the given template. Admins are exempt from the quota."),
+					},
+					tonic.Handler(handler.GetQuota, 200))
 				taskRoutes.GET("/task/:id",
 					[]fizz.OperationOption{
 						fizz.ID("GetTask"),
 						fizz.Summary("Get task details"),
 					},
+					etagMiddleware,
 					tonic.Handler(handler.GetTask, 200))
 				taskRoutes.PUT("/task/:id",
 					[]fizz.OperationOption{
 						fizz.ID("EditTask"),
 						fizz.Summary("Edit task"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.UpdateTask, 200))
+				taskRoutes.POST("/task/:id/assign",
+					[]fizz.OperationOption{
+						fizz.ID("AssignTask"),
+						fizz.Summary("Assign task"),
+						fizz.Description("Claim a task before running it, for the caller or another allowed resolver. Only the assignee can then resolve the task."),
+					},
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.AssignTask, 200))
+				taskRoutes.DELETE("/task/:id/assign",
+					[]fizz.OperationOption{
+						fizz.ID("UnassignTask"),
+						fizz.Summary("Unassign task"),
+						fizz.Description("Release the claim on a task. Only the assignee or an admin can unassign a task."),
+					},
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.UnassignTask, 204))
 				taskRoutes.POST("/task/:id/wontfix",
 					[]fizz.OperationOption{
 						fizz.ID("CancelTask"),
 						fizz.Summary("Cancel task"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.WontfixTask, 204))
 				taskRoutes.DELETE("/task/:id",
 					[]fizz.OperationOption{
@@ -305,8 +447,26 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Description("Admin rights required"),
 					},
 					requireAdmin,
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.DeleteTask, 204))
+				taskRoutes.POST("/task/:id/archive",
+					[]fizz.OperationOption{
+						fizz.ID("ArchiveTask"),
+						fizz.Summary("Archive task"),
+						fizz.Description("Store the task, its resolution and comments in the configured archive storage, then delete them. Admin rights required"),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.ArchiveTask, 200))
+				taskRoutes.POST("/task/restore",
+					[]fizz.OperationOption{
+						fizz.ID("RestoreTask"),
+						fizz.Summary("Restore an archived task"),
+						fizz.Description("Insert back in DB a task, its resolution and comments from the configured archive storage. The task must not exist anymore, and its template must still exist. Admin rights required"),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.RestoreTask, 201))
 			}
 
 			// comments
@@ -317,7 +477,7 @@ func (s *Server) build(ctx context.Context) {
 						fizz.ID("AddTaskComment"),
 						fizz.Summary("Post new comment on task"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.CreateComment, 201))
 				commentsRoutes.GET("/task/:id/comment",
 					[]fizz.OperationOption{
@@ -336,14 +496,14 @@ func (s *Server) build(ctx context.Context) {
 						fizz.ID("EditTaskComment"),
 						fizz.Summary("Edit task comment"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.UpdateComment, 200))
 				commentsRoutes.DELETE("/task/:id/comment/:commentid",
 					[]fizz.OperationOption{
 						fizz.ID("DeleteTaskComment"),
 						fizz.Summary("Delete task comment"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.DeleteComment, 204))
 			}
 
@@ -356,14 +516,22 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Summary("Create task resolution"),
 						fizz.Summary("This action instantiates a holder for the task's execution state. Only an approved resolver or admin user can perform this action."),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeExecute),
 					tonic.Handler(handler.CreateResolution, 201))
+				resolutionRoutes.GET("/resolution/mine",
+					[]fizz.OperationOption{
+						fizz.ID("ListMyResolutions"),
+						fizz.Summary("List the resolutions waiting for an action of the user"),
+						fizz.Description("Resolutions in state TODO, PAUSED or BLOCKED_*, for which the user is an allowed resolver. The state filter also accepts BLOCKED, matching any blocked state."),
+					},
+					tonic.Handler(handler.ListMyResolutions, 200))
 				resolutionRoutes.GET("/resolution/:id",
 					[]fizz.OperationOption{
 						fizz.ID("GetTaskResolution"),
 						fizz.Summary("Get the details of a task resolution"),
 						fizz.Description("Details include the intermediate results of every step. Admin users can view any resolution's details."),
 					},
+					etagMiddleware,
 					tonic.Handler(handler.GetResolution, 200))
 				resolutionRoutes.PUT("/resolution/:id",
 					[]fizz.OperationOption{
@@ -372,14 +540,15 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Description("Action of last resort if a task needs fixing. Admin users only."),
 					},
 					requireAdmin,
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.UpdateResolution, 204))
 				resolutionRoutes.POST("/resolution/:id/run",
 					[]fizz.OperationOption{
 						fizz.ID("ExecuteTask"),
 						fizz.Summary("Execute a task"),
+						fizz.Description("With dry_run, the actions of the resolution are described in a 200 response instead, without running them"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeExecute),
 					tonic.Handler(handler.RunResolution, 204))
 				resolutionRoutes.POST("/resolution/:id/pause",
 					[]fizz.OperationOption{
@@ -387,21 +556,38 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Summary("Pause a task's execution"),
 						fizz.Description("This action takes a task out of the execution pipeline, it will not be considered for automatic retry until it is re-run manually."),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.PauseResolution, 204))
+				resolutionRoutes.POST("/resolution/extend",
+					[]fizz.OperationOption{
+						fizz.ID("ExtendTaskResolutions"),
+						fizz.Summary("Extend max retry limit for all the task executions matching a filter"),
+						fizz.Description("Resolutions are selected by template name, task tags and state, BLOCKED_MAXRETRIES by default (ERROR and CRASHED are also accepted). Blocked resolutions are resumed right away. Resolutions currently running are left untouched. Returns the number of extended resolutions. Admin rights required."),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeExecute),
+					tonic.Handler(handler.ExtendResolutions, 200))
 				resolutionRoutes.POST("/resolution/:id/extend",
 					[]fizz.OperationOption{
 						fizz.ID("ExtendTaskResolution"),
 						fizz.Summary("Extend max retry limit for a task's execution"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeExecute),
 					tonic.Handler(handler.ExtendResolution, 204))
+				resolutionRoutes.POST("/resolution/:id/schedule",
+					[]fizz.OperationOption{
+						fizz.ID("ScheduleTaskResolution"),
+						fizz.Summary("Schedule the next execution of a task"),
+						fizz.Description("The resolution is run once the given time ('at') or duration ('delay') is reached. Admin or resolution manager rights required."),
+					},
+					maintenanceMode(utask.MaintenanceScopeExecute),
+					tonic.Handler(handler.ScheduleResolution, 204))
 				resolutionRoutes.POST("/resolution/:id/cancel",
 					[]fizz.OperationOption{
 						fizz.ID("CancelTaskResolution"),
 						fizz.Summary("Cancel a task's execution"),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.CancelResolution, 204))
 				resolutionRoutes.GET("/resolution/:id/step/:stepName",
 					[]fizz.OperationOption{
@@ -417,16 +603,58 @@ func (s *Server) build(ctx context.Context) {
 						fizz.Description("Allow the edition of a step, if a step needs fixing. Admin users only."),
 					},
 					requireAdmin,
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.UpdateResolutionStep, 204))
+				resolutionRoutes.POST("/resolution/:id/replay",
+					[]fizz.OperationOption{
+						fizz.ID("ReplayTaskResolution"),
+						fizz.Summary("Replay a task resolution from a step"),
+						fizz.Description("The given step and all the steps depending on it are reset to TODO, and the resolution runs again. The outputs of the other steps are kept. Resolution managers only."),
+					},
+					maintenanceMode(utask.MaintenanceScopeExecute),
+					tonic.Handler(handler.ReplayResolution, 204))
+				resolutionRoutes.PUT("/resolution/:id/step/:stepName/input",
+					[]fizz.OperationOption{
+						fizz.ID("OverrideTaskResolutionStepInput"),
+						fizz.Summary("Override the input of the step of a task resolution"),
+						fizz.Description("The given configuration is used as is by the action of the step on its next runs, instead of its templated configuration. The author of the override is recorded. Admin users only."),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.OverrideResolutionStepInput, 204))
+				resolutionRoutes.DELETE("/resolution/:id/step/:stepName/input",
+					[]fizz.OperationOption{
+						fizz.ID("RemoveTaskResolutionStepInputOverride"),
+						fizz.Summary("Remove the input override of the step of a task resolution"),
+						fizz.Description("The configuration of the action of the step is templated again on its next runs. Admin users only."),
+					},
+					requireAdmin,
+					maintenanceMode(utask.MaintenanceScopeAll),
+					tonic.Handler(handler.RemoveResolutionStepInputOverride, 204))
 				resolutionRoutes.PUT("/resolution/:id/step/:stepName/state",
 					[]fizz.OperationOption{
 						fizz.ID("EditTaskResolutionStepState"),
 						fizz.Summary("Edit the state of the step of a task resolution"),
 						fizz.Description("Allow the edition of the step state, if a step needs to be re-run or skipped manually. Resolution managers only."),
 					},
-					maintenanceMode,
+					maintenanceMode(utask.MaintenanceScopeAll),
 					tonic.Handler(handler.UpdateResolutionStepState, 204))
+				resolutionRoutes.POST("/resolution/:id/step/:stepName/approve",
+					[]fizz.OperationOption{
+						fizz.ID("ApproveTaskResolutionStep"),
+						fizz.Summary("Approve a step of a task resolution"),
+						fizz.Description("The approval step waiting for a decision is done, and the resolution resumes. The approver is recorded in the step output, with an optional reason. Resolution managers only."),
+					},
+					maintenanceMode(utask.MaintenanceScopeExecute),
+					tonic.Handler(handler.ApproveResolutionStep, 204))
+				resolutionRoutes.POST("/resolution/:id/step/:stepName/reject",
+					[]fizz.OperationOption{
+						fizz.ID("RejectTaskResolutionStep"),
+						fizz.Summary("Reject a step of a task resolution"),
+						fizz.Description("The approval step waiting for a decision fails with the given reason, blocking the resolution. Resolution managers only."),
+					},
+					maintenanceMode(utask.MaintenanceScopeExecute),
+					tonic.Handler(handler.RejectResolutionStep, 204))
 
 				//	resolutionRoutes.POST("/resolution/:id/rollback",
 				//		[]fizz.OperationOption{
@@ -451,13 +679,39 @@ func (s *Server) build(ctx context.Context) {
 				tonic.Handler(rootHandler, 200))
 
 			// admin
+			// not subject to maintenance mode, to be able to leave it
+			authRoutes.PUT("/maintenance",
+				[]fizz.OperationOption{
+					fizz.ID("SetMaintenanceMode"),
+					fizz.Summary("Switch the instance in or out of maintenance mode"),
+					fizz.Description("In maintenance mode, the write operations of its scope are refused: 'create' for the creation of tasks, 'execute' for the runs of resolutions, 'all' (default) for all of them except admin actions. The mode is not shared with other instances, and is reset to the startup value on restart. Admin rights required"),
+				},
+				requireAdmin,
+				tonic.Handler(setMaintenanceMode, 200))
 			authRoutes.POST("/key-rotate",
 				[]fizz.OperationOption{
 					fizz.ID("ReencryptData"),
 					fizz.Summary("Re-encrypt all data with latest storage key"),
+					fizz.Description("The re-encryption runs in the background, resuming the previous one if it was interrupted or failed. Only one can run at once. Admin rights required"),
 				},
 				requireAdmin,
 				tonic.Handler(keyRotate, 200))
+			authRoutes.GET("/key-rotate/status",
+				[]fizz.OperationOption{
+					fizz.ID("GetReencryptDataStatus"),
+					fizz.Summary("Get the progress of the re-encryption of all data with latest storage key"),
+					fizz.Description("Admin rights required"),
+				},
+				requireAdmin,
+				tonic.Handler(keyRotateStatus, 200))
+			authRoutes.POST("/notify/reload",
+				[]fizz.OperationOption{
+					fizz.ID("ReloadNotifyBackends"),
+					fizz.Summary("Reload the notification backends from the configuration"),
+					fizz.Description("The notification backends and actions are replaced all at once, or kept unchanged if the new configuration is invalid. Admin rights required"),
+				},
+				requireAdmin,
+				tonic.Handler(reloadNotifyBackends, 200))
 		}
 
 		router.GET("/unsecured/mon/ping",
@@ -483,7 +737,7 @@ func (s *Server) build(ctx context.Context) {
 				routeHandlers := []gin.HandlerFunc{}
 
 				if r.Maintenance {
-					routeHandlers = append(routeHandlers, maintenanceMode)
+					routeHandlers = append(routeHandlers, maintenanceMode(utask.MaintenanceScopeAll))
 				}
 				if r.Secured {
 					routeHandlers = append(routeHandlers, s.authMiddleware)
@@ -521,12 +775,14 @@ func pingHandler(c *gin.Context) {
 }
 
 type rootOut struct {
-	ApplicationName string   `json:"application_name"`
-	UserIsAdmin     bool     `json:"user_is_admin"`
-	Username        string   `json:"username"`
-	UserGroups      []string `json:"user_groups"`
-	Version         string   `json:"version"`
-	Commit          string   `json:"commit"`
+	ApplicationName  string   `json:"application_name"`
+	UserIsAdmin      bool     `json:"user_is_admin"`
+	Username         string   `json:"username"`
+	UserGroups       []string `json:"user_groups"`
+	Version          string   `json:"version"`
+	Commit           string   `json:"commit"`
+	MaintenanceMode  bool     `json:"maintenance_mode"`
+	MaintenanceScope string   `json:"maintenance_scope,omitempty"`
 }
 
 func rootHandler(c *gin.Context) (*rootOut, error) {
@@ -536,12 +792,14 @@ func rootHandler(c *gin.Context) (*rootOut, error) {
 	}
 
 	return &rootOut{
-		ApplicationName: utask.AppName(),
-		UserIsAdmin:     auth.IsAdmin(c) == nil,
-		Username:        auth.GetIdentity(c),
-		UserGroups:      groups,
-		Version:         utask.Version,
-		Commit:          utask.Commit,
+		ApplicationName:  utask.AppName(),
+		UserIsAdmin:      auth.IsAdmin(c) == nil,
+		Username:         auth.GetIdentity(c),
+		UserGroups:       groups,
+		Version:          utask.Version,
+		Commit:           utask.Commit,
+		MaintenanceMode:  utask.MaintenanceMode(),
+		MaintenanceScope: utask.MaintenanceScope(),
 	}, nil
 }
 
@@ -553,26 +811,77 @@ func requireAdmin(c *gin.Context) {
 	c.Next()
 }
 
-func maintenanceMode(c *gin.Context) {
-	if utask.FMaintenanceMode {
-		c.JSON(http.StatusMethodNotAllowed, map[string]string{
-			"error": "Maintenance mode activated",
-		})
-		return
+// maintenanceMode refuses the requests of a route while the maintenance mode
+// covers the given scope of operations
+func maintenanceMode(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utask.MaintenanceBlocks(scope) {
+			c.JSON(http.StatusMethodNotAllowed, map[string]string{
+				"error": "Maintenance mode activated",
+			})
+			return
+		}
+		c.Next()
 	}
-	c.Next()
 }
 
-func keyRotate(c *gin.Context) error {
+type setMaintenanceModeIn struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Scope   string `json:"scope"` // default: all
+}
+
+type maintenanceModeOut struct {
+	Enabled bool   `json:"enabled"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+func setMaintenanceMode(c *gin.Context, in *setMaintenanceModeIn) (*maintenanceModeOut, error) {
+	scope := ""
+	if *in.Enabled {
+		scope = in.Scope
+		if scope == "" {
+			scope = utask.MaintenanceScopeAll
+		}
+	}
+	if err := utask.SetMaintenanceScope(scope); err != nil {
+		return nil, errors.NewBadRequest(err, "invalid scope")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"maintenance_mode":  *in.Enabled,
+		"maintenance_scope": scope,
+		"username":          auth.GetIdentity(c),
+	}).Info("maintenance mode toggled")
+
+	return &maintenanceModeOut{Enabled: utask.MaintenanceMode(), Scope: utask.MaintenanceScope()}, nil
+}
+
+func keyRotate(c *gin.Context) (*keyrotation.Rotation, error) {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := db.CallKeyRotations(dbp); err != nil {
-		return err
+	return keyrotation.Start(dbp)
+}
+
+func keyRotateStatus(c *gin.Context) (*keyrotation.Rotation, error) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
 	}
-	if err := task.RotateTasks(dbp); err != nil {
-		return err
+	return keyrotation.Load(dbp)
+}
+
+type reloadNotifyBackendsOut struct {
+	NotifyBackends []string `json:"notify_backends"`
+}
+
+func reloadNotifyBackends(c *gin.Context) (*reloadNotifyBackendsOut, error) {
+	if err := notify.ReloadSenders(nil); err != nil {
+		return nil, errors.NewBadRequest(err, "invalid notify configuration")
 	}
-	return resolution.RotateResolutions(dbp)
+
+	names := notify.ListSendersNames()
+	sort.Strings(names)
+	return &reloadNotifyBackendsOut{NotifyBackends: names}, nil
 }
@@ -25,10 +25,13 @@ import (
 	"github.com/cneill/utask/engine"
 	"github.com/cneill/utask/engine/functions"
 	functionsrunner "github.com/cneill/utask/engine/functions/runner"
+	"github.com/cneill/utask/engine/values"
 	"github.com/cneill/utask/models/tasktemplate"
+	archive "github.com/cneill/utask/pkg/archive/init"
 	"github.com/cneill/utask/pkg/auth"
 	compress "github.com/cneill/utask/pkg/compress/init"
 	notify "github.com/cneill/utask/pkg/notify/init"
+	outputstore "github.com/cneill/utask/pkg/outputstore/init"
 	"github.com/cneill/utask/pkg/plugins"
 	"github.com/cneill/utask/pkg/plugins/builtin"
 )
@@ -52,6 +55,7 @@ const (
 	envHTTPPort    = "SERVER_PORT"
 	envDebug       = "DEBUG"
 	envMaintenance = "MAINTENANCE_MODE"
+	envMaintScope  = "MAINTENANCE_SCOPE"
 	envLogsFormat  = "LOGS_FORMAT"
 
 	basicAuthKey  = "basic-auth"
@@ -74,6 +78,7 @@ func init() {
 	viper.BindEnv(envHTTPPort)
 	viper.BindEnv(envDebug)
 	viper.BindEnv(envMaintenance)
+	viper.BindEnv(envMaintScope)
 	viper.BindEnv(envLogsFormat)
 
 	flags := rootCmd.Flags()
@@ -87,7 +92,8 @@ func init() {
 	flags.UintVar(&utask.FPort, "http-port", defaultPort, "HTTP port to expose")
 	flags.BoolVar(&utask.FDebug, "debug", false, "Run engine in debug mode")
 	flags.BoolVar(&utask.FMaintenanceMode, "maintenance-mode", false, "Switch API to maintenance mode")
-	flags.StringVar(&utask.FLogsFormat, "logs-format", defaultLogsFormat, "Format of the logs (text or gelf)")
+	flags.StringVar(&utask.FMaintenanceScope, "maintenance-scope", utask.MaintenanceScopeAll, "Scope of the maintenance mode (all, create or execute)")
+	flags.StringVar(&utask.FLogsFormat, "logs-format", defaultLogsFormat, "Format of the logs (text, json or gelf)")
 
 	viper.BindPFlag(envInit, rootCmd.Flags().Lookup("init-path"))
 	viper.BindPFlag(envPlugins, rootCmd.Flags().Lookup("plugins-path"))
@@ -98,6 +104,7 @@ func init() {
 	viper.BindPFlag(envHTTPPort, rootCmd.Flags().Lookup("http-port"))
 	viper.BindPFlag(envDebug, rootCmd.Flags().Lookup("debug"))
 	viper.BindPFlag(envMaintenance, rootCmd.Flags().Lookup("maintenance-mode"))
+	viper.BindPFlag(envMaintScope, rootCmd.Flags().Lookup("maintenance-scope"))
 	viper.BindPFlag(envLogsFormat, rootCmd.Flags().Lookup("logs-format"))
 }
 
@@ -117,6 +124,12 @@ var rootCmd = &cobra.Command{
 		utask.FPort = viper.GetUint(envHTTPPort)
 		utask.FDebug = viper.GetBool(envDebug)
 		utask.FMaintenanceMode = viper.GetBool(envMaintenance)
+		utask.FMaintenanceScope = viper.GetString(envMaintScope)
+		if utask.FMaintenanceMode {
+			if err := utask.SetMaintenanceScope(utask.FMaintenanceScope); err != nil {
+				return errors.NewNotValid(err, "maintenance scope")
+			}
+		}
 		utask.FLogsFormat = viper.GetString(envLogsFormat)
 
 		// Logger.
@@ -130,9 +143,14 @@ var rootCmd = &cobra.Command{
 		case "gelf":
 			hostname, _ := os.Hostname()
 			formatter = formatters.NewGelf(hostname)
+		case "json":
+			formatter = &log.JSONFormatter{TimestampFormat: time.RFC3339}
+		default:
+			return errors.NotSupportedf("logs format %q", utask.FLogsFormat)
 		}
 		log.SetOutput(os.Stdout)
 		log.SetFormatter(formatter)
+		log.AddHook(values.SecretsLogHook{})
 
 		store = configstore.DefaultStore
 		store.InitFromEnvironment()
@@ -166,6 +184,10 @@ var rootCmd = &cobra.Command{
 			auth.Init(store),
 			// init notify module
 			notify.Init(store),
+			// init archive module (cold storage of deleted tasks)
+			archive.Init(store),
+			// init step output store (storage of large step outputs)
+			outputstore.Init(store),
 		} {
 			if err != nil {
 				return err
@@ -180,6 +202,13 @@ var rootCmd = &cobra.Command{
 		server.SetDashboardAPIPathPrefix(cfg.DashboardAPIPathPrefix)
 		server.SetDashboardSentryDSN(cfg.DashboardSentryDSN)
 		server.SetMaxBodyBytes(cfg.ServerOptions.MaxBodyBytes)
+		server.SetMaxCompressedBodyBytes(cfg.ServerOptions.MaxCompressedBodyBytes)
+		for route, max := range cfg.ServerOptions.RouteMaxBodyBytes {
+			server.SetRouteMaxBodyBytes(route, max)
+		}
+		if cfg.ServerOptions.AuditStdout {
+			server.WithAuditSink(api.NewStdoutAuditSink())
+		}
 
 		utask.StepsCompressionAlg = cfg.StepsCompressionAlg
 
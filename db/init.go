@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/go-gorp/gorp"
@@ -43,6 +45,9 @@ var schema = []tableModel{
 	{runnerinstance.Instance{}, "runner_instance", []string{"id"}, true},
 }
 
+// sqlDB is the database registered in zesty, kept to get dedicated connections out of its pool
+var sqlDB *sql.DB
+
 // RegisterTableModel registers a new table model
 func RegisterTableModel(model interface{}, name string, keys []string, autoinc bool) {
 	schema = append(schema, tableModel{model, name, keys, autoinc})
@@ -95,6 +100,8 @@ func Init(store *configstore.Store) error {
 	db.SetMaxIdleConns(*cfg.MaxIdleConns)
 	db.SetConnMaxLifetime(time.Duration(*cfg.ConnMaxLifetime) * time.Second)
 
+	sqlDB = db
+
 	dbmap, err := getDbMap(db, schema, typeConverter{})
 	if err != nil {
 		return err
@@ -116,6 +123,15 @@ func Init(store *configstore.Store) error {
 	return models.Init(store)
 }
 
+// Conn returns a connection to the database taken out of the pool until it is closed,
+// for session-level features such as advisory locks
+func Conn(ctx context.Context) (*sql.Conn, error) {
+	if sqlDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	return sqlDB.Conn(ctx)
+}
+
 func getDbMap(db *sql.DB, schema []tableModel, tc gorp.TypeConverter) (*gorp.DbMap, error) {
 	dbmap := &gorp.DbMap{
 		Db:            db,
@@ -29,6 +29,9 @@ func AutorunCollector(ctx context.Context) error {
 			case <-ctx.Done():
 				running = false
 			default:
+				if !collecting() {
+					continue
+				}
 				r, _ := getUpdateAutorunResolution(dbp)
 				if r != nil {
 					sl.wakeup()
@@ -50,12 +53,14 @@ func getUpdateAutorunResolution(dbp zesty.DBProvider) (*resolution.Resolution, e
 		SET instance_id = $1, state = $2
 		WHERE id IN
 		(
-			SELECT id
+			SELECT "resolution".id
 			FROM "resolution"
-			WHERE (state = $3 OR
-				  (instance_id = $1 AND state = $2))
+			JOIN "task" ON "task".id = "resolution".id_task
+			WHERE ("resolution".state = $3 OR
+				  ("resolution".instance_id = $1 AND "resolution".state = $2))
+			ORDER BY "task".priority DESC, "resolution".id
 			LIMIT 1
-			FOR UPDATE SKIP LOCKED
+			FOR UPDATE OF "resolution" SKIP LOCKED
 		)
 		RETURNING id, public_id`
 
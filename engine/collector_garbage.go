@@ -2,24 +2,33 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/loopfz/gadgeto/zesty"
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/resolution"
 	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/archive"
+	"github.com/cneill/utask/pkg/leader"
 	"github.com/cneill/utask/pkg/now"
+	"github.com/cneill/utask/pkg/outputstore"
+	"github.com/cneill/utask/pkg/taskutils"
 )
 
 const (
 	thresholdStrDefault  = "720h" // 1 month
 	sleepDurationDefault = 24 * time.Hour
+	expiredTasksPageSize = 1000
 )
 
 // GarbageCollector launches a process that cleans up finished tasks
-// (ie are in a final state) older than a given threshold
-func GarbageCollector(ctx context.Context, completedTaskExpiration string) error {
+// (ie are in a final state) older than a given threshold,
+// or than their own ttl when one was set on the task or its template
+func GarbageCollector(ctx context.Context, completedTaskExpiration, interval string) error {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
 	if err != nil {
 		return err
@@ -38,13 +47,20 @@ func GarbageCollector(ctx context.Context, completedTaskExpiration string) error
 	if threshold < sleepDurationDefault {
 		sleepDuration = threshold
 	}
+	if interval != "" {
+		sleepDuration, err = time.ParseDuration(interval)
+		if err != nil {
+			return err
+		}
+		if sleepDuration <= 0 {
+			return fmt.Errorf("invalid garbage collector interval: %q", interval)
+		}
+	}
 
 	// delete old completed/cancelled/wontfix tasks
 	go func() {
 		// Run it immediately and wait for new tick
-		if err := deleteOldTasks(dbp, threshold); err != nil {
-			log.Printf("GarbageCollector: failed to trash old tasks: %s", err)
-		}
+		collectGarbageTasks(ctx, dbp, threshold)
 
 		for running := true; running; {
 			time.Sleep(sleepDuration)
@@ -53,9 +69,7 @@ func GarbageCollector(ctx context.Context, completedTaskExpiration string) error
 			case <-ctx.Done():
 				running = false
 			default:
-				if err := deleteOldTasks(dbp, threshold); err != nil {
-					log.Printf("GarbageCollector: failed to trash old tasks: %s", err)
-				}
+				collectGarbageTasks(ctx, dbp, threshold)
 			}
 		}
 	}()
@@ -63,9 +77,7 @@ func GarbageCollector(ctx context.Context, completedTaskExpiration string) error
 	// delete un-referenced batches
 	go func() {
 		// Run it immediately and wait for new tick
-		if err := deleteOrphanBatches(dbp); err != nil {
-			log.Printf("GarbageCollector: failed to trash old batches: %s", err)
-		}
+		collectGarbageBatches(dbp)
 
 		for running := true; running; {
 			time.Sleep(sleepDuration)
@@ -74,9 +86,7 @@ func GarbageCollector(ctx context.Context, completedTaskExpiration string) error
 			case <-ctx.Done():
 				running = false
 			default:
-				if err := deleteOrphanBatches(dbp); err != nil {
-					log.Printf("GarbageCollector: failed to trash old batches: %s", err)
-				}
+				collectGarbageBatches(dbp)
 			}
 		}
 	}()
@@ -84,25 +94,196 @@ func GarbageCollector(ctx context.Context, completedTaskExpiration string) error
 	return nil
 }
 
-// cascade delete task comments and task resolution
-func deleteOldTasks(dbp zesty.DBProvider, perishedThreshold time.Duration) error {
-	sqlStmt := `DELETE FROM "task"
-		WHERE "task".state IN ($1,$2,$3)
-		AND   "task".last_activity < $4`
+// collectGarbageTasks deletes the finished tasks which expired and the step outputs replaced, on the leader instance only
+func collectGarbageTasks(ctx context.Context, dbp zesty.DBProvider, threshold time.Duration) {
+	if !leader.IsLeader() || !collecting() {
+		return
+	}
+	if err := deleteOldTasks(ctx, dbp, threshold); err != nil {
+		log.Printf("GarbageCollector: failed to trash old tasks: %s", err)
+	}
+	if err := deleteExpiredTasks(ctx, dbp); err != nil {
+		log.Printf("GarbageCollector: failed to trash expired tasks: %s", err)
+	}
+	if err := resumeReleasedTasks(ctx, dbp); err != nil {
+		log.Printf("GarbageCollector: failed to resume released tasks: %s", err)
+	}
+	if err := resolution.DeleteReplacedOutputs(ctx, dbp); err != nil {
+		log.Printf("GarbageCollector: %s", err)
+	}
+}
+
+// resumeReleasedTasks resumes the tasks kept on hold whose dependencies are all over:
+// the ones depending on deleted tasks, as well as the ones whose resumption got lost
+func resumeReleasedTasks(ctx context.Context, dbp zesty.DBProvider) error {
+	released, err := taskutils.ReleasedTasksToResume(dbp)
+	if err != nil {
+		return err
+	}
 
-	if _, err := dbp.DB().Exec(sqlStmt,
+	for _, t := range released {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := GetEngine().ResolveWithContext(ctx, *t.Resolution, nil); err != nil {
+			log.Printf("GarbageCollector: failed to resume task %s: %s", t.PublicID, err)
+		}
+	}
+
+	return nil
+}
+
+// collectGarbageBatches deletes the batches without any task left, on the leader instance only
+func collectGarbageBatches(dbp zesty.DBProvider) {
+	if !leader.IsLeader() || !collecting() {
+		return
+	}
+	if err := deleteOrphanBatches(dbp); err != nil {
+		log.Printf("GarbageCollector: failed to trash old batches: %s", err)
+	}
+}
+
+// cascade delete task comments and task resolution
+// tasks with their own ttl are handled by deleteExpiredTasks
+func deleteOldTasks(ctx context.Context, dbp zesty.DBProvider, perishedThreshold time.Duration) error {
+	conditions := `WHERE "task".state IN ($1,$2,$3)
+		AND   "task".last_activity < $4
+		AND   "task".ttl IS NULL`
+	args := []interface{}{
 		// final task states, cannot run anymore
 		task.StateDone,
 		task.StateCancelled,
 		task.StateWontfix,
 		now.Get().Add(-perishedThreshold),
-	); err != nil {
+	}
+
+	if archive.OnExpiration() || outputstore.Enabled() {
+		var ids []int64
+		if _, err := dbp.DB().Select(&ids, `SELECT "task".id FROM "task" `+conditions, args...); err != nil {
+			return pgjuju.Interpret(err)
+		}
+		if archive.OnExpiration() {
+			return archiveTasks(ctx, dbp, ids)
+		}
+		return deleteTasks(ctx, dbp, ids)
+	}
+
+	if _, err := dbp.DB().Exec(`DELETE FROM "task" `+conditions, args...); err != nil {
 		return pgjuju.Interpret(err)
 	}
 
 	return nil
 }
 
+type taskTTL struct {
+	ID           int64     `db:"id"`
+	TTL          string    `db:"ttl"`
+	LastActivity time.Time `db:"last_activity"`
+}
+
+// deleteExpiredTasks deletes the finished tasks which outlived their own ttl
+// cascade delete task comments and task resolution
+func deleteExpiredTasks(ctx context.Context, dbp zesty.DBProvider) error {
+	selectStmt := `SELECT "task".id, "task".ttl, "task".last_activity FROM "task"
+		WHERE "task".state IN ($1,$2,$3)
+		AND   "task".ttl IS NOT NULL
+		AND   "task".id > $4
+		ORDER BY "task".id
+		LIMIT $5`
+
+	var last int64
+	for {
+		var tasks []taskTTL
+		if _, err := dbp.DB().Select(&tasks, selectStmt,
+			// final task states, cannot run anymore
+			task.StateDone,
+			task.StateCancelled,
+			task.StateWontfix,
+			last,
+			expiredTasksPageSize,
+		); err != nil {
+			return pgjuju.Interpret(err)
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		expired := make([]int64, 0, len(tasks))
+		for _, t := range tasks {
+			ttl, err := time.ParseDuration(t.TTL)
+			if err != nil {
+				log.Printf("GarbageCollector: invalid ttl %q for task %d: %s", t.TTL, t.ID, err)
+				continue
+			}
+			if t.LastActivity.Add(ttl).Before(now.Get()) {
+				expired = append(expired, t.ID)
+			}
+		}
+		if archive.OnExpiration() {
+			if err := archiveTasks(ctx, dbp, expired); err != nil {
+				return err
+			}
+		} else if err := deleteTasks(ctx, dbp, expired); err != nil {
+			return err
+		}
+
+		last = tasks[len(tasks)-1].ID
+	}
+}
+
+// archiveTasks stores each task in the archive storage before deleting it
+// a task failing to be archived is kept, to be retried on the next run
+func archiveTasks(ctx context.Context, dbp zesty.DBProvider, ids []int64) error {
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		t, err := task.LoadFromID(dbp, id)
+		if err != nil {
+			log.Printf("GarbageCollector: failed to load task %d: %s", id, err)
+			continue
+		}
+		if _, err := archive.Archive(ctx, dbp, t); err != nil {
+			log.Printf("GarbageCollector: %s", err)
+			continue
+		}
+		if err := taskutils.DeleteTask(ctx, dbp, t); err != nil {
+			log.Printf("GarbageCollector: failed to delete archived task %s: %s", t.PublicID, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteTasks deletes tasks along with their comments and resolutions,
+// then the outputs of their resolutions kept in the step output store
+func deleteTasks(ctx context.Context, dbp zesty.DBProvider, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	names, err := resolution.StoredOutputNames(dbp, ids...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dbp.DB().Exec(`DELETE FROM "task" WHERE "task".id = ANY($1)`, pq.Array(ids)); err != nil {
+		return pgjuju.Interpret(err)
+	}
+
+	if err := outputstore.Delete(ctx, names...); err != nil {
+		log.Printf("GarbageCollector: failed to delete the stored outputs of deleted tasks: %s", err)
+	}
+
+	return nil
+}
+
 func deleteOrphanBatches(dbp zesty.DBProvider) error {
 	sqlStmt := `DELETE FROM "batch"
 		WHERE id IN (
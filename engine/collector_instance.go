@@ -16,8 +16,8 @@ import (
 )
 
 // InstanceCollector launches a process that retrieves resolutions
-// which might have been running on a dead instance and marks them as
-// crashed, for examination
+// which might have been running on a dead instance (or on an instance not even listed anymore)
+// and marks them as crashed, for examination
 func InstanceCollector(ctx context.Context, maxConcurrentExecutions int, waitDuration time.Duration) error {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
 	if err != nil {
@@ -54,6 +54,10 @@ func InstanceCollector(ctx context.Context, maxConcurrentExecutions int, waitDur
 }
 
 func collect(dbp zesty.DBProvider, sm *semaphore.Weighted, waitDuration time.Duration) error {
+	if !collecting() {
+		return nil
+	}
+
 	// get a list of all instances
 	instances, err := runnerinstance.ListInstances(dbp)
 	if err != nil {
@@ -63,22 +67,13 @@ func collect(dbp zesty.DBProvider, sm *semaphore.Weighted, waitDuration time.Dur
 	for _, i := range instances {
 		// if an instance is dead
 		if i.IsDead() {
-			// loop while there are running resolutions from this instance
-			for {
+			i := i
+			// run the resolutions which were running on this instance
+			if err := recoverResolutions(dbp, sm, waitDuration, log, func() (*resolution.Resolution, uint64, error) {
 				r, err := getUpdateRunningResolution(dbp, i)
-				if err != nil {
-					// no more resolutions found, break out of loop
-					if errors.IsNotFound(err) {
-						break
-					}
-				} else {
-					// run found resolution
-					log.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("collected crashed resolution %s", r.PublicID)
-					_ = GetEngine().Resolve(r.PublicID, sm)
-
-					// waiting between two resolve, so others instances can also select tasks
-					time.Sleep(waitDuration)
-				}
+				return r, i.ID, err
+			}); err != nil {
+				return err
 			}
 			// no resolutions left to retry, delete instance
 			if remaining, err := getRemainingResolution(dbp, i); err == nil && remaining == 0 {
@@ -90,6 +85,62 @@ func collect(dbp zesty.DBProvider, sm *semaphore.Weighted, waitDuration time.Dur
 		}
 	}
 
+	// resolutions left running by an instance which is not even listed anymore
+	return recoverResolutions(dbp, sm, waitDuration, log, func() (*resolution.Resolution, uint64, error) {
+		return getUpdateOrphanResolution(dbp)
+	})
+}
+
+// resolveCollected runs a resolution recovered by the collector
+var resolveCollected = func(publicID string, sm *semaphore.Weighted) error {
+	return GetEngine().Resolve(publicID, sm)
+}
+
+// recoverResolutions marks as crashed and runs the resolutions returned by claim, until there are none left
+// claim also returns the instance the resolution was taken from: a resolution failing to run is given back to it,
+// left crashed, and collected again on the next round
+func recoverResolutions(dbp zesty.DBProvider, sm *semaphore.Weighted, waitDuration time.Duration, log *logrus.Entry, claim func() (*resolution.Resolution, uint64, error)) error {
+	for {
+		r, previousInstanceID, err := claim()
+		if err != nil {
+			// no more resolutions found
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		// run found resolution
+		log.WithFields(logrus.Fields{"resolution_id": r.PublicID}).Debugf("collected crashed resolution %s", r.PublicID)
+		if err := resolveCollected(r.PublicID, sm); err != nil {
+			log.WithError(err).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Warnf("failed to run crashed resolution %s", r.PublicID)
+			if err := releaseResolution(dbp, r, previousInstanceID); err != nil {
+				log.WithError(err).WithFields(logrus.Fields{"resolution_id": r.PublicID}).Errorf("failed to release crashed resolution %s", r.PublicID)
+			}
+			return nil
+		}
+
+		// waiting between two resolve, so others instances can also select tasks
+		time.Sleep(waitDuration)
+	}
+}
+
+// releaseResolution gives a claimed resolution back to the instance it was taken from,
+// unless it was run in the meantime
+func releaseResolution(dbp zesty.DBProvider, r *resolution.Resolution, previousInstanceID uint64) error {
+	sqlStmt := `UPDATE "resolution"
+		SET instance_id = $1
+		WHERE id = $2 AND instance_id = $3 AND state = $4`
+
+	if _, err := dbp.DB().Exec(sqlStmt,
+		previousInstanceID,
+		r.ID,
+		utask.InstanceID,
+		resolution.StateCrashed,
+	); err != nil {
+		return pgjuju.Interpret(err)
+	}
+
 	return nil
 }
 
@@ -98,12 +149,14 @@ func getUpdateRunningResolution(dbp zesty.DBProvider, i *runnerinstance.Instance
 		SET instance_id = $1, state = $2
 		WHERE id IN
 		(
-			SELECT id
+			SELECT "resolution".id
 			FROM "resolution"
-			WHERE ((instance_id = $3 AND state IN ($2,$4,$5,$6)) OR
-				   (instance_id = $1 AND state = $2))
+			JOIN "task" ON "task".id = "resolution".id_task
+			WHERE (("resolution".instance_id = $3 AND "resolution".state IN ($2,$4,$5,$6)) OR
+				   ("resolution".instance_id = $1 AND "resolution".state = $2))
+			ORDER BY "task".priority DESC, "resolution".id
 			LIMIT 1
-			FOR UPDATE SKIP LOCKED
+			FOR UPDATE OF "resolution" SKIP LOCKED
 		)
 		RETURNING id, public_id`
 
@@ -123,6 +176,46 @@ func getUpdateRunningResolution(dbp zesty.DBProvider, i *runnerinstance.Instance
 	return &r, nil
 }
 
+// getUpdateOrphanResolution claims a resolution left running by an instance which was removed from the instance list
+// it returns the ID of this instance along with the resolution
+func getUpdateOrphanResolution(dbp zesty.DBProvider) (*resolution.Resolution, uint64, error) {
+	sqlStmt := `UPDATE "resolution"
+		SET instance_id = $1, state = $2
+		FROM
+		(
+			SELECT "resolution".id, "resolution".instance_id
+			FROM "resolution"
+			JOIN "task" ON "task".id = "resolution".id_task
+			WHERE "resolution".instance_id IS NOT NULL
+			AND   "resolution".state IN ($2,$3,$4)
+			AND   NOT EXISTS (SELECT 1 FROM "runner_instance" WHERE "runner_instance".id = "resolution".instance_id)
+			ORDER BY "task".priority DESC, "resolution".id
+			LIMIT 1
+			FOR UPDATE OF "resolution" SKIP LOCKED
+		) AS "orphan"
+		WHERE "resolution".id = "orphan".id
+		RETURNING "resolution".id, "resolution".public_id, "orphan".instance_id AS previous_instance_id`
+
+	var claimed struct {
+		ID                 int64  `db:"id"`
+		PublicID           string `db:"public_id"`
+		PreviousInstanceID uint64 `db:"previous_instance_id"`
+	}
+
+	if err := dbp.DB().SelectOne(&claimed, sqlStmt,
+		utask.InstanceID,
+		resolution.StateCrashed,
+		resolution.StateRunning,
+		resolution.StateAutorunning,
+	); err != nil {
+		return nil, 0, pgjuju.Interpret(err)
+	}
+
+	return &resolution.Resolution{
+		DBModel: resolution.DBModel{ID: claimed.ID, PublicID: claimed.PublicID},
+	}, claimed.PreviousInstanceID, nil
+}
+
 func getRemainingResolution(dbp zesty.DBProvider, i *runnerinstance.Instance) (int64, error) {
 	sqlStmt := `SELECT COUNT(id)
 			FROM "resolution"
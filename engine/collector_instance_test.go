@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/runnerinstance"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/now"
+)
+
+// collectorResolution creates a resolution left in the given state by the given instance
+func collectorResolution(t *testing.T, dbp zesty.DBProvider, state string, instanceID uint64) *resolution.Resolution {
+	t.Helper()
+
+	tt, err := tasktemplate.LoadFromName(dbp, "collector-instance")
+	if errors.IsNotFound(err) {
+		tt = &tasktemplate.TaskTemplate{
+			Name:        "collector-instance",
+			Description: "recovered by the instance collector",
+			TitleFormat: "recovered by the instance collector",
+		}
+		tt.Normalize()
+		err = pgjuju.Interpret(dbp.DB().Insert(tt))
+	}
+	require.NoError(t, err)
+
+	// collected before the resolutions left by the other tests
+	priority := 1000
+	tsk, err := task.Create(dbp, tt, "", task.CreateOptions{Priority: &priority})
+	require.NoError(t, err)
+	r, err := resolution.Create(dbp, tsk, nil, "", false, nil)
+	require.NoError(t, err)
+
+	_, err = dbp.DB().Exec(`UPDATE "resolution" SET state = $1, instance_id = $2 WHERE id = $3`, state, instanceID, r.ID)
+	require.NoError(t, err)
+	return r
+}
+
+// deadInstance lists an instance which stopped sending its heartbeats
+func deadInstance(t *testing.T, dbp zesty.DBProvider) *runnerinstance.Instance {
+	t.Helper()
+	i := &runnerinstance.Instance{Heartbeat: now.Get().Add(-time.Hour)}
+	require.NoError(t, dbp.DB().Insert(i))
+	require.True(t, i.IsDead())
+	return i
+}
+
+// failResolveCollected makes the resolutions recovered by the collector fail to run, recording them
+func failResolveCollected(t *testing.T) *[]string {
+	previous := resolveCollected
+	t.Cleanup(func() { resolveCollected = previous })
+
+	var resolved []string
+	resolveCollected = func(publicID string, _ *semaphore.Weighted) error {
+		resolved = append(resolved, publicID)
+		return errors.New("instance is shutting down")
+	}
+	return &resolved
+}
+
+func assertResolutionInstance(t *testing.T, dbp zesty.DBProvider, r *resolution.Resolution, state string, instanceID uint64) {
+	t.Helper()
+	loaded, err := resolution.LoadFromPublicID(dbp, r.PublicID)
+	require.NoError(t, err)
+	assert.Equal(t, state, loaded.State)
+	require.NotNil(t, loaded.InstanceID)
+	assert.Equal(t, instanceID, *loaded.InstanceID)
+}
+
+func TestRecoverResolutionsRelease(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+	log := logrus.WithField("collector", "instance_collector")
+
+	dead := deadInstance(t, dbp)
+	r := collectorResolution(t, dbp, resolution.StateRunning, dead.ID)
+	claim := func() (*resolution.Resolution, uint64, error) {
+		claimed, err := getUpdateRunningResolution(dbp, dead)
+		return claimed, dead.ID, err
+	}
+
+	// a resolution failing to run is given back to the dead instance
+	resolved := failResolveCollected(t)
+	require.NoError(t, recoverResolutions(dbp, nil, 0, log, claim))
+	assert.Equal(t, []string{r.PublicID}, *resolved)
+	assertResolutionInstance(t, dbp, r, resolution.StateCrashed, dead.ID)
+
+	remaining, err := getRemainingResolution(dbp, dead)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), remaining, "the dead instance still has a resolution to recover")
+
+	// and collected again on the next round
+	require.NoError(t, recoverResolutions(dbp, nil, 0, log, claim))
+	assert.Equal(t, []string{r.PublicID, r.PublicID}, *resolved)
+	assertResolutionInstance(t, dbp, r, resolution.StateCrashed, dead.ID)
+
+	// a resolution run in the meantime is not given back
+	claimed, err := getUpdateRunningResolution(dbp, dead)
+	require.NoError(t, err)
+	_, err = dbp.DB().Exec(`UPDATE "resolution" SET state = $1 WHERE id = $2`, resolution.StateRunning, claimed.ID)
+	require.NoError(t, err)
+	require.NoError(t, releaseResolution(dbp, claimed, dead.ID))
+	assertResolutionInstance(t, dbp, r, resolution.StateRunning, utask.InstanceID)
+}
+
+func TestRecoverOrphanResolutionsRelease(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+	log := logrus.WithField("collector", "instance_collector")
+
+	// an instance removed from the instance list
+	removed := deadInstance(t, dbp)
+	require.NoError(t, removed.Delete(dbp))
+	r := collectorResolution(t, dbp, resolution.StateRunning, removed.ID)
+	claim := func() (*resolution.Resolution, uint64, error) {
+		return getUpdateOrphanResolution(dbp)
+	}
+
+	// a resolution failing to run is given back to the removed instance, and still orphan
+	resolved := failResolveCollected(t)
+	require.NoError(t, recoverResolutions(dbp, nil, 0, log, claim))
+	assert.Equal(t, []string{r.PublicID}, *resolved)
+	assertResolutionInstance(t, dbp, r, resolution.StateCrashed, removed.ID)
+
+	claimed, previousInstanceID, err := getUpdateOrphanResolution(dbp)
+	require.NoError(t, err)
+	assert.Equal(t, r.PublicID, claimed.PublicID)
+	assert.Equal(t, removed.ID, previousInstanceID)
+	assertResolutionInstance(t, dbp, r, resolution.StateCrashed, utask.InstanceID)
+}
+
+// recordResolveCollected records the resolutions recovered by the collector, marking them as running as Resolve would
+func recordResolveCollected(t *testing.T, dbp zesty.DBProvider) *[]string {
+	previous := resolveCollected
+	t.Cleanup(func() { resolveCollected = previous })
+
+	var resolved []string
+	resolveCollected = func(publicID string, _ *semaphore.Weighted) error {
+		resolved = append(resolved, publicID)
+		_, err := dbp.DB().Exec(`UPDATE "resolution" SET state = $1 WHERE public_id = $2`, resolution.StateRunning, publicID)
+		return err
+	}
+	return &resolved
+}
+
+func TestCollectLiveAndDeadInstances(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	orphansBefore, err := resolution.LoadOrphanCount(dbp)
+	require.NoError(t, err)
+
+	live := &runnerinstance.Instance{Heartbeat: now.Get().Truncate(time.Millisecond)}
+	require.NoError(t, dbp.DB().Insert(live))
+	dead := deadInstance(t, dbp)
+	removed := deadInstance(t, dbp)
+	require.NoError(t, removed.Delete(dbp))
+
+	onLive := collectorResolution(t, dbp, resolution.StateRunning, live.ID)
+	onDead := collectorResolution(t, dbp, resolution.StateRunning, dead.ID)
+	doneOnDead := collectorResolution(t, dbp, resolution.StateDone, dead.ID)
+	onRemoved := collectorResolution(t, dbp, resolution.StateAutorunning, removed.ID)
+
+	// the resolutions of the dead and removed instances await a takeover, the others don't
+	orphans, err := resolution.LoadOrphanCount(dbp)
+	require.NoError(t, err)
+	assert.Equal(t, orphansBefore+2, orphans)
+
+	// a resolution reports the heartbeat of the instance owning it, while it is listed
+	loaded, err := resolution.LoadFromPublicID(dbp, onLive.PublicID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded.InstanceHeartbeat)
+	assert.True(t, live.Heartbeat.Equal(*loaded.InstanceHeartbeat))
+	loaded, err = resolution.LoadFromPublicID(dbp, onDead.PublicID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded.InstanceHeartbeat)
+	assert.True(t, loaded.InstanceHeartbeat.Before(runnerinstance.DeadBefore()))
+	loaded, err = resolution.LoadFromPublicID(dbp, onRemoved.PublicID)
+	require.NoError(t, err)
+	assert.Nil(t, loaded.InstanceHeartbeat)
+
+	// the collector takes over the resolutions of the dead and removed instances only
+	resolved := recordResolveCollected(t, dbp)
+	require.NoError(t, collect(dbp, nil, 0))
+	assert.Contains(t, *resolved, onDead.PublicID)
+	assert.Contains(t, *resolved, onRemoved.PublicID)
+	assert.NotContains(t, *resolved, onLive.PublicID)
+	assert.NotContains(t, *resolved, doneOnDead.PublicID)
+
+	assertResolutionInstance(t, dbp, onLive, resolution.StateRunning, live.ID)
+	assertResolutionInstance(t, dbp, onDead, resolution.StateRunning, utask.InstanceID)
+	assertResolutionInstance(t, dbp, onRemoved, resolution.StateRunning, utask.InstanceID)
+	assertResolutionInstance(t, dbp, doneOnDead, resolution.StateDone, dead.ID)
+
+	// the dead instance is forgotten once its resolutions are recovered, the live one is kept
+	instances, err := runnerinstance.ListInstances(dbp)
+	require.NoError(t, err)
+	listed := map[uint64]bool{}
+	for _, i := range instances {
+		listed[i.ID] = true
+	}
+	assert.True(t, listed[live.ID])
+	assert.False(t, listed[dead.ID])
+
+	orphans, err = resolution.LoadOrphanCount(dbp)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, orphans, orphansBefore)
+}
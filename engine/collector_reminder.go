@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/leader"
+	"github.com/cneill/utask/pkg/now"
+)
+
+const (
+	reminderCollectorInterval = time.Minute
+	blockedTasksPageSize      = 1000
+)
+
+type blockedTask struct {
+	ID                int64      `db:"id"`
+	PublicID          string     `db:"public_id"`
+	TemplateID        int64      `db:"id_template"`
+	LastReminder      *time.Time `db:"last_reminder"`
+	LastStop          *time.Time `db:"last_stop"`
+	ReminderThreshold string     `db:"reminder_threshold"`
+	ReminderInterval  *string    `db:"reminder_interval"`
+}
+
+// ReminderCollector launches a process that reminds the resolvers of the tasks
+// blocked for longer than their template's reminder_threshold,
+// at most once per reminder_interval
+func ReminderCollector(ctx context.Context) error {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for running := true; running; {
+			select {
+			case <-ctx.Done():
+				running = false
+			default:
+				if leader.IsLeader() && collecting() {
+					if err := remindBlockedTasks(dbp); err != nil {
+						log.Printf("ReminderCollector: failed to remind blocked tasks: %s", err)
+					}
+				}
+				time.Sleep(reminderCollectorInterval)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func remindBlockedTasks(dbp zesty.DBProvider) error {
+	selectStmt := `SELECT "task".id, "task".public_id, "task".id_template, "task".last_reminder, "resolution".last_stop,
+			"task_template".reminder_threshold, "task_template".reminder_interval
+		FROM "task"
+		JOIN "task_template" ON "task_template".id = "task".id_template
+		JOIN "resolution" ON "resolution".id_task = "task".id
+		WHERE "task".state = $1
+		AND   "task_template".reminder_threshold IS NOT NULL
+		AND   "task".id > $2
+		ORDER BY "task".id
+		LIMIT $3`
+	// the reminder is claimed by a single instance, the one updating last_reminder first
+	claimStmt := `UPDATE "task" SET last_reminder = $1
+		WHERE "task".id = $2
+		AND   "task".last_reminder IS NOT DISTINCT FROM $3`
+
+	templates := map[int64]*tasktemplate.TaskTemplate{}
+
+	var last int64
+	for {
+		var tasks []blockedTask
+		if _, err := dbp.DB().Select(&tasks, selectStmt, task.StateBlocked, last, blockedTasksPageSize); err != nil {
+			return pgjuju.Interpret(err)
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		for _, bt := range tasks {
+			if !bt.reminderDue(now.Get()) {
+				continue
+			}
+
+			res, err := dbp.DB().Exec(claimStmt, now.Get(), bt.ID, bt.LastReminder)
+			if err != nil {
+				return pgjuju.Interpret(err)
+			}
+			if claimed, err := res.RowsAffected(); err != nil || claimed == 0 {
+				continue
+			}
+
+			tt, ok := templates[bt.TemplateID]
+			if !ok {
+				tt, err = tasktemplate.LoadFromID(dbp, bt.TemplateID)
+				if err != nil {
+					log.Printf("ReminderCollector: failed to load template of task %s: %s", bt.PublicID, err)
+					continue
+				}
+				templates[bt.TemplateID] = tt
+			}
+
+			t, err := task.LoadFromPublicID(dbp, bt.PublicID)
+			if err != nil {
+				log.Printf("ReminderCollector: failed to load task %s: %s", bt.PublicID, err)
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"task_id":  t.PublicID,
+				"log_type": "engine",
+			}).Debugf("Reminder Collector: task %s is still blocked", t.PublicID)
+			t.NotifyResolverReminder(tt)
+		}
+
+		last = tasks[len(tasks)-1].ID
+	}
+}
+
+// reminderDue tells whether the task has been blocked for longer than the threshold,
+// and not reminded since it got blocked, or not for longer than the interval
+func (bt *blockedTask) reminderDue(t time.Time) bool {
+	if bt.LastStop == nil {
+		return false
+	}
+	threshold, err := time.ParseDuration(bt.ReminderThreshold)
+	if err != nil {
+		log.Printf("ReminderCollector: invalid reminder_threshold %q for task %s: %s", bt.ReminderThreshold, bt.PublicID, err)
+		return false
+	}
+	if bt.LastStop.Add(threshold).After(t) {
+		return false
+	}
+	if bt.LastReminder == nil || bt.LastReminder.Before(*bt.LastStop) {
+		return true
+	}
+
+	interval := threshold
+	if bt.ReminderInterval != nil {
+		interval, err = time.ParseDuration(*bt.ReminderInterval)
+		if err != nil {
+			log.Printf("ReminderCollector: invalid reminder_interval %q for task %s: %s", *bt.ReminderInterval, bt.PublicID, err)
+			return false
+		}
+	}
+	return !bt.LastReminder.Add(interval).After(t)
+}
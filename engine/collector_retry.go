@@ -29,6 +29,9 @@ func RetryCollector(ctx context.Context) error {
 			case <-ctx.Done():
 				running = false
 			default:
+				if !collecting() {
+					continue
+				}
 				r, _ := getUpdateErrorResolution(dbp)
 				if r != nil {
 					sl.wakeup()
@@ -50,19 +53,21 @@ func getUpdateErrorResolution(dbp zesty.DBProvider) (*resolution.Resolution, err
 		SET instance_id = $1, state = $2
 		WHERE id IN
 		(
-			SELECT id
+			SELECT "resolution".id
 			FROM "resolution"
-			WHERE ((instance_id = $1 AND state = $2) OR
-				  ((state = $3 OR state = $4) AND next_retry < NOW()))
+			JOIN "task" ON "task".id = "resolution".id_task
+			WHERE (("resolution".instance_id = $1 AND "resolution".state = $2) OR
+				  (("resolution".state = $3 OR "resolution".state = $4 OR "resolution".state = $5) AND "resolution".next_retry < NOW()))
+			ORDER BY "task".priority DESC, "resolution".id
 			LIMIT 1
-			FOR UPDATE SKIP LOCKED
+			FOR UPDATE OF "resolution" SKIP LOCKED
 		)
 		RETURNING id, public_id`
 
 	var r resolution.Resolution
 
 	instanceID := utask.InstanceID
-	if err := dbp.DB().SelectOne(&r, sqlStmt, instanceID, resolution.StateRetry, resolution.StateError, resolution.StateToAutorunDelayed); err != nil {
+	if err := dbp.DB().SelectOne(&r, sqlStmt, instanceID, resolution.StateRetry, resolution.StateError, resolution.StateToAutorunDelayed, resolution.StateWaiting); err != nil {
 		return nil, pgjuju.Interpret(err)
 	}
 
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/leader"
+	"github.com/cneill/utask/pkg/now"
+)
+
+const (
+	slaCollectorInterval = time.Minute
+	slaBreachesPageSize  = 100
+)
+
+// SLACollector launches a process that looks for tasks still not over after
+// the sla deadline computed from their template, and notifies each breach once
+func SLACollector(ctx context.Context) error {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for running := true; running; {
+			select {
+			case <-ctx.Done():
+				running = false
+			default:
+				if leader.IsLeader() && collecting() {
+					if err := notifySLABreaches(dbp); err != nil {
+						logrus.WithError(err).WithField("log_type", "engine").Warn("SLA Collector: failed to notify sla breaches")
+					}
+				}
+				time.Sleep(slaCollectorInterval)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// notifySLABreaches flags the breaching tasks before notifying them,
+// so that a breach is notified only once, by a single instance
+func notifySLABreaches(dbp zesty.DBProvider) error {
+	sqlStmt := `UPDATE "task"
+		SET sla_breached = true
+		WHERE id IN
+		(
+			SELECT "task".id
+			FROM "task"
+			WHERE "task".sla_breached = false
+			AND   "task".sla_deadline < $1
+			AND   "task".state NOT IN ($2,$3,$4)
+			ORDER BY "task".sla_deadline
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING public_id`
+
+	for {
+		var publicIDs []string
+		if _, err := dbp.DB().Select(&publicIDs, sqlStmt,
+			now.Get(),
+			// final task states, cannot breach their sla anymore
+			task.StateDone,
+			task.StateCancelled,
+			task.StateWontfix,
+			slaBreachesPageSize,
+		); err != nil {
+			return pgjuju.Interpret(err)
+		}
+
+		for _, publicID := range publicIDs {
+			t, err := task.LoadFromPublicID(dbp, publicID)
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"task_id":  publicID,
+					"log_type": "engine",
+				}).Warnf("SLA Collector: failed to load task %s", publicID)
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"task_id":  t.PublicID,
+				"log_type": "engine",
+			}).Debugf("SLA Collector: task %s breached its sla", t.PublicID)
+			t.NotifySLABreach()
+		}
+
+		if len(publicIDs) < slaBreachesPageSize {
+			return nil
+		}
+	}
+}
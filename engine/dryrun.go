@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask/engine/step"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+)
+
+// DryRunStep describes what a step would do if its resolution was run
+type DryRunStep struct {
+	Name        string      `json:"name"`
+	ActionType  string      `json:"action_type"`
+	Supported   bool        `json:"supported"`
+	PreHook     interface{} `json:"pre_hook,omitempty"`
+	Description interface{} `json:"description,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// DryRunReport describes what a resolution would do if it was run
+type DryRunReport struct {
+	ResolutionID string       `json:"resolution_id"`
+	Steps        []DryRunStep `json:"steps"`
+	// steps not reached by the dry-run, waiting for other steps
+	// to end in a specific state, or for a loop to be expanded
+	PendingSteps []string `json:"pending_steps"`
+}
+
+// DryRun describes the actions a resolution would perform if it was run, without
+// running it: the resolution is left untouched, and the plugins supporting it are
+// asked to describe their action without any side effect. The steps are visited
+// in the order of their dependencies, assuming each of them succeeds with an empty output
+func DryRun(dbp zesty.DBProvider, publicID string) (report *DryRunReport, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to dry-run resolution")
+
+	res, err := resolution.LoadFromPublicID(dbp, publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.State {
+	case resolution.StateCancelled:
+		return nil, errors.NewBadRequest(nil, "Can't run resolution: cancelled")
+	case resolution.StateRunning:
+		return nil, errors.NewBadRequest(nil, "Can't run resolution: already running")
+	case resolution.StateDone:
+		return nil, errors.NewBadRequest(nil, "Can't run resolution: already done")
+	}
+
+	t, err := task.LoadFromID(dbp, res.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := tasktemplate.LoadVersion(dbp, t.TemplateID, t.TemplateVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// provide the resolution with values, as a real run would
+	t.ExportTaskInfos(res.Values)
+	taskInput, err := unsealedInput(t, res.Values.SecretScope())
+	if err != nil {
+		return nil, err
+	}
+	res.Values.SetInput(taskInput)
+	res.Values.SetResolverInput(res.ResolverInput)
+	res.Values.SetVariables(tt.Variables)
+
+	debugLogger := logrus.WithFields(logrus.Fields{"resolution_id": publicID, "log_type": "engine", "dry_run": true})
+	report = &DryRunReport{ResolutionID: res.PublicID, Steps: []DryRunStep{}, PendingSteps: []string{}}
+	visited := map[string]bool{}
+
+	for {
+		av := availableSteps(nil, res, visited, nil, debugLogger)
+		if len(av) == 0 {
+			break
+		}
+		names := make([]string, 0, len(av))
+		for name := range av {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			s := av[name]
+			s.Name = name
+			report.Steps = append(report.Steps, dryRunStep(s, res))
+			visited[name] = true
+		}
+		// the steps are then considered successful, unlocking the steps depending on them
+		for _, name := range names {
+			res.Steps[name].State = step.StateDone
+			res.Values.SetState(name, step.StateDone)
+			res.Values.SetOutput(name, nil)
+		}
+	}
+
+	for _, name := range res.StepList {
+		if !visited[name] && !res.Steps[name].IsFinal() {
+			report.PendingSteps = append(report.PendingSteps, name)
+		}
+	}
+	sort.Strings(report.PendingSteps)
+
+	return report, nil
+}
+
+func dryRunStep(s *step.Step, res *resolution.Resolution) DryRunStep {
+	ret := DryRunStep{Name: s.Name, ActionType: s.Action.Type}
+	if s.ForEach != "" {
+		ret.Error = "loop steps are expanded at run time, their children can't be described"
+		return ret
+	}
+
+	preHook, description, err := step.DryRun(s, res.BaseConfigurations, res.Values)
+	if err != nil {
+		ret.Supported = !errors.IsNotSupported(errors.Cause(err))
+		ret.Error = res.Values.SecretScope().RedactString(err.Error())
+		return ret
+	}
+	ret.Supported = true
+	ret.PreHook = res.Values.SecretScope().Redact(preHook)
+	ret.Description = res.Values.SecretScope().Redact(description)
+	return ret
+}
@@ -5,20 +5,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/gofrs/uuid"
 	expbk "github.com/jpillora/backoff"
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
 	"github.com/ovh/configstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
 	"sigs.k8s.io/yaml"
 
 	"github.com/cneill/utask"
+	"github.com/cneill/utask/db"
+	"github.com/cneill/utask/engine/input"
 	"github.com/cneill/utask/engine/step"
 	"github.com/cneill/utask/engine/step/condition"
 	"github.com/cneill/utask/engine/values"
@@ -26,10 +32,15 @@ import (
 	"github.com/cneill/utask/models/runnerinstance"
 	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/jsonschema"
+	"github.com/cneill/utask/pkg/leader"
 	"github.com/cneill/utask/pkg/metadata"
 	"github.com/cneill/utask/pkg/now"
+	pluginapproval "github.com/cneill/utask/pkg/plugins/builtin/approval"
 	pluginbatch "github.com/cneill/utask/pkg/plugins/builtin/batch"
+	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
+	pluginscript "github.com/cneill/utask/pkg/plugins/builtin/script"
 	"github.com/cneill/utask/pkg/taskutils"
 	"github.com/cneill/utask/pkg/utils"
 )
@@ -41,8 +52,22 @@ var (
 	// Used for stopping the current Engine
 	shutdownCtx    context.Context
 	gracePeriodEnd chan struct{}
+
+	maxStepExecutionsMetrics      = promauto.NewGaugeVec(prometheus.GaugeOpts{Name: "utask_template_max_step_executions"}, []string{"template"})
+	exceededStepExecutionsMetrics = promauto.NewCounterVec(prometheus.CounterOpts{Name: "utask_step_executions_exceeded"}, []string{"template"})
+	exhaustedRetryBudgetMetrics   = promauto.NewCounterVec(prometheus.CounterOpts{Name: "utask_retry_budget_exhausted"}, []string{"template"})
 )
 
+// concurrencyRetryDelay is how long a resolution is queued for,
+// when its template already runs as many resolutions as it allows
+const concurrencyRetryDelay = 30 * time.Second
+
+// progressCommitInterval is the minimum delay between two commits of the progress reported by the steps of a resolution
+const progressCommitInterval = 2 * time.Second
+
+// progressBufferSize is the number of progress reports queued for a resolution loop
+const progressBufferSize = 64
+
 // Engine is the heart of utask: it is the active process
 // that handles the lifecycle of every task resolution.
 // All the logic for resolution state changes is expressed here
@@ -57,6 +82,8 @@ type Engine struct {
 	// ie. credentials needed for http calls, etc...
 	config map[string]interface{}
 	wg     *sync.WaitGroup
+	// global cap on the step executions of a single resolution, nil for no limit
+	maxStepExecutions *int
 }
 
 // Init launches the task orchestration engine, providing it with a global context
@@ -83,6 +110,8 @@ func Init(ctx context.Context, wg *sync.WaitGroup, store *configstore.Store) err
 	}
 	// attempt to deserialize json formatted config items
 	// -> make it easier to access internal nodes/values when templating
+	// the secrets of the previous configuration are forgotten along with it
+	values.ResetSecrets()
 	eng.config = make(map[string]interface{})
 	for k, v := range config {
 		var i interface{}
@@ -99,6 +128,28 @@ func Init(ctx context.Context, wg *sync.WaitGroup, store *configstore.Store) err
 		}
 	}
 
+	eng.maxStepExecutions = cfg.MaxStepExecutions
+	values.SetPublicConfigItems(cfg.PublicConfigItems)
+	if cfg.OutboundProxy != nil {
+		httputil.SetProxy(cfg.OutboundProxy.HTTPProxy, cfg.OutboundProxy.HTTPSProxy, cfg.OutboundProxy.NoProxy)
+	}
+	if cfg.ScriptLimits != nil {
+		if err := pluginscript.SetDefaultLimits(*cfg.ScriptLimits); err != nil {
+			return errors.Annotate(err, "script_limits")
+		}
+	}
+	if cfg.ScriptContainerRuntime != "" {
+		pluginscript.SetContainerRuntime(cfg.ScriptContainerRuntime)
+	}
+	if err := pluginscript.SetAllowedMounts(cfg.ScriptContainerMounts); err != nil {
+		return errors.Annotate(err, "script_container_mounts")
+	}
+	if cfg.TaskQuota != nil {
+		if err := taskutils.SetQuota(*cfg.TaskQuota); err != nil {
+			return errors.Annotate(err, "task_quota")
+		}
+	}
+
 	// channels for handling graceful shutdown
 	shutdownCtx = ctx
 	gracePeriodEnd = make(chan struct{})
@@ -127,27 +178,39 @@ func Init(ctx context.Context, wg *sync.WaitGroup, store *configstore.Store) err
 		return err
 	}
 
+	// elect the instance running the singleton jobs, among the instances sharing the database
+	if cfg.LeaderElection {
+		leader.Start(ctx, db.Conn)
+	}
+
 	// initialize all collectors
 	// maintenance mode is meant to ensure that no data can change while we
-	// perform administration chores, so collectors are switched off
-	if !utask.FMaintenanceMode {
+	// perform administration chores, so collectors pause on each tick
+	// while the instance is in maintenance mode, unless only task creation is refused
 
-		// init garbage collector (delete tasks completed more than x time ago (x from global config) + delete orphaned batches)
-		if err := GarbageCollector(ctx, cfg.CompletedTaskExpiration); err != nil {
-			return err
-		}
-		// init autorun collector (create resolution + run for tasks with state == autorun)
-		if err := AutorunCollector(ctx); err != nil {
-			return err
-		}
-		// init crashed instance collector
-		if err := InstanceCollector(ctx, cfg.MaxConcurrentExecutionsFromCrashedComputed, cfg.InstanceCollectorWaitDuration); err != nil {
-			return err
-		}
-		// init retry collector (retry resolutions with state == error)
-		if err := RetryCollector(ctx); err != nil {
-			return err
-		}
+	// init garbage collector (delete tasks completed more than x time ago (x from global config) + delete orphaned batches)
+	if err := GarbageCollector(ctx, cfg.CompletedTaskExpiration, cfg.GarbageCollectorInterval); err != nil {
+		return err
+	}
+	// init autorun collector (create resolution + run for tasks with state == autorun)
+	if err := AutorunCollector(ctx); err != nil {
+		return err
+	}
+	// init crashed instance collector
+	if err := InstanceCollector(ctx, cfg.MaxConcurrentExecutionsFromCrashedComputed, cfg.InstanceCollectorWaitDuration); err != nil {
+		return err
+	}
+	// init retry collector (retry resolutions with state == error)
+	if err := RetryCollector(ctx); err != nil {
+		return err
+	}
+	// init sla collector (notify tasks still not over after their sla deadline)
+	if err := SLACollector(ctx); err != nil {
+		return err
+	}
+	// init reminder collector (remind the resolvers of tasks blocked for too long)
+	if err := ReminderCollector(ctx); err != nil {
+		return err
 	}
 	return nil
 }
@@ -180,19 +243,31 @@ func GetEngine() Engine {
 
 // Resolve launches the asynchronous execution of a resolution, given its ID
 func (e Engine) Resolve(publicID string, sm *semaphore.Weighted) error {
-	_, err := e.launchResolution(publicID, true, sm)
+	_, err := e.launchResolution(publicID, true, sm, "")
+	return err
+}
+
+// ResolveWithContext launches the asynchronous execution of a resolution, given its ID,
+// logging under the correlation ID held by ctx (e.g. the one of the API request running it)
+func (e Engine) ResolveWithContext(ctx context.Context, publicID string, sm *semaphore.Weighted) error {
+	_, err := e.launchResolution(publicID, true, sm, correlation.FromContext(ctx))
 	return err
 }
 
 // SyncResolve launches the synchronous execution of a resolution, given its ID
 func (e Engine) SyncResolve(publicID string, sm *semaphore.Weighted) (*resolution.Resolution, error) {
-	return e.launchResolution(publicID, false, sm)
+	return e.launchResolution(publicID, false, sm, "")
 }
 
-func (e Engine) launchResolution(publicID string, async bool, sm *semaphore.Weighted) (*resolution.Resolution, error) {
+// launchResolution logs under the given correlation ID, or a new one
+// so that the logs of a single run of the resolution can be told apart
+func (e Engine) launchResolution(publicID string, async bool, sm *semaphore.Weighted, correlationID string) (*resolution.Resolution, error) {
 	e.wg.Add(1)
 	defer e.wg.Done()
-	debugLogger := logrus.WithFields(logrus.Fields{"resolution_id": publicID, "log_type": "engine"})
+	if correlationID == "" {
+		correlationID = correlation.NewID()
+	}
+	debugLogger := logrus.WithFields(logrus.Fields{"resolution_id": publicID, "log_type": "engine", correlation.LogField: correlationID})
 	debugLogger.Debugf("Engine: Resolve() starting for %s", publicID)
 
 	dbp, err := zesty.NewDBProvider(utask.DBName)
@@ -284,6 +359,32 @@ func initialize(dbp zesty.DBProvider, publicID string, debugLogger *logrus.Entry
 		return nil, nil, err
 	}
 
+	t, err := task.LoadFromID(dbp, res.TaskID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a halt requested during a run which didn't get to apply it, e.g. after a crash, applies instead of the next run
+	switch res.State {
+	case resolution.StateCancelled, resolution.StateRunning, resolution.StateDone:
+	default:
+		halt, err := resolution.LoadHalt(dbp, res.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if halt != "" {
+			debugLogger.Debugf("Engine: Resolve() %s halted in state %s", publicID, halt)
+			haltResolution(res, t, halt)
+			if err := commitHalt(dbp, res, t); err != nil {
+				return nil, nil, err
+			}
+			if err := dbp.Commit(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, nil
+		}
+	}
+
 	switch res.State {
 	case resolution.StateCancelled:
 		return nil, nil, errors.NewBadRequest(nil, "Can't run resolution: cancelled")
@@ -309,6 +410,52 @@ func initialize(dbp zesty.DBProvider, publicID string, debugLogger *logrus.Entry
 		}
 		fallthrough
 	default:
+		// the task is kept on hold until the tasks it depends on are over,
+		// it gets resumed when the last of them completes
+		pending, err := t.PendingDependencies(dbp)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(pending) > 0 {
+			debugLogger.Debugf("Engine: Resolve() %s waiting for tasks %s", publicID, strings.Join(pending, ", "))
+			res.SetState(resolution.StateWaiting)
+			res.NextRetry = nil
+			t.SetState(task.StateBlocked)
+			if err := res.Update(dbp); err != nil {
+				return nil, nil, err
+			}
+			if err := t.Update(dbp, true, true); err != nil {
+				return nil, nil, err
+			}
+			if err := dbp.Commit(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, nil
+		}
+
+		// the template caps the amount of its resolutions running simultaneously:
+		// excess resolutions are queued, and picked up again by the retry collector
+		maxConcurrent, running, err := resolution.LockTemplateConcurrency(dbp, t.TemplateID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if maxConcurrent != nil && running >= int64(*maxConcurrent) {
+			debugLogger.Debugf("Engine: Resolve() %s queued, %d resolutions of template %s already running", publicID, running, t.TemplateName)
+			res.SetState(resolution.StateToAutorunDelayed)
+			res.SetNextRetry(now.Get().Add(concurrencyRetryDelay))
+			t.SetState(task.StateDelayed)
+			if err := res.Update(dbp); err != nil {
+				return nil, nil, err
+			}
+			if err := t.Update(dbp, true, true); err != nil {
+				return nil, nil, err
+			}
+			if err := dbp.Commit(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, nil
+		}
+
 		res.SetState(resolution.StateRunning)
 		res.SetInstanceID(utask.InstanceID)
 		res.SetLastStart(now.Get())
@@ -319,11 +466,6 @@ func initialize(dbp zesty.DBProvider, publicID string, debugLogger *logrus.Entry
 		return nil, nil, err
 	}
 
-	t, err := task.LoadFromID(dbp, res.TaskID)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	// if crash recover determined the resolution to be blocked, task is also blocked
 	if res.State == resolution.StateBlockedToCheck {
 		t.SetState(task.StateBlocked)
@@ -364,14 +506,23 @@ func initialize(dbp zesty.DBProvider, publicID string, debugLogger *logrus.Entry
 		return nil, nil, err
 	}
 
-	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	tt, err := tasktemplate.LoadVersion(dbp, t.TemplateID, t.TemplateVersion)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	res.StepExecutionsMax = maxStepExecutions(tt)
+	if res.StepExecutionsMax > 0 {
+		maxStepExecutionsMetrics.WithLabelValues(tt.Name).Set(float64(res.StepExecutionsMax))
+	}
+
 	// provide the resolution with values
 	t.ExportTaskInfos(res.Values)
-	res.Values.SetInput(t.Input)
+	taskInput, err := unsealedInput(t, res.Values.SecretScope())
+	if err != nil {
+		return nil, nil, err
+	}
+	res.Values.SetInput(taskInput)
 	res.Values.SetResolverInput(res.ResolverInput)
 	res.Values.SetVariables(tt.Variables)
 
@@ -382,9 +533,14 @@ func resolve(dbp zesty.DBProvider, res *resolution.Resolution, t *task.Task, sm
 	defer wg.Done()
 	// keep track of steps which get executed during each run, to avoid looping+retrying the same failing step endlessly
 	executedSteps := map[string]bool{}
+	// state requested by the halt of the template during the run
+	halt := ""
 	stepChan := make(chan *step.Step)
+	// progress reported by running steps, dropped rather than blocking them when the loop is busy
+	progressChan := make(chan stepProgress, progressBufferSize)
+	var lastProgressCommit time.Time
 
-	expectedMessages := runAvailableSteps(dbp, map[string]bool{}, res, t, stepChan, executedSteps, []string{}, wg, debugLogger)
+	expectedMessages := runAvailableSteps(dbp, map[string]bool{}, res, t, stepChan, progressChan, executedSteps, []string{}, wg, debugLogger)
 	recheckWaiting := true
 
 forLoop:
@@ -393,6 +549,7 @@ forLoop:
 		select {
 		case s := <-stepChan:
 			s.LastRun = time.Now()
+			s.EndExecution(s.LastRun)
 
 			if _, ok := res.ForeachChildrenAlreadyContracted[s.Name]; ok {
 				// If foreach children has been PRUNE in a skip condition, contraction of the
@@ -405,6 +562,9 @@ forLoop:
 			}
 
 			// Replace task's tags with the tags returned in the step.
+			if t.Tags == nil && len(s.Tags) > 0 {
+				t.Tags = map[string]string{}
+			}
 			for k, v := range s.Tags {
 				if v == "" {
 					delete(t.Tags, k)
@@ -412,6 +572,10 @@ forLoop:
 					t.Tags[k] = v
 				}
 			}
+			if len(s.Tags) > 0 {
+				// keep templating values up to date for the following steps
+				t.ExportTaskInfos(res.Values)
+			}
 
 			var oldState string
 			if oldStep, ok := res.Steps[s.Name]; ok {
@@ -441,11 +605,15 @@ forLoop:
 				executedSteps[s.Name] = true
 			}
 
-			debugLogger := debugLogger.WithFields(logrus.Fields{"step_name": s.Name, "step_state": s.State})
+			debugLogger := debugLogger.WithFields(logrus.Fields{"step_name": s.Name, "step_state": s.State, "attempt_id": s.AttemptID()})
 			debugLogger.Debugf("Engine: resolve() %s loop, step %s (#%d) result: %s", res.PublicID, s.Name, s.TryCount, s.State)
 
 			if newStep, ok := res.Steps[s.Name]; ok && newStep.State != oldState {
 				t.NotifyStepState(s.Name, newStep.State)
+				// foreach children share the notify block of their parent, which notifies once for all
+				if newStep.Notify != nil && !newStep.IsChild() && newStep.Notify.Matches(newStep.State) {
+					t.NotifyStepNotification(s.Name, newStep.State, res.Values.SecretScope().RedactString(newStep.Error), newStep.Notify.Backends)
+				}
 			}
 
 			// update done step count
@@ -455,8 +623,14 @@ forLoop:
 			}
 			// one less step to go
 			expectedMessages--
-			// state change might unlock more steps for execution
-			expectedMessages += runAvailableSteps(dbp, modifiedSteps, res, t, stepChan, executedSteps, []string{}, wg, debugLogger)
+			// state change might unlock more steps for execution, unless the resolution was halted:
+			// the steps still running are waited for
+			if halt == "" {
+				halt = loadHalt(dbp, res, debugLogger)
+			}
+			if halt == "" {
+				expectedMessages += runAvailableSteps(dbp, modifiedSteps, res, t, stepChan, progressChan, executedSteps, []string{}, wg, debugLogger)
+			}
 
 			// attempt to persist all changes in db
 			if err := commit(dbp, res, t); err != nil {
@@ -464,6 +638,21 @@ forLoop:
 			} else {
 				debugLogger.Debugf("Engine: resolve() %s loop, COMMIT DONE: step: %s = %s", res.PublicID, s.Name, s.State)
 			}
+		case p := <-progressChan:
+			// a late report of a step already done is discarded
+			s, ok := res.Steps[p.name]
+			if !ok || s.State != step.StateRunning {
+				continue
+			}
+			s.Progress = p.progress
+			// progress is persisted at a bounded pace, the last one reported is kept along with the next commit
+			if time.Since(lastProgressCommit) < progressCommitInterval {
+				continue
+			}
+			lastProgressCommit = time.Now()
+			if err := commit(dbp, res, nil); err != nil {
+				debugLogger.Debugf("Engine: resolve() %s loop, FAILED TO COMMIT PROGRESS: %s", res.PublicID, err)
+			}
 		case <-gracePeriodEnd:
 			// shutting down, time is up: exit the loop no matter how many steps might be pending
 			expectedMessages = 0
@@ -500,7 +689,12 @@ forLoop:
 			mapStatus[resolution.StateCrashed] = true
 			allDone = false
 		case step.StateWaiting:
-			mapStatus[resolution.StateWaiting] = true
+			// approval steps wait for a human decision rather than for an event
+			if s.Action.Type == pluginapproval.Plugin.PluginName() {
+				mapStatus[resolution.StateBlockedApproval] = true
+			} else {
+				mapStatus[resolution.StateWaiting] = true
+			}
 			allDone = false
 		case step.StateTODO:
 			// instance is in shutdown mode, the resolution may have been interrupted
@@ -521,9 +715,9 @@ forLoop:
 	// compute resolution state
 	if !allDone {
 		// from candidate resolution states, choose a resolution state by priority
-		for _, status := range []string{resolution.StateCrashed, resolution.StateBlockedFatal, resolution.StateBlockedBadRequest, resolution.StateError, resolution.StateWaiting, resolution.StateBlockedDeadlock, resolution.StateToAutorunDelayed} {
+		for _, status := range []string{resolution.StateCrashed, resolution.StateBlockedFatal, resolution.StateBlockedBadRequest, resolution.StateError, resolution.StateWaiting, resolution.StateBlockedApproval, resolution.StateBlockedDeadlock, resolution.StateToAutorunDelayed} {
 			if mapStatus[status] {
-				if status == resolution.StateWaiting && recheckWaiting {
+				if status == resolution.StateWaiting && recheckWaiting && halt == "" {
 					for name, s := range res.Steps {
 						// Steps using the batch plugin shouldn't be run again when WAITING. Running them second time
 						// may lead to a race condition when the last task of a sub-batch tries to resume its parent
@@ -532,7 +726,7 @@ forLoop:
 						}
 					}
 
-					expectedMessages = runAvailableSteps(dbp, map[string]bool{}, res, t, stepChan, executedSteps, []string{}, wg, debugLogger)
+					expectedMessages = runAvailableSteps(dbp, map[string]bool{}, res, t, stepChan, progressChan, executedSteps, []string{}, wg, debugLogger)
 					recheckWaiting = false
 
 					debugLogger.Debugf("Engine: resolve() %s loop, try to resolve %d waiting step(s)", res.PublicID, expectedMessages)
@@ -567,12 +761,31 @@ forLoop:
 		}
 	case resolution.StateWaiting:
 		t.SetState(task.StateWaiting)
+		// wake the resolution up when the first waiting step reaches its deadline
+		res.NextRetry = nil
+		for _, s := range res.Steps {
+			if s.State == step.StateWaiting && s.WaitUntil != nil && (res.NextRetry == nil || s.WaitUntil.Before(*res.NextRetry)) {
+				res.SetNextRetry(*s.WaitUntil)
+			}
+		}
 	case resolution.StateToAutorunDelayed:
 		t.SetState(task.StateDelayed)
-	case resolution.StateBlockedBadRequest, resolution.StateBlockedFatal, resolution.StateBlockedDeadlock:
+	case resolution.StateBlockedBadRequest, resolution.StateBlockedFatal, resolution.StateBlockedDeadlock, resolution.StateBlockedApproval:
 		t.SetState(task.StateBlocked)
 	}
 
+	// an unfinished resolution halted during its run is left in the requested state
+	finalCommit := commit
+	if !allDone {
+		if halt == "" {
+			halt = loadHalt(dbp, res, debugLogger)
+		}
+		if halt != "" {
+			haltResolution(res, t, halt)
+			finalCommit = commitHalt
+		}
+	}
+
 	// finalize metadata collection
 	res.SetLastStop(now.Get())
 
@@ -594,7 +807,7 @@ forLoop:
 
 	for {
 		debugLogger := debugLogger.WithField("resolution_state", res.State)
-		err := commit(dbp, res, t)
+		err := finalCommit(dbp, res, t)
 		if err != nil {
 			debugLogger.Debugf("Engine: resolve() %s final commit error: %s", res.PublicID, err)
 		} else {
@@ -604,6 +817,12 @@ forLoop:
 		time.Sleep(bkoff.NextBackOff())
 	}
 
+	if t.State == task.StateBlocked {
+		if err := reportBlockedResolution(dbp, res, t); err != nil {
+			debugLogger.WithError(err).Debugf("Engine: resolve() %s failed to report blocked resolution: %s", res.PublicID, err)
+		}
+	}
+
 	if sm != nil {
 		sm.Release(1)
 	}
@@ -613,6 +832,46 @@ forLoop:
 	if err := resumeParentTask(dbp, t, sm, debugLogger); err != nil {
 		debugLogger.WithError(err).Debugf("Engine: resolver(): failed to resume parent task: %s", err)
 	}
+	if err := resumeDependentTasks(dbp, t, sm, debugLogger); err != nil {
+		debugLogger.WithError(err).Debugf("Engine: resolver(): failed to resume dependent tasks: %s", err)
+	}
+}
+
+// reportBlockedResolution posts an error comment on a task whose resolution got blocked,
+// listing the errors of its failed steps. A resolution waiting for approvals is reported
+// with a system comment, listing the steps to approve
+func reportBlockedResolution(dbp zesty.DBProvider, res *resolution.Resolution, t *task.Task) error {
+	if res.State == resolution.StateBlockedApproval {
+		names := make([]string, 0)
+		for name, s := range res.Steps {
+			if s.State == step.StateWaiting && s.Action.Type == pluginapproval.Plugin.PluginName() {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		_, err := task.CreateSystemComment(dbp, t, utask.AppName(), "resolution waiting for the approval of step "+strings.Join(names, ", "))
+		return err
+	}
+
+	details := make([]string, 0)
+	for name, s := range res.Steps {
+		switch s.State {
+		case step.StateClientError, step.StateServerError, step.StateFatalError, step.StateCrashed, step.StateAfterrunError:
+			details = append(details, fmt.Sprintf("step %s (%s): %s", name, s.State, s.Error))
+		}
+	}
+	sort.Strings(details)
+
+	content := fmt.Sprintf("resolution blocked in state %s", res.State)
+	if len(details) > 0 {
+		content += "\n" + strings.Join(details, "\n")
+	}
+	if len(content) > utask.MaxTextSizeLong {
+		content = content[:utask.MaxTextSizeLong]
+	}
+
+	_, err := task.CreateErrorComment(dbp, t, utask.AppName(), content)
+	return err
 }
 
 func resumeParentTask(dbp zesty.DBProvider, currentTask *task.Task, sm *semaphore.Weighted, debugLogger *logrus.Entry) error {
@@ -627,7 +886,29 @@ func resumeParentTask(dbp zesty.DBProvider, currentTask *task.Task, sm *semaphor
 
 	debugLogger.Debugf("resuming parent task %q resolution %q", parentTask.PublicID, *parentTask.Resolution)
 	debugLogger.WithFields(logrus.Fields{"task_id": parentTask.PublicID, "resolution_id": *parentTask.Resolution}).Debugf("resuming resolution %q as child task %q state changed", *parentTask.Resolution, currentTask.PublicID)
-	return GetEngine().Resolve(*parentTask.Resolution, sm)
+	return GetEngine().ResolveWithContext(loggerContext(debugLogger), *parentTask.Resolution, sm)
+}
+
+func resumeDependentTasks(dbp zesty.DBProvider, currentTask *task.Task, sm *semaphore.Weighted, debugLogger *logrus.Entry) error {
+	dependentTasks, err := taskutils.DependentTasksToResume(dbp, currentTask)
+	if err != nil {
+		return err
+	}
+
+	for _, dependentTask := range dependentTasks {
+		debugLogger.WithFields(logrus.Fields{"task_id": dependentTask.PublicID, "resolution_id": *dependentTask.Resolution}).Debugf("resuming resolution %q as dependency task %q is over", *dependentTask.Resolution, currentTask.PublicID)
+		if err := GetEngine().ResolveWithContext(loggerContext(debugLogger), *dependentTask.Resolution, sm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loggerContext returns a context holding the correlation ID of debugLogger,
+// for the resolutions resumed by a resolution to share its logs correlation ID
+func loggerContext(debugLogger *logrus.Entry) context.Context {
+	id, _ := debugLogger.Data[correlation.LogField].(string)
+	return correlation.NewContext(context.Background(), id)
 }
 
 func commit(dbp zesty.DBProvider, res *resolution.Resolution, t *task.Task) error {
@@ -649,7 +930,44 @@ func commit(dbp zesty.DBProvider, res *resolution.Resolution, t *task.Task) erro
 	return dbp.Commit()
 }
 
-func runAvailableSteps(dbp zesty.DBProvider, modifiedSteps map[string]bool, res *resolution.Resolution, t *task.Task, stepChan chan<- *step.Step, executedSteps map[string]bool, expandedSteps []string, wg *sync.WaitGroup, debugLogger *logrus.Entry) int {
+// loadHalt returns the state requested by the halt of a running resolution, if any
+// a failure to check it is logged, the resolution going on
+func loadHalt(dbp zesty.DBProvider, res *resolution.Resolution, debugLogger *logrus.Entry) string {
+	halt, err := resolution.LoadHalt(dbp, res.ID)
+	if err != nil {
+		debugLogger.Debugf("Engine: resolve() %s failed to check halt: %s", res.PublicID, err)
+		return ""
+	}
+	return halt
+}
+
+// haltResolution leaves a resolution in the state requested by the halt of its template:
+// a cancelled resolution cancels its task, a paused one leaves it as is
+func haltResolution(res *resolution.Resolution, t *task.Task, state string) {
+	res.SetState(state)
+	res.NextRetry = nil
+	if state == resolution.StateCancelled {
+		t.SetState(task.StateCancelled)
+	}
+}
+
+// commitHalt persists a halted resolution, removing its halt along with it
+func commitHalt(dbp zesty.DBProvider, res *resolution.Resolution, t *task.Task) error {
+	sp, err := dbp.TxSavepoint()
+	defer dbp.RollbackTo(sp)
+	if err != nil {
+		return err
+	}
+	if err := resolution.ClearHalt(dbp, res.ID); err != nil {
+		return err
+	}
+	if err := commit(dbp, res, t); err != nil {
+		return err
+	}
+	return dbp.Commit()
+}
+
+func runAvailableSteps(dbp zesty.DBProvider, modifiedSteps map[string]bool, res *resolution.Resolution, t *task.Task, stepChan chan<- *step.Step, progressChan chan<- stepProgress, executedSteps map[string]bool, expandedSteps []string, wg *sync.WaitGroup, debugLogger *logrus.Entry) int {
 	av := availableSteps(modifiedSteps, res, executedSteps, expandedSteps, debugLogger)
 	expandedSteps = []string{}
 	preRunModifiedSteps := map[string]bool{}
@@ -712,17 +1030,51 @@ func runAvailableSteps(dbp zesty.DBProvider, modifiedSteps map[string]bool, res
 			} else { // regular step
 				s.ResultValidate = jsonschema.Validator(s.Name, s.Schema)
 
+				// a runaway resolution fails instead of executing steps endlessly
+				if res.StepExecutionsExceeded() {
+					res.SetStepState(s.Name, step.StateFatalError)
+					s.Error = fmt.Sprintf("resolution reached its maximum of %d step executions", res.StepExecutionsMax)
+					executedSteps[s.Name] = true
+					exceededStepExecutionsMetrics.WithLabelValues(t.TemplateName).Inc()
+					go func(s *step.Step) {
+						stepChan <- s
+					}(s)
+					continue
+				}
+				// a step retried once too often fails the resolution, instead of retrying again
+				if s.TryCount > 0 && s.State != step.StateAfterrunError {
+					if res.RetryBudgetExhausted() {
+						res.SetStepState(s.Name, step.StateFatalError)
+						s.Error = fmt.Sprintf("resolution exhausted its retry budget of %d retries: %s", *res.RetryBudget, s.Error)
+						executedSteps[s.Name] = true
+						exhaustedRetryBudgetMetrics.WithLabelValues(t.TemplateName).Inc()
+						go func(s *step.Step) {
+							stepChan <- s
+						}(s)
+						continue
+					}
+					res.IncrementStepRetries()
+				}
+				res.IncrementStepExecutions()
+
 				// skip prerun
 				// TODO fixme, ugly
 				// juggling with STATE_AFTERRUN_ERROR should probably only be inside step pkg
 				if s.State != step.StateAfterrunError {
 					res.SetStepState(s.Name, step.StateRunning)
 					step.PreRun(s, res.Values, resolutionStateSetter(res, preRunModifiedSteps), executedSteps)
+					// the key is committed before the step runs, for its retries
+					// to reuse it, even after a crash of the instance
+					if s.IdempotencyKey == "" {
+						s.IdempotencyKey = uuid.Must(uuid.NewV4()).String()
+					}
 					commit(dbp, res, nil)
 				}
 
 				// run
+				s.Progress = nil
 				stepCopy := *s
+				stepCopy.SetProgressReporter(progressReporter(s.Name, progressChan))
 				step.Run(&stepCopy, res.BaseConfigurations, res.Values, stepChan, wg, shutdownCtx)
 			}
 		}
@@ -733,12 +1085,28 @@ func runAvailableSteps(dbp zesty.DBProvider, modifiedSteps map[string]bool, res
 	// - loop step generated new steps
 	if len(preRunModifiedSteps) > 0 || expanded > 0 {
 		pruneSteps(res, preRunModifiedSteps)
-		return len(av) + runAvailableSteps(dbp, preRunModifiedSteps, res, t, stepChan, executedSteps, expandedSteps, wg, debugLogger)
+		return len(av) + runAvailableSteps(dbp, preRunModifiedSteps, res, t, stepChan, progressChan, executedSteps, expandedSteps, wg, debugLogger)
 	}
 
 	return len(av)
 }
 
+// stepProgress is a progress reported by a running step
+type stepProgress struct {
+	name     string
+	progress *step.Progress
+}
+
+// progressReporter forwards the progress reported by a step to the resolution loop
+func progressReporter(name string, progressChan chan<- stepProgress) func(*step.Progress) {
+	return func(p *step.Progress) {
+		select {
+		case progressChan <- stepProgress{name: name, progress: p}:
+		default:
+		}
+	}
+}
+
 func expandStep(s *step.Step, res *resolution.Resolution) {
 	foreach, err := res.Values.Apply(s.ForEach, nil, "")
 	if err != nil {
@@ -747,8 +1115,8 @@ func expandStep(s *step.Step, res *resolution.Resolution) {
 		return
 	}
 	// unmarshal into collection
-	var items []interface{}
-	if err := utils.JSONnumberUnmarshal(bytes.NewReader(foreach), &items); err != nil {
+	items, keys, err := foreachItems(foreach)
+	if err != nil {
 		res.SetStepState(s.Name, step.StateFatalError)
 		s.Error = err.Error()
 		return
@@ -791,6 +1159,11 @@ func expandStep(s *step.Step, res *resolution.Resolution) {
 			Conditions:   conditions,
 			Resources:    resources,
 			Item:         item,
+			Iteration: &values.Iteration{
+				Index: i,
+				Key:   keys[i],
+				Total: len(items),
+			},
 		}
 
 		if s.ForEachStrategy == step.ForEachStrategySequence {
@@ -815,6 +1188,40 @@ func expandStep(s *step.Step, res *resolution.Resolution) {
 	res.SetStepState(s.Name, step.StateExpanded)
 }
 
+// foreachItems unmarshals the collection of a foreach step, along with the key of each item:
+// its index in a list, or its key in an object, whose items are sorted by key
+func foreachItems(foreach []byte) ([]interface{}, []interface{}, error) {
+	var collection interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(foreach), &collection); err != nil {
+		return nil, nil, err
+	}
+
+	switch c := collection.(type) {
+	case nil:
+		return nil, nil, nil
+	case []interface{}:
+		keys := make([]interface{}, len(c))
+		for i := range c {
+			keys[i] = i
+		}
+		return c, keys, nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(c))
+		for k := range c {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		items := make([]interface{}, len(names))
+		keys := make([]interface{}, len(names))
+		for i, k := range names {
+			items[i] = c[k]
+			keys[i] = k
+		}
+		return items, keys, nil
+	}
+	return nil, nil, fmt.Errorf("foreach: expected a list or an object, got %s", bytes.TrimSpace(foreach))
+}
+
 func contractStep(s *step.Step, res *resolution.Resolution) {
 	// collect results, metadata and errors
 	collectedChildren := []interface{}{}
@@ -837,6 +1244,9 @@ func contractStep(s *step.Step, res *resolution.Resolution) {
 
 				childMetadata[values.IteratorKey] = make(map[string]interface{})
 				childMetadata[values.IteratorKey] = child.Item
+				if child.Iteration != nil {
+					childMetadata[values.IterationKey] = child.Iteration.Map()
+				}
 				childM[values.MetadataKey] = childMetadata
 				childM[values.StateKey] = child.State
 				var i interface{} = childM
@@ -1135,3 +1545,30 @@ func resolutionStateSetter(res *resolution.Resolution, modifiedSteps map[string]
 		}
 	}
 }
+
+// maxStepExecutions returns the cap on the step executions of a resolution of the given template:
+// the lowest of the template's and the instance's ones, 0 for no limit
+func maxStepExecutions(tt *tasktemplate.TaskTemplate) int {
+	max := 0
+	for _, m := range []*int{tt.MaxStepExecutions, eng.maxStepExecutions} {
+		if m != nil && (max == 0 || *m < max) {
+			max = *m
+		}
+	}
+	return max
+}
+
+// unsealedInput reveals the secret inputs of a task to the steps of its resolution,
+// and marks their values as secret so they get redacted from its results when displayed
+func unsealedInput(t *task.Task, scope *values.SecretScope) (map[string]interface{}, error) {
+	unsealed, err := t.UnsealedInput()
+	if err != nil {
+		return nil, err
+	}
+	for name, val := range t.Input {
+		if input.IsSealed(val) {
+			scope.RegisterValue(unsealed[name])
+		}
+	}
+	return unsealed, nil
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/cneill/utask/models/task"
 	"github.com/cneill/utask/models/tasktemplate"
 	compress "github.com/cneill/utask/pkg/compress/init"
+	"github.com/cneill/utask/pkg/notify"
 	"github.com/cneill/utask/pkg/now"
 	"github.com/cneill/utask/pkg/plugins"
 	pluginbatch "github.com/cneill/utask/pkg/plugins/builtin/batch"
@@ -44,6 +45,7 @@ import (
 	"github.com/cneill/utask/pkg/plugins/builtin/echo"
 	"github.com/cneill/utask/pkg/plugins/builtin/script"
 	pluginsubtask "github.com/cneill/utask/pkg/plugins/builtin/subtask"
+	plugintag "github.com/cneill/utask/pkg/plugins/builtin/tag"
 	"github.com/cneill/utask/pkg/taskutils"
 )
 
@@ -97,6 +99,7 @@ func TestMain(m *testing.M) {
 	step.RegisterRunner(pluginsubtask.Plugin.PluginName(), pluginsubtask.Plugin)
 	step.RegisterRunner(pluginbatch.Plugin.PluginName(), pluginbatch.Plugin)
 	step.RegisterRunner(plugincallback.Plugin.PluginName(), plugincallback.Plugin)
+	step.RegisterRunner(plugintag.Plugin.PluginName(), plugintag.Plugin)
 
 	os.Exit(m.Run())
 }
@@ -140,7 +143,7 @@ func createResolution(tmplName string, inputs, resolverInputs map[string]interfa
 	if err != nil {
 		return nil, err
 	}
-	tsk, err := task.Create(dbp, tmpl, "", nil, nil, nil, nil, nil, inputs, nil, nil, false)
+	tsk, err := task.Create(dbp, tmpl, "", task.CreateOptions{Input: inputs})
 	if err != nil {
 		return nil, err
 	}
@@ -229,6 +232,32 @@ func TestSimpleTemplate(t *testing.T) {
 	assert.Equal(t, "FAIL!", res.Values.GetError("stepThree"))
 }
 
+func TestSecretInput(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	res, err := runTask("secretInput.yaml", map[string]interface{}{"token": "tok-secret-input-test"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, resolution.StateDone, res.State)
+	// the steps see the actual value
+	assert.Equal(t, "token is tok-secret-input-test", res.Values.GetOutput("stepOne").(map[string]interface{})["message"])
+
+	// which is only redacted from the results of this resolution once displayed
+	shown, err := resolution.LoadFromPublicID(dbp, res.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, "tok-secret-input-test", shown.Steps["stepOne"].Output.(map[string]interface{})["token"])
+	shown.RedactSecrets()
+	assert.Equal(t, map[string]interface{}{"token": "***", "message": "token is ***"}, shown.Steps["stepOne"].Output)
+
+	// a short secret is not worth redacting, and the secrets of another resolution are ignored
+	other, err := runTask("secretInput.yaml", map[string]interface{}{"token": "1"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, resolution.StateDone, other.State)
+	other.Steps["stepOne"].Output = map[string]interface{}{"message": "tok-secret-input-test 1"}
+	other.RedactSecrets()
+	assert.Equal(t, map[string]interface{}{"message": "tok-secret-input-test 1"}, other.Steps["stepOne"].Output)
+}
+
 func TestFunction(t *testing.T) {
 	input := map[string]interface{}{}
 	res, err := runTask("functionEchoHelloWorld.yaml", input, nil)
@@ -345,6 +374,16 @@ func TestStepMaxRetries(t *testing.T) {
 	assert.Equal(t, resolution.StateBlockedFatal, res.State)
 	assert.Equal(t, 2, res.Steps["stepOne"].TryCount)
 	assert.Equal(t, step.StateFatalError, res.Steps["stepOne"].State)
+
+	// the blocked resolution is reported on the task
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+	commentType := task.CommentTypeError
+	comments, err := task.ListComments(dbp, res.TaskID, task.CommentFilter{Type: &commentType, PageSize: 10})
+	require.Nil(t, err)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Content, "resolution blocked in state BLOCKED_FATAL")
+	assert.Contains(t, comments[0].Content, "step stepOne (FATAL_ERROR)")
 }
 
 func TestLintingAndValidation(t *testing.T) {
@@ -783,6 +822,45 @@ func TestForeachWithChainedIterations(t *testing.T) {
 	assert.Cmp(res.Steps["generateItems-4"].Dependencies, []string{"generateItems-3"})
 }
 
+func TestForeachIteration(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+	res, err := createResolution("foreachIteration.yaml", map[string]interface{}{
+		"list": []interface{}{"x", "y", "z"},
+	}, nil)
+	require.Nil(err)
+	require.NotNil(res)
+
+	res, err = runResolution(res)
+	require.NotNil(res)
+	require.Nil(err)
+	require.Cmp(res.State, resolution.StateDone)
+
+	outputs := func(stepName string) []interface{} {
+		ret := []interface{}{}
+		for _, child := range res.Steps[stepName].Children {
+			ret = append(ret, child.(map[string]interface{})[values.OutputKey])
+		}
+		return ret
+	}
+
+	assert.Cmp(outputs("listItems"), []interface{}{
+		map[string]interface{}{"position": "0/3", "key": "0", "value": "x"},
+		map[string]interface{}{"position": "1/3", "key": "1", "value": "y"},
+		map[string]interface{}{"position": "2/3", "key": "2", "value": "z"},
+	})
+	assert.Cmp(outputs("objectItems"), []interface{}{
+		map[string]interface{}{"position": "0/2", "key": "alpha", "value": "a"},
+		map[string]interface{}{"position": "1/2", "key": "beta", "value": "b"},
+	})
+	// the iteration of the children steps shadows the one of their parents,
+	// still available through their metadata
+	assert.Cmp(outputs("chainedItems"), []interface{}{
+		map[string]interface{}{"position": "0/3", "parent": "0-x"},
+		map[string]interface{}{"position": "1/3", "parent": "1-y"},
+		map[string]interface{}{"position": "2/3", "parent": "2-z"},
+	})
+}
+
 func TestForeachWithChainedIterationsWithDepOnParent(t *testing.T) {
 	assert, require := td.AssertRequire(t)
 	res, err := createResolution("foreach.yaml", map[string]interface{}{
@@ -1360,6 +1438,382 @@ func TestResolveSubTaskParentTaskPaused(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestTaskDependencies(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	tmpl, err := templateFromYAML(dbp, "no-output.yaml")
+	require.Nil(t, err)
+
+	dependency, err := task.Create(dbp, tmpl, "", task.CreateOptions{})
+	require.Nil(t, err)
+
+	// unknown dependencies are rejected
+	_, err = task.Create(dbp, tmpl, "", task.CreateOptions{DependsOn: []string{"a9d6bdc7-7d0e-4c8b-a1e3-9b6b2d5d4a31"}})
+	assert.True(t, errors.IsNotFound(err), "unexpected error: %v", err)
+	// a dependency can't be declared twice
+	_, err = task.Create(dbp, tmpl, "", task.CreateOptions{DependsOn: []string{dependency.PublicID, dependency.PublicID}})
+	assert.True(t, errors.IsBadRequest(err), "unexpected error: %v", err)
+	// cycles are rejected
+	err = task.ValidateDependencies(dbp, dependency.PublicID, []string{dependency.PublicID})
+	assert.True(t, errors.IsBadRequest(err), "unexpected error: %v", err)
+
+	dependent, err := task.Create(dbp, tmpl, "", task.CreateOptions{DependsOn: []string{dependency.PublicID}})
+	require.Nil(t, err)
+	err = task.ValidateDependencies(dbp, dependency.PublicID, []string{dependent.PublicID})
+	assert.True(t, errors.IsBadRequest(err), "unexpected error: %v", err)
+
+	// the dependent task is kept on hold while its dependency is not over
+	dependentRes, err := resolution.Create(dbp, dependent, nil, "", false, nil)
+	require.Nil(t, err)
+	_, err = runResolution(dependentRes)
+	require.Nil(t, err)
+
+	dependentRes, err = resolution.LoadFromPublicID(dbp, dependentRes.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateWaiting, dependentRes.State)
+	dependent, err = task.LoadFromPublicID(dbp, dependent.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, task.StateBlocked, dependent.State)
+
+	toResume, err := taskutils.DependentTasksToResume(dbp, dependency)
+	require.Nil(t, err)
+	assert.Len(t, toResume, 0)
+
+	// the dependent task is resumed once its dependency is done
+	dependencyRes, err := resolution.Create(dbp, dependency, nil, "", false, nil)
+	require.Nil(t, err)
+	dependencyRes, err = runResolution(dependencyRes)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateDone, dependencyRes.State)
+
+	ti := time.Second
+	i := time.Duration(0)
+	for i < ti {
+		dependentRes, err = resolution.LoadFromPublicID(dbp, dependentRes.PublicID)
+		require.Nil(t, err)
+		if dependentRes.State == resolution.StateDone {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+		i += time.Millisecond * 10
+	}
+	assert.Equal(t, resolution.StateDone, dependentRes.State)
+}
+
+func TestTaskDependencyDeleted(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	tmpl, err := templateFromYAML(dbp, "no-output.yaml")
+	require.Nil(t, err)
+
+	waitForHold := func(tsk *task.Task) *resolution.Resolution {
+		res, err := resolution.Create(dbp, tsk, nil, "", false, nil)
+		require.Nil(t, err)
+		_, err = runResolution(res)
+		require.Nil(t, err)
+		res, err = resolution.LoadFromPublicID(dbp, res.PublicID)
+		require.Nil(t, err)
+		require.Equal(t, resolution.StateWaiting, res.State)
+		return res
+	}
+	waitForState := func(res *resolution.Resolution, state string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			res, err := resolution.LoadFromPublicID(dbp, res.PublicID)
+			require.Nil(t, err)
+			if res.State == state {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("resolution %s still in state %s", res.PublicID, res.State)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	// a task depending on a deleted task is resumed, whatever the state of the deleted task was
+	deleted, err := task.Create(dbp, tmpl, "", task.CreateOptions{})
+	require.Nil(t, err)
+	other, err := task.Create(dbp, tmpl, "", task.CreateOptions{})
+	require.Nil(t, err)
+	dependent, err := task.Create(dbp, tmpl, "", task.CreateOptions{DependsOn: []string{deleted.PublicID, other.PublicID}})
+	require.Nil(t, err)
+	dependentRes := waitForHold(dependent)
+
+	require.Nil(t, taskutils.DeleteTask(context.Background(), dbp, deleted))
+
+	// as long as it still waits for another task
+	toResume, err := taskutils.DeletedDependencyTasksToResume(dbp, deleted.PublicID)
+	require.Nil(t, err)
+	assert.Len(t, toResume, 0)
+
+	require.Nil(t, taskutils.DeleteTask(context.Background(), dbp, other))
+	toResume, err = taskutils.DeletedDependencyTasksToResume(dbp, other.PublicID)
+	require.Nil(t, err)
+	require.Len(t, toResume, 1)
+	assert.Equal(t, dependent.PublicID, toResume[0].PublicID)
+
+	// the garbage collector resumes the tasks which missed the deletion of their dependencies
+	released, err := taskutils.ReleasedTasksToResume(dbp)
+	require.Nil(t, err)
+	var found bool
+	for _, r := range released {
+		found = found || r.PublicID == dependent.PublicID
+	}
+	assert.True(t, found, "dependent task not released")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Nil(t, engine.GarbageCollector(ctx, "", ""))
+	waitForState(dependentRes, resolution.StateDone)
+
+	// a task still waiting for a task which exists is not released
+	pending, err := task.Create(dbp, tmpl, "", task.CreateOptions{})
+	require.Nil(t, err)
+	held, err := task.Create(dbp, tmpl, "", task.CreateOptions{DependsOn: []string{pending.PublicID}})
+	require.Nil(t, err)
+	waitForHold(held)
+	released, err = taskutils.ReleasedTasksToResume(dbp)
+	require.Nil(t, err)
+	for _, r := range released {
+		assert.NotEqual(t, held.PublicID, r.PublicID)
+	}
+}
+
+func TestTemplateMaxConcurrent(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	running, err := createResolution("max-concurrent.yaml", nil, nil)
+	require.Nil(t, err)
+	queued, err := createResolution("max-concurrent.yaml", nil, nil)
+	require.Nil(t, err)
+
+	// simulate a resolution of the template being run
+	running.SetState(resolution.StateRunning)
+	require.Nil(t, updateResolution(running))
+
+	// the template's single slot is taken, the resolution is queued
+	_, err = runResolution(queued)
+	require.Nil(t, err)
+
+	queued, err = resolution.LoadFromPublicID(dbp, queued.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateToAutorunDelayed, queued.State)
+	assert.NotNil(t, queued.NextRetry)
+	assert.Equal(t, 0, queued.RunCount)
+	tsk, err := task.LoadFromID(dbp, queued.TaskID)
+	require.Nil(t, err)
+	assert.Equal(t, task.StateDelayed, tsk.State)
+
+	// the slot is released, the queued resolution can run
+	running.SetState(resolution.StateDone)
+	require.Nil(t, updateResolution(running))
+
+	queued, err = runResolution(queued)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateDone, queued.State)
+}
+
+func TestTemplateMaxStepExecutions(t *testing.T) {
+	res, err := createResolution("max-step-executions.yaml", nil, nil)
+	require.Nil(t, err)
+
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	require.NotNil(t, res)
+
+	// three iterations were executed, the others failed the resolution
+	assert.Equal(t, resolution.StateBlockedFatal, res.State)
+	assert.Equal(t, 3, res.StepExecutions)
+
+	exceeded := 0
+	for _, s := range res.Steps {
+		if s.State == step.StateFatalError {
+			assert.Equal(t, "resolution reached its maximum of 3 step executions", s.Error)
+			exceeded++
+		}
+	}
+	assert.Equal(t, 2, exceeded)
+}
+
+func TestTemplateRetryBudget(t *testing.T) {
+	res, err := createResolution("retry-budget.yaml", nil, nil)
+	require.Nil(t, err)
+	require.NotNil(t, res)
+	require.NotNil(t, res.RetryBudget)
+	assert.Equal(t, 5, *res.RetryBudget)
+
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	require.NotNil(t, res)
+
+	// both steps shared five retries, then failed the resolution
+	assert.Equal(t, resolution.StateBlockedFatal, res.State)
+	assert.Equal(t, 5, res.StepRetries)
+	assert.Equal(t, 7, res.Steps["first"].TryCount+res.Steps["second"].TryCount)
+	for _, name := range []string{"first", "second"} {
+		assert.Equal(t, step.StateFatalError, res.Steps[name].State)
+		assert.True(t, strings.HasPrefix(res.Steps[name].Error, "resolution exhausted its retry budget of 5 retries"))
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	res, err = resolution.LoadFromPublicID(dbp, res.PublicID)
+	require.Nil(t, err)
+	require.NotNil(t, res.RetryBudgetRemaining)
+	assert.Equal(t, 0, *res.RetryBudgetRemaining)
+}
+
+type slaBreachSender struct {
+	breaches chan string
+}
+
+func (s *slaBreachSender) Send(m *notify.Message, name string) {
+	if m.NotificationType == notify.TaskSLABreachKey {
+		s.breaches <- m.TaskID()
+	}
+}
+
+func TestSLACollector(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	sender := &slaBreachSender{breaches: make(chan string, 10)}
+	notify.RegisterSender("sla-breaches", sender, map[string]string{notify.TaskSLABreachKey: utask.NotificationStrategyAlways}, nil)
+
+	res, err := createResolution("sla.yaml", nil, nil)
+	require.Nil(t, err)
+	tsk, err := task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+	require.NotNil(t, tsk.SLADeadline)
+	assert.False(t, tsk.SLABreached)
+
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Nil(t, engine.SLACollector(ctx))
+
+	timeout := time.After(5 * time.Second)
+	for breached := false; !breached; {
+		select {
+		case taskID := <-sender.breaches:
+			breached = taskID == tsk.PublicID
+		case <-timeout:
+			t.Fatal("sla breach not notified")
+		}
+	}
+
+	// the breach is flagged, to be notified only once
+	tsk, err = task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+	assert.True(t, tsk.SLABreached)
+}
+
+type reminderSender struct {
+	reminders chan *notify.Message
+}
+
+func (s *reminderSender) Send(m *notify.Message, name string) {
+	if m.NotificationType == notify.TaskReminderKey {
+		s.reminders <- m
+	}
+}
+
+func TestReminderCollector(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	sender := &reminderSender{reminders: make(chan *notify.Message, 10)}
+	notify.RegisterSender("reminders", sender, map[string]string{notify.TaskReminderKey: utask.NotificationStrategyAlways}, nil)
+
+	res, err := runTask("reminder.yaml", nil, nil)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateBlockedBadRequest, res.State)
+
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Nil(t, engine.ReminderCollector(ctx))
+
+	tsk, err := task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+
+	timeout := time.After(5 * time.Second)
+	for reminded := false; !reminded; {
+		select {
+		case m := <-sender.reminders:
+			if m.TaskID() == tsk.PublicID {
+				reminded = true
+				assert.Equal(t, "foo", m.Fields["potential_resolvers"])
+				assert.Equal(t, "bar-team", m.Fields["potential_resolver_groups"])
+			}
+		case <-timeout:
+			t.Fatal("blocked task not reminded")
+		}
+	}
+
+	// the next reminder is due after the reminder_interval
+	tsk, err = task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+	assert.NotNil(t, tsk.LastReminder)
+}
+
+func TestGarbageCollectorTTL(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	tmpl, err := templateFromYAML(dbp, "no-output.yaml")
+	require.Nil(t, err)
+
+	createTask := func(state, ttl string) *task.Task {
+		tsk, err := task.Create(dbp, tmpl, "", task.CreateOptions{TTL: &ttl})
+		require.Nil(t, err)
+		tsk.SetState(state)
+		require.Nil(t, tsk.Update(dbp, false, true))
+		return tsk
+	}
+	expired := createTask(task.StateDone, "1ms")
+	kept := createTask(task.StateDone, "1h")
+	blocked := createTask(task.StateBlocked, "1ms")
+
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Nil(t, engine.GarbageCollector(ctx, "", ""))
+
+	timeout := time.After(5 * time.Second)
+	for deleted := false; !deleted; {
+		_, err := task.LoadFromID(dbp, expired.ID)
+		switch {
+		case errors.IsNotFound(err):
+			deleted = true
+		case err != nil:
+			t.Fatal(err)
+		default:
+			select {
+			case <-timeout:
+				t.Fatal("expired task not deleted")
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	// a task within its ttl is kept, as is a task which is not finished
+	_, err = task.LoadFromID(dbp, kept.ID)
+	assert.Nil(t, err)
+	_, err = task.LoadFromID(dbp, blocked.ID)
+	assert.Nil(t, err)
+}
+
 func TestResolveCallback(t *testing.T) {
 	res, err := createResolution("callback.yaml", map[string]interface{}{}, nil)
 	require.NoError(t, err)
@@ -1391,6 +1845,26 @@ func TestB64RawEncodeDecode(t *testing.T) {
 	assert.Equal(t, "raw message", output["b"])
 }
 
+func TestTags(t *testing.T) {
+	res, err := createResolution("tags.yaml", nil, nil)
+	require.NoError(t, err)
+
+	res, err = runResolution(res)
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, resolution.StateDone, res.State)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	tsk, err := task.LoadFromPublicID(dbp, res.TaskPublicID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"team":              "beta",
+		"previous_customer": "acme",
+	}, tsk.Tags)
+}
+
 func TestBatch(t *testing.T) {
 	dbp, err := zesty.NewDBProvider(utask.DBName)
 	require.Nil(t, err)
@@ -1492,3 +1966,147 @@ func TestBatch(t *testing.T) {
 	}
 	assert.Equal(t, resolution.StateDone, res.State)
 }
+
+func TestDryRun(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	res, err := createResolution("dryRun.yaml", nil, nil)
+	require.Nil(t, err)
+
+	report, err := engine.DryRun(dbp, res.PublicID)
+	require.Nil(t, err)
+
+	require.Len(t, report.Steps, 3)
+	assert.Equal(t, "stepOne", report.Steps[0].Name)
+	assert.True(t, report.Steps[0].Supported)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, report.Steps[0].Description.(map[string]interface{})["output"])
+
+	assert.Equal(t, "stepTwo", report.Steps[1].Name)
+	assert.False(t, report.Steps[1].Supported)
+	assert.Contains(t, report.Steps[1].Error, "not supported")
+
+	assert.Equal(t, "stepThree", report.Steps[2].Name)
+	assert.True(t, report.Steps[2].Supported)
+
+	assert.Equal(t, []string{"stepNotFound"}, report.PendingSteps)
+
+	// the resolution is left untouched
+	res, err = resolution.LoadFromPublicID(dbp, res.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateTODO, res.State)
+	for name, s := range res.Steps {
+		assert.Equal(t, step.StateTODO, s.State, name)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	res, err := createResolution("nextRetry.yaml", nil, nil)
+	require.Nil(t, err)
+	assert.Empty(t, res.Steps["stepOne"].IdempotencyKey)
+
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	assert.Equal(t, step.StateServerError, res.Steps["stepOne"].State)
+	key := res.Steps["stepOne"].IdempotencyKey
+	assert.NotEmpty(t, key)
+
+	// the retries of the step reuse its key
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	assert.Equal(t, 2, res.Steps["stepOne"].TryCount)
+	assert.Equal(t, key, res.Steps["stepOne"].IdempotencyKey)
+}
+
+func TestApproval(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	res, err := runTask("approval.yaml", nil, nil)
+	require.Nil(t, err)
+
+	assert.Equal(t, resolution.StateBlockedApproval, res.State)
+	assert.Equal(t, step.StateWaiting, res.Steps["approve"].State)
+	assert.Equal(t, step.StateTODO, res.Steps["stepTwo"].State)
+
+	tsk, err := task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+	assert.Equal(t, task.StateBlocked, tsk.State)
+
+	// a run doesn't get past the approval step
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateBlockedApproval, res.State)
+	assert.Equal(t, step.StateTODO, res.Steps["stepTwo"].State)
+}
+
+func TestHaltRunningResolution(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	res, err := createResolution("halt.yaml", nil, nil)
+	require.Nil(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := runResolution(res)
+		done <- err
+	}()
+
+	// the template is halted while its first step is running
+	require.Eventually(t, func() bool {
+		loaded, err := resolution.LoadFromPublicID(dbp, res.PublicID)
+		return err == nil && loaded.Steps["stepOne"].State == step.StateRunning
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Nil(t, resolution.RequestHalt(dbp, res.ID, resolution.StateCancelled))
+
+	// the running step ends, the following one isn't run
+	require.Nil(t, <-done)
+	res, err = resolution.LoadFromPublicID(dbp, res.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StateCancelled, res.State)
+	assert.Equal(t, step.StateDone, res.Steps["stepOne"].State)
+	assert.Equal(t, step.StateTODO, res.Steps["stepTwo"].State)
+
+	tsk, err := task.LoadFromID(dbp, res.TaskID)
+	require.Nil(t, err)
+	assert.Equal(t, task.StateCancelled, tsk.State)
+
+	halt, err := resolution.LoadHalt(dbp, res.ID)
+	require.Nil(t, err)
+	assert.Empty(t, halt, "the halt is removed once applied")
+}
+
+func TestHaltCrashedResolution(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.Nil(t, err)
+
+	// a resolution halted during a run which crashed
+	res, err := createResolution("stepCondition.yaml", map[string]interface{}{}, nil)
+	require.Nil(t, err)
+	res.SetState(resolution.StateCrashed)
+	require.Nil(t, updateResolution(res))
+	require.Nil(t, resolution.RequestHalt(dbp, res.ID, resolution.StatePaused))
+
+	// is halted instead of being run again
+	loaded, err := runResolution(res)
+	require.Nil(t, err)
+	assert.Nil(t, loaded)
+
+	res, err = resolution.LoadFromPublicID(dbp, res.PublicID)
+	require.Nil(t, err)
+	assert.Equal(t, resolution.StatePaused, res.State)
+	assert.Equal(t, 0, res.RunCount)
+
+	halt, err := resolution.LoadHalt(dbp, res.ID)
+	require.Nil(t, err)
+	assert.Empty(t, halt)
+
+	// and runs again once resumed
+	res.SetState(resolution.StateTODO)
+	require.Nil(t, updateResolution(res))
+	res, err = runResolution(res)
+	require.Nil(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, 1, res.RunCount)
+}
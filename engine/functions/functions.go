@@ -31,6 +31,8 @@ var (
 // in the configuration given with templated variables under {{ .functions_args.xxx }}
 type Function struct {
 	Name         string                 `json:"name"`
+	Version      string                 `json:"version,omitempty"`
+	Plugins      []string               `json:"plugins,omitempty"`
 	Action       executor.Executor      `json:"action"`
 	PreHook      *executor.Executor     `json:"pre_hook,omitempty"`
 	Conditions   []*condition.Condition `json:"conditions,omitempty"`
@@ -189,9 +191,47 @@ func LoadFromDir(directory string) error {
 		logrus.Infof("Imported function %q", function.Name)
 	}
 
+	// functions may wrap functions declared in other files, plugins are
+	// resolved once all the functions of the directory are known
+	for _, function := range functionsImported {
+		function.Plugins = function.wrappedPlugins(map[string]bool{})
+	}
+
 	return nil
 }
 
+// wrappedPlugins returns the sorted names of the plugins eventually run by the function,
+// going through the functions it wraps.
+func (f *Function) wrappedPlugins(visited map[string]bool) []string {
+	visited[f.Name] = true
+
+	types := []string{f.Action.Type}
+	if f.PreHook != nil {
+		types = append(types, f.PreHook.Type)
+	}
+
+	plugins := map[string]struct{}{}
+	for _, typ := range types {
+		if visited[typ] {
+			continue
+		}
+		if nested, exists := functionsImported[typ]; exists {
+			for _, p := range nested.wrappedPlugins(visited) {
+				plugins[p] = struct{}{}
+			}
+			continue
+		}
+		plugins[typ] = struct{}{}
+	}
+
+	result := make([]string, 0, len(plugins))
+	for p := range plugins {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result
+}
+
 // List returns the list of functions imported.
 func List() []string {
 	var result = []string{}
@@ -203,6 +243,48 @@ func List() []string {
 	return result
 }
 
+// ListFilter holds the criteria to filter and paginate the imported functions.
+type ListFilter struct {
+	NamePrefix *string
+	Plugin     *string
+	Last       *string
+	PageSize   uint64
+}
+
+// ListFunctions returns the imported functions sorted by name, optionally filtered on
+// a name prefix or on a plugin they wrap, starting after the Last name.
+func ListFunctions(filter ListFilter) []*Function {
+	var result = []*Function{}
+
+	for _, name := range List() {
+		if filter.PageSize > 0 && uint64(len(result)) >= filter.PageSize {
+			break
+		}
+		if filter.Last != nil && *filter.Last != "" && name <= *filter.Last {
+			continue
+		}
+		if filter.NamePrefix != nil && !strings.HasPrefix(name, *filter.NamePrefix) {
+			continue
+		}
+		function := functionsImported[name]
+		if filter.Plugin != nil && !function.wraps(*filter.Plugin) {
+			continue
+		}
+		result = append(result, function)
+	}
+
+	return result
+}
+
+func (f *Function) wraps(plugin string) bool {
+	for _, p := range f.Plugins {
+		if p == plugin {
+			return true
+		}
+	}
+	return false
+}
+
 // Get return the function identified by the name in parameter and whether it exists.
 func Get(name string) (*Function, bool) {
 	s, exists := functionsImported[name]
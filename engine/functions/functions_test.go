@@ -0,0 +1,43 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/maxatome/go-testdeep/td"
+)
+
+func TestListFunctions(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	require.CmpNoError(LoadFromDir("../functions_tests"))
+
+	f, exists := Get("echo::hello::nested1")
+	require.True(exists)
+	assert.Cmp(f.Plugins, []string{"echo"})
+
+	f, exists = Get("echo::hello::world")
+	require.True(exists)
+	assert.Cmp(f.Version, "1.0.0")
+
+	names := func(list []*Function) []string {
+		ret := []string{}
+		for _, f := range list {
+			ret = append(ret, f.Name)
+		}
+		return ret
+	}
+
+	prefix := "echo::hello::"
+	assert.Cmp(names(ListFunctions(ListFilter{NamePrefix: &prefix})),
+		[]string{"echo::hello::nested1", "echo::hello::nested2", "echo::hello::world"})
+
+	last := "echo::hello::nested1"
+	assert.Cmp(names(ListFunctions(ListFilter{NamePrefix: &prefix, Last: &last, PageSize: 1})),
+		[]string{"echo::hello::nested2"})
+
+	plugin := "echo"
+	assert.Len(ListFunctions(ListFilter{Plugin: &plugin}), len(List()))
+
+	plugin = "http"
+	assert.Empty(ListFunctions(ListFilter{Plugin: &plugin}))
+}
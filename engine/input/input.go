@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/juju/errors"
@@ -18,11 +19,17 @@ const (
 	InputTypeNumber   = "number"
 )
 
+// SealedPrefix starts the values of secret inputs, once encrypted on their own
+const SealedPrefix = "__SEALED__:"
+
 // Input represents a single input for a task
 // it can express constraints on the acceptable values,
 // such as a type (string by default), a regexp to be matched, an enumeration of legal values,
 // wether a collection of values is accepted instead of a single value,
 // and wether the input is altogether optional, which can be supported with a default value
+// a default value can be computed from the other inputs, through templating
+// the value of a secret input is sealed once the task is created: it is only
+// revealed to the steps of its resolution, and never shown through the API
 type Input struct {
 	Name        string        `json:"name"`
 	Description string        `json:"description"`
@@ -33,6 +40,13 @@ type Input struct {
 	Optional    bool          `json:"optional"`
 	Default     interface{}   `json:"default"`
 	Hidden      bool          `json:"hidden"`
+	Secret      bool          `json:"secret,omitempty"`
+}
+
+// IsSealed tells whether a value is the sealed value of a secret input
+func IsSealed(val interface{}) bool {
+	s, ok := val.(string)
+	return ok && strings.HasPrefix(s, SealedPrefix)
 }
 
 // Valid asserts that an input definition is valid
@@ -40,7 +54,7 @@ type Input struct {
 // - a regexp must compile
 // - the input's type must be among the accepted types defined above
 // - legal_values must match the declared type
-// - default value must match the declared type
+// - default value must match the declared type, unless it is computed
 func (i Input) Valid() error {
 	// check that input regex compiles
 	if i.Regex != nil {
@@ -68,6 +82,14 @@ func (i Input) Valid() error {
 		}
 	}
 
+	// a computed default is only known once rendered, when a task is created
+	if i.HasComputedDefault() {
+		if i.Collection {
+			return errors.BadRequestf("Invalid input '%s': a collection can't have a computed default", i.Name)
+		}
+		return nil
+	}
+
 	// check that default value matches the input type
 	if err := i.checkValueType(i.Default); err != nil {
 		return err
@@ -75,9 +97,34 @@ func (i Input) Valid() error {
 	return i.CheckValue(i.Default)
 }
 
+// HasComputedDefault tells if the default value of an input is a template to be rendered
+func (i Input) HasComputedDefault() bool {
+	s, ok := i.Default.(string)
+	return ok && strings.Contains(s, "{{")
+}
+
+// ValueFromString converts a rendered value to the type of the input
+func (i Input) ValueFromString(s string) (interface{}, error) {
+	switch i.Type {
+	case InputTypeBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.BadRequestf("Invalid value '%s': expected a boolean", i.Name)
+		}
+		return b, nil
+	case InputTypeNumber:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, errors.BadRequestf("Invalid value '%s': expected a number", i.Name)
+		}
+		return json.Number(s), nil
+	}
+	return s, nil
+}
+
 // CheckValue verifies an input's constraints against a concrete value
+// sealed values were checked before being sealed
 func (i Input) CheckValue(val interface{}) error {
-	if val != nil {
+	if val != nil && !IsSealed(val) {
 		if i.Collection {
 			col, ok := val.([]interface{})
 			if !ok {
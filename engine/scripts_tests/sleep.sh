@@ -0,0 +1,4 @@
+#!/bin/sh
+
+sleep "$1"
+echo "{\"slept\":\"$1\"}"
@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"github.com/cneill/utask"
+)
 
 type sleeper struct {
 	sleepCount int
@@ -22,3 +26,9 @@ func (s *sleeper) sleep() {
 func (s *sleeper) wakeup() {
 	s.sleepCount = 0
 }
+
+// collecting tells if the collectors may run on this tick:
+// they pause while the instance is in a maintenance mode refusing to run resolutions
+func collecting() bool {
+	return !utask.MaintenanceBlocks(utask.MaintenanceScopeExecute)
+}
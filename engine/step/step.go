@@ -11,7 +11,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/sirupsen/logrus"
 
 	"github.com/cneill/utask"
@@ -20,6 +23,7 @@ import (
 	"github.com/cneill/utask/engine/step/executor"
 	"github.com/cneill/utask/engine/values"
 	"github.com/cneill/utask/pkg/jsonschema"
+	"github.com/cneill/utask/pkg/now"
 	"github.com/cneill/utask/pkg/utils"
 )
 
@@ -53,12 +57,24 @@ const (
 	StateExpanded = "EXPANDED"
 )
 
+var (
+	activeSteps       = promauto.NewGauge(prometheus.GaugeOpts{Name: "utask_active_steps"})
+	activeStepsWeight = promauto.NewGauge(prometheus.GaugeOpts{Name: "utask_active_steps_weight"})
+	attemptsMetric    = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "utask_step_attempts",
+		Help: "Number of attempts at the actions of the steps, by action type, with the ID of the latest attempt as exemplar",
+	}, []string{"action_type"})
+)
+
 const (
 	stepRefThis = utask.This
 
 	defaultMaxRetries = 10000
 
 	maxExecutionDelay = time.Duration(20) * time.Second
+
+	// maxAttempts is the number of attempts kept in the history of a step
+	maxAttempts = 20
 )
 
 var (
@@ -98,6 +114,10 @@ type Step struct {
 	Children       []interface{}           `json:"children,omitempty"`
 	Error          string                  `json:"error,omitempty"`
 	State          string                  `json:"state,omitempty"`
+	// outputs larger than SpillOutputBytes are kept in the step output store, out of the DB,
+	// and loaded back with the resolution (default: the limit of the step output store)
+	SpillOutputBytes int        `json:"spill_output_bytes,omitempty"`
+	OutputRef        *OutputRef `json:"output_ref,omitempty"`
 	// hints about ETA latency, async, for retrier to define strategy
 	// how often VS how many times
 	RetryPattern   string        `json:"retry_pattern,omitempty"` // seconds, minutes, hours
@@ -105,6 +125,14 @@ type Step struct {
 	MaxRetries     int           `json:"max_retries,omitempty"`
 	LastRun        time.Time     `json:"last_run,omitempty"`
 	ExecutionDelay time.Duration `json:"execution_delay,omitempty"`
+	WaitUntil      *time.Time    `json:"wait_until,omitempty"` // deadline of a waiting step, when the resolution should be run again
+	// timeline of the executions
+	StartedAt      *time.Time    `json:"started_at,omitempty"` // start of the first execution
+	EndedAt        *time.Time    `json:"ended_at,omitempty"`   // end of the last execution
+	Duration       time.Duration `json:"duration,omitempty"`   // time spent executing, all attempts included
+	executionStart time.Time
+	// latest attempts at the action, the last one being the current or latest execution
+	Attempts []*Attempt `json:"attempts,omitempty"`
 
 	// flow control
 	Dependencies []string               `json:"dependencies,omitempty"`
@@ -112,15 +140,210 @@ type Step struct {
 	Conditions   []*condition.Condition `json:"conditions,omitempty"`
 	skipped      bool
 	// loop
-	ForEach         string          `json:"foreach,omitempty"` // "parent" step: expression for list of items
-	ForEachStrategy string          `json:"foreach_strategy"`
-	ChildrenSteps   []string        `json:"children_steps,omitempty"` // list of children names
-	ChildrenStepMap map[string]bool `json:"children_steps_map,omitempty"`
-	Item            interface{}     `json:"item,omitempty"` // "child" step: item value, issued from foreach
+	ForEach         string            `json:"foreach,omitempty"` // "parent" step: expression for list (or object) of items
+	ForEachStrategy string            `json:"foreach_strategy"`
+	ChildrenSteps   []string          `json:"children_steps,omitempty"` // list of children names
+	ChildrenStepMap map[string]bool   `json:"children_steps_map,omitempty"`
+	Item            interface{}       `json:"item,omitempty"`      // "child" step: item value, issued from foreach
+	Iteration       *values.Iteration `json:"iteration,omitempty"` // "child" step: position of the item in the collection
+
+	// last progress reported by the plugin of a running step
+	Progress         *Progress `json:"progress,omitempty"`
+	progressReporter func(*Progress)
 
 	Resources []string `json:"resources"` // resource limits to enforce
 
 	Tags map[string]string `json:"tags"`
+
+	// IdempotencyKey is generated before the first run of the step, and reused by its
+	// retries: plugins supporting it pass it to the downstream system to avoid duplicate side effects
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// InputOverride replaces the templated configuration of the action on the next runs of the step
+	InputOverride *InputOverride `json:"input_override,omitempty"`
+
+	// Notify sends a notification when the step reaches some states, on top of the task_step_update ones
+	Notify *Notify `json:"notify,omitempty"`
+}
+
+// InputOverride is a configuration of the action of a step, set by an admin to fix a bad
+// computed input: it is used as is, its templates are not evaluated
+type InputOverride struct {
+	Configuration json.RawMessage `json:"configuration"`
+	Author        string          `json:"author"`
+	Created       time.Time       `json:"created"`
+}
+
+// OutputRef locates the output of a step kept in the step output store, when larger than its limit
+type OutputRef struct {
+	Name string `json:"name"`
+	Size int    `json:"size"` // size of the JSON encoded output
+}
+
+// Notify describes the notification sent when a step reaches one of the given states
+type Notify struct {
+	On       []string `json:"on,omitempty"`       // states sending the notification, default: FATAL_ERROR, CLIENT_ERROR and CRASHED
+	Backends []string `json:"backends,omitempty"` // notification backends, default: the ones of the task_step_notification action
+}
+
+// defaultNotifyStates are the states of a step sending its notification when none is given:
+// the failures blocking the resolution
+var defaultNotifyStates = []string{StateFatalError, StateClientError, StateCrashed}
+
+// Matches tells if a step reaching the given state sends the notification
+func (n *Notify) Matches(state string) bool {
+	if len(n.On) == 0 {
+		return utils.ListContainsString(defaultNotifyStates, state)
+	}
+	return utils.ListContainsString(n.On, state)
+}
+
+// valid checks that the notification is sent on states the step can reach
+func (n *Notify) valid(customStates []string) error {
+	for _, state := range n.On {
+		switch state {
+		case StateAny, StateTODO, StateRunning, StateExpanded:
+			return errors.NewNotValid(nil, fmt.Sprintf("notify: a step can't be notified on state %q", state))
+		}
+		if !utils.ListContainsString(builtinStates, state) && !utils.ListContainsString(customStates, state) {
+			return errors.NewNotValid(nil, fmt.Sprintf("notify: unknown step state %q", state))
+		}
+	}
+	if utils.HasDupsArray(n.On) {
+		return errors.NewNotValid(nil, "notify: duplicated state")
+	}
+	return nil
+}
+
+// Attempt is an execution of the action of a step: its ID follows the execution
+// through the logs and metrics, across the retries and the instances running them
+type Attempt struct {
+	ID         string     `json:"id"`
+	InstanceID uint64     `json:"instance_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	State      string     `json:"state,omitempty"`
+}
+
+// Progress is reported by the plugin of a running step, to give feedback on a long action
+type Progress struct {
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetProgressReporter defines the function receiving the progress reported by the plugin of the step
+func (st *Step) SetProgressReporter(reporter func(*Progress)) {
+	st.progressReporter = reporter
+}
+
+func (st *Step) reportProgress(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	st.progressReporter(&Progress{
+		Percent:   percent,
+		Message:   values.RedactString(message),
+		UpdatedAt: time.Now(),
+	})
+}
+
+func (st *Step) startExecution() {
+	now := time.Now()
+	st.executionStart = now
+	if st.StartedAt == nil {
+		st.StartedAt = &now
+	}
+
+	st.Attempts = append(st.Attempts, &Attempt{
+		ID:         uuid.Must(uuid.NewV4()).String(),
+		InstanceID: utask.InstanceID,
+		StartedAt:  now,
+	})
+	if len(st.Attempts) > maxAttempts {
+		st.Attempts = st.Attempts[len(st.Attempts)-maxAttempts:]
+	}
+	attemptsMetric.WithLabelValues(st.Action.Type).(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{"attempt_id": st.AttemptID()})
+}
+
+// AttemptID returns the ID of the current or latest attempt at the action of the step,
+// empty if it never ran
+func (st *Step) AttemptID() string {
+	if len(st.Attempts) == 0 {
+		return ""
+	}
+	return st.Attempts[len(st.Attempts)-1].ID
+}
+
+// EndExecution records the end of the execution in progress, if the step actually ran
+func (st *Step) EndExecution(end time.Time) {
+	if st.executionStart.IsZero() {
+		return
+	}
+	st.EndedAt = &end
+	st.Duration += end.Sub(st.executionStart)
+	st.executionStart = time.Time{}
+	if len(st.Attempts) > 0 {
+		attempt := st.Attempts[len(st.Attempts)-1]
+		attempt.EndedAt = &end
+		attempt.State = st.State
+	}
+}
+
+// Reset brings the step back to its state before its first execution, to be run again:
+// its results, retries, timeline and attempts are discarded, along with its idempotency key,
+// the new run being a new attempt at its action
+func (st *Step) Reset() {
+	st.State = StateTODO
+	st.Output = nil
+	st.Metadata = nil
+	st.Children = nil
+	st.Error = ""
+	st.TryCount = 0
+	st.LastRun = time.Time{}
+	st.WaitUntil = nil
+	st.StartedAt = nil
+	st.EndedAt = nil
+	st.Duration = 0
+	st.executionStart = time.Time{}
+	st.Attempts = nil
+	st.Progress = nil
+	st.IdempotencyKey = ""
+}
+
+// SetInputOverride validates a configuration of the action of the step, to be used instead of its
+// templated configuration from its next run. A nil configuration removes the override.
+func (st *Step) SetInputOverride(baseConfigs map[string]json.RawMessage, configuration json.RawMessage, author string) error {
+	if configuration == nil {
+		st.InputOverride = nil
+		return nil
+	}
+	if st.ForEach != "" {
+		return errors.BadRequestf("Can't override the input of the foreach step %q, override the input of its children instead", st.Name)
+	}
+
+	action := st.Action
+	action.Configuration = configuration
+	if _, err := validExecutor(baseConfigs, action, st.PreHook); err != nil {
+		return errors.NewNotValid(err, "Invalid input override")
+	}
+
+	st.InputOverride = &InputOverride{
+		Configuration: configuration,
+		Author:        author,
+		Created:       now.Get(),
+	}
+	return nil
+}
+
+// inputOverride returns the configuration overriding the templated configuration of the action, if any
+func (st *Step) inputOverride() json.RawMessage {
+	if st.InputOverride == nil {
+		return nil
+	}
+	return st.InputOverride.Configuration
 }
 
 // Context provides a step with extra metadata about the task
@@ -158,6 +381,8 @@ type execution struct {
 	runner      Runner
 	ctx         interface{}
 	shutdownCtx context.Context
+	// idempotencyKey is only set for the action of the step, not its pre-hook
+	idempotencyKey string
 }
 
 func (e *execution) generateOutput(st *Step, v *values.Values) error {
@@ -189,7 +414,7 @@ func (e *execution) generateOutput(st *Step, v *values.Values) error {
 			}
 
 			v.SetOutput(st.Name, st.Output)
-			st.Output, err = rawResolveObject(v, jsonOutput, st.Item, st.Name)
+			st.Output, err = rawResolveObject(v, jsonOutput, st.iterator(), st.Name)
 			if err != nil {
 				return err
 			}
@@ -198,11 +423,16 @@ func (e *execution) generateOutput(st *Step, v *values.Values) error {
 	return nil
 }
 
-func (st *Step) generateExecution(action executor.Executor, baseConfig map[string]json.RawMessage, values *values.Values, shutdownCtx context.Context) (*execution, error) {
+// generateExecution templates the configuration of an action, unless an override of its
+// configuration is provided: the override is used as is
+func (st *Step) generateExecution(action executor.Executor, override json.RawMessage, baseConfig map[string]json.RawMessage, values *values.Values, shutdownCtx context.Context) (*execution, error) {
 	var ret = execution{
 		config:      action.Configuration,
 		shutdownCtx: shutdownCtx,
 	}
+	if override != nil {
+		ret.config = override
+	}
 	var err error
 
 	if action.BaseConfiguration != "" {
@@ -211,7 +441,7 @@ func (st *Step) generateExecution(action executor.Executor, baseConfig map[strin
 			return nil, fmt.Errorf("could not find base configuration '%s'", action.BaseConfiguration)
 		}
 
-		resolvedBase, err := resolveObject(values, base, st.Item, st.Name)
+		resolvedBase, err := resolveObject(values, base, st.iterator(), st.Name)
 		if err != nil {
 			return nil, errors.Annotate(err, "failed to template base configuration")
 		}
@@ -234,7 +464,7 @@ func (st *Step) generateExecution(action executor.Executor, baseConfig map[strin
 					}
 				}
 
-				output, err := rawResolveObject(values, content, st.Item, st.Name)
+				output, err := rawResolveObject(values, content, st.iterator(), st.Name)
 				if err != nil {
 					return nil, errors.Annotate(err, "failed to template base output")
 				}
@@ -255,10 +485,14 @@ func (st *Step) generateExecution(action executor.Executor, baseConfig map[strin
 			}
 		}
 
-		ret.config, err = resolveObject(values, ret.config, st.Item, st.Name)
-		if err != nil {
-			return nil, errors.Annotate(err, "failed to template configuration")
+		if override == nil {
+			ret.config, err = resolveObject(values, ret.config, st.iterator(), st.Name)
+			if err != nil {
+				return nil, errors.Annotate(err, "failed to template configuration")
+			}
 		}
+		// the configuration of the functions called is templated from the override
+		override = nil
 
 		ret.runner, err = getRunner(action.Type)
 		if err != nil {
@@ -286,7 +520,7 @@ func (st *Step) generateExecution(action executor.Executor, baseConfig map[strin
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal context: %s", err)
 		}
-		ctxTmpl, err := values.Apply(string(ctxMarshal), st.Item, st.Name)
+		ctxTmpl, err := values.Apply(string(ctxMarshal), st.iterator(), st.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to template context: %s", err)
 		}
@@ -311,6 +545,22 @@ func (st *Step) execute(execution *execution, callback func(interface{}, interfa
 
 	resources := append(execution.runner.Resources(execution.baseCfgRaw, execution.config), st.Resources...)
 	limits := uniqueSortedList(resources)
+
+	// heavy steps take several slots of the instance's step pool
+	weight := utask.StepWeight(limits)
+	if acquiredErr := utask.AcquireStepSlots(execution.shutdownCtx, weight); acquiredErr != nil {
+		callback(`{}`, "", map[string]string{}, errors.NotProvisionedf("failed to acquire step slots"))
+		return
+	}
+	defer utask.ReleaseStepSlots(weight)
+
+	activeSteps.Inc()
+	activeStepsWeight.Add(float64(weight))
+	defer func() {
+		activeSteps.Dec()
+		activeStepsWeight.Sub(float64(weight))
+	}()
+
 	if acquiredErr := utask.AcquireResources(execution.shutdownCtx, limits); acquiredErr != nil {
 		// if resource acquisition takes too long (timeout or shutdown), let's put the step in ToRetry state
 		// to release the Execution pool, or let the instance shutdowns correctly, as the step execution didn't started yet
@@ -319,7 +569,18 @@ func (st *Step) execute(execution *execution, callback func(interface{}, interfa
 	}
 	defer utask.ReleaseResources(limits)
 
-	output, metadata, tags, err := execution.runner.Exec(st.Name, execution.baseCfgRaw, execution.config, execution.ctx)
+	var output, metadata interface{}
+	var tags map[string]string
+	var err error
+	if optionsRunner, ok := execution.runner.(OptionsRunner); ok {
+		var report func(int, string)
+		if st.progressReporter != nil {
+			report = st.reportProgress
+		}
+		output, metadata, tags, err = optionsRunner.ExecWithOptions(st.Name, execution.baseCfgRaw, execution.config, execution.ctx, execution.idempotencyKey, report)
+	} else {
+		output, metadata, tags, err = execution.runner.Exec(st.Name, execution.baseCfgRaw, execution.config, execution.ctx)
+	}
 	callback(output, metadata, tags, err)
 }
 
@@ -353,6 +614,8 @@ func Run(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Val
 		return
 	}
 
+	st.startExecution()
+
 	prehook, err := st.GetPreHook()
 	if err != nil {
 		st.State = StateFatalError
@@ -372,7 +635,7 @@ func Run(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Val
 	var prehookFailed bool
 	var preHookWg sync.WaitGroup
 	if prehook != nil {
-		preHookExecution, err := st.generateExecution(*prehook, baseConfig, stepValues, shutdownCtx)
+		preHookExecution, err := st.generateExecution(*prehook, nil, baseConfig, stepValues, shutdownCtx)
 		if err != nil {
 			st.State = StateFatalError
 			st.Error = fmt.Sprintf("prehook: %s", err)
@@ -423,16 +686,18 @@ func Run(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Val
 		}
 
 		// Generate the execution
-		execution, err := st.generateExecution(st.Action, baseConfig, preHookValues, shutdownCtx)
+		execution, err := st.generateExecution(st.Action, st.inputOverride(), baseConfig, preHookValues, shutdownCtx)
 		if err != nil {
 			st.State = StateFatalError
 			st.Error = err.Error()
 			go noopStep(st, stepChan)
 			return
 		}
+		execution.idempotencyKey = st.IdempotencyKey
 
 		st.execute(execution, func(output interface{}, metadata interface{}, tags map[string]string, err error) {
 			st.Output, st.Metadata, st.Tags = output, metadata, tags
+			st.WaitUntil = nil
 
 			outputErr := execution.generateOutput(st, preHookValues)
 			if outputErr != nil {
@@ -444,6 +709,10 @@ func Run(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Val
 						st.State = StateClientError
 					} else if errors.IsNotAssigned(err) {
 						st.State = StateWaiting
+						if w, ok := metadata.(waiter); ok {
+							deadline := w.WaitDeadline()
+							st.WaitUntil = &deadline
+						}
 					} else if errors.IsNotProvisioned(err) {
 						st.State = StateToRetry
 					} else {
@@ -475,6 +744,38 @@ func Run(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Val
 	}()
 }
 
+// DryRun describes the action of a Step, and the action of its pre-hook if any,
+// as they would be performed with the provided values, without any side effect.
+// A NotSupported error is returned when the runner of an action doesn't implement dry-runs
+func DryRun(st *Step, baseConfig map[string]json.RawMessage, stepValues *values.Values) (preHook interface{}, action interface{}, err error) {
+	if st.PreHook != nil {
+		preHook, err = st.dryRunAction(*st.PreHook, nil, baseConfig, stepValues)
+		if err != nil {
+			return nil, nil, errors.Annotate(err, "pre_hook")
+		}
+	}
+	action, err = st.dryRunAction(st.Action, st.inputOverride(), baseConfig, stepValues)
+	return preHook, action, err
+}
+
+func (st *Step) dryRunAction(action executor.Executor, override json.RawMessage, baseConfig map[string]json.RawMessage, stepValues *values.Values) (interface{}, error) {
+	execution, err := st.generateExecution(action, override, baseConfig, stepValues, context.Background())
+	if err != nil {
+		return nil, err
+	}
+	dryRunner, ok := execution.runner.(DryRunner)
+	if !ok {
+		return nil, errors.NotSupportedf("dry-run by action type %q", action.Type)
+	}
+	return dryRunner.DryRun(st.Name, execution.baseCfgRaw, execution.config, execution.ctx)
+}
+
+// waiter is implemented by the metadata of an action waiting for an external event,
+// which stops waiting at a given deadline
+type waiter interface {
+	WaitDeadline() time.Time
+}
+
 // StateSetter is a handle to apply the effects of a condition evaluation
 type StateSetter func(step, state, message string)
 
@@ -495,7 +796,7 @@ func PreRun(st *Step, values *values.Values, ss StateSetter, executedSteps map[s
 			continue
 		}
 
-		if err := sc.Eval(values, st.Item, st.Name); err != nil {
+		if err := sc.Eval(values, st.iterator(), st.Name); err != nil {
 			if _, ok := err.(condition.ErrConditionNotMet); ok {
 				logrus.Debugf("PreRun: Step [%s] condition eval: %s", st.Name, err)
 				continue
@@ -548,7 +849,7 @@ func AfterRun(st *Step, values *values.Values, ss StateSetter) {
 		if sc.Type != condition.CHECK {
 			continue
 		}
-		if err := sc.Eval(values, st.Item, st.Name); err != nil {
+		if err := sc.Eval(values, st.iterator(), st.Name); err != nil {
 			if _, ok := err.(condition.ErrConditionNotMet); ok {
 				logrus.Debugf("AfterRun: Step [%s] condition eval: %s", st.Name, err)
 				continue
@@ -643,6 +944,16 @@ func (st *Step) ValidAndNormalize(name string, baseConfigs map[string]json.RawMe
 		}
 	}
 
+	if st.SpillOutputBytes < 0 {
+		return errors.NewNotValid(nil, "spill_output_bytes can't be negative")
+	}
+
+	if st.Notify != nil {
+		if err := st.Notify.valid(st.CustomStates); err != nil {
+			return err
+		}
+	}
+
 	// valid step conditions
 	for _, sc := range st.Conditions {
 		if st.ForEach != "" && sc.Type == condition.SKIP && sc.ForEach == "" {
@@ -721,6 +1032,10 @@ func (st *Step) ValidAndNormalizeNewStep() error {
 		return errors.NewNotValid(nil, "step output must not be set")
 	}
 
+	if st.OutputRef != nil {
+		return errors.NewNotValid(nil, "step output_ref must not be set")
+	}
+
 	if st.Metadata != nil {
 		return errors.NewNotValid(nil, "step metadatas must not be set")
 	}
@@ -746,10 +1061,26 @@ func (st *Step) ValidAndNormalizeNewStep() error {
 		return errors.NewNotValid(nil, "step last_time must not be set")
 	}
 
+	if st.StartedAt != nil || st.EndedAt != nil || st.Duration != 0 {
+		return errors.NewNotValid(nil, "step started_at, ended_at and duration must not be set")
+	}
+
 	if st.Item != nil {
 		return errors.NewNotValid(nil, "step item must not be set")
 	}
 
+	if st.Iteration != nil {
+		return errors.NewNotValid(nil, "step iteration must not be set")
+	}
+
+	if st.Progress != nil {
+		return errors.NewNotValid(nil, "step progress must not be set")
+	}
+
+	if st.InputOverride != nil {
+		return errors.NewNotValid(nil, "step input_override must not be set")
+	}
+
 	return nil
 }
 
@@ -770,7 +1101,29 @@ func (st *Step) IsFinal() bool {
 
 // IsChild asserts that Step was spawned by a foreach step
 func (st *Step) IsChild() bool {
-	return st.Item != nil
+	return st.Item != nil || st.Iteration != nil
+}
+
+// iterator returns the item of a "child" step, along with its iteration when known
+func (st *Step) iterator() interface{} {
+	if st.Iteration == nil {
+		return st.Item
+	}
+	return &values.Iterator{Item: st.Item, Iteration: st.Iteration}
+}
+
+// RedactSecrets replaces the secrets of its resolution and of the configuration in the step's results,
+// before they are displayed: the step keeps its actual results for the following steps
+func (st *Step) RedactSecrets(scope *values.SecretScope) {
+	st.Output = scope.Redact(st.Output)
+	st.Metadata = scope.Redact(st.Metadata)
+	if st.Children != nil {
+		st.Children = scope.Redact(st.Children).([]interface{})
+	}
+	st.Error = scope.RedactString(st.Error)
+	if st.Tags != nil {
+		st.Tags = scope.Redact(st.Tags).(map[string]string)
+	}
 }
 
 // ExecutorMetadata returns the step's runner metadata schema
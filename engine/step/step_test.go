@@ -0,0 +1,241 @@
+package step
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxatome/go-testdeep/td"
+
+	"github.com/cneill/utask/engine/step/executor"
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/now"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+func TestExecuteWithProgress(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	values.RegisterSecret("progress-secret-test")
+	plugin := taskplugin.New("progress", "0.1",
+		func(string, interface{}, interface{}) (interface{}, interface{}, error) {
+			return "no progress", nil, nil
+		},
+		taskplugin.WithProgress(func(stepName string, config interface{}, ctx interface{}, report taskplugin.ProgressFunc) (interface{}, interface{}, error) {
+			report(-5, "starting")
+			report(50, "waiting for progress-secret-test")
+			report(150, "done")
+			return "progress", nil, nil
+		}),
+	)
+	exec := &execution{
+		config:      json.RawMessage(`{}`),
+		runner:      plugin,
+		shutdownCtx: context.Background(),
+	}
+
+	var reported []*Progress
+	st := &Step{Name: "slow"}
+	st.SetProgressReporter(func(p *Progress) {
+		reported = append(reported, p)
+	})
+
+	var output interface{}
+	st.execute(exec, func(o interface{}, _ interface{}, _ map[string]string, err error) {
+		require.Nil(err)
+		output = o
+	})
+	assert.Cmp(output, "progress")
+	require.Len(reported, 3)
+	assert.Cmp(reported[0], td.Struct(&Progress{Percent: 0, Message: "starting"}, td.StructFields{"UpdatedAt": td.NotZero()}))
+	assert.Cmp(reported[1].Percent, 50)
+	assert.Cmp(reported[1].Message, "waiting for ***")
+	assert.Cmp(reported[2].Percent, 100)
+
+	// without any reporter, the progress is discarded
+	st = &Step{Name: "quiet"}
+	st.execute(exec, func(o interface{}, _ interface{}, _ map[string]string, err error) {
+		require.Nil(err)
+		output = o
+	})
+	assert.Cmp(output, "progress")
+}
+
+func TestExecuteWithOptions(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	plugin := taskplugin.New("extended", "0.1",
+		func(string, interface{}, interface{}) (interface{}, interface{}, error) {
+			return "no options", nil, nil
+		},
+		taskplugin.WithExtendedExec(func(stepName string, config interface{}, ctx interface{}, opts taskplugin.ExecOptions) (interface{}, interface{}, error) {
+			opts.Report(50, "calling")
+			return opts.IdempotencyKey, nil, nil
+		}),
+	)
+	exec := &execution{
+		config:         json.RawMessage(`{}`),
+		runner:         plugin,
+		shutdownCtx:    context.Background(),
+		idempotencyKey: "my-key",
+	}
+
+	var reported []*Progress
+	st := &Step{Name: "extended"}
+	st.SetProgressReporter(func(p *Progress) {
+		reported = append(reported, p)
+	})
+
+	var output interface{}
+	st.execute(exec, func(o interface{}, _ interface{}, _ map[string]string, err error) {
+		require.Nil(err)
+		output = o
+	})
+	assert.Cmp(output, "my-key")
+	require.Len(reported, 1)
+	assert.Cmp(reported[0].Message, "calling")
+
+	// a plugin can't declare several exec functions
+	assert.CmpPanic(func() {
+		taskplugin.New("conflicting", "0.1",
+			func(string, interface{}, interface{}) (interface{}, interface{}, error) { return nil, nil, nil },
+			taskplugin.WithIdempotencyKey(func(string, interface{}, interface{}, string) (interface{}, interface{}, error) { return nil, nil, nil }),
+			taskplugin.WithProgress(func(string, interface{}, interface{}, taskplugin.ProgressFunc) (interface{}, interface{}, error) {
+				return nil, nil, nil
+			}),
+		)
+	}, td.Contains("conflicting exec functions"))
+}
+
+func TestExecutionTimeline(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	plugin := taskplugin.New("timeline", "0.1",
+		func(string, interface{}, interface{}) (interface{}, interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return "done", nil, nil
+		},
+	)
+	require.CmpNoError(RegisterRunner("timeline", plugin))
+
+	st := &Step{Name: "timed", Action: executor.Executor{Type: "timeline", Configuration: json.RawMessage(`{}`)}}
+	stepChan := make(chan *Step)
+	var wg sync.WaitGroup
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		st.State = StateRunning
+		Run(st, nil, values.NewValues(), stepChan, &wg, context.Background())
+		st = <-stepChan
+		st.EndExecution(time.Now())
+
+		assert.Cmp(st.State, StateDone)
+		assert.Cmp(st.TryCount, attempt)
+		require.NotNil(st.StartedAt)
+		require.NotNil(st.EndedAt)
+		assert.Gte(st.Duration, time.Duration(attempt)*10*time.Millisecond)
+		assert.Lte(st.Duration, st.EndedAt.Sub(*st.StartedAt))
+
+		require.Len(st.Attempts, attempt)
+		last := st.Attempts[attempt-1]
+		assert.Cmp(st.AttemptID(), last.ID)
+		assert.NotEmpty(last.ID)
+		assert.Cmp(last.State, StateDone)
+		assert.Cmp(last.EndedAt, st.EndedAt)
+	}
+	wg.Wait()
+	assert.Not(st.Attempts[0].ID, st.Attempts[1].ID)
+
+	// a step which did not run is left untouched
+	ended := *st.EndedAt
+	st.EndExecution(time.Now())
+	assert.Cmp(*st.EndedAt, ended)
+
+	// a reset step starts over
+	st.Reset()
+	assert.Cmp(st, td.Struct(&Step{Name: "timed", State: StateTODO}, td.StructFields{
+		"Action": td.Ignore(),
+	}))
+}
+
+type overrideConfig struct {
+	Value string `json:"value"`
+}
+
+func TestInputOverride(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	plugin := taskplugin.New("override", "0.1",
+		func(_ string, config interface{}, _ interface{}) (interface{}, interface{}, error) {
+			return config.(*overrideConfig).Value, nil, nil
+		},
+		taskplugin.WithConfig(func(config interface{}) error {
+			if config.(*overrideConfig).Value == "" {
+				return errors.New("missing value")
+			}
+			return nil
+		}, overrideConfig{}),
+	)
+	require.CmpNoError(RegisterRunner("override", plugin))
+
+	v := values.NewValues()
+	v.SetInput(map[string]interface{}{"value": "computed"})
+
+	st := &Step{Name: "fixed", Action: executor.Executor{Type: "override", Configuration: json.RawMessage(`{"value":"{{.input.value}}"}`)}}
+	stepChan := make(chan *Step)
+	var wg sync.WaitGroup
+	run := func() interface{} {
+		st.State = StateRunning
+		Run(st, nil, v, stepChan, &wg, context.Background())
+		st = <-stepChan
+		assert.Cmp(st.State, StateDone)
+		return st.Output
+	}
+
+	assert.Cmp(run(), "computed")
+
+	// an override must be valid for the action
+	assert.CmpError(st.SetInputOverride(nil, json.RawMessage(`{"value":""}`), "admin"))
+	assert.Nil(st.InputOverride)
+
+	// the override is used as is, without being templated
+	// its creation date is synchronized between the instances
+	before := now.Get()
+	require.CmpNoError(st.SetInputOverride(nil, json.RawMessage(`{"value":"{{.input.value}} fixed"}`), "admin"))
+	assert.Cmp(st.InputOverride, td.Struct(&InputOverride{Author: "admin"}, td.StructFields{
+		"Configuration": td.JSON(`{"value":"{{.input.value}} fixed"}`),
+		"Created":       td.Between(before, now.Get()),
+	}))
+	assert.Cmp(run(), "{{.input.value}} fixed")
+
+	// without any override, the configuration is templated again
+	require.CmpNoError(st.SetInputOverride(nil, nil, "admin"))
+	assert.Nil(st.InputOverride)
+	assert.Cmp(run(), "computed")
+	wg.Wait()
+
+	// foreach steps don't run their action themselves
+	st.ForEach = "{{.input.list}}"
+	assert.CmpError(st.SetInputOverride(nil, json.RawMessage(`{"value":"fixed"}`), "admin"))
+}
+
+func TestNotify(t *testing.T) {
+	assert := td.Assert(t)
+
+	n := &Notify{}
+	assert.True(n.Matches(StateFatalError))
+	assert.True(n.Matches(StateClientError))
+	assert.False(n.Matches(StateDone))
+	assert.CmpNoError(n.valid(nil))
+
+	n = &Notify{On: []string{StateDone, "NOT_FOUND"}}
+	assert.True(n.Matches("NOT_FOUND"))
+	assert.False(n.Matches(StateFatalError))
+	assert.CmpNoError(n.valid([]string{"NOT_FOUND"}))
+	assert.CmpError(n.valid(nil))
+
+	assert.CmpError((&Notify{On: []string{StateAny}}).valid(nil))
+	assert.CmpError((&Notify{On: []string{StateDone, StateDone}}).valid(nil))
+}
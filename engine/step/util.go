@@ -16,6 +16,18 @@ type Runner interface {
 	MetadataSchema() json.RawMessage
 }
 
+// DryRunner is implemented by the runners able to describe the action
+// they would perform, without any side effect
+type DryRunner interface {
+	DryRun(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}) (interface{}, error)
+}
+
+// OptionsRunner is implemented by the runners able to pass the idempotency key
+// of a step to the downstream system, and to report the progress of their action while it runs
+type OptionsRunner interface {
+	ExecWithOptions(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}, idempotencyKey string, report func(int, string)) (interface{}, interface{}, map[string]string, error)
+}
+
 var (
 	runners     = map[string]Runner{}
 	runnerslock sync.RWMutex
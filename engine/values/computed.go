@@ -0,0 +1,126 @@
+package values
+
+import (
+	"fmt"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// computedCache holds the computed values of a resolution,
+// shared by the clones of its Values handed to the steps
+type computedCache struct {
+	sync.RWMutex
+	values map[string]interface{}
+}
+
+func (c *computedCache) get(name string) (interface{}, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	val, ok := c.values[name]
+	return val, ok
+}
+
+func (c *computedCache) set(name string, val interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[name] = val
+}
+
+// computing holds the names of the computed values being evaluated,
+// to detect a value depending on itself
+type computing map[string]bool
+
+// resolveComputed evaluates the template variables referenced as .computed.[NAME] by a template,
+// each of them only once during the lifetime of the Values: the following references hit the cache
+func (v *Values) resolveComputed(tmpl *template.Template) error {
+	names := map[string]struct{}{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			computedRefs(t.Tree.Root, names)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	exposed := make(map[string]interface{}, len(names))
+	for name := range names {
+		val, err := v.computed(name)
+		if err != nil {
+			return err
+		}
+		exposed[name] = val
+	}
+	v.m[ComputedKey] = exposed
+	return nil
+}
+
+// computed returns the cached value of a variable, evaluating it on its first use
+func (v *Values) computed(name string) (interface{}, error) {
+	if val, ok := v.computedCache.get(name); ok {
+		return val, nil
+	}
+
+	vars, _ := v.m[VarKey].(map[string]*Variable)
+	if _, ok := vars[name]; !ok {
+		return nil, fmt.Errorf("computed value %q: no such variable in template", name)
+	}
+	if v.computing[name] {
+		return nil, fmt.Errorf("computed value %q depends on itself", name)
+	}
+	v.computing[name] = true
+	defer delete(v.computing, name)
+
+	val, err := v.varEval(name)
+	if err != nil {
+		return nil, fmt.Errorf("computed value %q: %s", name, err)
+	}
+	v.computedCache.set(name, val)
+	return val, nil
+}
+
+// computedRefs collects the names referenced as .computed.[NAME] within a template
+func computedRefs(node parse.Node, names map[string]struct{}) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			computedRefs(c, names)
+		}
+	case *parse.ActionNode:
+		computedRefs(n.Pipe, names)
+	case *parse.IfNode:
+		computedRefsBranch(&n.BranchNode, names)
+	case *parse.RangeNode:
+		computedRefsBranch(&n.BranchNode, names)
+	case *parse.WithNode:
+		computedRefsBranch(&n.BranchNode, names)
+	case *parse.TemplateNode:
+		computedRefs(n.Pipe, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			computedRefs(c, names)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			computedRefs(a, names)
+		}
+	case *parse.ChainNode:
+		computedRefs(n.Node, names)
+	case *parse.FieldNode:
+		if len(n.Ident) >= 2 && n.Ident[0] == ComputedKey {
+			names[n.Ident[1]] = struct{}{}
+		}
+	}
+}
+
+func computedRefsBranch(n *parse.BranchNode, names map[string]struct{}) {
+	computedRefs(n.Pipe, names)
+	computedRefs(n.List, names)
+	computedRefs(n.ElseList, names)
+}
@@ -0,0 +1,78 @@
+package values
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// publicConfigItems lists the configuration items readable through the configstore function
+// any other item is reached through the secret function, which redacts its value
+var publicConfigItems = &publicItemSet{names: map[string]struct{}{}}
+
+type publicItemSet struct {
+	sync.RWMutex
+	names map[string]struct{}
+}
+
+// SetPublicConfigItems declares the configuration items holding no secret,
+// replacing any previous declaration
+func SetPublicConfigItems(names []string) {
+	m := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		m[n] = struct{}{}
+	}
+	publicConfigItems.Lock()
+	defer publicConfigItems.Unlock()
+	publicConfigItems.names = m
+}
+
+func isPublicConfigItem(name string) bool {
+	publicConfigItems.RLock()
+	defer publicConfigItems.RUnlock()
+	_, ok := publicConfigItems.names[name]
+	return ok
+}
+
+// configstore retrieves a configuration item declared as public
+// it refuses any other item, as well as any value known as secret,
+// so that secrets keep going through the secret function
+func (v *Values) configstore(key ...string) (interface{}, error) {
+	if len(key) == 0 {
+		return nil, errors.New("configstore: missing configuration key")
+	}
+	if !isPublicConfigItem(key[0]) {
+		return nil, errors.Forbiddenf("configstore: configuration item %q is not declared in public_config_items, use the secret function", key[0])
+	}
+	val := fieldFn(v.m[ConfigKey], key)
+	if !val.IsValid() {
+		return nil, errors.NotFoundf("configstore: configuration item %q", strings.Join(key, "."))
+	}
+	i := val.Interface()
+	if holdsSecret(i) {
+		return nil, errors.Forbiddenf("configstore: configuration item %q holds a secret value, use the secret function", strings.Join(key, "."))
+	}
+	return i, nil
+}
+
+// holdsSecret tells whether a value contains a string marked as secret
+func holdsSecret(i interface{}) bool {
+	switch v := i.(type) {
+	case string:
+		return RedactString(v) != v
+	case map[string]interface{}:
+		for k, item := range v {
+			if holdsSecret(k) || holdsSecret(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if holdsSecret(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
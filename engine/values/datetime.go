@@ -0,0 +1,254 @@
+package values
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// time zones are available even without a tz database on the host
+	_ "time/tzdata"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/now"
+)
+
+// the date and time functions complement sprig's now and duration, left untouched:
+// they handle time zones, calendar units (days, weeks, months, years) and RFC3339 strings
+
+// dateLayouts are the names of the layouts accepted by dateFormat, along with Go layouts
+var dateLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+	"Kitchen":     time.Kitchen,
+}
+
+// unixLayout formats a date as a unix timestamp, in seconds
+const unixLayout = "unix"
+
+// durationUnit matches a component of a duration: calendar units are
+// years (y), months (mo), weeks (w) and days (d), along with the units of Go durations
+var durationUnit = regexp.MustCompile(`^(\d+(?:\.\d+)?)(y|mo|w|d|h|ms|m|s|us|µs|ns)`)
+
+// calendarDuration is an amount of time, whose calendar units depend on the date it is added to:
+// a day added across a daylight saving time change keeps the wall clock, and lasts 23 or 25 hours
+type calendarDuration struct {
+	years, months, days int
+	exact               time.Duration
+}
+
+// dateNow returns the current time, synchronized between the instances,
+// in the given time zone (IANA name, e.g. "Europe/Paris"), local by default
+func dateNow(timezone ...string) (time.Time, error) {
+	t := now.Get()
+	switch len(timezone) {
+	case 0:
+		return t, nil
+	case 1:
+		loc, err := time.LoadLocation(timezone[0])
+		if err != nil {
+			return t, errors.NewNotValid(err, "dateNow: invalid time zone")
+		}
+		return t.In(loc), nil
+	default:
+		return t, errors.NotValidf("dateNow: %d arguments, expecting at most a time zone", len(timezone))
+	}
+}
+
+// dateDuration returns a duration: a number of seconds, as sprig's duration,
+// or a Go duration string which also accepts days (d) and weeks (w), e.g. "1d12h"
+func dateDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second, nil
+		}
+		d, err := parseCalendarDuration(v)
+		if err != nil {
+			return 0, errors.Annotate(err, "dateDuration")
+		}
+		if d.years != 0 || d.months != 0 {
+			return 0, errors.NotValidf("dateDuration: %q, months and years have no fixed duration", v)
+		}
+		return time.Duration(d.days)*24*time.Hour + d.exact, nil
+	default:
+		seconds, err := toFloat(value)
+		if err != nil {
+			return 0, errors.Annotate(err, "dateDuration")
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+}
+
+// dateAdd adds an amount of time to a date, e.g. `dateNow | dateAdd "3d"`
+// the amount is a duration or a duration string, with calendar units (y, mo, w, d), possibly negative
+// an optional time zone before the date converts the date first, for its calendar units to follow its rules
+func dateAdd(amount interface{}, args ...interface{}) (time.Time, error) {
+	t, err := dateArgs("dateAdd", args)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var d calendarDuration
+	switch v := amount.(type) {
+	case time.Duration:
+		d.exact = v
+	case string:
+		d, err = parseCalendarDuration(v)
+		if err != nil {
+			return time.Time{}, errors.Annotate(err, "dateAdd")
+		}
+	default:
+		return time.Time{}, errors.NotValidf("dateAdd: amount of type %T", amount)
+	}
+
+	return t.AddDate(d.years, d.months, d.days).Add(d.exact), nil
+}
+
+// dateFormat formats a date with a Go layout, or the name of a standard one (e.g. "RFC3339"),
+// or "unix" for a timestamp. An optional time zone before the date converts it first
+func dateFormat(layout string, args ...interface{}) (string, error) {
+	t, err := dateArgs("dateFormat", args)
+	if err != nil {
+		return "", err
+	}
+	if layout == unixLayout {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+// dateArgs reads the arguments [timezone] date of the date functions
+func dateArgs(fn string, args []interface{}) (time.Time, error) {
+	var timezone string
+	switch len(args) {
+	case 1:
+	case 2:
+		tz, ok := args[0].(string)
+		if !ok {
+			return time.Time{}, errors.NotValidf("%s: time zone of type %T", fn, args[0])
+		}
+		timezone = tz
+	default:
+		return time.Time{}, errors.NotValidf("%s: %d arguments, expecting [timezone] date", fn, len(args))
+	}
+
+	t, err := toTime(args[len(args)-1])
+	if err != nil {
+		return time.Time{}, errors.Annotate(err, fn)
+	}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, errors.NewNotValid(err, fn+": invalid time zone")
+		}
+		t = t.In(loc)
+	}
+	return t, nil
+}
+
+// toTime reads a date: a time, an RFC3339 string (as found in the task and step values),
+// or a unix timestamp in seconds
+func toTime(i interface{}) (time.Time, error) {
+	switch v := i.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, errors.NotValidf("nil date")
+		}
+		return *v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, errors.NewNotValid(err, fmt.Sprintf("date %q, expecting RFC3339", v))
+		}
+		return t, nil
+	default:
+		seconds, err := toFloat(i)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec := int64(seconds)
+		return time.Unix(sec, int64((seconds-float64(sec))*float64(time.Second))), nil
+	}
+}
+
+func toFloat(i interface{}) (float64, error) {
+	switch v := i.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return 0, errors.NotValidf("value of type %T", i)
+	}
+}
+
+// parseCalendarDuration parses a duration string with calendar units, e.g. "-1y2mo3d4h"
+func parseCalendarDuration(s string) (calendarDuration, error) {
+	var d calendarDuration
+	rest := s
+	sign := 1
+	if strings.HasPrefix(rest, "-") {
+		sign = -1
+		rest = rest[1:]
+	} else {
+		rest = strings.TrimPrefix(rest, "+")
+	}
+	if rest == "" {
+		return d, errors.NotValidf("duration %q", s)
+	}
+
+	for rest != "" {
+		m := durationUnit.FindStringSubmatch(rest)
+		if m == nil {
+			return d, errors.NotValidf("duration %q", s)
+		}
+		rest = rest[len(m[0]):]
+
+		value, unit := m[1], m[2]
+		switch unit {
+		case "y", "mo", "w", "d":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return d, errors.NotValidf("duration %q, %s must be a whole number", s, unit)
+			}
+			switch unit {
+			case "y":
+				d.years += sign * n
+			case "mo":
+				d.months += sign * n
+			case "w":
+				d.days += sign * 7 * n
+			case "d":
+				d.days += sign * n
+			}
+		default:
+			exact, err := time.ParseDuration(value + unit)
+			if err != nil {
+				return d, errors.NewNotValid(err, fmt.Sprintf("duration %q", s))
+			}
+			d.exact += time.Duration(sign) * exact
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,140 @@
+package values
+
+import (
+	"bytes"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/itchyny/gojq"
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/utils"
+)
+
+const jqFuncName = "jq"
+
+// jq runs a jq query against a structured value
+// it returns a slice when the query yields several results, and a single value otherwise
+func (v *Values) jq(query string, input interface{}) (interface{}, error) {
+	code, err := compileJQ(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// gojq normalizes numbers in place: work on a copy of the input,
+	// not to alter the data held in Values
+	ba, err := utils.JSONMarshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(ba), &data); err != nil {
+		return nil, err
+	}
+
+	results := []interface{}{}
+	iter := code.Run(data)
+	for {
+		res, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := res.(error); ok {
+			return nil, errors.Annotatef(err, "jq query %q", query)
+		}
+		results = append(results, res)
+	}
+
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return results[0], nil
+	}
+	return results, nil
+}
+
+func compileJQ(query string) (*gojq.Code, error) {
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid jq query %q", query)
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid jq query %q", query)
+	}
+	return code, nil
+}
+
+// ValidateJQQueries parses a templated string, and compiles every jq query
+// given as a literal string, so that an invalid program is caught before execution
+// templating errors are ignored: they will surface when the string gets templated
+func ValidateJQQueries(templateStr string) error {
+	tmpl, err := template.
+		New("tmpl").
+		Funcs(NewValues().funcMap).
+		Parse(templateStr)
+	if err != nil || tmpl.Tree == nil {
+		return nil
+	}
+	return walkJQNodes(tmpl.Tree.Root)
+}
+
+func walkJQNodes(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := walkJQNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return walkJQNodes(n.Pipe)
+	case *parse.IfNode:
+		return walkJQBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return walkJQBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return walkJQBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return walkJQNodes(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := walkJQNodes(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 2 {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == jqFuncName {
+				if query, ok := n.Args[1].(*parse.StringNode); ok {
+					if _, err := compileJQ(query.Text); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			if err := walkJQNodes(arg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func walkJQBranch(n *parse.BranchNode) error {
+	if err := walkJQNodes(n.Pipe); err != nil {
+		return err
+	}
+	if err := walkJQNodes(n.List); err != nil {
+		return err
+	}
+	return walkJQNodes(n.ElseList)
+}
@@ -0,0 +1,316 @@
+package values
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// RedactedValue replaces every occurrence of a secret value
+const RedactedValue = "***"
+
+// MinSecretLength is the length under which a value is never redacted:
+// shorter values are too likely to show up in unrelated data
+const MinSecretLength = 6
+
+// commonValues are never redacted, being found everywhere even when used as secrets
+var commonValues = map[string]struct{}{
+	"default":   {},
+	"disabled":  {},
+	"enabled":   {},
+	"localhost": {},
+	"password":  {},
+	"unknown":   {},
+	"undefined": {},
+}
+
+// configSecrets holds the configuration items read through the secret function,
+// redacted from the step results, API responses and logs of all resolutions until
+// the configuration is reloaded. Other secrets, such as the secret inputs of a task,
+// are registered in the SecretScope of its resolution, and only redacted from its results
+var configSecrets = newSecretSet()
+
+// secretSet is a set of secret values, along with the replacer redacting them
+type secretSet struct {
+	sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}
+
+func newSecretSet() *secretSet {
+	return &secretSet{values: map[string]struct{}{}}
+}
+
+// redactable tells whether a value is worth being redacted
+func redactable(s string) bool {
+	if len(strings.TrimSpace(s)) < MinSecretLength {
+		return false
+	}
+	_, common := commonValues[strings.ToLower(s)]
+	return !common
+}
+
+func (set *secretSet) add(s string) {
+	if !redactable(s) {
+		return
+	}
+	set.Lock()
+	defer set.Unlock()
+	if _, ok := set.values[s]; ok {
+		return
+	}
+	set.values[s] = struct{}{}
+	set.replacer = nil
+}
+
+func (set *secretSet) reset() {
+	set.Lock()
+	defer set.Unlock()
+	set.values = map[string]struct{}{}
+	set.replacer = nil
+}
+
+func (set *secretSet) empty() bool {
+	set.RLock()
+	defer set.RUnlock()
+	return len(set.values) == 0
+}
+
+func (set *secretSet) list() []string {
+	set.RLock()
+	defer set.RUnlock()
+	list := make([]string, 0, len(set.values))
+	for s := range set.values {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (set *secretSet) redactString(s string) string {
+	if s == "" {
+		return s
+	}
+	set.RLock()
+	r, empty := set.replacer, len(set.values) == 0
+	set.RUnlock()
+	if empty {
+		return s
+	}
+	if r == nil {
+		r = set.buildReplacer()
+	}
+	return r.Replace(s)
+}
+
+func (set *secretSet) buildReplacer() *strings.Replacer {
+	set.Lock()
+	defer set.Unlock()
+	if set.replacer != nil {
+		return set.replacer
+	}
+	list := make([]string, 0, len(set.values))
+	for s := range set.values {
+		list = append(list, s)
+	}
+	// longest secrets first, so that a secret containing another one is fully redacted
+	sort.Slice(list, func(i, j int) bool {
+		if len(list[i]) != len(list[j]) {
+			return len(list[i]) > len(list[j])
+		}
+		return list[i] < list[j]
+	})
+	oldnew := make([]string, 0, 2*len(list))
+	for _, s := range list {
+		oldnew = append(oldnew, s, RedactedValue)
+	}
+	set.replacer = strings.NewReplacer(oldnew...)
+	return set.replacer
+}
+
+// secret retrieves an item from configstore, and marks its value as secret:
+// it gets redacted from step outputs, API responses and logs
+func (v *Values) secret(key ...string) (interface{}, error) {
+	if len(key) == 0 {
+		return nil, errors.New("secret: missing configuration key")
+	}
+	val := fieldFn(v.m[ConfigKey], key)
+	if !val.IsValid() {
+		return nil, errors.NotFoundf("secret: configuration item %q", strings.Join(key, "."))
+	}
+	i := val.Interface()
+	RegisterSecretValue(i)
+	// kept along with the resolution, to be redacted from its results once the configuration is reloaded
+	v.secretScope.RegisterValue(i)
+	return i, nil
+}
+
+// RegisterSecret marks a string from the configuration as secret,
+// to be redacted until the configuration is reloaded
+// values shorter than MinSecretLength and common values are ignored
+func RegisterSecret(s string) {
+	configSecrets.add(s)
+}
+
+// RegisterSecretValue marks every string held by a value from the configuration as secret,
+// as well as its JSON representation when it is a structure
+// map keys and other scalars (numbers, booleans) are too ambiguous to be redacted
+func RegisterSecretValue(i interface{}) {
+	walkSecretValue(i, RegisterSecret)
+}
+
+// ResetSecrets forgets the secrets of the configuration, when it is reloaded
+func ResetSecrets() {
+	configSecrets.reset()
+}
+
+func walkSecretValue(i interface{}, register func(string)) {
+	switch v := i.(type) {
+	case string:
+		register(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			walkSecretValue(item, register)
+		}
+		if ba, err := json.Marshal(v); err == nil {
+			register(string(ba))
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkSecretValue(item, register)
+		}
+		if ba, err := json.Marshal(v); err == nil {
+			register(string(ba))
+		}
+	}
+}
+
+// SecretScope holds the secrets of a resolution, such as the secret inputs of its task:
+// they are redacted from its own results only, along with the secrets of the configuration
+// a nil SecretScope only redacts the secrets of the configuration
+type SecretScope struct {
+	set *secretSet
+}
+
+// NewSecretScope returns an empty SecretScope
+func NewSecretScope() *SecretScope {
+	return &SecretScope{set: newSecretSet()}
+}
+
+// Register marks a string as secret within the scope
+// values shorter than MinSecretLength and common values are ignored
+func (sc *SecretScope) Register(s string) {
+	sc.set.add(s)
+}
+
+// RegisterValue marks every string held by a value as secret within the scope,
+// as well as its JSON representation when it is a structure
+func (sc *SecretScope) RegisterValue(i interface{}) {
+	walkSecretValue(i, sc.Register)
+}
+
+// Values returns the secrets of the scope, for them to be stored along with the resolution
+func (sc *SecretScope) Values() []string {
+	if sc == nil {
+		return nil
+	}
+	return sc.set.list()
+}
+
+// RedactString replaces every secret of the scope and of the configuration within a string
+func (sc *SecretScope) RedactString(s string) string {
+	if sc != nil {
+		s = sc.set.redactString(s)
+	}
+	return configSecrets.redactString(s)
+}
+
+// Redact returns a copy of a structure in which every secret of the scope
+// and of the configuration is replaced, as described by Redact
+func (sc *SecretScope) Redact(i interface{}) interface{} {
+	if (sc == nil || sc.set.empty()) && configSecrets.empty() {
+		return i
+	}
+	return redact(i, sc.RedactString)
+}
+
+// RedactString replaces every secret of the configuration within a string
+func RedactString(s string) string {
+	return configSecrets.redactString(s)
+}
+
+// Redact returns a copy of a structure in which every secret of the configuration is replaced
+// strings are redacted, map keys and other scalar types are returned as is
+// any other structure goes through a JSON round-trip, as it would when stored
+func Redact(i interface{}) interface{} {
+	if configSecrets.empty() {
+		return i
+	}
+	return redact(i, RedactString)
+}
+
+func redact(i interface{}, redactString func(string) string) interface{} {
+	switch v := i.(type) {
+	case nil, bool, json.Number, int, int64, float64:
+		return i
+	case string:
+		return redactString(v)
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			ret[k] = redact(item, redactString)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for idx, item := range v {
+			ret[idx] = redact(item, redactString)
+		}
+		return ret
+	case map[string]string:
+		ret := make(map[string]string, len(v))
+		for k, item := range v {
+			ret[k] = redactString(item)
+		}
+		return ret
+	}
+
+	ba, err := utils.JSONMarshal(i)
+	if err != nil {
+		return i
+	}
+	var generic interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(ba), &generic); err != nil {
+		return i
+	}
+	return redact(generic, redactString)
+}
+
+// SecretsLogHook redacts the secrets of the configuration from log messages and string fields
+type SecretsLogHook struct{}
+
+// Levels implements logrus.Hook
+func (SecretsLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (SecretsLogHook) Fire(entry *logrus.Entry) error {
+	entry.Message = RedactString(entry.Message)
+	for k, v := range entry.Data {
+		switch val := v.(type) {
+		case string:
+			entry.Data[k] = RedactString(val)
+		case error:
+			entry.Data[k] = RedactString(val.Error())
+		}
+	}
+	return nil
+}
@@ -6,15 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/go-ldap/ldap/v3"
 	"github.com/gofrs/uuid"
 	"github.com/juju/errors"
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/pkg/utils"
 	"github.com/robertkrimen/otto"
+	"sigs.k8s.io/yaml"
 )
 
 // keys to store/retrieve data from a Values struct
@@ -26,7 +29,9 @@ const (
 	ConfigKey        = "config"
 	TaskKey          = "task"
 	VarKey           = "var"
-	IteratorKey      = "iterator" // reserved for transient one-off values, set/unset when applying values to template
+	ComputedKey      = "computed"
+	IteratorKey      = "iterator"  // reserved for transient one-off values, set/unset when applying values to template
+	IterationKey     = "iteration" // position of the iterator within its collection, set/unset along with it
 
 	StateKey      = "state"
 	PreHookKey    = "pre_hook"
@@ -41,8 +46,35 @@ const (
 
 // Values is a container for all the live data of a running task
 type Values struct {
-	m       map[string]interface{}
-	funcMap map[string]interface{}
+	m             map[string]interface{}
+	funcMap       map[string]interface{}
+	computedCache *computedCache
+	computing     computing
+	secretScope   *SecretScope
+}
+
+// Iteration describes the position of a foreach item within its collection
+// Key is the index of the item in a list, or its key in an object
+type Iteration struct {
+	Index int         `json:"index"`
+	Key   interface{} `json:"key"`
+	Total int         `json:"total"`
+}
+
+// Map returns the iteration as exposed to templates
+func (i *Iteration) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"index": i.Index,
+		"key":   i.Key,
+		"total": i.Total,
+	}
+}
+
+// Iterator is a foreach item along with its iteration,
+// to be applied to a template instead of a bare item
+type Iterator struct {
+	Item      interface{}
+	Iteration *Iteration
 }
 
 // Variable holds a named variable, with either a JS expression to be evalued
@@ -67,10 +99,18 @@ func NewValues() *Values {
 			TaskKey:          map[string]interface{}{},
 			ConfigKey:        map[string]interface{}{},
 			VarKey:           map[string]*Variable{},
+			ComputedKey:      map[string]interface{}{},
 			IteratorKey:      nil,
+			IterationKey:     nil,
 		},
+		computedCache: &computedCache{values: map[string]interface{}{}},
+		computing:     computing{},
+		secretScope:   NewSecretScope(),
 	}
 	v.funcMap = sprig.FuncMap()
+	// the environment of the instance holds its own secrets, it is not exposed to the templates
+	delete(v.funcMap, "env")
+	delete(v.funcMap, "expandenv")
 	v.funcMap["field"] = v.fieldTmpl
 	v.funcMap["fieldFrom"] = fieldFromTmpl
 	v.funcMap["eval"] = v.varEval
@@ -80,6 +120,18 @@ func NewValues() *Values {
 	v.funcMap["uuid"] = uuid.NewV4
 	v.funcMap["b64RawEnc"] = v.b64RawEnc
 	v.funcMap["b64RawDec"] = v.b64RawDec
+	v.funcMap["ldapEscape"] = ldap.EscapeFilter
+	v.funcMap["toYaml"] = v.toYAML
+	v.funcMap["mustToYaml"] = v.mustToYAML
+	v.funcMap["fromYaml"] = v.fromYAML
+	v.funcMap["mustFromYaml"] = v.mustFromYAML
+	v.funcMap[jqFuncName] = v.jq
+	v.funcMap["secret"] = v.secret
+	v.funcMap["configstore"] = v.configstore
+	v.funcMap["dateNow"] = dateNow
+	v.funcMap["dateDuration"] = dateDuration
+	v.funcMap["dateAdd"] = dateAdd
+	v.funcMap["dateFormat"] = dateFormat
 
 	return v
 }
@@ -87,9 +139,12 @@ func NewValues() *Values {
 // Clone duplicates the values object
 func (v *Values) Clone() (*Values, error) {
 	n := NewValues()
+	// computed values and secrets are shared by the whole resolution
+	n.computedCache = v.computedCache
+	n.secretScope = v.secretScope
 
 	for key, val := range v.m {
-		if val == nil {
+		if val == nil || key == ComputedKey {
 			continue
 		}
 
@@ -291,6 +346,12 @@ func (v *Values) SetTaskInfos(t map[string]interface{}) {
 	v.m[TaskKey] = t
 }
 
+// SecretScope returns the secrets of the resolution, such as its secret inputs,
+// redacted from its results when they are displayed
+func (v *Values) SecretScope() *SecretScope {
+	return v.secretScope
+}
+
 // SetVariables stores template-defined variables in Values
 func (v *Values) SetVariables(vars []Variable) {
 	varmap := make(map[string]*Variable)
@@ -298,6 +359,7 @@ func (v *Values) SetVariables(vars []Variable) {
 		varmap[vars[i].Name] = &vars[i]
 	}
 	v.m[VarKey] = varmap
+	v.computedCache = &computedCache{values: map[string]interface{}{}}
 }
 
 // SetIterator stores the data for the current item in an iteration
@@ -308,6 +370,16 @@ func (v *Values) SetIterator(i interface{}) {
 // UnsetIterator cleans up data on iterator
 func (v *Values) UnsetIterator() {
 	v.m[IteratorKey] = nil
+	v.m[IterationKey] = nil
+}
+
+// SetIteration stores the position of the current item in an iteration
+func (v *Values) SetIteration(i *Iteration) {
+	if i == nil {
+		v.m[IterationKey] = nil
+		return
+	}
+	v.m[IterationKey] = i.Map()
 }
 
 // GetVariables returns all template variables stored in Values
@@ -330,11 +402,25 @@ func (v *Values) Apply(templateStr string, item interface{}, stepName string) ([
 		return nil, errors.NewBadRequest(err, "Templating error")
 	}
 
+	if err := v.resolveComputed(tmpl); err != nil {
+		return nil, errors.NewBadRequest(err, "Templating error")
+	}
+
 	b := new(bytes.Buffer)
 
 	if item != nil {
-		v.SetIterator(item)
-		defer v.UnsetIterator()
+		// an inner iteration shadows the outer one, restored afterwards
+		prevIterator, prevIteration := v.m[IteratorKey], v.m[IterationKey]
+		if it, ok := item.(*Iterator); ok {
+			v.SetIterator(it.Item)
+			v.SetIteration(it.Iteration)
+		} else {
+			v.SetIterator(item)
+			v.SetIteration(nil)
+		}
+		defer func() {
+			v.m[IteratorKey], v.m[IterationKey] = prevIterator, prevIteration
+		}()
 	}
 
 	if stepName != "" {
@@ -502,6 +588,34 @@ func (v *Values) mustFromJSON(s string) (reflect.Value, error) {
 	return reflect.ValueOf(output), err
 }
 
+// toYAML encodes a value into YAML, ignoring errors.
+func (v *Values) toYAML(i interface{}) string {
+	output, _ := v.mustToYAML(i)
+	return output
+}
+
+// mustToYAML encodes a value into YAML, returning errors.
+func (v *Values) mustToYAML(i interface{}) (string, error) {
+	output, err := yaml.Marshal(i)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
+
+// fromYAML decodes YAML into a structured value, ignoring errors.
+func (v *Values) fromYAML(s string) (reflect.Value, error) {
+	output, _ := v.mustFromYAML(s)
+	return output, nil
+}
+
+// mustFromYAML decodes YAML into a structured value, returning errors.
+func (v *Values) mustFromYAML(s string) (reflect.Value, error) {
+	var output interface{}
+	err := yaml.Unmarshal([]byte(s), &output, utils.JSONUseNumber)
+	return reflect.ValueOf(output), err
+}
+
 func (v *Values) b64RawDec(s string) string {
 	data, err := base64.RawStdEncoding.DecodeString(s)
 	if err != nil {
@@ -1,13 +1,17 @@
 package values_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/maxatome/go-testdeep/td"
 	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/compress/gzip"
 	"github.com/cneill/utask/pkg/utils"
+	"github.com/maxatome/go-testdeep/td"
 	"sigs.k8s.io/yaml"
 )
 
@@ -41,6 +45,17 @@ func TestTmpl(t *testing.T) {
 	td.Cmp(t, string(output), "example.org")
 }
 
+func TestEnvironmentNotExposed(t *testing.T) {
+	t.Setenv("UTASK_TEST_ENV", "instance-secret")
+
+	v := values.NewValues()
+	_, err := v.Apply(`{{ env "UTASK_TEST_ENV" }}`, nil, "foo")
+	td.CmpNotNil(t, err)
+
+	_, err = v.Apply(`{{ expandenv "$UTASK_TEST_ENV" }}`, nil, "foo")
+	td.CmpNotNil(t, err)
+}
+
 func TestJsonNumber(t *testing.T) {
 	input := `
 {
@@ -150,3 +165,425 @@ foo.foo;`,
 	require.Nil(err)
 	assert.Cmp(string(outputba), "buzz")
 }
+
+func TestEncodingFunctions(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	v.SetInput(map[string]interface{}{
+		"secret": "s3cr3t<>",
+		"object": map[string]interface{}{
+			"zeta":  "last",
+			"alpha": []interface{}{1, "two"},
+			"mid":   map[string]interface{}{"b": true, "a": nil},
+		},
+	})
+
+	output, err := v.Apply("{{ .input.secret | b64enc }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "czNjcjN0PD4=")
+
+	output, err = v.Apply("{{ .input.secret | b64enc | b64dec }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "s3cr3t<>")
+
+	output, err = v.Apply("{{ `not base64!` | b64dec }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "illegal base64 data at input byte 3")
+
+	// sprig's toJson sorts the keys
+	output, err = v.Apply("{{ .input.object | toJson }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), `{"alpha":[1,"two"],"mid":{"a":null,"b":true},"zeta":"last"}`)
+
+	for i := 0; i < 10; i++ {
+		again, err := v.Apply("{{ .input.object | toJson }}", nil, "")
+		require.Nil(err)
+		assert.Cmp(string(again), string(output))
+	}
+
+	output, err = v.Apply("{{ (.input.object | toJson | fromJson).zeta }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "last")
+
+	// and escapes HTML characters, unlike toRawJson
+	output, err = v.Apply("{{ .input.secret | toJson }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), `"s3cr3t\u003c\u003e"`)
+
+	output, err = v.Apply("{{ .input.secret | toRawJson }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), `"s3cr3t<>"`)
+
+	// values interpolated in a LDAP filter can't alter it
+	output, err = v.Apply("{{ `*)(uid=*))(|(uid=\\` | ldapEscape }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), `\2a\29\28uid=\2a\29\29\28|\28uid=\5c`)
+
+	output, err = v.Apply("(uid={{ `jdoe` | ldapEscape }})", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "(uid=jdoe)")
+
+	output, err = v.Apply("{{ .input.object | toYaml }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), `alpha:
+- 1
+- two
+mid:
+  a: null
+  b: true
+zeta: last`)
+
+	output, err = v.Apply("{{ (.input.object | toYaml | fromYaml).mid.b }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "true")
+
+	output, err = v.Apply("{{ index (`foo: [1, 2, 3]` | fromYaml).foo 2 }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "3")
+
+	output, err = v.Apply("{{ `foo: [1, 2` | fromYaml | toJson }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "null")
+
+	_, err = v.Apply("{{ `foo: [1, 2` | mustFromYaml }}", nil, "")
+	assert.NotNil(err)
+}
+
+func TestJQ(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	input := map[string]interface{}{
+		"list": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"id": json.Number("1"), "active": true},
+				map[string]interface{}{"id": json.Number("2"), "active": false},
+				map[string]interface{}{"id": json.Number("3"), "active": true},
+			},
+		},
+	}
+	v.SetInput(input)
+
+	output, err := v.Apply("{{ jq `.items[] | select(.active) | .id` .input.list | toJson }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "[1,3]")
+
+	output, err = v.Apply("{{ jq `.items | length` .input.list }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "3")
+
+	output, err = v.Apply("{{ jq `.items[0].id + 1` .input.list }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "2")
+
+	// input data is left untouched
+	items := input["list"].(map[string]interface{})["items"].([]interface{})
+	assert.Cmp(items[0].(map[string]interface{})["id"], json.Number("1"))
+
+	_, err = v.Apply("{{ jq `.items[` .input.list }}", nil, "")
+	assert.NotNil(err)
+
+	_, err = v.Apply("{{ jq `error(\"boom\")` .input.list }}", nil, "")
+	assert.NotNil(err)
+
+	assert.NotNil(values.ValidateJQQueries("{{ jq `.items[` .input.list }}"))
+	assert.NotNil(values.ValidateJQQueries("{{ if .input.foo }}{{ jq \".a | \" .input.list }}{{ end }}"))
+	assert.Nil(values.ValidateJQQueries("{{ jq `.items[0]` .input.list }}"))
+	assert.Nil(values.ValidateJQQueries("{{ .input.foo | default `bar` }}"))
+	assert.Nil(values.ValidateJQQueries("not a template {{"))
+}
+
+func TestSecret(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	v.SetConfig(map[string]interface{}{
+		"db": map[string]interface{}{
+			"user":     "admin",
+			"password": "hunter2-secret-test",
+		},
+		"token": "tok-0123456789-secret-test",
+	})
+
+	output, err := v.Apply("Bearer {{ secret `token` }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "Bearer tok-0123456789-secret-test")
+
+	output, err = v.Apply("{{ (secret `db`).password }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "hunter2-secret-test")
+
+	_, err = v.Apply("{{ secret `unknown` }}", nil, "")
+	assert.NotNil(err)
+
+	stepOutput := map[string]interface{}{
+		"header":              "Bearer tok-0123456789-secret-test",
+		"nested":              []interface{}{"hunter2-secret-test", json.Number("42"), true},
+		"user":                "admin",
+		"hunter2-secret-test": "keys are kept",
+	}
+	redacted := values.Redact(stepOutput)
+	// short values such as the user are not redacted, nor are map keys
+	assert.Cmp(redacted, map[string]interface{}{
+		"header":              "Bearer ***",
+		"nested":              []interface{}{"***", json.Number("42"), true},
+		"user":                "admin",
+		"hunter2-secret-test": "keys are kept",
+	})
+	// original structure is left untouched
+	assert.Cmp(stepOutput["header"], "Bearer tok-0123456789-secret-test")
+	assert.Cmp(values.RedactString("the admin user"), "the admin user")
+
+	// redacted data stays redacted through storage
+	c := gzip.New()
+	ba, err := utils.JSONMarshal(redacted)
+	require.Nil(err)
+	compressed, err := c.Compress(ba)
+	require.Nil(err)
+	decompressed, err := c.Decompress(compressed)
+	require.Nil(err)
+	var stored interface{}
+	require.Nil(utils.JSONnumberUnmarshal(bytes.NewReader(decompressed), &stored))
+	assert.Cmp(stored, redacted)
+	assert.Cmp(values.Redact(stored), redacted)
+
+	assert.Cmp(values.RedactString("error: invalid token tok-0123456789-secret-test"), "error: invalid token ***")
+
+	type typedOutput struct {
+		Token string `json:"token"`
+	}
+	assert.Cmp(values.Redact(typedOutput{Token: "tok-0123456789-secret-test"}), map[string]interface{}{"token": "***"})
+
+	// short and common values are never redacted
+	values.RegisterSecret("prod")
+	values.RegisterSecret("localhost")
+	values.RegisterSecret("     1")
+	assert.Cmp(values.RedactString("prod on localhost:     1"), "prod on localhost:     1")
+}
+
+func TestSecretScope(t *testing.T) {
+	assert := td.Assert(t)
+
+	first := values.NewSecretScope()
+	second := values.NewSecretScope()
+
+	first.RegisterValue(map[string]interface{}{"password": "scoped-secret-test"})
+	second.Register("other-scoped-secret-test")
+	assert.Cmp(first.RedactString("password: scoped-secret-test"), "password: ***")
+	assert.Cmp(first.RedactString(`{"password":"scoped-secret-test"}`), "***")
+	assert.Cmp(first.Values(), []string{"scoped-secret-test", `{"password":"scoped-secret-test"}`})
+
+	// the secrets of a scope are only redacted from its own results, never globally
+	assert.Cmp(second.RedactString("password: scoped-secret-test"), "password: scoped-secret-test")
+	assert.Cmp(values.RedactString("password: scoped-secret-test"), "password: scoped-secret-test")
+	assert.Cmp(second.Redact(map[string]interface{}{"a": "other-scoped-secret-test"}), map[string]interface{}{"a": "***"})
+
+	// short values are ignored, as in the configuration
+	first.Register("1")
+	first.Register("prod")
+	assert.Cmp(first.RedactString("1 prod"), "1 prod")
+
+	// the secrets of the configuration are redacted from every scope
+	values.RegisterSecret("config-secret-test")
+	assert.Cmp(first.RedactString("config-secret-test"), "***")
+	var none *values.SecretScope
+	assert.Cmp(none.RedactString("config-secret-test scoped-secret-test"), "*** scoped-secret-test")
+
+	// the scope of a resolution is shared by its values
+	v := values.NewValues()
+	clone, err := v.Clone()
+	assert.CmpNoError(err)
+	clone.SecretScope().Register("resolution-secret-test")
+	assert.Cmp(v.SecretScope().RedactString("resolution-secret-test"), "***")
+
+	// secrets of the configuration are kept until it is reloaded
+	values.RegisterSecret("reloaded-secret-test")
+	assert.Cmp(values.RedactString("reloaded-secret-test"), "***")
+	values.ResetSecrets()
+	assert.Cmp(values.RedactString("reloaded-secret-test"), "reloaded-secret-test")
+	assert.Cmp(first.RedactString("config-secret-test"), "config-secret-test")
+}
+
+func TestConfigstore(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	values.SetPublicConfigItems([]string{"shared-settings", "leaky-settings", "api"})
+	defer values.SetPublicConfigItems(nil)
+
+	v := values.NewValues()
+	v.SetConfig(map[string]interface{}{
+		"shared-settings": map[string]interface{}{
+			"region": "eu-west-1",
+			"zones":  []interface{}{"a", "b"},
+		},
+		"leaky-settings": map[string]interface{}{
+			"token": "tok-configstore-secret-test",
+		},
+		"api":   map[string]interface{}{"token": "tok-configstore-other-test"},
+		"token": "tok-configstore-private-test",
+	})
+
+	output, err := v.Apply("{{ configstore `shared-settings` `region` }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "eu-west-1")
+
+	output, err = v.Apply("{{ (configstore `shared-settings`).zones | join `,` }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "a,b")
+
+	// not declared as public
+	_, err = v.Apply("{{ configstore `token` }}", nil, "")
+	assert.NotNil(err)
+
+	_, err = v.Apply("{{ configstore `shared-settings` `unknown` }}", nil, "")
+	assert.NotNil(err)
+
+	// a value marked as secret stays behind the secret function
+	values.RegisterSecret("tok-configstore-secret-test")
+	_, err = v.Apply("{{ configstore `leaky-settings` `token` }}", nil, "")
+	assert.NotNil(err)
+	_, err = v.Apply("{{ configstore `leaky-settings` }}", nil, "")
+	assert.NotNil(err)
+
+	_, err = v.Apply("{{ (secret `api`).token }}", nil, "")
+	require.Nil(err)
+	_, err = v.Apply("{{ configstore `api` `token` }}", nil, "")
+	assert.NotNil(err)
+}
+
+func TestComputed(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	v.SetInput(map[string]interface{}{"region": "eu"})
+	v.SetVariables([]values.Variable{
+		{Name: "cluster", Value: "cluster-{{.input.region}}"},
+		{Name: "fqdn", Value: "{{.computed.cluster}}.example.org"},
+		{Name: "replicas", Expression: "1 + 2"},
+		{Name: "loopA", Value: "{{.computed.loopB}}"},
+		{Name: "loopB", Value: "{{.computed.loopA}}"},
+	})
+
+	output, err := v.Apply("{{.computed.fqdn}} {{.computed.cluster}}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "cluster-eu.example.org cluster-eu")
+
+	output, err = v.Apply("{{ if eq .computed.replicas `3` }}ok{{ end }}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "ok")
+
+	// computed once: later changes don't alter the value, clones share it
+	v.SetInput(map[string]interface{}{"region": "us"})
+	output, err = v.Apply("{{.computed.cluster}}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "cluster-eu")
+
+	c, err := v.Clone()
+	require.Nil(err)
+	output, err = c.Apply("{{.computed.fqdn}}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "cluster-eu.example.org")
+
+	_, err = v.Apply("{{.computed.unknown}}", nil, "")
+	assert.NotNil(err)
+
+	_, err = v.Apply("{{.computed.loopA}}", nil, "")
+	assert.NotNil(err)
+}
+
+func TestIteration(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	tmpl := "{{.iteration.index}}/{{.iteration.total}} {{.iteration.key}}={{.iterator}}"
+
+	// items of a list are keyed by their index
+	output, err := v.Apply(tmpl, &values.Iterator{Item: "b", Iteration: &values.Iteration{Index: 1, Key: 1, Total: 3}}, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "1/3 1=b")
+
+	// items of an object by their key
+	output, err = v.Apply(tmpl, &values.Iterator{Item: json.Number("42"), Iteration: &values.Iteration{Index: 0, Key: "answer", Total: 2}}, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "0/2 answer=42")
+
+	// a bare item comes without iteration
+	output, err = v.Apply("{{.iterator.name}}{{if .iteration}} {{.iteration.index}}{{end}}", map[string]interface{}{"name": "foo"}, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "foo")
+
+	// the innermost iteration shadows the outer one, restored afterwards
+	v.SetIterator("outer")
+	v.SetIteration(&values.Iteration{Index: 4, Key: "x", Total: 5})
+	output, err = v.Apply(tmpl, &values.Iterator{Item: "inner", Iteration: &values.Iteration{Index: 0, Key: 0, Total: 1}}, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "0/1 0=inner")
+
+	output, err = v.Apply(tmpl, nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "4/5 x=outer")
+
+	v.UnsetIterator()
+	output, err = v.Apply("{{.iterator}}{{.iteration}}", nil, "")
+	require.Nil(err)
+	assert.Cmp(string(output), "<no value><no value>")
+}
+
+func TestDateTime(t *testing.T) {
+	assert, require := td.AssertRequire(t)
+
+	v := values.NewValues()
+	apply := func(tmpl string) string {
+		t.Helper()
+		output, err := v.Apply(tmpl, nil, "")
+		require.CmpNoError(err, tmpl)
+		return string(output)
+	}
+
+	// RFC3339 dates round-trip, nanoseconds and offset included
+	for _, date := range []string{"2026-03-28T12:00:00+01:00", "2026-10-16T08:30:15.123456789Z", "2026-01-01T00:00:00-05:30"} {
+		assert.Cmp(apply(`{{ dateFormat "RFC3339Nano" "`+date+`" }}`), date)
+		assert.Cmp(apply(`{{ dateAdd "0s" "`+date+`" | dateFormat "RFC3339Nano" }}`), date)
+	}
+
+	// calendar units keep the wall clock across daylight saving time changes, exact units don't
+	assert.Cmp(apply(`{{ dateAdd "1d" "Europe/Paris" "2026-03-28T12:00:00+01:00" | dateFormat "RFC3339" }}`), "2026-03-29T12:00:00+02:00")
+	assert.Cmp(apply(`{{ dateAdd "24h" "Europe/Paris" "2026-03-28T12:00:00+01:00" | dateFormat "RFC3339" }}`), "2026-03-29T13:00:00+02:00")
+	assert.Cmp(apply(`{{ dateAdd "1d" "Europe/Paris" "2026-10-24T12:00:00+02:00" | dateFormat "RFC3339" }}`), "2026-10-25T12:00:00+01:00")
+	assert.Cmp(apply(`{{ dateAdd "-1w" "America/New_York" "2026-03-14T09:00:00-04:00" | dateFormat "RFC3339" }}`), "2026-03-07T09:00:00-05:00")
+	// a wall clock skipped by the change is pushed forward
+	assert.Cmp(apply(`{{ dateAdd "1d" "Europe/Paris" "2026-03-28T02:30:00+01:00" | dateFormat "RFC3339" }}`), "2026-03-29T03:30:00+02:00")
+
+	assert.Cmp(apply(`{{ dateAdd "1y2mo3d4h5m" "2026-01-31T00:00:00Z" | dateFormat "DateTime" }}`), "2027-04-03 04:05:00")
+	assert.Cmp(apply(`{{ dateAdd (dateDuration "90m") "2026-01-01T00:00:00Z" | dateFormat "Kitchen" }}`), "1:30AM")
+	assert.Cmp(apply(`{{ dateFormat "2006-01-02 15:04 MST" "Asia/Tokyo" "2026-10-16T00:00:00Z" }}`), "2026-10-16 09:00 JST")
+	assert.Cmp(apply(`{{ dateFormat "unix" "2026-10-16T00:00:00Z" }}`), "1792108800")
+	assert.Cmp(apply(`{{ dateFormat "RFC3339" "UTC" 1792108800 }}`), "2026-10-16T00:00:00Z")
+
+	// dateDuration keeps the seconds of sprig's duration
+	assert.Cmp(apply(`{{ dateDuration 3600 }}`), "1h0m0s")
+	assert.Cmp(apply(`{{ dateDuration "95" }}`), "1m35s")
+	assert.Cmp(apply(`{{ dateDuration "1d12h" }}`), "36h0m0s")
+
+	// dateNow is in the requested time zone
+	assert.Cmp(apply(`{{ dateNow "Asia/Kolkata" | dateFormat "Z07:00" }}`), "+05:30")
+	assert.Cmp(apply(`{{ (dateNow "UTC").Year }}`), fmt.Sprint(time.Now().UTC().Year()))
+
+	// sprig's now and duration are left as they are
+	assert.Cmp(apply(`{{ duration "90" }}`), "1m30s")
+	assert.Cmp(apply(`{{ duration "1d12h" }}`), "0s")
+	assert.Cmp(apply(`{{ now | date "2006" }}`), fmt.Sprint(time.Now().Year()))
+
+	for _, tmpl := range []string{
+		`{{ dateNow "Nowhere/Nothing" }}`,
+		`{{ dateAdd "1.5d" "2026-01-01T00:00:00Z" }}`,
+		`{{ dateAdd "3 days" "2026-01-01T00:00:00Z" }}`,
+		`{{ dateFormat "RFC3339" "yesterday" }}`,
+		`{{ dateDuration "1mo" }}`,
+		`{{ now "UTC" }}`,
+	} {
+		_, err := v.Apply(tmpl, nil, "")
+		assert.CmpError(err, tmpl)
+	}
+}
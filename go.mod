@@ -11,8 +11,10 @@ require (
 	github.com/fabienm/go-logrus-formatters v1.0.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/go-gorp/gorp v2.2.0+incompatible
+	github.com/go-ldap/ldap/v3 v3.4.11
 	github.com/go-ping/ping v1.2.0
 	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/itchyny/gojq v0.12.17
 	github.com/jpillora/backoff v1.0.0
 	github.com/juju/errors v1.0.0
 	github.com/lib/pq v1.10.9
@@ -24,6 +26,7 @@ require (
 	github.com/ovh/go-ovh v1.7.0
 	github.com/ovh/symmecrypt v0.6.1
 	github.com/prometheus/client_golang v1.21.1
+	github.com/rabbitmq/amqp091-go v1.15.0
 	github.com/robertkrimen/otto v0.5.1
 	github.com/santhosh-tekuri/jsonschema v1.2.4
 	github.com/sirupsen/logrus v1.9.3
@@ -35,6 +38,7 @@ require (
 	github.com/ybriffa/go-http-digest-auth-client v0.6.3
 	golang.org/x/crypto v0.36.0
 	golang.org/x/net v0.38.0
+	golang.org/x/oauth2 v0.28.0
 	golang.org/x/sync v0.12.0
 	gopkg.in/mail.v2 v2.3.1
 	sigs.k8s.io/yaml v1.4.0
@@ -42,6 +46,7 @@ require (
 
 require (
 	dario.cat/mergo v1.0.1 // indirect
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/Masterminds/goutils v1.1.1 // indirect
 	github.com/Masterminds/semver/v3 v3.3.1 // indirect
 	github.com/SSSaaS/sssa-golang v0.0.0-20170502204618-d37d7782d752 // indirect
@@ -55,6 +60,7 @@ require (
 	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
 	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/gin-contrib/sse v1.0.0 // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.8-0.20250403174932-29230038a667 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.26.0 // indirect
@@ -65,6 +71,7 @@ require (
 	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
 	github.com/huandu/xstrings v1.5.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/itchyny/timefmt-go v0.1.6 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
@@ -98,7 +105,6 @@ require (
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/arch v0.15.0 // indirect
-	golang.org/x/oauth2 v0.28.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
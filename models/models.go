@@ -6,13 +6,16 @@ import (
 	"github.com/ovh/symmecrypt/keyloader"
 )
 
+// StorageKeyIdentifier is the identifier of the encryption key protecting task data in DB
+const StorageKeyIdentifier = "storage"
+
 // EncryptionKey holds the global key to encrypt/decrypt
 // task data in DB
 var EncryptionKey symmecrypt.Key
 
 // Init takes an instance of configstore and loads EncryptionKey from it
 func Init(store *configstore.Store) error {
-	k, err := keyloader.LoadKeyFromStore("storage", store)
+	k, err := keyloader.LoadKeyFromStore(StorageKeyIdentifier, store)
 	if err != nil {
 		return err
 	}
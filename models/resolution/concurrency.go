@@ -0,0 +1,88 @@
+package resolution
+
+import (
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/runnerinstance"
+)
+
+// A template can cap the amount of its resolutions running simultaneously,
+// across all the instances of µTask
+
+// LockTemplateConcurrency returns the concurrency cap of a template, along with
+// the count of its resolutions currently running
+// when the template is capped, it gets locked until the end of the current transaction,
+// so that the resolutions of that template are started one at a time
+func LockTemplateConcurrency(dbp zesty.DBProvider, templateID int64) (maxConcurrent *int, running int64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to check concurrency of template %d", templateID)
+
+	// NO KEY UPDATE doesn't conflict with the creation of tasks referencing the template
+	limit, err := dbp.DB().SelectNullInt(`SELECT "task_template".max_concurrent FROM "task_template"
+		WHERE "task_template".id = $1 AND "task_template".max_concurrent IS NOT NULL
+		FOR NO KEY UPDATE`, templateID)
+	if err != nil {
+		return nil, 0, pgjuju.Interpret(err)
+	}
+	if !limit.Valid {
+		return nil, 0, nil
+	}
+
+	running, err = dbp.DB().SelectInt(`SELECT count(*) FROM "resolution"
+		JOIN "task" ON "task".id = "resolution".id_task
+		WHERE "task".id_template = $1 AND "resolution".state = $2`, templateID, StateRunning)
+	if err != nil {
+		return nil, 0, pgjuju.Interpret(err)
+	}
+
+	maxConcurrent = new(int)
+	*maxConcurrent = int(limit.Int64)
+	return maxConcurrent, running, nil
+}
+
+type templateRunningCount struct {
+	Template string  `db:"template"`
+	Count    float64 `db:"running_count"`
+}
+
+// LoadRunningCountByTemplate returns the count of resolutions currently running, by template name
+func LoadRunningCountByTemplate(dbp zesty.DBProvider) (rc map[string]float64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load running resolutions stats")
+
+	s := []templateRunningCount{}
+	if _, err := dbp.DB().Select(&s, `SELECT "task_template".name as template, COALESCE(r.running_count, 0) as running_count
+		FROM "task_template"
+		LEFT JOIN (
+			SELECT "task".id_template, count(*) as running_count
+			FROM "resolution"
+			JOIN "task" ON "task".id = "resolution".id_task
+			WHERE "resolution".state = $1
+			GROUP BY "task".id_template
+		) r ON r.id_template = "task_template".id`, StateRunning); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	rc = make(map[string]float64, len(s))
+	for _, trc := range s {
+		rc[trc.Template] = trc.Count
+	}
+	return rc, nil
+}
+
+// LoadOrphanCount returns the count of resolutions owned by an instance which is dead or not listed anymore,
+// while running or crashed: they are eligible for a takeover by the instance collector of another instance
+func LoadOrphanCount(dbp zesty.DBProvider) (count int64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to count orphan resolutions")
+
+	count, err = dbp.DB().SelectInt(`SELECT count(*) FROM "resolution"
+		LEFT JOIN "runner_instance" ON "runner_instance".id = "resolution".instance_id
+		WHERE "resolution".instance_id IS NOT NULL
+		AND   "resolution".state IN ($1,$2,$3)
+		AND   ("runner_instance".id IS NULL OR "runner_instance".heartbeat < $4)`,
+		StateRunning, StateAutorunning, StateCrashed, runnerinstance.DeadBefore())
+	if err != nil {
+		return 0, pgjuju.Interpret(err)
+	}
+	return count, nil
+}
@@ -0,0 +1,50 @@
+package resolution
+
+import (
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/db/pgjuju"
+)
+
+// A resolution can't be halted while its engine holds it: the halt of its template
+// is recorded instead, and applied by the engine at the end of the current run
+
+// RunningStates are the states of a resolution held by its engine, halted at the end of their run
+var RunningStates = []string{
+	StateRunning,
+	StateAutorunning,
+}
+
+// RequestHalt records that a resolution should be left in the given state (PAUSED or CANCELLED)
+// at the end of its current run, overriding a previous request
+func RequestHalt(dbp zesty.DBProvider, resolutionID int64, state string) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to request the halt of resolution %d", resolutionID)
+
+	if _, err := dbp.DB().Exec(`INSERT INTO "resolution_halt" (id_resolution, state) VALUES ($1, $2)
+		ON CONFLICT (id_resolution) DO UPDATE SET state = $2, requested_at = now()`, resolutionID, state); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	return nil
+}
+
+// LoadHalt returns the state requested by the halt of a resolution, or an empty string when it wasn't halted
+func LoadHalt(dbp zesty.DBProvider, resolutionID int64) (state string, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load the halt of resolution %d", resolutionID)
+
+	s, err := dbp.DB().SelectNullStr(`SELECT state FROM "resolution_halt" WHERE id_resolution = $1`, resolutionID)
+	if err != nil {
+		return "", pgjuju.Interpret(err)
+	}
+	return s.String, nil
+}
+
+// ClearHalt removes the halt of a resolution, once applied
+func ClearHalt(dbp zesty.DBProvider, resolutionID int64) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to clear the halt of resolution %d", resolutionID)
+
+	if _, err := dbp.DB().Exec(`DELETE FROM "resolution_halt" WHERE id_resolution = $1`, resolutionID); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	return nil
+}
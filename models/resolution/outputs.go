@@ -0,0 +1,315 @@
+package resolution
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/ovh/symmecrypt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/engine/step"
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/pkg/compress"
+	"github.com/cneill/utask/pkg/outputstore"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// replacedOutputsPageSize is the number of replaced outputs deleted per transaction
+const replacedOutputsPageSize = 100
+
+// spillOutputs returns the steps to persist in DB: the outputs larger than their limit
+// are compressed, encrypted and stored in the step output store, and replaced by a reference
+// the steps of the resolution are left untouched, their outputs still being used by the engine
+// keep is called before an output is stored, for it not to be deleted if it was replaced by a previous update
+// the stored outputs not referenced anymore are recorded, to be deleted once the update is committed
+func (r *Resolution) spillOutputs(c compress.Compression, keep func(name string) error) (map[string]*step.Step, error) {
+	if !outputstore.Enabled() {
+		return r.Steps, nil
+	}
+
+	steps := make(map[string]*step.Step, len(r.Steps))
+	spilled := make(map[string]string, len(r.storedOutputs))
+	for name, s := range r.Steps {
+		steps[name] = s
+
+		if s.Output == nil {
+			continue
+		}
+
+		data, err := json.Marshal(s.Output)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= outputstore.MaxBytes(s.SpillOutputBytes) {
+			continue
+		}
+
+		// an unchanged output was already stored, unless it was encrypted with a previous key
+		outputName := outputstore.Name(r.PublicID, name, data)
+		if r.storedOutputs[name] != outputName || r.staleOutputs[name] {
+			compressed, err := c.Compress(data)
+			if err != nil {
+				return nil, err
+			}
+			encrypted, err := models.EncryptionKey.Encrypt(compressed, []byte(r.PublicID))
+			if err != nil {
+				return nil, err
+			}
+			if err := keep(outputName); err != nil {
+				return nil, err
+			}
+			if err := outputstore.Put(context.Background(), outputName, encrypted); err != nil {
+				return nil, errors.Annotatef(err, "failed to store the output of step %s", name)
+			}
+			delete(r.staleOutputs, name)
+		}
+		spilled[name] = outputName
+
+		withRef := *s
+		withRef.Output = nil
+		withRef.OutputRef = &step.OutputRef{Name: outputName, Size: len(data)}
+		steps[name] = &withRef
+	}
+
+	// outputs which changed, shrank or whose step is gone
+	for name, outputName := range r.storedOutputs {
+		if spilled[name] != outputName {
+			r.replacedOutputs = append(r.replacedOutputs, outputName)
+		}
+	}
+	r.storedOutputs = spilled
+
+	return steps, nil
+}
+
+// recordReplacedOutputs lists the stored outputs not referenced anymore by the resolution, within the transaction
+// updating it: they are deleted by the garbage collector once the update is committed, and kept if it is rolled back
+func (r *Resolution) recordReplacedOutputs(dbp zesty.DBProvider) error {
+	for _, name := range r.replacedOutputs {
+		if _, err := dbp.DB().Exec(`INSERT INTO "replaced_output" (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+			return pgjuju.Interpret(err)
+		}
+	}
+	r.replacedOutputs = nil
+	return nil
+}
+
+// keepOutput removes an output from the replaced outputs, before it is stored again
+// an output being deleted by the garbage collector is waited for, to be stored once it is gone
+func keepOutput(dbp zesty.DBProvider, name string) error {
+	if _, err := dbp.DB().Exec(`DELETE FROM "replaced_output" WHERE name = $1`, name); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	return nil
+}
+
+// DeleteReplacedOutputs removes from the step output store the outputs replaced by the committed updates of resolutions
+// the outputs failing to be deleted are kept, to be deleted on the next run
+func DeleteReplacedOutputs(ctx context.Context, dbp zesty.DBProvider) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to delete the replaced outputs")
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		deleted, failed, err := deleteReplacedOutputsPage(ctx, dbp)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return errors.Errorf("%d outputs failed to be deleted", failed)
+		}
+		if deleted == 0 {
+			return nil
+		}
+	}
+}
+
+// deleteReplacedOutputsPage deletes a page of replaced outputs, locked until they are deleted
+// so that an update storing one of them again waits for it to be gone
+func deleteReplacedOutputsPage(ctx context.Context, dbp zesty.DBProvider) (deleted, failed int, err error) {
+	if err := dbp.Tx(); err != nil {
+		return 0, 0, err
+	}
+
+	var names []string
+	if _, err := dbp.DB().Select(&names, `SELECT name FROM "replaced_output"
+		ORDER BY replaced_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, replacedOutputsPageSize); err != nil {
+		dbp.Rollback()
+		return 0, 0, pgjuju.Interpret(err)
+	}
+
+	done := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := outputstore.Delete(ctx, name); err != nil {
+			failed++
+			continue
+		}
+		done = append(done, name)
+	}
+
+	if _, err := dbp.DB().Exec(`DELETE FROM "replaced_output" WHERE name = ANY($1)`, pq.Array(done)); err != nil {
+		dbp.Rollback()
+		return 0, 0, pgjuju.Interpret(err)
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return 0, 0, err
+	}
+
+	return len(done), failed, nil
+}
+
+// loadOutputs loads back the outputs of the steps from the step output store
+// an output encrypted with a previous key is stored again on the next update
+// unless strict, an output failing to be loaded is left as its reference, for the resolution to be displayed
+// while the step output store is unavailable
+func (r *Resolution) loadOutputs(c compress.Compression, strict bool) error {
+	for name, s := range r.Steps {
+		if s.OutputRef == nil {
+			continue
+		}
+
+		output, latest, err := r.loadOutput(c, s.OutputRef.Name)
+		if err != nil {
+			err = errors.Annotatef(err, "failed to load the output of step %s", name)
+			if strict {
+				return err
+			}
+			logrus.WithError(err).WithField("resolution_id", r.PublicID).Warn("step output left as its reference")
+			continue
+		}
+
+		if r.storedOutputs == nil {
+			r.storedOutputs = make(map[string]string)
+		}
+		r.storedOutputs[name] = s.OutputRef.Name
+		if !latest {
+			r.markStaleOutput(name)
+		}
+		s.Output = output
+		s.OutputRef = nil
+	}
+
+	return nil
+}
+
+// loadOutput loads an output from the step output store, telling whether it was encrypted with the latest key
+func (r *Resolution) loadOutput(c compress.Compression, name string) (interface{}, bool, error) {
+	encrypted, err := outputstore.Get(context.Background(), name)
+	if err != nil {
+		return nil, false, err
+	}
+	compressed, latest, err := decryptOutput(encrypted, []byte(r.PublicID))
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := c.Decompress(compressed)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var output interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(data), &output); err != nil {
+		return nil, false, err
+	}
+	return output, latest, nil
+}
+
+// rotateOutputs makes the next update store again all the outputs of the resolution,
+// encrypting them with the latest storage key
+func (r *Resolution) rotateOutputs() {
+	for name := range r.storedOutputs {
+		r.markStaleOutput(name)
+	}
+}
+
+func (r *Resolution) markStaleOutput(name string) {
+	if r.staleOutputs == nil {
+		r.staleOutputs = make(map[string]bool)
+	}
+	r.staleOutputs[name] = true
+}
+
+// decryptOutput decrypts a stored output, and asserts that it was encrypted with the latest storage key
+func decryptOutput(encrypted, extra []byte) ([]byte, bool, error) {
+	if ck, ok := models.EncryptionKey.(symmecrypt.CompositeKey); ok && len(ck) > 1 {
+		if data, err := ck[0].Decrypt(encrypted, extra); err == nil {
+			return data, true, nil
+		}
+		data, err := ck[1:].Decrypt(encrypted, extra)
+		return data, false, err
+	}
+	data, err := models.EncryptionKey.Decrypt(encrypted, extra)
+	return data, true, err
+}
+
+// DeleteOutputs removes from the step output store the outputs of the resolution,
+// once it was deleted from DB
+func (r *Resolution) DeleteOutputs(ctx context.Context) error {
+	names := make([]string, 0, len(r.storedOutputs)+len(r.replacedOutputs))
+	for _, name := range r.storedOutputs {
+		names = append(names, name)
+	}
+	names = append(names, r.replacedOutputs...)
+	if len(names) == 0 {
+		return nil
+	}
+	if err := outputstore.Delete(ctx, names...); err != nil {
+		return err
+	}
+	r.storedOutputs = nil
+	r.replacedOutputs = nil
+	return nil
+}
+
+// StoredOutputNames returns the names of the step outputs kept in the step output store
+// by the resolutions of the given tasks, to delete them along with the tasks
+// the outputs are not loaded from the store
+func StoredOutputNames(dbp zesty.DBProvider, taskIDs ...int64) (names []string, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list the stored outputs of resolutions")
+
+	if !outputstore.Enabled() || len(taskIDs) == 0 {
+		return nil, nil
+	}
+
+	query, params, err := rSelector.Where(
+		squirrel.Expr(`"resolution".id_task = ANY(?)`, pq.Array(taskIDs)),
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var resolutions []*Resolution
+	if _, err := dbp.DB().Select(&resolutions, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	for _, r := range resolutions {
+		c, err := compress.Get(r.StepsCompressionAlg)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := r.decryptSteps(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range steps {
+			if s.OutputRef != nil {
+				names = append(names, s.OutputRef.Name)
+			}
+		}
+	}
+
+	return names, nil
+}
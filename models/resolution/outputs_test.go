@@ -0,0 +1,213 @@
+package resolution
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/symmecrypt"
+	"github.com/ovh/symmecrypt/keyloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/engine/step"
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/pkg/compress/gzip"
+	"github.com/cneill/utask/pkg/outputstore"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	outputs map[string][]byte
+	puts    int
+}
+
+func (s *memoryStore) Store(_ context.Context, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs[name] = data
+	s.puts++
+	return nil
+}
+
+func (s *memoryStore) Load(_ context.Context, name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.outputs[name]
+	if !ok {
+		return nil, errors.NotFoundf("output %q", name)
+	}
+	return data, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.outputs, name)
+	return nil
+}
+
+func newTestKey(t *testing.T, identifier string, timestamp time.Time) symmecrypt.Key {
+	cfg, err := keyloader.GenerateKey("aes-gcm", identifier, false, timestamp)
+	require.NoError(t, err)
+	k, err := keyloader.NewKey(cfg)
+	require.NoError(t, err)
+	return k
+}
+
+// reload simulates a resolution persisted in DB then loaded back, with its spilled steps
+func reload(t *testing.T, publicID string, steps map[string]*step.Step) *Resolution {
+	data, err := json.Marshal(steps)
+	require.NoError(t, err)
+	r := &Resolution{DBModel: DBModel{PublicID: publicID}}
+	require.NoError(t, json.Unmarshal(data, &r.Steps))
+	require.NoError(t, r.loadOutputs(gzip.New(), true))
+	return r
+}
+
+func TestSpillOutputs(t *testing.T) {
+	oldKey := newTestKey(t, "storage", time.Now().Add(-time.Hour))
+	newKey := newTestKey(t, "storage", time.Now())
+	prevKey := models.EncryptionKey
+	models.EncryptionKey = oldKey
+	defer func() { models.EncryptionKey = prevKey }()
+
+	store := &memoryStore{outputs: map[string][]byte{}}
+	require.NoError(t, outputstore.Register(store, 64))
+	defer outputstore.Unregister()
+
+	var kept []string
+	keep := func(name string) error {
+		kept = append(kept, name)
+		return nil
+	}
+
+	c := gzip.New()
+	large := map[string]interface{}{"payload": strings.Repeat("a", 100)}
+	r := &Resolution{
+		DBModel: DBModel{PublicID: "res"},
+		Steps: map[string]*step.Step{
+			"large": {Output: large},
+			"small": {Output: "small"},
+			"none":  {},
+		},
+	}
+
+	// large outputs are replaced by a reference, the resolution keeps them
+	steps, err := r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	require.NotNil(t, steps["large"].OutputRef)
+	assert.Nil(t, steps["large"].Output)
+	assert.Equal(t, large, r.Steps["large"].Output)
+	assert.Nil(t, steps["small"].OutputRef)
+	assert.Equal(t, "small", steps["small"].Output)
+	assert.Len(t, store.outputs, 1)
+	assert.Equal(t, 1, store.puts)
+	name := steps["large"].OutputRef.Name
+	assert.Equal(t, []string{name}, kept, "a stored output is kept from the garbage collector")
+
+	// and loaded back with the resolution
+	r = reload(t, "res", steps)
+	assert.Equal(t, map[string]interface{}{"payload": strings.Repeat("a", 100)}, r.Steps["large"].Output)
+	assert.Nil(t, r.Steps["large"].OutputRef)
+	assert.Equal(t, "small", r.Steps["small"].Output)
+
+	// an unchanged output is not stored again
+	steps, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	assert.Equal(t, name, steps["large"].OutputRef.Name)
+	assert.Equal(t, 1, store.puts)
+
+	// after a key rotation, outputs encrypted with the previous key are stored again with the new one
+	models.EncryptionKey = symmecrypt.CompositeKey{newKey, oldKey}
+	r = reload(t, "res", steps)
+	assert.True(t, r.staleOutputs["large"])
+	steps, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.puts)
+	assert.Empty(t, r.staleOutputs)
+
+	// once the previous key is retired, the resolution can still be loaded
+	models.EncryptionKey = newKey
+	r = reload(t, "res", steps)
+	assert.Empty(t, r.staleOutputs)
+
+	// the rotation of resolutions stores all their outputs again
+	r.rotateOutputs()
+	steps, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.puts)
+
+	// a replaced output is listed to be deleted once the update is committed, and left in the store until then
+	r.Steps["large"].Output = map[string]interface{}{"payload": strings.Repeat("b", 100)}
+	steps, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	replacing := steps["large"].OutputRef.Name
+	assert.NotEqual(t, name, replacing)
+	assert.Equal(t, []string{name}, r.replacedOutputs)
+	assert.Len(t, store.outputs, 2)
+	assert.Contains(t, store.outputs, name)
+
+	// as is an output which shrank
+	r.replacedOutputs = nil
+	r.Steps["large"].Output = "small again"
+	steps, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	assert.Nil(t, steps["large"].OutputRef)
+	assert.Equal(t, []string{replacing}, r.replacedOutputs)
+	assert.Len(t, store.outputs, 2)
+	store.outputs = map[string][]byte{}
+
+	// outputs are deleted along with their resolution
+	r.Steps["large"].Output = large
+	_, err = r.spillOutputs(c, keep)
+	require.NoError(t, err)
+	assert.Len(t, store.outputs, 1)
+	require.NoError(t, r.DeleteOutputs(context.Background()))
+	assert.Empty(t, store.outputs)
+}
+
+func TestLoadOutputsUnavailable(t *testing.T) {
+	prevKey := models.EncryptionKey
+	models.EncryptionKey = newTestKey(t, "storage", time.Now())
+	defer func() { models.EncryptionKey = prevKey }()
+
+	store := &memoryStore{outputs: map[string][]byte{}}
+	require.NoError(t, outputstore.Register(store, 64))
+	defer outputstore.Unregister()
+
+	r := &Resolution{
+		DBModel: DBModel{PublicID: "res"},
+		Steps: map[string]*step.Step{
+			"large": {Output: map[string]interface{}{"payload": strings.Repeat("a", 100)}},
+		},
+	}
+	steps, err := r.spillOutputs(gzip.New(), func(string) error { return nil })
+	require.NoError(t, err)
+	ref := steps["large"].OutputRef
+	require.NotNil(t, ref)
+
+	// the output store losing the output, the resolution loaded to be run fails
+	store.outputs = map[string][]byte{}
+	data, err := json.Marshal(steps)
+	require.NoError(t, err)
+	r = &Resolution{DBModel: DBModel{PublicID: "res"}}
+	require.NoError(t, json.Unmarshal(data, &r.Steps))
+	assert.Error(t, r.loadOutputs(gzip.New(), true))
+
+	// while the one loaded to be displayed keeps the reference of the output
+	require.NoError(t, r.loadOutputs(gzip.New(), false))
+	assert.Nil(t, r.Steps["large"].Output)
+	require.NotNil(t, r.Steps["large"].OutputRef)
+	assert.Equal(t, ref.Name, r.Steps["large"].OutputRef.Name)
+
+	// and stores it as is when updated
+	steps, err = r.spillOutputs(gzip.New(), func(string) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, ref.Name, steps["large"].OutputRef.Name)
+	assert.Empty(t, r.replacedOutputs)
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/cneill/utask"
@@ -21,6 +23,7 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/gofrs/uuid"
 	"github.com/juju/errors"
+	"github.com/lib/pq"
 	"github.com/loopfz/gadgeto/zesty"
 )
 
@@ -41,6 +44,7 @@ const (
 	StateBlockedDeadlock   = "BLOCKED_DEADLOCK"   // blocked by unsolvable dependencies
 	StateBlockedMaxRetries = "BLOCKED_MAXRETRIES" // has reached max retries, still failing
 	StateBlockedFatal      = "BLOCKED_FATAL"      // encountered a fatal non-client error
+	StateBlockedApproval   = "BLOCKED_APPROVAL"   // waiting for a resolution manager to approve a step
 
 	// collectable
 
@@ -60,6 +64,8 @@ type Resolution struct {
 	DBModel
 	TaskPublicID                     string                 `json:"task_id" db:"task_public_id"`
 	TaskTitle                        string                 `json:"task_title" db:"task_title"`
+	TemplateName                     string                 `json:"template_name,omitempty" db:"template_name"`
+	InstanceHeartbeat                *time.Time             `json:"instance_heartbeat,omitempty" db:"instance_heartbeat"`
 	Values                           *values.Values         `json:"-" db:"-"`                         // never persisted: rebuilt on instantiation
 	Steps                            map[string]*step.Step  `json:"steps,omitempty" db:"-"`           // persisted in encrypted blob
 	ResolverInput                    map[string]interface{} `json:"resolver_inputs,omitempty" db:"-"` // persisted in encrypted blob
@@ -67,6 +73,11 @@ type Resolution struct {
 	StepTreeIndexPrune               map[string][]string    `json:"-" db:"-"`
 	StepList                         []string               `json:"-" db:"-"`
 	ForeachChildrenAlreadyContracted map[string]bool        `json:"-" db:"-"`
+	StepExecutionsMax                int                    `json:"-" db:"-"`                                // never persisted: computed on each run, 0 for no limit
+	RetryBudgetRemaining             *int                   `json:"retry_budget_remaining,omitempty" db:"-"` // never persisted: computed on load, nil for no limit
+	storedOutputs                    map[string]string      // names of the step outputs kept in the step output store, by step
+	staleOutputs                     map[string]bool        // steps whose stored output was encrypted with a previous key
+	replacedOutputs                  []string               // names of the stored outputs not referenced anymore, to be recorded
 }
 
 // DBModel is a resolution's representation in DB
@@ -85,12 +96,19 @@ type DBModel struct {
 	RunCount   int        `json:"run_count" db:"run_count"`
 	RunMax     int        `json:"run_max" db:"run_max"`
 
+	StepExecutions int  `json:"step_executions" db:"step_executions"`
+	StepRetries    int  `json:"step_retries" db:"step_retries"`
+	RetryBudget    *int `json:"retry_budget,omitempty" db:"retry_budget"` // max step retries, all steps included, nil for no limit
+
 	CryptKey            []byte `json:"-" db:"crypt_key"` // key for encrypting steps (itself encrypted with master key)
 	EncryptedInput      []byte `json:"-" db:"encrypted_resolver_input"`
 	EncryptedSteps      []byte `json:"-" db:"encrypted_steps"`       // encrypted Steps map
+	EncryptedSecrets    []byte `json:"-" db:"encrypted_secrets"`     // encrypted values of the secret scope
 	StepsCompressionAlg string `json:"-" db:"steps_compression_alg"` // compression algorithm used
 
 	BaseConfigurations map[string]json.RawMessage `json:"base_configurations" db:"base_configurations"`
+
+	Revision int `json:"revision" db:"revision"` // incremented on each update, to detect concurrent edits
 }
 
 // Create inserts a new resolution in DB
@@ -102,6 +120,11 @@ func Create(dbp zesty.DBProvider, t *task.Task, resolverInputs map[string]interf
 		return nil, err
 	}
 
+	if t.Assignee != nil && *t.Assignee != resUser {
+		err = errors.Forbiddenf("Task is assigned to %s", *t.Assignee)
+		return nil, err
+	}
+
 	r = &Resolution{
 		DBModel: DBModel{
 			PublicID:         uuid.Must(uuid.NewV4()).String(),
@@ -109,6 +132,7 @@ func Create(dbp zesty.DBProvider, t *task.Task, resolverInputs map[string]interf
 			ResolverUsername: resUser,
 			State:            StateTODO,
 			Created:          now.Get(),
+			Revision:         1,
 		},
 		TaskPublicID: t.PublicID,
 		Values:       values.NewValues(),
@@ -127,7 +151,7 @@ func Create(dbp zesty.DBProvider, t *task.Task, resolverInputs map[string]interf
 	// force empty to stop using old crypto code
 	r.CryptKey = []byte{}
 
-	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	tt, err := tasktemplate.LoadVersion(dbp, t.TemplateID, t.TemplateVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +167,7 @@ func Create(dbp zesty.DBProvider, t *task.Task, resolverInputs map[string]interf
 	} else {
 		r.RunMax = utask.DefaultRetryMax
 	}
+	r.RetryBudget = tt.RetryBudget
 
 	r.BaseConfigurations = tt.BaseConfigurations
 
@@ -245,12 +270,78 @@ func load(dbp zesty.DBProvider, publicID string, locked bool, lockNoWait bool) (
 	}
 
 	r.Values = values.NewValues()
+	r.RetryBudgetRemaining = r.retryBudgetRemaining()
 
 	c, err := compress.Get(r.StepsCompressionAlg)
 	if err != nil {
 		return nil, err
 	}
 
+	st, err := r.decryptSteps(c)
+	if err != nil {
+		return nil, err
+	}
+	r.setSteps(st)
+
+	// the resolutions loaded to be updated need their outputs, the others are only displayed
+	if err := r.loadOutputs(c, locked); err != nil {
+		return nil, err
+	}
+
+	input := make(map[string]interface{})
+	err = models.EncryptionKey.DecryptMarshal(string(r.EncryptedInput), &input, []byte(r.PublicID))
+	if err != nil {
+		return nil, err
+	}
+	r.SetInput(input)
+
+	if err := r.loadSecrets(); err != nil {
+		return nil, err
+	}
+
+	r.BuildStepTree()
+
+	return r, nil
+}
+
+// encryptSecrets stores the secrets registered by the runs of the resolution, encrypted along with its steps,
+// for its results to be redacted when they are displayed
+func (r *Resolution) encryptSecrets() error {
+	if r.Values == nil {
+		return nil
+	}
+	secrets := r.Values.SecretScope().Values()
+	if len(secrets) == 0 {
+		r.EncryptedSecrets = nil
+		return nil
+	}
+	encrSecrets, err := models.EncryptionKey.EncryptMarshal(secrets, []byte(r.PublicID))
+	if err != nil {
+		return err
+	}
+	r.EncryptedSecrets = []byte(encrSecrets)
+	return nil
+}
+
+// loadSecrets restores the secrets registered during the previous runs of the resolution,
+// to keep redacting them from its results
+func (r *Resolution) loadSecrets() error {
+	if len(r.EncryptedSecrets) == 0 {
+		return nil
+	}
+	var secrets []string
+	if err := models.EncryptionKey.DecryptMarshal(string(r.EncryptedSecrets), &secrets, []byte(r.PublicID)); err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		r.Values.SecretScope().Register(secret)
+	}
+	return nil
+}
+
+// decryptSteps decrypts the steps of the resolution as stored in DB,
+// the outputs kept in the step output store being left as references
+func (r *Resolution) decryptSteps(c compress.Compression) (map[string]*step.Step, error) {
 	dst := make([]byte, hex.DecodedLen(len(r.EncryptedSteps)))
 
 	// if we can't hex Decode, we might be in the case of a Resolution row in database that was
@@ -259,7 +350,7 @@ func load(dbp zesty.DBProvider, publicID string, locked bool, lockNoWait bool) (
 	// often.
 	// See https://github.com/cneill/utask/commit/bf23fbb10b62bb487ac4ea01b1e519f85480e58b and migration
 	// from symmecrypt.Key.DecryptMarshal to symmecrypt.Key.Decrypt
-	if _, err = hex.Decode(dst, r.EncryptedSteps); err != nil {
+	if _, err := hex.Decode(dst, r.EncryptedSteps); err != nil {
 		dst = r.EncryptedSteps
 	}
 
@@ -277,18 +368,7 @@ func load(dbp zesty.DBProvider, publicID string, locked bool, lockNoWait bool) (
 	if err := utils.JSONnumberUnmarshal(bytes.NewReader(jsonSteps), &st); err != nil {
 		return nil, err
 	}
-	r.setSteps(st)
-
-	input := make(map[string]interface{})
-	err = models.EncryptionKey.DecryptMarshal(string(r.EncryptedInput), &input, []byte(r.PublicID))
-	if err != nil {
-		return nil, err
-	}
-	r.SetInput(input)
-
-	r.BuildStepTree()
-
-	return r, nil
+	return st, nil
 }
 
 // BuildStepTree re-generates a dependency graph for the steps
@@ -372,6 +452,215 @@ func ListResolutions(dbp zesty.DBProvider, t *task.Task, resolverUsername *strin
 	return r, nil
 }
 
+// ActionableStates are the states of a resolution waiting for a human action
+var ActionableStates = []string{
+	StateTODO,
+	StatePaused,
+	StateBlockedToCheck,
+	StateBlockedBadRequest,
+	StateBlockedDeadlock,
+	StateBlockedMaxRetries,
+	StateBlockedFatal,
+	StateBlockedApproval,
+}
+
+// ActionableFilter holds the parameters used to list the resolutions a user can act on
+type ActionableFilter struct {
+	ResolverUsername string
+	ResolverGroups   []string
+	States           []string // defaults to ActionableStates
+	Template         *string
+	PageSize         uint64
+	Last             *string
+}
+
+// ListActionable returns the resolutions in an actionable state for which a user
+// is an allowed resolver, be it through the task's template, the task itself or the resolution
+// the resolutions are simplified and do not include the content of steps
+func ListActionable(dbp zesty.DBProvider, filter ActionableFilter) (r []*Resolution, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list actionable resolutions")
+
+	states := filter.States
+	if len(states) == 0 {
+		states = ActionableStates
+	}
+
+	argUser := strconv.Quote(filter.ResolverUsername)
+	resolver := squirrel.Or{
+		squirrel.Eq{`"resolution".resolver_username`: filter.ResolverUsername},
+		squirrel.Expr(`"task_template".allowed_resolver_usernames @> ?::jsonb`, argUser),
+		squirrel.Expr(`"task".resolver_usernames @> ?::jsonb`, argUser),
+	}
+	if len(filter.ResolverGroups) > 0 {
+		argGroups, err := pq.Array(filter.ResolverGroups).Value()
+		if err != nil {
+			return nil, err
+		}
+		resolver = append(resolver,
+			// To escape "?", insert two "?" (see https://github.com/Masterminds/squirrel/pull/32)
+			squirrel.Expr(`"task_template".allowed_resolver_groups ??| ?`, argGroups),
+			squirrel.Expr(`"task".resolver_groups ??| ?`, argGroups),
+		)
+	}
+
+	sel := rSelector.Column(
+		`"task_template".name as template_name`,
+	).Join(
+		`"task_template" on "task_template".id = "task".id_template`,
+	).Where(
+		squirrel.Eq{`"resolution".state`: states},
+	).Where(
+		resolver,
+	).Limit(
+		filter.PageSize,
+	)
+
+	if filter.Template != nil {
+		sel = sel.Where(squirrel.Eq{`"task_template".name`: *filter.Template})
+	}
+
+	if filter.Last != nil {
+		lastR, err := LoadFromPublicID(dbp, *filter.Last)
+		if err != nil {
+			return nil, err
+		}
+		sel = sel.Where(`"resolution".id > ?`, lastR.ID)
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&r, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return r, nil
+}
+
+// ExtendableStates are the states of a resolution whose retry limit can be extended
+var ExtendableStates = []string{
+	StateBlockedMaxRetries,
+	StateError,
+	StateCrashed,
+}
+
+// ExtendableFilter holds the parameters used to select the resolutions to extend in bulk
+type ExtendableFilter struct {
+	Template *string
+	Tags     map[string]string
+	States   []string // defaults to BLOCKED_MAXRETRIES
+}
+
+// ListExtendable returns the resolutions matching a filter, locking them for the current transaction
+// resolutions already locked, e.g. by a running engine, are skipped
+// the resolutions are simplified and do not include the content of steps
+func ListExtendable(dbp zesty.DBProvider, filter ExtendableFilter) (r []*Resolution, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list extendable resolutions")
+
+	states := filter.States
+	if len(states) == 0 {
+		states = []string{StateBlockedMaxRetries}
+	}
+
+	return listLocked(dbp, filter.Template, filter.Tags, states)
+}
+
+// HaltableStates are the states of a resolution which can be paused or cancelled when halting its template
+// running resolutions are left to their engine, which holds them until the end of their current run
+var HaltableStates = []string{
+	StateTODO,
+	StatePaused,
+	StateBlockedToCheck,
+	StateBlockedBadRequest,
+	StateBlockedDeadlock,
+	StateBlockedMaxRetries,
+	StateBlockedFatal,
+	StateBlockedApproval,
+	StateWaiting,
+	StateCrashed,
+	StateRetry,
+	StateError,
+	StateToAutorun,
+	StateToAutorunDelayed,
+}
+
+// ListHaltable returns the resolutions of a template in one of the given states,
+// locking them for the current transaction; resolutions already locked are skipped
+// the resolutions are simplified and do not include the content of steps
+func ListHaltable(dbp zesty.DBProvider, templateName string, states []string) (r []*Resolution, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list haltable resolutions")
+
+	return listLocked(dbp, &templateName, nil, states)
+}
+
+// CountFromTemplate returns the number of resolutions of a template, except those in one of the excluded states
+func CountFromTemplate(dbp zesty.DBProvider, templateName string, excludedStates []string) (count int64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to count resolutions of template %q", templateName)
+
+	sel := sqlgenerator.PGsql.Select(
+		`COUNT(*)`,
+	).From(
+		`"resolution"`,
+	).Join(
+		`"task" on "task".id = "resolution".id_task`,
+	).Join(
+		`"task_template" on "task_template".id = "task".id_template`,
+	).Where(
+		squirrel.Eq{`"task_template".name`: templateName},
+	).Where(
+		squirrel.NotEq{`"resolution".state`: excludedStates},
+	)
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	count, err = dbp.DB().SelectInt(query, params...)
+	if err != nil {
+		return 0, pgjuju.Interpret(err)
+	}
+	return count, nil
+}
+
+// listLocked returns the resolutions matching a template, tags and states, locking them for the current transaction
+func listLocked(dbp zesty.DBProvider, template *string, tags map[string]string, states []string) (r []*Resolution, err error) {
+	sel := rSelector.Column(
+		`"task_template".name as template_name`,
+	).Join(
+		`"task_template" on "task_template".id = "task".id_template`,
+	).Where(
+		squirrel.Eq{`"resolution".state`: states},
+	).Suffix(
+		`FOR NO KEY UPDATE OF "resolution" SKIP LOCKED`,
+	)
+
+	if template != nil {
+		sel = sel.Where(squirrel.Eq{`"task_template".name`: *template})
+	}
+
+	if len(tags) > 0 {
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return nil, err
+		}
+		sel = sel.Where(`"task".tags @> ?::jsonb`, string(b))
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&r, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return r, nil
+}
+
 // Update commits any changes of state in Resolution to DB
 func (r *Resolution) Update(dbp zesty.DBProvider) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to update resolution")
@@ -383,7 +672,14 @@ func (r *Resolution) Update(dbp zesty.DBProvider) (err error) {
 		return err
 	}
 
-	jsonSteps, err := json.Marshal(r.Steps)
+	steps, err := r.spillOutputs(c, func(name string) error {
+		return keepOutput(dbp, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	jsonSteps, err := json.Marshal(steps)
 	if err != nil {
 		return err
 	}
@@ -407,9 +703,15 @@ func (r *Resolution) Update(dbp zesty.DBProvider) (err error) {
 	}
 	r.EncryptedInput = []byte(encrInput)
 
+	if err := r.encryptSecrets(); err != nil {
+		return err
+	}
+
 	// force empty to stop using old crypto code
 	r.CryptKey = []byte{}
 
+	r.Revision++
+
 	rows, err := dbp.DB().Update(&r.DBModel)
 	if err != nil {
 		return pgjuju.Interpret(err)
@@ -417,10 +719,15 @@ func (r *Resolution) Update(dbp zesty.DBProvider) (err error) {
 		return errors.NotFoundf("No such resolution to update: %s", r.PublicID)
 	}
 
+	if err := r.recordReplacedOutputs(dbp); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // Delete removes the Resolution from DB
+// its outputs kept in the step output store are removed by DeleteOutputs
 func (r *Resolution) Delete(dbp zesty.DBProvider) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to update resolution")
 
@@ -440,52 +747,86 @@ func (r *Resolution) Delete(dbp zesty.DBProvider) (err error) {
 func RotateResolutions(dbp zesty.DBProvider) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to rotate encrypted resolutions to new key")
 
-	var last string
+	var last int64
 	for {
-		var lastID *string
-		if last != "" {
-			lastID = &last
+		sp, err := dbp.TxSavepoint()
+		if err != nil {
+			return err
 		}
-		resolutions, err := ListResolutions(dbp,
-			nil, // task
-			nil, // resolverUsername
-			nil, // state
-			nil, // instanceID
-			utask.MaxPageSize,
-			lastID)
+		lastID, count, err := RotateResolutionsBatch(dbp, last, utask.MaxPageSize)
 		if err != nil {
+			dbp.RollbackTo(sp)
+			return err
+		}
+		// commit
+		if err := dbp.Commit(); err != nil {
 			return err
 		}
-		if len(resolutions) == 0 {
+		if count == 0 {
 			break
 		}
-		last = resolutions[len(resolutions)-1].PublicID
+		last = lastID
+	}
 
-		for _, r := range resolutions {
-			sp, err := dbp.TxSavepoint()
-			if err != nil {
-				return err
-			}
-			// load resolution locked (decrypt)
-			res, err := LoadLockedFromPublicID(dbp, r.PublicID)
-			if err != nil {
-				dbp.RollbackTo(sp)
-				return err
-			}
-			// update resolution (encrypt)
-			if err := res.Update(dbp); err != nil {
-				dbp.RollbackTo(sp)
-				return err
-			}
-			// commit
-			if err := dbp.Commit(); err != nil {
-				return err
-			}
+	return nil
+}
+
+// RotateResolutionsBatch re-encrypts with the latest available storage key
+// up to size resolutions, following the resolution with the DB id afterID,
+// within the current transaction of dbp. It returns the DB id of
+// the last resolution handled, and the count of resolutions handled
+func RotateResolutionsBatch(dbp zesty.DBProvider, afterID int64, size uint64) (lastID int64, count int, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to rotate a batch of encrypted resolutions to new key")
+
+	query, params, err := sqlgenerator.PGsql.Select(
+		`"resolution".id, "resolution".public_id`,
+	).From(
+		`"resolution"`,
+	).Where(
+		squirrel.Gt{`"resolution".id`: afterID},
+	).OrderBy(
+		`"resolution".id`,
+	).Limit(
+		size,
+	).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
 
+	var ids []rotationID
+	if _, err := dbp.DB().Select(&ids, query, params...); err != nil {
+		return 0, 0, pgjuju.Interpret(err)
+	}
+
+	for _, id := range ids {
+		// load resolution locked (decrypt)
+		r, err := LoadLockedFromPublicID(dbp, id.PublicID)
+		if err != nil {
+			return 0, 0, err
+		}
+		// update resolution (encrypt), storing again its outputs kept in the step output store
+		r.rotateOutputs()
+		if err := r.Update(dbp); err != nil {
+			return 0, 0, err
 		}
+		lastID = id.ID
 	}
 
-	return nil
+	return lastID, len(ids), nil
+}
+
+// CountResolutionsAfter returns the count of resolutions following the resolution with the DB id afterID
+func CountResolutionsAfter(dbp zesty.DBProvider, afterID int64) (int64, error) {
+	count, err := dbp.DB().SelectInt(`SELECT count(*) FROM "resolution" WHERE "resolution".id > $1`, afterID)
+	if err != nil {
+		return 0, pgjuju.Interpret(err)
+	}
+	return count, nil
+}
+
+type rotationID struct {
+	ID       int64  `db:"id"`
+	PublicID string `db:"public_id"`
 }
 
 // SetState changes the Resolution's state
@@ -522,6 +863,40 @@ func (r *Resolution) IncrementRunCount() {
 	r.RunCount++
 }
 
+// IncrementStepExecutions records that a step of this resolution is about to be executed
+// (relevant to keep track of StepExecutions < StepExecutionsMax)
+func (r *Resolution) IncrementStepExecutions() {
+	r.StepExecutions++
+}
+
+// StepExecutionsExceeded tells if the resolution performed as many step executions as it is allowed to
+func (r *Resolution) StepExecutionsExceeded() bool {
+	return r.StepExecutionsMax > 0 && r.StepExecutions >= r.StepExecutionsMax
+}
+
+// IncrementStepRetries records that a step of this resolution is about to be retried
+// (relevant to keep track of StepRetries < RetryBudget)
+func (r *Resolution) IncrementStepRetries() {
+	r.StepRetries++
+}
+
+// RetryBudgetExhausted tells if the resolution retried its steps as many times as it is allowed to
+func (r *Resolution) RetryBudgetExhausted() bool {
+	return r.RetryBudget != nil && r.StepRetries >= *r.RetryBudget
+}
+
+// retryBudgetRemaining returns how many step retries the resolution may still perform, nil for no limit
+func (r *Resolution) retryBudgetRemaining() *int {
+	if r.RetryBudget == nil {
+		return nil
+	}
+	remaining := *r.RetryBudget - r.StepRetries
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
 // SetNextRetry assigns a point in time when the resolution will become eligible for execution
 func (r *Resolution) SetNextRetry(t time.Time) {
 	r.NextRetry = &t
@@ -544,6 +919,95 @@ func (r *Resolution) ClearOutputs() {
 	r.ResolverInput = map[string]interface{}{}
 }
 
+// RedactSecrets replaces the secrets of the resolution and of the configuration in the results of all steps,
+// for them to be displayed: the resolution is stored with its actual results, and must not be updated afterwards
+func (r *Resolution) RedactSecrets() {
+	for _, s := range r.Steps {
+		s.RedactSecrets(r.Values.SecretScope())
+	}
+}
+
+// ReplayFrom resets a step and all the steps depending on it, directly or not, so that
+// they run again: the results of the other steps are kept. The children of a reset
+// foreach step are dropped, to be generated again. It returns the names of the reset steps.
+func (r *Resolution) ReplayFrom(stepName string) ([]string, error) {
+	if _, ok := r.Steps[stepName]; !ok {
+		return nil, errors.NotFoundf("given stepName %q for this resolution", stepName)
+	}
+
+	// foreach children depend on the dependencies of their parent, not on the parent itself
+	parents := map[string]string{}
+	for name, s := range r.Steps {
+		for _, child := range s.ChildrenSteps {
+			parents[child] = name
+		}
+	}
+	if parent, ok := parents[stepName]; ok {
+		return nil, errors.BadRequestf("Step %q is generated by the foreach step %q, which should be replayed instead", stepName, parent)
+	}
+
+	toReset := map[string]bool{}
+	queue := []string{stepName}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if toReset[name] {
+			continue
+		}
+		toReset[name] = true
+		for _, dependent := range r.StepTreeIndex[name] {
+			if _, ok := parents[dependent]; ok {
+				continue
+			}
+			queue = append(queue, dependent)
+		}
+	}
+
+	reset := make([]string, 0, len(toReset))
+	for name := range toReset {
+		s := r.Steps[name]
+		for _, child := range s.ChildrenSteps {
+			delete(r.Steps, child)
+			delete(r.ForeachChildrenAlreadyContracted, child)
+			if r.Values != nil {
+				r.Values.UnsetOutput(child)
+				r.Values.UnsetMetadata(child)
+				r.Values.UnsetChildren(child)
+				r.Values.UnsetError(child)
+				r.Values.UnsetState(child)
+			}
+		}
+		// clean up dependency on children
+		if s.ChildrenStepMap != nil {
+			var cleanDependencies []string
+			for _, dep := range s.Dependencies {
+				depName, _ := step.DependencyParts(dep)
+				if !s.ChildrenStepMap[depName] {
+					cleanDependencies = append(cleanDependencies, dep)
+				}
+			}
+			s.Dependencies = cleanDependencies
+		}
+		s.ChildrenSteps = nil
+		s.ChildrenStepMap = nil
+
+		s.Reset()
+		if r.Values != nil {
+			r.Values.SetOutput(name, s.Output)
+			r.Values.SetMetadata(name, s.Metadata)
+			r.Values.SetChildren(name, s.Children)
+			r.Values.SetError(name, s.Error)
+			r.Values.SetState(name, s.State)
+		}
+		reset = append(reset, name)
+	}
+	sort.Strings(reset)
+
+	r.BuildStepTree()
+
+	return reset, nil
+}
+
 ///
 
 func (r *Resolution) setSteps(st map[string]*step.Step) {
@@ -582,11 +1046,13 @@ func (r *Resolution) SetInput(input map[string]interface{}) {
 }
 
 var rSelector = sqlgenerator.PGsql.Select(
-	`"resolution".id, "resolution".public_id, "resolution".id_task, "resolution".resolver_username, "resolution".state, "resolution".instance_id, "resolution".created, "resolution".last_start, "resolution".last_stop, "resolution".next_retry, "resolution".run_count, "resolution".run_max, "resolution".crypt_key, "resolution".encrypted_steps, "resolution".steps_compression_alg, "resolution".encrypted_resolver_input, "resolution".base_configurations, "task".public_id as task_public_id, "task".title as task_title`,
+	`"resolution".id, "resolution".public_id, "resolution".id_task, "resolution".resolver_username, "resolution".state, "resolution".instance_id, "resolution".created, "resolution".last_start, "resolution".last_stop, "resolution".next_retry, "resolution".run_count, "resolution".run_max, "resolution".step_executions, "resolution".step_retries, "resolution".retry_budget, "resolution".crypt_key, "resolution".encrypted_steps, "resolution".encrypted_secrets, "resolution".steps_compression_alg, "resolution".encrypted_resolver_input, "resolution".base_configurations, "resolution".revision, "task".public_id as task_public_id, "task".title as task_title, "runner_instance".heartbeat as instance_heartbeat`,
 ).From(
 	`"resolution"`,
 ).OrderBy(
 	`"resolution".id`,
 ).Join(
 	`"task" on "task".id = "resolution".id_task`,
+).LeftJoin(
+	`"runner_instance" on "runner_instance".id = "resolution".instance_id`,
 )
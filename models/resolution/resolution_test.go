@@ -0,0 +1,50 @@
+package resolution
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/engine/step"
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/models"
+)
+
+func TestSecrets(t *testing.T) {
+	prevKey := models.EncryptionKey
+	models.EncryptionKey = newTestKey(t, "storage", time.Now())
+	defer func() { models.EncryptionKey = prevKey }()
+
+	r := &Resolution{DBModel: DBModel{PublicID: "a5d4c6b2-0f4e-4c0b-9d0a-secrets-test"}, Values: values.NewValues()}
+	require.NoError(t, r.encryptSecrets())
+	assert.Nil(t, r.EncryptedSecrets)
+
+	r.Values.SecretScope().Register("resolution-secret-test")
+	require.NoError(t, r.encryptSecrets())
+	require.NotEmpty(t, r.EncryptedSecrets)
+	assert.NotContains(t, string(r.EncryptedSecrets), "resolution-secret-test")
+
+	// a resolution without values keeps its stored secrets
+	withoutValues := &Resolution{DBModel: r.DBModel}
+	require.NoError(t, withoutValues.encryptSecrets())
+	assert.Equal(t, r.EncryptedSecrets, withoutValues.EncryptedSecrets)
+
+	// loaded back, the results of the resolution are redacted when displayed only
+	loaded := &Resolution{DBModel: r.DBModel, Values: values.NewValues()}
+	require.NoError(t, loaded.loadSecrets())
+	loaded.Steps = map[string]*step.Step{
+		"stepOne": {Output: map[string]interface{}{"token": "resolution-secret-test"}, Error: "invalid token resolution-secret-test"},
+	}
+	loaded.RedactSecrets()
+	assert.Equal(t, map[string]interface{}{"token": values.RedactedValue}, loaded.Steps["stepOne"].Output)
+	assert.Equal(t, "invalid token ***", loaded.Steps["stepOne"].Error)
+
+	// and never in other resolutions
+	other := &Resolution{Values: values.NewValues(), Steps: map[string]*step.Step{
+		"stepOne": {Output: "resolution-secret-test"},
+	}}
+	other.RedactSecrets()
+	assert.Equal(t, "resolution-secret-test", other.Steps["stepOne"].Output)
+}
@@ -72,8 +72,13 @@ func ListInstances(dbp zesty.DBProvider) (ii []*Instance, err error) {
 // IsDead asserts that an instance is dead (hasn't emitted a heartbeat
 // for longer than twice the heartbeat interval)
 func (i *Instance) IsDead() bool {
+	return i.Heartbeat.Before(DeadBefore())
+}
+
+// DeadBefore returns the time before which the last heartbeat of an instance means it is dead
+func DeadBefore() time.Time {
 	// leave some margin for declaring an instance dead (twice past its due heartbeat)
-	return now.Get().Sub(i.Heartbeat) > 2*HeartbeatInterval
+	return now.Get().Add(-2 * HeartbeatInterval)
 }
 
 func (i *Instance) heartBeat(dbp zesty.DBProvider) error {
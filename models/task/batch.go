@@ -62,6 +62,27 @@ func LoadBatchFromPublicID(dbp zesty.DBProvider, publicID string) (b *Batch, err
 	return b, nil
 }
 
+// ListTasks returns all the tasks of a batch, oldest first
+func (b *Batch) ListTasks(dbp zesty.DBProvider) (t []*Task, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list tasks of batch")
+
+	query, params, err := tSelector.Where(
+		squirrel.Eq{`"task".id_batch`: b.ID},
+	).OrderBy(
+		`"task".created`,
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dbp.DB().Select(&t, query, params...)
+	if err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return t, nil
+}
+
 // Delete removes a task batch from DB
 func (b *Batch) Delete(dbp zesty.DBProvider) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to delete batch")
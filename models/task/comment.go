@@ -14,6 +14,16 @@ import (
 	"github.com/loopfz/gadgeto/zesty"
 )
 
+// possible comment types
+const (
+	CommentTypeUser   = "user"   // written by a user
+	CommentTypeSystem = "system" // records an action performed on the task
+	CommentTypeError  = "error"  // reports a failure of the task's resolution
+)
+
+// CommentTypes lists all possible comment types
+var CommentTypes = []string{CommentTypeUser, CommentTypeSystem, CommentTypeError}
+
 // Comment is the structure representing a comment made on a task
 type Comment struct {
 	ID       int64     `json:"-" db:"id"`
@@ -23,10 +33,25 @@ type Comment struct {
 	Created  time.Time `json:"created" db:"created"`
 	Updated  time.Time `json:"updated" db:"updated"`
 	Content  string    `json:"content" db:"content"`
+	Type     string    `json:"type" db:"type"`
+}
+
+// CreateComment inserts a new comment written by a user in DB
+func CreateComment(dbp zesty.DBProvider, t *Task, user, content string) (*Comment, error) {
+	return createComment(dbp, t, user, content, CommentTypeUser)
+}
+
+// CreateSystemComment inserts in DB a new comment recording an action performed on a task
+func CreateSystemComment(dbp zesty.DBProvider, t *Task, user, content string) (*Comment, error) {
+	return createComment(dbp, t, user, content, CommentTypeSystem)
+}
+
+// CreateErrorComment inserts in DB a new comment reporting a failure of a task's resolution
+func CreateErrorComment(dbp zesty.DBProvider, t *Task, user, content string) (*Comment, error) {
+	return createComment(dbp, t, user, content, CommentTypeError)
 }
 
-// CreateComment inserts a new comment in DB
-func CreateComment(dbp zesty.DBProvider, t *Task, user, content string) (c *Comment, err error) {
+func createComment(dbp zesty.DBProvider, t *Task, user, content, commentType string) (c *Comment, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to create comment")
 
 	c = &Comment{
@@ -36,6 +61,7 @@ func CreateComment(dbp zesty.DBProvider, t *Task, user, content string) (c *Comm
 		Created:  now.Get(),
 		Updated:  now.Get(),
 		Content:  content,
+		Type:     commentType,
 	}
 
 	err = c.Valid()
@@ -73,6 +99,8 @@ func LoadCommentsFromTaskID(dbp zesty.DBProvider, taskID int64) (c []*Comment, e
 
 	query, params, err := cSelector.Where(
 		squirrel.Eq{`"task_comment".id_task`: taskID},
+	).OrderBy(
+		`"task_comment".created`, `"task_comment".id`,
 	).ToSql()
 
 	_, err = dbp.DB().Select(&c, query, params...)
@@ -83,6 +111,62 @@ func LoadCommentsFromTaskID(dbp zesty.DBProvider, taskID int64) (c []*Comment, e
 	return c, nil
 }
 
+// CommentFilter holds the criteria to list the comments of a task
+// Last is the public ID of the last comment of the previous page
+type CommentFilter struct {
+	Author   *string
+	Type     *string
+	After    *time.Time
+	Last     *string
+	PageSize uint64
+}
+
+// ListComments returns a page of the comments related to a task, oldest first
+func ListComments(dbp zesty.DBProvider, taskID int64, filter CommentFilter) (c []*Comment, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list comments")
+
+	sel := cSelector.Where(
+		squirrel.Eq{`"task_comment".id_task`: taskID},
+	).OrderBy(
+		`"task_comment".created`, `"task_comment".id`,
+	).Limit(
+		filter.PageSize,
+	)
+
+	if filter.Last != nil {
+		lastC, err := LoadCommentFromPublicID(dbp, *filter.Last)
+		if err != nil {
+			return nil, err
+		}
+		// comments created at the same time are ordered by id, so that none is skipped between pages
+		sel = sel.Where(`("task_comment".created, "task_comment".id) > (?, ?)`, lastC.Created, lastC.ID)
+	}
+
+	if filter.Author != nil {
+		sel = sel.Where(squirrel.Eq{`"task_comment".username`: *filter.Author})
+	}
+
+	if filter.Type != nil {
+		sel = sel.Where(squirrel.Eq{`"task_comment".type`: *filter.Type})
+	}
+
+	if filter.After != nil {
+		sel = sel.Where(squirrel.Gt{`"task_comment".created`: *filter.After})
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dbp.DB().Select(&c, query, params...)
+	if err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return c, nil
+}
+
 // Update changes the content of a comment in DB
 func (c *Comment) Update(dbp zesty.DBProvider, content string) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to update comment")
@@ -119,14 +203,18 @@ func (c *Comment) Delete(dbp zesty.DBProvider) (err error) {
 	return nil
 }
 
-// Valid asserts that the content of a message is whithin min/max character bounds
+// Valid asserts that the content of a message is whithin min/max character bounds,
+// and that its type is known
 func (c *Comment) Valid() error {
+	if !utils.ListContainsString(CommentTypes, c.Type) {
+		return errors.BadRequestf("Invalid comment type %q: must be one of %v", c.Type, CommentTypes)
+	}
 	return utils.ValidText("task comment", c.Content)
 }
 
 var (
 	cSelector = sqlgenerator.PGsql.Select(
-		`"task_comment".id, "task_comment".public_id, "task_comment".id_task, "task_comment".username, "task_comment".created, "task_comment".updated, "task_comment".content`,
+		`"task_comment".id, "task_comment".public_id, "task_comment".id_task, "task_comment".username, "task_comment".created, "task_comment".updated, "task_comment".content, "task_comment".type`,
 	).From(
 		`"task_comment"`,
 	)
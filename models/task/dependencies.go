@@ -0,0 +1,160 @@
+package task
+
+import (
+	"strconv"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/db/sqlgenerator"
+)
+
+// A task can depend on other tasks: its resolution is kept on hold
+// until every task it depends on has reached a final state
+
+var finalStates = []string{StateDone, StateWontfix, StateCancelled}
+
+type dependencies struct {
+	DependsOn []string `db:"depends_on"`
+}
+
+// ValidateDependencies asserts that the tasks a task depends on exist,
+// and that depending on them does not introduce a cycle
+func ValidateDependencies(dbp zesty.DBProvider, publicID string, dependsOn []string) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Invalid task dependencies")
+
+	direct := make(map[string]bool, len(dependsOn))
+	for _, id := range dependsOn {
+		if id == publicID {
+			return errors.BadRequestf("a task can't depend on itself")
+		}
+		if direct[id] {
+			return errors.BadRequestf("duplicate dependency %q", id)
+		}
+		direct[id] = true
+	}
+
+	seen := make(map[string]bool)
+	queue := append([]string{}, dependsOn...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if id == publicID {
+			return errors.BadRequestf("dependency cycle detected through task %q", id)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		deps, err := loadDependencies(dbp, id)
+		if err != nil {
+			if errors.IsNotFound(err) && !direct[id] {
+				// an indirect dependency no longer exists, it can't be part of a cycle
+				continue
+			}
+			return err
+		}
+		queue = append(queue, deps...)
+	}
+
+	return nil
+}
+
+func loadDependencies(dbp zesty.DBProvider, publicID string) ([]string, error) {
+	query, params, err := sqlgenerator.PGsql.Select(`"task".depends_on`).
+		From(`"task"`).
+		Where(squirrel.Eq{`"task".public_id`: publicID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var d dependencies
+	if err := dbp.DB().SelectOne(&d, query, params...); err != nil {
+		err = pgjuju.Interpret(err)
+		if errors.IsNotFound(err) {
+			return nil, errors.NotFoundf("task %q", publicID)
+		}
+		return nil, err
+	}
+
+	return d.DependsOn, nil
+}
+
+// PendingDependencies returns the public IDs of the tasks this task depends on,
+// which have not reached a final state yet
+// a task which no longer exists is considered as over
+func (t *Task) PendingDependencies(dbp zesty.DBProvider) (pending []string, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load pending dependencies of task %s", t.PublicID)
+
+	if len(t.DependsOn) == 0 {
+		return nil, nil
+	}
+
+	query, params, err := sqlgenerator.PGsql.Select(`"task".public_id`).
+		From(`"task"`).
+		Where(squirrel.Eq{`"task".public_id`: t.DependsOn}).
+		Where(squirrel.NotEq{`"task".state`: finalStates}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&pending, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return pending, nil
+}
+
+// ListDependents returns the tasks which depend on a given task
+func ListDependents(dbp zesty.DBProvider, publicID string) (t []*Task, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list tasks depending on %s", publicID)
+
+	query, params, err := tSelector.Where(
+		`"task".depends_on @> ?::jsonb`, "["+strconv.Quote(publicID)+"]",
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&t, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return t, nil
+}
+
+// ListReleasedDependents returns the blocked tasks depending on other tasks, which are all over:
+// the tasks depending on a task which got deleted before reaching a final state
+// don't get notified of its end, and have to be looked for
+func ListReleasedDependents(dbp zesty.DBProvider) (t []*Task, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list released dependent tasks")
+
+	query, params, err := tSelector.
+		Where(squirrel.Eq{`"task".state`: StateBlocked}).
+		Where(`jsonb_typeof("task".depends_on) = 'array'`).
+		Where(`"task".depends_on <> '[]'::jsonb`).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM "task" AS "dependency"
+			WHERE "dependency".public_id::text IN (
+				SELECT jsonb_array_elements_text(CASE jsonb_typeof("task".depends_on) WHEN 'array' THEN "task".depends_on ELSE '[]'::jsonb END)
+			)
+			AND NOT ("dependency".state = ANY(?))
+		)`, pq.Array(finalStates)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&t, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,92 @@
+package task
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/engine/input"
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// sealInputs encrypts the values of the secret inputs of a task on their own,
+// with the storage key: they stay encrypted once the input of the task is decrypted.
+// Values sealed already are sealed again, with the latest storage key
+func (t *Task) sealInputs(tt *tasktemplate.TaskTemplate) error {
+	secret := make(map[string]bool)
+	for _, i := range tt.Inputs {
+		if i.Secret {
+			secret[i.Name] = true
+		}
+	}
+
+	for name, val := range t.Input {
+		if input.IsSealed(val) {
+			clear, err := t.unsealInput(name, val.(string))
+			if err != nil {
+				return err
+			}
+			val = clear
+		} else if !secret[name] || val == nil {
+			continue
+		}
+		sealed, err := t.sealInput(name, val)
+		if err != nil {
+			return err
+		}
+		t.Input[name] = sealed
+	}
+	return nil
+}
+
+// UnsealedInput returns a copy of the input of a task, with the values of its secret inputs
+// decrypted. It is meant for the steps of the task's resolution only
+func (t *Task) UnsealedInput() (map[string]interface{}, error) {
+	if t.Input == nil {
+		return nil, nil
+	}
+	ret := make(map[string]interface{}, len(t.Input))
+	for name, val := range t.Input {
+		if input.IsSealed(val) {
+			clear, err := t.unsealInput(name, val.(string))
+			if err != nil {
+				return nil, err
+			}
+			val = clear
+		}
+		ret[name] = val
+	}
+	return ret, nil
+}
+
+func (t *Task) sealInput(name string, val interface{}) (string, error) {
+	b, err := utils.JSONMarshal(val)
+	if err != nil {
+		return "", err
+	}
+	enc, err := models.EncryptionKey.Encrypt(b, []byte(t.PublicID), []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return input.SealedPrefix + base64.StdEncoding.EncodeToString(enc), nil
+}
+
+func (t *Task) unsealInput(name, sealed string) (interface{}, error) {
+	enc, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, input.SealedPrefix))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to decode secret input %q", name)
+	}
+	b, err := models.EncryptionKey.Decrypt(enc, []byte(t.PublicID), []byte(name))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to decrypt secret input %q", name)
+	}
+	var val interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(b), &val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/Masterminds/squirrel"
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
 	"github.com/cneill/utask/db/pgjuju"
@@ -52,20 +53,18 @@ func RegisterTaskTime(templateName string, taskCreation, resCreation time.Time)
 	executionTimes.WithLabelValues(templateName).Observe(executionTime)
 }
 
-// LoadStateCount returns a map containing the count of tasks grouped by state
-func LoadStateCount(dbp zesty.DBProvider, tags map[string]string) (sc map[string]float64, err error) {
+// LoadStateCount returns a map containing the count of tasks grouped by state,
+// optionally restricted to the tasks having some tags, or created or ended within a period
+func LoadStateCount(dbp zesty.DBProvider, tags map[string]string, period Period) (sc map[string]float64, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to load task stats")
 
-	sel := sqlgenerator.PGsql.Select(`state, count(state) as state_count`).
-		From(`"task"`).
-		GroupBy(`state`)
-
-	if len(tags) > 0 {
-		b, err := json.Marshal(tags)
-		if err != nil {
-			return nil, err
-		}
-		sel = sel.Where(`"task".tags @> ?::jsonb`, string(b))
+	sel, err := whereTagsAndPeriod(
+		sqlgenerator.PGsql.Select(`state, count(state) as state_count`).
+			From(`"task"`).
+			GroupBy(`state`),
+		tags, period)
+	if err != nil {
+		return nil, err
 	}
 
 	query, params, err := sel.ToSql()
@@ -93,21 +92,27 @@ func LoadStateCount(dbp zesty.DBProvider, tags map[string]string) (sc map[string
 	return sc, nil
 }
 
-// LoadStateCountResolverGroup returns a map containing the count of tasks grouped by state and by resolver_group
-func LoadStateCountResolverGroup(dbp zesty.DBProvider) (sc map[string]map[string]map[string]float64, err error) {
+// LoadStateCountResolverGroup returns a map containing the count of tasks grouped by state and by resolver_group,
+// optionally restricted to the tasks having some tags, or created or ended within a period
+func LoadStateCountResolverGroup(dbp zesty.DBProvider, tags map[string]string, period Period) (sc map[string]map[string]map[string]float64, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to load task stats")
 
-	subQuery := sqlgenerator.PGsql.Select(
-		`t."id"`,
-		`tt."name" as "template"`,
-		`t."state"`,
-		`coalesce(
-			nullif(t."resolver_groups", 'null'::jsonb),
-			nullif(tt."allowed_resolver_groups", 'null'::jsonb),
+	subQuery, err := whereTagsAndPeriod(
+		sqlgenerator.PGsql.Select(
+			`"task"."id"`,
+			`"task_template"."name" as "template"`,
+			`"task"."state"`,
+			`coalesce(
+			nullif("task"."resolver_groups", 'null'::jsonb),
+			nullif("task_template"."allowed_resolver_groups", 'null'::jsonb),
 			'[""]'::jsonb
 		) as "groups"`).
-		From(`"task" t`).
-		LeftJoin(`"task_template" tt ON t."id_template" = tt."id"`)
+			From(`"task"`).
+			LeftJoin(`"task_template" ON "task"."id_template" = "task_template"."id"`),
+		tags, period)
+	if err != nil {
+		return nil, err
+	}
 
 	sel := sqlgenerator.PGsql.Select(`"group_name"`, `"state"`, `"sq"."template"`, `count("sq"."state") as "state_count"`).
 		FromSelect(subQuery, "sq").
@@ -148,3 +153,175 @@ func LoadStateCountResolverGroup(dbp zesty.DBProvider) (sc map[string]map[string
 
 	return sc, nil
 }
+
+type stateCountPriority struct {
+	stateCount
+	Template string `db:"template"`
+	Priority int    `db:"priority"`
+}
+
+// LoadStateCountPriority returns a map containing the count of tasks grouped by state, by template and by priority
+func LoadStateCountPriority(dbp zesty.DBProvider) (sc map[int]map[string]map[string]float64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load task stats")
+
+	sel := sqlgenerator.PGsql.Select(`t."priority"`, `tt."name" as "template"`, `t."state"`, `count(t."state") as "state_count"`).
+		From(`"task" t`).
+		Join(`"task_template" tt ON t."id_template" = tt."id"`).
+		GroupBy(`t."priority"`, `tt."name"`, `t."state"`)
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	s := []stateCountPriority{}
+	if _, err := dbp.DB().Select(&s, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	sc = make(map[int]map[string]map[string]float64)
+
+	for _, psc := range s {
+		if _, exists := sc[psc.Priority]; !exists {
+			sc[psc.Priority] = map[string]map[string]float64{}
+		}
+
+		if _, exists := sc[psc.Priority][psc.Template]; !exists {
+			sc[psc.Priority][psc.Template] = map[string]float64{
+				StateTODO:      0,
+				StateBlocked:   0,
+				StateRunning:   0,
+				StateWontfix:   0,
+				StateDone:      0,
+				StateCancelled: 0,
+			}
+		}
+
+		sc[psc.Priority][psc.Template][psc.State] = psc.Count
+	}
+
+	return sc, nil
+}
+
+// TemplateStats holds the stats of the tasks of a template
+type TemplateStats struct {
+	TaskStates          map[string]float64   `json:"task_states"`
+	ResolutionDurations *ResolutionDurations `json:"resolution_durations,omitempty"`
+}
+
+// ResolutionDurations sums up how long the resolutions of the done tasks took, in seconds,
+// from the creation of the resolution to its last stop
+type ResolutionDurations struct {
+	Count   float64 `json:"count" db:"resolution_count"`
+	Average float64 `json:"average" db:"average"`
+	P50     float64 `json:"p50" db:"p50"`
+	P90     float64 `json:"p90" db:"p90"`
+	P99     float64 `json:"p99" db:"p99"`
+}
+
+type stateCountTemplate struct {
+	stateCount
+	Template string `db:"template"`
+}
+
+type resolutionDurationsTemplate struct {
+	ResolutionDurations
+	Template string `db:"template"`
+}
+
+// LoadTemplateStats returns the stats of the tasks of every template, indexed by template name:
+// the count of tasks grouped by state, and the durations of the resolutions of the done tasks,
+// optionally restricted to the tasks having some tags, or created or ended within a period
+func LoadTemplateStats(dbp zesty.DBProvider, tags map[string]string, period Period) (ts map[string]*TemplateStats, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load template stats")
+
+	sel, err := whereTagsAndPeriod(
+		sqlgenerator.PGsql.Select(`"task_template".name as "template"`, `"task".state`, `count("task".state) as "state_count"`).
+			From(`"task"`).
+			Join(`"task_template" ON "task_template".id = "task".id_template`).
+			GroupBy(`"task_template".name`, `"task".state`),
+		tags, period)
+	if err != nil {
+		return nil, err
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := []stateCountTemplate{}
+	if _, err := dbp.DB().Select(&sc, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	ts = make(map[string]*TemplateStats)
+	for _, tsc := range sc {
+		if _, exists := ts[tsc.Template]; !exists {
+			ts[tsc.Template] = &TemplateStats{
+				TaskStates: map[string]float64{
+					StateTODO:      0,
+					StateBlocked:   0,
+					StateRunning:   0,
+					StateWontfix:   0,
+					StateDone:      0,
+					StateCancelled: 0,
+				},
+			}
+		}
+		ts[tsc.Template].TaskStates[tsc.State] = tsc.Count
+	}
+
+	duration := `extract(epoch from ("resolution".last_stop - "resolution".created))`
+	sel, err = whereTagsAndPeriod(
+		sqlgenerator.PGsql.Select(
+			`"task_template".name as "template"`,
+			`count(*) as "resolution_count"`,
+			`avg(`+duration+`) as "average"`,
+			`percentile_cont(0.5) within group (order by `+duration+`) as "p50"`,
+			`percentile_cont(0.9) within group (order by `+duration+`) as "p90"`,
+			`percentile_cont(0.99) within group (order by `+duration+`) as "p99"`,
+		).
+			From(`"task"`).
+			Join(`"task_template" ON "task_template".id = "task".id_template`).
+			Join(`"resolution" ON "resolution".id_task = "task".id`).
+			Where(squirrel.Eq{`"task".state`: StateDone}).
+			Where(`"resolution".last_stop IS NOT NULL`).
+			GroupBy(`"task_template".name`),
+		tags, period)
+	if err != nil {
+		return nil, err
+	}
+
+	query, params, err = sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rd := []resolutionDurationsTemplate{}
+	if _, err := dbp.DB().Select(&rd, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	for _, trd := range rd {
+		if stats, exists := ts[trd.Template]; exists {
+			durations := trd.ResolutionDurations
+			stats.ResolutionDurations = &durations
+		}
+	}
+
+	return ts, nil
+}
+
+// whereTagsAndPeriod restricts a query on the task table to the tasks having some tags,
+// and created or ended within a period
+func whereTagsAndPeriod(sel squirrel.SelectBuilder, tags map[string]string, period Period) (squirrel.SelectBuilder, error) {
+	if len(tags) > 0 {
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return sel, err
+		}
+		sel = sel.Where(`"task".tags @> ?::jsonb`, string(b))
+	}
+	return period.where(sel), nil
+}
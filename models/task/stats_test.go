@@ -53,7 +53,7 @@ func createTasks(dbp zesty.DBProvider, templates map[string]*tasktemplate.TaskTe
 			return nil, fmt.Errorf("template %q not found", name)
 		}
 
-		task, err := task.Create(dbp, template, "foo", nil, nil, nil, nil, groups, nil, nil, nil, false)
+		task, err := task.Create(dbp, template, "foo", task.CreateOptions{ResolverGroups: groups})
 		if err != nil {
 			return nil, err
 		}
@@ -259,7 +259,7 @@ func TestLoadStateCountResolverGroup(t *testing.T) {
 				return
 			}
 
-			gotSc, err := task.LoadStateCountResolverGroup(dbp)
+			gotSc, err := task.LoadStateCountResolverGroup(dbp, nil, task.Period{})
 			if err != nil {
 				t.Errorf("LoadStateCountResolverGroup() error = %v, wantErr false", err)
 				return
@@ -276,3 +276,57 @@ func TestLoadStateCountResolverGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadStateCountPriority(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dbp.Tx())
+	defer dbp.Rollback()
+
+	prefix := fmt.Sprintf("task-%d-", time.Now().UnixNano())
+	templates, err := createTemplates(dbp, prefix, map[string][]string{"task": nil})
+	assert.NoError(t, err)
+
+	priority := 5
+	_, err = task.Create(dbp, templates["task"], "foo", task.CreateOptions{})
+	assert.NoError(t, err)
+	tsk, err := task.Create(dbp, templates["task"], "foo", task.CreateOptions{Priority: &priority})
+	assert.NoError(t, err)
+	assert.Equal(t, priority, tsk.Priority)
+
+	sc, err := task.LoadStateCountPriority(dbp)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), sc[0][prefix+"task"][task.StateTODO])
+	assert.Equal(t, float64(1), sc[priority][prefix+"task"][task.StateTODO])
+	assert.Equal(t, float64(0), sc[priority][prefix+"task"][task.StateDone])
+}
+
+func TestLoadTemplateStats(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dbp.Tx())
+	defer dbp.Rollback()
+
+	prefix := fmt.Sprintf("task-%d-", time.Now().UnixNano())
+	templates, err := createTemplates(dbp, prefix, map[string][]string{"task": nil})
+	assert.NoError(t, err)
+
+	_, err = task.Create(dbp, templates["task"], "foo", task.CreateOptions{})
+	assert.NoError(t, err)
+
+	ts, err := task.LoadTemplateStats(dbp, nil, task.Period{})
+	assert.NoError(t, err)
+	if assert.Contains(t, ts, prefix+"task") {
+		assert.Equal(t, float64(1), ts[prefix+"task"].TaskStates[task.StateTODO])
+		assert.Equal(t, float64(0), ts[prefix+"task"].TaskStates[task.StateDone])
+		// no task done yet
+		assert.Nil(t, ts[prefix+"task"].ResolutionDurations)
+	}
+
+	later := time.Now().Add(time.Hour)
+	ts, err = task.LoadTemplateStats(dbp, nil, task.Period{CreatedAfter: &later})
+	assert.NoError(t, err)
+	assert.NotContains(t, ts, prefix+"task")
+}
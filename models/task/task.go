@@ -72,6 +72,7 @@ type DBModel struct {
 	PublicID          string            `json:"id" db:"public_id"`
 	Title             string            `json:"title" db:"title"`
 	TemplateID        int64             `json:"-" db:"id_template"`
+	TemplateVersion   int               `json:"template_version" db:"template_version"` // version of the template the task runs
 	BatchID           *int64            `json:"-" db:"id_batch"`
 	RequesterUsername string            `json:"requester_username" db:"requester_username"`
 	RequesterGroups   []string          `json:"requester_groups,omitempty" db:"requester_groups"`
@@ -85,42 +86,107 @@ type DBModel struct {
 	StepsTotal        int               `json:"steps_total" db:"steps_total"`
 	LastActivity      time.Time         `json:"last_activity" db:"last_activity"`
 	Tags              map[string]string `json:"tags,omitempty" db:"tags"`
+	TTL               *string           `json:"ttl,omitempty" db:"ttl"`                         // how long the task is kept after its completion
+	Priority          int               `json:"priority" db:"priority"`                         // resolutions of tasks with the highest priority run first
+	DependsOn         []string          `json:"depends_on,omitempty" db:"depends_on"`           // tasks that must be over before this task runs
+	Assignee          *string           `json:"assignee,omitempty" db:"assignee"`               // resolver who claimed the task, the only one allowed to run it
+	NotifyBackends    []string          `json:"notify_backends,omitempty" db:"notify_backends"` // if set, the only notification backends receiving this task's notifications
+	SLADeadline       *time.Time        `json:"sla_deadline,omitempty" db:"sla_deadline"`       // when the task breaches its template's sla if still not over
+	SLABreached       bool              `json:"sla_breached" db:"sla_breached"`                 // set once the sla breach has been notified
+	LastReminder      *time.Time        `json:"last_reminder,omitempty" db:"last_reminder"`     // last time the resolvers were reminded of the task being blocked
+	Revision          int               `json:"revision" db:"revision"`                         // incremented on each update, to detect concurrent edits
 
 	CryptKey        []byte `json:"-" db:"crypt_key"` // key for encrypting steps (itself encrypted with master key)
 	EncryptedInput  []byte `json:"-" db:"encrypted_input"`
 	EncryptedResult []byte `json:"-" db:"encrypted_result"` // encrypted Result
 }
 
+// CreateOptions holds the optional properties of a new Task
+type CreateOptions struct {
+	RequesterGroups   []string
+	WatcherUsernames  []string
+	WatcherGroups     []string
+	ResolverUsernames []string
+	ResolverGroups    []string
+	Input             map[string]interface{}
+	Tags              map[string]string // merged into the template's tags
+	Batch             *Batch
+	Delayed           bool
+	TTL               *string  // the template's ttl applies if nil
+	Priority          *int     // the template's priority applies if nil
+	DependsOn         []string // tasks that must be over before this task runs
+	NotifyBackends    []string // the only notification backends receiving this task's notifications, if set
+}
+
 // Create inserts a new Task in DB
-func Create(dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, reqUsername string, reqGroups []string, watcherUsernames []string, watcherGroups []string, resolverUsernames []string, resolverGroups []string, input map[string]interface{}, tags map[string]string, b *Batch, delayed bool) (t *Task, err error) {
+func Create(dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, reqUsername string, opts CreateOptions) (t *Task, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to create new Task")
 
+	// the template's ttl applies unless one is given for this task
+	ttl := opts.TTL
+	if ttl == nil {
+		ttl = tt.TTL
+	}
+	if ttl != nil {
+		if err := utils.ValidateTTL(*ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	// the template's priority applies unless one is given for this task
+	priority := opts.Priority
+	if priority == nil {
+		priority = &tt.Priority
+	}
+
+	// the deadline is computed once, from the task's creation time
+	var slaDeadline *time.Time
+	if tt.SLA != nil {
+		sla, err := time.ParseDuration(*tt.SLA)
+		if err != nil {
+			return nil, errors.NewNotValid(err, "invalid sla")
+		}
+		deadline := now.Get().Add(sla)
+		slaDeadline = &deadline
+	}
+
 	initState := StateTODO
-	if delayed {
+	if opts.Delayed {
 		initState = StateDelayed
 	}
 	t = &Task{
 		DBModel: DBModel{
 			PublicID:          uuid.Must(uuid.NewV4()).String(),
 			TemplateID:        tt.ID,
+			TemplateVersion:   tt.Version,
 			RequesterUsername: reqUsername,
-			RequesterGroups:   reqGroups,
-			WatcherUsernames:  watcherUsernames,
-			WatcherGroups:     watcherGroups,
-			ResolverUsernames: resolverUsernames,
-			ResolverGroups:    resolverGroups,
+			RequesterGroups:   opts.RequesterGroups,
+			WatcherUsernames:  opts.WatcherUsernames,
+			WatcherGroups:     opts.WatcherGroups,
+			ResolverUsernames: opts.ResolverUsernames,
+			ResolverGroups:    opts.ResolverGroups,
 			Created:           now.Get(),
 			LastActivity:      now.Get(),
 			StepsTotal:        len(tt.Steps),
 			State:             initState,
+			TTL:               ttl,
+			Priority:          *priority,
+			DependsOn:         opts.DependsOn,
+			NotifyBackends:    opts.NotifyBackends,
+			SLADeadline:       slaDeadline,
+			Revision:          1,
 		},
 		TemplateName: tt.Name,
 		Result:       tt.ResultFormat,
-		Input:        tt.FilterInputs(input),
+		Input:        tt.FilterInputs(opts.Input),
 	}
 
-	if b != nil {
-		t.BatchID = &b.ID
+	if opts.Batch != nil {
+		t.BatchID = &opts.Batch.ID
+	}
+
+	if err := t.sealInputs(tt); err != nil {
+		return nil, err
 	}
 
 	// force empty to stop using old crypto code
@@ -148,10 +214,40 @@ func Create(dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, reqUsername str
 		return nil, err
 	}
 
+	if err := ValidateDependencies(dbp, t.PublicID, opts.DependsOn); err != nil {
+		return nil, err
+	}
+
+	if err := validateNotifyBackends(opts.NotifyBackends); err != nil {
+		return nil, err
+	}
+
 	// title can be computed if input values are valid
+	// secret inputs are sealed already, and can't be revealed by the title
 	v := values.NewValues()
-	v.SetInput(input)
+	v.SetInput(t.Input)
 	v.SetVariables(tt.Variables)
+
+	// the template adds its own resolvers and watchers, which can be computed from input values too
+	// the lists given by the requester are kept as is, they are never templated
+	for _, l := range []struct {
+		field     string
+		list      *[]string
+		templated []string
+		separator string
+	}{
+		{"task_watcher_usernames", &t.WatcherUsernames, tt.TaskWatcherUsernames, utask.UsernamesSeparator},
+		{"task_watcher_groups", &t.WatcherGroups, tt.TaskWatcherGroups, utask.GroupsSeparator},
+		{"task_resolver_usernames", &t.ResolverUsernames, tt.TaskResolverUsernames, utask.UsernamesSeparator},
+		{"task_resolver_groups", &t.ResolverGroups, tt.TaskResolverGroups, utask.GroupsSeparator},
+	} {
+		rendered, err := renderList(l.field, l.templated, l.separator, v)
+		if err != nil {
+			return nil, err
+		}
+		*l.list = utils.AppendUniq(*l.list, rendered...)
+	}
+
 	t.ExportTaskInfos(v) // make task-specific info available for title
 	title, err := v.Apply(tt.TitleFormat, nil, "")
 	if err != nil {
@@ -164,7 +260,7 @@ func Create(dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, reqUsername str
 	for k, v := range tt.Tags {
 		mergedTags[k] = v
 	}
-	for k, v := range tags {
+	for k, v := range opts.Tags {
 		mergedTags[k] = v
 	}
 	if err := t.SetTags(mergedTags, v); err != nil {
@@ -295,6 +391,39 @@ type ListFilter struct {
 	After                              *time.Time
 	Tags                               map[string]string
 	Template                           *string
+	Priority                           *int
+	Resolver                           *string
+	Watcher                            *string
+	Period                             Period
+}
+
+// Period restricts a listing to the tasks created, or ended (reaching a final state), between some bounds
+type Period struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	EndedAfter    *time.Time
+	EndedBefore   *time.Time
+}
+
+// where adds the conditions of the period to a query on the task table:
+// a task ended with its last activity, as the garbage collector considers it
+func (p Period) where(sel squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if p.CreatedAfter != nil {
+		sel = sel.Where(squirrel.GtOrEq{`"task".created`: *p.CreatedAfter})
+	}
+	if p.CreatedBefore != nil {
+		sel = sel.Where(squirrel.Lt{`"task".created`: *p.CreatedBefore})
+	}
+	if p.EndedAfter != nil || p.EndedBefore != nil {
+		sel = sel.Where(squirrel.Eq{`"task".state`: finalStates})
+	}
+	if p.EndedAfter != nil {
+		sel = sel.Where(squirrel.GtOrEq{`"task".last_activity`: *p.EndedAfter})
+	}
+	if p.EndedBefore != nil {
+		sel = sel.Where(squirrel.Lt{`"task".last_activity`: *p.EndedBefore})
+	}
+	return sel
 }
 
 // ListTasks returns a list of tasks, optionally filtered on one or several criteria
@@ -420,6 +549,31 @@ func ListTasks(dbp zesty.DBProvider, filter ListFilter) (t []*Task, err error) {
 		sel = sel.Where(squirrel.Eq{`"task_template".name`: *filter.Template})
 	}
 
+	if filter.Priority != nil {
+		sel = sel.Where(squirrel.Eq{`"task".priority`: *filter.Priority})
+	}
+
+	sel = filter.Period.where(sel)
+
+	// resolver and watcher match a username as well as a group name
+	if filter.Resolver != nil {
+		arg := strconv.Quote(*filter.Resolver)
+		sel = sel.Where(squirrel.Or{
+			squirrel.Expr(`"task_template".allowed_resolver_usernames @> ?::jsonb`, arg),
+			squirrel.Expr(`"task".resolver_usernames @> ?::jsonb`, arg),
+			squirrel.Expr(`"task_template".allowed_resolver_groups @> ?::jsonb`, arg),
+			squirrel.Expr(`"task".resolver_groups @> ?::jsonb`, arg),
+		})
+	}
+
+	if filter.Watcher != nil {
+		arg := strconv.Quote(*filter.Watcher)
+		sel = sel.Where(squirrel.Or{
+			squirrel.Expr(`"task".watcher_usernames @> ?::jsonb`, arg),
+			squirrel.Expr(`"task".watcher_groups @> ?::jsonb`, arg),
+		})
+	}
+
 	query, params, err := sel.ToSql()
 	if err != nil {
 		return nil, err
@@ -450,19 +604,24 @@ func (t *Task) Update(dbp zesty.DBProvider, skipValidation, recordLastActivity b
 		return err
 	}
 
-	encrInput, err := models.EncryptionKey.EncryptMarshal(t.Input, []byte(t.PublicID))
+	tt, err := tasktemplate.LoadVersion(dbp, t.TemplateID, t.TemplateVersion)
 	if err != nil {
 		return err
 	}
-	t.EncryptedInput = []byte(encrInput)
 
-	// force empty to stop using old crypto code
-	t.CryptKey = []byte{}
+	// secret inputs are sealed when updated, and sealed again with the latest key
+	if err := t.sealInputs(tt); err != nil {
+		return err
+	}
 
-	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	encrInput, err := models.EncryptionKey.EncryptMarshal(t.Input, []byte(t.PublicID))
 	if err != nil {
 		return err
 	}
+	t.EncryptedInput = []byte(encrInput)
+
+	// force empty to stop using old crypto code
+	t.CryptKey = []byte{}
 
 	if !skipValidation {
 		err = t.Valid(tt)
@@ -486,6 +645,8 @@ func (t *Task) Update(dbp zesty.DBProvider, skipValidation, recordLastActivity b
 		t.LastActivity = now.Get()
 	}
 
+	t.Revision++
+
 	rows, err := dbp.DB().Update(&t.DBModel)
 	if err != nil {
 		return pgjuju.Interpret(err)
@@ -516,54 +677,171 @@ func (t *Task) Delete(dbp zesty.DBProvider) (err error) {
 func RotateTasks(dbp zesty.DBProvider) (err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to rotate encrypted tasks to new key")
 
-	var last string
+	var last int64
 	for {
-		var lastID *string
-		if last != "" {
-			lastID = &last
+		sp, err := dbp.TxSavepoint()
+		if err != nil {
+			return err
 		}
-		// load all tasks
-		tasks, err := ListTasks(dbp, ListFilter{
-			PageSize: utask.MaxPageSize,
-			Last:     lastID,
-		})
+		lastID, count, err := RotateTasksBatch(dbp, last, utask.MaxPageSize)
 		if err != nil {
+			dbp.RollbackTo(sp)
 			return err
 		}
-		if len(tasks) == 0 {
+		// commit
+		if err := dbp.Commit(); err != nil {
+			return err
+		}
+		if count == 0 {
 			break
 		}
-		last = tasks[len(tasks)-1].PublicID
+		last = lastID
+	}
 
-		for _, t := range tasks {
-			sp, err := dbp.TxSavepoint()
-			if err != nil {
-				return err
-			}
-			// load task locked without comments (decrypt)
-			tsk, err := loadFromPublicID(dbp, t.PublicID, true, false)
-			if err != nil {
-				dbp.RollbackTo(sp)
-				return err
-			}
-			// update task (encrypt)
-			if err := tsk.Update(dbp,
-				true,  // skip validation
-				false, // do not change lastActivity value
-			); err != nil {
-				dbp.RollbackTo(sp)
-				return err
-			}
-			// commit
-			if err := dbp.Commit(); err != nil {
-				return err
-			}
+	return nil
+}
+
+// RotateTasksBatch re-encrypts with the latest available storage key
+// up to size tasks, following the task with the DB id afterID,
+// within the current transaction of dbp. It returns the DB id of
+// the last task handled, and the count of tasks handled
+func RotateTasksBatch(dbp zesty.DBProvider, afterID int64, size uint64) (lastID int64, count int, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to rotate a batch of encrypted tasks to new key")
+
+	query, params, err := sqlgenerator.PGsql.Select(
+		`"task".id, "task".public_id`,
+	).From(
+		`"task"`,
+	).Where(
+		squirrel.Gt{`"task".id`: afterID},
+	).OrderBy(
+		`"task".id`,
+	).Limit(
+		size,
+	).ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ids []rotationID
+	if _, err := dbp.DB().Select(&ids, query, params...); err != nil {
+		return 0, 0, pgjuju.Interpret(err)
+	}
+
+	for _, id := range ids {
+		// load task locked without comments (decrypt)
+		t, err := loadFromPublicID(dbp, id.PublicID, true, false)
+		if err != nil {
+			return 0, 0, err
+		}
+		// update task (encrypt)
+		if err := t.Update(dbp,
+			true,  // skip validation
+			false, // do not change lastActivity value
+		); err != nil {
+			return 0, 0, err
+		}
+		lastID = id.ID
+	}
+
+	return lastID, len(ids), nil
+}
+
+// ListUnresolved returns the tasks of a template still waiting for a resolution to be created,
+// locking them for the current transaction; tasks already locked are skipped
+func ListUnresolved(dbp zesty.DBProvider, templateID int64) (t []*Task, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list unresolved tasks of template %d", templateID)
+
+	var publicIDs []string
+	if _, err := dbp.DB().Select(&publicIDs, `SELECT "task".public_id FROM "task"
+		WHERE "task".id_template = $1 AND "task".state = $2
+		AND NOT EXISTS (SELECT 1 FROM "resolution" WHERE "resolution".id_task = "task".id)
+		ORDER BY "task".id
+		FOR NO KEY UPDATE OF "task" SKIP LOCKED`, templateID, StateTODO); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	t = make([]*Task, 0, len(publicIDs))
+	for _, publicID := range publicIDs {
+		// load task locked without comments
+		tsk, err := loadFromPublicID(dbp, publicID, true, false)
+		if err != nil {
+			return nil, err
 		}
+		t = append(t, tsk)
 	}
+	return t, nil
+}
+
+// CountTasksAfter returns the count of tasks following the task with the DB id afterID
+func CountTasksAfter(dbp zesty.DBProvider, afterID int64) (int64, error) {
+	count, err := dbp.DB().SelectInt(`SELECT count(*) FROM "task" WHERE "task".id > $1`, afterID)
+	if err != nil {
+		return 0, pgjuju.Interpret(err)
+	}
+	return count, nil
+}
+
+// CountCreatedBy returns the count of tasks created by a requester since a given time,
+// restricted to a template when templateID is not nil
+func CountCreatedBy(dbp zesty.DBProvider, requester string, templateID *int64, since time.Time) (count int64, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to count tasks created by %q", requester)
+
+	sel := sqlgenerator.PGsql.Select(
+		`count(*)`,
+	).From(
+		`"task"`,
+	).Where(
+		squirrel.Eq{`"task".requester_username`: requester},
+	).Where(
+		`"task".created >= ?`, since,
+	)
+
+	if templateID != nil {
+		sel = sel.Where(squirrel.Eq{`"task".id_template`: *templateID})
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	count, err = dbp.DB().SelectInt(query, params...)
+	if err != nil {
+		return 0, pgjuju.Interpret(err)
+	}
+	return count, nil
+}
 
+// LockRequesterQuota serializes the task creations of a requester until the end of the
+// current transaction, so that the tasks counted against its quota can't change concurrently
+// dbp must be a transaction: outside of one, the lock is released right away
+func LockRequesterQuota(dbp zesty.DBProvider, requester string) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to lock the quota of %q", requester)
+
+	if _, err := dbp.DB().Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "utask-quota:"+requester); err != nil {
+		return pgjuju.Interpret(err)
+	}
 	return nil
 }
 
+// LatestActivity returns the most recent last activity among all tasks, nil when there is no task
+func LatestActivity(dbp zesty.DBProvider) (*time.Time, error) {
+	latest := struct {
+		Latest *time.Time `db:"latest"`
+	}{}
+
+	if err := dbp.DB().SelectOne(&latest, `SELECT max("task".last_activity) AS latest FROM "task"`); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+	return latest.Latest, nil
+}
+
+type rotationID struct {
+	ID       int64  `db:"id"`
+	PublicID string `db:"public_id"`
+}
+
 // SetWatcherUsernames sets the list of watchers for the task
 func (t *Task) SetWatcherUsernames(watcherUsernames []string) {
 	t.WatcherUsernames = watcherUsernames
@@ -580,8 +858,15 @@ func (t *Task) SetInput(input map[string]interface{}) {
 }
 
 // SetResult consolidates values collected during resolution into the task's final result
-func (t *Task) SetResult(values *values.Values) error {
-	return applyTemplateToMap(t.Result, values)
+func (t *Task) SetResult(v *values.Values) error {
+	if err := applyTemplateToMap(t.Result, v); err != nil {
+		return err
+	}
+	// the result is only displayed, never read again by the resolution
+	if redacted, ok := v.SecretScope().Redact(t.Result).(map[string]interface{}); ok {
+		t.Result = redacted
+	}
+	return nil
 }
 
 func applyTemplateToMap(m map[string]interface{}, values *values.Values) error {
@@ -643,6 +928,42 @@ func (t *Task) SetTags(tags map[string]string, values *values.Values) error {
 	return nil
 }
 
+// renderList templates the entries of a list of usernames or groups declared by a template
+// a templated entry can render to several names, separated by separator
+func renderList(field string, list []string, separator string, v *values.Values) ([]string, error) {
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	rendered := make([]string, 0, len(list))
+	for _, entry := range list {
+		if !strings.Contains(entry, "{{") {
+			if !utils.ListContainsString(rendered, entry) {
+				rendered = append(rendered, entry)
+			}
+			continue
+		}
+
+		out, err := v.Apply(entry, nil, "")
+		if err != nil {
+			return nil, errors.NewBadRequest(err, fmt.Sprintf("failed to template %s entry %q", field, entry))
+		}
+		for _, name := range strings.Split(string(out), separator) {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if strings.ContainsAny(name, " \t\n") || name == "<no value>" {
+				return nil, errors.BadRequestf("invalid %s entry %q, rendered from %q", field, name, entry)
+			}
+			if !utils.ListContainsString(rendered, name) {
+				rendered = append(rendered, name)
+			}
+		}
+	}
+	return rendered, nil
+}
+
 // Valid asserts that the task holds valid data: the state is among accepted states,
 // and input is present and valid given the template spec
 func (t *Task) Valid(tt *tasktemplate.TaskTemplate) error {
@@ -679,6 +1000,7 @@ func (t *Task) ExportTaskInfos(values *values.Values) {
 		m["watcher_groups"] = strings.Join(t.WatcherGroups, utask.GroupsSeparator)
 	}
 	m["last_activity"] = t.LastActivity
+	m["tags"] = t.Tags
 	m["region"] = utask.FRegion
 	if t.Resolution != nil {
 		m["resolution_id"] = t.Resolution
@@ -689,7 +1011,7 @@ func (t *Task) ExportTaskInfos(values *values.Values) {
 
 var (
 	tSelector = sqlgenerator.PGsql.Select(
-		`"task".id, "task".public_id, "task".title, "task".id_template, "task".id_batch, "task".requester_username, "task".requester_groups, "task".watcher_usernames, "task".watcher_groups, "task".created, "task".state, "task".tags, "task".steps_done, "task".steps_total, "task".crypt_key, "task".encrypted_input, "task".encrypted_result, "task".last_activity, "task".resolver_usernames, "task".resolver_groups, "task_template".name as template_name, "task_template".resolver_inputs as resolver_inputs, "resolution".public_id as resolution_public_id, "resolution".last_start as last_start, "resolution".last_stop as last_stop, "resolution".resolver_username as resolver_username, "batch".public_id as batch_public_id`,
+		`"task".id, "task".public_id, "task".title, "task".id_template, "task".template_version, "task".id_batch, "task".requester_username, "task".requester_groups, "task".watcher_usernames, "task".watcher_groups, "task".created, "task".state, "task".tags, "task".ttl, "task".priority, "task".depends_on, "task".assignee, "task".notify_backends, "task".sla_deadline, "task".sla_breached, "task".last_reminder, "task".revision, "task".steps_done, "task".steps_total, "task".crypt_key, "task".encrypted_input, "task".encrypted_result, "task".last_activity, "task".resolver_usernames, "task".resolver_groups, "task_template".name as template_name, "task_template".resolver_inputs as resolver_inputs, "resolution".public_id as resolution_public_id, "resolution".last_start as last_start, "resolution".last_stop as last_stop, "resolution".resolver_username as resolver_username, "batch".public_id as batch_public_id`,
 	).From(
 		`"task"`,
 	).Join(
@@ -701,6 +1023,25 @@ var (
 	)
 )
 
+// validateNotifyBackends checks that the notification backends overridden for a task are registered
+func validateNotifyBackends(notifyBackends []string) error {
+	registered := notify.ListSendersNames()
+	for _, name := range notifyBackends {
+		if !utils.ListContainsString(registered, name) {
+			return errors.BadRequestf("unknown notify backend %q", name)
+		}
+	}
+	return nil
+}
+
+// notifyParams applies the notification backends overridden for this task to the parameters of a notify action
+func (t *Task) notifyParams(params utask.NotifyActionsParameters) utask.NotifyActionsParameters {
+	if len(t.NotifyBackends) > 0 {
+		params.NotifyBackends = t.NotifyBackends
+	}
+	return params
+}
+
 func (t *Task) notifyState(potentialResolvers []string) {
 	tsu := &notify.TaskStateUpdate{
 		Title:              t.Title,
@@ -720,7 +1061,7 @@ func (t *Task) notifyState(potentialResolvers []string) {
 
 	notify.Send(
 		notify.WrapTaskStateUpdate(tsu),
-		notify.ListActions().TaskStateUpdateAction,
+		t.notifyParams(notify.ListActions().TaskStateUpdateAction),
 	)
 }
 
@@ -745,7 +1086,67 @@ func (t *Task) NotifyValidationRequired(tt *tasktemplate.TaskTemplate) {
 
 	notify.Send(
 		notify.WrapTaskValidation(tv),
-		notify.ListActions().TaskValidationAction,
+		t.notifyParams(notify.ListActions().TaskValidationAction),
+	)
+}
+
+// NotifySLABreach notifies that the task is still not over after its sla deadline
+func (t *Task) NotifySLABreach() {
+	tsb := &notify.TaskSLABreach{
+		Title:             t.Title,
+		PublicID:          t.PublicID,
+		State:             t.State,
+		TemplateName:      t.TemplateName,
+		RequesterUsername: t.RequesterUsername,
+		ResolverUsername:  t.ResolverUsername,
+		StepsDone:         t.StepsDone,
+		StepsTotal:        t.StepsTotal,
+		Tags:              t.Tags,
+	}
+	if t.Resolution != nil {
+		tsb.ResolutionPublicID = *t.Resolution
+	}
+	if t.SLADeadline != nil {
+		tsb.SLADeadline = *t.SLADeadline
+	}
+
+	notify.Send(
+		notify.WrapTaskSLABreach(tsb),
+		t.notifyParams(notify.ListActions().TaskSLABreachAction),
+	)
+}
+
+// NotifyResolverReminder reminds the potential resolvers of a task that it is still blocked
+// they are the users and groups allowed to resolve it, as checked by auth.IsResolutionManager
+func (t *Task) NotifyResolverReminder(tt *tasktemplate.TaskTemplate) {
+	potentialResolvers := utils.AppendUniq(append([]string{}, tt.AllowedResolverUsernames...), t.ResolverUsernames...)
+	if tt.AllowAllResolverUsernames {
+		potentialResolvers = utils.AppendUniq(potentialResolvers, t.RequesterUsername)
+	}
+	potentialResolverGroups := utils.AppendUniq(append([]string{}, tt.AllowedResolverGroups...), t.ResolverGroups...)
+
+	tr := &notify.TaskReminder{
+		Title:                   t.Title,
+		PublicID:                t.PublicID,
+		State:                   t.State,
+		TemplateName:            t.TemplateName,
+		RequesterUsername:       t.RequesterUsername,
+		PotentialResolvers:      potentialResolvers,
+		PotentialResolverGroups: potentialResolverGroups,
+		StepsDone:               t.StepsDone,
+		StepsTotal:              t.StepsTotal,
+		Tags:                    t.Tags,
+	}
+	if t.Resolution != nil {
+		tr.ResolutionPublicID = *t.Resolution
+	}
+	if t.LastStop != nil {
+		tr.BlockedSince = *t.LastStop
+	}
+
+	notify.Send(
+		notify.WrapTaskReminder(tr),
+		t.notifyParams(notify.ListActions().TaskResolverReminderAction),
 	)
 }
 
@@ -772,6 +1173,35 @@ func (t *Task) NotifyStepState(stepName, stepState string) {
 
 	notify.Send(
 		notify.WrapTaskStepUpdate(tsu),
-		notify.ListActions().TaskStepUpdateAction,
+		t.notifyParams(notify.ListActions().TaskStepUpdateAction),
 	)
 }
+
+// NotifyStepNotification notifies that a step reached one of the states listed in its notify block,
+// through the backends it lists if any
+func (t *Task) NotifyStepNotification(stepName, stepState, stepError string, backends []string) {
+	if t.Resolution == nil || t.ResolverUsername == nil {
+		return
+	}
+
+	tsn := &notify.TaskStepNotification{
+		Title:              t.Title,
+		PublicID:           t.PublicID,
+		State:              t.State,
+		TemplateName:       t.TemplateName,
+		RequesterUsername:  t.RequesterUsername,
+		ResolverUsername:   *t.ResolverUsername,
+		Tags:               t.Tags,
+		StepName:           stepName,
+		StepState:          stepState,
+		StepError:          stepError,
+		ResolutionPublicID: *t.Resolution,
+	}
+
+	params := t.notifyParams(notify.ListActions().TaskStepNotificationAction)
+	if len(backends) > 0 {
+		params.NotifyBackends = backends
+	}
+
+	notify.Send(notify.WrapTaskStepNotification(tsn), params)
+}
@@ -1,8 +1,18 @@
 package task
 
 import (
+	"testing"
+
+	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
 	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/engine/input"
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/models/tasktemplate"
 )
 
 func DeleteAllTasks(dbp zesty.DBProvider) error {
@@ -26,3 +36,57 @@ func DeleteAllTasks(dbp zesty.DBProvider) error {
 
 	return nil
 }
+
+func Test_renderList(t *testing.T) {
+	v := values.NewValues()
+	v.SetInput(map[string]interface{}{
+		"region":    "eu",
+		"approvers": "alice, bob",
+		"spaced":    "not a name",
+	})
+
+	list, err := renderList("resolver_groups", nil, utask.GroupsSeparator, v)
+	require.NoError(t, err)
+	assert.Nil(t, list)
+
+	list, err = renderList("resolver_groups", []string{"admins", "team-{{.input.region}}"}, utask.GroupsSeparator, v)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admins", "team-eu"}, list)
+
+	list, err = renderList("resolver_usernames", []string{"bob", "{{.input.approvers}}"}, utask.UsernamesSeparator, v)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "alice"}, list)
+
+	_, err = renderList("resolver_usernames", []string{"{{.input.spaced}}"}, utask.UsernamesSeparator, v)
+	assert.True(t, errors.IsBadRequest(err))
+
+	_, err = renderList("resolver_usernames", []string{"{{.input.unknown}}"}, utask.UsernamesSeparator, v)
+	assert.True(t, errors.IsBadRequest(err))
+}
+
+func TestCreateTemplatedLists(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	tt, err := tasktemplate.LoadFromName(dbp, "templated-lists")
+	if errors.IsNotFound(err) {
+		tt, err = tasktemplate.Create(dbp, "templated-lists", "templated lists", nil, nil, []input.Input{{Name: "region"}}, nil, nil, nil, false, false, nil, nil, nil, nil, "templated lists", nil, false, nil)
+	}
+	require.NoError(t, err)
+	tt.TaskResolverGroups = []string{"team-{{.input.region}}"}
+	tt.TaskWatcherUsernames = []string{"oncall"}
+
+	// the lists declared by the template are computed from the input, and added to the requester's ones,
+	// which are never templated
+	tsk, err := Create(dbp, tt, "foo", CreateOptions{
+		WatcherUsernames: []string{"{{.input.region}}"},
+		ResolverGroups:   []string{"admins", "team-{{.input.region}}"},
+		Input:            map[string]interface{}{"region": "eu"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admins", "team-{{.input.region}}", "team-eu"}, tsk.ResolverGroups)
+	assert.Equal(t, []string{"{{.input.region}}", "oncall"}, tsk.WatcherUsernames)
+
+	_, err = Create(dbp, tt, "foo", CreateOptions{Input: map[string]interface{}{"region": "not a region"}})
+	assert.True(t, errors.IsBadRequest(err), "unexpected error: %v", err)
+}
@@ -0,0 +1,127 @@
+package tasktemplate
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/db/pgjuju"
+)
+
+// possible outcomes of the import of a template
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportError   = "error"
+	ImportSkipped = "skipped" // valid template, not committed because of another template's error
+)
+
+// ImportResult reports the outcome of the import of a single template
+type ImportResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ListAll returns every task template in its full representation, steps included
+func ListAll(dbp zesty.DBProvider, includeHidden bool) (tt []*TaskTemplate, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to list templates")
+
+	sel := ttSelector
+	if !includeHidden {
+		sel = sel.Where(squirrel.Eq{`"task_template".hidden`: false})
+	}
+
+	query, params, err := sel.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dbp.DB().Select(&tt, query, params...); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+
+	return tt, nil
+}
+
+// Import upserts a set of task templates within a single transaction
+// Every template is validated beforehand: if any of them is invalid,
+// nothing is committed, and the error is reported for that template
+func Import(dbp zesty.DBProvider, templates []*TaskTemplate) (results []ImportResult, committed bool, err error) {
+	results = make([]ImportResult, len(templates))
+	valid := true
+	seen := make(map[string]bool, len(templates))
+
+	for i, tt := range templates {
+		if tt == nil {
+			results[i] = ImportResult{Status: ImportError, Error: "empty template"}
+			valid = false
+			continue
+		}
+		tt.Normalize()
+		results[i] = ImportResult{Name: tt.Name, Status: ImportSkipped}
+		if seen[tt.Name] {
+			results[i].Status = ImportError
+			results[i].Error = "duplicate template name"
+			valid = false
+			continue
+		}
+		seen[tt.Name] = true
+		if err := tt.Valid(); err != nil {
+			results[i].Status = ImportError
+			results[i].Error = err.Error()
+			valid = false
+		}
+	}
+
+	if !valid {
+		return results, false, nil
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, false, err
+	}
+
+	for i, tt := range templates {
+		status, err := upsert(dbp, tt)
+		if err != nil {
+			dbp.Rollback()
+			if !errors.IsBadRequest(err) && !errors.IsNotValid(err) && !errors.IsAlreadyExists(err) {
+				return nil, false, err
+			}
+			for j := range results[:i] {
+				results[j].Status = ImportSkipped
+			}
+			results[i].Status = ImportError
+			results[i].Error = err.Error()
+			return results, false, nil
+		}
+		results[i].Status = status
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, false, err
+	}
+
+	return results, true, nil
+}
+
+func upsert(dbp zesty.DBProvider, tt *TaskTemplate) (string, error) {
+	existing, err := LoadFromName(dbp, tt.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		if _, err := create(dbp, tt); err != nil {
+			return "", err
+		}
+		return ImportCreated, nil
+	}
+
+	tt.ID = existing.ID
+	if err := update(dbp, tt); err != nil {
+		return "", err
+	}
+	return ImportUpdated, nil
+}
@@ -0,0 +1,160 @@
+package tasktemplate
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// Diff describes the changes between two versions of a template:
+// the fields of the template itself, and its steps added, removed or changed
+type Diff struct {
+	From   int           `json:"from"`
+	To     int           `json:"to"`
+	Fields []FieldChange `json:"fields"`
+	Steps  StepsDiff     `json:"steps"`
+}
+
+// StepsDiff lists the steps added and removed by a version,
+// and the fields changed in the steps both versions have
+type StepsDiff struct {
+	Added   []string                 `json:"added"`
+	Removed []string                 `json:"removed"`
+	Changed map[string][]FieldChange `json:"changed"`
+}
+
+// FieldChange is a single changed value, identified by its dotted path:
+// From is missing for an added field, To for a removed one
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
+
+// DiffVersions compares two recorded versions of a template
+func DiffVersions(dbp zesty.DBProvider, tt *TaskTemplate, from, to int) (d *Diff, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to diff versions %d and %d of template %q", from, to, tt.Name)
+
+	fromTT, err := loadVersionContent(dbp, tt, from)
+	if err != nil {
+		return nil, err
+	}
+	toTT, err := loadVersionContent(dbp, tt, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffTemplates(fromTT, toTT)
+}
+
+// DiffTemplates compares the content of two templates
+func DiffTemplates(from, to *TaskTemplate) (*Diff, error) {
+	fromContent, err := diffContent(from)
+	if err != nil {
+		return nil, err
+	}
+	toContent, err := diffContent(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fromSteps, _ := fromContent["steps"].(map[string]interface{})
+	toSteps, _ := toContent["steps"].(map[string]interface{})
+	delete(fromContent, "steps")
+	delete(toContent, "steps")
+
+	d := &Diff{
+		From:   from.Version,
+		To:     to.Version,
+		Fields: diffValues("", fromContent, toContent),
+		Steps: StepsDiff{
+			Added:   []string{},
+			Removed: []string{},
+			Changed: map[string][]FieldChange{},
+		},
+	}
+
+	for _, name := range sortedKeys(fromSteps, toSteps) {
+		fromStep, inFrom := fromSteps[name]
+		toStep, inTo := toSteps[name]
+		switch {
+		case !inFrom:
+			d.Steps.Added = append(d.Steps.Added, name)
+		case !inTo:
+			d.Steps.Removed = append(d.Steps.Removed, name)
+		default:
+			if changes := diffValues("", fromStep, toStep); len(changes) > 0 {
+				d.Steps.Changed[name] = changes
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// diffContent returns the generic json representation of a template, without its version
+func diffContent(tt *TaskTemplate) (map[string]interface{}, error) {
+	cpy := *tt
+	cpy.Version = 0
+	b, err := utils.JSONMarshal(cpy)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(b, &content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// diffValues walks through json objects to list the values changed between a and b,
+// any other value being compared as a whole
+func diffValues(path string, a, b interface{}) []FieldChange {
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if !aIsMap || !bIsMap {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []FieldChange{{Field: path, From: a, To: b}}
+	}
+
+	changes := []FieldChange{}
+	for _, k := range sortedKeys(aMap, bMap) {
+		subpath := k
+		if path != "" {
+			subpath = path + "." + k
+		}
+		aValue, inA := aMap[k]
+		bValue, inB := bMap[k]
+		switch {
+		case !inA:
+			changes = append(changes, FieldChange{Field: subpath, To: bValue})
+		case !inB:
+			changes = append(changes, FieldChange{Field: subpath, From: aValue})
+		default:
+			changes = append(changes, diffValues(subpath, aValue, bValue)...)
+		}
+	}
+	return changes
+}
+
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
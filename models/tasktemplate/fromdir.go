@@ -58,6 +58,11 @@ func LoadFromDir(dbp zesty.DBProvider, directories ...string) error {
 		} else {
 			verb = "Updated"
 			tt.ID = existing.ID
+			// a template blocked by an administrator stays blocked until unblocked the same way,
+			// unlike a template archived while missing from the directory, which comes back with it
+			if existing.Blocked && (!existing.Hidden || tt.Hidden) {
+				tt.Blocked = true
+			}
 			if err := update(dbp, &tt); err != nil {
 				return fmt.Errorf("failed to update template '%s': %s", tt.Name, err)
 			}
@@ -69,7 +74,7 @@ func LoadFromDir(dbp zesty.DBProvider, directories ...string) error {
 	var last *string
 	currentTemplates := []*TaskTemplate{}
 	for {
-		taskTemplatesFromDatabase, err := ListTemplates(dbp, true, 100, last)
+		taskTemplatesFromDatabase, err := ListTemplates(dbp, true, nil, 100, last)
 		if err != nil {
 			logrus.Fatalf("unable to remove old templates: %s", err)
 		}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
 	"github.com/ovh/configstore"
 	"github.com/sirupsen/logrus"
@@ -63,7 +64,7 @@ func TestLoadFromDir(t *testing.T) {
 	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
 	assert.Nil(t, err, "LoadFromDir failed")
 
-	taskTemplatesFromDatabase, err := tasktemplate.ListTemplates(dbp, true, 10, nil)
+	taskTemplatesFromDatabase, err := tasktemplate.ListTemplates(dbp, true, nil, 10, nil)
 	assert.Nil(t, err, "ListTemplates failed")
 	assert.Len(t, taskTemplatesFromDatabase, 2, "wrong size of imported templates")
 
@@ -82,14 +83,14 @@ func TestLoadFromDir(t *testing.T) {
 	err = dbp.DB().Insert(&tt)
 	assert.Nil(t, err, "unable to insert new template")
 
-	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, 10, nil)
+	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, nil, 10, nil)
 	assert.Nil(t, err, "ListTemplates failed")
 	assert.Len(t, taskTemplatesFromDatabase, 3, "wrong size of imported templates")
 
 	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
 	assert.Nil(t, err, "LoadFromDir failed")
 
-	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, 10, nil)
+	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, nil, 10, nil)
 	assert.Nil(t, err, "ListTemplates failed")
 	assert.Len(t, taskTemplatesFromDatabase, 2, "wrong size of imported templates")
 
@@ -97,13 +98,13 @@ func TestLoadFromDir(t *testing.T) {
 	err = dbp.DB().Insert(&tt)
 	assert.Nil(t, err, "unable to insert new template")
 
-	_, err = task.Create(dbp, &tt, "admin", []string{}, []string{}, []string{}, []string{}, []string{}, map[string]interface{}{}, nil, nil, false)
+	_, err = task.Create(dbp, &tt, "admin", task.CreateOptions{})
 	assert.Nil(t, err, "unable to create task")
 
 	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
 	assert.Nil(t, err, "LoadFromDir failed")
 
-	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, 10, nil)
+	taskTemplatesFromDatabase, err = tasktemplate.ListTemplates(dbp, true, nil, 10, nil)
 	assert.Nil(t, err, "ListTemplates failed")
 	assert.Len(t, taskTemplatesFromDatabase, 3, "wrong size of imported templates")
 
@@ -115,6 +116,135 @@ func TestLoadFromDir(t *testing.T) {
 	assert.True(t, tt2.Blocked, "template should have been blocked as not existing in dir but have linked task")
 }
 
+func TestLoadFromDirKeepsBlocked(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
+	assert.Nil(t, err, "LoadFromDir failed")
+
+	tt, err := tasktemplate.LoadFromName(dbp, "hello-world-now")
+	assert.Nil(t, err, "unable to load template")
+	assert.False(t, tt.Blocked)
+
+	// a template blocked by an administrator stays blocked across restarts
+	assert.Nil(t, tt.SetBlocked(dbp, true), "unable to block template")
+	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
+	assert.Nil(t, err, "LoadFromDir failed")
+	tt, err = tasktemplate.LoadFromName(dbp, "hello-world-now")
+	assert.Nil(t, err, "unable to load template")
+	assert.True(t, tt.Blocked, "template should have stayed blocked")
+
+	// until unblocked
+	assert.Nil(t, tt.SetBlocked(dbp, false), "unable to unblock template")
+	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
+	assert.Nil(t, err, "LoadFromDir failed")
+	tt, err = tasktemplate.LoadFromName(dbp, "hello-world-now")
+	assert.Nil(t, err, "unable to load template")
+	assert.False(t, tt.Blocked, "template should have stayed unblocked")
+
+	// an archived template coming back in the directory is unblocked with it
+	tt.Hidden = true
+	tt.Blocked = true
+	_, err = dbp.DB().Update(tt)
+	assert.Nil(t, err, "unable to archive template")
+	err = tasktemplate.LoadFromDir(dbp, "templates_tests")
+	assert.Nil(t, err, "LoadFromDir failed")
+	tt, err = tasktemplate.LoadFromName(dbp, "hello-world-now")
+	assert.Nil(t, err, "unable to load template")
+	assert.False(t, tt.Hidden, "template should have been restored")
+	assert.False(t, tt.Blocked, "template should have been restored")
+}
+
+func TestTemplateVersions(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readTemplate := func() *tasktemplate.TaskTemplate {
+		tt := tasktemplate.TaskTemplate{}
+		tmpl, err := os.ReadFile(path.Join("templates_tests", "hello-world-now.yaml"))
+		assert.Nil(t, err, "unable to read file hello-world-now.yaml")
+		err = yaml.Unmarshal(tmpl, &tt)
+		assert.Nil(t, err, "unable to unmarshal tasktemplate")
+		tt.Name = "versioned template"
+		return &tt
+	}
+
+	_, committed, err := tasktemplate.Import(dbp, []*tasktemplate.TaskTemplate{readTemplate()})
+	assert.Nil(t, err, "unable to import template")
+	assert.True(t, committed)
+
+	v1, err := tasktemplate.LoadFromName(dbp, "versioned-template")
+	assert.Nil(t, err, "unable to load template")
+	assert.Equal(t, 1, v1.Version)
+
+	// saving the same content keeps the version
+	_, _, err = tasktemplate.Import(dbp, []*tasktemplate.TaskTemplate{readTemplate()})
+	assert.Nil(t, err, "unable to import template")
+	tt, err := tasktemplate.LoadFromName(dbp, "versioned-template")
+	assert.Nil(t, err, "unable to load template")
+	assert.Equal(t, 1, tt.Version)
+
+	changed := readTemplate()
+	changed.Description = "Changed description"
+	_, _, err = tasktemplate.Import(dbp, []*tasktemplate.TaskTemplate{changed})
+	assert.Nil(t, err, "unable to import template")
+	tt, err = tasktemplate.LoadFromName(dbp, "versioned-template")
+	assert.Nil(t, err, "unable to load template")
+	assert.Equal(t, 2, tt.Version)
+
+	pinned, err := tasktemplate.LoadVersion(dbp, tt.ID, 1)
+	assert.Nil(t, err, "unable to load version 1")
+	assert.Equal(t, 1, pinned.Version)
+	assert.Equal(t, v1.Description, pinned.Description)
+	assert.Equal(t, len(v1.Steps), len(pinned.Steps))
+
+	pinnedTask, err := task.Create(dbp, pinned, "admin", task.CreateOptions{})
+	assert.Nil(t, err, "unable to create task")
+	assert.Equal(t, 1, pinnedTask.TemplateVersion)
+
+	_, err = tasktemplate.LoadVersion(dbp, tt.ID, 3)
+	assert.True(t, errors.IsNotFound(err))
+
+	diff, err := tasktemplate.DiffVersions(dbp, tt, 1, 2)
+	assert.Nil(t, err, "unable to diff versions")
+	assert.Equal(t, []tasktemplate.FieldChange{{Field: "description", From: v1.Description, To: "Changed description"}}, diff.Fields)
+	assert.Empty(t, diff.Steps.Changed)
+}
+
+func TestDiffTemplates(t *testing.T) {
+	tmpl, err := os.ReadFile(path.Join("templates_tests", "hello-world-now.yaml"))
+	assert.Nil(t, err, "unable to read file hello-world-now.yaml")
+
+	from := tasktemplate.TaskTemplate{}
+	err = yaml.Unmarshal(tmpl, &from)
+	assert.Nil(t, err, "unable to unmarshal tasktemplate")
+	from.Version = 1
+
+	to := tasktemplate.TaskTemplate{}
+	err = yaml.Unmarshal(tmpl, &to)
+	assert.Nil(t, err, "unable to unmarshal tasktemplate")
+	to.Version = 2
+	to.Hidden = true
+	to.Steps["sayHello"].Description = "Echo a greeting"
+	to.Steps["sayGoodbye"] = &step.Step{Description: "Echo a farewell"}
+
+	diff, err := tasktemplate.DiffTemplates(&from, &to)
+	assert.Nil(t, err, "unable to diff templates")
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 2, diff.To)
+	assert.Equal(t, []tasktemplate.FieldChange{{Field: "hidden", From: false, To: true}}, diff.Fields)
+	assert.Equal(t, []string{"sayGoodbye"}, diff.Steps.Added)
+	assert.Empty(t, diff.Steps.Removed)
+	assert.Equal(t, map[string][]tasktemplate.FieldChange{
+		"sayHello": {{Field: "description", From: "Echo a greeting in your language of choice", To: "Echo a greeting"}},
+	}, diff.Steps.Changed)
+}
+
 func TestInvalidVariablesTemplates(t *testing.T) {
 	tt := tasktemplate.TaskTemplate{}
 	tmpl, err := os.ReadFile(path.Join("templates_errors_tests", "error-variables.yaml"))
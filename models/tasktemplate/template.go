@@ -3,6 +3,7 @@ package tasktemplate
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/squirrel"
@@ -14,6 +15,7 @@ import (
 	"github.com/cneill/utask/engine/input"
 	"github.com/cneill/utask/engine/step"
 	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/jsonschema"
 	"github.com/cneill/utask/pkg/utils"
 )
 
@@ -27,6 +29,7 @@ import (
 type TaskTemplate struct {
 	ID              int64                  `json:"-" db:"id"`
 	Name            string                 `json:"name" db:"name"`
+	Version         int                    `json:"version,omitempty" db:"version"` // incremented each time the template's content changes
 	Description     string                 `json:"description" db:"description"`
 	LongDescription *string                `json:"long_description,omitempty" db:"long_description"`
 	DocLink         *string                `json:"doc_link,omitempty" db:"doc_link"`
@@ -36,13 +39,26 @@ type TaskTemplate struct {
 	AllowedResolverGroups     []string `json:"allowed_resolver_groups" db:"allowed_resolver_groups"`
 	AllowedResolverUsernames  []string `json:"allowed_resolver_usernames" db:"allowed_resolver_usernames"`
 	AllowAllResolverUsernames bool     `json:"allow_all_resolver_usernames" db:"allow_all_resolver_usernames"`
+	TaskResolverUsernames     []string `json:"task_resolver_usernames,omitempty" db:"task_resolver_usernames"` // added to the resolvers of each task, templated from its input
+	TaskResolverGroups        []string `json:"task_resolver_groups,omitempty" db:"task_resolver_groups"`
+	TaskWatcherUsernames      []string `json:"task_watcher_usernames,omitempty" db:"task_watcher_usernames"` // added to the watchers of each task, templated from its input
+	TaskWatcherGroups         []string `json:"task_watcher_groups,omitempty" db:"task_watcher_groups"`
 	AutoRunnable              bool     `json:"auto_runnable" db:"auto_runnable"`
 	Blocked                   bool     `json:"blocked" db:"blocked"`
 	Hidden                    bool     `json:"hidden" db:"hidden"`
 	RetryMax                  *int     `json:"retry_max,omitempty" db:"retry_max"`
 	AllowTaskStartOver        bool     `json:"allow_task_start_over" db:"allow_task_start_over"`
+	TTL                       *string  `json:"ttl,omitempty" db:"ttl"`                                 // how long tasks are kept after completion
+	Priority                  int      `json:"priority,omitempty" db:"priority"`                       // default priority of tasks, the highest runs first
+	MaxConcurrent             *int     `json:"max_concurrent,omitempty" db:"max_concurrent"`           // cap on the resolutions running simultaneously
+	SLA                       *string  `json:"sla,omitempty" db:"sla"`                                 // how long tasks may run before a breach is notified
+	ReminderThreshold         *string  `json:"reminder_threshold,omitempty" db:"reminder_threshold"`   // how long tasks stay blocked before their resolvers are reminded
+	ReminderInterval          *string  `json:"reminder_interval,omitempty" db:"reminder_interval"`     // how often the reminder is repeated, default: the threshold
+	MaxStepExecutions         *int     `json:"max_step_executions,omitempty" db:"max_step_executions"` // cap on the step executions of a resolution
+	RetryBudget               *int     `json:"retry_budget,omitempty" db:"retry_budget"`               // cap on the step retries of a resolution, all steps included
 
 	Inputs             []input.Input              `json:"inputs,omitempty" db:"inputs"`
+	InputSchema        map[string]interface{}     `json:"input_schema,omitempty" db:"input_schema"` // json schema for the whole input object
 	ResolverInputs     []input.Input              `json:"resolver_inputs,omitempty" db:"resolver_inputs"`
 	Variables          []values.Variable          `json:"variables,omitempty" db:"variables"`
 	Tags               map[string]string          `json:"tags,omitempty" db:"tags"`
@@ -104,10 +120,15 @@ func create(dbp zesty.DBProvider, tt *TaskTemplate) (*TaskTemplate, error) {
 		return nil, err
 	}
 
+	tt.Version = 1
 	if err := dbp.DB().Insert(tt); err != nil {
 		return nil, pgjuju.Interpret(err)
 	}
 
+	if err := saveVersion(dbp, tt); err != nil {
+		return nil, err
+	}
+
 	return tt, nil
 }
 
@@ -151,7 +172,8 @@ func LoadFromID(dbp zesty.DBProvider, id int64) (tt *TaskTemplate, err error) {
 }
 
 // ListTemplates returns a list of task templates, in a simplified form (steps not included)
-func ListTemplates(dbp zesty.DBProvider, includeHidden bool, pageSize uint64, last *string) (tt []*TaskTemplate, err error) {
+// only the templates holding all the given tags are listed
+func ListTemplates(dbp zesty.DBProvider, includeHidden bool, tags map[string]string, pageSize uint64, last *string) (tt []*TaskTemplate, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to list templates")
 
 	sel := ttBasicSelector.OrderBy(
@@ -164,6 +186,14 @@ func ListTemplates(dbp zesty.DBProvider, includeHidden bool, pageSize uint64, la
 		sel = sel.Where(squirrel.Eq{`"task_template".hidden`: false})
 	}
 
+	if len(tags) > 0 {
+		b, err := json.Marshal(tags)
+		if err != nil {
+			return nil, err
+		}
+		sel = sel.Where(`"task_template".tags @> ?::jsonb`, string(b))
+	}
+
 	if last != nil {
 		lastTT, err := LoadFromName(dbp, *last)
 		if err != nil {
@@ -263,6 +293,25 @@ func (tt *TaskTemplate) Update(dbp zesty.DBProvider,
 	return
 }
 
+// SetBlocked allows or refuses the creation of new tasks from a template
+// as an access rule, it doesn't change the content of the template nor its version
+func (tt *TaskTemplate) SetBlocked(dbp zesty.DBProvider, blocked bool) (err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to update template")
+
+	res, err := dbp.DB().Exec(`UPDATE "task_template" SET blocked = $1 WHERE id = $2`, blocked, tt.ID)
+	if err != nil {
+		return pgjuju.Interpret(err)
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.NotFoundf("No such template to update: %s", tt.Name)
+	}
+
+	tt.Blocked = blocked
+	return nil
+}
+
 func update(dbp zesty.DBProvider, tt *TaskTemplate) error {
 	tt.Normalize()
 
@@ -270,6 +319,10 @@ func update(dbp zesty.DBProvider, tt *TaskTemplate) error {
 		return err
 	}
 
+	if err := saveVersion(dbp, tt); err != nil {
+		return err
+	}
+
 	rows, err := dbp.DB().Update(tt)
 	if err != nil {
 		return pgjuju.Interpret(err)
@@ -328,6 +381,49 @@ func (tt *TaskTemplate) Valid() (err error) {
 		return err
 	}
 
+	if tt.TTL != nil {
+		if err := utils.ValidateTTL(*tt.TTL); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value *string
+	}{
+		{"sla", tt.SLA},
+		{"reminder_threshold", tt.ReminderThreshold},
+		{"reminder_interval", tt.ReminderInterval},
+	} {
+		if d.value == nil {
+			continue
+		}
+		if duration, err := time.ParseDuration(*d.value); err != nil {
+			return errors.NewNotValid(err, "invalid "+d.name)
+		} else if duration <= 0 {
+			return errors.NewNotValid(nil, fmt.Sprintf("%s must be a positive duration: %q", d.name, *d.value))
+		}
+	}
+	if tt.ReminderInterval != nil && tt.ReminderThreshold == nil {
+		return errors.NewNotValid(nil, "reminder_interval requires a reminder_threshold")
+	}
+
+	if tt.MaxConcurrent != nil && *tt.MaxConcurrent < 1 {
+		return errors.NewNotValid(nil, "max_concurrent must be positive")
+	}
+
+	if tt.MaxStepExecutions != nil && *tt.MaxStepExecutions < 1 {
+		return errors.NewNotValid(nil, "max_step_executions must be positive")
+	}
+
+	if tt.RetryBudget != nil && *tt.RetryBudget < 0 {
+		return errors.NewNotValid(nil, "retry_budget can't be negative")
+	}
+
+	if err := tt.validInputSchema(); err != nil {
+		return err
+	}
+
 	if tt.LongDescription != nil {
 		if err := utils.ValidText("template long description", *tt.LongDescription); err != nil {
 			return err
@@ -373,10 +469,19 @@ func (tt *TaskTemplate) Valid() (err error) {
 		return err
 	}
 
-	if err := validTemplate(string(tmplJSON), inputNames, resolverInputNames, tt.Steps); err != nil {
+	variableNames := make([]string, 0, len(tt.Variables))
+	for _, v := range tt.Variables {
+		variableNames = append(variableNames, v.Name)
+	}
+
+	if err := validTemplate(string(tmplJSON), inputNames, resolverInputNames, variableNames, tt.Steps); err != nil {
 		return errors.NewNotValid(err, "Invalid text-template handles within task template")
 	}
 
+	if err := validJQQueries(tmplJSON); err != nil {
+		return errors.NewNotValid(err, "Invalid jq query within task template")
+	}
+
 	return nil
 }
 
@@ -389,19 +494,26 @@ func (tt *TaskTemplate) IsAutoRunnable() bool {
 // ValidateResolverInputs asserts that input values provided by a task's resolver
 // conform to the template's spec for resolver inputs
 func (tt *TaskTemplate) ValidateResolverInputs(inputValues map[string]interface{}) error {
-	return validateInputsValues(tt.ResolverInputs, inputValues)
+	return validateInputsValues(tt.ResolverInputs, inputValues, values.ResolverInputKey)
 }
 
 // ValidateInputs asserts that input values provided by a task's requester
 // conform to the template's spec for requester inputs
 func (tt *TaskTemplate) ValidateInputs(inputValues map[string]interface{}) error {
-	return validateInputsValues(tt.Inputs, inputValues)
+	return validateInputsValues(tt.Inputs, inputValues, values.InputKey)
 }
 
-func validateInputsValues(inputs []input.Input, inputValues map[string]interface{}) error {
+// validateInputsValues checks the given values and fills in the defaults of missing ones
+// computed defaults are rendered last, in declaration order, with the values known so far under key
+func validateInputsValues(inputs []input.Input, inputValues map[string]interface{}, key string) error {
+	computed := make([]input.Input, 0)
 	for _, i := range inputs {
 		val, ok := inputValues[i.Name]
 		if !ok || val == nil || val == "" {
+			if i.HasComputedDefault() {
+				computed = append(computed, i)
+				continue
+			}
 			if i.Default != nil {
 				inputValues[i.Name] = i.Default
 				continue
@@ -415,6 +527,76 @@ func validateInputsValues(inputs []input.Input, inputValues map[string]interface
 			}
 		}
 	}
+
+	for _, i := range computed {
+		val, err := computeDefault(i, inputValues, key)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			if !i.Optional {
+				return errors.BadRequestf("Missing input '%s'", i.Name)
+			}
+			continue
+		}
+		if err := i.CheckValue(val); err != nil {
+			return err
+		}
+		inputValues[i.Name] = val
+	}
+	return nil
+}
+
+// computeDefault renders the default value of an input,
+// a nil value meaning that it rendered empty
+func computeDefault(i input.Input, inputValues map[string]interface{}, key string) (interface{}, error) {
+	v := values.NewValues()
+	if key == values.ResolverInputKey {
+		v.SetResolverInput(inputValues)
+	} else {
+		v.SetInput(inputValues)
+	}
+
+	rendered, err := v.Apply(i.Default.(string), nil, "")
+	if err != nil {
+		return nil, errors.BadRequestf("Failed to compute default of input '%s': %s", i.Name, err)
+	}
+
+	str := strings.TrimSpace(string(rendered))
+	if str == "" || str == "<no value>" {
+		return nil, nil
+	}
+	return i.ValueFromString(str)
+}
+
+// ValidateInputSchema asserts that input values provided by a task's requester
+// match the json schema declared by the template, defaults being expected to be filled in already
+func (tt *TaskTemplate) ValidateInputSchema(inputValues map[string]interface{}) error {
+	if tt.InputSchema == nil {
+		return nil
+	}
+
+	schema, err := utils.JSONMarshal(tt.InputSchema)
+	if err != nil {
+		return err
+	}
+	if err := jsonschema.Validate(tt.Name, schema, inputValues); err != nil {
+		return errors.BadRequestf("Invalid input: %s", strings.Join(jsonschema.ValidationDetails(err), "; "))
+	}
+	return nil
+}
+
+func (tt *TaskTemplate) validInputSchema() error {
+	if tt.InputSchema == nil {
+		return nil
+	}
+	schema, err := utils.JSONMarshal(tt.InputSchema)
+	if err != nil {
+		return errors.NewNotValid(err, "invalid input_schema")
+	}
+	if _, err := jsonschema.NormalizeAndCompile(tt.Name, schema); err != nil {
+		return errors.NewNotValid(err, "invalid input_schema")
+	}
 	return nil
 }
 
@@ -468,7 +650,7 @@ func validateVariables(variables []values.Variable) error {
 
 var (
 	ttBasicSelector = sqlgenerator.PGsql.Select(
-		`"task_template".id, "task_template".name, "task_template".description, "task_template".long_description, "task_template".doc_link, "task_template".allowed_resolver_groups, "task_template".allowed_resolver_usernames, "task_template".allow_all_resolver_usernames, "task_template".auto_runnable, "task_template".blocked, "task_template".hidden, "task_template".retry_max, "task_template".allow_task_start_over, "task_template".inputs, "task_template".resolver_inputs, "task_template".base_configurations, "task_template".tags`,
+		`"task_template".id, "task_template".name, "task_template".version, "task_template".description, "task_template".long_description, "task_template".doc_link, "task_template".allowed_resolver_groups, "task_template".allowed_resolver_usernames, "task_template".allow_all_resolver_usernames, "task_template".task_resolver_usernames, "task_template".task_resolver_groups, "task_template".task_watcher_usernames, "task_template".task_watcher_groups, "task_template".auto_runnable, "task_template".blocked, "task_template".hidden, "task_template".retry_max, "task_template".allow_task_start_over, "task_template".inputs, "task_template".resolver_inputs, "task_template".base_configurations, "task_template".tags, "task_template".ttl, "task_template".priority, "task_template".max_concurrent, "task_template".input_schema, "task_template".sla, "task_template".reminder_threshold, "task_template".reminder_interval, "task_template".max_step_executions, "task_template".retry_budget`,
 	).From(
 		`"task_template"`,
 	).OrderBy(
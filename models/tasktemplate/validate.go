@@ -22,7 +22,7 @@ var (
 	tmplRegex = regexp.MustCompile(`{{[^}\.]*(\.[A-Za-z0-9_\.]+)[^{]*}}`)
 )
 
-func validTemplate(template string, inputs, resolverInputs []string, steps map[string]*step.Step) error {
+func validTemplate(template string, inputs, resolverInputs, variables []string, steps map[string]*step.Step) error {
 	// Ranging over tmplRegex.FindAllStringSubmatch does not match all "should-match" values, so
 	// we split the indented json line by line, and match each lines.
 	matches := make([][]string, 0)
@@ -31,7 +31,7 @@ func validTemplate(template string, inputs, resolverInputs []string, steps map[s
 	}
 
 	stepNames := stepNames(steps)
-	taskInfoKeys := []string{"resolver_username", "created", "requester_username", "requester_groups", "task_id", "region", "resolution_id", "watcher_usernames", "watcher_groups"}
+	taskInfoKeys := []string{"resolver_username", "created", "requester_username", "requester_groups", "task_id", "region", "resolution_id", "watcher_usernames", "watcher_groups", "tags"}
 	for _, m := range matches {
 		parts := strings.Split(m[1], ".")
 		if len(parts) >= 3 {
@@ -69,6 +69,10 @@ func validTemplate(template string, inputs, resolverInputs []string, steps map[s
 				if !utils.ListContainsString(resolverInputs, key) {
 					return fmt.Errorf("Wrong input key: %s", key)
 				}
+			case values.ComputedKey:
+				if !utils.ListContainsString(variables, key) {
+					return fmt.Errorf("Wrong computed value key: %s", key)
+				}
 			case values.ConfigKey:
 				// TODO... not sure how to check this... against global secret store?
 			case values.TaskKey:
@@ -85,6 +89,35 @@ func validTemplate(template string, inputs, resolverInputs []string, steps map[s
 	return nil
 }
 
+// validJQQueries compiles the jq queries found in every string of a template
+func validJQQueries(tmplJSON []byte) error {
+	var tmpl interface{}
+	if err := json.Unmarshal(tmplJSON, &tmpl); err != nil {
+		return err
+	}
+	return walkStrings(tmpl, values.ValidateJQQueries)
+}
+
+func walkStrings(i interface{}, f func(string) error) error {
+	switch v := i.(type) {
+	case string:
+		return f(v)
+	case []interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, f); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := walkStrings(item, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // expect parts to contain:
 // - {stepname}
 // - "output"
@@ -0,0 +1,131 @@
+package tasktemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// LoadVersion returns a task template as it was saved in a given version, so that
+// a task keeps running the steps it was created with after its template is edited.
+// Access rules (blocked, hidden, allowed resolvers) are always those of the latest version.
+func LoadVersion(dbp zesty.DBProvider, id int64, version int) (tt *TaskTemplate, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load version %d of template from ID %d", version, id)
+
+	latest, err := LoadFromID(dbp, id)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Version == version {
+		return latest, nil
+	}
+
+	tt, err = loadVersionContent(dbp, latest, version)
+	if err != nil {
+		return nil, err
+	}
+	tt.Blocked = latest.Blocked
+	tt.Hidden = latest.Hidden
+	tt.AllowedResolverGroups = latest.AllowedResolverGroups
+	tt.AllowedResolverUsernames = latest.AllowedResolverUsernames
+	tt.AllowAllResolverUsernames = latest.AllowAllResolverUsernames
+
+	return tt, nil
+}
+
+// loadVersionContent returns the template content recorded for a version, as it was saved
+func loadVersionContent(dbp zesty.DBProvider, latest *TaskTemplate, version int) (tt *TaskTemplate, err error) {
+	content, err := dbp.DB().SelectNullStr(
+		`SELECT template FROM "task_template_version" WHERE id_template = $1 AND version = $2`,
+		latest.ID, version,
+	)
+	if err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+	if !content.Valid {
+		return nil, errors.NotFoundf("version %d of template %q", version, latest.Name)
+	}
+
+	if err := json.Unmarshal([]byte(content.String), &tt); err != nil {
+		return nil, err
+	}
+	tt.ID = latest.ID
+	tt.Version = version
+	tt.Name = latest.Name
+	return tt, nil
+}
+
+type templateVersion struct {
+	Version  int    `db:"version"`
+	Template string `db:"template"`
+}
+
+// saveVersion records the content of a template, under a new version if it changed
+// since its latest saved version
+func saveVersion(dbp zesty.DBProvider, tt *TaskTemplate) error {
+	// the version itself is not part of the content
+	tt.Version = 0
+	content, err := utils.JSONMarshal(tt)
+	if err != nil {
+		return err
+	}
+
+	var latest []templateVersion
+	if _, err := dbp.DB().Select(&latest,
+		`SELECT version, template FROM "task_template_version" WHERE id_template = $1 ORDER BY version DESC LIMIT 1`,
+		tt.ID,
+	); err != nil {
+		return pgjuju.Interpret(err)
+	}
+
+	if len(latest) > 0 {
+		tt.Version = latest[0].Version
+		same, err := sameContent([]byte(latest[0].Template), content)
+		if err != nil {
+			return err
+		}
+		if same {
+			return nil
+		}
+	}
+
+	tt.Version++
+	if _, err := dbp.DB().Exec(
+		`INSERT INTO "task_template_version" (id_template, version, template) VALUES ($1, $2, $3)`,
+		tt.ID, tt.Version, string(content),
+	); err != nil {
+		return pgjuju.Interpret(err)
+	}
+
+	return nil
+}
+
+// sameContent compares the content of a recorded version with a template's marshaled content,
+// regardless of the formatting and keys order of the json documents: the recorded one goes
+// through a template again, as it may come from the database row itself
+func sameContent(recorded, content []byte) (bool, error) {
+	var tt TaskTemplate
+	if err := json.Unmarshal(recorded, &tt); err != nil {
+		return false, fmt.Errorf("invalid template version: %s", err)
+	}
+	tt.Version = 0
+	normalized, err := utils.JSONMarshal(tt)
+	if err != nil {
+		return false, err
+	}
+
+	var a, b interface{}
+	if err := json.Unmarshal(normalized, &a); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(content, &b); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
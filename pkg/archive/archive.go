@@ -0,0 +1,312 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/compress"
+	"github.com/cneill/utask/pkg/now"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// utask tasks can be archived to a cold storage before being deleted
+// an archive is a bundle of the task, its resolution and its comments,
+// serialized as JSON, compressed and encrypted with the storage key, stored in a configured sink:
+// the bundle holds the decrypted inputs and step outputs, which never reach the sink in clear
+
+// FormatVersion is the version of the archive format, stored in every bundle
+const FormatVersion = 1
+
+// extension of an archive name, before the compression algorithm
+const extension = ".json."
+
+var (
+	sink             Sink
+	compressionAlg   string
+	archiveOnExpired bool
+)
+
+// Sink is a storage backend for archives
+type Sink interface {
+	Store(ctx context.Context, name string, data []byte) error
+	Load(ctx context.Context, name string) ([]byte, error)
+}
+
+// Bundle is the archived representation of a task, its resolution and its comments
+type Bundle struct {
+	Version    int                    `json:"version"`
+	ArchivedAt time.Time              `json:"archived_at"`
+	Task       *task.Task             `json:"task"`
+	Resolution *resolution.Resolution `json:"resolution,omitempty"`
+	Secrets    []string               `json:"secrets,omitempty"` // values redacted from the results of the resolution
+}
+
+// RegisterSink sets the sink used to store archives,
+// and the compression algorithm applied to them
+// onExpiration makes the garbage collector archive the tasks it deletes
+func RegisterSink(s Sink, compressionAlgorithm string, onExpiration bool) error {
+	if _, err := compress.Get(compressionAlgorithm); err != nil {
+		return err
+	}
+	sink = s
+	compressionAlg = compressionAlgorithm
+	archiveOnExpired = onExpiration
+	return nil
+}
+
+// UnregisterSink removes the sink used to store archives: tasks are not archived anymore
+func UnregisterSink() {
+	sink = nil
+	compressionAlg = ""
+	archiveOnExpired = false
+}
+
+// Enabled asserts that a sink is configured to store archives
+func Enabled() bool {
+	return sink != nil
+}
+
+// OnExpiration asserts that expired tasks should be archived before their deletion
+func OnExpiration() bool {
+	return Enabled() && archiveOnExpired
+}
+
+// Name returns the name of the archive of a task
+func Name(taskID, compressionAlgorithm string) string {
+	return taskID + extension + compressionAlgorithm
+}
+
+// NewBundle gathers a task, its resolution and comments
+func NewBundle(dbp zesty.DBProvider, t *task.Task) (*Bundle, error) {
+	b := &Bundle{
+		Version:    FormatVersion,
+		ArchivedAt: now.Get(),
+		Task:       t,
+	}
+
+	if t.Comments == nil {
+		comments, err := task.LoadCommentsFromTaskID(dbp, t.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.Comments = comments
+	}
+
+	if t.Resolution != nil {
+		r, err := resolution.LoadFromPublicID(dbp, *t.Resolution)
+		if err != nil {
+			return nil, err
+		}
+		b.Resolution = r
+		b.Secrets = r.Values.SecretScope().Values()
+	}
+
+	return b, nil
+}
+
+// Encode serializes, compresses and encrypts a bundle with the storage key,
+// bound to the ID of its task
+func Encode(b *Bundle, compressionAlgorithm string) ([]byte, error) {
+	c, err := compress.Get(compressionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := utils.JSONMarshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := c.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.EncryptionKey.Encrypt(compressed, []byte(b.Task.PublicID))
+}
+
+// Decode decrypts, decompresses and deserializes the bundle of a task
+// it must have been encrypted with one of the storage keys still configured
+func Decode(data []byte, taskID, compressionAlgorithm string) (*Bundle, error) {
+	c, err := compress.Get(compressionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := models.EncryptionKey.Decrypt(data, []byte(taskID))
+	if err != nil {
+		return nil, errors.Annotate(err, "failed to decrypt archive")
+	}
+
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var b Bundle
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(decompressed), &b); err != nil {
+		return nil, err
+	}
+	if b.Version != FormatVersion {
+		return nil, errors.NotSupportedf("archive format version %d", b.Version)
+	}
+	if b.Task == nil || b.Task.PublicID != taskID {
+		return nil, errors.NotValidf("archive without task %s", taskID)
+	}
+
+	return &b, nil
+}
+
+// Archive stores a task's bundle in the configured sink, and returns the archive's name
+func Archive(ctx context.Context, dbp zesty.DBProvider, t *task.Task) (string, error) {
+	if !Enabled() {
+		return "", errors.NotImplementedf("task archival")
+	}
+
+	b, err := NewBundle(dbp, t)
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to archive task %s", t.PublicID)
+	}
+
+	data, err := Encode(b, compressionAlg)
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to archive task %s", t.PublicID)
+	}
+
+	name := Name(t.PublicID, compressionAlg)
+	if err := sink.Store(ctx, name, data); err != nil {
+		return "", errors.Annotatef(err, "failed to archive task %s", t.PublicID)
+	}
+
+	return name, nil
+}
+
+// Import loads an archive from the configured sink, and restores it in DB
+func Import(ctx context.Context, dbp zesty.DBProvider, name string) (*task.Task, error) {
+	if !Enabled() {
+		return nil, errors.NotImplementedf("task archival")
+	}
+
+	idx := strings.LastIndex(name, extension)
+	if idx < 0 {
+		return nil, errors.NotValidf("archive name %q", name)
+	}
+	taskID, alg := name[:idx], name[idx+len(extension):]
+
+	data, err := sink.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := Decode(data, taskID, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return Restore(dbp, b)
+}
+
+// Restore inserts back in DB the task, resolution and comments of a bundle
+// the task must not exist anymore, and its template must still exist
+func Restore(dbp zesty.DBProvider, b *Bundle) (*task.Task, error) {
+	t := b.Task
+
+	tt, err := tasktemplate.LoadFromName(dbp, t.TemplateName)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to restore task %s", t.PublicID)
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+
+	if err := restore(dbp, b, tt); err != nil {
+		dbp.Rollback()
+		return nil, errors.Annotatef(err, "failed to restore task %s", t.PublicID)
+	}
+
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func restore(dbp zesty.DBProvider, b *Bundle, tt *tasktemplate.TaskTemplate) error {
+	t := b.Task
+
+	t.ID = 0
+	t.TemplateID = tt.ID
+	// older archives don't know their template version, and the template might
+	// have been recreated since: the task runs its latest version then
+	if _, err := tasktemplate.LoadVersion(dbp, tt.ID, t.TemplateVersion); errors.IsNotFound(err) {
+		t.TemplateVersion = tt.Version
+	} else if err != nil {
+		return err
+	}
+	// the batch might not exist anymore
+	t.BatchID = nil
+	// encrypted fields are computed on update
+	t.CryptKey = []byte{}
+	t.EncryptedInput = []byte{}
+	t.EncryptedResult = []byte{}
+	if t.Input == nil {
+		t.Input = map[string]interface{}{}
+	}
+
+	if err := dbp.DB().Insert(&t.DBModel); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	if err := t.Update(dbp, true, false); err != nil {
+		return err
+	}
+
+	for _, c := range t.Comments {
+		c.ID = 0
+		c.TaskID = t.ID
+		if err := dbp.DB().Insert(c); err != nil {
+			return pgjuju.Interpret(err)
+		}
+	}
+
+	if r := b.Resolution; r != nil {
+		r.ID = 0
+		r.TaskID = t.ID
+		r.InstanceID = nil
+		r.CryptKey = []byte{}
+		r.EncryptedInput = []byte{}
+		r.EncryptedSteps = []byte{}
+		r.EncryptedSecrets = nil
+		r.StepsCompressionAlg = utask.StepsCompressionAlg
+		// encrypted again with the resolution, to keep redacting them
+		r.Values = values.NewValues()
+		for _, secret := range b.Secrets {
+			r.Values.SecretScope().Register(secret)
+		}
+		if r.BaseConfigurations == nil {
+			r.BaseConfigurations = tt.BaseConfigurations
+		}
+
+		if err := dbp.DB().Insert(&r.DBModel); err != nil {
+			return pgjuju.Interpret(err)
+		}
+		if err := r.Update(dbp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package archive_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ovh/symmecrypt/keyloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/archive"
+	"github.com/cneill/utask/pkg/compress/gzip"
+	compressinit "github.com/cneill/utask/pkg/compress/init"
+	"github.com/cneill/utask/pkg/compress/noop"
+)
+
+func TestMain(m *testing.M) {
+	if err := compressinit.Register(); err != nil {
+		panic(err)
+	}
+	cfg, err := keyloader.GenerateKey("aes-gcm", "storage", false, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	models.EncryptionKey, err = keyloader.NewKey(cfg)
+	if err != nil {
+		panic(err)
+	}
+	m.Run()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	resolutionID := "f2c0d1bb-7a5f-4c73-9a39-1ec3c08f3b5d"
+	b := &archive.Bundle{
+		Version:    archive.FormatVersion,
+		ArchivedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Task: &task.Task{
+			DBModel: task.DBModel{
+				PublicID: "9d4e1e6e-5bb2-4b30-8e1d-1ab4d52a2e39",
+				Title:    "hello",
+				State:    task.StateDone,
+				Tags:     map[string]string{"foo": "bar"},
+			},
+			TemplateName: "hello-world",
+			Input:        map[string]interface{}{"name": "foo", "token": "s3cr3t-t0k3n"},
+			Resolution:   &resolutionID,
+			Comments: []*task.Comment{
+				{PublicID: "5c1f0c6d-3f52-43fb-a1c4-2f7d0d1b0a8e", Username: "admin", Content: "done"},
+			},
+		},
+		Resolution: &resolution.Resolution{
+			DBModel: resolution.DBModel{
+				PublicID: resolutionID,
+				State:    resolution.StateDone,
+			},
+		},
+		Secrets: []string{"s3cr3t-t0k3n"},
+	}
+
+	for _, alg := range []string{gzip.AlgorithmName, noop.AlgorithmName} {
+		data, err := archive.Encode(b, alg)
+		require.NoError(t, err, alg)
+		// the decrypted inputs never reach the sink in clear
+		assert.False(t, bytes.Contains(data, []byte("s3cr3t-t0k3n")), alg)
+		assert.False(t, bytes.Contains(data, []byte("hello-world")), alg)
+
+		decoded, err := archive.Decode(data, b.Task.PublicID, alg)
+		require.NoError(t, err, alg)
+		assert.Equal(t, b.ArchivedAt, decoded.ArchivedAt.UTC())
+		assert.Equal(t, b.Task.PublicID, decoded.Task.PublicID)
+		assert.Equal(t, b.Task.TemplateName, decoded.Task.TemplateName)
+		assert.Equal(t, b.Task.Tags, decoded.Task.Tags)
+		assert.Equal(t, "foo", decoded.Task.Input["name"])
+		require.Len(t, decoded.Task.Comments, 1)
+		assert.Equal(t, "done", decoded.Task.Comments[0].Content)
+		require.NotNil(t, decoded.Resolution)
+		assert.Equal(t, resolutionID, decoded.Resolution.PublicID)
+		assert.Equal(t, b.Secrets, decoded.Secrets)
+
+		// an archive only decrypts as the one of its own task
+		_, err = archive.Decode(data, resolutionID, alg)
+		assert.Error(t, err, alg)
+	}
+
+	// nor without the storage key
+	data, err := archive.Encode(b, gzip.AlgorithmName)
+	require.NoError(t, err)
+	_, err = archive.Decode(append([]byte{}, data[:len(data)-1]...), b.Task.PublicID, gzip.AlgorithmName)
+	assert.Error(t, err)
+	plain, err := gzip.New().Compress([]byte(`{"version":1,"task":{"id":"9d4e1e6e-5bb2-4b30-8e1d-1ab4d52a2e39"}}`))
+	require.NoError(t, err)
+	_, err = archive.Decode(plain, b.Task.PublicID, gzip.AlgorithmName)
+	assert.Error(t, err)
+
+	b.Version = archive.FormatVersion + 1
+	data, err = archive.Encode(b, gzip.AlgorithmName)
+	require.NoError(t, err)
+	_, err = archive.Decode(data, b.Task.PublicID, gzip.AlgorithmName)
+	assert.Error(t, err)
+
+	_, err = archive.Encode(b, "unknown")
+	assert.Error(t, err)
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "foo.json.gzip", archive.Name("foo", gzip.AlgorithmName))
+}
@@ -0,0 +1,89 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// Type represents a local directory as archive backend
+	Type string = "filesystem"
+)
+
+// Sink is an archive.Sink implementation storing archives as files in a directory
+type Sink struct {
+	path string
+}
+
+// NewSink instantiates a Sink, creating its directory if needed
+func NewSink(path string) (*Sink, error) {
+	if path == "" {
+		return nil, errors.NotValidf("empty archive path")
+	}
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	return &Sink{path: path}, nil
+}
+
+// Store writes an archive to a file, replacing any previous archive with the same name
+func (s *Sink) Store(_ context.Context, name string, data []byte) error {
+	filename, err := s.filename(name)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that an archive is never partially written
+	tmp, err := os.CreateTemp(s.path, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Load reads an archive from its file
+func (s *Sink) Load(_ context.Context, name string) ([]byte, error) {
+	filename, err := s.filename(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, errors.NotFoundf("archive %q", name)
+	}
+	return data, err
+}
+
+// Delete removes the file of an archive, deleting a missing archive is not an error
+func (s *Sink) Delete(_ context.Context, name string) error {
+	filename, err := s.filename(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *Sink) filename(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", errors.NotValidf("archive name %q", name)
+	}
+	return filepath.Join(s.path, name), nil
+}
@@ -0,0 +1,44 @@
+package filesystem_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/archive/filesystem"
+)
+
+func TestStoreLoad(t *testing.T) {
+	ctx := context.Background()
+	s, err := filesystem.NewSink(filepath.Join(t.TempDir(), "archives"))
+	require.NoError(t, err)
+
+	_, err = s.Load(ctx, "foo.json.gzip")
+	assert.True(t, errors.IsNotFound(err), "unexpected error: %v", err)
+
+	require.NoError(t, s.Store(ctx, "foo.json.gzip", []byte("hello")))
+	data, err := s.Load(ctx, "foo.json.gzip")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// an archive with the same name is replaced
+	require.NoError(t, s.Store(ctx, "foo.json.gzip", []byte("world")))
+	data, err = s.Load(ctx, "foo.json.gzip")
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	require.NoError(t, s.Delete(ctx, "foo.json.gzip"))
+	_, err = s.Load(ctx, "foo.json.gzip")
+	assert.True(t, errors.IsNotFound(err), "unexpected error: %v", err)
+	// deleting a missing archive is not an error
+	require.NoError(t, s.Delete(ctx, "foo.json.gzip"))
+
+	for _, name := range []string{"", ".", "..", "../foo", "foo/bar"} {
+		assert.Error(t, s.Store(ctx, name, []byte("hello")), name)
+		assert.Error(t, s.Delete(ctx, name), name)
+	}
+}
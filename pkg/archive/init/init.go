@@ -0,0 +1,64 @@
+package init
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/pkg/archive"
+	"github.com/cneill/utask/pkg/archive/filesystem"
+	"github.com/cneill/utask/pkg/archive/s3"
+	"github.com/cneill/utask/pkg/compress/gzip"
+)
+
+const (
+	errRetrieveCfg string = "failed to retrieve archive cfg"
+)
+
+// Init registers the archive sink defined in configuration, if any
+func Init(store *configstore.Store) error {
+	cfg, err := utask.Config(store)
+	if err != nil {
+		return err
+	}
+
+	acfg := cfg.Archive
+	if acfg == nil {
+		return nil
+	}
+
+	var sink archive.Sink
+	switch acfg.Type {
+	case filesystem.Type:
+		f := utask.ArchiveBackendFilesystem{}
+		if err := json.Unmarshal(acfg.Config, &f); err != nil {
+			return fmt.Errorf("%s: %s: %s", errRetrieveCfg, acfg.Type, err)
+		}
+		sink, err = filesystem.NewSink(f.Path)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate filesystem archive sink: %s", err)
+		}
+
+	case s3.Type:
+		f := utask.ArchiveBackendS3{}
+		if err := json.Unmarshal(acfg.Config, &f); err != nil {
+			return fmt.Errorf("%s: %s: %s", errRetrieveCfg, acfg.Type, err)
+		}
+		sink, err = s3.NewSink(f.Endpoint, f.Region, f.Bucket, f.Prefix, f.AccessKey, f.SecretKey)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate s3 archive sink: %s", err)
+		}
+
+	default:
+		return fmt.Errorf("unknown archive type %q", acfg.Type)
+	}
+
+	compression := acfg.Compression
+	if compression == "" {
+		compression = gzip.AlgorithmName
+	}
+
+	return archive.RegisterSink(sink, compression, acfg.OnExpiration)
+}
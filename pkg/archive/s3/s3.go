@@ -0,0 +1,189 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// Type represents an S3 compatible object storage as archive backend
+	Type string = "s3"
+
+	service   = "s3"
+	algorithm = "AWS4-HMAC-SHA256"
+	amzFormat = "20060102T150405Z"
+	dayFormat = "20060102"
+)
+
+// Sink is an archive.Sink implementation storing archives as objects in an S3 bucket
+// requests are signed with AWS signature version 4, and use path-style addressing
+// so that any S3 compatible object storage can be used
+type Sink struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	prefix     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewSink instantiates a Sink
+// endpoint defaults to AWS S3 in the given region
+func NewSink(endpoint, region, bucket, prefix, accessKey, secretKey string) (*Sink, error) {
+	if region == "" || bucket == "" {
+		return nil, errors.NotValidf("s3 archive configuration: region and bucket are mandatory")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.NotValidf("s3 archive configuration: credentials are mandatory")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.NewNotValid(err, "s3 archive endpoint")
+	}
+
+	return &Sink{
+		endpoint:   u,
+		region:     region,
+		bucket:     bucket,
+		prefix:     prefix,
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: time.Minute},
+		now:        time.Now,
+	}, nil
+}
+
+// Store uploads an archive as an object
+func (s *Sink) Store(ctx context.Context, name string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res, name)
+}
+
+// Load downloads an archive
+func (s *Sink) Load(ctx context.Context, name string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, name); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// Delete removes an archive, deleting a missing archive is not an error
+func (s *Sink) Delete(ctx context.Context, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func checkResponse(res *http.Response, name string) error {
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return errors.NotFoundf("archive %q", name)
+	case res.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.Errorf("s3 archive %q: unexpected status %d: %s", name, res.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *Sink) do(ctx context.Context, method, name string, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + s.prefix + name
+	u.RawPath = ""
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body)
+
+	return s.httpClient.Do(req)
+}
+
+// sign adds an AWS signature version 4 to a request
+// see https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *Sink) sign(req *http.Request, body []byte) {
+	t := s.now().UTC()
+	amzDate := t.Format(amzFormat)
+	day := t.Format(dayFormat)
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{day, s.region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -12,14 +12,29 @@ import (
 )
 
 // TaskArgs holds arguments needed to create tasks in a batch
+// watchers, resolvers and tags apply to every task, unless overridden for a task
 type TaskArgs struct {
-	TemplateName     string                   // Mandatory
-	Inputs           []map[string]interface{} // Mandatory
-	CommonInput      map[string]interface{}   // Optional
-	Comment          string                   // Optional
-	WatcherUsernames []string                 // Optional
-	WatcherGroups    []string                 // Optional
-	Tags             map[string]string        // Optional
+	TemplateName      string                   // Mandatory
+	Inputs            []map[string]interface{} // Mandatory
+	CommonInput       map[string]interface{}   // Optional
+	Comment           string                   // Optional
+	WatcherUsernames  []string                 // Optional
+	WatcherGroups     []string                 // Optional
+	ResolverUsernames []string                 // Optional
+	ResolverGroups    []string                 // Optional
+	Tags              map[string]string        // Optional
+	Priority          *int                     // Optional
+	Overrides         []*TaskOverride          // Optional, the override of each input, by index
+}
+
+// TaskOverride holds the settings of a single task of a batch
+// a list given here replaces the batch's one, while tags are merged into the batch's ones
+type TaskOverride struct {
+	WatcherUsernames  []string
+	WatcherGroups     []string
+	ResolverUsernames []string
+	ResolverGroups    []string
+	Tags              map[string]string
 }
 
 // Populate creates and adds new tasks to a given batch.
@@ -32,27 +47,34 @@ func Populate(ctx context.Context, batch *task.Batch, dbp zesty.DBProvider, args
 		return nil, err
 	}
 
+	if len(args.Overrides) > 0 && len(args.Overrides) != len(args.Inputs) {
+		return nil, errors.BadRequestf("Expected %d task overrides, one per input, got %d", len(args.Inputs), len(args.Overrides))
+	}
+
 	taskIDs := make([]string, 0, len(args.Inputs))
-	for _, inp := range args.Inputs {
+	for i, inp := range args.Inputs {
 		input, err := mergeMaps(args.CommonInput, inp)
 		if err != nil {
 			return nil, err
 		}
 
-		t, err := taskutils.CreateTask(
-			ctx,
-			dbp,
-			tt,
-			args.WatcherUsernames,
-			args.WatcherGroups,
-			[]string{},
-			[]string{},
-			input,
-			batch,
-			args.Comment,
-			nil,
-			args.Tags,
-		)
+		var override *TaskOverride
+		if len(args.Overrides) > 0 {
+			override = args.Overrides[i]
+		}
+		settings := args.taskSettings(override)
+
+		t, err := taskutils.CreateTask(ctx, dbp, tt, taskutils.CreateTaskOptions{
+			WatcherUsernames:  settings.WatcherUsernames,
+			WatcherGroups:     settings.WatcherGroups,
+			ResolverUsernames: settings.ResolverUsernames,
+			ResolverGroups:    settings.ResolverGroups,
+			Input:             input,
+			Batch:             batch,
+			Comment:           args.Comment,
+			Tags:              settings.Tags,
+			Priority:          args.Priority,
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -61,6 +83,50 @@ func Populate(ctx context.Context, batch *task.Batch, dbp zesty.DBProvider, args
 	return taskIDs, nil
 }
 
+// taskSettings applies the override of a task to the batch-level settings
+func (args TaskArgs) taskSettings(override *TaskOverride) TaskOverride {
+	settings := TaskOverride{
+		WatcherUsernames:  args.WatcherUsernames,
+		WatcherGroups:     args.WatcherGroups,
+		ResolverUsernames: args.ResolverUsernames,
+		ResolverGroups:    args.ResolverGroups,
+		Tags:              args.Tags,
+	}
+	if settings.ResolverUsernames == nil {
+		settings.ResolverUsernames = []string{}
+	}
+	if settings.ResolverGroups == nil {
+		settings.ResolverGroups = []string{}
+	}
+	if override == nil {
+		return settings
+	}
+
+	if override.WatcherUsernames != nil {
+		settings.WatcherUsernames = override.WatcherUsernames
+	}
+	if override.WatcherGroups != nil {
+		settings.WatcherGroups = override.WatcherGroups
+	}
+	if override.ResolverUsernames != nil {
+		settings.ResolverUsernames = override.ResolverUsernames
+	}
+	if override.ResolverGroups != nil {
+		settings.ResolverGroups = override.ResolverGroups
+	}
+	if override.Tags != nil {
+		tags := make(map[string]string, len(args.Tags)+len(override.Tags))
+		for k, v := range args.Tags {
+			tags[k] = v
+		}
+		for k, v := range override.Tags {
+			tags[k] = v
+		}
+		settings.Tags = tags
+	}
+	return settings
+}
+
 func mergeMaps(common, particular map[string]interface{}) (map[string]interface{}, error) {
 	merged := make(map[string]interface{}, len(common)+len(particular))
 	for key, value := range particular {
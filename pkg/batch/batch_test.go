@@ -75,6 +75,33 @@ func TestPopulate(t *testing.T) {
 
 }
 
+func Test_taskSettings(t *testing.T) {
+	args := TaskArgs{
+		WatcherUsernames: []string{"foo"},
+		ResolverGroups:   []string{"ops"},
+		Tags:             map[string]string{"team": "ops", "env": "prod"},
+	}
+
+	settings := args.taskSettings(nil)
+	assert.Equal(t, []string{"foo"}, settings.WatcherUsernames)
+	assert.Equal(t, []string{}, settings.ResolverUsernames)
+	assert.Equal(t, []string{"ops"}, settings.ResolverGroups)
+	assert.Equal(t, args.Tags, settings.Tags)
+
+	settings = args.taskSettings(&TaskOverride{
+		WatcherUsernames:  []string{},
+		ResolverUsernames: []string{"bar"},
+		Tags:              map[string]string{"env": "dev", "customer": "baz"},
+	})
+	assert.Equal(t, []string{}, settings.WatcherUsernames)
+	assert.Equal(t, []string{"bar"}, settings.ResolverUsernames)
+	assert.Equal(t, []string{"ops"}, settings.ResolverGroups)
+	assert.Equal(t, map[string]string{"team": "ops", "env": "dev", "customer": "baz"}, settings.Tags)
+
+	// the batch-level tags are left untouched
+	assert.Equal(t, map[string]string{"team": "ops", "env": "prod"}, args.Tags)
+}
+
 var dummyTemplate = tasktemplate.TaskTemplate{
 	Name:        "dummy-template",
 	Description: "does nothing",
@@ -26,3 +26,30 @@ func RunningTasks(dbp zesty.DBProvider, batchID int64) (int64, error) {
 
 	return dbp.DB().SelectInt(query, params...)
 }
+
+// TasksByState returns the amount of tasks sharing the same given batchId, for each state.
+func TasksByState(dbp zesty.DBProvider, batchID int64) (map[string]int64, error) {
+	query, params, err := sqlgenerator.PGsql.
+		Select("t.state, count (*)").
+		From("task t").
+		Where(squirrel.Eq{"t.id_batch": batchID}).
+		GroupBy("t.state").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		State string `db:"state"`
+		Count int64  `db:"count"`
+	}
+	if _, err := dbp.DB().Select(&rows, query, params...); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		states[r.State] = r.Count
+	}
+	return states, nil
+}
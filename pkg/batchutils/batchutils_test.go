@@ -60,6 +60,33 @@ func TestRunningTasks(t *testing.T) {
 	assert.Equal(t, expectedRunning, running)
 }
 
+func TestTasksByState(t *testing.T) {
+	store := configstore.DefaultStore
+	store.InitFromEnvironment()
+
+	if err := db.Init(store); err != nil {
+		panic(err)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batchID, tasks := createBatch(t, 3, dbp)
+
+	tasks[0].SetState(task.StateWontfix)
+	if err := tasks[0].Update(dbp, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := batchutils.TasksByState(dbp, batchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]int64{task.StateTODO: 2, task.StateWontfix: 1}, states)
+}
+
 func createBatch(t *testing.T, amount int, dbp zesty.DBProvider) (int64, []*task.Task) {
 	tmpl, err := tasktemplate.LoadFromName(dbp, dummyTemplate.Name)
 	if err != nil {
@@ -80,20 +107,10 @@ func createBatch(t *testing.T, amount int, dbp zesty.DBProvider) (int64, []*task
 	tasks := make([]*task.Task, 0, amount)
 	for i := 0; i < amount; i++ {
 		// Manually populating the batch to prevent cyclic imports
-		newTask, err := task.Create(
-			dbp,
-			tmpl,
-			"",
-			nil,
-			nil,
-			nil,
-			nil,
-			nil,
-			map[string]any{"id": fmt.Sprintf("dummyID-%d", i)},
-			nil,
-			b,
-			false,
-		)
+		newTask, err := task.Create(dbp, tmpl, "", task.CreateOptions{
+			Input: map[string]any{"id": fmt.Sprintf("dummyID-%d", i)},
+			Batch: b,
+		})
 		if err != nil {
 			t.Fatal(err)
 		}
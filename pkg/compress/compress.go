@@ -2,6 +2,7 @@ package compress
 
 import (
 	"fmt"
+	"io"
 	"sync"
 )
 
@@ -15,6 +16,20 @@ type Compression interface {
 	Decompress([]byte) ([]byte, error)
 }
 
+// StreamCompression is implemented by the algorithms able to compress a stream of data
+// as it is written, such as the responses of the API
+type StreamCompression interface {
+	Compression
+	NewWriter(io.Writer) StreamWriter
+}
+
+// StreamWriter compresses the data written to it, until it is closed
+// Flush writes the data compressed so far, for it to be received before the stream is over
+type StreamWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
 // RegisterAlgorithm registers a custom compression algorithm.
 func RegisterAlgorithm(name string, c Compression) error {
 	if c == nil {
@@ -32,6 +32,11 @@ func (c *gzipCompression) Compress(data []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// NewWriter returns a writer compressing the data written to it, until it is closed.
+func (c *gzipCompression) NewWriter(w io.Writer) compress.StreamWriter {
+	return gzip.NewWriter(w)
+}
+
 // Decompress transforms compressed form into an uncompressed form.
 func (c *gzipCompression) Decompress(data []byte) ([]byte, error) {
 	zr, err := gzip.NewReader(bytes.NewReader(data))
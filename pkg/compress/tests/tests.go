@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,4 +31,24 @@ func CompressionTests(t *testing.T, c compress.Compression) {
 			assert.Equal(t, tt.want, string(got))
 		})
 	}
+
+	// the algorithms compressing streams produce the same format, flushed or not
+	sc, ok := c.(compress.StreamCompression)
+	if !ok {
+		return
+	}
+	t.Run("Stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := sc.NewWriter(&buf)
+		_, err := w.Write([]byte("Hello "))
+		require.NoError(t, err)
+		require.NoError(t, w.Flush())
+		_, err = w.Write([]byte("world!"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		got, err := c.Decompress(buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "Hello world!", string(got))
+	})
 }
@@ -5,4 +5,8 @@ const (
 	// if a completed task has a parent task, and that parent task should be
 	// resumed.
 	SubtaskTagParentTaskID = "_utask_parent_task_id"
+
+	// TagIdempotencyKey is the tag key holding the idempotency key of the step
+	// which created a task through the utask plugin, to create it only once
+	TagIdempotencyKey = "_utask_idempotency_key"
 )
@@ -0,0 +1,46 @@
+package correlation
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Header is the http header carrying the correlation ID of an API request,
+	// reused when already set by the client or a reverse proxy
+	Header = "X-Request-Id"
+	// LogField is the log field holding the correlation ID
+	LogField = "correlation_id"
+)
+
+type contextKey struct{}
+
+// NewID generates a new correlation ID
+func NewID() string {
+	return uuid.Must(uuid.NewV4()).String()
+}
+
+// NewContext returns a copy of ctx holding the given correlation ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the correlation ID held by ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns a logger entry carrying the correlation ID held by ctx, if any
+func Logger(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := FromContext(ctx); id != "" {
+		entry = entry.WithField(LogField, id)
+	}
+	return entry
+}
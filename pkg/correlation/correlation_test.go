@@ -0,0 +1,20 @@
+package correlation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, "", FromContext(context.Background()))
+	assert.NotContains(t, Logger(context.Background()).Data, LogField)
+
+	id := NewID()
+	assert.NotEqual(t, id, NewID())
+
+	ctx := NewContext(context.Background(), id)
+	assert.Equal(t, id, FromContext(ctx))
+	assert.Equal(t, id, Logger(ctx).Data[LogField])
+}
@@ -3,6 +3,8 @@ package jsonschema
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/juju/errors"
 	"github.com/santhosh-tekuri/jsonschema"
@@ -30,6 +32,47 @@ func Validator(url string, rawSchema json.RawMessage) ValidateFunc {
 	return schema.ValidateInterface
 }
 
+// Validate asserts that a value matches a json Schema definition,
+// the value being checked under its json representation
+func Validate(url string, rawSchema json.RawMessage, value interface{}) error {
+	schema, err := compile(url, computeVersion(rawSchema))
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+
+	b, err := utils.JSONMarshal(value)
+	if err != nil {
+		return err
+	}
+	return schema.Validate(bytes.NewReader(b))
+}
+
+// ValidationDetails flattens a json schema validation error
+// into one message per invalid field of the document
+func ValidationDetails(err error) []string {
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	if len(ve.Causes) == 0 {
+		ptr := strings.TrimPrefix(ve.InstancePtr, "#")
+		if ptr == "" {
+			ptr = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", ptr, ve.Message)}
+	}
+
+	details := make([]string, 0, len(ve.Causes))
+	for _, cause := range ve.Causes {
+		details = append(details, ValidationDetails(cause)...)
+	}
+	return details
+}
+
 // NormalizeAndCompile normalizes the version and then compile the json schema.
 func NormalizeAndCompile(url string, s json.RawMessage) (json.RawMessage, error) {
 	s = computeVersion(s)
@@ -0,0 +1,51 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = json.RawMessage(`{
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["success"],
+	"properties": {
+		"success": {"type": "boolean"},
+		"count": {"type": "integer"}
+	}
+}`)
+
+func TestValidationDetails(t *testing.T) {
+	schema, err := NormalizeAndCompile("test", testSchema)
+	assert.NoError(t, err)
+	validate := Validator("test", schema)
+
+	assert.NoError(t, validate(map[string]interface{}{"success": true}))
+
+	err = validate(map[string]interface{}{"success": true, "count": "1"})
+	if assert.Error(t, err) {
+		assert.Equal(t, []string{"/count: expected integer, but got string"}, ValidationDetails(err))
+	}
+
+	err = validate(map[string]interface{}{})
+	if assert.Error(t, err) {
+		assert.Equal(t, []string{`/: missing properties: "success"`}, ValidationDetails(err))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("test", nil, map[string]interface{}{"anything": "goes"}))
+
+	// go values are checked under their json representation
+	assert.NoError(t, Validate("test", testSchema, map[string]interface{}{"success": true, "count": 3}))
+	assert.NoError(t, Validate("test", testSchema, map[string]interface{}{"success": true, "count": json.Number("3")}))
+
+	err := Validate("test", testSchema, map[string]interface{}{"success": "yes"})
+	if assert.Error(t, err) {
+		assert.Equal(t, []string{"/success: expected boolean, but got string"}, ValidationDetails(err))
+	}
+
+	assert.Error(t, Validate("test", json.RawMessage(`{"type": 3}`), map[string]interface{}{}))
+}
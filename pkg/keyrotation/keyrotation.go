@@ -0,0 +1,335 @@
+package keyrotation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db"
+	"github.com/cneill/utask/db/pgjuju"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/runnerinstance"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/now"
+)
+
+// possible states of a key rotation
+const (
+	StateIdle    = "IDLE"
+	StateRunning = "RUNNING"
+	StateDone    = "DONE"
+	StateFailed  = "FAILED"
+)
+
+// phases of a key rotation, run in this order
+const (
+	PhaseCallbacks   = "callbacks"
+	PhaseTasks       = "tasks"
+	PhaseResolutions = "resolutions"
+)
+
+var (
+	// BatchSize is the count of rows re-encrypted and committed at once,
+	// along with the progress of the rotation
+	BatchSize uint64 = 100
+	// HeartbeatInterval is the duration between two updates of a running rotation
+	HeartbeatInterval = time.Minute
+	// StaleAfter is the duration after which a running rotation which wasn't updated
+	// is considered interrupted, and can be resumed
+	StaleAfter = 5 * time.Minute
+)
+
+var nextPhase = map[string]string{
+	PhaseCallbacks:   PhaseTasks,
+	PhaseTasks:       PhaseResolutions,
+	PhaseResolutions: "",
+}
+
+// Rotation holds the progress of the re-encryption of the DB data
+// with the latest storage key. A single rotation exists, stored in DB
+// and shared by all the instances of µTask
+type Rotation struct {
+	mu sync.Mutex `db:"-" json:"-"` // guards the progress, updated by the running rotation
+
+	State      string     `db:"state" json:"state"`
+	Phase      string     `db:"phase" json:"phase,omitempty"`
+	LastID     int64      `db:"last_id" json:"-"`
+	Processed  int64      `db:"processed" json:"processed"`
+	Remaining  int64      `db:"-" json:"remaining"`
+	InstanceID *uint64    `db:"instance_id" json:"instance_id,omitempty"`
+	StartedAt  *time.Time `db:"started_at" json:"started_at,omitempty"`
+	UpdatedAt  *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+	FinishedAt *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+	Error      *string    `db:"error" json:"error,omitempty"`
+}
+
+const rotationColumns = `state, phase, last_id, processed, instance_id, started_at, updated_at, finished_at, error`
+
+// Start launches the rotation in the background, resuming the previous one
+// if it was interrupted or failed. Only one rotation can run at once,
+// across all the instances of µTask
+func Start(dbp zesty.DBProvider) (r *Rotation, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to start key rotation")
+
+	t := now.Get()
+	// the rotation row is claimed by a single instance: a rotation still running
+	// can only be taken over once its instance stopped updating it
+	sqlStmt := `UPDATE "key_rotation" SET
+			state = $1,
+			instance_id = $2,
+			updated_at = $3,
+			finished_at = NULL,
+			error = NULL,
+			started_at = CASE WHEN state IN ($4, $5) THEN $3 ELSE started_at END,
+			phase = CASE WHEN state IN ($4, $5) THEN $6 ELSE phase END,
+			last_id = CASE WHEN state IN ($4, $5) THEN 0 ELSE last_id END,
+			processed = CASE WHEN state IN ($4, $5) THEN 0 ELSE processed END
+		WHERE id = 1
+		AND (
+			state <> $1
+			OR updated_at < $7
+			OR NOT EXISTS (SELECT 1 FROM "runner_instance" WHERE "runner_instance".id = "key_rotation".instance_id AND "runner_instance".heartbeat > $8)
+		)
+		RETURNING ` + rotationColumns
+
+	var rotations []*Rotation
+	if _, err := dbp.DB().Select(&rotations, sqlStmt,
+		StateRunning,
+		utask.InstanceID,
+		t,
+		StateIdle,
+		StateDone,
+		PhaseCallbacks,
+		t.Add(-StaleAfter),
+		t.Add(-2*runnerinstance.HeartbeatInterval),
+	); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+	if len(rotations) == 0 {
+		return nil, errors.NewAlreadyExists(nil, "a key rotation is already running")
+	}
+	running := rotations[0]
+
+	runDBP, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, err
+	}
+	// the caller gets the rotation as it was claimed, the running one being updated in the background
+	r = running.snapshot()
+	go running.run(runDBP)
+
+	if err := r.computeRemaining(dbp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// snapshot returns a copy of the rotation, safe to read while the rotation runs
+func (r *Rotation) snapshot() *Rotation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Rotation{
+		State:      r.State,
+		Phase:      r.Phase,
+		LastID:     r.LastID,
+		Processed:  r.Processed,
+		Remaining:  r.Remaining,
+		InstanceID: r.InstanceID,
+		StartedAt:  r.StartedAt,
+		UpdatedAt:  r.UpdatedAt,
+		FinishedAt: r.FinishedAt,
+		Error:      r.Error,
+	}
+}
+
+// setProgress records the progress of the running rotation, once committed
+func (r *Rotation) setProgress(phase string, lastID, processed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Phase, r.LastID = phase, lastID
+	r.Processed += processed
+}
+
+// Load returns the current rotation, along with the count of rows remaining to re-encrypt
+func Load(dbp zesty.DBProvider) (r *Rotation, err error) {
+	defer errors.DeferredAnnotatef(&err, "Failed to load key rotation")
+
+	r = &Rotation{}
+	if err := dbp.DB().SelectOne(r, `SELECT `+rotationColumns+` FROM "key_rotation" WHERE id = 1`); err != nil {
+		return nil, pgjuju.Interpret(err)
+	}
+	if err := r.computeRemaining(dbp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// computeRemaining counts the tasks and resolutions still to re-encrypt,
+// the callbacks phase being re-run as a whole when resumed
+func (r *Rotation) computeRemaining(dbp zesty.DBProvider) error {
+	r.Remaining = 0
+	if r.State != StateRunning && r.State != StateFailed {
+		return nil
+	}
+
+	var tasksAfter, resolutionsAfter int64
+	switch r.Phase {
+	case PhaseTasks:
+		tasksAfter = r.LastID
+	case PhaseResolutions:
+		tasksAfter = -1
+		resolutionsAfter = r.LastID
+	}
+	if tasksAfter >= 0 {
+		count, err := task.CountTasksAfter(dbp, tasksAfter)
+		if err != nil {
+			return err
+		}
+		r.Remaining += count
+	}
+	count, err := resolution.CountResolutionsAfter(dbp, resolutionsAfter)
+	if err != nil {
+		return err
+	}
+	r.Remaining += count
+	return nil
+}
+
+func (r *Rotation) run(dbp zesty.DBProvider) {
+	logger := logrus.WithFields(logrus.Fields{"log_type": "key_rotation", "instance_id": utask.InstanceID})
+	logger.Infof("key rotation: running from phase %q", r.Phase)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go r.heartbeat(stop)
+
+	if err := r.resume(dbp); err != nil {
+		logger.WithError(err).Error("key rotation: failed")
+		if err := r.fail(dbp, err); err != nil {
+			logger.WithError(err).Error("key rotation: failed to record the failure")
+		}
+		return
+	}
+	logger.Infof("key rotation: done, %d rows re-encrypted", r.Processed)
+}
+
+// resume runs the remaining phases of the rotation, committing its progress
+// along with each batch of re-encrypted rows
+func (r *Rotation) resume(dbp zesty.DBProvider) error {
+	for r.Phase != "" {
+		switch r.Phase {
+		case PhaseCallbacks:
+			if err := db.CallKeyRotations(dbp); err != nil {
+				return err
+			}
+			if err := r.commitProgress(dbp, nextPhase[r.Phase], 0, 0); err != nil {
+				return err
+			}
+			r.setProgress(nextPhase[r.Phase], 0, 0)
+		case PhaseTasks:
+			if err := r.rotateBatches(dbp, task.RotateTasksBatch); err != nil {
+				return err
+			}
+		case PhaseResolutions:
+			if err := r.rotateBatches(dbp, resolution.RotateResolutionsBatch); err != nil {
+				return err
+			}
+		default:
+			return errors.NotValidf("key rotation phase %q", r.Phase)
+		}
+	}
+	return r.finish(dbp)
+}
+
+func (r *Rotation) rotateBatches(dbp zesty.DBProvider, rotateBatch func(zesty.DBProvider, int64, uint64) (int64, int, error)) error {
+	for {
+		sp, err := dbp.TxSavepoint()
+		if err != nil {
+			return err
+		}
+		lastID, count, err := rotateBatch(dbp, r.LastID, BatchSize)
+		if err != nil {
+			dbp.RollbackTo(sp)
+			return err
+		}
+
+		phase := r.Phase
+		if count == 0 {
+			phase, lastID = nextPhase[r.Phase], 0
+		}
+		if err := r.commitProgress(dbp, phase, lastID, int64(count)); err != nil {
+			dbp.RollbackTo(sp)
+			return err
+		}
+		if err := dbp.Commit(); err != nil {
+			return err
+		}
+		if phase != r.Phase {
+			r.setProgress(phase, 0, 0)
+			return nil
+		}
+		r.setProgress(phase, lastID, int64(count))
+	}
+}
+
+// commitProgress records the progress of the rotation, failing if another
+// instance took it over
+func (r *Rotation) commitProgress(dbp zesty.DBProvider, phase string, lastID, processed int64) error {
+	res, err := dbp.DB().Exec(`UPDATE "key_rotation"
+		SET phase = $1, last_id = $2, processed = processed + $3, updated_at = $4
+		WHERE id = 1 AND state = $5 AND instance_id = $6`,
+		phase, lastID, processed, now.Get(), StateRunning, utask.InstanceID)
+	if err != nil {
+		return pgjuju.Interpret(err)
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows == 0 {
+		return errors.New("key rotation taken over by another instance")
+	}
+	return nil
+}
+
+func (r *Rotation) finish(dbp zesty.DBProvider) error {
+	t := now.Get()
+	if _, err := dbp.DB().Exec(`UPDATE "key_rotation"
+		SET state = $1, phase = '', last_id = 0, updated_at = $2, finished_at = $2
+		WHERE id = 1 AND state = $3 AND instance_id = $4`,
+		StateDone, t, StateRunning, utask.InstanceID); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	return nil
+}
+
+func (r *Rotation) fail(dbp zesty.DBProvider, cause error) error {
+	msg := cause.Error()
+	if _, err := dbp.DB().Exec(`UPDATE "key_rotation"
+		SET state = $1, error = $2, updated_at = $3
+		WHERE id = 1 AND state = $4 AND instance_id = $5`,
+		StateFailed, msg, now.Get(), StateRunning, utask.InstanceID); err != nil {
+		return pgjuju.Interpret(err)
+	}
+	return nil
+}
+
+// heartbeat keeps the rotation from being considered interrupted
+// while a long phase runs
+func (r *Rotation) heartbeat(stop <-chan struct{}) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return
+	}
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, _ = dbp.DB().Exec(`UPDATE "key_rotation" SET updated_at = $1 WHERE id = 1 AND state = $2 AND instance_id = $3`,
+				now.Get(), StateRunning, utask.InstanceID)
+		}
+	}
+}
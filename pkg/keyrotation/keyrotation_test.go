@@ -0,0 +1,161 @@
+package keyrotation_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/ovh/configstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db"
+	"github.com/cneill/utask/models/runnerinstance"
+	"github.com/cneill/utask/pkg/keyrotation"
+	"github.com/cneill/utask/pkg/now"
+)
+
+func TestMain(m *testing.M) {
+	store := configstore.DefaultStore
+	store.InitFromEnvironment()
+
+	if err := db.Init(store); err != nil {
+		panic(err)
+	}
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		panic(err)
+	}
+	// the rotation is claimed by a live instance, as it is when µTask runs
+	utask.InstanceID, err = runnerinstance.Create(dbp)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// setRotation overwrites the rotation stored in DB
+func setRotation(t *testing.T, dbp zesty.DBProvider, state, phase string, processed int64, instanceID *uint64, startedAt time.Time) {
+	t.Helper()
+	_, err := dbp.DB().Exec(`INSERT INTO "key_rotation" (id, state, phase, last_id, processed, instance_id, started_at, updated_at)
+		VALUES (1, $1, $2, 0, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET state = $1, phase = $2, last_id = 0, processed = $3, instance_id = $4,
+			started_at = $5, updated_at = $6, finished_at = NULL, error = NULL`,
+		state, phase, processed, instanceID, startedAt, now.Get())
+	require.NoError(t, err)
+}
+
+// waitRotation waits for the running rotation to be over
+func waitRotation(t *testing.T, dbp zesty.DBProvider) *keyrotation.Rotation {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		r, err := keyrotation.Load(dbp)
+		require.NoError(t, err)
+		if r.State != keyrotation.StateRunning {
+			return r
+		}
+		select {
+		case <-timeout:
+			t.Fatal("key rotation still running")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestStartResume(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	// a rotation interrupted during the tasks phase, its instance being gone
+	startedAt := now.Get().Add(-time.Hour).Truncate(time.Second)
+	deadInstance := uint64(0)
+	setRotation(t, dbp, keyrotation.StateRunning, keyrotation.PhaseTasks, 42, &deadInstance, startedAt)
+
+	r, err := keyrotation.Start(dbp)
+	require.NoError(t, err)
+	assert.Equal(t, keyrotation.StateRunning, r.State)
+	assert.Equal(t, keyrotation.PhaseTasks, r.Phase)
+	assert.Equal(t, int64(42), r.Processed)
+	require.NotNil(t, r.InstanceID)
+	assert.Equal(t, utask.InstanceID, *r.InstanceID)
+	require.NotNil(t, r.StartedAt)
+	assert.True(t, startedAt.Equal(*r.StartedAt), "the resumed rotation keeps its start date")
+
+	r = waitRotation(t, dbp)
+	assert.Equal(t, keyrotation.StateDone, r.State)
+	assert.Nil(t, r.Error)
+	assert.GreaterOrEqual(t, r.Processed, int64(42))
+	assert.NotNil(t, r.FinishedAt)
+
+	// a finished rotation starts over from the first phase
+	r, err = keyrotation.Start(dbp)
+	require.NoError(t, err)
+	assert.Equal(t, keyrotation.PhaseCallbacks, r.Phase)
+	assert.Equal(t, int64(0), r.Processed)
+	waitRotation(t, dbp)
+}
+
+func TestStartLocking(t *testing.T) {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	// a rotation still run by a live instance can't be taken over
+	liveInstance, err := runnerinstance.Create(dbp)
+	require.NoError(t, err)
+	setRotation(t, dbp, keyrotation.StateRunning, keyrotation.PhaseTasks, 0, &liveInstance, now.Get())
+
+	_, err = keyrotation.Start(dbp)
+	assert.True(t, errors.IsAlreadyExists(err), "unexpected error: %v", err)
+
+	// among concurrent starts, a single one claims the rotation
+	setRotation(t, dbp, keyrotation.StateIdle, "", 0, nil, now.Get())
+
+	// the starts wait for the rotation to be released all together,
+	// so that none of them comes after the rotation is over
+	lockDBP, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+	require.NoError(t, lockDBP.Tx())
+	_, err = lockDBP.DB().Exec(`SELECT id FROM "key_rotation" WHERE id = 1 FOR UPDATE`)
+	require.NoError(t, err)
+
+	const starts = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, starts)
+	for i := 0; i < starts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbp, err := zesty.NewDBProvider(utask.DBName)
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = keyrotation.Start(dbp)
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, lockDBP.Commit())
+	wg.Wait()
+	close(errs)
+
+	started := 0
+	for err := range errs {
+		if err == nil {
+			started++
+			continue
+		}
+		assert.True(t, errors.IsAlreadyExists(err), "unexpected error: %v", err)
+	}
+	assert.Equal(t, 1, started)
+
+	r := waitRotation(t, dbp)
+	assert.Equal(t, keyrotation.StateDone, r.State)
+}
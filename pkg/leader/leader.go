@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The instances of µTask sharing a database can elect a leader among them,
+// the only one running the singleton background jobs (garbage collection, reminders, metrics...)
+// the leader holds a postgres advisory lock on a dedicated connection: when it dies,
+// its connection is closed, releasing the lock to the next instance campaigning for it
+// the leader's connection is taken out of the pool for as long as it leads:
+// it counts against max_open_conns, leaving one connection less to the rest of the instance
+
+const (
+	// lockKey identifies the advisory lock of the leadership, the same for all the instances
+	lockKey int64 = 0x757461736b
+
+	// CampaignInterval is the duration between two attempts of an instance to become the leader,
+	// and between two checks of the leader's connection
+	CampaignInterval = 10 * time.Second
+)
+
+var (
+	enabled atomic.Bool
+	leading atomic.Bool
+)
+
+// IsLeader tells if this instance should run the singleton jobs:
+// always true when the leader election is disabled, every instance running them
+func IsLeader() bool {
+	return !enabled.Load() || leading.Load()
+}
+
+// Start enables the leader election: this instance campaigns for the leadership
+// until ctx is done, getting a dedicated connection to the database from conn
+// the first campaign is over when Start returns
+func Start(ctx context.Context, conn func(context.Context) (*sql.Conn, error)) {
+	enabled.Store(true)
+
+	c := campaign(ctx, conn, nil)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				resign(c)
+				return
+			case <-time.After(CampaignInterval):
+				c = campaign(ctx, conn, c)
+			}
+		}
+	}()
+}
+
+// campaign checks that the connection holding the leadership is still alive,
+// or tries to acquire the leadership when not holding it,
+// returning the connection holding the leadership, nil if this instance is not the leader
+func campaign(ctx context.Context, conn func(context.Context) (*sql.Conn, error), c *sql.Conn) *sql.Conn {
+	log := logrus.WithField("component", "leader_election")
+
+	if c != nil {
+		err := c.PingContext(ctx)
+		if err == nil {
+			return c
+		}
+		log.WithError(err).Warn("lost the leadership")
+		leading.Store(false)
+		_ = c.Close()
+	}
+
+	c, err := conn(ctx)
+	if err != nil {
+		log.WithError(err).Warn("failed to campaign for the leadership")
+		return nil
+	}
+
+	var acquired bool
+	if err := c.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&acquired); err != nil || !acquired {
+		if err != nil {
+			log.WithError(err).Warn("failed to campaign for the leadership")
+		}
+		_ = c.Close()
+		return nil
+	}
+
+	log.Info("elected leader, running the singleton jobs")
+	leading.Store(true)
+	return c
+}
+
+// resign releases the leadership, for another instance to take it over
+func resign(c *sql.Conn) {
+	leading.Store(false)
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = c.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey)
+	_ = c.Close()
+}
@@ -0,0 +1,182 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB is a database granting its advisory lock at will,
+// counting the connections opened to it and the ones still open
+type fakeDB struct {
+	sync.Mutex
+	grant   bool
+	pingErr error
+	opened  int
+	open    int
+	unlocks int
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	db.Lock()
+	defer db.Unlock()
+	db.opened++
+	db.open++
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Close() error {
+	c.db.Lock()
+	defer c.db.Unlock()
+	c.db.open--
+	return nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.db.Lock()
+	defer c.db.Unlock()
+	return c.db.pingErr
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	c.db.Lock()
+	defer c.db.Unlock()
+	return &fakeRows{value: c.db.grant}, nil
+}
+
+func (c *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	c.db.Lock()
+	defer c.db.Unlock()
+	c.db.unlocks++
+	return driver.ResultNoRows, nil
+}
+
+type fakeRows struct {
+	value bool
+	done  bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"pg_try_advisory_lock"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func (db *fakeDB) counts() (opened, open, unlocks int) {
+	db.Lock()
+	defer db.Unlock()
+	return db.opened, db.open, db.unlocks
+}
+
+func reset(t *testing.T) {
+	t.Cleanup(func() {
+		enabled.Store(false)
+		leading.Store(false)
+	})
+}
+
+func TestIsLeader(t *testing.T) {
+	reset(t)
+
+	// every instance runs the singleton jobs without the leader election
+	assert.True(t, IsLeader())
+	leading.Store(false)
+	assert.True(t, IsLeader())
+
+	enabled.Store(true)
+	assert.False(t, IsLeader())
+	leading.Store(true)
+	assert.True(t, IsLeader())
+}
+
+func TestCampaign(t *testing.T) {
+	reset(t)
+	enabled.Store(true)
+	ctx := context.Background()
+
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	// connections given back are closed, for the counts to follow them
+	db.SetMaxIdleConns(0)
+
+	// another instance holds the lock
+	c := campaign(ctx, db.Conn, nil)
+	assert.Nil(t, c)
+	assert.False(t, IsLeader())
+	opened, open, _ := fake.counts()
+	assert.Equal(t, 1, opened)
+	assert.Equal(t, 0, open)
+
+	// until it releases it
+	fake.grant = true
+	c = campaign(ctx, db.Conn, nil)
+	require.NotNil(t, c)
+	assert.True(t, IsLeader())
+	opened, open, _ = fake.counts()
+	assert.Equal(t, 2, opened)
+	assert.Equal(t, 1, open)
+
+	// the leader keeps its connection as long as it's alive
+	next := campaign(ctx, db.Conn, c)
+	assert.Same(t, c, next)
+	assert.True(t, IsLeader())
+	opened, open, _ = fake.counts()
+	assert.Equal(t, 2, opened)
+	assert.Equal(t, 1, open)
+
+	// and campaigns again when it's lost
+	fake.pingErr = errors.New("connection reset by peer")
+	fake.grant = false
+	next = campaign(ctx, db.Conn, c)
+	assert.Nil(t, next)
+	assert.False(t, IsLeader())
+	opened, open, _ = fake.counts()
+	assert.Equal(t, 3, opened)
+	assert.Equal(t, 0, open)
+
+	// failing to get a connection doesn't make it the leader
+	failing := func(context.Context) (*sql.Conn, error) { return nil, errors.New("too many connections") }
+	assert.Nil(t, campaign(ctx, failing, nil))
+	assert.False(t, IsLeader())
+
+	// resigning releases the lock and the connection
+	fake.pingErr = nil
+	fake.grant = true
+	c = campaign(ctx, db.Conn, nil)
+	require.NotNil(t, c)
+	assert.True(t, IsLeader())
+	resign(c)
+	assert.False(t, IsLeader())
+	_, open, unlocks := fake.counts()
+	assert.Equal(t, 0, open)
+	assert.Equal(t, 1, unlocks)
+}
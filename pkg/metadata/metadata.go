@@ -14,6 +14,9 @@ const (
 	FunctionName = "function_name"
 	CommentID    = "comment_id"
 	BatchID      = "batch_id"
+	Assignee     = "assignee"
+	DryRun       = "dry_run"
+	ArchiveName  = "archive"
 )
 
 func AddActionMetadata(c *gin.Context, name string, value interface{}) {
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cneill/utask/pkg/now"
+)
+
+// maxDedupEntries bounds the number of notifications remembered for deduplication,
+// the oldest ones are evicted first
+const maxDedupEntries = 10000
+
+// dedupCache remembers when notifications were last sent, to suppress
+// identical notifications fired again within a time window (eg. a flapping task)
+type dedupCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // least recently sent first
+	now        func() time.Time
+}
+
+type dedupEntry struct {
+	key  string
+	sent time.Time
+}
+
+var dedup = newDedupCache(maxDedupEntries)
+
+func newDedupCache(maxEntries int) *dedupCache {
+	return &dedupCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        now.Get,
+	}
+}
+
+// dedupKey identifies a notification by task, action and state
+// messages not related to a task are never deduplicated
+func dedupKey(m *Message) string {
+	if m.TaskID() == "" {
+		return ""
+	}
+	return strings.Join([]string{
+		m.TaskID(),
+		m.NotificationType,
+		m.TaskState(),
+		m.Fields["step_name"],
+		m.Fields["step_state"],
+	}, "\x00")
+}
+
+// isDuplicate returns true if an identical message was sent less than window ago,
+// otherwise the message is recorded as sent
+func (c *dedupCache) isDuplicate(m *Message, window time.Duration) bool {
+	key := dedupKey(m)
+	if key == "" || window <= 0 {
+		return false
+	}
+
+	t := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*dedupEntry)
+		if t.Sub(entry.sent) < window {
+			return true
+		}
+		entry.sent = t
+		c.order.MoveToBack(e)
+		return false
+	}
+
+	c.entries[key] = c.order.PushBack(&dedupEntry{key: key, sent: t})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).key)
+	}
+
+	return false
+}
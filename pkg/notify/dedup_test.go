@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupCache(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newDedupCache(2)
+	c.now = func() time.Time { return clock }
+
+	msg := func(taskID, state string) *Message {
+		return &Message{
+			NotificationType: TaskStateUpdateKey,
+			Fields:           map[string]string{"task_id": taskID, "state": state},
+		}
+	}
+
+	assert.False(t, c.isDuplicate(msg("a", "BLOCKED"), time.Minute))
+	assert.True(t, c.isDuplicate(msg("a", "BLOCKED"), time.Minute))
+	// another state or another task is not a duplicate
+	assert.False(t, c.isDuplicate(msg("a", "RUNNING"), time.Minute))
+	assert.True(t, c.isDuplicate(msg("a", "RUNNING"), time.Minute))
+
+	// no deduplication without window, or for messages unrelated to a task
+	assert.False(t, c.isDuplicate(msg("a", "RUNNING"), 0))
+	assert.False(t, c.isDuplicate(msg("", "RUNNING"), time.Minute))
+	assert.False(t, c.isDuplicate(msg("", "RUNNING"), time.Minute))
+
+	// once the window is over, the notification is sent again
+	clock = clock.Add(2 * time.Minute)
+	assert.False(t, c.isDuplicate(msg("a", "BLOCKED"), time.Minute))
+	assert.True(t, c.isDuplicate(msg("a", "BLOCKED"), time.Minute))
+
+	// the cache is bounded: the least recently sent entry (a, RUNNING) is evicted
+	assert.False(t, c.isDuplicate(msg("b", "BLOCKED"), time.Minute))
+	assert.Equal(t, 2, c.order.Len())
+	assert.False(t, c.isDuplicate(msg("a", "RUNNING"), time.Hour))
+	assert.True(t, c.isDuplicate(msg("b", "BLOCKED"), time.Minute))
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ovh/configstore"
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/pkg/notify"
+	"github.com/cneill/utask/pkg/notify/mattermost"
 	"github.com/cneill/utask/pkg/notify/opsgenie"
 	"github.com/cneill/utask/pkg/notify/slack"
+	"github.com/cneill/utask/pkg/notify/telegram"
 	"github.com/cneill/utask/pkg/notify/webhook"
 )
 
@@ -19,16 +22,45 @@ const (
 )
 
 // Init aims to inject user defined cfg around notify
+// the same configuration is read again by notify.ReloadSenders
 func Init(store *configstore.Store) error {
-	cfg, err := utask.Config(store)
+	notify.SetLoader(load)
+	return notify.ReloadSenders(store)
+}
+
+// notifyCfg holds the notify related part of the global configuration
+type notifyCfg struct {
+	NotifyConfig  map[string]utask.NotifyBackend `json:"notify_config"`
+	NotifyActions utask.NotifyActions            `json:"notify_actions"`
+}
+
+// readConfig reads the notify configuration straight from the store,
+// utask.Config only loading the global configuration once
+func readConfig(store *configstore.Store) (*notifyCfg, error) {
+	cfgStr, err := configstore.Filter().Slice(utask.UtaskCfgSecretAlias).Squash().Store(store).MustGetFirstItem().Value()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to get utask configuration from store: %s", err)
 	}
 
+	var cfg notifyCfg
+	if err := json.Unmarshal([]byte(cfgStr), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal utask configuration: %s", err)
+	}
+	return &cfg, nil
+}
+
+// load builds the notification senders and actions described in the configuration
+func load(store *configstore.Store) (*notify.Backends, utask.NotifyActions, error) {
+	cfg, err := readConfig(store)
+	if err != nil {
+		return nil, utask.NotifyActions{}, err
+	}
+
+	b := notify.NewBackends()
 	for name, ncfg := range cfg.NotifyConfig {
 		newncfg, err := validateAndNormalizeNotificationStrategy(ncfg)
 		if err != nil {
-			return err
+			return nil, utask.NotifyActions{}, err
 		}
 
 		// save normalisation modifications
@@ -38,7 +70,7 @@ func Init(store *configstore.Store) error {
 		case opsgenie.Type:
 			f := utask.NotifyBackendOpsGenie{}
 			if err := json.Unmarshal(ncfg.Config, &f); err != nil {
-				return fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
 			}
 			ogns, err := opsgenie.NewOpsGenieNotificationSender(
 				f.Zone,
@@ -46,22 +78,41 @@ func Init(store *configstore.Store) error {
 				f.Timeout,
 			)
 			if err != nil {
-				return fmt.Errorf("failed to instantiate opsgenie notification sender: %s", err)
+				return nil, utask.NotifyActions{}, fmt.Errorf("failed to instantiate opsgenie notification sender: %s", err)
 			}
-			notify.RegisterSender(name, ogns, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
+			b.Register(name, ogns, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
 
 		case slack.Type:
 			f := utask.NotifyBackendSlack{}
 			if err := json.Unmarshal(ncfg.Config, &f); err != nil {
-				return fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
 			}
 			sn := slack.NewSlackNotificationSender(f.WebhookURL)
-			notify.RegisterSender(name, sn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
+			b.Register(name, sn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
+
+		case mattermost.Type:
+			f := utask.NotifyBackendMattermost{}
+			if err := json.Unmarshal(ncfg.Config, &f); err != nil {
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+			}
+			mn := mattermost.NewMattermostNotificationSender(f.WebhookURL).WithChannel(f.Channel)
+			b.Register(name, mn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
+
+		case telegram.Type:
+			f := utask.NotifyBackendTelegram{}
+			if err := json.Unmarshal(ncfg.Config, &f); err != nil {
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+			}
+			if f.BotToken == "" || f.ChatID == "" {
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: bot_token and chat_id are required", errRetrieveCfg, ncfg.Type, name)
+			}
+			tn := telegram.NewTelegramNotificationSender(f.BotToken, f.ChatID)
+			b.Register(name, tn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
 
 		case webhook.Type:
 			f := utask.NotifyBackendWebhook{}
 			if err := json.Unmarshal(ncfg.Config, &f); err != nil {
-				return fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+				return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
 			}
 
 			if f.CredentialsName != "" {
@@ -79,40 +130,69 @@ func Init(store *configstore.Store) error {
 					Slice(f.CredentialsName).
 					GetItemList()
 				if err != nil {
-					return fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+					return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
 				}
 				if items.Len() == 0 {
-					return fmt.Errorf("%s: %s, %s: no credential found with name %q", errRetrieveCfg, ncfg.Type, name, f.CredentialsName)
+					return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: no credential found with name %q", errRetrieveCfg, ncfg.Type, name, f.CredentialsName)
 				}
 				if items.Len() > 1 {
-					return fmt.Errorf("%s: %s, %s: more than one credentials found with name %q", errRetrieveCfg, ncfg.Type, name, f.CredentialsName)
+					return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: more than one credentials found with name %q", errRetrieveCfg, ncfg.Type, name, f.CredentialsName)
 				}
 
 				iValue, err := items.Items[0].Unmarshaled()
 				if err != nil {
-					return fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
+					return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: %s", errRetrieveCfg, ncfg.Type, name, err)
 				}
 
 				value, ok := iValue.(*utask.NotifyBackendWebhookCredentials)
 				if !ok {
-					return fmt.Errorf("%s: %s, %s: expected *utask.NotifyBackendWebhookCredentials, got %T", errRetrieveCfg, ncfg.Type, name, value)
+					return nil, utask.NotifyActions{}, fmt.Errorf("%s: %s, %s: expected *utask.NotifyBackendWebhookCredentials, got %T", errRetrieveCfg, ncfg.Type, name, value)
 				}
 
 				f.Username = value.Username
 				f.Password = value.Password
 			}
 
-			sn := webhook.NewWebhookNotificationSender(f.WebhookURL, f.Username, f.Password, f.Headers)
-			notify.RegisterSender(name, sn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
+			sn, err := webhook.NewWebhookNotificationSender(
+				f.WebhookURL,
+				f.Username,
+				f.Password,
+				f.Headers,
+				f.Timeout,
+				f.InsecureSkipVerify,
+				f.RootCA,
+				webhook.PayloadTemplate{
+					Template:    f.PayloadTemplate,
+					ContentType: f.ContentType,
+				},
+			)
+			if err != nil {
+				return nil, utask.NotifyActions{}, fmt.Errorf("failed to instantiate webhook notification sender: %s", err)
+			}
+			b.Register(name, sn, ncfg.DefaultNotificationStrategy, ncfg.TemplateNotificationStrategies)
 
 		default:
-			return fmt.Errorf("failed to identify backend type: %s", ncfg.Type)
+			return nil, utask.NotifyActions{}, fmt.Errorf("failed to identify backend type: %s", ncfg.Type)
 		}
 	}
 
-	notify.RegisterActions(cfg.NotifyActions)
+	for action, params := range map[string]utask.NotifyActionsParameters{
+		notify.TaskStateUpdateKey:      cfg.NotifyActions.TaskStateUpdateAction,
+		notify.TaskValidationKey:       cfg.NotifyActions.TaskValidationAction,
+		notify.TaskStepUpdateKey:       cfg.NotifyActions.TaskStepUpdateAction,
+		notify.TaskSLABreachKey:        cfg.NotifyActions.TaskSLABreachAction,
+		notify.TaskReminderKey:         cfg.NotifyActions.TaskResolverReminderAction,
+		notify.TaskStepNotificationKey: cfg.NotifyActions.TaskStepNotificationAction,
+	} {
+		if params.DeduplicationWindow == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(params.DeduplicationWindow); err != nil {
+			return nil, utask.NotifyActions{}, fmt.Errorf("invalid deduplication_window for notify action %q: %s", action, err)
+		}
+	}
 
-	return nil
+	return b, cfg.NotifyActions, nil
 }
 
 func validateAndNormalizeNotificationStrategy(ncfg utask.NotifyBackend) (utask.NotifyBackend, error) {
@@ -122,7 +202,7 @@ func validateAndNormalizeNotificationStrategy(ncfg utask.NotifyBackend) (utask.N
 		}
 	}
 
-	for _, action := range []string{notify.TaskValidationKey, notify.TaskStateUpdateKey, notify.TaskStepUpdateKey} {
+	for _, action := range []string{notify.TaskValidationKey, notify.TaskStateUpdateKey, notify.TaskStepUpdateKey, notify.TaskSLABreachKey, notify.TaskReminderKey, notify.TaskStepNotificationKey} {
 		if ncfg.DefaultNotificationStrategy == nil {
 			ncfg.DefaultNotificationStrategy = make(map[string]string)
 		}
@@ -167,11 +247,13 @@ func validateStrategyForAction(action, strategy string) error {
 	switch strategy {
 	case utask.NotificationStrategyAlways, utask.NotificationStrategySilent:
 	case utask.NotificationStrategyFailureOnly:
-		if action == notify.TaskValidationKey {
+		// validations and sla breaches only happen on tasks that are not over,
+		// step notifications are sent on the states chosen by the steps
+		if action == notify.TaskValidationKey || action == notify.TaskSLABreachKey || action == notify.TaskStepNotificationKey {
 			return errNotAllowed
 		}
 	case utask.NotificationStrategyFailureOrDone:
-		if action == notify.TaskValidationKey {
+		if action == notify.TaskValidationKey || action == notify.TaskSLABreachKey || action == notify.TaskStepNotificationKey {
 			return errNotAllowed
 		}
 	default:
@@ -183,7 +265,7 @@ func validateStrategyForAction(action, strategy string) error {
 
 func validateActionName(action string) bool {
 	switch action {
-	case notify.TaskValidationKey, notify.TaskStateUpdateKey, notify.TaskStepUpdateKey:
+	case notify.TaskValidationKey, notify.TaskStateUpdateKey, notify.TaskStepUpdateKey, notify.TaskSLABreachKey, notify.TaskReminderKey, notify.TaskStepNotificationKey:
 		return true
 	default:
 		return false
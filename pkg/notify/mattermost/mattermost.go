@@ -0,0 +1,136 @@
+package mattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cneill/utask/pkg/notify"
+)
+
+const (
+	// Type represents Mattermost as notify backend
+	Type string = "mattermost"
+
+	colorDone    = "#2eb886"
+	colorBlocked = "#d00000"
+	colorDefault = "#439fe0"
+)
+
+// NotificationSender is a notify.NotificationSender implementation
+// capable of sending formatted notifications over a Mattermost incoming webhook
+type NotificationSender struct {
+	webhookURL string
+	channel    string
+	httpClient *http.Client
+}
+
+type formattedMattermostRequest struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Attachments []attachmentMattermost `json:"attachments"`
+}
+
+type attachmentMattermost struct {
+	Fallback string            `json:"fallback"`
+	Color    string            `json:"color,omitempty"`
+	Text     string            `json:"text"`
+	Fields   []fieldMattermost `json:"fields,omitempty"`
+	Footer   string            `json:"footer,omitempty"`
+}
+
+type fieldMattermost struct {
+	Short bool   `json:"short"`
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// NewMattermostNotificationSender instantiates a NotificationSender
+func NewMattermostNotificationSender(webhookURL string) *NotificationSender {
+	return &NotificationSender{
+		webhookURL: webhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithChannel overrides the channel configured on the incoming webhook
+func (mn *NotificationSender) WithChannel(channel string) *NotificationSender {
+	mn.channel = channel
+	return mn
+}
+
+// Send dispatches a notify.Message to Mattermost
+func (mn *NotificationSender) Send(m *notify.Message, name string) {
+	mmfb := formatSendRequest(m, name, mn.channel)
+
+	mmBody, _ := json.Marshal(mmfb)
+
+	req, err := http.NewRequest(http.MethodPost, mn.webhookURL, bytes.NewBuffer(mmBody))
+	if err != nil {
+		notify.WrappedSendError(err, m, Type, name)
+		return
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := mn.httpClient.Do(req)
+	if err != nil {
+		notify.WrappedSendError(err, m, Type, name)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("non-ok response returned from Mattermost: %d", resp.StatusCode)
+		notify.WrappedSendErrorWithBody(err, m, Type, name, buf.String())
+		return
+	}
+}
+
+func formatSendRequest(m *notify.Message, name, channel string) *formattedMattermostRequest {
+	att := attachmentMattermost{
+		Fallback: m.MainMessage,
+		Color:    stateColor(m.TaskState()),
+		Text:     m.MainMessage,
+		Footer:   fmt.Sprintf("🚀 Sent from %s", name),
+	}
+
+	keys := make([]string, 0, len(m.Fields))
+	for key := range m.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := m.Fields[key]
+		if len(value) > 0 {
+			trimStr := strings.Replace(key, "_", " ", -1)
+			att.Fields = append(att.Fields, fieldMattermost{
+				Short: len(value) < 40,
+				Title: strings.Title(trimStr),
+				Value: value,
+			})
+		}
+	}
+
+	return &formattedMattermostRequest{
+		Channel:     channel,
+		Attachments: []attachmentMattermost{att},
+	}
+}
+
+func stateColor(state string) string {
+	switch state {
+	case "DONE":
+		return colorDone
+	case "BLOCKED":
+		return colorBlocked
+	default:
+		return colorDefault
+	}
+}
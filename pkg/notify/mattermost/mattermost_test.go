@@ -0,0 +1,68 @@
+package mattermost
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/notify"
+)
+
+var testMessage = &notify.Message{
+	MainMessage: "Task 'foo-bar' state update: DONE",
+	Fields: map[string]string{
+		"task_id":  "1234-abcd",
+		"state":    "DONE",
+		"resolver": "",
+		"url":      "https://utask.example.org/ui/dashboard/#/task/1234-abcd/with/a/very/long/path",
+	},
+}
+
+func Test_formatSendRequest(t *testing.T) {
+	expected := &formattedMattermostRequest{
+		Attachments: []attachmentMattermost{{
+			Fallback: "Task 'foo-bar' state update: DONE",
+			Color:    colorDone,
+			Text:     "Task 'foo-bar' state update: DONE",
+			Fields: []fieldMattermost{
+				{Short: true, Title: "State", Value: "DONE"},
+				{Short: true, Title: "Task Id", Value: "1234-abcd"},
+				{Short: false, Title: "Url", Value: "https://utask.example.org/ui/dashboard/#/task/1234-abcd/with/a/very/long/path"},
+			},
+			Footer: "🚀 Sent from mattermost-ops",
+		}},
+	}
+	assert.Equal(t, expected, formatSendRequest(testMessage, "mattermost-ops", ""))
+
+	expected.Channel = "ops-alerts"
+	assert.Equal(t, expected, formatSendRequest(testMessage, "mattermost-ops", "ops-alerts"))
+
+	assert.Equal(t, colorBlocked, stateColor("BLOCKED"))
+	assert.Equal(t, colorDefault, stateColor("RUNNING"))
+}
+
+func TestSend(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	// the channel of the incoming webhook is kept without override
+	NewMattermostNotificationSender(server.URL).Send(testMessage, "mattermost-ops")
+	require.NotNil(t, body)
+	assert.NotContains(t, body, "channel")
+	require.Len(t, body["attachments"], 1)
+	assert.Equal(t, "Task 'foo-bar' state update: DONE", body["attachments"].([]interface{})[0].(map[string]interface{})["text"])
+
+	NewMattermostNotificationSender(server.URL).WithChannel("ops-alerts").Send(testMessage, "mattermost-ops")
+	require.NotNil(t, body)
+	assert.Equal(t, "ops-alerts", body["channel"])
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/engine/step"
@@ -143,6 +144,118 @@ func WrapTaskValidation(tv *TaskValidation) *Message {
 	return &m
 }
 
+// TaskSLABreach holds a digest of data representing a task still not over after its sla deadline
+type TaskSLABreach struct {
+	Title              string
+	PublicID           string
+	ResolutionPublicID string
+	State              string
+	TemplateName       string
+	RequesterUsername  string
+	ResolverUsername   *string
+	StepsDone          int
+	StepsTotal         int
+	SLADeadline        time.Time
+	Tags               map[string]string
+}
+
+// WrapTaskSLABreach returns a Message struct formatted for a task breaching its sla
+func WrapTaskSLABreach(tsb *TaskSLABreach) *Message {
+	var m Message
+
+	m.MainMessage = fmt.Sprintf("#task #id:%s\n%s\nSLA breached: not over since %s", tsb.PublicID, tsb.Title, tsb.SLADeadline.Format(time.RFC3339))
+	m.NotificationType = TaskSLABreachKey
+
+	m.Fields = make(map[string]string)
+
+	m.Fields["task_id"] = tsb.PublicID
+	m.Fields["title"] = tsb.Title
+	m.Fields["state"] = tsb.State
+	m.Fields["template"] = tsb.TemplateName
+	m.Fields["requester"] = tsb.RequesterUsername
+	if tsb.ResolverUsername != nil {
+		m.Fields["resolver"] = *tsb.ResolverUsername
+	}
+	m.Fields["steps"] = fmt.Sprintf("%d/%d", tsb.StepsDone, tsb.StepsTotal)
+	m.Fields["sla_deadline"] = tsb.SLADeadline.Format(time.RFC3339)
+	if tsb.ResolutionPublicID != "" {
+		m.Fields["resolution_id"] = tsb.ResolutionPublicID
+	}
+
+	if tsb.Tags != nil {
+		tags, err := json.Marshal(tsb.Tags)
+		if err == nil {
+			m.Fields["tags"] = string(tags)
+		} else {
+			log.Printf("notify error: failed to marshal tags for task #%s: %s", tsb.PublicID, err)
+		}
+	}
+
+	if cfg, err := utask.Config(nil); err == nil {
+		m.Fields["url"] = cfg.BaseURL + cfg.DashboardPathPrefix + dashboardUriTaskView + tsb.PublicID
+	}
+
+	return &m
+}
+
+// TaskReminder holds a digest of data representing a task blocked for too long
+type TaskReminder struct {
+	Title                   string
+	PublicID                string
+	ResolutionPublicID      string
+	State                   string
+	TemplateName            string
+	RequesterUsername       string
+	PotentialResolvers      []string
+	PotentialResolverGroups []string
+	StepsDone               int
+	StepsTotal              int
+	BlockedSince            time.Time
+	Tags                    map[string]string
+}
+
+// WrapTaskReminder returns a Message struct formatted to remind the resolvers of a blocked task
+func WrapTaskReminder(tr *TaskReminder) *Message {
+	var m Message
+
+	m.MainMessage = fmt.Sprintf("#task #id:%s\n%s\nReminder: blocked since %s", tr.PublicID, tr.Title, tr.BlockedSince.Format(time.RFC3339))
+	m.NotificationType = TaskReminderKey
+
+	m.Fields = make(map[string]string)
+
+	m.Fields["task_id"] = tr.PublicID
+	m.Fields["title"] = tr.Title
+	m.Fields["state"] = tr.State
+	m.Fields["template"] = tr.TemplateName
+	m.Fields["requester"] = tr.RequesterUsername
+	m.Fields["steps"] = fmt.Sprintf("%d/%d", tr.StepsDone, tr.StepsTotal)
+	m.Fields["blocked_since"] = tr.BlockedSince.Format(time.RFC3339)
+	if len(tr.PotentialResolvers) > 0 {
+		m.Fields["potential_resolvers"] = strings.Join(tr.PotentialResolvers, " ")
+	}
+	if len(tr.PotentialResolverGroups) > 0 {
+		m.Fields["potential_resolver_groups"] = strings.Join(tr.PotentialResolverGroups, " ")
+	}
+	if tr.ResolutionPublicID != "" {
+		m.Fields["resolution_id"] = tr.ResolutionPublicID
+	}
+
+	if tr.Tags != nil {
+		tags, err := json.Marshal(tr.Tags)
+		if err == nil {
+			m.Fields["tags"] = string(tags)
+		} else {
+			log.Printf("notify error: failed to marshal tags for task #%s: %s", tr.PublicID, err)
+		}
+	}
+
+	if cfg, err := utask.Config(nil); err == nil {
+		m.Fields["url"] = cfg.BaseURL + cfg.DashboardPathPrefix + dashboardUriTaskView + tr.PublicID
+	}
+
+	return &m
+}
+
 // TaskStepUpdate holds a digest of data representing a task step update
 type TaskStepUpdate struct {
 	Title              string
@@ -196,6 +309,60 @@ func WrapTaskStepUpdate(tsu *TaskStepUpdate) *Message {
 	return &m
 }
 
+// TaskStepNotification holds a digest of data representing a step reaching a state listed in its notify block
+type TaskStepNotification struct {
+	Title              string
+	PublicID           string
+	ResolutionPublicID string
+	State              string
+	TemplateName       string
+	RequesterUsername  string
+	ResolverUsername   string
+	StepName           string
+	StepState          string
+	StepError          string
+	Tags               map[string]string
+}
+
+// WrapTaskStepNotification returns a Message struct formatted for a step reaching a state listed in its notify block
+func WrapTaskStepNotification(tsn *TaskStepNotification) *Message {
+	var m Message
+
+	m.MainMessage = fmt.Sprintf("#task #id:%s\n%s\nStep %s: %s", tsn.PublicID, tsn.Title, tsn.StepName, tsn.StepState)
+	m.NotificationType = TaskStepNotificationKey
+
+	m.Fields = make(map[string]string)
+
+	m.Fields["task_id"] = tsn.PublicID
+	m.Fields["title"] = tsn.Title
+	m.Fields["state"] = tsn.State
+	m.Fields["template"] = tsn.TemplateName
+	m.Fields["requester"] = tsn.RequesterUsername
+	m.Fields["resolver"] = tsn.ResolverUsername
+	m.Fields["resolution_id"] = tsn.ResolutionPublicID
+
+	if tsn.Tags != nil {
+		tags, err := json.Marshal(tsn.Tags)
+		if err == nil {
+			m.Fields["tags"] = string(tags)
+		} else {
+			log.Printf("notify error: failed to marshal tags for task #%s: %s", tsn.PublicID, err)
+		}
+	}
+
+	m.Fields["step_name"] = tsn.StepName
+	m.Fields["step_state"] = tsn.StepState
+	if tsn.StepError != "" {
+		m.Fields["step_error"] = tsn.StepError
+	}
+
+	if cfg, err := utask.Config(nil); err == nil {
+		m.Fields["url"] = cfg.BaseURL + cfg.DashboardPathPrefix + dashboardUriTaskView + tsn.PublicID
+	}
+
+	return &m
+}
+
 func checkIfDeliverMessage(m *Message, b *notificationBackend) bool {
 	send := checkIfDeliverMessageFromTaskState(m, b.defaultNotificationStrategy[m.NotificationType])
 
@@ -1,21 +1,40 @@
 package notify
 
-import "github.com/cneill/utask"
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask"
+)
 
 // utask should be able to notify about inner task events through different channels
 // relevant information for the outside world is described by the Message struct
 // this package allows for the registration of different senders, capable of handling the Message struct
 
 var (
+	// mu guards all the package state below: senders can be registered or reloaded while notifications are sent
+	// a published senders map is never modified but replaced, so that Send can range over it without holding the lock
+	mu      sync.RWMutex
 	senders = make(map[string]notificationBackend)
+	// registered holds the senders added through RegisterSender (e.g. by init plugins), kept on reload
+	registered = make(map[string]notificationBackend)
 	// actions represents configuration of each notify actions
 	actions utask.NotifyActions
+	// loader builds the senders and actions from the configuration, see ReloadSenders
+	loader Loader
 )
 
 const (
 	TaskStateUpdateKey = "task_state_update"
 	TaskStepUpdateKey  = "task_step_update"
 	TaskValidationKey  = "task_validation"
+	TaskSLABreachKey   = "task_sla_breach"
+	TaskReminderKey    = "task_resolver_reminder"
+	// TaskStepNotificationKey is fired by the steps declaring a notify block
+	TaskStepNotificationKey = "task_step_notification"
 )
 
 // NotificationSender is an object capable of sending a Message struct
@@ -30,17 +49,86 @@ type notificationBackend struct {
 	templateNotificationStrategies map[string][]utask.TemplateNotificationStrategy
 }
 
-// RegisterSender adds a NotificationSender to the pool of available senders
-func RegisterSender(name string, s NotificationSender, defaultNotificationStrategy map[string]string, templateNotificationStrategies map[string][]utask.TemplateNotificationStrategy) {
-	senders[name] = notificationBackend{
+// Backends is a set of named senders, built from the configuration
+// before replacing the registered senders all at once
+type Backends struct {
+	senders map[string]notificationBackend
+}
+
+// NewBackends returns an empty set of senders
+func NewBackends() *Backends {
+	return &Backends{senders: make(map[string]notificationBackend)}
+}
+
+// Register adds a NotificationSender to the set
+func (b *Backends) Register(name string, s NotificationSender, defaultNotificationStrategy map[string]string, templateNotificationStrategies map[string][]utask.TemplateNotificationStrategy) {
+	b.senders[name] = notificationBackend{
 		sender:                         s,
 		defaultNotificationStrategy:    defaultNotificationStrategy,
 		templateNotificationStrategies: templateNotificationStrategies,
 	}
 }
 
+// Loader builds the senders and the actions described in a configuration store
+type Loader func(store *configstore.Store) (*Backends, utask.NotifyActions, error)
+
+// SetLoader sets the function building the senders and actions on ReloadSenders
+func SetLoader(l Loader) {
+	mu.Lock()
+	defer mu.Unlock()
+	loader = l
+}
+
+// ReloadSenders builds the senders and actions from the configuration store,
+// then replaces the registered ones at once: a notification being sent sees either
+// the previous or the new senders, never a mix of both
+// the registered senders are kept if the configuration is invalid
+func ReloadSenders(store *configstore.Store) error {
+	mu.RLock()
+	l := loader
+	mu.RUnlock()
+	if l == nil {
+		return errors.New("notify: no loader set to reload senders")
+	}
+
+	b, na, err := l(store)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// senders from the configuration replace the registered ones with the same name
+	for name, nb := range registered {
+		if _, ok := b.senders[name]; !ok {
+			b.senders[name] = nb
+		}
+	}
+	senders = b.senders
+	actions = na
+	return nil
+}
+
+// RegisterSender adds a NotificationSender to the pool of available senders
+func RegisterSender(name string, s NotificationSender, defaultNotificationStrategy map[string]string, templateNotificationStrategies map[string][]utask.TemplateNotificationStrategy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// copy the published map, it can still be read by Send
+	b := NewBackends()
+	for n, nb := range senders {
+		b.senders[n] = nb
+	}
+	b.Register(name, s, defaultNotificationStrategy, templateNotificationStrategies)
+	registered[name] = b.senders[name]
+	senders = b.senders
+}
+
 // ListSendersNames returns a list of available senders
 func ListSendersNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
 	names := []string{}
 	for name := range senders {
 		names = append(names, name)
@@ -50,11 +138,15 @@ func ListSendersNames() []string {
 
 // RegisterActions set available actions
 func RegisterActions(na utask.NotifyActions) {
+	mu.Lock()
+	defer mu.Unlock()
 	actions = na
 }
 
 // ListActions returns a list of available actions to notify
 func ListActions() utask.NotifyActions {
+	mu.RLock()
+	defer mu.RUnlock()
 	return actions
 }
 
@@ -64,6 +156,15 @@ func Send(m *Message, params utask.NotifyActionsParameters) {
 		return
 	}
 
+	// an invalid or empty window disables deduplication, windows are validated on init
+	if window, err := time.ParseDuration(params.DeduplicationWindow); err == nil && dedup.isDuplicate(m, window) {
+		return
+	}
+
+	mu.RLock()
+	senders := senders
+	mu.RUnlock()
+
 	// Empty NotifyBackends list means any
 	if len(params.NotifyBackends) == 0 {
 		for name, s := range senders {
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ovh/configstore"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cneill/utask"
+)
+
+type countingSender struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (s *countingSender) Send(m *Message, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+}
+
+// resetSenders clears the package state left by other tests
+func resetSenders() {
+	mu.Lock()
+	defer mu.Unlock()
+	senders = make(map[string]notificationBackend)
+	registered = make(map[string]notificationBackend)
+	actions = utask.NotifyActions{}
+	loader = nil
+}
+
+func sortedSendersNames() []string {
+	names := ListSendersNames()
+	sort.Strings(names)
+	return names
+}
+
+func TestReloadSenders(t *testing.T) {
+	resetSenders()
+	always := map[string]string{TaskStateUpdateKey: utask.NotificationStrategyAlways}
+
+	RegisterSender("plugin", &countingSender{}, always, nil)
+
+	backends := []string{"slack", "webhook"}
+	var loadErr error
+	SetLoader(func(store *configstore.Store) (*Backends, utask.NotifyActions, error) {
+		if loadErr != nil {
+			return nil, utask.NotifyActions{}, loadErr
+		}
+		b := NewBackends()
+		for _, name := range backends {
+			b.Register(name, &countingSender{}, always, nil)
+		}
+		return b, utask.NotifyActions{TaskStepUpdateAction: utask.NotifyActionsParameters{Disabled: true}}, nil
+	})
+
+	// senders registered by plugins are kept along with the configured ones
+	assert.NoError(t, ReloadSenders(nil))
+	assert.Equal(t, []string{"plugin", "slack", "webhook"}, sortedSendersNames())
+	assert.True(t, ListActions().TaskStepUpdateAction.Disabled)
+
+	backends = []string{"slack"}
+	assert.NoError(t, ReloadSenders(nil))
+	assert.Equal(t, []string{"plugin", "slack"}, sortedSendersNames())
+
+	// an invalid configuration keeps the current senders
+	loadErr = errors.New("invalid configuration")
+	assert.Error(t, ReloadSenders(nil))
+	assert.Equal(t, []string{"plugin", "slack"}, sortedSendersNames())
+	loadErr = nil
+
+	// notifications can be sent while reloading
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			Send(&Message{NotificationType: TaskStateUpdateKey, Fields: map[string]string{}}, utask.NotifyActionsParameters{})
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, ReloadSenders(nil))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentRegisterAndSend(t *testing.T) {
+	resetSenders()
+	always := map[string]string{TaskStateUpdateKey: utask.NotificationStrategyAlways}
+	sender := &countingSender{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			RegisterSender(fmt.Sprintf("concurrent-%d", i), sender, always, nil)
+		}(i)
+		go func() {
+			defer wg.Done()
+			Send(&Message{NotificationType: TaskStateUpdateKey, Fields: map[string]string{}}, ListActions().TaskStateUpdateAction)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = ListSendersNames()
+		}()
+		go func() {
+			defer wg.Done()
+			RegisterActions(utask.NotifyActions{})
+		}()
+	}
+	wg.Wait()
+
+	names := ListSendersNames()
+	for i := 0; i < 20; i++ {
+		assert.Contains(t, names, fmt.Sprintf("concurrent-%d", i))
+	}
+}
+
+func TestWrapTaskReminder(t *testing.T) {
+	m := WrapTaskReminder(&TaskReminder{
+		PublicID:                "task-id",
+		PotentialResolvers:      []string{"foo", "bar"},
+		PotentialResolverGroups: []string{"team-eu"},
+	})
+	assert.Equal(t, TaskReminderKey, m.NotificationType)
+	assert.Equal(t, "foo bar", m.Fields["potential_resolvers"])
+	assert.Equal(t, "team-eu", m.Fields["potential_resolver_groups"])
+
+	// a task resolved by groups only doesn't list any user
+	m = WrapTaskReminder(&TaskReminder{PublicID: "task-id", PotentialResolverGroups: []string{"team-eu"}})
+	assert.NotContains(t, m.Fields, "potential_resolvers")
+	assert.Equal(t, "team-eu", m.Fields["potential_resolver_groups"])
+}
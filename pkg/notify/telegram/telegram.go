@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cneill/utask/pkg/notify"
+)
+
+const (
+	// Type represents Telegram as notify backend
+	Type string = "telegram"
+
+	apiURL = "https://api.telegram.org"
+)
+
+// characters to be escaped in MarkdownV2 text, see https://core.telegram.org/bots/api#markdownv2-style
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `_`, `\_`, `*`, `\*`, `[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`,
+	`~`, `\~`, "`", "\\`", `>`, `\>`, `#`, `\#`, `+`, `\+`, `-`, `\-`, `=`, `\=`,
+	`|`, `\|`, `{`, `\{`, `}`, `\}`, `.`, `\.`, `!`, `\!`,
+)
+
+// inside the url of an inline link, only ')' and '\' have to be escaped
+var linkEscaper = strings.NewReplacer(`\`, `\\`, `)`, `\)`)
+
+// NotificationSender is a notify.NotificationSender implementation
+// capable of sending formatted notifications through a Telegram bot
+type NotificationSender struct {
+	apiURL     string
+	botToken   string
+	chatID     string
+	httpClient *http.Client
+}
+
+type sendMessageRequest struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type sendMessageResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// NewTelegramNotificationSender instantiates a NotificationSender
+func NewTelegramNotificationSender(botToken, chatID string) *NotificationSender {
+	return &NotificationSender{
+		apiURL:     apiURL,
+		botToken:   botToken,
+		chatID:     chatID,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send dispatches a notify.Message to Telegram
+func (tn *NotificationSender) Send(m *notify.Message, name string) {
+	body, _ := json.Marshal(sendMessageRequest{
+		ChatID:                tn.chatID,
+		Text:                  formatMessage(m, name),
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/bot%s/sendMessage", tn.apiURL, tn.botToken), bytes.NewBuffer(body))
+	if err != nil {
+		// the error holds the url, which contains the bot token
+		notify.WrappedSendError(errors.New("failed to build Telegram request"), m, Type, name)
+		return
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := tn.httpClient.Do(req)
+	if err != nil {
+		notify.WrappedSendError(errors.New(strings.Replace(err.Error(), tn.botToken, "xxx", -1)), m, Type, name)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(resp.Body)
+
+	var smr sendMessageResponse
+	if err := json.Unmarshal(buf.Bytes(), &smr); err != nil || !smr.OK {
+		err = fmt.Errorf("non-ok response returned from Telegram: %d", resp.StatusCode)
+		notify.WrappedSendErrorWithBody(err, m, Type, name, buf.String())
+		return
+	}
+}
+
+func formatMessage(m *notify.Message, name string) string {
+	var sb strings.Builder
+
+	sb.WriteString("*" + escapeMarkdown(m.MainMessage) + "*\n\n")
+
+	keys := make([]string, 0, len(m.Fields))
+	for key := range m.Fields {
+		// the url is rendered as a link below
+		if key != "url" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := m.Fields[key]
+		if len(value) > 0 {
+			trimStr := strings.Title(strings.Replace(key, "_", " ", -1))
+			sb.WriteString(fmt.Sprintf("*%s:* %s\n", escapeMarkdown(trimStr), escapeMarkdown(value)))
+		}
+	}
+
+	if url := m.Fields["url"]; url != "" {
+		sb.WriteString(fmt.Sprintf("\n[View task](%s)\n", linkEscaper.Replace(url)))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n_🚀 Sent from %s_", escapeMarkdown(name)))
+
+	return sb.String()
+}
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
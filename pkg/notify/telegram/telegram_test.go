@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cneill/utask/pkg/notify"
+)
+
+func Test_formatMessage(t *testing.T) {
+	m := &notify.Message{
+		MainMessage: "Task 'foo-bar' state update: DONE",
+		Fields: map[string]string{
+			"task_id":  "1234-abcd",
+			"state":    "DONE",
+			"steps":    "2/2",
+			"resolver": "",
+			"url":      "https://utask.example.org/ui/dashboard/#/task/1234-abcd",
+		},
+	}
+
+	expected := "*Task 'foo\\-bar' state update: DONE*\n\n" +
+		"*State:* DONE\n" +
+		"*Steps:* 2/2\n" +
+		"*Task Id:* 1234\\-abcd\n" +
+		"\n[View task](https://utask.example.org/ui/dashboard/#/task/1234-abcd)\n" +
+		"\n_🚀 Sent from telegram\\-ops_"
+
+	assert.Equal(t, expected, formatMessage(m, "telegram-ops"))
+}
@@ -5,40 +5,140 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/Masterminds/sprig/v3"
+
 	"github.com/cneill/utask/pkg/notify"
+	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
 )
 
 const (
 	// Type represents Webhook as notify backend
 	Type string = "webhook"
+
+	defaultTimeout     = 10 * time.Second
+	defaultContentType = "application/json"
 )
 
 // NotificationSender is a notify.NotificationSender implementation
 // capable of sending notifications to a webhook
 type NotificationSender struct {
-	webhookURL string
-	username   string
-	password   string
-	headers    map[string]string
-	httpClient *http.Client
+	webhookURL      string
+	username        string
+	password        string
+	headers         map[string]string
+	payloadTemplate *template.Template
+	contentType     string
+	httpClient      *http.Client
+}
+
+// PayloadTemplate configures the body sent to the webhook:
+// Template is a Go template executed over the notify.Message, replacing the default JSON body,
+// its values are not JSON-escaped unless piped through toJson,
+// ContentType is the Content-Type header of the request
+type PayloadTemplate struct {
+	Template    string
+	ContentType string
 }
 
 // NewWebhookNotificationSender instantiates a NotificationSender
-func NewWebhookNotificationSender(webhookURL, username, password string, headers map[string]string) *NotificationSender {
+// timeout defaults to 10s, rootCA holds PEM encoded certificates trusted on top of the system ones
+func NewWebhookNotificationSender(webhookURL, username, password string, headers map[string]string, timeout string, insecureSkipVerify bool, rootCA string, payload PayloadTemplate) (*NotificationSender, error) {
+	httpClient := &http.Client{Timeout: defaultTimeout}
+	if timeout != "" {
+		td, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timeout: %s", err)
+		}
+		httpClient.Timeout = td
+	}
+
+	opts := []func(*http.Transport) error{}
+	if insecureSkipVerify {
+		opts = append(opts, httputil.WithTLSInsecureSkipVerify(true))
+	}
+	if rootCA != "" {
+		opts = append(opts, httputil.WithTLSRootCA([]byte(rootCA)))
+	}
+	if len(opts) > 0 {
+		transport, err := httputil.GetTransport(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to craft a new http transport: %s", err)
+		}
+		httpClient.Transport = transport
+	}
+
+	contentType := payload.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	var tmpl *template.Template
+	if payload.Template != "" {
+		var err error
+		tmpl, err = parsePayloadTemplate(payload.Template, contentType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &NotificationSender{
-		webhookURL: webhookURL,
-		username:   username,
-		password:   password,
-		headers:    headers,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		webhookURL:      webhookURL,
+		username:        username,
+		password:        password,
+		headers:         headers,
+		payloadTemplate: tmpl,
+		contentType:     contentType,
+		httpClient:      httpClient,
+	}, nil
+}
+
+// parsePayloadTemplate parses a payload template, and renders it with an empty message
+// to catch errors early: the result has to be valid JSON when sent as such
+func parsePayloadTemplate(payloadTemplate, contentType string) (*template.Template, error) {
+	tmpl, err := template.New("payload").Funcs(sprig.TxtFuncMap()).Parse(payloadTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse payload_template: %s", err)
 	}
+
+	b, err := render(tmpl, &notify.Message{Fields: map[string]string{}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render payload_template: %s", err)
+	}
+	if isJSON(contentType) && !json.Valid(b) {
+		return nil, fmt.Errorf("payload_template does not render valid JSON: %s", b)
+	}
+
+	return tmpl, nil
 }
 
-// Send is the implementation for triggering a webhook to send the notification
-func (w *NotificationSender) Send(m *notify.Message, name string) {
+func render(tmpl *template.Template, m *notify.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// payload returns the body of the request sent for a message
+func (w *NotificationSender) payload(m *notify.Message) ([]byte, error) {
+	if w.payloadTemplate != nil {
+		return render(w.payloadTemplate, m)
+	}
+
 	msg := map[string]string{
 		"message":           m.MainMessage,
 		"notification_type": m.NotificationType,
@@ -48,7 +148,12 @@ func (w *NotificationSender) Send(m *notify.Message, name string) {
 		msg[k] = v
 	}
 
-	b, err := json.Marshal(msg)
+	return json.Marshal(msg)
+}
+
+// Send is the implementation for triggering a webhook to send the notification
+func (w *NotificationSender) Send(m *notify.Message, name string) {
+	b, err := w.payload(m)
 	if err != nil {
 		notify.WrappedSendError(err, m, Type, name)
 		return
@@ -60,6 +165,7 @@ func (w *NotificationSender) Send(m *notify.Message, name string) {
 		return
 	}
 
+	req.Header.Set("Content-Type", w.contentType)
 	for k, v := range w.headers {
 		req.Header.Set(k, v)
 	}
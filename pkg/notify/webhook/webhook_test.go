@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/notify"
+)
+
+var testMessage = &notify.Message{
+	MainMessage:      `Task "foo" state update: DONE`,
+	NotificationType: notify.TaskStateUpdateKey,
+	Fields: map[string]string{
+		"task_id": "1234-abcd",
+		"state":   "DONE",
+	},
+}
+
+func Test_parsePayloadTemplate(t *testing.T) {
+	_, err := parsePayloadTemplate(`{"text": {{ .MainMessage | toJson }}}`, "application/json")
+	assert.NoError(t, err)
+	_, err = parsePayloadTemplate(`{"text": {{ .MainMessage | toJson }}}`, "application/vnd.api+json; charset=utf-8")
+	assert.NoError(t, err)
+
+	_, err = parsePayloadTemplate(`{"text": {{ .MainMessage }`, "application/json")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse payload_template")
+
+	_, err = parsePayloadTemplate(`{{ .Unknown.Field }}`, "text/plain")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to render payload_template")
+
+	_, err = parsePayloadTemplate(`{"text": {{ .MainMessage }}}`, "application/json")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload_template does not render valid JSON")
+
+	// a body which isn't sent as JSON is not checked
+	_, err = parsePayloadTemplate(`text={{ .MainMessage }}`, "application/x-www-form-urlencoded")
+	assert.NoError(t, err)
+}
+
+func Test_payload(t *testing.T) {
+	w, err := NewWebhookNotificationSender("http://webhook.example.org", "", "", nil, "", false, "", PayloadTemplate{})
+	require.NoError(t, err)
+	b, err := w.payload(testMessage)
+	require.NoError(t, err)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(b, &body))
+	assert.Equal(t, map[string]string{
+		"message":           `Task "foo" state update: DONE`,
+		"notification_type": notify.TaskStateUpdateKey,
+		"task_id":           "1234-abcd",
+		"state":             "DONE",
+	}, body)
+
+	w, err = NewWebhookNotificationSender("http://webhook.example.org", "", "", nil, "", false, "", PayloadTemplate{
+		Template: `{"text": {{ .MainMessage | toJson }}, "task": {{ .Fields.task_id | toJson }}}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", w.contentType)
+	b, err = w.payload(testMessage)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Task \"foo\" state update: DONE", "task": "1234-abcd"}`, string(b))
+
+	// the values are not escaped without toJson
+	w, err = NewWebhookNotificationSender("http://webhook.example.org", "", "", nil, "", false, "", PayloadTemplate{
+		Template:    `{{ .Fields.state }}: {{ .MainMessage }}`,
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	b, err = w.payload(testMessage)
+	require.NoError(t, err)
+	assert.Equal(t, `DONE: Task "foo" state update: DONE`, string(b))
+
+	// which the check at init can't catch, an empty message rendering valid JSON
+	w, err = NewWebhookNotificationSender("http://webhook.example.org", "", "", nil, "", false, "", PayloadTemplate{
+		Template: `{"text": "{{ .MainMessage }}"}`,
+	})
+	require.NoError(t, err)
+	b, err = w.payload(testMessage)
+	require.NoError(t, err)
+	assert.False(t, json.Valid(b))
+}
+
+func TestSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	_, err := NewWebhookNotificationSender(server.URL, "", "", nil, "soon", false, "", PayloadTemplate{})
+	assert.Error(t, err)
+
+	// the notification is given up once the timeout is reached, instead of waiting for the webhook
+	w, err := NewWebhookNotificationSender(server.URL, "", "", nil, "50ms", false, "", PayloadTemplate{})
+	require.NoError(t, err)
+	start := time.Now()
+	w.Send(testMessage, "webhook-slow")
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&received))
+
+	w, err = NewWebhookNotificationSender(server.URL, "", "", nil, "", false, "", PayloadTemplate{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultTimeout, w.httpClient.Timeout)
+}
+
+func TestSendTLS(t *testing.T) {
+	var received int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	send := func(insecureSkipVerify bool, rootCA string) int32 {
+		t.Helper()
+		w, err := NewWebhookNotificationSender(server.URL, "", "", nil, "", insecureSkipVerify, rootCA, PayloadTemplate{})
+		require.NoError(t, err)
+		before := atomic.LoadInt32(&received)
+		w.Send(testMessage, "webhook-tls")
+		return atomic.LoadInt32(&received) - before
+	}
+
+	// the certificate of the webhook is not trusted by default
+	assert.Equal(t, int32(0), send(false, ""))
+
+	// unless its verification is skipped
+	assert.Equal(t, int32(1), send(true, ""))
+
+	// or its authority is trusted
+	rootCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Equal(t, int32(1), send(false, string(rootCA)))
+
+	_, err := NewWebhookNotificationSender(server.URL, "", "", nil, "", false, "not a certificate", PayloadTemplate{})
+	assert.Error(t, err)
+}
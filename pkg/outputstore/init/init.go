@@ -0,0 +1,59 @@
+package init
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/pkg/archive/filesystem"
+	"github.com/cneill/utask/pkg/archive/s3"
+	"github.com/cneill/utask/pkg/outputstore"
+)
+
+const (
+	errRetrieveCfg string = "failed to retrieve step output store cfg"
+)
+
+// Init registers the storage of large step outputs defined in configuration, if any
+// it uses the same backends as the archives
+func Init(store *configstore.Store) error {
+	cfg, err := utask.Config(store)
+	if err != nil {
+		return err
+	}
+
+	ocfg := cfg.StepOutputStore
+	if ocfg == nil {
+		return nil
+	}
+
+	var s outputstore.Store
+	switch ocfg.Type {
+	case filesystem.Type:
+		f := utask.ArchiveBackendFilesystem{}
+		if err := json.Unmarshal(ocfg.Config, &f); err != nil {
+			return fmt.Errorf("%s: %s: %s", errRetrieveCfg, ocfg.Type, err)
+		}
+		s, err = filesystem.NewSink(f.Path)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate filesystem step output store: %s", err)
+		}
+
+	case s3.Type:
+		f := utask.ArchiveBackendS3{}
+		if err := json.Unmarshal(ocfg.Config, &f); err != nil {
+			return fmt.Errorf("%s: %s: %s", errRetrieveCfg, ocfg.Type, err)
+		}
+		s, err = s3.NewSink(f.Endpoint, f.Region, f.Bucket, f.Prefix, f.AccessKey, f.SecretKey)
+		if err != nil {
+			return fmt.Errorf("failed to instantiate s3 step output store: %s", err)
+		}
+
+	default:
+		return fmt.Errorf("unknown step output store type %q", ocfg.Type)
+	}
+
+	return outputstore.Register(s, ocfg.MaxOutputBytes)
+}
@@ -0,0 +1,116 @@
+package outputstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/juju/errors"
+)
+
+// the outputs of the steps larger than a limit can be spilled to an external storage,
+// to keep the resolutions lean in DB: only a reference to the output is kept in the step,
+// and the output is loaded back along with its resolution
+
+// DefaultMaxOutputBytes is the size of the largest step output kept in DB, when the storage doesn't set it
+const DefaultMaxOutputBytes = 1 << 20
+
+// extension of the name of a stored output
+const extension = ".output"
+
+var (
+	store          Store
+	maxOutputBytes int
+)
+
+// Store is a storage backend for step outputs, such as the archive sinks
+// deleting a missing output must not be an error
+type Store interface {
+	Store(ctx context.Context, name string, data []byte) error
+	Load(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Register sets the storage of the step outputs larger than maxBytes
+func Register(s Store, maxBytes int) error {
+	if s == nil {
+		return errors.NotValidf("nil output store")
+	}
+	if maxBytes < 0 {
+		return errors.NotValidf("negative max_output_bytes")
+	}
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxOutputBytes
+	}
+	store = s
+	maxOutputBytes = maxBytes
+	return nil
+}
+
+// Unregister removes the storage of the step outputs: outputs are kept in DB again
+func Unregister() {
+	store = nil
+	maxOutputBytes = 0
+}
+
+// Enabled asserts that a storage is configured for the step outputs
+func Enabled() bool {
+	return store != nil
+}
+
+// MaxBytes returns the size of the largest output of a step kept in DB,
+// its own limit if set, otherwise the one of the storage
+// 0 means that no output is spilled
+func MaxBytes(stepMaxBytes int) int {
+	if !Enabled() {
+		return 0
+	}
+	if stepMaxBytes > 0 {
+		return stepMaxBytes
+	}
+	return maxOutputBytes
+}
+
+// Name returns the name of a stored output, unique to its resolution, step and content:
+// an unchanged output keeps its name, and doesn't need to be stored again
+func Name(resolutionID, stepName string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(stepName))
+	h.Write([]byte{0})
+	h.Write(data)
+	return resolutionID + "." + hex.EncodeToString(h.Sum(nil)) + extension
+}
+
+// Put stores an output
+func Put(ctx context.Context, name string, data []byte) error {
+	if !Enabled() {
+		return errors.NotImplementedf("step output storage")
+	}
+	return store.Store(ctx, name, data)
+}
+
+// Get loads a stored output
+func Get(ctx context.Context, name string) ([]byte, error) {
+	if !Enabled() {
+		return nil, errors.NotImplementedf("step output storage")
+	}
+	return store.Load(ctx, name)
+}
+
+// Delete removes stored outputs, once their resolution doesn't reference them anymore
+// all the outputs are deleted, the first error being returned
+func Delete(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if !Enabled() {
+		return errors.NotImplementedf("step output storage")
+	}
+	var firstErr error
+	for _, name := range names {
+		if err := store.Delete(ctx, name); err != nil && firstErr == nil {
+			firstErr = errors.Annotatef(err, "failed to delete stored output %s", name)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,48 @@
+package outputstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/archive/filesystem"
+	"github.com/cneill/utask/pkg/outputstore"
+)
+
+func TestOutputStore(t *testing.T) {
+	ctx := context.Background()
+	defer outputstore.Unregister()
+
+	// without storage, outputs are kept in DB
+	assert.False(t, outputstore.Enabled())
+	assert.Equal(t, 0, outputstore.MaxBytes(10))
+	_, err := outputstore.Get(ctx, "foo")
+	assert.Error(t, err)
+
+	s, err := filesystem.NewSink(filepath.Join(t.TempDir(), "outputs"))
+	require.NoError(t, err)
+	assert.Error(t, outputstore.Register(s, -1))
+	require.NoError(t, outputstore.Register(s, 0))
+	assert.Equal(t, outputstore.DefaultMaxOutputBytes, outputstore.MaxBytes(0))
+	assert.Equal(t, 10, outputstore.MaxBytes(10))
+
+	// names depend on the resolution, the step and the output
+	name := outputstore.Name("res", "step", []byte("output"))
+	assert.Equal(t, name, outputstore.Name("res", "step", []byte("output")))
+	assert.NotEqual(t, name, outputstore.Name("res", "step", []byte("other output")))
+	assert.NotEqual(t, name, outputstore.Name("res", "other", []byte("output")))
+	assert.NotEqual(t, name, outputstore.Name("other", "step", []byte("output")))
+
+	require.NoError(t, outputstore.Put(ctx, name, []byte("output")))
+	data, err := outputstore.Get(ctx, name)
+	require.NoError(t, err)
+	assert.Equal(t, "output", string(data))
+
+	require.NoError(t, outputstore.Delete(ctx))
+	require.NoError(t, outputstore.Delete(ctx, name, outputstore.Name("res", "other", []byte("output"))))
+	_, err = outputstore.Get(ctx, name)
+	assert.Error(t, err)
+}
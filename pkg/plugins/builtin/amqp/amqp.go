@@ -0,0 +1,283 @@
+package pluginamqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the amqp plugin publishes a message to an AMQP 0-9-1 broker, such as RabbitMQ,
+// waiting for the broker to confirm it
+var (
+	Plugin = taskplugin.New("amqp", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithIdempotencyKey(execWithIdempotencyKey),
+		taskplugin.WithResources(resourcesamqp),
+	)
+)
+
+// TimeoutDefault bounds the time spent connecting to the broker and waiting for its confirmation,
+// when no timeout is configured
+const TimeoutDefault = "10s"
+
+// delivery modes of a message
+const (
+	DeliveryModePersistent = "persistent"
+	DeliveryModeTransient  = "transient"
+)
+
+// Config describes the message to publish
+// credentials:   key to retrieve the AMQP URL of the broker from configstore
+// exchange:      the exchange to publish to (optional, defaults to the default exchange)
+// routing_key:   the routing key of the message
+// body:          the body of the message
+// content_type:  the MIME type of the body (optional)
+// headers:       headers of the message (optional)
+// delivery_mode: persistent or transient (optional, defaults to persistent)
+// timeout:       timeout of the publication (optional, defaults to 10s)
+type Config struct {
+	Credentials  string            `json:"credentials"`
+	Exchange     string            `json:"exchange,omitempty"`
+	RoutingKey   string            `json:"routing_key"`
+	Body         string            `json:"body"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	DeliveryMode string            `json:"delivery_mode,omitempty"`
+	Timeout      string            `json:"timeout,omitempty"`
+}
+
+// brokerConfig holds the url of a broker, with the credentials to connect to it
+type brokerConfig struct {
+	URL string `json:"url"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Credentials == "" {
+		return errors.New("missing credentials")
+	}
+	if cfg.Exchange == "" && cfg.RoutingKey == "" {
+		return errors.New("missing routing_key, mandatory when publishing to the default exchange")
+	}
+
+	// templated fields are checked at runtime
+	if cfg.DeliveryMode != "" && !strings.Contains(cfg.DeliveryMode, "{{") {
+		if _, err := deliveryMode(cfg.DeliveryMode); err != nil {
+			return err
+		}
+	}
+	if cfg.Timeout != "" && !strings.Contains(cfg.Timeout, "{{") {
+		if d, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return errors.Annotate(err, "invalid timeout")
+		} else if d <= 0 {
+			return errors.Errorf("invalid timeout %q: must be positive", cfg.Timeout)
+		}
+	}
+	for name := range cfg.Headers {
+		if name == "" {
+			return errors.New("missing header name")
+		}
+	}
+
+	if !strings.Contains(cfg.Credentials, "{{") {
+		if _, err := loadBrokerConfig(cfg.Credentials); err != nil {
+			return err
+		}
+	} else {
+		v := values.NewValues()
+		if _, err := v.Apply(cfg.Credentials, nil, ""); err != nil {
+			return fmt.Errorf("failed to parse credentials template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func resourcesamqp(i interface{}) []string {
+	cfg := i.(*Config)
+	resources := []string{
+		"socket",
+	}
+
+	broker, err := loadBrokerConfig(cfg.Credentials)
+	if err != nil {
+		return resources
+	}
+	if uri, err := amqp.ParseURI(broker.URL); err == nil {
+		resources = append(resources, "url:"+uri.Host)
+	}
+	return resources
+}
+
+// loadBrokerConfig reads the url of the broker from configstore,
+// either as a JSON object or as a plain AMQP URL
+func loadBrokerConfig(credentials string) (*brokerConfig, error) {
+	str, err := configstore.GetItemValue(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve credentials from configstore: %s", err)
+	}
+
+	var broker brokerConfig
+	if strings.HasPrefix(strings.TrimSpace(str), "{") {
+		if err := json.Unmarshal([]byte(str), &broker); err != nil {
+			return nil, fmt.Errorf("can't unmarshal amqp credentials from configstore: %s", err)
+		}
+	} else {
+		broker.URL = strings.TrimSpace(str)
+	}
+	if broker.URL == "" {
+		return nil, errors.New("missing url in amqp credentials")
+	}
+	if _, err := amqp.ParseURI(broker.URL); err != nil {
+		return nil, fmt.Errorf("invalid url in amqp credentials: %s", err)
+	}
+	return &broker, nil
+}
+
+func deliveryMode(mode string) (uint8, error) {
+	switch mode {
+	case "", DeliveryModePersistent:
+		return amqp.Persistent, nil
+	case DeliveryModeTransient:
+		return amqp.Transient, nil
+	default:
+		return 0, errors.NotValidf("delivery_mode %q, expected %s or %s", mode, DeliveryModePersistent, DeliveryModeTransient)
+	}
+}
+
+// publishing builds the message described by the configuration,
+// identified by the idempotency key of the step when it's known
+func publishing(cfg *Config, idempotencyKey string) (amqp.Publishing, error) {
+	mode, err := deliveryMode(cfg.DeliveryMode)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  cfg.ContentType,
+		DeliveryMode: mode,
+		MessageId:    idempotencyKey,
+		Timestamp:    time.Now(),
+		Body:         []byte(cfg.Body),
+	}
+	if len(cfg.Headers) > 0 {
+		msg.Headers = amqp.Table{}
+		for name, value := range cfg.Headers {
+			msg.Headers[name] = value
+		}
+	}
+	return msg, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	return execWithIdempotencyKey(stepName, config, ctx, "")
+}
+
+// execWithIdempotencyKey publishes the message, with the idempotency key of the step as its message id,
+// letting consumers discard the duplicates published by a retried step
+func execWithIdempotencyKey(stepName string, config interface{}, ctx interface{}, idempotencyKey string) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	broker, err := loadBrokerConfig(cfg.Credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := publishing(cfg, idempotencyKey)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid message")
+	}
+
+	timeout := cfg.Timeout
+	if timeout == "" {
+		timeout = TimeoutDefault
+	}
+	td, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid timeout")
+	}
+
+	return publish(broker, cfg, msg, td)
+}
+
+func publish(broker *brokerConfig, cfg *Config, msg amqp.Publishing, timeout time.Duration) (interface{}, interface{}, error) {
+	conn, err := amqp.DialConfig(broker.URL, amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, timeout)
+		},
+	})
+	if err != nil {
+		return nil, nil, amqpError(err, "failed to connect to amqp broker")
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, amqpError(err, "failed to open amqp channel")
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return nil, nil, amqpError(err, "failed to enable publisher confirms")
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, cfg.Exchange, cfg.RoutingKey, false, false, msg)
+	if err != nil {
+		return nil, nil, amqpError(err, "failed to publish message")
+	}
+	confirmed, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no confirmation received from amqp broker: %s", err)
+	}
+
+	output := map[string]interface{}{
+		"exchange":    cfg.Exchange,
+		"routing_key": cfg.RoutingKey,
+		"message_id":  msg.MessageId,
+	}
+	metadata := map[string]interface{}{
+		"confirmed":    confirmed,
+		"delivery_tag": confirmation.DeliveryTag,
+	}
+	if !confirmed {
+		// the channel is closed when the broker refuses the message, e.g. for a missing exchange
+		select {
+		case amqpErr := <-closed:
+			if amqpErr != nil {
+				return output, metadata, amqpError(amqpErr, "message refused by amqp broker")
+			}
+		default:
+		}
+		return output, metadata, errors.New("message not confirmed by amqp broker")
+	}
+	return output, metadata, nil
+}
+
+// amqpError wraps an error, as a client error when the broker refused the request:
+// missing exchange, access refused or invalid frame won't get any better when retried
+func amqpError(err error, message string) error {
+	wrapped := fmt.Errorf("%s: %s", message, err)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		switch amqpErr.Code {
+		case amqp.NotFound, amqp.AccessRefused, amqp.NotAllowed, amqp.PreconditionFailed, amqp.SyntaxError, amqp.CommandInvalid:
+			return errors.NewBadRequest(wrapped, "")
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,81 @@
+package pluginamqp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Credentials: "{{.input.broker}}", Exchange: "events", RoutingKey: "server.created", Body: `{"id":"{{.input.id}}"}`}, true},
+		{Config{Credentials: "{{.input.broker}}", RoutingKey: "jobs", Body: "hello", DeliveryMode: "transient", Timeout: "2s"}, true},
+		{Config{Credentials: "{{.input.broker}}", Exchange: "fanout", Body: "hello", DeliveryMode: "{{.input.mode}}"}, true},
+		{Config{Credentials: "", Exchange: "events", RoutingKey: "a"}, false},
+		{Config{Credentials: "{{.input.broker}}", Body: "no routing key for the default exchange"}, false},
+		{Config{Credentials: "{{.input.broker}}", Exchange: "events", DeliveryMode: "durable"}, false},
+		{Config{Credentials: "{{.input.broker}}", Exchange: "events", Timeout: "0s"}, false},
+		{Config{Credentials: "{{.input.broker}}", Exchange: "events", Headers: map[string]string{"": "value"}}, false},
+		{Config{Credentials: "not-in-configstore", Exchange: "events"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_publishing(t *testing.T) {
+	msg, err := publishing(&Config{
+		Body:        `{"id":42}`,
+		ContentType: "application/json",
+		Headers:     map[string]string{"x-origin": "utask"},
+	}, "key")
+	require.NoError(t, err)
+	assert.Equal(t, amqp.Persistent, msg.DeliveryMode)
+	assert.Equal(t, "key", msg.MessageId)
+	assert.Equal(t, "application/json", msg.ContentType)
+	assert.Equal(t, amqp.Table{"x-origin": "utask"}, msg.Headers)
+	assert.Equal(t, []byte(`{"id":42}`), msg.Body)
+
+	msg, err = publishing(&Config{DeliveryMode: DeliveryModeTransient}, "")
+	require.NoError(t, err)
+	assert.Equal(t, amqp.Transient, msg.DeliveryMode)
+	assert.Nil(t, msg.Headers)
+
+	_, err = publishing(&Config{DeliveryMode: "durable"}, "")
+	assert.True(t, errors.IsNotValid(err))
+}
+
+func Test_amqpError(t *testing.T) {
+	err := amqpError(&amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange 'events'"}, "message refused by amqp broker")
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Contains(t, err.Error(), "no exchange 'events'")
+
+	err = amqpError(&amqp.Error{Code: amqp.ConnectionForced, Reason: "shutdown"}, "failed to publish message")
+	assert.False(t, errors.IsBadRequest(err))
+}
+
+func Test_publishUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	_, _, err = publish(&brokerConfig{URL: "amqp://guest:guest@" + addr + "/"}, &Config{RoutingKey: "jobs"}, amqp.Publishing{}, time.Second)
+	require.Error(t, err)
+	assert.False(t, errors.IsBadRequest(err), "an unreachable broker should be retried")
+}
@@ -22,6 +22,7 @@ var (
 		taskplugin.WithConfig(validConfig, APIOVHConfig{}),
 		taskplugin.WithExecutorMetadata(ExecutorMetadata),
 		taskplugin.WithResources(resourcesapiovh),
+		taskplugin.WithIdempotencyKey(execWithIdempotencyKey),
 	)
 )
 
@@ -37,6 +38,8 @@ type APIOVHConfig struct {
 	Body        string `json:"body,omitempty"`
 }
 
+const httpIdempotencyKeyHeader = "Idempotency-Key"
+
 // ovhConfig holds the credentials needed to instantiate
 // an OVH API client
 type ovhConfig struct {
@@ -112,6 +115,13 @@ func resourcesapiovh(i interface{}) []string {
 }
 
 func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	return execWithIdempotencyKey(stepName, config, ctx, "")
+}
+
+// execWithIdempotencyKey performs the API call, sending the idempotency key of the step
+// along with POST requests, for the API to deduplicate the calls of a retried step.
+// The header is not part of the request signature
+func execWithIdempotencyKey(stepName string, config interface{}, ctx interface{}, idempotencyKey string) (interface{}, interface{}, error) {
 	cfg := config.(*APIOVHConfig)
 
 	ovhCfgStr, err := configstore.GetItemValue(cfg.Credentials)
@@ -132,6 +142,10 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't create new OVH client: %s", err)
 	}
+	cli.Client.Transport, err = httputil.GetTransport()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to craft a new http transport: %s", err)
+	}
 
 	var body interface{}
 	if cfg.Body != "" {
@@ -145,6 +159,9 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't create new request: %s", err)
 	}
+	if idempotencyKey != "" && cfg.Method == "POST" {
+		req.Header.Set(httpIdempotencyKeyHeader, idempotencyKey)
+	}
 
 	resp, err := cli.Do(req)
 	if err != nil {
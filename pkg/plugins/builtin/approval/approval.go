@@ -0,0 +1,66 @@
+package pluginapproval
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the approval plugin holds a resolution until a resolution manager
+// approves or rejects the step through the API
+var (
+	Plugin = taskplugin.New("approval", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithDryRun(dryRun),
+	)
+)
+
+// Config is the configuration of an approval step
+// message: what is to be approved, shown to the approvers (optional)
+type Config struct {
+	Message string `json:"message,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	return nil
+}
+
+// exec never completes the step by itself: the step stays WAITING until a decision
+// is recorded on it through the API (/resolution/:id/step/:stepName/approve or reject)
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	output := map[string]interface{}{
+		"message": cfg.Message,
+	}
+	return output, nil, errors.NewNotAssigned(fmt.Errorf("step is waiting for approval"), "")
+}
+
+func dryRun(stepName string, config interface{}, ctx interface{}) (interface{}, error) {
+	cfg := config.(*Config)
+	return map[string]interface{}{
+		"message": cfg.Message,
+		"waiting": "the resolution will be blocked until a resolution manager approves or rejects the step",
+	}, nil
+}
+
+// Output builds the output of an approval step, once a decision was made on it
+func Output(approved bool, username, reason string, date time.Time) map[string]interface{} {
+	output := map[string]interface{}{
+		"approved": approved,
+		"username": username,
+		"date":     date,
+	}
+	if reason != "" {
+		output["reason"] = reason
+	}
+	return output
+}
+
+// RejectionError is the error of a rejected approval step
+func RejectionError(username, reason string) string {
+	return fmt.Sprintf("rejected by %s: %s", username, reason)
+}
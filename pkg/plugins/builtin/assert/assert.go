@@ -0,0 +1,69 @@
+package pluginassert
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the assert plugin fails a step when a condition isn't met
+// allowing to guard the execution of a task between steps
+var (
+	Plugin = taskplugin.New("assert", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+	)
+)
+
+// DefaultMessage is the error message of a failed assertion, when none is configured
+const DefaultMessage = "assertion failed"
+
+// Config describes the assertion to check
+// expression: a boolean, usually obtained through templating
+// message:    the error message of a failed assertion (optional)
+type Config struct {
+	Expression string `json:"expression"`
+	Message    string `json:"message,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+	if strings.TrimSpace(cfg.Expression) == "" {
+		return errors.New("missing expression")
+	}
+	// templated expressions are evaluated at runtime
+	if !strings.Contains(cfg.Expression, "{{") {
+		if _, err := parseExpression(cfg.Expression); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseExpression(expr string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(expr))
+	if err != nil {
+		return false, errors.Errorf("expression should evaluate to a boolean, got %q", expr)
+	}
+	return b, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	ok, err := parseExpression(cfg.Expression)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid assertion")
+	}
+	if !ok {
+		message := cfg.Message
+		if message == "" {
+			message = DefaultMessage
+		}
+		return nil, nil, errors.NewBadRequest(nil, message)
+	}
+
+	return map[string]interface{}{"result": true}, nil, nil
+}
@@ -0,0 +1,47 @@
+package pluginassert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		valid      bool
+	}{
+		{"true", true},
+		{"{{ eq .input.foo `bar` }}", true},
+		{"", false},
+		{"maybe", false},
+	} {
+		cfgJSON, err := json.Marshal(Config{Expression: tc.expression})
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, tc.expression)
+		} else {
+			assert.Error(t, err, tc.expression)
+		}
+	}
+}
+
+func Test_exec(t *testing.T) {
+	output, _, err := exec("test", &Config{Expression: " true\n"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"result": true}, output)
+
+	_, _, err = exec("test", &Config{Expression: "false", Message: "foo should be bar"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+	assert.EqualError(t, err, "foo should be bar")
+
+	_, _, err = exec("test", &Config{Expression: "false"}, nil)
+	assert.EqualError(t, err, DefaultMessage)
+
+	_, _, err = exec("test", &Config{Expression: "<no value>"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+}
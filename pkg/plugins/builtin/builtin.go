@@ -3,18 +3,30 @@ package builtin
 import (
 	"github.com/cneill/utask/engine/step"
 	"github.com/cneill/utask/pkg/plugins"
+	pluginamqp "github.com/cneill/utask/pkg/plugins/builtin/amqp"
 	pluginapiovh "github.com/cneill/utask/pkg/plugins/builtin/apiovh"
+	pluginapproval "github.com/cneill/utask/pkg/plugins/builtin/approval"
+	pluginassert "github.com/cneill/utask/pkg/plugins/builtin/assert"
 	pluginbatch "github.com/cneill/utask/pkg/plugins/builtin/batch"
 	plugincallback "github.com/cneill/utask/pkg/plugins/builtin/callback"
+	plugincrypto "github.com/cneill/utask/pkg/plugins/builtin/crypto"
+	plugindns "github.com/cneill/utask/pkg/plugins/builtin/dns"
 	pluginecho "github.com/cneill/utask/pkg/plugins/builtin/echo"
 	pluginemail "github.com/cneill/utask/pkg/plugins/builtin/email"
+	plugingraphql "github.com/cneill/utask/pkg/plugins/builtin/graphql"
 	pluginhttp "github.com/cneill/utask/pkg/plugins/builtin/http"
+	pluginjwt "github.com/cneill/utask/pkg/plugins/builtin/jwt"
+	pluginldap "github.com/cneill/utask/pkg/plugins/builtin/ldap"
 	pluginnotify "github.com/cneill/utask/pkg/plugins/builtin/notify"
 	pluginping "github.com/cneill/utask/pkg/plugins/builtin/ping"
+	pluginpoll "github.com/cneill/utask/pkg/plugins/builtin/poll"
+	pluginprometheus "github.com/cneill/utask/pkg/plugins/builtin/prometheus"
 	pluginscript "github.com/cneill/utask/pkg/plugins/builtin/script"
 	pluginssh "github.com/cneill/utask/pkg/plugins/builtin/ssh"
+	pluginstatsd "github.com/cneill/utask/pkg/plugins/builtin/statsd"
 	pluginsubtask "github.com/cneill/utask/pkg/plugins/builtin/subtask"
 	plugintag "github.com/cneill/utask/pkg/plugins/builtin/tag"
+	pluginutask "github.com/cneill/utask/pkg/plugins/builtin/utask"
 	"github.com/cneill/utask/pkg/plugins/taskplugin"
 )
 
@@ -45,6 +57,18 @@ func Register() error {
 		plugintag.Plugin,
 		plugincallback.Plugin,
 		pluginbatch.Plugin,
+		pluginassert.Plugin,
+		pluginapproval.Plugin,
+		pluginstatsd.Plugin,
+		pluginprometheus.Plugin,
+		pluginldap.Plugin,
+		plugindns.Plugin,
+		pluginjwt.Plugin,
+		plugincrypto.Plugin,
+		pluginutask.Plugin,
+		plugingraphql.Plugin,
+		pluginamqp.Plugin,
+		pluginpoll.Plugin,
 	} {
 		if err := step.RegisterRunner(p.PluginName(), p); err != nil {
 			return err
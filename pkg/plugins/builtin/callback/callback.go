@@ -1,13 +1,18 @@
 package plugincallback
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/ovh/configstore"
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/jsonschema"
+	"github.com/cneill/utask/pkg/now"
 	"github.com/cneill/utask/pkg/plugins/taskplugin"
 )
 
@@ -18,10 +23,30 @@ var (
 	)
 )
 
+// possible behaviours of a "wait" step when no callback was received within its timeout
+const (
+	OnTimeoutFail     = "fail"
+	OnTimeoutContinue = "continue"
+)
+
 type CallbackStepConfig struct {
-	Action     string `json:"action"`
-	BodySchema string `json:"schema,omitempty"`
-	ID         string `json:"id"`
+	Action          string `json:"action"`
+	BodySchema      string `json:"schema,omitempty"`
+	SignatureSecret string `json:"signature_secret,omitempty"`
+	ID              string `json:"id"`
+	Timeout         string `json:"timeout,omitempty"`
+	OnTimeout       string `json:"on_timeout,omitempty"`
+}
+
+// CallbackWaitMetadata is returned while a "wait" step with a timeout is waiting for its callback
+// it lets the engine schedule a new run of the resolution when the deadline is reached
+type CallbackWaitMetadata struct {
+	Deadline time.Time `json:"deadline"`
+}
+
+// WaitDeadline returns the point in time when the wait step times out
+func (m *CallbackWaitMetadata) WaitDeadline() time.Time {
+	return m.Deadline
 }
 
 type CallbackContext struct {
@@ -43,12 +68,38 @@ func validConfig(config interface{}) error {
 
 	switch strings.ToLower(cfg.Action) {
 	case "create":
+		// templated schemas are validated on execution
+		if cfg.BodySchema != "" && !strings.Contains(cfg.BodySchema, "{{") {
+			if _, err := jsonschema.NormalizeAndCompile("schema", json.RawMessage(cfg.BodySchema)); err != nil {
+				return fmt.Errorf("invalid %q parameter: %s", "schema", err)
+			}
+		}
+		if cfg.SignatureSecret != "" && !strings.Contains(cfg.SignatureSecret, "{{") {
+			if _, err := configstore.GetItemValue(cfg.SignatureSecret); err != nil {
+				return fmt.Errorf("can't retrieve signature secret from configstore: %s", err)
+			}
+		}
 		return nil
 
 	case "wait":
 		if cfg.ID == "" {
 			return fmt.Errorf("missing %q parameter", "id")
 		}
+		if cfg.Timeout != "" {
+			// templated timeouts are validated on execution
+			if !strings.Contains(cfg.Timeout, "{{") {
+				if _, err := parseTimeout(cfg.Timeout); err != nil {
+					return err
+				}
+			}
+		} else if cfg.OnTimeout != "" {
+			return fmt.Errorf("%q parameter requires %q", "on_timeout", "timeout")
+		}
+		switch strings.ToLower(cfg.OnTimeout) {
+		case "", OnTimeoutFail, OnTimeoutContinue:
+		default:
+			return fmt.Errorf("invalid on_timeout %q: expected %q or %q", cfg.OnTimeout, OnTimeoutFail, OnTimeoutContinue)
+		}
 		return nil
 
 	default:
@@ -72,7 +123,7 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 
 	switch strings.ToLower(cfg.Action) {
 	case "create":
-		cb, err := createCallback(dbp, task, stepContext, cfg.BodySchema)
+		cb, err := createCallback(dbp, task, stepContext, cfg.BodySchema, cfg.SignatureSecret)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -90,19 +141,58 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 			return nil, nil, err
 		}
 
-		if cb.Called == nil {
-			return nil, nil, errors.NewNotAssigned(fmt.Errorf("task is waiting for a callback"), "")
-		}
+		return wait(cb, cfg, now.Get())
+
+	default:
+		return nil, nil, errors.BadRequestf("invalid action %q", cfg.Action)
+	}
+}
+
+// wait returns the output of a callback which has been called,
+// or the outcome of a callback still expected at a given point in time
+func wait(cb *callback, cfg *CallbackStepConfig, at time.Time) (interface{}, interface{}, error) {
+	if cb.Called != nil {
+		return map[string]interface{}{
+			"id":        cb.PublicID,
+			"date":      cb.Called,
+			"body":      cb.Body,
+			"timed_out": false,
+		}, nil, nil
+	}
+
+	if cfg.Timeout == "" {
+		return nil, nil, errors.NewNotAssigned(fmt.Errorf("task is waiting for a callback"), "")
+	}
 
+	timeout, err := parseTimeout(cfg.Timeout)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "")
+	}
+
+	deadline := cb.Created.Add(timeout)
+	if at.Before(deadline) {
+		return nil, &CallbackWaitMetadata{Deadline: deadline}, errors.NewNotAssigned(fmt.Errorf("task is waiting for a callback until %s", deadline.Format(time.RFC3339)), "")
+	}
+
+	if strings.ToLower(cfg.OnTimeout) == OnTimeoutContinue {
 		return map[string]interface{}{
-			"id":   cb.PublicID,
-			"date": cb.Called,
-			"body": cb.Body,
+			"id":        cb.PublicID,
+			"timed_out": true,
 		}, nil, nil
+	}
 
-	default:
-		return nil, nil, errors.BadRequestf("invalid action %q", cfg.Action)
+	return nil, nil, errors.BadRequestf("no callback received within %s", timeout)
+}
+
+func parseTimeout(s string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %s", s, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must be positive", s)
 	}
+	return timeout, nil
 }
 
 func buildUrl(cb *callback) string {
@@ -1,10 +1,15 @@
 package plugincallback
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/juju/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,6 +28,12 @@ func Test_validConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
 
+	// create step - invalid JSON schema
+	cfg.BodySchema = `{"type": "foo"}`
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
 	// wait step - invalid missing id
 	cfg = CallbackStepConfig{
 		Action: "wait",
@@ -37,6 +48,39 @@ func Test_validConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
 
+	// wait step - valid with timeout
+	cfg.Timeout = "1h"
+	cfg.OnTimeout = "continue"
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
+	// wait step - valid with templated timeout
+	cfg.Timeout = "{{.input.timeout}}"
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
+	// wait step - invalid timeout
+	cfg.Timeout = "forever"
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
+	// wait step - invalid on_timeout
+	cfg.Timeout = "1h"
+	cfg.OnTimeout = "foo"
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
+	// wait step - on_timeout without timeout
+	cfg.Timeout = ""
+	cfg.OnTimeout = "fail"
+	cfgJSON, err = json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
 	// unknown action
 	cfg = CallbackStepConfig{
 		Action: "foo",
@@ -46,6 +90,61 @@ func Test_validConfig(t *testing.T) {
 	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)), "invalid action \"foo\"")
 }
 
+func Test_wait(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := &callback{PublicID: "foobar", Created: created}
+
+	// no timeout: wait forever
+	output, metadata, err := wait(cb, &CallbackStepConfig{}, created.Add(24*time.Hour))
+	assert.True(t, errors.IsNotAssigned(err))
+	assert.Nil(t, output)
+	assert.Nil(t, metadata)
+
+	// before the deadline: wait, and expose the deadline
+	cfg := &CallbackStepConfig{Timeout: "1h"}
+	_, metadata, err = wait(cb, cfg, created.Add(time.Minute))
+	assert.True(t, errors.IsNotAssigned(err))
+	if assert.IsType(t, &CallbackWaitMetadata{}, metadata) {
+		assert.Equal(t, created.Add(time.Hour), metadata.(*CallbackWaitMetadata).WaitDeadline())
+	}
+
+	// after the deadline: fail by default
+	_, _, err = wait(cb, cfg, created.Add(2*time.Hour))
+	assert.True(t, errors.IsBadRequest(err))
+
+	// after the deadline: continue
+	cfg.OnTimeout = OnTimeoutContinue
+	output, _, err = wait(cb, cfg, created.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "foobar", "timed_out": true}, output)
+
+	// called after the deadline, before the resolution was run again
+	called := created.Add(90 * time.Minute)
+	cb.Called = &called
+	output, _, err = wait(cb, cfg, created.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, false, output.(map[string]interface{})["timed_out"])
+}
+
+func Test_verifySignature(t *testing.T) {
+	body := []byte(`{"success": true}`)
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	assert.NoError(t, verifySignature("s3cr3t", body, signature))
+	assert.NoError(t, verifySignature("s3cr3t", body, "sha256="+signature))
+
+	for _, err := range []error{
+		verifySignature("s3cr3t", body, ""),
+		verifySignature("s3cr3t", body, "not-hex"),
+		verifySignature("other", body, signature),
+		verifySignature("s3cr3t", []byte(`{"success": false}`), signature),
+	} {
+		assert.True(t, errors.IsUnauthorized(err), "%v", err)
+	}
+}
+
 func Test_buildUrl(t *testing.T) {
 	cb := &callback{
 		ID:       42,
@@ -1,12 +1,22 @@
 package plugincallback
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
 	"github.com/loopfz/gadgeto/zesty"
+	"github.com/ovh/configstore"
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/engine"
 	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/pkg/correlation"
 	"github.com/cneill/utask/pkg/jsonschema"
 	"github.com/cneill/utask/pkg/metadata"
 	"github.com/sirupsen/logrus"
@@ -16,6 +26,12 @@ const (
 	CallbackID     = "callback_id"
 	CallbackSecret = "callback_secret"
 	CallbackBody   = "callback_body"
+
+	// SignatureHeader holds the hex-encoded HMAC-SHA256 of the body of a signed call,
+	// optionally prefixed with "sha256="
+	SignatureHeader = "X-Signature"
+
+	rawBodyKey = "callback_raw_body"
 )
 
 type handleCallbackIn struct {
@@ -28,6 +44,48 @@ type handleCallbackOut struct {
 	Message string `json:"message"`
 }
 
+// keepRawBody keeps a copy of the request body, for its signature to be verified
+// once the body has been consumed by the binding of the handler
+// the body is read up to the max body bytes of the route, as it would be by the binding
+func keepRawBody(maxBodyBytes func(route string) int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes(c.FullPath()))
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				_ = c.AbortWithError(http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Set(rawBodyKey, body)
+		c.Next()
+	}
+}
+
+// verifySignature asserts that a signature is the HMAC-SHA256 of a body, using a given secret
+func verifySignature(secret string, body []byte, signature string) error {
+	if signature == "" {
+		return errors.Unauthorizedf("missing %s header", SignatureHeader)
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return errors.Unauthorizedf("invalid signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.Unauthorizedf("invalid signature")
+	}
+
+	return nil
+}
+
 func HandleCallback(c *gin.Context, in *handleCallbackIn) (res *handleCallbackOut, err error) {
 	metadata.AddActionMetadata(c, CallbackID, in.CallbackID)
 	metadata.AddActionMetadata(c, CallbackSecret, in.CallbackSecret)
@@ -53,6 +111,20 @@ func HandleCallback(c *gin.Context, in *handleCallbackIn) (res *handleCallbackOu
 		return nil, errors.NotFoundf("failed to load callback from public id: callback")
 	}
 
+	if cb.SignatureSecret != "" {
+		secret, err := configstore.GetItemValue(cb.SignatureSecret)
+		if err != nil {
+			dbp.Rollback()
+			return nil, errors.Annotate(err, "can't retrieve signature secret from configstore")
+		}
+		rawBody, _ := c.Get(rawBodyKey)
+		body, _ := rawBody.([]byte)
+		if err := verifySignature(secret, body, c.GetHeader(SignatureHeader)); err != nil {
+			dbp.Rollback()
+			return nil, err
+		}
+	}
+
 	if cb.Called != nil {
 		dbp.Rollback()
 		return nil, errors.BadRequestf("callback has already been resolved")
@@ -81,7 +153,7 @@ func HandleCallback(c *gin.Context, in *handleCallbackIn) (res *handleCallbackOu
 		vc := jsonschema.Validator(in.CallbackID, s)
 		if err := vc(in.Body); err != nil {
 			dbp.Rollback()
-			return nil, errors.BadRequestf("unable to validate body: %s", err)
+			return nil, errors.BadRequestf("unable to validate body: %s", strings.Join(jsonschema.ValidationDetails(err), "; "))
 		}
 	}
 
@@ -95,11 +167,11 @@ func HandleCallback(c *gin.Context, in *handleCallbackIn) (res *handleCallbackOu
 		return nil, err
 	}
 
-	logrus.Debugf("resuming task %q resolution %q", t.PublicID, *t.Resolution)
-	logrus.WithFields(logrus.Fields{"task_id": t.PublicID, "resolution_id": *t.Resolution}).Debugf("resuming resolution %q as callback %q has been called", *t.Resolution, cb.PublicID)
+	correlation.Logger(c.Request.Context()).Debugf("resuming task %q resolution %q", t.PublicID, *t.Resolution)
+	correlation.Logger(c.Request.Context()).WithFields(logrus.Fields{"task_id": t.PublicID, "resolution_id": *t.Resolution}).Debugf("resuming resolution %q as callback %q has been called", *t.Resolution, cb.PublicID)
 
 	// We ignore the potential error because the caller don't care about it
-	_ = engine.GetEngine().Resolve(*t.Resolution, nil)
+	_ = engine.GetEngine().ResolveWithContext(c.Request.Context(), *t.Resolution, nil)
 
 	res = &handleCallbackOut{
 		Message: "The callback has been resolved",
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -246,7 +248,7 @@ func TestHandleCallback(t *testing.T) {
 		Checkers(
 			//iffy.DumpResponse(t),
 			iffy.ExpectStatus(400),
-			iffy.ExpectJSONFields("error"),
+			iffy.ExpectJSONBranch("error", "unable to validate body: /success: expected boolean, but got string"),
 		)
 
 	tester.AddCall("resolveCallback", http.MethodPost, "/unsecured/callback/{{.getResolution.steps.createCb.output.id}}?t={{.getResolution.steps.createCb.output.token}}", `{"success": true}`).
@@ -276,3 +278,26 @@ func TestHandleCallback(t *testing.T) {
 
 	tester.Run()
 }
+
+func TestKeepRawBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/callback/:id", keepRawBody(func(route string) int64 {
+		assert.Equal(t, "/callback/:id", route)
+		return 16
+	}), func(c *gin.Context) {
+		raw, _ := c.Get(rawBodyKey)
+		c.String(http.StatusOK, "%s", raw)
+	})
+
+	// the raw body is kept for the handler, within the limit of the route
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/callback/foo", strings.NewReader(`{"success":true}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"success":true}`, w.Body.String())
+
+	// a bigger body is rejected before being read entirely
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/callback/foo", strings.NewReader(`{"success":false}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
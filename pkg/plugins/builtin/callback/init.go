@@ -60,6 +60,7 @@ func (ci *CallbackInit) Init(s *plugins.Service) error {
 					fizz.Description("This action updates a waiting callback to resolves it."),
 				},
 				Handlers: []gin.HandlerFunc{
+					keepRawBody(s.Server.MaxBodyBytes),
 					tonic.Handler(HandleCallback, 200),
 				},
 				Maintenance: true,
@@ -34,9 +34,10 @@ type callback struct {
 	Secret           string          `json:"-" db:"-"`
 	Body             json.RawMessage `json:"body" db:"-"`
 	Schema           json.RawMessage `json:"schema" db:"-"`
+	SignatureSecret  string          `json:"-" db:"signature_secret"` // configstore item holding the HMAC secret of the calls
 }
 
-func createCallback(dbp zesty.DBProvider, task *task.Task, ctx *CallbackContext, schemaJSON string) (cb *callback, err error) {
+func createCallback(dbp zesty.DBProvider, task *task.Task, ctx *CallbackContext, schemaJSON, signatureSecret string) (cb *callback, err error) {
 	defer errors.DeferredAnnotatef(&err, "Failed to create callback")
 
 	resolution, err := resolution.LoadFromPublicID(dbp, *task.Resolution)
@@ -52,6 +53,7 @@ func createCallback(dbp zesty.DBProvider, task *task.Task, ctx *CallbackContext,
 		Updated:          now.Get(),
 		ResolverUsername: ctx.RequesterUsername,
 		Secret:           uuid.Must(uuid.NewV4()).String(),
+		SignatureSecret:  signatureSecret,
 	}
 
 	if schemaJSON != "" {
@@ -278,7 +280,7 @@ func RotateEncryptionKeys(dbp zesty.DBProvider) (err error) {
 }
 
 var rSelector = sqlgenerator.PGsql.Select(
-	`"callback".id, "callback".public_id, "callback".id_task, "callback".id_resolution, "callback".resolver_username, "callback".created, "callback".updated, "callback".called, "callback".encrypted_schema, "callback".encrypted_body, "callback".encrypted_secret`,
+	`"callback".id, "callback".public_id, "callback".id_task, "callback".id_resolution, "callback".resolver_username, "callback".created, "callback".updated, "callback".called, "callback".encrypted_schema, "callback".encrypted_body, "callback".encrypted_secret, "callback".signature_secret`,
 ).From(
 	`"callback"`,
 ).OrderBy(
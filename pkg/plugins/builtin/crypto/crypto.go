@@ -0,0 +1,150 @@
+package plugincrypto
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/ovh/symmecrypt"
+	"github.com/ovh/symmecrypt/ciphers/aesgcm"
+	"github.com/ovh/symmecrypt/keyloader"
+
+	"github.com/cneill/utask/models"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the crypto plugin encrypts and decrypts payloads with AES-GCM
+// its keys are managed as the storage key, through symmecrypt
+var (
+	Plugin = taskplugin.New("crypto", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+	)
+)
+
+// actions supported by the plugin
+const (
+	ActionEncrypt = "encrypt"
+	ActionDecrypt = "decrypt"
+)
+
+// additionalData binds every ciphertext to the plugin,
+// so that a ciphertext produced elsewhere with the same key can't be decrypted by a task
+var additionalData = []byte("utask-plugin-crypto")
+
+// Config describes the payload to encrypt or decrypt
+// action:          encrypt or decrypt
+// key:             identifier of the encryption key in configstore, with the aes-gcm cipher
+// data:            the plaintext to encrypt, or the base64 ciphertext to decrypt
+// associated_data: authenticated along with the payload, the same value is required to decrypt it (optional)
+type Config struct {
+	Action         string `json:"action"`
+	Key            string `json:"key"`
+	Data           string `json:"data"`
+	AssociatedData string `json:"associated_data,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Action != ActionEncrypt && cfg.Action != ActionDecrypt {
+		return errors.Errorf("invalid action %q, expected encrypt or decrypt", cfg.Action)
+	}
+	if cfg.Key == "" {
+		return errors.New("missing key")
+	}
+
+	// templated keys are checked at runtime
+	if !strings.Contains(cfg.Key, "{{") {
+		if err := validKey(cfg.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validKey checks that every version of a key uses the aes-gcm cipher,
+// without requiring sealed keys to be unsealed yet
+func validKey(identifier string) error {
+	if identifier == models.StorageKeyIdentifier {
+		return errors.Errorf("the %q key is reserved to task data storage", identifier)
+	}
+
+	items, err := keyloader.ConfigFilter.Slice(identifier).GetItemList()
+	if err != nil {
+		return errors.Annotate(err, "can't retrieve key from configstore")
+	}
+	if items.Len() == 0 {
+		return errors.NotFoundf("encryption key %q", identifier)
+	}
+	for _, item := range items.Items {
+		i, err := item.Unmarshaled()
+		if err != nil {
+			return errors.Annotatef(err, "invalid encryption key %q", identifier)
+		}
+		if c := i.(*keyloader.KeyConfig).Cipher; c != aesgcm.CipherName {
+			return errors.Errorf("invalid encryption key %q: cipher %q, expected %s", identifier, c, aesgcm.CipherName)
+		}
+	}
+	return nil
+}
+
+func loadKey(identifier string) (symmecrypt.Key, error) {
+	if err := validKey(identifier); err != nil {
+		return nil, errors.NewBadRequest(err, "")
+	}
+	k, err := keyloader.LoadKey(identifier)
+	if err != nil {
+		return nil, errors.Annotate(err, "can't load key")
+	}
+	return k, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	key, err := loadKey(cfg.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch cfg.Action {
+	case ActionEncrypt:
+		ciphertext, err := encrypt(key, cfg.Data, cfg.AssociatedData)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]interface{}{"ciphertext": ciphertext}, nil, nil
+	case ActionDecrypt:
+		plaintext, err := decrypt(key, cfg.Data, cfg.AssociatedData)
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string]interface{}{"plaintext": plaintext}, nil, nil
+	}
+	return nil, nil, errors.BadRequestf("invalid action %q, expected encrypt or decrypt", cfg.Action)
+}
+
+func encrypt(key symmecrypt.Key, plaintext, associatedData string) (string, error) {
+	b, err := key.Encrypt([]byte(plaintext), additionalData, []byte(associatedData))
+	if err != nil {
+		// a sealed key might get unsealed later on
+		return "", errors.Annotate(err, "failed to encrypt")
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func decrypt(key symmecrypt.Key, ciphertext, associatedData string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.NewBadRequest(err, "invalid ciphertext: expected base64")
+	}
+	plaintext, err := key.Decrypt(b, additionalData, []byte(associatedData))
+	if err != nil {
+		if errors.Is(err, keyloader.ErrKeySealed) {
+			return "", errors.Annotate(err, "failed to decrypt")
+		}
+		return "", errors.NewBadRequest(err, "failed to decrypt")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,78 @@
+package plugincrypto
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+	"github.com/ovh/symmecrypt/keyloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	var items []configstore.Item
+	for _, k := range []struct{ cipher, identifier string }{
+		{"aes-gcm", "payloads"},
+		{"aes-gcm", "storage"},
+		{"xchacha20-poly1305", "other"},
+	} {
+		cfg, err := keyloader.GenerateKey(k.cipher, k.identifier, false, time.Now())
+		if err != nil {
+			panic(err)
+		}
+		items = append(items, configstore.NewItem(keyloader.EncryptionKeyConfigName, cfg.String(), 1))
+	}
+	configstore.RegisterProvider("tests", func() (configstore.ItemList, error) {
+		return configstore.ItemList{Items: items}, nil
+	})
+
+	os.Exit(m.Run())
+}
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Action: "encrypt", Key: "payloads", Data: "{{.input.blob}}"}, true},
+		{Config{Action: "decrypt", Key: "{{.input.key}}", Data: "{{.step.encrypt.output.ciphertext}}"}, true},
+		{Config{Action: "sign", Key: "payloads"}, false},
+		{Config{Action: "encrypt", Key: ""}, false},
+		{Config{Action: "encrypt", Key: "missing"}, false},
+		{Config{Action: "encrypt", Key: "storage"}, false},
+		{Config{Action: "encrypt", Key: "other"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_exec(t *testing.T) {
+	output, _, err := exec("encrypt", &Config{Action: "encrypt", Key: "payloads", Data: "s3cr3t payload", AssociatedData: "task-1"}, nil)
+	require.NoError(t, err)
+	ciphertext := output.(map[string]interface{})["ciphertext"].(string)
+	assert.NotContains(t, ciphertext, "s3cr3t")
+
+	output, _, err = exec("decrypt", &Config{Action: "decrypt", Key: "payloads", Data: ciphertext, AssociatedData: "task-1"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t payload", output.(map[string]interface{})["plaintext"])
+
+	_, _, err = exec("decrypt", &Config{Action: "decrypt", Key: "payloads", Data: ciphertext, AssociatedData: "task-2"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+
+	_, _, err = exec("decrypt", &Config{Action: "decrypt", Key: "payloads", Data: "not base64!"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+
+	_, _, err = exec("encrypt", &Config{Action: "encrypt", Key: "storage", Data: "payload"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+}
@@ -0,0 +1,219 @@
+package plugindns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the dns plugin looks up the records of a name
+// optionally expecting a value, to wait for a record to be propagated
+var (
+	Plugin = taskplugin.New("dns", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcesdns),
+	)
+)
+
+// TimeoutDefault is the timeout of a lookup, when none is configured
+const TimeoutDefault = "10s"
+
+// record types supported by the plugin
+const (
+	TypeA     = "A"
+	TypeAAAA  = "AAAA"
+	TypeCNAME = "CNAME"
+	TypeTXT   = "TXT"
+	TypeMX    = "MX"
+)
+
+var recordTypes = map[string]bool{
+	TypeA:     true,
+	TypeAAAA:  true,
+	TypeCNAME: true,
+	TypeTXT:   true,
+	TypeMX:    true,
+}
+
+// Config describes the lookup
+// name:     the name to look up
+// type:     A, AAAA, CNAME, TXT or MX
+// resolver: the host:port of the DNS server to query (optional, defaults to the system's resolver)
+// expect:   a value one of the records must match, failing the step otherwise (optional)
+// timeout:  timeout of the lookup (optional, defaults to 10s)
+type Config struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Resolver string `json:"resolver,omitempty"`
+	Expect   string `json:"expect,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+// Output is the result of a lookup
+type Output struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Records []string `json:"records"`
+}
+
+// resolver is the subset of net.Resolver used by the plugin
+type resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Name == "" {
+		return errors.New("missing name")
+	}
+	if !strings.Contains(cfg.Type, "{{") && !recordTypes[strings.ToUpper(cfg.Type)] {
+		return errors.Errorf("invalid type %q, expected one of A, AAAA, CNAME, TXT, MX", cfg.Type)
+	}
+	if cfg.Resolver != "" && !strings.Contains(cfg.Resolver, "{{") {
+		if _, _, err := net.SplitHostPort(cfg.Resolver); err != nil {
+			return errors.Annotatef(err, "invalid resolver %q, expected host:port", cfg.Resolver)
+		}
+	}
+	if cfg.Timeout != "" && !strings.Contains(cfg.Timeout, "{{") {
+		if _, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return errors.Annotate(err, "invalid timeout")
+		}
+	}
+
+	return nil
+}
+
+func resourcesdns(i interface{}) []string {
+	cfg := i.(*Config)
+	resources := []string{
+		"socket",
+	}
+	if host, _, err := net.SplitHostPort(cfg.Resolver); err == nil {
+		resources = append(resources, "url:"+host)
+	}
+	return resources
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	recordType := strings.ToUpper(cfg.Type)
+	if !recordTypes[recordType] {
+		return nil, nil, errors.BadRequestf("invalid type %q, expected one of A, AAAA, CNAME, TXT, MX", cfg.Type)
+	}
+
+	timeout := cfg.Timeout
+	if timeout == "" {
+		timeout = TimeoutDefault
+	}
+	td, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid timeout")
+	}
+
+	r := net.DefaultResolver
+	if cfg.Resolver != "" {
+		if _, _, err := net.SplitHostPort(cfg.Resolver); err != nil {
+			return nil, nil, errors.NewBadRequest(err, fmt.Sprintf("invalid resolver %q", cfg.Resolver))
+		}
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, cfg.Resolver)
+			},
+		}
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.Background(), td)
+	defer cancel()
+
+	records, err := lookup(lookupCtx, r, recordType, cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output := &Output{
+		Name:    cfg.Name,
+		Type:    recordType,
+		Records: records,
+	}
+
+	if cfg.Expect != "" && !matches(recordType, records, cfg.Expect) {
+		// a plain error: the step is retried until the record is propagated
+		return output, nil, fmt.Errorf("no %s record of %s matches %q, got %v", recordType, cfg.Name, cfg.Expect, records)
+	}
+
+	return output, nil, nil
+}
+
+// lookup returns the records of a name as strings
+// a missing name or record is not an error: no records are returned
+func lookup(ctx context.Context, r resolver, recordType, name string) ([]string, error) {
+	records := []string{}
+	var err error
+
+	switch recordType {
+	case TypeA, TypeAAAA:
+		network := "ip4"
+		if recordType == TypeAAAA {
+			network = "ip6"
+		}
+		var ips []net.IP
+		ips, err = r.LookupIP(ctx, network, name)
+		for _, ip := range ips {
+			records = append(records, ip.String())
+		}
+	case TypeCNAME:
+		var cname string
+		cname, err = r.LookupCNAME(ctx, name)
+		// the canonical name of a name without CNAME record is the name itself
+		if err == nil && normalize(cname) != normalize(name) {
+			records = append(records, cname)
+		}
+	case TypeTXT:
+		var txts []string
+		txts, err = r.LookupTXT(ctx, name)
+		records = append(records, txts...)
+	case TypeMX:
+		var mxs []*net.MX
+		mxs, err = r.LookupMX(ctx, name)
+		for _, mx := range mxs {
+			records = append(records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	}
+
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to look up %s record of %s: %s", recordType, name, err)
+	}
+	return records, nil
+}
+
+// matches tells whether one of the records matches the expected value
+// names are compared regardless of their case and of a trailing dot, TXT records as is
+func matches(recordType string, records []string, expect string) bool {
+	for _, r := range records {
+		if r == expect || (recordType != TypeTXT && normalize(r) == normalize(expect)) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSuffix(s, "."))
+}
@@ -0,0 +1,126 @@
+package plugindns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Name: "example.org", Type: "A"}, true},
+		{Config{Name: "example.org", Type: "mx", Resolver: "1.1.1.1:53"}, true},
+		{Config{Name: "{{.input.fqdn}}", Type: "{{.input.type}}", Resolver: "{{.input.resolver}}", Expect: "{{.input.ip}}", Timeout: "2s"}, true},
+		{Config{Name: "", Type: "A"}, false},
+		{Config{Name: "example.org", Type: "SRV"}, false},
+		{Config{Name: "example.org", Type: "A", Resolver: "1.1.1.1"}, false},
+		{Config{Name: "example.org", Type: "A", Timeout: "soon"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+type fakeResolver struct {
+	ips   map[string][]net.IP
+	cname map[string]string
+	txt   map[string][]string
+	mx    map[string][]*net.MX
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (f *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if host == "broken.example.org" {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+	var ips []net.IP
+	for _, ip := range f.ips[host] {
+		if (network == "ip4") == (ip.To4() != nil) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, notFound(host)
+	}
+	return ips, nil
+}
+
+func (f *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if c, ok := f.cname[host]; ok {
+		return c, nil
+	}
+	return host + ".", nil
+}
+
+func (f *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if t, ok := f.txt[name]; ok {
+		return t, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if m, ok := f.mx[name]; ok {
+		return m, nil
+	}
+	return nil, notFound(name)
+}
+
+func Test_lookup(t *testing.T) {
+	r := &fakeResolver{
+		ips: map[string][]net.IP{
+			"example.org": {net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		},
+		cname: map[string]string{"www.example.org": "example.org."},
+		txt:   map[string][]string{"example.org": {"v=spf1 -all"}},
+		mx:    map[string][]*net.MX{"example.org": {{Host: "mx.example.org.", Pref: 10}}},
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		recordType string
+		name       string
+		records    []string
+	}{
+		{TypeA, "example.org", []string{"192.0.2.1"}},
+		{TypeAAAA, "example.org", []string{"2001:db8::1"}},
+		{TypeA, "missing.example.org", []string{}},
+		{TypeCNAME, "www.example.org", []string{"example.org."}},
+		{TypeCNAME, "example.org", []string{}},
+		{TypeTXT, "example.org", []string{"v=spf1 -all"}},
+		{TypeMX, "example.org", []string{"10 mx.example.org."}},
+		{TypeMX, "missing.example.org", []string{}},
+	} {
+		records, err := lookup(ctx, r, tc.recordType, tc.name)
+		require.NoError(t, err, tc.recordType+" "+tc.name)
+		assert.Equal(t, tc.records, records, tc.recordType+" "+tc.name)
+	}
+
+	_, err := lookup(ctx, r, TypeA, "broken.example.org")
+	assert.Error(t, err)
+}
+
+func Test_matches(t *testing.T) {
+	assert.True(t, matches(TypeA, []string{"192.0.2.1", "192.0.2.2"}, "192.0.2.2"))
+	assert.False(t, matches(TypeA, []string{"192.0.2.1"}, "192.0.2.2"))
+	assert.True(t, matches(TypeCNAME, []string{"Example.org."}, "example.org"))
+	assert.True(t, matches(TypeMX, []string{"10 mx.example.org."}, "10 mx.example.org"))
+	assert.False(t, matches(TypeTXT, []string{"Token"}, "token"))
+	assert.False(t, matches(TypeA, []string{}, "192.0.2.1"))
+}
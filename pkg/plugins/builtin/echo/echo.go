@@ -1,6 +1,7 @@
 package echo
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/juju/errors"
@@ -14,17 +15,27 @@ import (
 var (
 	Plugin = taskplugin.New("echo", "0.1", exec,
 		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithDryRun(dryRun),
 	)
 )
 
+// possible values of output_type
+const (
+	OutputTypeString = "string"
+	OutputTypeJSON   = "json"
+	OutputTypeYAML   = "yaml"
+)
+
 // Config describes transparently the outcome of execution
 // output:   an arbitrary object, equivalent to a successful return
+// output_type: defines how a string output is parsed before returning: string (as is), json or yaml
 // metadata: the metadata returned by execution, if any
-// unmarshal: defines whether unmarshal the output if it's a string or byte array before returning
+// unmarshal: defines whether unmarshal the output if it's a string or byte array before returning, same as output_type yaml
 // error_message: the outcome of a non-successful execution
 // error_type:    choose between client|server, to trigger different behavior (blocked VS retry)
 type Config struct {
 	Output       interface{}            `json:"output"`
+	OutputType   string                 `json:"output_type"`
 	Metadata     map[string]interface{} `json:"metadata"`
 	Unmarshal    bool                   `json:"unmarshal"`
 	ErrorMessage string                 `json:"error_message"`
@@ -38,6 +49,15 @@ func validConfig(config interface{}) error {
 	default:
 		return errors.New("Wrong error type: expecting 'client' or 'server'")
 	}
+	switch cfg.OutputType {
+	case OutputTypeJSON, OutputTypeYAML, "":
+	case OutputTypeString:
+		if cfg.Unmarshal {
+			return errors.New("unmarshal conflicts with output_type 'string'")
+		}
+	default:
+		return errors.Errorf("Wrong output type: expecting '%s', '%s' or '%s'", OutputTypeString, OutputTypeJSON, OutputTypeYAML)
+	}
 	return nil
 }
 
@@ -53,22 +73,47 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		}
 	}
 
+	outputType := cfg.OutputType
+	if outputType == "" && cfg.Unmarshal {
+		outputType = OutputTypeYAML
+	}
+
 	var output interface{} = cfg.Output
-	if cfg.Unmarshal {
+	if outputType == OutputTypeJSON || outputType == OutputTypeYAML {
 		var content []byte
 		switch v := cfg.Output.(type) {
 		case string:
 			content = []byte(v)
 		case []byte:
 			content = v
-		default:
-			return nil, nil, fmt.Errorf("cannot unmarshal: invalid data type (%T)", cfg.Output)
 		}
 
-		if err := yaml.Unmarshal(content, &output, utils.JSONUseNumber); err != nil {
-			return nil, nil, fmt.Errorf("failed to unmarshal output: %s", err)
+		// an output which is already structured, such as a templated map or array, is returned as is
+		if content != nil {
+			var err error
+			if outputType == OutputTypeJSON {
+				err = utils.JSONnumberUnmarshal(bytes.NewReader(content), &output)
+			} else {
+				err = yaml.Unmarshal(content, &output, utils.JSONUseNumber)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal %s output: %s", outputType, err)
+			}
 		}
 	}
 
 	return output, cfg.Metadata, resultErr
 }
+
+// dryRun describes the outcome of the step: echo has no side effect
+func dryRun(stepName string, config interface{}, ctx interface{}) (interface{}, error) {
+	output, metadata, err := exec(stepName, config, ctx)
+	description := map[string]interface{}{
+		"output":   output,
+		"metadata": metadata,
+	}
+	if err != nil {
+		description["error"] = err.Error()
+	}
+	return description, nil
+}
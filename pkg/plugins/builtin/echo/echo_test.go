@@ -0,0 +1,59 @@
+package echo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	assert.NoError(t, validConfig(&Config{}))
+	assert.NoError(t, validConfig(&Config{OutputType: OutputTypeJSON, ErrorType: "client"}))
+	assert.NoError(t, validConfig(&Config{OutputType: OutputTypeYAML, Unmarshal: true}))
+	assert.Error(t, validConfig(&Config{ErrorType: "both"}))
+	assert.Error(t, validConfig(&Config{OutputType: "xml"}))
+	assert.Error(t, validConfig(&Config{OutputType: OutputTypeString, Unmarshal: true}))
+}
+
+func Test_exec(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		output interface{}
+		err    string
+	}{
+		{"string", `{"output": "{\"foo\": 1}"}`, `{"foo": 1}`, ""},
+		{"map", `{"output": {"foo": "bar"}}`, map[string]interface{}{"foo": "bar"}, ""},
+		{"json string", `{"output": "{\"foo\": 1}", "output_type": "json"}`, map[string]interface{}{"foo": json.Number("1")}, ""},
+		{"yaml string", `{"output": "- foo\n- 2", "output_type": "yaml"}`, []interface{}{"foo", json.Number("2")}, ""},
+		{"unmarshal", `{"output": "foo: bar", "unmarshal": true}`, map[string]interface{}{"foo": "bar"}, ""},
+		{"json map", `{"output": {"foo": "bar"}, "output_type": "json"}`, map[string]interface{}{"foo": "bar"}, ""},
+		{"yaml array", `{"output": ["foo", "bar"], "output_type": "yaml"}`, []interface{}{"foo", "bar"}, ""},
+		{"invalid json", `{"output": "{foo", "output_type": "json"}`, nil, "failed to unmarshal json output"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			output, _, _, err := Plugin.Exec("test", nil, json.RawMessage(tc.config), nil)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.output, output)
+		})
+	}
+}
+
+func Test_execError(t *testing.T) {
+	output, metadata, _, err := Plugin.Exec("test", nil, json.RawMessage(`{"output": "foo", "metadata": {"bar": "baz"}, "error_message": "failed", "error_type": "client"}`), nil)
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Equal(t, "foo", output)
+	assert.Equal(t, map[string]interface{}{"bar": "baz"}, metadata)
+
+	_, _, _, err = Plugin.Exec("test", nil, json.RawMessage(`{"error_message": "failed"}`), nil)
+	require.Error(t, err)
+	assert.False(t, errors.IsBadRequest(err))
+}
@@ -0,0 +1,316 @@
+package plugingraphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the graphql plugin POSTs a query to a GraphQL endpoint
+// and returns the data it resolved
+var (
+	Plugin = taskplugin.New("graphql", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcesgraphql),
+	)
+)
+
+const (
+	// TimeoutDefault is the timeout of a query, when none is configured
+	TimeoutDefault = "30s"
+	// MaxResponseBytes is the maximum size of a response body
+	MaxResponseBytes = 10 * 1024 * 1024
+)
+
+// Config holds the configuration needed to run a query
+// credentials:    key to retrieve the endpoint's url and credentials from configstore
+// query:          GraphQL document
+// variables:      variables of the query, as an object or a string holding a JSON object (optional)
+// operation_name: operation to run, when the document holds several of them (optional)
+// headers:        headers added to the request, overriding those of the credentials (optional)
+// timeout:        timeout of the query (optional, defaults to 30s)
+type Config struct {
+	Credentials   string          `json:"credentials"`
+	Query         string          `json:"query"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+	OperationName string          `json:"operation_name,omitempty"`
+	Headers       []parameter     `json:"headers,omitempty"`
+	Timeout       string          `json:"timeout,omitempty"`
+}
+
+// parameter is a header set on the request
+type parameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// endpointConfig holds the url of a GraphQL endpoint and the credentials to query it
+type endpointConfig struct {
+	URL                string            `json:"url"`
+	Username           string            `json:"username,omitempty"`
+	Password           string            `json:"password,omitempty"`
+	BearerToken        string            `json:"bearer_token,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty"`
+}
+
+// request is the payload POSTed to the endpoint
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// Error is an error returned by the endpoint, under the errors field of its response
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Location points to the part of the query an error relates to
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e Error) String() string {
+	var details []string
+	if len(e.Path) > 0 {
+		path := make([]string, 0, len(e.Path))
+		for _, p := range e.Path {
+			path = append(path, fmt.Sprint(p))
+		}
+		details = append(details, "path "+strings.Join(path, "."))
+	}
+	for _, l := range e.Locations {
+		details = append(details, fmt.Sprintf("line %d column %d", l.Line, l.Column))
+	}
+	if code, ok := e.Extensions["code"]; ok {
+		details = append(details, fmt.Sprintf("code %v", code))
+	}
+	if len(details) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, strings.Join(details, ", "))
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Credentials == "" {
+		return errors.New("missing credentials")
+	}
+	if strings.TrimSpace(cfg.Query) == "" {
+		return errors.New("missing query")
+	}
+
+	for _, h := range cfg.Headers {
+		if h.Name == "" {
+			return fmt.Errorf("missing header name (with value '%s')", h.Value)
+		}
+	}
+
+	// templated fields are checked at runtime
+	if len(cfg.Variables) > 0 && !bytes.Contains(cfg.Variables, []byte("{{")) {
+		if _, err := parseVariables(cfg.Variables); err != nil {
+			return err
+		}
+	}
+	if cfg.Timeout != "" && !strings.Contains(cfg.Timeout, "{{") {
+		if d, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return errors.Annotate(err, "invalid timeout")
+		} else if d <= 0 {
+			return errors.Errorf("invalid timeout %q: must be positive", cfg.Timeout)
+		}
+	}
+
+	if !strings.Contains(cfg.Credentials, "{{") {
+		if _, err := loadEndpointConfig(cfg.Credentials); err != nil {
+			return err
+		}
+	} else {
+		v := values.NewValues()
+		if _, err := v.Apply(cfg.Credentials, nil, ""); err != nil {
+			return fmt.Errorf("failed to parse credentials template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func resourcesgraphql(i interface{}) []string {
+	cfg := i.(*Config)
+	resources := []string{
+		"socket",
+	}
+
+	endpoint, err := loadEndpointConfig(cfg.Credentials)
+	if err != nil {
+		return resources
+	}
+	if uri, _ := url.Parse(endpoint.URL); uri != nil && uri.Host != "" {
+		resources = append(resources, "url:"+uri.Host)
+	}
+	return resources
+}
+
+func loadEndpointConfig(credentials string) (*endpointConfig, error) {
+	str, err := configstore.GetItemValue(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve credentials from configstore: %s", err)
+	}
+
+	var endpoint endpointConfig
+	if err := json.Unmarshal([]byte(str), &endpoint); err != nil {
+		return nil, fmt.Errorf("can't unmarshal graphql credentials from configstore: %s", err)
+	}
+	if endpoint.URL == "" {
+		return nil, errors.New("missing url in graphql credentials")
+	}
+	return &endpoint, nil
+}
+
+// parseVariables accepts a JSON object, or a JSON string holding an object,
+// as produced by templating an object with toJson
+func parseVariables(raw json.RawMessage) (map[string]interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if strings.TrimSpace(str) == "" {
+			return nil, nil
+		}
+		raw = json.RawMessage(str)
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(raw, &vars); err != nil {
+		return nil, errors.NewNotValid(err, "variables must be a JSON object")
+	}
+	return vars, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	endpoint, err := loadEndpointConfig(cfg.Credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return query(endpoint, cfg)
+}
+
+// query POSTs the query to the endpoint, and returns the data of its response
+func query(endpoint *endpointConfig, cfg *Config) (interface{}, interface{}, error) {
+	vars, err := parseVariables(cfg.Variables)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid variables")
+	}
+
+	timeout := cfg.Timeout
+	if timeout == "" {
+		timeout = TimeoutDefault
+	}
+	td, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid timeout")
+	}
+
+	payload, err := json.Marshal(request{Query: cfg.Query, Variables: vars, OperationName: cfg.OperationName})
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid query")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if endpoint.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+endpoint.BearerToken)
+	} else if endpoint.Username != "" {
+		req.SetBasicAuth(endpoint.Username, endpoint.Password)
+	}
+	for name, value := range endpoint.Headers {
+		req.Header.Set(name, value)
+	}
+	for _, h := range cfg.Headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+
+	opts := []func(*http.Transport) error{}
+	if endpoint.InsecureSkipVerify {
+		opts = append(opts, httputil.WithTLSInsecureSkipVerify(true))
+	}
+	tr, err := httputil.GetTransport(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := httputil.NewHTTPClient(httputil.HTTPClientConfig{Timeout: td, Transport: tr})
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query graphql endpoint: %s", err)
+	}
+	if err := httputil.LimitResponseBody(resp, MaxResponseBytes); err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read graphql response: %s", err)
+	}
+
+	metadata := map[string]interface{}{taskplugin.HTTPStatus: resp.StatusCode}
+
+	var gqlResp struct {
+		Data   interface{} `json:"data"`
+		Errors []Error     `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &gqlResp); err != nil {
+		err := fmt.Errorf("failed to unmarshal graphql response (status %d): %s", resp.StatusCode, err)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, metadata, errors.NewBadRequest(err, "")
+		}
+		return nil, metadata, err
+	}
+
+	if len(gqlResp.Errors) > 0 {
+		metadata["errors"] = gqlResp.Errors
+		messages := make([]string, 0, len(gqlResp.Errors))
+		for _, e := range gqlResp.Errors {
+			messages = append(messages, e.String())
+		}
+		err := fmt.Errorf("graphql query failed: %s", strings.Join(messages, "; "))
+		// an unavailable endpoint may recover, a query refused or failing to resolve won't get any better when retried
+		if resp.StatusCode >= 500 {
+			return gqlResp.Data, metadata, err
+		}
+		return gqlResp.Data, metadata, errors.NewBadRequest(err, "")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("failed graphql request: %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return gqlResp.Data, metadata, errors.NewBadRequest(err, "")
+		}
+		return gqlResp.Data, metadata, err
+	}
+
+	return gqlResp.Data, metadata, nil
+}
@@ -0,0 +1,116 @@
+package plugingraphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ viewer { login } }"}, true},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "query($id: ID!) { node(id: $id) { id } }", Variables: json.RawMessage(`{"id":"{{.input.id}}"}`)}, true},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ a }", Variables: json.RawMessage(`"{\"id\":1}"`)}, true},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ a }", Headers: []parameter{{Name: "X-Api-Key", Value: "secret"}}, Timeout: "5s"}, true},
+		{Config{Credentials: "", Query: "{ a }"}, false},
+		{Config{Credentials: "{{.input.endpoint}}", Query: " "}, false},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ a }", Variables: json.RawMessage(`[1,2]`)}, false},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ a }", Headers: []parameter{{Value: "secret"}}}, false},
+		{Config{Credentials: "{{.input.endpoint}}", Query: "{ a }", Timeout: "-1s"}, false},
+		{Config{Credentials: "not-in-configstore", Query: "{ a }"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_query(t *testing.T) {
+	var received request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "step", r.Header.Get("X-Api-Key"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/graphql/invalid":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"Cannot query field \"nope\"","locations":[{"line":1,"column":3}],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}]}`))
+		case "/graphql/partial":
+			w.Write([]byte(`{"data":{"user":null},"errors":[{"message":"user not found","path":["user",0]}]}`))
+		case "/graphql/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`upstream unavailable`))
+		default:
+			w.Write([]byte(`{"data":{"user":{"id":"42","login":"utask"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	endpoint := &endpointConfig{
+		URL:         srv.URL + "/graphql",
+		BearerToken: "token",
+		Headers:     map[string]string{"X-Api-Key": "credentials"},
+	}
+	cfg := &Config{
+		Query:         "query GetUser($id: ID!) { user(id: $id) { id login } }",
+		Variables:     json.RawMessage(`"{\"id\":\"42\"}"`),
+		OperationName: "GetUser",
+		Headers:       []parameter{{Name: "X-Api-Key", Value: "step"}},
+	}
+
+	output, metadata, err := query(endpoint, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "42"}, received.Variables)
+	assert.Equal(t, "GetUser", received.OperationName)
+	assert.Equal(t, map[string]interface{}{"user": map[string]interface{}{"id": "42", "login": "utask"}}, output)
+	assert.Equal(t, http.StatusOK, metadata.(map[string]interface{})["HTTPStatus"])
+
+	endpoint.URL = srv.URL + "/graphql/invalid"
+	_, _, err = query(endpoint, cfg)
+	require.Error(t, err)
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Contains(t, err.Error(), `Cannot query field "nope" (line 1 column 3, code GRAPHQL_VALIDATION_FAILED)`)
+
+	endpoint.URL = srv.URL + "/graphql/partial"
+	output, metadata, err = query(endpoint, cfg)
+	require.Error(t, err)
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Contains(t, err.Error(), "user not found (path user.0)")
+	assert.Equal(t, map[string]interface{}{"user": nil}, output)
+	assert.Len(t, metadata.(map[string]interface{})["errors"], 1)
+
+	endpoint.URL = srv.URL + "/graphql/down"
+	_, _, err = query(endpoint, cfg)
+	require.Error(t, err)
+	assert.False(t, errors.IsBadRequest(err))
+}
+
+func Test_parseVariables(t *testing.T) {
+	vars, err := parseVariables(json.RawMessage(`{"id":1,"tags":["a"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "tags": []interface{}{"a"}}, vars)
+
+	vars, err = parseVariables(json.RawMessage(`""`))
+	require.NoError(t, err)
+	assert.Nil(t, vars)
+
+	_, err = parseVariables(json.RawMessage(`"not json"`))
+	assert.Error(t, err)
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
 	"github.com/cneill/utask/pkg/plugins/taskplugin"
 	"github.com/cneill/utask/pkg/utils"
+	jujuerrors "github.com/juju/errors"
+	"github.com/sirupsen/logrus"
 	dac "github.com/ybriffa/go-http-digest-auth-client"
 )
 
@@ -25,12 +27,23 @@ var (
 	Plugin = taskplugin.New("http", "1.0", exec,
 		taskplugin.WithConfig(validConfig, HTTPConfig{}),
 		taskplugin.WithResources(resourceshttp),
+		taskplugin.WithDryRun(dryRun),
+		taskplugin.WithIdempotencyKey(execWithIdempotencyKey),
 	)
 )
 
 const (
 	// TimeoutDefault represents the default value that will be used for HTTP call, if not defined in configuration
 	TimeoutDefault = "30s"
+	// MaxRedirectsDefault represents the default number of redirects followed, if not defined in configuration
+	MaxRedirectsDefault = 10
+	// IdempotencyKeyHeader is the header carrying the idempotency key of the step
+	// on the non-idempotent requests (POST and PATCH)
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// MaxResponseBytesDefault represents the default maximum size of a response body, if not defined in configuration
+	MaxResponseBytesDefault = 10 * 1024 * 1024
+	// MaxRequestBytesDefault represents the default maximum size of a request body, if not defined in configuration
+	MaxRequestBytesDefault = 10 * 1024 * 1024
 )
 
 // HTTPConfig is the configuration needed to perform an HTTP call
@@ -44,10 +57,13 @@ type HTTPConfig struct {
 	Timeout            string      `json:"timeout,omitempty"`
 	Auth               auth        `json:"auth,omitempty"`
 	FollowRedirect     string      `json:"follow_redirect,omitempty"`
+	MaxRedirects       string      `json:"max_redirects,omitempty"`
 	QueryParameters    []parameter `json:"query_parameters,omitempty"`
 	TrimPrefix         string      `json:"trim_prefix,omitempty"`
 	InsecureSkipVerify string      `json:"insecure_skip_verify,omitempty"`
 	RootCA             string      `json:"root_ca,omitempty"`
+	MaxResponseBytes   string      `json:"max_response_bytes,omitempty"`
+	MaxRequestBytes    string      `json:"max_request_bytes,omitempty"`
 }
 
 // parameter represents either headers, query parameters, ...
@@ -61,6 +77,7 @@ type auth struct {
 	Basic     *authBasic  `json:"basic"`
 	Digest    *authDigest `json:"digest"`
 	Bearer    *string     `json:"bearer"`
+	OAuth2    *authOAuth2 `json:"oauth2"`
 	MutualTLS *mTLS       `json:"mutual_tls"`
 }
 
@@ -101,7 +118,7 @@ func validConfig(config interface{}) error {
 		return errors.New("missing either URL or Host")
 	}
 
-	// skip validation of Timeout, FollowRedirect to allow runtime templating
+	// skip validation of Timeout, FollowRedirect, MaxRedirects, MaxResponseBytes, MaxRequestBytes to allow runtime templating
 
 	for _, p := range cfg.Headers {
 		if p.Name == "" {
@@ -116,13 +133,13 @@ func validConfig(config interface{}) error {
 	}
 
 	authentication := 0
-	for _, authExist := range []bool{cfg.Auth.Basic != nil, cfg.Auth.Bearer != nil, cfg.Auth.Digest != nil} {
+	for _, authExist := range []bool{cfg.Auth.Basic != nil, cfg.Auth.Bearer != nil, cfg.Auth.Digest != nil, cfg.Auth.OAuth2 != nil} {
 		if authExist {
 			authentication++
 		}
 	}
 	if authentication > 1 {
-		return errors.New("basic|digest|bearer authentications are mutually exclusive")
+		return errors.New("basic|digest|bearer|oauth2 authentications are mutually exclusive")
 	}
 
 	if cfg.Auth.Basic != nil {
@@ -141,6 +158,12 @@ func validConfig(config interface{}) error {
 		return fmt.Errorf("missing bearer token value")
 	}
 
+	if cfg.Auth.OAuth2 != nil {
+		if err := validOAuth2Config(cfg.Auth.OAuth2); err != nil {
+			return err
+		}
+	}
+
 	if cfg.Auth.MutualTLS != nil {
 		if cfg.Auth.MutualTLS.ClientCert == "" || cfg.Auth.MutualTLS.ClientKey == "" {
 			return fmt.Errorf("missing either client_cert or client_key for mTLS")
@@ -176,6 +199,12 @@ func resourceshttp(i interface{}) []string {
 }
 
 func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	return execWithIdempotencyKey(stepName, config, ctx, "")
+}
+
+// execWithIdempotencyKey performs the HTTP call, sending the idempotency key of the step
+// along with POST and PATCH requests, unless the step sets its own Idempotency-Key header
+func execWithIdempotencyKey(stepName string, config interface{}, ctx interface{}, idempotencyKey string) (interface{}, interface{}, error) {
 	cfg := config.(*HTTPConfig)
 
 	// do it once and avoid re-copies
@@ -185,51 +214,50 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		fmt.Println(string(body))
 	}
 
-	target := cfg.URL
-	if target == "" {
-		hostURL, err := url.Parse(cfg.Host)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse host: %s", err)
-		}
-		pathURL, err := url.Parse(cfg.Path)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse path: %s", err)
-		}
-		pathURL.Host = hostURL.Host
-		pathURL.Scheme = hostURL.Scheme
-		target = pathURL.String()
+	maxRequestBytes, err := parseMaxBytes(cfg.MaxRequestBytes, MaxRequestBytesDefault, "max_request_bytes")
+	if err != nil {
+		return nil, nil, err
 	}
-
-	req, err := http.NewRequest(cfg.Method, target, bytes.NewBuffer(body))
+	if int64(len(body)) > maxRequestBytes {
+		return nil, nil, jujuerrors.NewBadRequest(nil, fmt.Sprintf("request body of %d bytes exceeds max_request_bytes (%d bytes)", len(body), maxRequestBytes))
+	}
+	maxResponseBytes, err := parseMaxBytes(cfg.MaxResponseBytes, MaxResponseBytesDefault, "max_response_bytes")
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create HTTP request: %s", err.Error())
+		return nil, nil, err
 	}
 
-	q := req.URL.Query()
-	for _, p := range cfg.QueryParameters {
-		q.Add(p.Name, p.Value)
+	req, err := newRequest(cfg, body)
+	if err != nil {
+		return nil, nil, err
 	}
-	req.URL.RawQuery = q.Encode()
 
 	if cfg.Auth.Bearer != nil {
 		var bearer = "Bearer " + *cfg.Auth.Bearer
 		req.Header.Add("Authorization", bearer)
 	} else if cfg.Auth.Basic != nil {
 		req.SetBasicAuth(cfg.Auth.Basic.User, cfg.Auth.Basic.Password)
+	} else if cfg.Auth.OAuth2 != nil {
+		tok, err := oauth2Token(cfg.Auth.OAuth2)
+		if err != nil {
+			return nil, nil, fmt.Errorf("OAuth2 authentication failed, request not sent: %s", err)
+		}
+		req.Header.Set("Authorization", tok.Type()+" "+tok.AccessToken)
 	}
 
 	for _, h := range cfg.Headers {
 		req.Header.Set(h.Name, h.Value)
 	}
 
-	// best-effort match the body's content-type
-	if len(body) > 0 && req.Header.Get("Content-Type") == "" {
-		var i interface{}
-		reader := bytes.NewReader(body)
-		if err := utils.JSONnumberUnmarshal(reader, &i); err == nil {
-			req.Header.Set("Content-Type", "application/json")
-		} else if err := xml.Unmarshal(body, &i); err == nil {
-			req.Header.Set("Content-Type", "application/xml")
+	if req.Header.Get("Content-Type") == "" {
+		if ct := bodyContentType(body); ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+
+	if idempotencyKey != "" && req.Header.Get(IdempotencyKeyHeader) == "" {
+		switch req.Method {
+		case http.MethodPost, http.MethodPatch:
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
 		}
 	}
 
@@ -237,7 +265,7 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		cfg.Timeout = TimeoutDefault
 	}
 
-	var fr bool
+	fr := true
 
 	td, err := time.ParseDuration(cfg.Timeout)
 	if err != nil {
@@ -249,6 +277,16 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 			return nil, nil, fmt.Errorf("failed to parse follow_redirect: %s", err)
 		}
 	}
+	maxRedirects := MaxRedirectsDefault
+	if cfg.MaxRedirects != "" {
+		maxRedirects, err = strconv.Atoi(cfg.MaxRedirects)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse max_redirects: %s", err)
+		}
+		if maxRedirects < 1 {
+			return nil, nil, fmt.Errorf("invalid max_redirects %d: must be positive", maxRedirects)
+		}
+	}
 	var insecureSkipVerify bool
 	if cfg.InsecureSkipVerify != "" {
 		insecureSkipVerify, err = strconv.ParseBool(cfg.InsecureSkipVerify)
@@ -259,6 +297,7 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 	httpClientConfig := httputil.HTTPClientConfig{
 		Timeout:        td,
 		FollowRedirect: fr,
+		MaxRedirects:   maxRedirects,
 	}
 
 	opts := []func(*http.Transport) error{}
@@ -293,11 +332,21 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		httpClient = &transport
 	}
 
+	req, timings := httputil.TraceRequest(req)
+
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't do HTTP request: %s", err.Error())
 	}
 
+	if err := httputil.LimitResponseBody(resp, maxResponseBytes); err != nil {
+		timings.Done()
+		return nil, map[string]interface{}{
+			taskplugin.HTTPStatus:  resp.StatusCode,
+			taskplugin.HTTPTimings: timings.Metadata(),
+		}, err
+	}
+
 	// remove response magic prefix
 	if cfg.TrimPrefix != "" {
 		trimPrefixBytes := []byte(cfg.TrimPrefix)
@@ -310,7 +359,142 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		resp.Body = io.NopCloser(bytes.NewReader(respBody))
 	}
 
-	return httputil.UnmarshalResponse(resp)
+	// when redirects are not followed, the redirection is the expected response:
+	// its status and Location header are returned in the metadata
+	unmarshal := httputil.UnmarshalResponse
+	if !fr {
+		unmarshal = httputil.UnmarshalRedirectResponse
+	}
+	output, metadata, err := unmarshal(resp)
+	timings.Done()
+
+	if m, ok := metadata.(map[string]interface{}); ok {
+		m[taskplugin.HTTPTimings] = timings.Metadata()
+	}
+
+	return output, metadata, err
+}
+
+// parseMaxBytes parses a maximum size in bytes, which must be positive
+func parseMaxBytes(value string, def int64, name string) (int64, error) {
+	if value == "" {
+		return def, nil
+	}
+	maxBytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", name, err)
+	}
+	if maxBytes < 1 {
+		return 0, fmt.Errorf("invalid %s %d: must be positive", name, maxBytes)
+	}
+	return maxBytes, nil
+}
+
+// dryRun describes the HTTP request the step would send, without sending it
+// nor fetching an OAuth2 token. Credentials are masked
+func dryRun(stepName string, config interface{}, ctx interface{}) (interface{}, error) {
+	cfg := config.(*HTTPConfig)
+
+	body := []byte(cfg.Body)
+	req, err := newRequest(cfg, body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.Auth.Bearer != nil:
+		req.Header.Set("Authorization", "Bearer "+*cfg.Auth.Bearer)
+	case cfg.Auth.Basic != nil:
+		req.SetBasicAuth(cfg.Auth.Basic.User, cfg.Auth.Basic.Password)
+	case cfg.Auth.OAuth2 != nil:
+		req.Header.Set("Authorization", oauth2DryRunToken)
+	}
+	for _, h := range cfg.Headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+	// only the authentication scheme is described
+	if authorization := req.Header.Get("Authorization"); authorization != "" && authorization != oauth2DryRunToken {
+		scheme, _, _ := strings.Cut(authorization, " ")
+		req.Header.Set("Authorization", scheme+" "+maskedCredentials)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		if ct := bodyContentType(body); ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+
+	headers := map[string]interface{}{}
+	for name := range req.Header {
+		headers[name] = req.Header.Get(name)
+	}
+
+	description := map[string]interface{}{
+		"method":  req.Method,
+		"url":     req.URL.String(),
+		"headers": headers,
+	}
+	if len(body) > 0 {
+		description["body"] = cfg.Body
+	}
+	if cfg.Auth.Digest != nil {
+		description["auth"] = "digest"
+	}
+	if cfg.Auth.MutualTLS != nil {
+		description["mutual_tls"] = true
+	}
+
+	logrus.WithFields(logrus.Fields{"step_name": stepName, "dry_run": true}).Infof("http: would send %s %s", req.Method, req.URL.String())
+
+	return description, nil
+}
+
+const (
+	maskedCredentials = "***"
+	oauth2DryRunToken = "<OAuth2 token, not fetched during a dry-run>"
+)
+
+// newRequest builds the request targeted by the configuration, with its query parameters
+func newRequest(cfg *HTTPConfig, body []byte) (*http.Request, error) {
+	target := cfg.URL
+	if target == "" {
+		hostURL, err := url.Parse(cfg.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host: %s", err)
+		}
+		pathURL, err := url.Parse(cfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse path: %s", err)
+		}
+		pathURL.Host = hostURL.Host
+		pathURL.Scheme = hostURL.Scheme
+		target = pathURL.String()
+	}
+
+	req, err := http.NewRequest(cfg.Method, target, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %s", err.Error())
+	}
+
+	q := req.URL.Query()
+	for _, p := range cfg.QueryParameters {
+		q.Add(p.Name, p.Value)
+	}
+	req.URL.RawQuery = q.Encode()
+	return req, nil
+}
+
+// bodyContentType best-effort matches the body's content-type
+func bodyContentType(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var i interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(body), &i); err == nil {
+		return "application/json"
+	} else if err := xml.Unmarshal(body, &i); err == nil {
+		return "application/xml"
+	}
+	return ""
 }
 
 // ExecutorMetadata generates json schema to validate the metadata
@@ -318,5 +502,6 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 func ExecutorMetadata() string {
 	return taskplugin.NewMetadataSchema().
 		WithStatusCode().
+		WithTimings().
 		String()
 }
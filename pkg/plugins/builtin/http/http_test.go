@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	httputilutask "github.com/cneill/utask/pkg/plugins/builtin/httputil"
+	jujuerrors "github.com/juju/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -202,9 +203,14 @@ func Test_exec(t *testing.T) {
 
 	mapMetadata, ok := metadata.(map[string]interface{})
 	require.True(t, ok)
-	assert.Len(t, mapMetadata, 3)
+	assert.Len(t, mapMetadata, 4)
 	assert.Equal(t, 200, mapMetadata["HTTPStatus"])
 
+	mapTimings, ok := mapMetadata["HTTPTimings"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Len(t, mapTimings, 5)
+	assert.Greater(t, mapTimings["total_ms"], 0.0)
+
 	mapCookies, ok := mapMetadata["HTTPCookies"].(map[string]string)
 	require.True(t, ok)
 	assert.Len(t, mapCookies, 1)
@@ -217,3 +223,112 @@ func Test_exec(t *testing.T) {
 	assert.Equal(t, "Cookie-1=foo", mapHeaders["Set-Cookie"])
 
 }
+
+func Test_execWithIdempotencyKey(t *testing.T) {
+	var received []string
+	httputilutask.NewHTTPClient = func(cfg httputilutask.HTTPClientConfig) httputilutask.HTTPClient {
+		return MockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				received = append(received, req.Header.Get(IdempotencyKeyHeader))
+
+				var httpResponse = new(http.Response)
+				httpResponse.Body = io.NopCloser(bytes.NewBufferString(`{}`))
+				httpResponse.StatusCode = 201
+				return httpResponse, nil
+			},
+		}
+	}
+
+	for _, cfg := range []HTTPConfig{
+		{URL: "http://lolcat.host/stuff", Method: "POST", Body: `{"foo":"bar"}`},
+		{URL: "http://lolcat.host/stuff", Method: "GET"},
+		{URL: "http://lolcat.host/stuff", Method: "POST", Headers: []parameter{{Name: IdempotencyKeyHeader, Value: "custom"}}},
+	} {
+		cfgJSON, err := json.Marshal(cfg)
+		require.NoError(t, err)
+		_, _, _, err = Plugin.ExecWithIdempotencyKey("test", json.RawMessage(""), json.RawMessage(cfgJSON), nil, "my-key")
+		require.NoError(t, err)
+	}
+
+	// safe methods don't need a key, and the step headers take precedence
+	assert.Equal(t, []string{"my-key", "", "custom"}, received)
+}
+
+func Test_dryRun(t *testing.T) {
+	httputilutask.NewHTTPClient = func(cfg httputilutask.HTTPClientConfig) httputilutask.HTTPClient {
+		return MockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				t.Fatal("no request should be sent during a dry-run")
+				return nil, nil
+			},
+		}
+	}
+
+	bearerToken := "my_token"
+	cfg := HTTPConfig{
+		URL:             "http://lolcat.host/stuff",
+		Method:          "POST",
+		Body:            `{"foo":"bar"}`,
+		QueryParameters: []parameter{{Name: "foo", Value: "bar"}},
+		Headers:         []parameter{{Name: "X-Foo", Value: "bar"}},
+		Auth:            auth{Bearer: &bearerToken},
+	}
+	cfgJSON, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	assert.True(t, Plugin.SupportsDryRun())
+	description, err := Plugin.DryRun("test", json.RawMessage(""), json.RawMessage(cfgJSON), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"method": "POST",
+		"url":    "http://lolcat.host/stuff?foo=bar",
+		"headers": map[string]interface{}{
+			"Authorization": "Bearer ***",
+			"X-Foo":         "bar",
+			"Content-Type":  "application/json",
+		},
+		"body": `{"foo":"bar"}`,
+	}, description)
+}
+
+func Test_execMaxBytes(t *testing.T) {
+	httputilutask.NewHTTPClient = func(cfg httputilutask.HTTPClientConfig) httputilutask.HTTPClient {
+		return MockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				var httpResponse = new(http.Response)
+				httpResponse.Body = io.NopCloser(bytes.NewBufferString(`0123456789`))
+				httpResponse.ContentLength = -1
+				httpResponse.StatusCode = 200
+				return httpResponse, nil
+			},
+		}
+	}
+
+	exec := func(cfg HTTPConfig) (interface{}, error) {
+		cfgJSON, err := json.Marshal(cfg)
+		require.NoError(t, err)
+		output, _, _, err := Plugin.Exec("test", json.RawMessage(""), json.RawMessage(cfgJSON), nil)
+		return output, err
+	}
+
+	// the defaults let reasonable bodies through
+	output, err := exec(HTTPConfig{URL: "http://lolcat.host/stuff", Method: "POST", Body: "body"})
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", output)
+
+	output, err = exec(HTTPConfig{URL: "http://lolcat.host/stuff", Method: "GET", MaxResponseBytes: "10"})
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", output)
+
+	_, err = exec(HTTPConfig{URL: "http://lolcat.host/stuff", Method: "GET", MaxResponseBytes: "9"})
+	assert.True(t, jujuerrors.IsBadRequest(err))
+	assert.EqualError(t, err, "response body exceeds the maximum of 9 bytes")
+
+	_, err = exec(HTTPConfig{URL: "http://lolcat.host/stuff", Method: "POST", Body: "body", MaxRequestBytes: "3"})
+	assert.True(t, jujuerrors.IsBadRequest(err))
+	assert.EqualError(t, err, "request body of 4 bytes exceeds max_request_bytes (3 bytes)")
+
+	_, err = exec(HTTPConfig{URL: "http://lolcat.host/stuff", Method: "GET", MaxResponseBytes: "0"})
+	assert.EqualError(t, err, "invalid max_response_bytes 0: must be positive")
+}
@@ -0,0 +1,157 @@
+package pluginhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ovh/configstore"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
+)
+
+const (
+	// tokenTimeoutDefault bounds the time spent fetching a token from the authorization server
+	tokenTimeoutDefault = 30 * time.Second
+
+	// maxTokenSources bounds the amount of token sources kept, the least recently used is evicted beyond
+	maxTokenSources = 256
+)
+
+// authOAuth2 represents the embedded OAuth2 client credentials auth inside Auth struct
+// credentials: key to retrieve the client ID and secret from configstore
+type authOAuth2 struct {
+	TokenURL    string   `json:"token_url"`
+	Credentials string   `json:"credentials"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+// oauth2Credentials holds the client credentials stored in configstore
+type oauth2Credentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// token sources are kept across steps, so that a token is reused until it expires
+// they refresh their token shortly before its expiry
+// they are keyed by the name of their credentials item, never by the credentials themselves
+var (
+	tokenSources    = map[string]*cachedTokenSource{}
+	tokenSourcesMu  sync.Mutex
+	tokenSourcesUse uint64
+)
+
+// cachedTokenSource is a token source, along with a digest of the credentials it was built with,
+// to build a new one when they get rotated
+type cachedTokenSource struct {
+	ts       oauth2.TokenSource
+	digest   [sha256.Size]byte
+	lastUsed uint64
+}
+
+func validOAuth2Config(cfg *authOAuth2) error {
+	if cfg.TokenURL == "" {
+		return errors.New("missing token_url for oauth2 auth")
+	}
+	if cfg.Credentials == "" {
+		return errors.New("missing credentials for oauth2 auth")
+	}
+	// templated credentials are resolved at runtime
+	if !strings.Contains(cfg.Credentials, "{{") {
+		if _, err := loadOAuth2Credentials(cfg.Credentials); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadOAuth2Credentials(key string) (*oauth2Credentials, error) {
+	if utask.IsConcealedSecret(key) {
+		return nil, fmt.Errorf("can't retrieve oauth2 credentials from configstore: %q is a concealed secret", key)
+	}
+	str, err := configstore.GetItemValue(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve oauth2 credentials from configstore: %s", err)
+	}
+
+	var creds oauth2Credentials
+	if err := json.Unmarshal([]byte(str), &creds); err != nil {
+		return nil, fmt.Errorf("can't unmarshal oauth2 credentials from configstore: %s", err)
+	}
+	if creds.ClientID == "" || creds.ClientSecret == "" {
+		return nil, errors.New("missing either client_id or client_secret in oauth2 credentials")
+	}
+	return &creds, nil
+}
+
+// oauth2Token returns a valid access token for the given configuration,
+// fetching a new one from the authorization server only when needed
+func oauth2Token(cfg *authOAuth2) (*oauth2.Token, error) {
+	creds, err := loadOAuth2Credentials(cfg.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := tokenSource(cfg.TokenURL, cfg.Credentials, creds, cfg.Scopes).Token()
+	if err != nil {
+		var rErr *oauth2.RetrieveError
+		if errors.As(err, &rErr) && rErr.Response != nil {
+			return nil, fmt.Errorf("token endpoint refused the client credentials (HTTP %d): %s", rErr.Response.StatusCode, strings.TrimSpace(string(rErr.Body)))
+		}
+		return nil, fmt.Errorf("can't fetch token: %s", err)
+	}
+	return tok, nil
+}
+
+func tokenSource(tokenURL, credentials string, creds *oauth2Credentials, scopes []string) oauth2.TokenSource {
+	key := strings.Join([]string{tokenURL, credentials, strings.Join(scopes, " ")}, "\x00")
+	// a rotated secret gets a fresh token
+	digest := sha256.Sum256([]byte(creds.ClientID + "\x00" + creds.ClientSecret))
+
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+
+	cached, ok := tokenSources[key]
+	if !ok || cached.digest != digest {
+		cc := clientcredentials.Config{
+			ClientID:     creds.ClientID,
+			ClientSecret: creds.ClientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       scopes,
+		}
+		client := &http.Client{Timeout: tokenTimeoutDefault}
+		if tr, err := httputil.GetTransport(); err == nil {
+			client.Transport = tr
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		if !ok && len(tokenSources) >= maxTokenSources {
+			evictTokenSource()
+		}
+		cached = &cachedTokenSource{ts: cc.TokenSource(ctx), digest: digest}
+		tokenSources[key] = cached
+	}
+	tokenSourcesUse++
+	cached.lastUsed = tokenSourcesUse
+	return cached.ts
+}
+
+// evictTokenSource drops the least recently used token source, tokenSourcesMu must be held
+func evictTokenSource() {
+	var oldestKey string
+	var oldest uint64
+	for key, cached := range tokenSources {
+		if oldestKey == "" || cached.lastUsed < oldest {
+			oldestKey, oldest = key, cached.lastUsed
+		}
+	}
+	delete(tokenSources, oldestKey)
+}
@@ -0,0 +1,118 @@
+package pluginhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tokenSource(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "read write", r.PostForm.Get("scope"))
+
+		user, pass, _ := r.BasicAuth()
+		if user != "my-client" || pass != "my-secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, calls)
+	}))
+	defer srv.Close()
+
+	scopes := []string{"read", "write"}
+
+	creds := &oauth2Credentials{ClientID: "my-client", ClientSecret: "my-secret"}
+	tok, err := tokenSource(srv.URL, "oauth2-item", creds, scopes).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+	assert.Equal(t, "Bearer", tok.Type())
+
+	// the token is cached until its expiry
+	tok, err = tokenSource(srv.URL, "oauth2-item", creds, scopes).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+	assert.Equal(t, 1, calls)
+
+	// the cache is keyed by the name of the credentials item, not by the credentials
+	tokenSourcesMu.Lock()
+	for key := range tokenSources {
+		assert.NotContains(t, key, "my-secret")
+	}
+	tokenSourcesMu.Unlock()
+
+	// a rotated secret replaces the token source of its item
+	_, err = tokenSource(srv.URL, "oauth2-item", &oauth2Credentials{ClientID: "my-client", ClientSecret: "wrong-secret"}, scopes).Token()
+	assert.Error(t, err)
+	tokenSourcesMu.Lock()
+	assert.Len(t, tokenSources, 1)
+	tokenSourcesMu.Unlock()
+}
+
+func Test_tokenSourceEviction(t *testing.T) {
+	tokenSourcesMu.Lock()
+	tokenSources = map[string]*cachedTokenSource{}
+	tokenSourcesMu.Unlock()
+
+	creds := &oauth2Credentials{ClientID: "my-client", ClientSecret: "my-secret"}
+	first := tokenSource("http://auth.example.org/token", "item-0", creds, nil)
+	for i := 1; i < maxTokenSources; i++ {
+		tokenSource("http://auth.example.org/token", fmt.Sprintf("item-%d", i), creds, nil)
+	}
+	// the first one is used again, the second one is now the least recently used
+	assert.Equal(t, first, tokenSource("http://auth.example.org/token", "item-0", creds, nil))
+
+	tokenSource("http://auth.example.org/token", "item-new", creds, nil)
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+	assert.Len(t, tokenSources, maxTokenSources)
+	assert.Contains(t, tokenSources, "http://auth.example.org/token\x00item-0\x00")
+	assert.NotContains(t, tokenSources, "http://auth.example.org/token\x00item-1\x00")
+}
+
+func Test_validOAuth2Config(t *testing.T) {
+	cfg := HTTPConfig{
+		URL:    "http://lolcat.host/stuff",
+		Method: "GET",
+		Auth: auth{
+			OAuth2: &authOAuth2{
+				TokenURL:    "http://lolcat.host/token",
+				Credentials: "{{.config.oauth2}}",
+			},
+		},
+	}
+
+	cfgJSON, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.NoError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+
+	cfg.Auth.OAuth2.TokenURL = ""
+	cfgJSON, err = json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.EqualError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)), "missing token_url for oauth2 auth")
+	cfg.Auth.OAuth2.TokenURL = "http://lolcat.host/token"
+
+	cfg.Auth.OAuth2.Credentials = "unknown-item"
+	cfgJSON, err = json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Error(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)))
+	cfg.Auth.OAuth2.Credentials = "{{.config.oauth2}}"
+
+	bearerToken := "my_token"
+	cfg.Auth.Bearer = &bearerToken
+	cfgJSON, err = json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.EqualError(t, Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON)), "basic|digest|bearer|oauth2 authentications are mutually exclusive")
+}
@@ -33,6 +33,16 @@ var (
 // - its body, deserialized if content-type appropriate
 // - metadata such as headers and status code
 func UnmarshalResponse(resp *http.Response) (interface{}, interface{}, error) {
+	return unmarshalResponse(resp, false)
+}
+
+// UnmarshalRedirectResponse behaves like UnmarshalResponse, but considers a redirection (3xx)
+// as a successful response, for the callers which don't follow redirects
+func UnmarshalRedirectResponse(resp *http.Response) (interface{}, interface{}, error) {
+	return unmarshalResponse(resp, true)
+}
+
+func unmarshalResponse(resp *http.Response, acceptRedirect bool) (interface{}, interface{}, error) {
 
 	defer resp.Body.Close()
 
@@ -74,6 +84,10 @@ func UnmarshalResponse(resp *http.Response) (interface{}, interface{}, error) {
 		output = string(bodyBytes)
 	}
 
+	if acceptRedirect && resp.StatusCode > 299 && resp.StatusCode < 400 {
+		return output, metadata, nil
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		err := fmt.Errorf("failed api request: %d: %s", resp.StatusCode, string(bodyBytes))
 		if resp.StatusCode > 399 && resp.StatusCode < 500 {
@@ -85,6 +99,25 @@ func UnmarshalResponse(resp *http.Response) (interface{}, interface{}, error) {
 	return output, metadata, nil
 }
 
+// LimitResponseBody reads the body of a response, failing with a client error
+// when it exceeds maxBytes: the body is not kept in memory beyond that size
+func LimitResponseBody(resp *http.Response, maxBytes int64) error {
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxBytes {
+		return errors.NewBadRequest(nil, fmt.Sprintf("response body of %d bytes exceeds the maximum of %d bytes", resp.ContentLength, maxBytes))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("can't read body: %s", err.Error())
+	}
+	if int64(len(body)) > maxBytes {
+		return errors.NewBadRequest(nil, fmt.Sprintf("response body exceeds the maximum of %d bytes", maxBytes))
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
 // NewHTTPClient is a factory of HTTPClient
 var NewHTTPClient = defaultHTTPClientFactory
 
@@ -97,6 +130,7 @@ type HTTPClient interface {
 type HTTPClientConfig struct {
 	Timeout        time.Duration
 	FollowRedirect bool
+	MaxRedirects   int // when following redirects, 0 falls back to the http.Client default (10)
 	Transport      http.RoundTripper
 }
 
@@ -107,6 +141,13 @@ func defaultHTTPClientFactory(cfg HTTPClientConfig) HTTPClient {
 		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		}
+	} else if cfg.MaxRedirects > 0 {
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			return nil
+		}
 	}
 	if cfg.Transport != nil {
 		c.Transport = cfg.Transport
@@ -114,8 +155,10 @@ func defaultHTTPClientFactory(cfg HTTPClientConfig) HTTPClient {
 	return c
 }
 
+// GetTransport builds a transport going through the configured proxy, see SetProxy
 func GetTransport(opts ...func(*http.Transport) error) (http.RoundTripper, error) {
 	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = Proxy
 	for _, o := range opts {
 		if err := o(tr); err != nil {
 			return tr, err
@@ -2,8 +2,11 @@ package httputil
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,3 +51,111 @@ func TestUnmarshalResponse(t *testing.T) {
 	assert.Equal(t, "Cookie-1=foo", mapHeaders["Set-Cookie"])
 
 }
+
+func TestUnmarshalRedirectResponse(t *testing.T) {
+	newResponse := func() *http.Response {
+		return &http.Response{
+			StatusCode: 302,
+			Header:     http.Header{"Location": {"https://example.org/elsewhere"}},
+			Body:       io.NopCloser(bytes.NewBufferString("")),
+		}
+	}
+
+	_, _, err := UnmarshalResponse(newResponse())
+	assert.Error(t, err)
+
+	_, metadata, err := UnmarshalRedirectResponse(newResponse())
+	require.NoError(t, err)
+	mapMetadata, ok := metadata.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, 302, mapMetadata["HTTPStatus"])
+	assert.Equal(t, "https://example.org/elsewhere", mapMetadata["HTTPHeaders"].(map[string]string)["Location"])
+}
+
+func TestMaxRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops, _ := strconv.Atoi(r.URL.Query().Get("hops"))
+		if hops > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/?hops=%d", hops-1), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cli := defaultHTTPClientFactory(HTTPClientConfig{FollowRedirect: true, MaxRedirects: 3})
+
+	resp, err := cli.Do(mustRequest(t, srv.URL+"/?hops=3"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = cli.Do(mustRequest(t, srv.URL+"/?hops=4"))
+	assert.ErrorContains(t, err, "stopped after 3 redirects")
+
+	cli = defaultHTTPClientFactory(HTTPClientConfig{FollowRedirect: false})
+	resp, err = cli.Do(mustRequest(t, srv.URL+"/?hops=1"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/?hops=0", resp.Header.Get("Location"))
+}
+
+func mustRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	return req
+}
+
+func TestTraceRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req, timings := TraceRequest(mustRequest(t, srv.URL))
+	resp, err := defaultHTTPClientFactory(HTTPClientConfig{}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	timings.Done()
+
+	metadata := timings.Metadata()
+	assert.Len(t, metadata, 5)
+	assert.Greater(t, metadata["connect_ms"], 0.0)
+	assert.Greater(t, metadata["first_byte_ms"], 0.0)
+	assert.GreaterOrEqual(t, metadata["total_ms"], metadata["first_byte_ms"])
+	assert.Equal(t, 0.0, metadata["tls_ms"])
+}
+
+func TestProxy(t *testing.T) {
+	envProxy := proxy.fn
+	t.Cleanup(func() { proxy.fn = envProxy })
+
+	t.Setenv("HTTP_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3129")
+	t.Setenv("NO_PROXY", "")
+
+	// the configuration overrides the environment, which remains the fallback
+	SetProxy("http://config-proxy:3128", "", []string{".internal.example.com"})
+
+	for target, expected := range map[string]string{
+		"http://api.example.com/":          "http://config-proxy:3128",
+		"https://api.example.com/":         "http://env-proxy:3129",
+		"http://db.internal.example.com/":  "",
+		"https://db.internal.example.com/": "",
+	} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		proxyURL, err := Proxy(req)
+		require.NoError(t, err)
+		if expected == "" {
+			assert.Nil(t, proxyURL, target)
+		} else if assert.NotNil(t, proxyURL, target) {
+			assert.Equal(t, expected, proxyURL.String(), target)
+		}
+	}
+
+	tr, err := GetTransport()
+	require.NoError(t, err)
+	assert.NotNil(t, tr.(*http.Transport).Proxy)
+}
@@ -0,0 +1,45 @@
+package httputil
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxy picks the proxy of the requests sent through the transports built by GetTransport,
+// from the standard environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) unless configured
+var proxy = struct {
+	sync.RWMutex
+	fn func(*url.URL) (*url.URL, error)
+}{
+	fn: httpproxy.FromEnvironment().ProxyFunc(),
+}
+
+// SetProxy configures the proxy of the outbound requests of the plugins:
+// the values left empty fall back to the standard environment variables
+func SetProxy(httpProxy, httpsProxy string, noProxy []string) {
+	cfg := httpproxy.FromEnvironment()
+	if httpProxy != "" {
+		cfg.HTTPProxy = httpProxy
+	}
+	if httpsProxy != "" {
+		cfg.HTTPSProxy = httpsProxy
+	}
+	if len(noProxy) > 0 {
+		cfg.NoProxy = strings.Join(noProxy, ",")
+	}
+
+	proxy.Lock()
+	defer proxy.Unlock()
+	proxy.fn = cfg.ProxyFunc()
+}
+
+// Proxy returns the proxy to use for a request, nil for a direct connection
+func Proxy(req *http.Request) (*url.URL, error) {
+	proxy.RLock()
+	defer proxy.RUnlock()
+	return proxy.fn(req.URL)
+}
@@ -0,0 +1,94 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings records the duration of the phases of an http call
+// DNS, connection and TLS phases are left empty when a connection is reused
+type Timings struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	tls          time.Duration
+	firstByte    time.Duration
+	total        time.Duration
+}
+
+// TraceRequest returns a copy of req recording its timings,
+// to be completed with Done once the response has been read
+func TraceRequest(req *http.Request) (*http.Request, *Timings) {
+	t := &Timings{}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dns = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tls = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Since(t.start)
+		},
+	}
+	t.start = time.Now()
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+// Done records the total duration of the call
+func (t *Timings) Done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total = time.Since(t.start)
+}
+
+// Metadata renders the timings in milliseconds, under the keys described by MetadataSchemaBuilder.WithTimings
+func (t *Timings) Metadata() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return map[string]interface{}{
+		"dns_ms":        milliseconds(t.dns),
+		"connect_ms":    milliseconds(t.connect),
+		"tls_ms":        milliseconds(t.tls),
+		"first_byte_ms": milliseconds(t.firstByte),
+		"total_ms":      milliseconds(t.total),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
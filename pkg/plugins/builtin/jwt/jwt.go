@@ -0,0 +1,242 @@
+package pluginjwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the jwt plugin mints a signed JSON Web Token
+// to be used as a bearer token by the following steps
+var (
+	Plugin = taskplugin.New("jwt", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+	)
+)
+
+// ExpiresInDefault is the lifetime of a token, when none is configured
+const ExpiresInDefault = "5m"
+
+// signing algorithms supported by the plugin
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+// minHMACKeyLength is the minimum length of a HS256 secret, as many bytes as the hash
+const minHMACKeyLength = sha256.Size
+
+// Config describes the token to mint
+// key:        key to retrieve the signing key from configstore: a secret for HS256, a PEM private key for RS256
+// algorithm:  HS256 or RS256
+// key_id:     set as the kid header of the token (optional)
+// claims:     the claims of the token
+// expires_in: lifetime of the token, setting its exp claim (optional, defaults to 5m)
+type Config struct {
+	Key       string                 `json:"key"`
+	Algorithm string                 `json:"algorithm"`
+	KeyID     string                 `json:"key_id,omitempty"`
+	Claims    map[string]interface{} `json:"claims"`
+	ExpiresIn string                 `json:"expires_in,omitempty"`
+}
+
+// registered claims holding a NumericDate
+var timeClaims = []string{"exp", "iat", "nbf"}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Algorithm != AlgorithmHS256 && cfg.Algorithm != AlgorithmRS256 {
+		return errors.Errorf("invalid algorithm %q, expected HS256 or RS256", cfg.Algorithm)
+	}
+	if cfg.Key == "" {
+		return errors.New("missing key")
+	}
+	if len(cfg.Claims) == 0 {
+		return errors.New("missing claims")
+	}
+	if err := validTimeClaims(cfg.Claims, true); err != nil {
+		return err
+	}
+	if cfg.ExpiresIn != "" && !strings.Contains(cfg.ExpiresIn, "{{") {
+		if _, err := parseExpiresIn(cfg.ExpiresIn); err != nil {
+			return err
+		}
+	}
+
+	// templated fields are checked at runtime
+	if !strings.Contains(cfg.Key, "{{") {
+		if _, err := loadKey(cfg.Key, cfg.Algorithm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validTimeClaims checks that the exp, iat and nbf claims are numbers
+// allowTemplates lets them be templated strings, before templating
+func validTimeClaims(claims map[string]interface{}, allowTemplates bool) error {
+	for _, name := range timeClaims {
+		v, ok := claims[name]
+		if !ok {
+			continue
+		}
+		switch t := v.(type) {
+		case float64, json.Number:
+		case string:
+			if !allowTemplates || !strings.Contains(t, "{{") {
+				return errors.Errorf("invalid %s claim %q: must be a unix timestamp", name, t)
+			}
+		default:
+			return errors.Errorf("invalid %s claim: must be a unix timestamp", name)
+		}
+	}
+	return nil
+}
+
+func parseExpiresIn(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Annotate(err, "invalid expires_in")
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("invalid expires_in %q: must be positive", s)
+	}
+	return d, nil
+}
+
+// loadKey retrieves the signing key from configstore, parsing it according to the algorithm
+func loadKey(name, algorithm string) (interface{}, error) {
+	str, err := configstore.GetItemValue(name)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve key from configstore: %s", err)
+	}
+
+	switch algorithm {
+	case AlgorithmHS256:
+		if len(str) < minHMACKeyLength {
+			return nil, errors.Errorf("invalid key: a HS256 secret must be at least %d bytes long", minHMACKeyLength)
+		}
+		return []byte(str), nil
+	case AlgorithmRS256:
+		return parseRSAKey(str)
+	}
+	return nil, errors.Errorf("invalid algorithm %q", algorithm)
+}
+
+func parseRSAKey(str string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(str))
+	if block == nil {
+		return nil, errors.New("invalid key: expected a PEM encoded RSA private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid key: not a RSA private key")
+	}
+	return rsaKey, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	key, err := loadKey(cfg.Key, cfg.Algorithm)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "")
+	}
+	if err := validTimeClaims(cfg.Claims, false); err != nil {
+		return nil, nil, errors.NewBadRequest(err, "")
+	}
+
+	expiresIn := cfg.ExpiresIn
+	if expiresIn == "" {
+		expiresIn = ExpiresInDefault
+	}
+	d, err := parseExpiresIn(expiresIn)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "")
+	}
+
+	now := time.Now()
+	claims := make(map[string]interface{}, len(cfg.Claims)+2)
+	for k, v := range cfg.Claims {
+		claims[k] = v
+	}
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(d).Unix()
+	}
+
+	token, err := sign(cfg.Algorithm, cfg.KeyID, key, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return map[string]interface{}{
+		"token":      token,
+		"expires_at": claims["exp"],
+	}, nil, nil
+}
+
+// sign builds the compact serialization of a JWT: header.claims.signature
+func sign(algorithm, keyID string, key interface{}, claims map[string]interface{}) (string, error) {
+	header := map[string]string{
+		"alg": algorithm,
+		"typ": "JWT",
+	}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", errors.Annotate(err, "failed to marshal header")
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.NewBadRequest(err, "failed to marshal claims")
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", errors.Annotate(err, "failed to sign token")
+		}
+	default:
+		return "", errors.Errorf("unsupported key type %T", key)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,121 @@
+package pluginjwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ovh/configstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hmacSecret = "0123456789abcdef0123456789abcdef"
+
+var rsaKey *rsa.PrivateKey
+
+func TestMain(m *testing.M) {
+	var err error
+	rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	configstore.RegisterProvider("tests", func() (configstore.ItemList, error) {
+		return configstore.ItemList{Items: []configstore.Item{
+			configstore.NewItem("jwt-hmac", hmacSecret, 1),
+			configstore.NewItem("jwt-hmac-short", "secret", 1),
+			configstore.NewItem("jwt-rsa", string(rsaPEM), 1),
+		}}, nil
+	})
+
+	os.Exit(m.Run())
+}
+
+func Test_validConfig(t *testing.T) {
+	claims := map[string]interface{}{"sub": "{{.input.user}}"}
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Key: "jwt-hmac", Algorithm: "HS256", Claims: claims}, true},
+		{Config{Key: "jwt-rsa", Algorithm: "RS256", KeyID: "2024", Claims: claims, ExpiresIn: "1h"}, true},
+		{Config{Key: "{{.input.key}}", Algorithm: "RS256", Claims: map[string]interface{}{"exp": "{{.input.exp}}"}}, true},
+		{Config{Key: "jwt-hmac", Algorithm: "HS512", Claims: claims}, false},
+		{Config{Key: "", Algorithm: "HS256", Claims: claims}, false},
+		{Config{Key: "jwt-hmac", Algorithm: "HS256"}, false},
+		{Config{Key: "jwt-hmac", Algorithm: "HS256", Claims: map[string]interface{}{"exp": "tomorrow"}}, false},
+		{Config{Key: "jwt-hmac", Algorithm: "HS256", Claims: claims, ExpiresIn: "-1m"}, false},
+		{Config{Key: "jwt-hmac-short", Algorithm: "HS256", Claims: claims}, false},
+		{Config{Key: "jwt-hmac", Algorithm: "RS256", Claims: claims}, false},
+		{Config{Key: "not-in-configstore", Algorithm: "HS256", Claims: claims}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func decode(t *testing.T, token string) (map[string]interface{}, map[string]interface{}, []byte) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	var header, claims map[string]interface{}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &header))
+	b, err = base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &claims))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	return header, claims, signature
+}
+
+func Test_execHS256(t *testing.T) {
+	before := time.Now().Unix()
+	output, _, err := exec("token", &Config{Key: "jwt-hmac", Algorithm: "HS256", Claims: map[string]interface{}{"sub": "jdoe"}, ExpiresIn: "10m"}, nil)
+	require.NoError(t, err)
+
+	token := output.(map[string]interface{})["token"].(string)
+	header, claims, signature := decode(t, token)
+	assert.Equal(t, map[string]interface{}{"alg": "HS256", "typ": "JWT"}, header)
+	assert.Equal(t, "jdoe", claims["sub"])
+	assert.InDelta(t, before, claims["iat"], 1)
+	assert.InDelta(t, before+600, claims["exp"], 1)
+
+	mac := hmac.New(sha256.New, []byte(hmacSecret))
+	mac.Write([]byte(token[:strings.LastIndex(token, ".")]))
+	assert.Equal(t, mac.Sum(nil), signature)
+}
+
+func Test_execRS256(t *testing.T) {
+	output, _, err := exec("token", &Config{Key: "jwt-rsa", Algorithm: "RS256", KeyID: "2024", Claims: map[string]interface{}{"sub": "jdoe", "exp": float64(4102444800)}}, nil)
+	require.NoError(t, err)
+
+	out := output.(map[string]interface{})
+	assert.Equal(t, float64(4102444800), out["expires_at"])
+	token := out["token"].(string)
+	header, claims, signature := decode(t, token)
+	assert.Equal(t, map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "2024"}, header)
+	assert.Equal(t, float64(4102444800), claims["exp"])
+
+	digest := sha256.Sum256([]byte(token[:strings.LastIndex(token, ".")]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature))
+}
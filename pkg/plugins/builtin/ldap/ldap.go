@@ -0,0 +1,312 @@
+package pluginldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the ldap plugin searches a directory for entries and their attributes
+var (
+	Plugin = taskplugin.New("ldap", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcesldap),
+	)
+)
+
+// TimeoutDefault is the timeout of a search, when none is configured
+const TimeoutDefault = "30s"
+
+var scopes = map[string]int{
+	"base": ldap.ScopeBaseObject,
+	"one":  ldap.ScopeSingleLevel,
+	"sub":  ldap.ScopeWholeSubtree,
+}
+
+// Config holds the configuration needed to run a search
+// credentials: key to retrieve the server's url and bind credentials from configstore
+// base_dn:     the entry the search starts from
+// filter:      LDAP filter matching the entries, eg. (uid=jdoe)
+// attributes:  the attributes to return (optional, defaults to all of them)
+// scope:       base, one or sub (optional, defaults to sub)
+// size_limit:  maximum number of entries returned (optional, defaults to no limit)
+// timeout:     timeout of the search (optional, defaults to 30s)
+type Config struct {
+	Credentials string   `json:"credentials"`
+	BaseDN      string   `json:"base_dn"`
+	Filter      string   `json:"filter"`
+	Attributes  []string `json:"attributes,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	SizeLimit   string   `json:"size_limit,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+}
+
+// serverConfig holds the url of a LDAP server and the credentials to bind with
+type serverConfig struct {
+	URL                string `json:"url"` // ldap://host:389 or ldaps://host:636
+	BindDN             string `json:"bind_dn,omitempty"`
+	BindPassword       string `json:"bind_password,omitempty"`
+	StartTLS           bool   `json:"start_tls,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	RootCA             string `json:"root_ca,omitempty"`
+}
+
+// Entry is an entry matched by a search, with the values of its attributes
+type Entry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Credentials == "" {
+		return errors.New("missing credentials")
+	}
+	if cfg.Filter == "" {
+		return errors.New("missing filter")
+	}
+	if cfg.Scope != "" {
+		if _, ok := scopes[cfg.Scope]; !ok {
+			return errors.Errorf("invalid scope %q, expected one of base, one, sub", cfg.Scope)
+		}
+	}
+
+	// templated fields are checked at runtime
+	if !strings.Contains(cfg.BaseDN, "{{") {
+		if _, err := ldap.ParseDN(cfg.BaseDN); err != nil {
+			return errors.Annotatef(err, "invalid base_dn %q", cfg.BaseDN)
+		}
+	}
+	if !strings.Contains(cfg.Filter, "{{") {
+		if _, err := ldap.CompileFilter(cfg.Filter); err != nil {
+			return errors.Annotatef(err, "invalid filter %q", cfg.Filter)
+		}
+	}
+	if cfg.SizeLimit != "" && !strings.Contains(cfg.SizeLimit, "{{") {
+		if _, err := parseSizeLimit(cfg.SizeLimit); err != nil {
+			return err
+		}
+	}
+	if cfg.Timeout != "" && !strings.Contains(cfg.Timeout, "{{") {
+		if _, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return errors.Annotate(err, "invalid timeout")
+		}
+	}
+
+	if !strings.Contains(cfg.Credentials, "{{") {
+		if _, err := loadServerConfig(cfg.Credentials); err != nil {
+			return err
+		}
+	} else {
+		v := values.NewValues()
+		if _, err := v.Apply(cfg.Credentials, nil, ""); err != nil {
+			return fmt.Errorf("failed to parse credentials template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func resourcesldap(i interface{}) []string {
+	cfg := i.(*Config)
+	resources := []string{
+		"socket",
+	}
+
+	srv, err := loadServerConfig(cfg.Credentials)
+	if err != nil {
+		return resources
+	}
+	if uri, _ := url.Parse(srv.URL); uri != nil && uri.Host != "" {
+		resources = append(resources, "url:"+uri.Hostname())
+	}
+	return resources
+}
+
+func loadServerConfig(credentials string) (*serverConfig, error) {
+	str, err := configstore.GetItemValue(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve credentials from configstore: %s", err)
+	}
+
+	var srv serverConfig
+	if err := json.Unmarshal([]byte(str), &srv); err != nil {
+		return nil, fmt.Errorf("can't unmarshal ldap credentials from configstore: %s", err)
+	}
+	uri, err := url.Parse(srv.URL)
+	if err != nil || (uri.Scheme != "ldap" && uri.Scheme != "ldaps") || uri.Host == "" {
+		return nil, fmt.Errorf("invalid url %q in ldap credentials, expected ldap://host:port or ldaps://host:port", srv.URL)
+	}
+	if srv.StartTLS && uri.Scheme == "ldaps" {
+		return nil, errors.New("start_tls can't be used along with an ldaps url")
+	}
+	return &srv, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	srv, err := loadServerConfig(cfg.Credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, timeout, err := searchRequest(cfg)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid search")
+	}
+
+	entries, err := search(srv, req, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	}, nil, nil
+}
+
+func searchRequest(cfg *Config) (*ldap.SearchRequest, time.Duration, error) {
+	if _, err := ldap.ParseDN(cfg.BaseDN); err != nil {
+		return nil, 0, errors.Annotatef(err, "invalid base_dn %q", cfg.BaseDN)
+	}
+	if _, err := ldap.CompileFilter(cfg.Filter); err != nil {
+		return nil, 0, errors.Annotatef(err, "invalid filter %q", cfg.Filter)
+	}
+
+	scope := ldap.ScopeWholeSubtree
+	if cfg.Scope != "" {
+		s, ok := scopes[cfg.Scope]
+		if !ok {
+			return nil, 0, errors.Errorf("invalid scope %q", cfg.Scope)
+		}
+		scope = s
+	}
+
+	sizeLimit := 0
+	if cfg.SizeLimit != "" {
+		l, err := parseSizeLimit(cfg.SizeLimit)
+		if err != nil {
+			return nil, 0, err
+		}
+		sizeLimit = l
+	}
+
+	timeout := cfg.Timeout
+	if timeout == "" {
+		timeout = TimeoutDefault
+	}
+	td, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, 0, errors.Annotate(err, "invalid timeout")
+	}
+
+	return ldap.NewSearchRequest(
+		cfg.BaseDN,
+		scope,
+		ldap.NeverDerefAliases,
+		sizeLimit,
+		int(td.Seconds()),
+		false,
+		cfg.Filter,
+		cfg.Attributes,
+		nil,
+	), td, nil
+}
+
+func search(srv *serverConfig, req *ldap.SearchRequest, timeout time.Duration) ([]Entry, error) {
+	uri, _ := url.Parse(srv.URL)
+
+	tlsConfig := &tls.Config{
+		ServerName:         uri.Hostname(),
+		InsecureSkipVerify: srv.InsecureSkipVerify, // #nosec G402: explicitly configured
+	}
+	if srv.RootCA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(srv.RootCA)) {
+			return nil, errors.New("invalid root_ca in ldap credentials")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	conn, err := ldap.DialURL(srv.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't reach ldap server: %s", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(timeout)
+
+	if srv.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to start tls: %s", err)
+		}
+	}
+
+	if srv.BindDN != "" {
+		if err := conn.Bind(srv.BindDN, srv.BindPassword); err != nil {
+			return nil, interpretError(err, "failed to bind")
+		}
+	}
+
+	res, err := conn.Search(req)
+	// a size limit reached still returns the first entries
+	if err != nil && !(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && res != nil) {
+		return nil, interpretError(err, "search failed")
+	}
+
+	return toEntries(res.Entries), nil
+}
+
+// interpretError sets the errors which won't get any better when retried as client errors
+func interpretError(err error, msg string) error {
+	if ldap.IsErrorAnyOf(err,
+		ldap.LDAPResultInvalidCredentials,
+		ldap.LDAPResultInsufficientAccessRights,
+		ldap.LDAPResultNoSuchObject,
+		ldap.LDAPResultInvalidDNSyntax,
+		ldap.LDAPResultUndefinedAttributeType,
+		ldap.LDAPResultInappropriateMatching,
+		ldap.ErrorFilterCompile,
+	) {
+		return errors.NewBadRequest(err, msg)
+	}
+	return errors.Annotate(err, msg)
+}
+
+func toEntries(entries []*ldap.Entry) []Entry {
+	ret := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		entry := Entry{DN: e.DN, Attributes: make(map[string][]string, len(e.Attributes))}
+		for _, a := range e.Attributes {
+			entry.Attributes[a.Name] = a.Values
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+func parseSizeLimit(s string) (int, error) {
+	l, err := strconv.Atoi(s)
+	if err != nil || l < 0 {
+		return 0, errors.Errorf("invalid size_limit %q: must be a positive integer", s)
+	}
+	return l, nil
+}
@@ -0,0 +1,99 @@
+package pluginldap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/engine/values"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "ou=people,dc=example,dc=org", Filter: "(uid=jdoe)"}, true},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: "(uid={{.input.login}})", Attributes: []string{"mail", "cn"}}, true},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "{{.input.base}}", Filter: "(objectClass=*)", Scope: "one", SizeLimit: "10"}, true},
+		{Config{Credentials: "", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)"}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: ""}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe"}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc", Filter: "(uid=jdoe)"}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)", Scope: "all"}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)", SizeLimit: "-1"}, false},
+		{Config{Credentials: "{{.input.directory}}", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)", Timeout: "soon"}, false},
+		{Config{Credentials: "not-in-configstore", BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_searchRequest(t *testing.T) {
+	req, timeout, err := searchRequest(&Config{BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)", Attributes: []string{"mail"}})
+	require.NoError(t, err)
+	assert.Equal(t, ldap.ScopeWholeSubtree, req.Scope)
+	assert.Equal(t, 0, req.SizeLimit)
+	assert.Equal(t, 30, req.TimeLimit)
+	assert.Equal(t, []string{"mail"}, req.Attributes)
+	assert.Equal(t, "30s", timeout.String())
+
+	req, _, err = searchRequest(&Config{BaseDN: "dc=example,dc=org", Filter: "(uid=jdoe)", Scope: "base", SizeLimit: "1", Timeout: "5s"})
+	require.NoError(t, err)
+	assert.Equal(t, ldap.ScopeBaseObject, req.Scope)
+	assert.Equal(t, 1, req.SizeLimit)
+	assert.Equal(t, 5, req.TimeLimit)
+
+	_, _, err = searchRequest(&Config{BaseDN: "dc=example,dc=org", Filter: "uid=jdoe)"})
+	assert.Error(t, err)
+}
+
+func Test_searchRequestEscapedFilter(t *testing.T) {
+	v := values.NewValues()
+	v.SetInput(map[string]interface{}{"login": "*)(uid=*"})
+
+	// an escaped input matches a single uid, whatever it holds
+	filter, err := v.Apply("(uid={{.input.login | ldapEscape}})", nil, "")
+	require.NoError(t, err)
+	req, _, err := searchRequest(&Config{BaseDN: "dc=example,dc=org", Filter: string(filter)})
+	require.NoError(t, err)
+	assert.Equal(t, `(uid=\2a\29\28uid=\2a)`, req.Filter)
+
+	compiled, err := ldap.CompileFilter(req.Filter)
+	require.NoError(t, err)
+	assert.Equal(t, ldap.FilterEqualityMatch, int(compiled.Tag))
+}
+
+func Test_toEntries(t *testing.T) {
+	entries := toEntries([]*ldap.Entry{
+		ldap.NewEntry("uid=jdoe,ou=people,dc=example,dc=org", map[string][]string{
+			"mail": {"jdoe@example.org"},
+			"cn":   {"John Doe", "Johnny"},
+		}),
+	})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "uid=jdoe,ou=people,dc=example,dc=org", entries[0].DN)
+	assert.Equal(t, []string{"jdoe@example.org"}, entries[0].Attributes["mail"])
+	assert.Equal(t, []string{"John Doe", "Johnny"}, entries[0].Attributes["cn"])
+
+	assert.NotNil(t, toEntries(nil))
+}
+
+func Test_interpretError(t *testing.T) {
+	err := interpretError(ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")), "failed to bind")
+	assert.True(t, errors.IsBadRequest(err))
+
+	err = interpretError(ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")), "search failed")
+	assert.False(t, errors.IsBadRequest(err))
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	ping "github.com/go-ping/ping"
@@ -20,6 +24,23 @@ var (
 	)
 )
 
+const (
+	// ProtocolICMP sends icmp echo requests (the default)
+	ProtocolICMP = "icmp"
+	// ProtocolTCP opens tcp connections to a port, where icmp is filtered
+	ProtocolTCP = "tcp"
+
+	// maxConcurrentTargets is the number of targets pinged simultaneously
+	maxConcurrentTargets = 10
+)
+
+// networks maps the ip versions to the networks resolving the addresses of the hosts
+var networks = map[string]string{
+	"":  "ip",
+	"4": "ip4",
+	"6": "ip6",
+}
+
 // based on Statistics struct from github.com/sparrc/go-ping /w json tags
 type pingStats struct {
 	PacketsRecv int             `json:"packets_received"`
@@ -33,19 +54,110 @@ type pingStats struct {
 	StdDevRtt   time.Duration   `json:"std_dev_rtt"`
 }
 
+// targetResult is the result of the pings of one of the targets:
+// a target succeeds when it replied to at least one ping
+type targetResult struct {
+	Success bool          `json:"success"`
+	Latency time.Duration `json:"latency"` // average round-trip time
+	Error   string        `json:"error,omitempty"`
+	*pingStats
+}
+
+// targetsOutput is the result of the pings of a list of targets
+type targetsOutput struct {
+	Targets map[string]*targetResult `json:"targets"`
+	Failed  []string                 `json:"failed"`
+	Total   int                      `json:"total"`
+}
+
 // Config is the configuration needed to send a ping
+// either to a single hostname, or to a list of targets: in that case the step fails
+// when the fraction of targets not replying exceeds failure_threshold (0 by default, any failure)
+// the hosts are probed with icmp, or with tcp connections to a port;
+// ip_version restricts the resolution of their names to IPv4 ("4") or IPv6 ("6") addresses
 type Config struct {
-	Hostname string `json:"hostname"`
-	Count    string `json:"count,omitempty"`
-	Interval string `json:"interval_second,omitempty"`
+	Hostname         string   `json:"hostname,omitempty"`
+	Targets          []string `json:"targets,omitempty"`
+	FailureThreshold string   `json:"failure_threshold,omitempty"`
+	Protocol         string   `json:"protocol,omitempty"`
+	Port             string   `json:"port,omitempty"`
+	IPVersion        string   `json:"ip_version,omitempty"`
+	Count            string   `json:"count,omitempty"`
+	Interval         string   `json:"interval_second,omitempty"`
+}
+
+// Metadata holds the configuration of the step, along with the family (ipv4 or ipv6)
+// of the address of the hostname, or of the address of each of the targets
+type Metadata struct {
+	*Config
+	AddressFamily   string            `json:"address_family,omitempty"`
+	AddressFamilies map[string]string `json:"address_families,omitempty"`
+}
+
+// probe describes how the hosts are pinged
+type probe struct {
+	protocol string
+	network  string
+	port     string
+	count    int
+	interval time.Duration
+}
+
+// pinger is the subset of ping.Pinger used by the plugin
+type pinger interface {
+	Run() error
+	Statistics() *ping.Statistics
+}
+
+var newPinger = func(addr string, pr probe) (pinger, error) {
+	// IPv6 addresses may be given between brackets, as in urls
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	if pr.protocol == ProtocolTCP {
+		return newTCPPinger(addr, pr)
+	}
+
+	p := ping.New(addr)
+	p.SetNetwork(pr.network)
+	if err := p.Resolve(); err != nil {
+		return nil, err
+	}
+	p.Count = pr.count
+	p.Interval = pr.interval
+	return p, nil
 }
 
 func validConfig(config interface{}) error {
 	cfg := config.(*Config)
 
-	if cfg.Hostname == "" {
+	if cfg.Hostname == "" && len(cfg.Targets) == 0 {
 		return errors.New("hostname is missing")
 	}
+	if cfg.Hostname != "" && len(cfg.Targets) > 0 {
+		return errors.New("hostname and targets are mutually exclusive")
+	}
+	for _, t := range cfg.Targets {
+		if t == "" {
+			return errors.New("empty target")
+		}
+	}
+
+	if cfg.FailureThreshold != "" {
+		if len(cfg.Targets) == 0 {
+			return errors.New("failure_threshold requires targets")
+		}
+		if !strings.Contains(cfg.FailureThreshold, "{{") {
+			if _, err := parseFailureThreshold(cfg.FailureThreshold); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !strings.Contains(cfg.Protocol, "{{") && !strings.Contains(cfg.Port, "{{") && !strings.Contains(cfg.IPVersion, "{{") {
+		if _, err := parseProbe(cfg); err != nil {
+			return err
+		}
+	}
 
 	if cfg.Count != "" {
 		if _, err := strconv.ParseUint(cfg.Count, 10, 64); err != nil {
@@ -62,30 +174,176 @@ func validConfig(config interface{}) error {
 	return nil
 }
 
+// parseProbe checks the protocol, port and ip version of the configuration,
+// the count and interval being parsed separately
+func parseProbe(cfg *Config) (probe, error) {
+	pr := probe{
+		protocol: strings.ToLower(cfg.Protocol),
+		port:     cfg.Port,
+	}
+
+	switch pr.protocol {
+	case "":
+		pr.protocol = ProtocolICMP
+	case ProtocolICMP, ProtocolTCP:
+	default:
+		return pr, fmt.Errorf("invalid protocol %q: expected %s or %s", cfg.Protocol, ProtocolICMP, ProtocolTCP)
+	}
+
+	if pr.protocol == ProtocolTCP {
+		if cfg.Port == "" {
+			return pr, errors.New("port is missing, required by the tcp protocol")
+		}
+		if port, err := strconv.ParseUint(cfg.Port, 10, 16); err != nil || port == 0 {
+			return pr, fmt.Errorf("invalid port %q", cfg.Port)
+		}
+	} else if cfg.Port != "" {
+		return pr, errors.New("port is only used by the tcp protocol")
+	}
+
+	network, ok := networks[cfg.IPVersion]
+	if !ok {
+		return pr, fmt.Errorf("invalid ip_version %q: expected 4 or 6", cfg.IPVersion)
+	}
+	pr.network = network
+
+	return pr, nil
+}
+
+// addressFamily returns the family of a resolved address, ipv4 or ipv6
+func addressFamily(ipAddr *net.IPAddr) string {
+	switch {
+	case ipAddr == nil || ipAddr.IP == nil:
+		return ""
+	case ipAddr.IP.To4() != nil:
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+func parseFailureThreshold(s string) (float64, error) {
+	threshold, err := strconv.ParseFloat(s, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return 0, fmt.Errorf("invalid failure_threshold %q: expected a fraction between 0 and 1", s)
+	}
+	return threshold, nil
+}
+
 func resourcesping(i interface{}) []string {
 	cfg := i.(*Config)
 
-	return []string{
+	resources := []string{
 		"socket",
-		"url:" + cfg.Hostname,
 	}
+	if cfg.Hostname != "" {
+		resources = append(resources, "url:"+cfg.Hostname)
+	}
+	for _, t := range cfg.Targets {
+		resources = append(resources, "url:"+t)
+	}
+	return resources
 }
 
 func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
 	cfg := config.(*Config)
 
-	pinger, err := ping.NewPinger(cfg.Hostname)
+	pr, err := parseProbe(cfg)
 	if err != nil {
-		return nil, nil, fmt.Errorf("can't initiate ping: %s", err.Error())
+		return nil, nil, err
 	}
+	pr.count = pingDefault(cfg.Count)
+	pr.interval = time.Duration(pingDefault(cfg.Interval)) * time.Second
 
-	pinger.Count = pingDefault(cfg.Count)
-	pinger.Interval = time.Duration(pingDefault(cfg.Interval)) * time.Second
+	if len(cfg.Targets) > 0 {
+		return execTargets(cfg, pr)
+	}
+
+	p, err := newPinger(cfg.Hostname, pr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't initiate ping: %s", err.Error())
+	}
 
 	// Run() is blocking until count is done
-	pinger.Run()
+	p.Run()
+
+	so := p.Statistics()
+	return statistics(so), &Metadata{Config: cfg, AddressFamily: addressFamily(so.IPAddr)}, nil
+}
+
+// execTargets pings all the targets, failing when too many of them didn't reply
+func execTargets(cfg *Config, pr probe) (interface{}, interface{}, error) {
+	metadata := &Metadata{Config: cfg, AddressFamilies: make(map[string]string, len(cfg.Targets))}
 
-	so := pinger.Statistics()
+	threshold := float64(0)
+	if cfg.FailureThreshold != "" {
+		var err error
+		if threshold, err = parseFailureThreshold(cfg.FailureThreshold); err != nil {
+			return nil, metadata, err
+		}
+	}
+
+	output := &targetsOutput{
+		Targets: make(map[string]*targetResult, len(cfg.Targets)),
+		Failed:  []string{},
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentTargets)
+	for _, target := range cfg.Targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, family := pingTarget(target, pr)
+			mu.Lock()
+			output.Targets[target] = res
+			if family != "" {
+				metadata.AddressFamilies[target] = family
+			}
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	for target, res := range output.Targets {
+		if !res.Success {
+			output.Failed = append(output.Failed, target)
+		}
+	}
+	sort.Strings(output.Failed)
+	output.Total = len(output.Targets)
+
+	if float64(len(output.Failed)) > threshold*float64(output.Total) {
+		return output, metadata, fmt.Errorf("%d of %d targets failed, more than the failure_threshold (%v): %s",
+			len(output.Failed), output.Total, threshold, strings.Join(output.Failed, ", "))
+	}
+	return output, metadata, nil
+}
+
+// pingTarget pings one of the targets, returning the family of its address once resolved
+func pingTarget(target string, pr probe) (*targetResult, string) {
+	p, err := newPinger(target, pr)
+	if err != nil {
+		return &targetResult{Error: fmt.Sprintf("can't initiate ping: %s", err.Error())}, ""
+	}
+	family := addressFamily(p.Statistics().IPAddr)
+	if err := p.Run(); err != nil {
+		return &targetResult{Error: err.Error()}, family
+	}
+
+	stats := statistics(p.Statistics())
+	return &targetResult{
+		Success:   stats.PacketsRecv > 0,
+		Latency:   stats.AvgRtt,
+		pingStats: stats,
+	}, family
+}
+
+func statistics(so *ping.Statistics) *pingStats {
 	// ping library can return some invalid float64 values, let's prevent this.
 	if math.IsNaN(so.PacketLoss) || math.IsInf(so.PacketLoss, 0) {
 		so.PacketLoss = float64(0)
@@ -101,7 +359,7 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		MaxRtt:      so.MaxRtt,
 		AvgRtt:      so.AvgRtt,
 		StdDevRtt:   so.StdDevRtt,
-	}, cfg, nil
+	}
 }
 
 func pingDefault(c string) int {
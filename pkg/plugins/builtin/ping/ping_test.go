@@ -0,0 +1,171 @@
+package ping
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	goping "github.com/go-ping/ping"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct {
+	stats *goping.Statistics
+	err   error
+}
+
+func (p *fakePinger) Run() error                     { return p.err }
+func (p *fakePinger) Statistics() *goping.Statistics { return p.stats }
+
+func fakePingers(t *testing.T, pingers map[string]*fakePinger) {
+	prev := newPinger
+	newPinger = func(addr string, pr probe) (pinger, error) {
+		p, ok := pingers[addr]
+		if !ok {
+			return nil, errors.New("unknown host")
+		}
+		return p, nil
+	}
+	t.Cleanup(func() { newPinger = prev })
+}
+
+func replied(ip string, rtt time.Duration) *fakePinger {
+	return &fakePinger{stats: &goping.Statistics{
+		PacketsRecv: 1,
+		PacketsSent: 1,
+		IPAddr:      &net.IPAddr{IP: net.ParseIP(ip)},
+		Rtts:        []time.Duration{rtt},
+		MinRtt:      rtt,
+		MaxRtt:      rtt,
+		AvgRtt:      rtt,
+	}}
+}
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Hostname: "example.org", Count: "2"}, true},
+		{Config{Targets: []string{"a.example.org", "b.example.org"}}, true},
+		{Config{Targets: []string{"a.example.org"}, FailureThreshold: "0.5"}, true},
+		{Config{Targets: []string{"a.example.org"}, FailureThreshold: "{{.input.threshold}}"}, true},
+		{Config{}, false},
+		{Config{Hostname: "example.org", Targets: []string{"a.example.org"}}, false},
+		{Config{Targets: []string{"a.example.org", ""}}, false},
+		{Config{Hostname: "example.org", FailureThreshold: "0.5"}, false},
+		{Config{Targets: []string{"a.example.org"}, FailureThreshold: "50%"}, false},
+		{Config{Targets: []string{"a.example.org"}, FailureThreshold: "1.5"}, false},
+		{Config{Hostname: "2001:db8::1", Protocol: "tcp", Port: "443", IPVersion: "6"}, true},
+		{Config{Hostname: "example.org", Protocol: "ICMP", IPVersion: "4"}, true},
+		{Config{Hostname: "example.org", Protocol: "{{.input.protocol}}", Port: "{{.input.port}}"}, true},
+		{Config{Hostname: "example.org", Protocol: "udp"}, false},
+		{Config{Hostname: "example.org", Protocol: "tcp"}, false},
+		{Config{Hostname: "example.org", Protocol: "tcp", Port: "70000"}, false},
+		{Config{Hostname: "example.org", Port: "443"}, false},
+		{Config{Hostname: "example.org", IPVersion: "5"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_execTargets(t *testing.T) {
+	fakePingers(t, map[string]*fakePinger{
+		"a.example.org": replied("192.0.2.1", 10*time.Millisecond),
+		"b.example.org": replied("192.0.2.2", 20*time.Millisecond),
+		"c.example.org": {stats: &goping.Statistics{PacketsSent: 1, IPAddr: &net.IPAddr{IP: net.ParseIP("192.0.2.3")}}},
+		"d.example.org": {stats: &goping.Statistics{IPAddr: &net.IPAddr{IP: net.ParseIP("2001:db8::4")}}, err: errors.New("socket: permission denied")},
+	})
+
+	output, _, err := exec("test", &Config{Targets: []string{"a.example.org", "b.example.org"}}, nil)
+	require.NoError(t, err)
+	out := output.(*targetsOutput)
+	assert.Equal(t, 2, out.Total)
+	assert.Empty(t, out.Failed)
+	assert.True(t, out.Targets["b.example.org"].Success)
+	assert.Equal(t, 20*time.Millisecond, out.Targets["b.example.org"].Latency)
+	assert.Equal(t, "192.0.2.2", out.Targets["b.example.org"].IPAddr)
+
+	targets := []string{"a.example.org", "b.example.org", "c.example.org", "d.example.org", "e.example.org"}
+
+	output, metadata, err := exec("test", &Config{Targets: targets, FailureThreshold: "0.6"}, nil)
+	require.NoError(t, err)
+	out = output.(*targetsOutput)
+	assert.Equal(t, []string{"c.example.org", "d.example.org", "e.example.org"}, out.Failed)
+	assert.False(t, out.Targets["c.example.org"].Success)
+	assert.Equal(t, "socket: permission denied", out.Targets["d.example.org"].Error)
+	assert.Contains(t, out.Targets["e.example.org"].Error, "unknown host")
+	assert.Equal(t, map[string]string{
+		"a.example.org": "ipv4",
+		"b.example.org": "ipv4",
+		"c.example.org": "ipv4",
+		"d.example.org": "ipv6",
+	}, metadata.(*Metadata).AddressFamilies)
+
+	output, _, err = exec("test", &Config{Targets: targets, FailureThreshold: "0.5"}, nil)
+	assert.EqualError(t, err, "3 of 5 targets failed, more than the failure_threshold (0.5): c.example.org, d.example.org, e.example.org")
+	assert.NotNil(t, output)
+
+	_, _, err = exec("test", &Config{Targets: []string{"a.example.org", "c.example.org"}}, nil)
+	assert.Error(t, err)
+}
+
+func Test_tcpPing(t *testing.T) {
+	for _, tc := range []struct {
+		listen    string
+		family    string
+		ipVersion string
+	}{
+		{"127.0.0.1:0", "ipv4", "4"},
+		{"[::1]:0", "ipv6", "6"},
+	} {
+		l, err := net.Listen("tcp", tc.listen)
+		if err != nil {
+			t.Logf("skipping %s: %s", tc.family, err)
+			continue
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		host, port, err := net.SplitHostPort(l.Addr().String())
+		require.NoError(t, err)
+
+		// IPv6 addresses are accepted between brackets
+		if tc.family == "ipv6" {
+			host = "[" + host + "]"
+		}
+
+		output, metadata, err := exec("test", &Config{Hostname: host, Protocol: "tcp", Port: port, IPVersion: tc.ipVersion}, nil)
+		require.NoError(t, err, tc.family)
+		stats := output.(*pingStats)
+		assert.Equal(t, 1, stats.PacketsSent, tc.family)
+		assert.Equal(t, 1, stats.PacketsRecv, tc.family)
+		assert.Equal(t, float64(0), stats.PacketLoss, tc.family)
+		assert.Equal(t, tc.family, metadata.(*Metadata).AddressFamily)
+
+		l.Close()
+		output, _, err = exec("test", &Config{Targets: []string{host}, Protocol: "tcp", Port: port}, nil)
+		assert.Error(t, err, tc.family)
+		res := output.(*targetsOutput).Targets[host]
+		assert.False(t, res.Success, tc.family)
+		assert.Equal(t, float64(100), res.PacketLoss, tc.family)
+	}
+}
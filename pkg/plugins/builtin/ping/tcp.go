@@ -0,0 +1,92 @@
+package ping
+
+import (
+	"math"
+	"net"
+	"time"
+
+	ping "github.com/go-ping/ping"
+)
+
+// tcpTimeout is the timeout of each connection of a tcp ping
+const tcpTimeout = 5 * time.Second
+
+// tcpPinger pings a host by opening tcp connections to one of its ports, where icmp is filtered:
+// the round-trip time is the time taken to establish a connection, a refused connection is lost
+type tcpPinger struct {
+	ipAddr   *net.IPAddr
+	port     string
+	count    int
+	interval time.Duration
+	stats    *ping.Statistics
+}
+
+func newTCPPinger(addr string, pr probe) (*tcpPinger, error) {
+	ipAddr, err := net.ResolveIPAddr(pr.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpPinger{
+		ipAddr:   ipAddr,
+		port:     pr.port,
+		count:    pr.count,
+		interval: pr.interval,
+		stats:    &ping.Statistics{IPAddr: ipAddr, Addr: addr},
+	}, nil
+}
+
+// Run is blocking until count is done
+func (p *tcpPinger) Run() error {
+	address := net.JoinHostPort(p.ipAddr.String(), p.port)
+	for i := 0; i < p.count; i++ {
+		if i > 0 {
+			time.Sleep(p.interval)
+		}
+		p.stats.PacketsSent++
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, tcpTimeout)
+		if err != nil {
+			continue
+		}
+		p.stats.Rtts = append(p.stats.Rtts, time.Since(start))
+		p.stats.PacketsRecv++
+		conn.Close()
+	}
+	p.computeStats()
+	return nil
+}
+
+func (p *tcpPinger) Statistics() *ping.Statistics {
+	return p.stats
+}
+
+// computeStats computes the statistics of the round-trip times, as the icmp pinger does
+func (p *tcpPinger) computeStats() {
+	s := p.stats
+	if s.PacketsSent > 0 {
+		s.PacketLoss = float64(s.PacketsSent-s.PacketsRecv) / float64(s.PacketsSent) * 100
+	}
+	if len(s.Rtts) == 0 {
+		return
+	}
+
+	var total time.Duration
+	s.MinRtt, s.MaxRtt = s.Rtts[0], s.Rtts[0]
+	for _, rtt := range s.Rtts {
+		if rtt < s.MinRtt {
+			s.MinRtt = rtt
+		}
+		if rtt > s.MaxRtt {
+			s.MaxRtt = rtt
+		}
+		total += rtt
+	}
+	s.AvgRtt = total / time.Duration(len(s.Rtts))
+
+	var sumSquares float64
+	for _, rtt := range s.Rtts {
+		d := float64(rtt - s.AvgRtt)
+		sumSquares += d * d
+	}
+	s.StdDevRtt = time.Duration(math.Sqrt(sumSquares / float64(len(s.Rtts))))
+}
@@ -0,0 +1,251 @@
+package pluginpoll
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/juju/errors"
+
+	pluginhttp "github.com/cneill/utask/pkg/plugins/builtin/http"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// the poll plugin sends an HTTP request at an interval until its response is the expected one,
+// or until a deadline, instead of combining retries of http and assert steps
+var (
+	Plugin = taskplugin.New("poll", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcespoll),
+	)
+)
+
+const (
+	// IntervalDefault is the duration between two attempts, when none is configured
+	IntervalDefault = "10s"
+	// TimeoutDefault is how long the plugin polls before giving up, when none is configured
+	TimeoutDefault = "5m"
+)
+
+// Config describes the polling
+// http:            the request sent on each attempt, configured as for the http plugin
+// expected_status: the statuses of a successful response (optional, defaults to any 2xx status)
+// condition:       a jq expression evaluated against the response, which must yield true (optional)
+// interval:        duration between two attempts (optional, defaults to 10s)
+// timeout:         how long to poll before failing the step (optional, defaults to 5m)
+type Config struct {
+	HTTP           json.RawMessage `json:"http"`
+	ExpectedStatus []string        `json:"expected_status,omitempty"`
+	Condition      string          `json:"condition,omitempty"`
+	Interval       string          `json:"interval,omitempty"`
+	Timeout        string          `json:"timeout,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if len(cfg.HTTP) == 0 {
+		return errors.New("missing http request")
+	}
+	if err := pluginhttp.Plugin.ValidConfig(nil, cfg.HTTP); err != nil {
+		return errors.Annotate(err, "invalid http request")
+	}
+
+	for _, status := range cfg.ExpectedStatus {
+		if !strings.Contains(status, "{{") {
+			if _, err := parseStatus(status); err != nil {
+				return err
+			}
+		}
+	}
+
+	// templated conditions are compiled at runtime
+	if cfg.Condition != "" && !strings.Contains(cfg.Condition, "{{") {
+		if _, err := compileCondition(cfg.Condition); err != nil {
+			return err
+		}
+	}
+
+	for name, val := range map[string]string{"interval": cfg.Interval, "timeout": cfg.Timeout} {
+		if val != "" && !strings.Contains(val, "{{") {
+			if _, err := parseDuration(name, val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func resourcespoll(i interface{}) []string {
+	cfg := i.(*Config)
+	return pluginhttp.Plugin.Resources(nil, cfg.HTTP)
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	interval, err := parseDurationDefault("interval", cfg.Interval, IntervalDefault)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid configuration")
+	}
+	timeout, err := parseDurationDefault("timeout", cfg.Timeout, TimeoutDefault)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid configuration")
+	}
+
+	expected := make(map[int]bool, len(cfg.ExpectedStatus))
+	for _, s := range cfg.ExpectedStatus {
+		status, err := parseStatus(s)
+		if err != nil {
+			return nil, nil, errors.NewBadRequest(err, "invalid configuration")
+		}
+		expected[status] = true
+	}
+
+	var condition *gojq.Code
+	if cfg.Condition != "" {
+		condition, err = compileCondition(cfg.Condition)
+		if err != nil {
+			return nil, nil, errors.NewBadRequest(err, "invalid configuration")
+		}
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		output, metadata, _, err := pluginhttp.Plugin.Exec(stepName, nil, cfg.HTTP, ctx)
+		lastErr = check(output, metadata, err, expected, condition)
+		if lastErr == nil {
+			return output, withPollMetadata(metadata, attempt, time.Since(start)), nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, withPollMetadata(metadata, attempt, time.Since(start)),
+				errors.NewBadRequest(lastErr, fmt.Sprintf("still not successful after %d attempts over %s", attempt, timeout))
+		}
+		if interval < remaining {
+			remaining = interval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// check tells whether the response to an attempt is the expected one, returning why it isn't
+func check(output, metadata interface{}, execErr error, expected map[int]bool, condition *gojq.Code) error {
+	status := 0
+	headers := map[string]string{}
+	if m, ok := metadata.(map[string]interface{}); ok {
+		status, _ = m[taskplugin.HTTPStatus].(int)
+		if h, ok := m[taskplugin.HTTPHeaders].(map[string]string); ok {
+			headers = h
+		}
+	}
+
+	switch {
+	case status == 0:
+		// no response at all
+		return execErr
+	case len(expected) > 0 && !expected[status]:
+		return errors.Errorf("unexpected status %d", status)
+	case len(expected) == 0 && execErr != nil:
+		return execErr
+	}
+
+	if condition == nil {
+		return nil
+	}
+	ok, err := evalCondition(condition, map[string]interface{}{
+		"status":  status,
+		"headers": headers,
+		"body":    output,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("condition not met")
+	}
+	return nil
+}
+
+// evalCondition runs the condition against the response, which must yield true as its single result
+func evalCondition(condition *gojq.Code, response map[string]interface{}) (bool, error) {
+	// gojq normalizes numbers in place: work on a copy of the response,
+	// not to alter the output of the step
+	ba, err := utils.JSONMarshal(response)
+	if err != nil {
+		return false, err
+	}
+	var data interface{}
+	if err := utils.JSONnumberUnmarshal(bytes.NewReader(ba), &data); err != nil {
+		return false, err
+	}
+
+	iter := condition.Run(data)
+	res, ok := iter.Next()
+	if !ok {
+		return false, nil
+	}
+	if err, ok := res.(error); ok {
+		return false, errors.Annotate(err, "failed to evaluate condition")
+	}
+	b, ok := res.(bool)
+	return ok && b, nil
+}
+
+func compileCondition(condition string) (*gojq.Code, error) {
+	q, err := gojq.Parse(condition)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid condition %q", condition)
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid condition %q", condition)
+	}
+	return code, nil
+}
+
+func parseStatus(s string) (int, error) {
+	status, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || status < 100 || status > 599 {
+		return 0, errors.Errorf("invalid expected status %q", s)
+	}
+	return status, nil
+}
+
+func parseDurationDefault(name, val, def string) (time.Duration, error) {
+	if val == "" {
+		val = def
+	}
+	return parseDuration(name, val)
+}
+
+func parseDuration(name, val string) (time.Duration, error) {
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, errors.Annotatef(err, "invalid %s", name)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("invalid %s %q: must be positive", name, val)
+	}
+	return d, nil
+}
+
+// withPollMetadata adds the description of the polling to the metadata of the last response
+func withPollMetadata(metadata interface{}, attempts int, elapsed time.Duration) interface{} {
+	m, ok := metadata.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+	}
+	m["attempts"] = attempts
+	m["elapsed"] = elapsed.Round(time.Millisecond).String()
+	return m
+}
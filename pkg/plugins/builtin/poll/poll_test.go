@@ -0,0 +1,109 @@
+package pluginpoll
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func httpConfig(url string) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{"url":%q,"method":"GET"}`, url))
+}
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{HTTP: httpConfig("https://example.org")}, true},
+		{Config{HTTP: httpConfig("https://example.org"), ExpectedStatus: []string{"200", "{{.input.status}}"}, Condition: `.body.state == "ready"`, Interval: "1s", Timeout: "1m"}, true},
+		{Config{HTTP: httpConfig("https://example.org"), Condition: `.body.state == "{{.input.state}}"`}, true},
+		{Config{}, false},
+		{Config{HTTP: json.RawMessage(`{"url":"https://example.org","method":"FETCH"}`)}, false},
+		{Config{HTTP: httpConfig("https://example.org"), ExpectedStatus: []string{"ok"}}, false},
+		{Config{HTTP: httpConfig("https://example.org"), ExpectedStatus: []string{"42"}}, false},
+		{Config{HTTP: httpConfig("https://example.org"), Condition: `.body.state ==`}, false},
+		{Config{HTTP: httpConfig("https://example.org"), Interval: "often"}, false},
+		{Config{HTTP: httpConfig("https://example.org"), Timeout: "-1m"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_exec(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/job":
+			w.Header().Set("Content-Type", "application/json")
+			switch n {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"state":"unknown"}`))
+			case 2:
+				w.Write([]byte(`{"state":"running","progress":50}`))
+			default:
+				w.Write([]byte(`{"state":"done","progress":100}`))
+			}
+		case "/deleted":
+			if n < 2 {
+				w.Write([]byte(`still there`))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"state":"running"}`))
+		}
+	}))
+	defer srv.Close()
+
+	output, metadata, err := exec("test", &Config{
+		HTTP:      httpConfig(srv.URL + "/job"),
+		Condition: `.body.state == "done" and .body.progress == 100`,
+		Interval:  "10ms",
+		Timeout:   "5s",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"state": "done", "progress": json.Number("100")}, output)
+	m := metadata.(map[string]interface{})
+	assert.Equal(t, 3, m["attempts"])
+	assert.Equal(t, http.StatusOK, m["HTTPStatus"])
+
+	atomic.StoreInt32(&calls, 0)
+	_, metadata, err = exec("test", &Config{
+		HTTP:           httpConfig(srv.URL + "/deleted"),
+		ExpectedStatus: []string{"404"},
+		Interval:       "10ms",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, metadata.(map[string]interface{})["attempts"])
+
+	_, _, err = exec("test", &Config{
+		HTTP:      httpConfig(srv.URL + "/stuck"),
+		Condition: `.body.state == "done"`,
+		Interval:  "10ms",
+		Timeout:   "50ms",
+	}, nil)
+	require.Error(t, err)
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Contains(t, err.Error(), "condition not met")
+
+	_, _, err = exec("test", &Config{HTTP: httpConfig(srv.URL), Interval: "sometimes"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+}
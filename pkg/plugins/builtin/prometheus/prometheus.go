@@ -0,0 +1,377 @@
+package pluginprometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ovh/configstore"
+
+	"github.com/cneill/utask/engine/values"
+	"github.com/cneill/utask/pkg/plugins/builtin/httputil"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the prometheus plugin runs a PromQL query against a Prometheus server
+// allowing the following steps to branch on the value of a metric
+var (
+	Plugin = taskplugin.New("prometheus", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcesprometheus),
+	)
+)
+
+// TimeoutDefault is the timeout of a query, when none is configured
+const TimeoutDefault = "30s"
+
+// Config holds the configuration needed to run a query
+// credentials: key to retrieve the server's url and credentials from configstore
+// query:       PromQL expression
+// time:        evaluation time of an instant query (optional, defaults to now)
+// start, end:  time range of a range query (end is optional, defaults to now)
+// step:        resolution of a range query, mandatory along with start
+// timeout:     timeout of the query (optional, defaults to 30s)
+type Config struct {
+	Credentials string `json:"credentials"`
+	Query       string `json:"query"`
+	Time        string `json:"time,omitempty"`
+	Start       string `json:"start,omitempty"`
+	End         string `json:"end,omitempty"`
+	Step        string `json:"step,omitempty"`
+	Timeout     string `json:"timeout,omitempty"`
+}
+
+// serverConfig holds the url of a Prometheus server and the credentials to query it
+type serverConfig struct {
+	URL                string `json:"url"`
+	Username           string `json:"username,omitempty"`
+	Password           string `json:"password,omitempty"`
+	BearerToken        string `json:"bearer_token,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// Sample is a single value of a vector or of a series, with its timestamp in seconds;
+// special values (NaN, +Inf, -Inf) are kept as strings
+type Sample struct {
+	Metric map[string]string `json:"metric,omitempty"`
+	Time   float64           `json:"time"`
+	Value  interface{}       `json:"value"`
+}
+
+// Series is the list of values of a time series, returned by a range query
+type Series struct {
+	Metric map[string]string `json:"metric"`
+	Values []Sample          `json:"values"`
+}
+
+// Output is the result of a query:
+// value holds a scalar or string result, or the value of the first sample of a vector
+type Output struct {
+	ResultType string      `json:"result_type"`
+	Value      interface{} `json:"value,omitempty"`
+	Samples    []Sample    `json:"samples,omitempty"`
+	Series     []Series    `json:"series,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Credentials == "" {
+		return errors.New("missing credentials")
+	}
+	if strings.TrimSpace(cfg.Query) == "" {
+		return errors.New("missing query")
+	}
+
+	if cfg.Start != "" || cfg.End != "" || cfg.Step != "" {
+		if cfg.Time != "" {
+			return errors.New("time can't be set along with the start, end and step of a range query")
+		}
+		if cfg.Start == "" || cfg.Step == "" {
+			return errors.New("a range query requires a start and a step")
+		}
+	}
+
+	// templated fields are checked at runtime
+	for name, val := range map[string]string{"time": cfg.Time, "start": cfg.Start, "end": cfg.End} {
+		if val != "" && !strings.Contains(val, "{{") {
+			if _, err := parseTime(val); err != nil {
+				return errors.Annotatef(err, "invalid %s", name)
+			}
+		}
+	}
+	for name, val := range map[string]string{"step": cfg.Step, "timeout": cfg.Timeout} {
+		if val != "" && !strings.Contains(val, "{{") {
+			if d, err := time.ParseDuration(val); err != nil {
+				return errors.Annotatef(err, "invalid %s", name)
+			} else if d <= 0 {
+				return errors.Errorf("invalid %s %q: must be positive", name, val)
+			}
+		}
+	}
+
+	if !strings.Contains(cfg.Credentials, "{{") {
+		if _, err := loadServerConfig(cfg.Credentials); err != nil {
+			return err
+		}
+	} else {
+		v := values.NewValues()
+		if _, err := v.Apply(cfg.Credentials, nil, ""); err != nil {
+			return fmt.Errorf("failed to parse credentials template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func resourcesprometheus(i interface{}) []string {
+	cfg := i.(*Config)
+	resources := []string{
+		"socket",
+	}
+
+	srv, err := loadServerConfig(cfg.Credentials)
+	if err != nil {
+		return resources
+	}
+	if uri, _ := url.Parse(srv.URL); uri != nil && uri.Host != "" {
+		resources = append(resources, "url:"+uri.Host)
+	}
+	return resources
+}
+
+func loadServerConfig(credentials string) (*serverConfig, error) {
+	str, err := configstore.GetItemValue(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve credentials from configstore: %s", err)
+	}
+
+	var srv serverConfig
+	if err := json.Unmarshal([]byte(str), &srv); err != nil {
+		return nil, fmt.Errorf("can't unmarshal prometheus credentials from configstore: %s", err)
+	}
+	if srv.URL == "" {
+		return nil, errors.New("missing url in prometheus credentials")
+	}
+	return &srv, nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	srv, err := loadServerConfig(cfg.Credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return query(srv, cfg)
+}
+
+// query runs an instant query, or a range query when a start is configured
+func query(srv *serverConfig, cfg *Config) (interface{}, interface{}, error) {
+	params := url.Values{}
+	params.Set("query", cfg.Query)
+
+	path := "/api/v1/query"
+	if cfg.Start != "" {
+		path = "/api/v1/query_range"
+		end := cfg.End
+		if end == "" {
+			end = strconv.FormatInt(time.Now().Unix(), 10)
+		}
+		for name, val := range map[string]string{"start": cfg.Start, "end": end} {
+			t, err := parseTime(val)
+			if err != nil {
+				return nil, nil, errors.NewBadRequest(err, "invalid "+name)
+			}
+			params.Set(name, t)
+		}
+		step, err := time.ParseDuration(cfg.Step)
+		if err != nil || step <= 0 {
+			return nil, nil, errors.NewBadRequest(err, fmt.Sprintf("invalid step %q", cfg.Step))
+		}
+		params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	} else if cfg.Time != "" {
+		t, err := parseTime(cfg.Time)
+		if err != nil {
+			return nil, nil, errors.NewBadRequest(err, "invalid time")
+		}
+		params.Set("time", t)
+	}
+
+	timeout := cfg.Timeout
+	if timeout == "" {
+		timeout = TimeoutDefault
+	}
+	td, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid timeout")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(srv.URL, "/")+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if srv.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+srv.BearerToken)
+	} else if srv.Username != "" {
+		req.SetBasicAuth(srv.Username, srv.Password)
+	}
+
+	opts := []func(*http.Transport) error{}
+	if srv.InsecureSkipVerify {
+		opts = append(opts, httputil.WithTLSInsecureSkipVerify(true))
+	}
+	tr, err := httputil.GetTransport(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := httputil.NewHTTPClient(httputil.HTTPClientConfig{Timeout: td, Transport: tr})
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query prometheus: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read prometheus response: %s", err)
+	}
+
+	var apiResp struct {
+		Status    string          `json:"status"`
+		ErrorType string          `json:"errorType"`
+		Error     string          `json:"error"`
+		Data      json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal prometheus response (status %d): %s", resp.StatusCode, err)
+	}
+	if apiResp.Status != "success" {
+		err := fmt.Errorf("prometheus query failed (%s): %s", apiResp.ErrorType, apiResp.Error)
+		// bad queries won't get any better when retried
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, nil, errors.NewBadRequest(err, "")
+		}
+		return nil, nil, err
+	}
+
+	output, err := parseData(apiResp.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, map[string]interface{}{"status_code": resp.StatusCode}, nil
+}
+
+// parseTime accepts RFC3339 times and unix timestamps, and returns them in a format understood by Prometheus
+func parseTime(val string) (string, error) {
+	val = strings.TrimSpace(val)
+	if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return val, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil {
+		return "", errors.Errorf("%q is neither a RFC3339 time nor a unix timestamp", val)
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+func parseData(data json.RawMessage) (*Output, error) {
+	var d struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prometheus result: %s", err)
+	}
+
+	output := &Output{ResultType: d.ResultType}
+	switch d.ResultType {
+	case "scalar", "string":
+		var pair []interface{}
+		if err := json.Unmarshal(d.Result, &pair); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prometheus %s: %s", d.ResultType, err)
+		}
+		s, err := parseSample(pair)
+		if err != nil {
+			return nil, err
+		}
+		if d.ResultType == "string" {
+			s.Value = pair[1]
+		}
+		output.Value = s.Value
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}
+		if err := json.Unmarshal(d.Result, &vector); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prometheus vector: %s", err)
+		}
+		output.Samples = make([]Sample, 0, len(vector))
+		for _, v := range vector {
+			s, err := parseSample(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			s.Metric = v.Metric
+			output.Samples = append(output.Samples, s)
+		}
+		if len(output.Samples) > 0 {
+			output.Value = output.Samples[0].Value
+		}
+	case "matrix":
+		var matrix []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		}
+		if err := json.Unmarshal(d.Result, &matrix); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prometheus matrix: %s", err)
+		}
+		output.Series = make([]Series, 0, len(matrix))
+		for _, m := range matrix {
+			series := Series{Metric: m.Metric, Values: make([]Sample, 0, len(m.Values))}
+			for _, pair := range m.Values {
+				s, err := parseSample(pair)
+				if err != nil {
+					return nil, err
+				}
+				series.Values = append(series.Values, s)
+			}
+			output.Series = append(output.Series, series)
+		}
+	default:
+		return nil, fmt.Errorf("unknown prometheus result type %q", d.ResultType)
+	}
+	return output, nil
+}
+
+// parseSample converts a [<timestamp>, "<value>"] pair
+func parseSample(pair []interface{}) (Sample, error) {
+	if len(pair) != 2 {
+		return Sample{}, fmt.Errorf("invalid prometheus sample %v", pair)
+	}
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid prometheus sample timestamp %v", pair[0])
+	}
+	str, ok := pair[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid prometheus sample value %v", pair[1])
+	}
+	s := Sample{Time: ts, Value: str}
+	if f, err := strconv.ParseFloat(str, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		s.Value = f
+	}
+	return s, nil
+}
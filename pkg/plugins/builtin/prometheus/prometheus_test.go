@@ -0,0 +1,109 @@
+package pluginprometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Credentials: "{{.input.server}}", Query: "up"}, true},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Time: "2024-06-01T22:00:00Z"}, true},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Start: "{{.input.since}}", Step: "1m"}, true},
+		{Config{Credentials: "", Query: "up"}, false},
+		{Config{Credentials: "{{.input.server}}", Query: " "}, false},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Time: "yesterday"}, false},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Start: "1717279200"}, false},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Start: "1717279200", Step: "-1m"}, false},
+		{Config{Credentials: "{{.input.server}}", Query: "up", Time: "1717279200", Start: "1717279200", Step: "1m"}, false},
+		{Config{Credentials: "not-in-configstore", Query: "up"}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_query(t *testing.T) {
+	var form map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "utask", user)
+		assert.Equal(t, "secret", pass)
+
+		switch {
+		case r.URL.Path == "/api/v1/query" && r.PostForm.Get("query") == "bad(":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		case r.URL.Path == "/api/v1/query":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"instance":"a"},"value":[1717279200,"0.15"]},
+				{"metric":{"instance":"b"},"value":[1717279200,"NaN"]}
+			]}}`))
+		case r.URL.Path == "/api/v1/query_range":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"instance":"a"},"values":[[1717279200,"1"],[1717279260,"2"]]}
+			]}}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"error","errorType":"unavailable","error":"down"}`))
+		}
+	}))
+	defer srv.Close()
+
+	server := &serverConfig{URL: srv.URL + "/", Username: "utask", Password: "secret"}
+
+	output, _, err := query(server, &Config{Query: "avg(cpu)", Time: "2024-06-01T22:00:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06-01T22:00:00Z", form["time"][0])
+	out := output.(*Output)
+	assert.Equal(t, "vector", out.ResultType)
+	assert.Equal(t, 0.15, out.Value)
+	require.Len(t, out.Samples, 2)
+	assert.Equal(t, map[string]string{"instance": "a"}, out.Samples[0].Metric)
+	assert.Equal(t, "NaN", out.Samples[1].Value)
+	_, err = json.Marshal(out)
+	assert.NoError(t, err)
+
+	output, _, err = query(server, &Config{Query: "cpu", Start: "1717279200", End: "1717279260", Step: "1m"})
+	require.NoError(t, err)
+	assert.Equal(t, "60", form["step"][0])
+	out = output.(*Output)
+	assert.Equal(t, "matrix", out.ResultType)
+	require.Len(t, out.Series, 1)
+	assert.Equal(t, []Sample{{Time: 1717279200, Value: float64(1)}, {Time: 1717279260, Value: float64(2)}}, out.Series[0].Values)
+
+	_, _, err = query(server, &Config{Query: "bad("})
+	assert.True(t, errors.IsBadRequest(err))
+
+	_, _, err = query(&serverConfig{URL: srv.URL + "/down", Username: "utask", Password: "secret"}, &Config{Query: "up"})
+	assert.Error(t, err)
+	assert.False(t, errors.IsBadRequest(err))
+}
+
+func Test_parseData(t *testing.T) {
+	out, err := parseData(json.RawMessage(`{"resultType":"scalar","result":[1717279200,"12.5"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, out.Value)
+
+	out, err = parseData(json.RawMessage(`{"resultType":"vector","result":[]}`))
+	require.NoError(t, err)
+	assert.Nil(t, out.Value)
+	assert.Empty(t, out.Samples)
+}
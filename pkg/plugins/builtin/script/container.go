@@ -0,0 +1,203 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	gexec "os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/cneill/utask"
+)
+
+const (
+	// containerScriptsFolder is where the scripts folder is mounted in the containers, read-only
+	containerScriptsFolder = "/utask/scripts"
+
+	// containerStopDelay is the time given to the container runtime to remove a container
+	// after the cancellation of its script, before the runtime itself is killed
+	containerStopDelay = 10 * time.Second
+)
+
+// containerRuntime is the CLI of the container runtime running the scripts configured with a container,
+// compatible with the docker CLI (docker, podman, nerdctl...), along with the host folders the containers may mount
+var containerRuntime = struct {
+	sync.RWMutex
+	cli           string
+	allowedMounts []string
+}{
+	cli: "docker",
+}
+
+// SetContainerRuntime configures the CLI of the container runtime, "docker" by default
+func SetContainerRuntime(cli string) {
+	containerRuntime.Lock()
+	defer containerRuntime.Unlock()
+	containerRuntime.cli = cli
+}
+
+// SetAllowedMounts configures the host folders which can be mounted in the containers, along with their content
+// none by default: the containers only get the scripts folder
+func SetAllowedMounts(folders []string) error {
+	allowed := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !filepath.IsAbs(folder) {
+			return fmt.Errorf("invalid folder %q: path must be absolute", folder)
+		}
+		allowed = append(allowed, resolvePath(folder))
+	}
+
+	containerRuntime.Lock()
+	defer containerRuntime.Unlock()
+	containerRuntime.allowedMounts = allowed
+	return nil
+}
+
+// resolvePath cleans a host path and resolves its symbolic links, for it not to escape an allowed folder
+// a path which doesn't exist yet is only cleaned, the runtime creating it as a folder
+func resolvePath(p string) string {
+	p = filepath.Clean(p)
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		return resolved
+	}
+	return p
+}
+
+// mountAllowed tells whether a host path is one of the allowed folders, or within one of them
+func mountAllowed(hostPath string) bool {
+	hostPath = resolvePath(hostPath)
+
+	containerRuntime.RLock()
+	defer containerRuntime.RUnlock()
+	for _, folder := range containerRuntime.allowedMounts {
+		if hostPath == folder || strings.HasPrefix(hostPath, strings.TrimSuffix(folder, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Container is a container image in which a script runs, instead of running on the host:
+// the scripts folder is mounted read-only in the container, as its working directory
+type Container struct {
+	Image       string            `json:"image"`
+	Mounts      []string          `json:"mounts,omitempty"` // host_path:container_path[:ro|rw]
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+func (c *Container) valid() error {
+	if c.Image == "" {
+		return errors.New("image is missing")
+	}
+	for _, mount := range c.Mounts {
+		if err := validMount(mount); err != nil {
+			return err
+		}
+	}
+	return validEnvironment(c.Environment)
+}
+
+// validEnvironment checks the names of environment variables
+func validEnvironment(env map[string]string) error {
+	for k := range env {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("invalid environment variable name %q", k)
+		}
+	}
+	return nil
+}
+
+func validMount(mount string) error {
+	parts := strings.Split(mount, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid mount %q, expected host_path:container_path[:ro|rw]", mount)
+	}
+	if !filepath.IsAbs(parts[0]) || !path.IsAbs(parts[1]) {
+		return fmt.Errorf("invalid mount %q: paths must be absolute", mount)
+	}
+	if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+		return fmt.Errorf("invalid mount %q: mode must be ro or rw", mount)
+	}
+	if !mountAllowed(parts[0]) {
+		return fmt.Errorf("invalid mount %q: %s is not within the folders allowed by script_container_mounts", mount, parts[0])
+	}
+	return nil
+}
+
+// environment returns the variables of the container, sorted by name
+func (c *Container) environment() []string {
+	keys := make([]string, 0, len(c.Environment))
+	for k := range c.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+c.Environment[k])
+	}
+	return env
+}
+
+// command builds the command running a script in a container, with the given environment:
+// the limits of the script apply to the container, which is removed when the script ends or is cancelled
+func (c *Container) command(ctx context.Context, l limits, file string, argv []string, env []string) *gexec.Cmd {
+	containerRuntime.RLock()
+	cli := containerRuntime.cli
+	containerRuntime.RUnlock()
+
+	scriptsFolder, err := filepath.Abs(utask.FScriptsFolder)
+	if err != nil {
+		scriptsFolder = utask.FScriptsFolder
+	}
+	name := "utask-script-" + uuid.Must(uuid.NewV4()).String()
+
+	args := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"-v", scriptsFolder + ":" + containerScriptsFolder + ":ro",
+		"-w", containerScriptsFolder,
+	}
+	for _, mount := range c.Mounts {
+		args = append(args, "-v", mount)
+	}
+	// the variables are only named on the command line, their values are read by the runtime
+	// from its own environment: they don't show in the process listings
+	names := map[string]bool{}
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		if !names[name] {
+			names[name] = true
+			args = append(args, "-e", name)
+		}
+	}
+	if l.memoryBytes > 0 {
+		args = append(args, "--memory", fmt.Sprint(l.memoryBytes), "--memory-swap", fmt.Sprint(l.memoryBytes))
+	}
+	if l.cpuTime > 0 {
+		seconds := int64(l.cpuTime / time.Second)
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", seconds, seconds))
+	}
+	args = append(args, c.Image, "./"+file)
+	args = append(args, argv...)
+
+	cmd := gexec.CommandContext(ctx, cli, args...)
+	// the environment of the host is only given to the container runtime
+	cmd.Env = append(os.Environ(), env...)
+	// killing the runtime CLI would leave the container running
+	cmd.Cancel = func() error {
+		rmCtx, cancel := context.WithTimeout(context.Background(), containerStopDelay)
+		defer cancel()
+		_ = gexec.CommandContext(rmCtx, cli, "rm", "-f", name).Run()
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = containerStopDelay
+	return cmd
+}
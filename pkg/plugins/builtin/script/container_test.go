@@ -0,0 +1,96 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+)
+
+func allowMounts(t *testing.T, folders ...string) {
+	require.NoError(t, SetAllowedMounts(folders))
+	t.Cleanup(func() { _ = SetAllowedMounts(nil) })
+}
+
+func Test_validMount(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(allowed, "sub"), 0o755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(allowed, "escape")))
+
+	// no folder is allowed by default
+	assert.Error(t, validMount(allowed+":/data"))
+
+	allowMounts(t, allowed)
+	for _, mount := range []string{
+		allowed + ":/data",
+		allowed + "/:/data:ro",
+		allowed + "/sub:/data:rw",
+		allowed + "/not-created-yet:/data",
+	} {
+		assert.NoError(t, validMount(mount), mount)
+	}
+
+	for _, mount := range []string{
+		outside + ":/data",
+		allowed + "/../" + filepath.Base(outside) + ":/data",
+		allowed + "/escape:/data",
+		allowed + "-sibling:/data",
+		"/:/data",
+		"relative:/data",
+		allowed + ":relative",
+		allowed + ":/data:rx",
+		allowed,
+	} {
+		assert.Error(t, validMount(mount), mount)
+	}
+
+	// the folders allowed must be absolute
+	assert.Error(t, SetAllowedMounts([]string{"relative"}))
+}
+
+func TestExecContainerScriptEnvironment(t *testing.T) {
+	// a fake container runtime, echoing its arguments and the variables it got for the container
+	writeScript(t, "runtime.sh", "#!/bin/sh\necho \"{\\\"task\\\":\\\"$UTASK_TASK_ID\\\",\\\"resolution\\\":\\\"$UTASK_RESOLUTION_ID\\\",\\\"step\\\":\\\"$UTASK_STEP_NAME\\\",\\\"foo\\\":\\\"$FOO\\\",\\\"args\\\":\\\"$*\\\"}\"\n")
+	SetContainerRuntime(filepath.Join(utask.FScriptsFolder, "runtime.sh"))
+	defer SetContainerRuntime("docker")
+
+	shared := t.TempDir()
+	allowMounts(t, shared)
+
+	cfg := &Config{
+		File:        "script.sh",
+		Environment: map[string]interface{}{"FOO": "from-environment"},
+		Container: &Container{
+			Image:  "alpine",
+			Mounts: []string{shared + ":/shared:ro"},
+		},
+	}
+	output, _, err := exec("stepOne", cfg, &ScriptContext{TaskID: "task-id", ResolutionID: "resolution-id"})
+	require.NoError(t, err)
+
+	// the UTASK_* variables and the environment of the step reach the container
+	out := output.(map[string]interface{})
+	assert.Equal(t, "task-id", out["task"])
+	assert.Equal(t, "resolution-id", out["resolution"])
+	assert.Equal(t, "stepOne", out["step"])
+	assert.Equal(t, "from-environment", out["foo"])
+
+	// named only on the command line of the runtime, along with the mounts
+	args := strings.Fields(out["args"].(string))
+	for _, name := range []string{"UTASK_TASK_ID", "UTASK_RESOLUTION_ID", "UTASK_STEP_NAME", "FOO"} {
+		assert.Contains(t, args, name)
+	}
+	assert.NotContains(t, out["args"], "from-environment")
+	assert.Contains(t, args, shared+":/shared:ro")
+
+	// a mount not allowed anymore is refused when the step runs
+	require.NoError(t, SetAllowedMounts(nil))
+	_, _, err = exec("stepOne", cfg, &ScriptContext{})
+	assert.Error(t, err)
+}
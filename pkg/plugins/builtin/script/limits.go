@@ -0,0 +1,152 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	gexec "os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cneill/utask"
+)
+
+// MaxOutputBytesDefault is the default maximum size of the output of a script,
+// if not defined in the step nor in the global configuration
+const MaxOutputBytesDefault = 10 * 1024 * 1024
+
+// limits bound the resources of a script: its memory and cpu time are rlimits,
+// applied by a shell wrapping its execution, its output is capped while being read
+type limits struct {
+	memoryBytes int64         // address space, 0 for unlimited
+	cpuTime     time.Duration // 0 for unlimited
+	outputBytes int64
+}
+
+var defaultLimits = struct {
+	sync.RWMutex
+	limits
+}{
+	limits: limits{outputBytes: MaxOutputBytesDefault},
+}
+
+// SetDefaultLimits configures the limits of the scripts whose steps don't set their own
+func SetDefaultLimits(cfg utask.ScriptLimitsConfig) error {
+	l := limits{outputBytes: MaxOutputBytesDefault}
+	if cfg.MaxMemoryBytes < 0 {
+		return fmt.Errorf("invalid max_memory_bytes %d: must be positive", cfg.MaxMemoryBytes)
+	}
+	l.memoryBytes = cfg.MaxMemoryBytes
+	if cfg.MaxOutputBytes < 0 {
+		return fmt.Errorf("invalid max_output_bytes %d: must be positive", cfg.MaxOutputBytes)
+	} else if cfg.MaxOutputBytes > 0 {
+		l.outputBytes = cfg.MaxOutputBytes
+	}
+	if cfg.MaxCPUTime != "" {
+		cpuTime, err := parseCPUTime(cfg.MaxCPUTime)
+		if err != nil {
+			return err
+		}
+		l.cpuTime = cpuTime
+	}
+
+	defaultLimits.Lock()
+	defer defaultLimits.Unlock()
+	defaultLimits.limits = l
+	return nil
+}
+
+// stepLimits returns the limits of a step, falling back to the default limits
+func stepLimits(cfg *Config) (limits, error) {
+	defaultLimits.RLock()
+	l := defaultLimits.limits
+	defaultLimits.RUnlock()
+
+	var err error
+	if cfg.MaxMemoryBytes != "" {
+		if l.memoryBytes, err = parseMaxBytes(cfg.MaxMemoryBytes, "max_memory_bytes"); err != nil {
+			return l, err
+		}
+	}
+	if cfg.MaxOutputBytes != "" {
+		if l.outputBytes, err = parseMaxBytes(cfg.MaxOutputBytes, "max_output_bytes"); err != nil {
+			return l, err
+		}
+	}
+	if cfg.MaxCPUTime != "" {
+		if l.cpuTime, err = parseCPUTime(cfg.MaxCPUTime); err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+// parseMaxBytes parses a maximum size in bytes, which must be positive
+func parseMaxBytes(value string, name string) (int64, error) {
+	maxBytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", name, err)
+	}
+	if maxBytes < 1 {
+		return 0, fmt.Errorf("invalid %s %d: must be positive", name, maxBytes)
+	}
+	return maxBytes, nil
+}
+
+// parseCPUTime parses a cpu time, applied with the precision of a second
+func parseCPUTime(value string) (time.Duration, error) {
+	cpuTime, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse max_cpu_time field %q: %s", value, err.Error())
+	}
+	if cpuTime < time.Second {
+		return 0, fmt.Errorf("invalid max_cpu_time %q: must be at least 1s", value)
+	}
+	return cpuTime, nil
+}
+
+// command builds the command running a script, through a shell setting the rlimits of the script
+// before replacing itself by it: the script fails to start if the limits can't be applied
+func (l limits) command(ctx context.Context, file string, argv []string) *gexec.Cmd {
+	if l.memoryBytes == 0 && l.cpuTime == 0 {
+		return gexec.CommandContext(ctx, file, argv...)
+	}
+
+	script := ""
+	if l.memoryBytes > 0 {
+		// ulimit -v is expressed in kilobytes
+		script += fmt.Sprintf("ulimit -v %d && ", max(l.memoryBytes/1024, 1))
+	}
+	if l.cpuTime > 0 {
+		script += fmt.Sprintf("ulimit -t %d && ", int64(l.cpuTime/time.Second))
+	}
+	script += `exec "$0" "$@"`
+
+	return gexec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script, file}, argv...)...)
+}
+
+var errOutputExceeded = errors.New("output exceeds max_output_bytes")
+
+// limitedOutput collects the output of a script, up to its limit:
+// beyond, the script is killed by the cancellation of its context
+type limitedOutput struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+	cancel   context.CancelFunc
+}
+
+func (o *limitedOutput) Write(p []byte) (int, error) {
+	if o.exceeded {
+		return 0, errOutputExceeded
+	}
+	if remaining := o.max - int64(o.buf.Len()); int64(len(p)) > remaining {
+		o.buf.Write(p[:remaining])
+		o.exceeded = true
+		o.cancel()
+		return int(remaining), errOutputExceeded
+	}
+	return o.buf.Write(p)
+}
@@ -0,0 +1,134 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+)
+
+func TestLimitedOutput(t *testing.T) {
+	cancelled := false
+	o := &limitedOutput{max: 10, cancel: func() { cancelled = true }}
+
+	n, err := o.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	n, err = o.Write([]byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.False(t, o.exceeded)
+	assert.False(t, cancelled)
+
+	// the output is truncated at its limit, and the script cancelled
+	n, err = o.Write([]byte("!"))
+	assert.Equal(t, errOutputExceeded, err)
+	assert.Equal(t, 0, n)
+	assert.True(t, o.exceeded)
+	assert.True(t, cancelled)
+	assert.Equal(t, "helloworld", o.buf.String())
+
+	// and the following writes are refused
+	n, err = o.Write([]byte("more"))
+	assert.Equal(t, errOutputExceeded, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "helloworld", o.buf.String())
+
+	// a write crossing the limit is partially kept
+	cancelled = false
+	o = &limitedOutput{max: 8, cancel: func() { cancelled = true }}
+	n, err = o.Write([]byte("hello world"))
+	assert.Equal(t, errOutputExceeded, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "hello wo", o.buf.String())
+	assert.True(t, cancelled)
+}
+
+func TestLimitsCommand(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := limits{}.command(ctx, "./script.sh", []string{"foo"})
+	assert.Equal(t, []string{"./script.sh", "foo"}, cmd.Args)
+
+	cmd = limits{memoryBytes: 10 * 1024 * 1024}.command(ctx, "./script.sh", []string{"foo"})
+	assert.Equal(t, []string{"/bin/sh", "-c", `ulimit -v 10240 && exec "$0" "$@"`, "./script.sh", "foo"}, cmd.Args)
+
+	// the memory limit is expressed in kilobytes, at least one
+	cmd = limits{memoryBytes: 100}.command(ctx, "./script.sh", nil)
+	assert.Equal(t, []string{"/bin/sh", "-c", `ulimit -v 1 && exec "$0" "$@"`, "./script.sh"}, cmd.Args)
+
+	cmd = limits{memoryBytes: 2048, cpuTime: 90 * time.Second}.command(ctx, "./script.sh", []string{"foo", "bar"})
+	assert.Equal(t, []string{"/bin/sh", "-c", `ulimit -v 2 && ulimit -t 90 && exec "$0" "$@"`, "./script.sh", "foo", "bar"}, cmd.Args)
+
+	// the wrapped script runs with its arguments
+	out, err := limits{memoryBytes: 1 << 30, cpuTime: time.Minute}.command(ctx, "/bin/echo", []string{"foo", "bar baz"}).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "foo bar baz\n", string(out))
+
+	// and is killed once its context is cancelled
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = limits{cpuTime: time.Minute}.command(ctx, "/bin/sleep", []string{"10"}).Run()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestParseCPUTime(t *testing.T) {
+	cpuTime, err := parseCPUTime("90s")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cpuTime)
+
+	cpuTime, err = parseCPUTime("1s")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, cpuTime)
+
+	_, err = parseCPUTime("500ms")
+	assert.EqualError(t, err, `invalid max_cpu_time "500ms": must be at least 1s`)
+	_, err = parseCPUTime("-1m")
+	assert.Error(t, err)
+	_, err = parseCPUTime("soon")
+	assert.Error(t, err)
+}
+
+func TestStepLimits(t *testing.T) {
+	defer func() { require.NoError(t, SetDefaultLimits(utask.ScriptLimitsConfig{})) }()
+
+	l, err := stepLimits(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, limits{outputBytes: MaxOutputBytesDefault}, l)
+
+	require.NoError(t, SetDefaultLimits(utask.ScriptLimitsConfig{MaxMemoryBytes: 1024, MaxCPUTime: "1m", MaxOutputBytes: 2048}))
+	l, err = stepLimits(&Config{})
+	require.NoError(t, err)
+	assert.Equal(t, limits{memoryBytes: 1024, cpuTime: time.Minute, outputBytes: 2048}, l)
+
+	// the limits of a step override the default ones
+	l, err = stepLimits(&Config{MaxMemoryBytes: "4096", MaxCPUTime: "2s", MaxOutputBytes: "10"})
+	require.NoError(t, err)
+	assert.Equal(t, limits{memoryBytes: 4096, cpuTime: 2 * time.Second, outputBytes: 10}, l)
+
+	_, err = stepLimits(&Config{MaxOutputBytes: "0"})
+	assert.Error(t, err)
+	_, err = stepLimits(&Config{MaxMemoryBytes: "lots"})
+	assert.Error(t, err)
+
+	assert.Error(t, SetDefaultLimits(utask.ScriptLimitsConfig{MaxMemoryBytes: -1}))
+	assert.Error(t, SetDefaultLimits(utask.ScriptLimitsConfig{MaxOutputBytes: -1}))
+	assert.Error(t, SetDefaultLimits(utask.ScriptLimitsConfig{MaxCPUTime: "0s"}))
+}
+
+func TestExecMaxOutputBytes(t *testing.T) {
+	writeScript(t, "verbose.sh", "#!/bin/sh\nwhile true; do echo verbose; done\n")
+
+	start := time.Now()
+	_, metadata, err := exec("stepOne", &Config{File: "verbose.sh", MaxOutputBytes: "20"}, &ScriptContext{})
+	assert.True(t, errors.IsBadRequest(err))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "verbose\nverbose\nverb", metadata.(map[string]interface{})[outputMetadataKey])
+}
@@ -12,8 +12,11 @@ import (
 	"syscall"
 	"time"
 
+	jujuerrors "github.com/juju/errors"
+
 	"github.com/cneill/utask"
 
+	"github.com/cneill/utask/engine/values"
 	"github.com/cneill/utask/pkg/plugins/builtin/scriptutil"
 	"github.com/cneill/utask/pkg/plugins/taskplugin"
 )
@@ -54,6 +57,11 @@ type Config struct {
 	OutputManualDelimiters []string               `json:"output_manual_delimiters"`
 	ExitCodesUnrecoverable []string               `json:"exit_codes_unrecoverable"`
 	Environment            map[string]interface{} `json:"environment,omitempty"`
+	Env                    map[string]string      `json:"env,omitempty"` // overrides environment, never written on a command line
+	MaxMemoryBytes         string                 `json:"max_memory_bytes,omitempty"`
+	MaxCPUTime             string                 `json:"max_cpu_time,omitempty"`
+	MaxOutputBytes         string                 `json:"max_output_bytes,omitempty"`
+	Container              *Container             `json:"container,omitempty"`
 }
 
 // ScriptContext is the metadata inherited from the task
@@ -105,6 +113,20 @@ func validConfig(config interface{}) error {
 		}
 	}
 
+	if _, err := stepLimits(cfg); err != nil {
+		return err
+	}
+
+	if err := validEnvironment(cfg.Env); err != nil {
+		return err
+	}
+
+	if cfg.Container != nil {
+		if err := cfg.Container.valid(); err != nil {
+			return fmt.Errorf("invalid container: %s", err)
+		}
+	}
+
 	switch cfg.OutputMode {
 	case "":
 		// default will have to be reset in exec as config modification will not be persisted
@@ -156,32 +178,59 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 		cfg.OutputMode = scriptutil.OutputModeManualLastLine
 	}
 
+	limits, err := stepLimits(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	ctxe, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := gexec.CommandContext(ctxe, fmt.Sprintf("./%s", cfg.File), cfg.Argv...)
-	cmd.Env = append(
-		os.Environ(),
+	env := []string{
 		fmt.Sprintf("UTASK_TASK_ID=%s", scriptContext.TaskID),
 		fmt.Sprintf("UTASK_RESOLUTION_ID=%s", scriptContext.ResolutionID),
 		fmt.Sprintf("UTASK_STEP_NAME=%s", stepName),
-	)
-	cmd.Dir = utask.FScriptsFolder
-	cmd.Stdin = strings.NewReader(cfg.Stdin)
-
+	}
 	for k, v := range cfg.Environment {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	if cfg.Container != nil {
+		env = append(env, cfg.Container.environment()...)
+	}
+	// the last value of a variable wins
+	for k, v := range cfg.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	var cmd *gexec.Cmd
+	if cfg.Container != nil {
+		// the template may have been validated before the allowed mounts were configured
+		if err := cfg.Container.valid(); err != nil {
+			return nil, nil, jujuerrors.BadRequestf("invalid container: %s", err)
+		}
+		cmd = cfg.Container.command(ctxe, limits, cfg.File, cfg.Argv, env)
+	} else {
+		cmd = limits.command(ctxe, fmt.Sprintf("./%s", cfg.File), cfg.Argv)
+		cmd.Env = append(os.Environ(), env...)
 	}
+	cmd.Dir = utask.FScriptsFolder
+	cmd.Stdin = strings.NewReader(cfg.Stdin)
 
 	exitCode := 0
 	metaError := ""
 
+	// combine stdout and stderr, killing the script beyond its max output
+	combined := &limitedOutput{max: limits.outputBytes, cancel: cancel}
+	cmd.Stdout = combined
+	cmd.Stderr = combined
+
 	// start exec time timer
 	timer := time.Now()
 	// execute script
-	out, err := cmd.CombinedOutput()
+	err = cmd.Run()
 	// evaluate exec time
 	execTime := time.Since(timer)
+	out := combined.buf.Bytes()
 
 	if err != nil {
 		if exitError, ok := err.(*gexec.ExitError); ok {
@@ -198,12 +247,18 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 
 	outStr := string(out)
 
+	// the values marked as secret are redacted, the script echoing them from its env included,
+	// the other values of env are reported as is
 	metadata := map[string]interface{}{
 		exitCodeMetadataKey:      fmt.Sprint(exitCode),
 		processStateMetadataKey:  pState,
-		outputMetadataKey:        outStr,
+		outputMetadataKey:        values.RedactString(outStr),
 		executionTimeMetadataKey: execTime.String(),
-		errorMetadataKey:         metaError,
+		errorMetadataKey:         values.RedactString(metaError),
+	}
+
+	if combined.exceeded {
+		return nil, metadata, jujuerrors.NewBadRequest(nil, fmt.Sprintf("output of the script exceeds max_output_bytes (%d bytes)", limits.outputBytes))
 	}
 
 	output := make(map[string]interface{})
@@ -218,8 +273,8 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 	}
 
 	if exitCode != 0 {
-		return output, metadata, scriptutil.FormatErrorExitCode(exitCode, cfg.ExitCodesUnrecoverable, err)
+		return values.Redact(output), metadata, scriptutil.FormatErrorExitCode(exitCode, cfg.ExitCodesUnrecoverable, err)
 	}
 
-	return output, metadata, nil
+	return values.Redact(output), metadata, nil
 }
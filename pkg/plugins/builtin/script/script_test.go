@@ -0,0 +1,64 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/engine/values"
+)
+
+// writeScript writes an executable script in a temporary scripts folder
+func writeScript(t *testing.T, name, content string) {
+	prevFolder := utask.FScriptsFolder
+	utask.FScriptsFolder = t.TempDir()
+	t.Cleanup(func() { utask.FScriptsFolder = prevFolder })
+
+	require.NoError(t, os.WriteFile(filepath.Join(utask.FScriptsFolder, name), []byte(content), 0o755))
+}
+
+func TestExecRedactsSecretEnv(t *testing.T) {
+	writeScript(t, "token.sh", "#!/bin/sh\necho \"token: $TOKEN, region: $REGION\"\necho \"{\\\"token\\\":\\\"$TOKEN\\\",\\\"region\\\":\\\"$REGION\\\"}\"\n")
+
+	// a value marked as secret, as by the secret template function
+	values.RegisterSecret("s3cr3t-t0ken")
+	defer values.ResetSecrets()
+
+	cfg := &Config{
+		File: "token.sh",
+		Env:  map[string]string{"TOKEN": "s3cr3t-t0ken", "REGION": "eu-west-1"},
+	}
+	output, metadata, err := exec("stepOne", cfg, &ScriptContext{})
+	require.NoError(t, err)
+
+	// only the value marked as secret is redacted
+	assert.Equal(t, map[string]interface{}{"token": values.RedactedValue, "region": "eu-west-1"}, output)
+	meta := metadata.(map[string]interface{})
+	assert.Equal(t, "token: ***, region: eu-west-1\n{\"token\":\"***\",\"region\":\"eu-west-1\"}\n", meta[outputMetadataKey])
+}
+
+func TestExecContainerEnv(t *testing.T) {
+	// a fake container runtime, echoing the variables it got for the container
+	writeScript(t, "runtime.sh", "#!/bin/sh\necho \"{\\\"foo\\\":\\\"$FOO\\\",\\\"bar\\\":\\\"$BAR\\\"}\"\n")
+	SetContainerRuntime(filepath.Join(utask.FScriptsFolder, "runtime.sh"))
+	defer SetContainerRuntime("docker")
+
+	cfg := &Config{
+		File:        "script.sh",
+		Environment: map[string]interface{}{"FOO": "from-environment", "BAR": "from-environment"},
+		Env:         map[string]string{"FOO": "from-env"},
+		Container: &Container{
+			Image:       "alpine",
+			Environment: map[string]string{"FOO": "from-container", "BAR": "from-container"},
+		},
+	}
+	output, _, err := exec("stepOne", cfg, &ScriptContext{})
+	require.NoError(t, err)
+
+	// env overrides the environment of the container, which overrides the environment of the step
+	assert.Equal(t, map[string]interface{}{"foo": "from-env", "bar": "from-container"}, output)
+}
@@ -0,0 +1,226 @@
+package pluginstatsd
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+)
+
+// the statsd plugin sends a metric to a StatsD (or DogStatsD) endpoint
+// allowing tasks to record custom business metrics
+var (
+	Plugin = taskplugin.New("statsd", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithResources(resourcesstatsd),
+	)
+)
+
+// DefaultAddress is the StatsD endpoint metrics are sent to, when none is configured
+const DefaultAddress = "localhost:8125"
+
+// sendTimeout bounds the time spent reaching the StatsD endpoint
+const sendTimeout = 5 * time.Second
+
+// metric types, and their notation in the StatsD protocol
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+	TypeTiming  = "timing"
+)
+
+var protocolTypes = map[string]string{
+	TypeCounter: "c",
+	TypeGauge:   "g",
+	TypeTiming:  "ms",
+}
+
+// Config describes the metric to send
+// address: the host:port of the StatsD endpoint, reached over UDP (optional)
+// metric:  the name of the metric
+// type:    counter, gauge or timing
+// value:   a number, usually obtained through templating (optional for counters, defaults to 1)
+// tags:    DogStatsD tags attached to the metric (optional)
+type Config struct {
+	Address string            `json:"address,omitempty"`
+	Metric  string            `json:"metric"`
+	Type    string            `json:"type"`
+	Value   string            `json:"value,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	if cfg.Metric == "" {
+		return errors.New("missing metric")
+	}
+	if _, ok := protocolTypes[cfg.Type]; !ok {
+		return errors.Errorf("invalid type %q, expected one of %s, %s, %s", cfg.Type, TypeCounter, TypeGauge, TypeTiming)
+	}
+	if cfg.Value == "" && cfg.Type != TypeCounter {
+		return errors.Errorf("missing value for a metric of type %s", cfg.Type)
+	}
+
+	// templated fields are checked at runtime
+	if !strings.Contains(cfg.Metric, "{{") {
+		if err := validName("metric", cfg.Metric); err != nil {
+			return err
+		}
+	}
+	if cfg.Value != "" && !strings.Contains(cfg.Value, "{{") {
+		if _, err := parseValue(cfg.Value); err != nil {
+			return err
+		}
+	}
+	if cfg.Address != "" && !strings.Contains(cfg.Address, "{{") {
+		if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+			return errors.Annotatef(err, "invalid address %q", cfg.Address)
+		}
+	}
+	for k, v := range cfg.Tags {
+		if strings.Contains(k, "{{") || strings.Contains(v, "{{") {
+			continue
+		}
+		if err := validTag(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourcesstatsd(i interface{}) []string {
+	cfg := i.(*Config)
+
+	host, _, err := net.SplitHostPort(address(cfg))
+	if err != nil {
+		return []string{"socket"}
+	}
+	return []string{
+		"socket",
+		"url:" + host,
+	}
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+
+	payload, value, err := format(cfg)
+	if err != nil {
+		return nil, nil, errors.NewBadRequest(err, "invalid metric")
+	}
+
+	conn, err := net.DialTimeout("udp", address(cfg), sendTimeout)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "can't reach statsd endpoint %q", address(cfg))
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(sendTimeout)); err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		return nil, nil, errors.Annotatef(err, "can't send metric %q", cfg.Metric)
+	}
+
+	return map[string]interface{}{
+		"metric": cfg.Metric,
+		"type":   cfg.Type,
+		"value":  value,
+		"tags":   cfg.Tags,
+	}, nil, nil
+}
+
+func address(cfg *Config) string {
+	if cfg.Address == "" {
+		return DefaultAddress
+	}
+	return cfg.Address
+}
+
+// format builds the StatsD line of a metric: <metric>:<value>|<type>[|#<tag>:<value>,...]
+func format(cfg *Config) (string, float64, error) {
+	if err := validName("metric", cfg.Metric); err != nil {
+		return "", 0, err
+	}
+	protocolType, ok := protocolTypes[cfg.Type]
+	if !ok {
+		return "", 0, errors.Errorf("invalid type %q", cfg.Type)
+	}
+
+	value := float64(1)
+	if cfg.Value != "" {
+		v, err := parseValue(cfg.Value)
+		if err != nil {
+			return "", 0, err
+		}
+		value = v
+	} else if cfg.Type != TypeCounter {
+		return "", 0, errors.Errorf("missing value for a metric of type %s", cfg.Type)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(cfg.Metric)
+	sb.WriteString(":")
+	sb.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	sb.WriteString("|")
+	sb.WriteString(protocolType)
+
+	if len(cfg.Tags) > 0 {
+		keys := make([]string, 0, len(cfg.Tags))
+		for k, v := range cfg.Tags {
+			if err := validTag(k, v); err != nil {
+				return "", 0, err
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		tags := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if cfg.Tags[k] == "" {
+				tags = append(tags, k)
+			} else {
+				tags = append(tags, k+":"+cfg.Tags[k])
+			}
+		}
+		sb.WriteString("|#")
+		sb.WriteString(strings.Join(tags, ","))
+	}
+
+	return sb.String(), value, nil
+}
+
+func parseValue(value string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, errors.Errorf("value should be a number, got %q", value)
+	}
+	return v, nil
+}
+
+func validName(field, name string) error {
+	if strings.ContainsAny(name, ":|@#,\n") {
+		return errors.Errorf("invalid %s %q: characters ':|@#,' and line breaks are reserved", field, name)
+	}
+	return nil
+}
+
+func validTag(key, value string) error {
+	if key == "" {
+		return errors.New("invalid empty tag name")
+	}
+	if err := validName("tag name", key); err != nil {
+		return err
+	}
+	if strings.ContainsAny(value, "|@#,\n") {
+		return errors.Errorf("invalid value %q for tag %q: characters '|@#,' and line breaks are reserved", value, key)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pluginstatsd
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		valid bool
+	}{
+		{Config{Metric: "provisioned_vms", Type: TypeCounter}, true},
+		{Config{Metric: "provisioned_vms", Type: TypeGauge, Value: "{{.step.count.output.total}}"}, true},
+		{Config{Metric: "deploy", Type: TypeTiming, Value: "1520.5", Address: "statsd.example.org:8125", Tags: map[string]string{"env": "prod"}}, true},
+		{Config{Metric: "", Type: TypeCounter}, false},
+		{Config{Metric: "provisioned_vms", Type: "histogram", Value: "1"}, false},
+		{Config{Metric: "provisioned_vms", Type: TypeGauge}, false},
+		{Config{Metric: "provisioned:vms", Type: TypeCounter}, false},
+		{Config{Metric: "provisioned_vms", Type: TypeCounter, Value: "many"}, false},
+		{Config{Metric: "provisioned_vms", Type: TypeCounter, Address: "statsd.example.org"}, false},
+		{Config{Metric: "provisioned_vms", Type: TypeCounter, Tags: map[string]string{"env": "prod,dev"}}, false},
+	} {
+		cfgJSON, err := json.Marshal(tc.cfg)
+		require.NoError(t, err)
+		err = Plugin.ValidConfig(json.RawMessage(""), json.RawMessage(cfgJSON))
+		if tc.valid {
+			assert.NoError(t, err, string(cfgJSON))
+		} else {
+			assert.Error(t, err, string(cfgJSON))
+		}
+	}
+}
+
+func Test_format(t *testing.T) {
+	payload, value, err := format(&Config{Metric: "provisioned_vms", Type: TypeCounter})
+	require.NoError(t, err)
+	assert.Equal(t, "provisioned_vms:1|c", payload)
+	assert.Equal(t, float64(1), value)
+
+	payload, _, err = format(&Config{Metric: "deploy.duration", Type: TypeTiming, Value: " 1520.5 ", Tags: map[string]string{"region": "eu", "canary": "", "env": "prod"}})
+	require.NoError(t, err)
+	assert.Equal(t, "deploy.duration:1520.5|ms|#canary,env:prod,region:eu", payload)
+
+	_, _, err = format(&Config{Metric: "load", Type: TypeGauge, Value: "{{.step.load.output}}"})
+	assert.Error(t, err)
+}
+
+func Test_exec(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	output, _, err := exec("test", &Config{
+		Address: conn.LocalAddr().String(),
+		Metric:  "provisioned_vms",
+		Type:    TypeGauge,
+		Value:   "3",
+		Tags:    map[string]string{"env": "prod"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), output.(map[string]interface{})["value"])
+
+	buf := make([]byte, 512)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "provisioned_vms:3|g|#env:prod", string(buf[:n]))
+
+	_, _, err = exec("test", &Config{Address: conn.LocalAddr().String(), Metric: "provisioned_vms", Type: TypeGauge, Value: "three"}, nil)
+	assert.True(t, errors.IsBadRequest(err))
+}
@@ -160,7 +160,16 @@ func exec(stepName string, config interface{}, ctx interface{}) (interface{}, in
 			cfg.Tags = map[string]string{}
 		}
 		cfg.Tags[constants.SubtaskTagParentTaskID] = stepContext.ParentTaskID
-		t, err = taskutils.CreateTask(ctx, dbp, tt, watcherUsernames, watcherGroups, resolverUsernames, resolverGroups, cfg.Input, nil, "Auto created subtask, parent task "+stepContext.ParentTaskID, cfg.Delay, cfg.Tags)
+		t, err = taskutils.CreateTask(ctx, dbp, tt, taskutils.CreateTaskOptions{
+			WatcherUsernames:  watcherUsernames,
+			WatcherGroups:     watcherGroups,
+			ResolverUsernames: resolverUsernames,
+			ResolverGroups:    resolverGroups,
+			Input:             cfg.Input,
+			Comment:           "Auto created subtask, parent task " + stepContext.ParentTaskID,
+			Delay:             cfg.Delay,
+			Tags:              cfg.Tags,
+		})
 		if err != nil {
 			dbp.Rollback()
 			return nil, nil, err
@@ -1,21 +1,42 @@
 package plugintag
 
 import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/juju/errors"
+
+	"github.com/cneill/utask/pkg/constants"
 	"github.com/cneill/utask/pkg/plugins/taskplugin"
 	"github.com/cneill/utask/pkg/utils"
 )
 
 // The tag plugin allow to update the tags of a task.
 var (
-	Plugin = taskplugin.New("tag", "0.1", exec,
+	Plugin = taskplugin.New("tag", "0.2", exec,
 		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithContextFunc(ctx),
 		taskplugin.WithTags(tags),
 	)
 )
 
 // Config represents the configuration of the plugin.
 type Config struct {
-	Tags map[string]string `json:"tags"`
+	Tags    map[string]string `json:"tags"`
+	Delete  []string          `json:"delete,omitempty"`
+	Replace bool              `json:"replace,omitempty"`
+}
+
+// Context holds the current tags of the task, JSON encoded then base64 encoded
+// so that the templated value remains a valid JSON string
+type Context struct {
+	TaskTags string `json:"task_tags"`
+}
+
+func ctx(stepName string) interface{} {
+	return &Context{
+		TaskTags: "{{.task.tags | toJson | b64enc}}",
+	}
 }
 
 func validConfig(config interface{}) error {
@@ -25,18 +46,62 @@ func validConfig(config interface{}) error {
 		return err
 	}
 
+	for _, k := range cfg.Delete {
+		if k == constants.SubtaskTagParentTaskID {
+			return errors.BadRequestf("tag name %q not allowed", k)
+		}
+	}
+
 	return nil
 }
 
+// exec computes the changes to apply to the tags of the task: an empty value deletes a tag.
+// When replacing, the current tags of the task not listed in the configuration are deleted.
 func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
-	return nil, nil, nil
+	cfg := config.(*Config)
+
+	var current map[string]string
+	if cfg.Replace {
+		stepContext := ctx.(*Context)
+
+		ba, err := base64.StdEncoding.DecodeString(stepContext.TaskTags)
+		if err != nil {
+			return nil, nil, errors.Annotate(err, "failed to decode current task tags")
+		}
+		if err := json.Unmarshal(ba, &current); err != nil {
+			return nil, nil, errors.Annotate(err, "failed to decode current task tags")
+		}
+	}
+
+	return tagChanges(cfg, current), nil, nil
 }
 
-func tags(config, _, _, _ interface{}, _ error) map[string]string {
-	if config == nil {
+// tagChanges merges the operations of the configuration into a single set of changes
+// the tag linking a subtask to its parent task is never removed
+func tagChanges(cfg *Config, current map[string]string) map[string]string {
+	changes := make(map[string]string)
+
+	if cfg.Replace {
+		for k := range current {
+			if k != constants.SubtaskTagParentTaskID {
+				changes[k] = ""
+			}
+		}
+	}
+	for _, k := range cfg.Delete {
+		changes[k] = ""
+	}
+	for k, v := range cfg.Tags {
+		changes[k] = v
+	}
+
+	return changes
+}
+
+func tags(_, _, output, _ interface{}, err error) map[string]string {
+	if err != nil || output == nil {
 		return nil
 	}
-	cfg := config.(*Config)
 
-	return cfg.Tags
+	return output.(map[string]string)
 }
@@ -0,0 +1,38 @@
+package plugintag
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask/pkg/constants"
+)
+
+func TestValidConfig(t *testing.T) {
+	assert.NoError(t, validConfig(&Config{Tags: map[string]string{"foo": "bar"}, Delete: []string{"lock"}}))
+	assert.Error(t, validConfig(&Config{Tags: map[string]string{constants.SubtaskTagParentTaskID: "foo"}}))
+	assert.Error(t, validConfig(&Config{Delete: []string{constants.SubtaskTagParentTaskID}}))
+}
+
+func TestExec(t *testing.T) {
+	current := base64.StdEncoding.EncodeToString([]byte(`{"lock":"held","team":"alpha","` + constants.SubtaskTagParentTaskID + `":"parent"}`))
+
+	output, _, err := exec("stepName", &Config{Tags: map[string]string{"foo": "bar"}, Delete: []string{"lock"}}, &Context{TaskTags: current})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar", "lock": ""}, output)
+
+	output, _, err = exec("stepName", &Config{Tags: map[string]string{"team": "beta"}, Replace: true}, &Context{TaskTags: current})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "beta", "lock": ""}, output)
+	assert.Equal(t, output, tags(nil, nil, output, nil, nil))
+
+	// task without any tag
+	output, _, err = exec("stepName", &Config{Replace: true}, &Context{TaskTags: base64.StdEncoding.EncodeToString([]byte(`null`))})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{}, output)
+
+	_, _, err = exec("stepName", &Config{Replace: true}, &Context{TaskTags: "not base64"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,342 @@
+package pluginutask
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/resolution"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/constants"
+	"github.com/cneill/utask/pkg/plugins/taskplugin"
+	"github.com/cneill/utask/pkg/taskutils"
+	"github.com/cneill/utask/pkg/utils"
+)
+
+// the utask plugin calls µTask itself, in-process, on behalf of the requester of the task:
+// it creates, gets or lists tasks, with the permissions the API would grant to this requester
+var (
+	Plugin = taskplugin.New("utask", "0.1", exec,
+		taskplugin.WithConfig(validConfig, Config{}),
+		taskplugin.WithContextFunc(ctx),
+		taskplugin.WithIdempotencyKey(execWithIdempotencyKey),
+	)
+)
+
+// actions of the plugin
+const (
+	ActionCreateTask = "create_task"
+	ActionGetTask    = "get_task"
+	ActionListTasks  = "list_tasks"
+)
+
+// types of listing, as on the API
+const (
+	listTypeOwn        = "own"
+	listTypeResolvable = "resolvable"
+	listTypeAll        = "all"
+)
+
+// defaultPageSize is the number of tasks listed when the page size isn't set
+const defaultPageSize = 100
+
+// Config is the configuration of a call to µTask
+type Config struct {
+	Action string `json:"action"`
+
+	// create_task; template and tags also filter list_tasks
+	Template  string                 `json:"template,omitempty"`
+	Input     map[string]interface{} `json:"input,omitempty"`
+	JSONInput string                 `json:"json_input,omitempty"`
+	Comment   string                 `json:"comment,omitempty"`
+	Delay     *string                `json:"delay,omitempty"`
+	Tags      map[string]string      `json:"tags,omitempty"`
+
+	// get_task
+	TaskID string `json:"task_id,omitempty"`
+
+	// list_tasks
+	Type     string `json:"type,omitempty"`
+	State    string `json:"state,omitempty"`
+	PageSize string `json:"page_size,omitempty"`
+	Last     string `json:"last,omitempty"`
+}
+
+// UtaskContext is the identity of the requester of the task, used to call µTask
+type UtaskContext struct {
+	TaskID            string `json:"task_id"`
+	RequesterUsername string `json:"requester_username"`
+	RequesterGroups   string `json:"requester_groups"`
+}
+
+// Task is the summary of a task returned by the plugin
+type Task struct {
+	ID                string                 `json:"id"`
+	Title             string                 `json:"title"`
+	TemplateName      string                 `json:"template_name"`
+	State             string                 `json:"state"`
+	RequesterUsername string                 `json:"requester_username"`
+	ResolverUsername  *string                `json:"resolver_username,omitempty"`
+	Resolution        *string                `json:"resolution,omitempty"`
+	Tags              map[string]string      `json:"tags,omitempty"`
+	Result            map[string]interface{} `json:"result,omitempty"`
+	Created           time.Time              `json:"created"`
+	LastActivity      time.Time              `json:"last_activity"`
+}
+
+func ctx(stepName string) interface{} {
+	return &UtaskContext{
+		TaskID:            "{{ .task.task_id }}",
+		RequesterUsername: "{{.task.requester_username}}",
+		RequesterGroups:   "{{ if .task.requester_groups }}{{ .task.requester_groups }}{{ end }}",
+	}
+}
+
+func validConfig(config interface{}) error {
+	cfg := config.(*Config)
+
+	switch cfg.Action {
+	case ActionCreateTask:
+		if cfg.Template == "" {
+			return errors.NotValidf("missing template to create a task")
+		}
+		if err := utils.ValidateTags(cfg.Tags); err != nil {
+			return err
+		}
+	case ActionGetTask:
+		if cfg.TaskID == "" {
+			return errors.NotValidf("missing task_id to get a task")
+		}
+	case ActionListTasks:
+		switch cfg.Type {
+		case "", listTypeOwn, listTypeResolvable, listTypeAll:
+		default:
+			return errors.NotValidf("type %q, expecting %q, %q or %q", cfg.Type, listTypeOwn, listTypeResolvable, listTypeAll)
+		}
+		if _, err := pageSize(cfg.PageSize); err != nil {
+			return err
+		}
+	default:
+		return errors.NotValidf("action %q, expecting %q, %q or %q", cfg.Action, ActionCreateTask, ActionGetTask, ActionListTasks)
+	}
+
+	return nil
+}
+
+func exec(stepName string, config interface{}, ctx interface{}) (interface{}, interface{}, error) {
+	return execWithIdempotencyKey(stepName, config, ctx, "")
+}
+
+func execWithIdempotencyKey(stepName string, config interface{}, ctx interface{}, idempotencyKey string) (interface{}, interface{}, error) {
+	cfg := config.(*Config)
+	utaskContext := ctx.(*UtaskContext)
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var requesterGroups []string
+	if utaskContext.RequesterGroups != "" {
+		requesterGroups = strings.Split(utaskContext.RequesterGroups, utask.GroupsSeparator)
+	}
+	c := auth.WithIdentity(context.Background(), utaskContext.RequesterUsername)
+	c = auth.WithGroups(c, requesterGroups)
+
+	var output interface{}
+	switch cfg.Action {
+	case ActionCreateTask:
+		output, err = createTask(c, dbp, cfg, utaskContext, idempotencyKey)
+	case ActionGetTask:
+		output, err = getTask(c, dbp, cfg.TaskID)
+	case ActionListTasks:
+		output, err = listTasks(c, dbp, cfg)
+	default:
+		err = errors.BadRequestf("unknown action %q", cfg.Action)
+	}
+	if err != nil {
+		return nil, nil, asClientError(err)
+	}
+	return output, nil, nil
+}
+
+// createTask creates a task, once per step: a step retried after a crash finds the task
+// created by its previous attempt, through the idempotency key of the step in its tags
+func createTask(c context.Context, dbp zesty.DBProvider, cfg *Config, utaskContext *UtaskContext, idempotencyKey string) (interface{}, error) {
+	if cfg.Tags == nil {
+		cfg.Tags = map[string]string{}
+	}
+	if idempotencyKey != "" {
+		cfg.Tags[constants.TagIdempotencyKey] = idempotencyKey
+		existing, err := task.ListTasks(dbp, task.ListFilter{
+			RequesterUser: &utaskContext.RequesterUsername,
+			Tags:          map[string]string{constants.TagIdempotencyKey: idempotencyKey},
+			PageSize:      1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			return summary(existing[0]), nil
+		}
+	}
+
+	if cfg.JSONInput != "" {
+		if err := json.Unmarshal([]byte(cfg.JSONInput), &cfg.Input); err != nil {
+			return nil, errors.NewBadRequest(err, "can't parse json_input")
+		}
+	}
+
+	tt, err := tasktemplate.LoadFromName(dbp, cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := cfg.Comment
+	if comment == "" {
+		comment = "Created by task " + utaskContext.TaskID
+	}
+
+	if err := dbp.Tx(); err != nil {
+		return nil, err
+	}
+	t, err := taskutils.CreateTask(c, dbp, tt, taskutils.CreateTaskOptions{
+		Input:   cfg.Input,
+		Comment: comment,
+		Delay:   cfg.Delay,
+		Tags:    cfg.Tags,
+	})
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+	if err := dbp.Commit(); err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+
+	return summary(t), nil
+}
+
+// getTask returns a task, if the requester is allowed to see it through the API
+func getTask(c context.Context, dbp zesty.DBProvider, publicID string) (interface{}, error) {
+	t, err := task.LoadFromPublicID(dbp, publicID)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := tasktemplate.LoadFromID(dbp, t.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	var res *resolution.Resolution
+	if t.Resolution != nil {
+		res, err = resolution.LoadFromPublicID(dbp, *t.Resolution)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	admin := auth.IsAdmin(c) == nil
+	requester := auth.IsRequester(c, t) == nil
+	watcher := auth.IsWatcher(c, t) == nil
+	resolutionManager := auth.IsResolutionManager(c, tt, t, res) == nil
+	if !admin && !requester && !watcher && !resolutionManager {
+		return nil, errors.Forbiddenf("Can't display task details")
+	}
+
+	return summary(t), nil
+}
+
+// listTasks lists the tasks the requester would see through the API
+func listTasks(c context.Context, dbp zesty.DBProvider, cfg *Config) (interface{}, error) {
+	size, err := pageSize(cfg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	filter := task.ListFilter{
+		PageSize: size,
+		Tags:     cfg.Tags,
+	}
+	if cfg.Template != "" {
+		filter.Template = &cfg.Template
+	}
+	if cfg.State != "" {
+		filter.State = &cfg.State
+	}
+	if cfg.Last != "" {
+		filter.Last = &cfg.Last
+	}
+
+	user := auth.GetIdentity(c)
+	switch cfg.Type {
+	case listTypeOwn:
+		filter.RequesterUser = &user
+	case listTypeResolvable:
+		filter.PotentialResolverUser = &user
+		filter.PotentialResolverGroups = auth.GetGroups(c)
+	default:
+		if err := auth.IsAdmin(c); err != nil {
+			filter.RequesterOrPotentialResolverUser = &user
+			filter.RequesterOrPotentialResolverGroups = auth.GetGroups(c)
+		}
+	}
+
+	tasks, err := task.ListTasks(dbp, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Task, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, summary(t))
+	}
+	return map[string]interface{}{"tasks": out}, nil
+}
+
+// pageSize parses the number of tasks to list, capped like the API
+func pageSize(value string) (uint64, error) {
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	size, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || size == 0 {
+		return 0, errors.BadRequestf("invalid page_size %q, expecting a positive integer", value)
+	}
+	if size > utask.MaxPageSize {
+		return 0, errors.BadRequestf("invalid page_size %d, greater than %d", size, utask.MaxPageSize)
+	}
+	return size, nil
+}
+
+func summary(t *task.Task) *Task {
+	return &Task{
+		ID:                t.PublicID,
+		Title:             t.Title,
+		TemplateName:      t.TemplateName,
+		State:             t.State,
+		RequesterUsername: t.RequesterUsername,
+		ResolverUsername:  t.ResolverUsername,
+		Resolution:        t.Resolution,
+		Tags:              t.Tags,
+		Result:            t.Result,
+		Created:           t.Created,
+		LastActivity:      t.LastActivity,
+	}
+}
+
+// asClientError turns the errors due to the configuration of the step, or to the permissions
+// of the requester, into client errors: retrying the step would fail again
+func asClientError(err error) error {
+	if errors.IsNotFound(err) || errors.IsForbidden(err) || errors.IsNotValid(err) || errors.IsBadRequest(err) {
+		return errors.NewBadRequest(err, "")
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package pluginutask
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/ovh/configstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/db"
+	"github.com/cneill/utask/engine/step"
+	"github.com/cneill/utask/engine/step/executor"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/constants"
+)
+
+func TestValidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   Config
+		valid bool
+	}{
+		{"create", Config{Action: ActionCreateTask, Template: "foo", Tags: map[string]string{"foo": "bar"}}, true},
+		{"create without template", Config{Action: ActionCreateTask}, false},
+		{"create with reserved tags", Config{Action: ActionCreateTask, Template: "foo", Tags: map[string]string{constants.TagIdempotencyKey: "bar"}}, false},
+		{"get", Config{Action: ActionGetTask, TaskID: "foo"}, true},
+		{"get without task_id", Config{Action: ActionGetTask}, false},
+		{"list", Config{Action: ActionListTasks}, true},
+		{"list own", Config{Action: ActionListTasks, Type: listTypeOwn, PageSize: "10"}, true},
+		{"list resolvable", Config{Action: ActionListTasks, Type: listTypeResolvable}, true},
+		{"list with invalid type", Config{Action: ActionListTasks, Type: "mine"}, false},
+		{"list with invalid page_size", Config{Action: ActionListTasks, PageSize: "0"}, false},
+		{"unknown action", Config{Action: "delete_task"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validConfig(&tc.cfg)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	size, err := pageSize("")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(defaultPageSize), size)
+
+	size, err = pageSize("42")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), size)
+
+	size, err = pageSize(fmt.Sprint(utask.MaxPageSize))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(utask.MaxPageSize), size)
+
+	for _, value := range []string{"0", "-1", "foo", fmt.Sprint(utask.MaxPageSize + 1)} {
+		_, err := pageSize(value)
+		assert.True(t, errors.IsBadRequest(err), value)
+	}
+}
+
+func TestAsClientError(t *testing.T) {
+	for _, err := range []error{
+		errors.NotFoundf("task"),
+		errors.Forbiddenf("Can't display task details"),
+		errors.NotValidf("input"),
+		errors.BadRequestf("invalid page_size"),
+	} {
+		assert.True(t, errors.IsBadRequest(asClientError(err)), err.Error())
+	}
+
+	// the errors of µTask itself may go away on a retry
+	err := errors.New("connection refused")
+	assert.Equal(t, err, asClientError(err))
+}
+
+var dummyTemplate = tasktemplate.TaskTemplate{
+	Name:        "utask-plugin-template",
+	Description: "does nothing",
+	TitleFormat: "this task does nothing at all",
+	Steps: map[string]*step.Step{
+		"step": {
+			Action: executor.Executor{
+				Type:          "echo",
+				Configuration: json.RawMessage(`{"output": {"foo":"bar"}}`),
+			},
+		},
+	},
+}
+
+func TestCreateTaskIdempotency(t *testing.T) {
+	store := configstore.DefaultStore
+	store.InitFromEnvironment()
+	require.NoError(t, db.Init(store))
+
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	require.NoError(t, err)
+
+	if _, err := tasktemplate.LoadFromName(dbp, dummyTemplate.Name); errors.IsNotFound(err) {
+		tmpl := dummyTemplate
+		require.NoError(t, dbp.DB().Insert(&tmpl))
+	} else {
+		require.NoError(t, err)
+	}
+
+	utaskContext := &UtaskContext{TaskID: "parent", RequesterUsername: "foo"}
+	create := func(idempotencyKey string) *Task {
+		cfg := &Config{Action: ActionCreateTask, Template: dummyTemplate.Name}
+		require.NoError(t, validConfig(cfg))
+		output, _, err := execWithIdempotencyKey("stepOne", cfg, utaskContext, idempotencyKey)
+		require.NoError(t, err)
+		return output.(*Task)
+	}
+
+	// a step retried with the same key finds back the task it created
+	created := create("utask-plugin-key")
+	assert.Equal(t, "foo", created.RequesterUsername)
+	assert.Equal(t, "utask-plugin-key", created.Tags[constants.TagIdempotencyKey])
+	assert.Equal(t, created.ID, create("utask-plugin-key").ID)
+
+	tasks, err := task.ListTasks(dbp, task.ListFilter{
+		Tags:     map[string]string{constants.TagIdempotencyKey: "utask-plugin-key"},
+		PageSize: 10,
+	})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	// without a key, each call creates a task
+	assert.NotEqual(t, create("").ID, create("").ID)
+}
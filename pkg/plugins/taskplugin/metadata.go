@@ -10,6 +10,7 @@ const (
 	HTTPStatus  = "HTTPStatus"
 	HTTPHeaders = "HTTPHeaders"
 	HTTPCookies = "HTTPCookies"
+	HTTPTimings = "HTTPTimings"
 )
 
 // MetadataSchemaBuilder is a helper to generate jsonschema for a metadata payload
@@ -47,6 +48,19 @@ func (m *MetadataSchemaBuilder) WithHeaders(headers ...string) *MetadataSchemaBu
 	return m
 }
 
+// WithTimings adds an HTTPTimings field to metadata, holding the duration
+// of the phases of an http call, in milliseconds
+func (m *MetadataSchemaBuilder) WithTimings() *MetadataSchemaBuilder {
+	properties := []string{}
+	for _, timing := range []string{"dns_ms", "connect_ms", "tls_ms", "first_byte_ms", "total_ms"} {
+		properties = append(properties, fmt.Sprintf(`"%s":{"type":"number"}`, timing))
+	}
+
+	HTTPTimings := fmt.Sprintf(`"%s":{"type":"object","properties":{%s}}`, HTTPTimings, strings.Join(properties, ","))
+	m.properties = append(m.properties, HTTPTimings)
+	return m
+}
+
 // String renders a json schema for metadata
 func (m *MetadataSchemaBuilder) String() string {
 	return fmt.Sprintf(`{"type":"object","properties":{%s}}`, strings.Join(m.properties, ","))
@@ -17,11 +17,43 @@ type ConfigFunc func(interface{}) error
 // ExecFunc is a type of function to be implemented by a plugin to perform an action in a task
 type ExecFunc func(string, interface{}, interface{}) (interface{}, interface{}, error)
 
+// DryRunFunc is a type of function to be implemented by a plugin to describe the action
+// it would perform in a task, without any side effect
+type DryRunFunc func(string, interface{}, interface{}) (interface{}, error)
+
+// IdempotentExecFunc is a type of function to be implemented by a plugin to perform an action in a task,
+// receiving the idempotency key of the step to pass along to the downstream system
+type IdempotentExecFunc func(string, interface{}, interface{}, string) (interface{}, interface{}, error)
+
+// ProgressFunc is handed to the plugins reporting their progress, to be called as many times as needed
+// while the action runs, with a percentage (from 0 to 100) and a message describing the current stage
+type ProgressFunc func(percent int, message string)
+
+// ProgressExecFunc is a type of function to be implemented by a plugin to perform an action in a task,
+// reporting its progress along the way
+type ProgressExecFunc func(string, interface{}, interface{}, ProgressFunc) (interface{}, interface{}, error)
+
+// ExecOptions holds what the engine hands to a plugin along with the configuration and the context of a step
+type ExecOptions struct {
+	// IdempotencyKey is the idempotency key of the step, reused by all its retries, empty when there is none
+	IdempotencyKey string
+	// Report reports the progress of the action, never nil
+	Report ProgressFunc
+}
+
+// ExtendedExecFunc is a type of function to be implemented by a plugin to perform an action in a task,
+// receiving both the idempotency key of the step and a function to report its progress
+type ExtendedExecFunc func(string, interface{}, interface{}, ExecOptions) (interface{}, interface{}, error)
+
 // PluginExecutor is a structure to generate action executors from different implementations
 // builtin or loaded as custom extensions
 type PluginExecutor struct {
 	configfunc     ConfigFunc
 	execfunc       ExecFunc
+	dryRunFunc     DryRunFunc
+	extendedFunc   ExtendedExecFunc
+	idempotent     bool
+	progress       bool
 	resourcesFunc  func(interface{}) []string
 	configFactory  func() interface{}
 	pluginName     string
@@ -85,28 +117,96 @@ func (r PluginExecutor) ValidConfig(baseConfig json.RawMessage, config json.RawM
 
 // Exec performs the action implemented by the executor
 func (r PluginExecutor) Exec(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}) (interface{}, interface{}, map[string]string, error) {
-	var cfg interface{}
+	cfg, err := r.loadConfig(baseConfig, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	output, metadata, err := r.execfunc(stepName, cfg, ctx)
+	return output, metadata, r.tags(cfg, ctx, output, metadata, err), err
+}
 
-	if r.configFactory != nil {
-		cfg = r.configFactory()
-		if len(baseConfig) > 0 {
-			err := utils.JSONnumberUnmarshal(bytes.NewReader(baseConfig), cfg)
-			if err != nil {
-				return nil, nil, nil, errors.Annotate(err, "failed to unmarshal base configuration")
-			}
-		}
-		err := utils.JSONnumberUnmarshal(bytes.NewReader(config), cfg)
+// ExecWithIdempotencyKey performs the action implemented by the executor, passing along
+// the idempotency key of the step, which stays the same when the step is retried.
+// Plugins which don't declare idempotency keys fall back to Exec
+func (r PluginExecutor) ExecWithIdempotencyKey(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}, idempotencyKey string) (interface{}, interface{}, map[string]string, error) {
+	return r.ExecWithOptions(stepName, baseConfig, config, ctx, idempotencyKey, nil)
+}
+
+// SupportsIdempotencyKey tells whether the plugin passes idempotency keys to the downstream system
+func (r PluginExecutor) SupportsIdempotencyKey() bool {
+	return r.idempotent
+}
+
+// ExecWithProgress performs the action implemented by the executor, handing it a function
+// to report its progress, which may be nil to discard it. Plugins which don't report their progress fall back to Exec
+func (r PluginExecutor) ExecWithProgress(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}, report func(int, string)) (interface{}, interface{}, map[string]string, error) {
+	return r.ExecWithOptions(stepName, baseConfig, config, ctx, "", report)
+}
+
+// SupportsProgress tells whether the plugin reports its progress while running
+func (r PluginExecutor) SupportsProgress() bool {
+	return r.progress
+}
+
+// ExecWithOptions performs the action implemented by the executor, passing along the idempotency key
+// of the step and a function to report its progress, which may be nil to discard it.
+// Each of them is only handed to the plugins declaring it: the other plugins fall back to Exec
+func (r PluginExecutor) ExecWithOptions(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}, idempotencyKey string, report func(int, string)) (interface{}, interface{}, map[string]string, error) {
+	if r.extendedFunc == nil || (!r.progress && idempotencyKey == "") {
+		return r.Exec(stepName, baseConfig, config, ctx)
+	}
+	if report == nil {
+		report = func(int, string) {}
+	}
+	cfg, err := r.loadConfig(baseConfig, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	output, metadata, err := r.extendedFunc(stepName, cfg, ctx, ExecOptions{IdempotencyKey: idempotencyKey, Report: report})
+	return output, metadata, r.tags(cfg, ctx, output, metadata, err), err
+}
+
+func (r PluginExecutor) tags(cfg, ctx, output, metadata interface{}, err error) map[string]string {
+	if r.tagsFunc == nil {
+		return nil
+	}
+	return r.tagsFunc(cfg, ctx, output, metadata, err)
+}
+
+// DryRun describes the action the executor would perform, without performing it.
+// It returns a NotSupported error if the plugin doesn't implement dry-runs
+func (r PluginExecutor) DryRun(stepName string, baseConfig json.RawMessage, config json.RawMessage, ctx interface{}) (interface{}, error) {
+	if r.dryRunFunc == nil {
+		return nil, errors.NotSupportedf("dry-run by plugin %q", r.pluginName)
+	}
+	cfg, err := r.loadConfig(baseConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	return r.dryRunFunc(stepName, cfg, ctx)
+}
+
+// SupportsDryRun tells whether the plugin implements dry-runs
+func (r PluginExecutor) SupportsDryRun() bool {
+	return r.dryRunFunc != nil
+}
+
+func (r PluginExecutor) loadConfig(baseConfig json.RawMessage, config json.RawMessage) (interface{}, error) {
+	if r.configFactory == nil {
+		return nil, nil
+	}
+	cfg := r.configFactory()
+	if len(baseConfig) > 0 {
+		err := utils.JSONnumberUnmarshal(bytes.NewReader(baseConfig), cfg)
 		if err != nil {
-			return nil, nil, nil, errors.Annotate(err, "failed to unmarshal configuration")
+			return nil, errors.Annotate(err, "failed to unmarshal base configuration")
 		}
 	}
-	output, metadata, err := r.execfunc(stepName, cfg, ctx)
-
-	var tags map[string]string
-	if r.tagsFunc != nil {
-		tags = r.tagsFunc(cfg, ctx, output, metadata, err)
+	err := utils.JSONnumberUnmarshal(bytes.NewReader(config), cfg)
+	if err != nil {
+		return nil, errors.Annotate(err, "failed to unmarshal configuration")
 	}
-	return output, metadata, tags, err
+	return cfg, nil
 }
 
 // PluginName returns a plugin's name
@@ -135,6 +235,11 @@ type PluginOpt struct {
 	resourcesFunc   func(interface{}) []string
 	metadataFunc    func() string
 	tagsFunc        tagsFunc
+	dryRunFunc      DryRunFunc
+	extendedFunc    ExtendedExecFunc
+	idempotent      bool
+	progress        bool
+	conflictingExec bool
 }
 
 // WithConfig defines the configuration struct and validation function
@@ -174,6 +279,50 @@ func WithTags(fn tagsFunc) func(*PluginOpt) {
 	}
 }
 
+// WithDryRun defines a function describing the action the plugin would perform,
+// without any side effect, for the dry-runs of a resolution
+func WithDryRun(dryRunFunc DryRunFunc) func(*PluginOpt) {
+	return func(o *PluginOpt) {
+		o.dryRunFunc = dryRunFunc
+	}
+}
+
+// WithIdempotencyKey defines a function performing the action of the plugin with the idempotency key
+// of the step, generated by the engine and reused when the step is retried, so that the downstream system
+// can deduplicate the calls of a step re-run after a crash. It replaces the exec function of the plugin
+func WithIdempotencyKey(idempotentFunc IdempotentExecFunc) func(*PluginOpt) {
+	return withExtendedExec(func(stepName string, config interface{}, ctx interface{}, opts ExecOptions) (interface{}, interface{}, error) {
+		return idempotentFunc(stepName, config, ctx, opts.IdempotencyKey)
+	}, true, false)
+}
+
+// WithProgress defines a function performing the action of the plugin while reporting its progress,
+// for long-running actions: the last progress reported is shown on the running step.
+// It replaces the exec function of the plugin
+func WithProgress(progressFunc ProgressExecFunc) func(*PluginOpt) {
+	return withExtendedExec(func(stepName string, config interface{}, ctx interface{}, opts ExecOptions) (interface{}, interface{}, error) {
+		return progressFunc(stepName, config, ctx, opts.Report)
+	}, false, true)
+}
+
+// WithExtendedExec defines a function performing the action of the plugin with both the idempotency key
+// of the step and a function to report its progress, as WithIdempotencyKey and WithProgress would.
+// It replaces the exec function of the plugin
+func WithExtendedExec(extendedFunc ExtendedExecFunc) func(*PluginOpt) {
+	return withExtendedExec(extendedFunc, true, true)
+}
+
+func withExtendedExec(extendedFunc ExtendedExecFunc, idempotent, progress bool) func(*PluginOpt) {
+	return func(o *PluginOpt) {
+		if o.extendedFunc != nil {
+			o.conflictingExec = true
+		}
+		o.extendedFunc = extendedFunc
+		o.idempotent = idempotent
+		o.progress = progress
+	}
+}
+
 // WithResources defines a function indicating what resources will be needed by the plugin
 func WithResources(resourcesFunc func(interface{}) []string) func(*PluginOpt) {
 	return func(o *PluginOpt) {
@@ -202,6 +351,9 @@ func New(pluginName string, pluginVersion string, execfunc ExecFunc, opts ...fun
 	if pOpt.contextObj != nil && pOpt.contextFunc != nil {
 		panic(fmt.Sprintf("plugin executor '%s': conflicting context object + factory", pluginName))
 	}
+	if pOpt.conflictingExec {
+		panic(fmt.Sprintf("plugin executor '%s': conflicting exec functions, use WithExtendedExec to both take an idempotency key and report progress", pluginName))
+	}
 
 	var schema json.RawMessage
 	if pOpt.metadataFunc != nil {
@@ -250,6 +402,10 @@ func New(pluginName string, pluginVersion string, execfunc ExecFunc, opts ...fun
 		pluginVersion:  pluginVersion,
 		configfunc:     pOpt.configCheckFunc,
 		execfunc:       execfunc,
+		dryRunFunc:     pOpt.dryRunFunc,
+		extendedFunc:   pOpt.extendedFunc,
+		idempotent:     pOpt.idempotent,
+		progress:       pOpt.progress,
 		resourcesFunc:  pOpt.resourcesFunc,
 		configFactory:  configFactory,
 		contextFactory: contextFactory,
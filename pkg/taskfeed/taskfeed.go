@@ -0,0 +1,128 @@
+package taskfeed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/loopfz/gadgeto/zesty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/task"
+)
+
+// The live task list pushes the activity of the tasks to the connected clients:
+// instead of each client polling the task list, a single query per instance watches
+// the latest activity among all tasks, and the subscribers are told when it moves,
+// to list the tasks they are interested in that changed since their last listing
+
+// Interval is the duration between two checks of the activity of the tasks
+const Interval = 2 * time.Second
+
+var (
+	mu          sync.Mutex
+	subscribers = map[*Subscription]struct{}{}
+	latest      *time.Time
+	stopped     = make(chan struct{})
+)
+
+// Subscription is the registration of a client of the live task list
+type Subscription struct {
+	changes chan struct{}
+}
+
+// Subscribe registers a new client of the live task list, which must be closed once disconnected
+func Subscribe() *Subscription {
+	s := &Subscription{
+		// a single pending notification: a slow subscriber catches up
+		// on all the changes at once, without blocking the others
+		changes: make(chan struct{}, 1),
+	}
+
+	mu.Lock()
+	subscribers[s] = struct{}{}
+	mu.Unlock()
+
+	return s
+}
+
+// Changes receives a notification when tasks were updated since the last one
+func (s *Subscription) Changes() <-chan struct{} {
+	return s.changes
+}
+
+// Done is closed when the live task list stops, with the instance
+func (s *Subscription) Done() <-chan struct{} {
+	return stopped
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	mu.Lock()
+	delete(subscribers, s)
+	mu.Unlock()
+}
+
+// Subscribers returns the number of clients connected to the live task list
+func Subscribers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(subscribers)
+}
+
+// Notify tells all the subscribers that tasks were updated
+func Notify() {
+	mu.Lock()
+	defer mu.Unlock()
+	for s := range subscribers {
+		select {
+		case s.changes <- struct{}{}:
+		default:
+			// a notification is already pending
+		}
+	}
+}
+
+// Start watches the activity of the tasks until ctx is done
+func Start(ctx context.Context) error {
+	dbp, err := zesty.NewDBProvider(utask.DBName)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		tick := time.NewTicker(Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				watch(dbp)
+			case <-ctx.Done():
+				close(stopped)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// watch notifies the subscribers when the latest activity among all tasks moved,
+// without querying the database while there is no subscriber
+func watch(dbp zesty.DBProvider) {
+	if Subscribers() == 0 {
+		return
+	}
+
+	last, err := task.LatestActivity(dbp)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to watch the activity of the tasks")
+		return
+	}
+	if last == nil || (latest != nil && !last.After(*latest)) {
+		return
+	}
+	latest = last
+
+	Notify()
+}
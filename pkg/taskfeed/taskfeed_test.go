@@ -0,0 +1,53 @@
+package taskfeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pending(s *Subscription) int {
+	count := 0
+	for {
+		select {
+		case <-s.Changes():
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	assert.Equal(t, 0, Subscribers())
+
+	first := Subscribe()
+	second := Subscribe()
+	assert.Equal(t, 2, Subscribers())
+
+	Notify()
+	assert.Equal(t, 1, pending(first))
+	assert.Equal(t, 1, pending(second))
+
+	// the notifications of a slow subscriber are merged, without blocking
+	Notify()
+	Notify()
+	Notify()
+	assert.Equal(t, 1, pending(first))
+	assert.Equal(t, 1, pending(second))
+
+	// a closed subscription isn't notified anymore
+	first.Close()
+	assert.Equal(t, 1, Subscribers())
+	Notify()
+	assert.Equal(t, 0, pending(first))
+	assert.Equal(t, 1, pending(second))
+
+	second.Close()
+	assert.Equal(t, 0, Subscribers())
+}
+
+func TestWatchWithoutSubscribers(t *testing.T) {
+	// the database isn't queried while no client is connected
+	assert.NotPanics(t, func() { watch(nil) })
+}
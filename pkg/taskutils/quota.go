@@ -0,0 +1,187 @@
+package taskutils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/loopfz/gadgeto/zesty"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/task"
+	"github.com/cneill/utask/models/tasktemplate"
+	"github.com/cneill/utask/pkg/auth"
+	"github.com/cneill/utask/pkg/now"
+)
+
+// DefaultQuotaWindow is the default rolling window over which the created tasks are counted
+const DefaultQuotaWindow = time.Hour
+
+// quota caps the tasks created by a single requester, nil for no quota
+type quota struct {
+	window              time.Duration
+	maxTasks            int
+	maxTasksPerTemplate int
+	templates           map[string]int
+}
+
+var currentQuota = struct {
+	sync.RWMutex
+	q *quota
+}{}
+
+// SetQuota configures the task creation quota of the requesters
+func SetQuota(cfg utask.TaskQuotaConfig) error {
+	q := &quota{
+		window:              DefaultQuotaWindow,
+		maxTasks:            cfg.MaxTasks,
+		maxTasksPerTemplate: cfg.MaxTasksPerTemplate,
+		templates:           cfg.Templates,
+	}
+	if cfg.Window != "" {
+		window, err := time.ParseDuration(cfg.Window)
+		if err != nil {
+			return fmt.Errorf("invalid window: %s", err)
+		}
+		if window <= 0 {
+			return fmt.Errorf("invalid window %q: must be positive", cfg.Window)
+		}
+		q.window = window
+	}
+	if cfg.MaxTasks < 0 {
+		return fmt.Errorf("invalid max_tasks %d: must be positive", cfg.MaxTasks)
+	}
+	if cfg.MaxTasksPerTemplate < 0 {
+		return fmt.Errorf("invalid max_tasks_per_template %d: must be positive", cfg.MaxTasksPerTemplate)
+	}
+	for name, max := range cfg.Templates {
+		if max < 0 {
+			return fmt.Errorf("invalid max tasks %d for template %q: must be positive", max, name)
+		}
+	}
+
+	currentQuota.Lock()
+	defer currentQuota.Unlock()
+	currentQuota.q = q
+	return nil
+}
+
+func getQuota() *quota {
+	currentQuota.RLock()
+	defer currentQuota.RUnlock()
+	return currentQuota.q
+}
+
+// maxTemplateTasks returns the cap on the tasks created from a template, 0 for no limit
+func (q *quota) maxTemplateTasks(tt *tasktemplate.TaskTemplate) int {
+	if max, ok := q.templates[tt.Name]; ok {
+		return max
+	}
+	return q.maxTasksPerTemplate
+}
+
+// QuotaExceededError is returned when a requester already created as many tasks as allowed
+type QuotaExceededError struct {
+	Requester string
+	Template  string // empty when the quota across all templates is reached
+	Max       int
+	Window    time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Template != "" {
+		return fmt.Sprintf("Task quota exceeded: %q can't create more than %d tasks from template %q in %s", e.Requester, e.Max, e.Template, e.Window)
+	}
+	return fmt.Sprintf("Task quota exceeded: %q can't create more than %d tasks in %s", e.Requester, e.Max, e.Window)
+}
+
+// QuotaUsage reports the tasks created by a requester over the quota window, against their caps
+type QuotaUsage struct {
+	Enabled          bool   `json:"enabled"`
+	Exempt           bool   `json:"exempt"`
+	Window           string `json:"window,omitempty"`
+	MaxTasks         int    `json:"max_tasks,omitempty"`
+	Tasks            int64  `json:"tasks"`
+	Template         string `json:"template,omitempty"`
+	MaxTemplateTasks int    `json:"max_template_tasks,omitempty"`
+	TemplateTasks    int64  `json:"template_tasks,omitempty"`
+}
+
+// GetQuotaUsage returns the usage of the task creation quota by the requester of the context,
+// for a given template when tt is not nil
+func GetQuotaUsage(c context.Context, dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate) (*QuotaUsage, error) {
+	q := getQuota()
+	if q == nil {
+		return &QuotaUsage{}, nil
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	since := now.Get().Add(-q.window)
+
+	usage := &QuotaUsage{
+		Enabled:  true,
+		Exempt:   auth.IsAdmin(c) == nil,
+		Window:   q.window.String(),
+		MaxTasks: q.maxTasks,
+	}
+
+	tasks, err := task.CountCreatedBy(dbp, reqUsername, nil, since)
+	if err != nil {
+		return nil, err
+	}
+	usage.Tasks = tasks
+
+	if tt != nil {
+		usage.Template = tt.Name
+		usage.MaxTemplateTasks = q.maxTemplateTasks(tt)
+		usage.TemplateTasks, err = task.CountCreatedBy(dbp, reqUsername, &tt.ID, since)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return usage, nil
+}
+
+// checkQuota returns a QuotaExceededError when the requester of the context
+// can't create another task from a template, admins being exempt
+// dbp must be the transaction inserting the task: the requester's quota stays locked until it ends,
+// concurrent creations can't both pass the check
+func checkQuota(c context.Context, dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate) error {
+	q := getQuota()
+	if q == nil || auth.IsAdmin(c) == nil {
+		return nil
+	}
+
+	reqUsername := auth.GetIdentity(c)
+	if q.maxTasks <= 0 && q.maxTemplateTasks(tt) <= 0 {
+		return nil
+	}
+	if err := task.LockRequesterQuota(dbp, reqUsername); err != nil {
+		return err
+	}
+	since := now.Get().Add(-q.window)
+
+	if q.maxTasks > 0 {
+		tasks, err := task.CountCreatedBy(dbp, reqUsername, nil, since)
+		if err != nil {
+			return err
+		}
+		if tasks >= int64(q.maxTasks) {
+			return &QuotaExceededError{Requester: reqUsername, Max: q.maxTasks, Window: q.window}
+		}
+	}
+
+	if max := q.maxTemplateTasks(tt); max > 0 {
+		tasks, err := task.CountCreatedBy(dbp, reqUsername, &tt.ID, since)
+		if err != nil {
+			return err
+		}
+		if tasks >= int64(max) {
+			return &QuotaExceededError{Requester: reqUsername, Template: tt.Name, Max: max, Window: q.window}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package taskutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cneill/utask"
+	"github.com/cneill/utask/models/tasktemplate"
+)
+
+func TestSetQuota(t *testing.T) {
+	defer func() { currentQuota.q = nil }()
+
+	for _, tc := range []struct {
+		name string
+		cfg  utask.TaskQuotaConfig
+		err  string
+	}{
+		{"invalid window", utask.TaskQuotaConfig{Window: "soon"}, "invalid window"},
+		{"zero window", utask.TaskQuotaConfig{Window: "0s"}, `invalid window "0s": must be positive`},
+		{"negative window", utask.TaskQuotaConfig{Window: "-1h"}, `invalid window "-1h": must be positive`},
+		{"negative max_tasks", utask.TaskQuotaConfig{MaxTasks: -1}, "invalid max_tasks -1"},
+		{"negative max_tasks_per_template", utask.TaskQuotaConfig{MaxTasksPerTemplate: -1}, "invalid max_tasks_per_template -1"},
+		{"negative template", utask.TaskQuotaConfig{Templates: map[string]int{"foo": -2}}, `invalid max tasks -2 for template "foo"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := SetQuota(tc.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+			assert.Nil(t, getQuota())
+		})
+	}
+
+	require.NoError(t, SetQuota(utask.TaskQuotaConfig{MaxTasks: 10}))
+	q := getQuota()
+	require.NotNil(t, q)
+	assert.Equal(t, DefaultQuotaWindow, q.window)
+	assert.Equal(t, 10, q.maxTasks)
+
+	require.NoError(t, SetQuota(utask.TaskQuotaConfig{
+		Window:              "30m",
+		MaxTasksPerTemplate: 5,
+		Templates:           map[string]int{"foo": 2, "bar": 0},
+	}))
+	q = getQuota()
+	require.NotNil(t, q)
+	assert.Equal(t, 30*time.Minute, q.window)
+	assert.Equal(t, 0, q.maxTasks)
+	assert.Equal(t, 2, q.maxTemplateTasks(&tasktemplate.TaskTemplate{Name: "foo"}))
+	assert.Equal(t, 0, q.maxTemplateTasks(&tasktemplate.TaskTemplate{Name: "bar"}))
+	assert.Equal(t, 5, q.maxTemplateTasks(&tasktemplate.TaskTemplate{Name: "baz"}))
+}
+
+func TestQuotaExceededError(t *testing.T) {
+	err := &QuotaExceededError{Requester: "foo", Max: 3, Window: time.Hour}
+	assert.Equal(t, `Task quota exceeded: "foo" can't create more than 3 tasks in 1h0m0s`, err.Error())
+
+	err.Template = "bar"
+	assert.Equal(t, `Task quota exceeded: "foo" can't create more than 3 tasks from template "bar" in 1h0m0s`, err.Error())
+}
@@ -13,24 +13,70 @@ import (
 	"github.com/cneill/utask/pkg/auth"
 	"github.com/cneill/utask/pkg/batchutils"
 	"github.com/cneill/utask/pkg/constants"
+	"github.com/cneill/utask/pkg/correlation"
+	"github.com/cneill/utask/pkg/outputstore"
 )
 
+// CreateTaskOptions holds the optional properties of a task created by CreateTask
+type CreateTaskOptions struct {
+	WatcherUsernames  []string
+	WatcherGroups     []string
+	ResolverUsernames []string
+	ResolverGroups    []string
+	Input             map[string]interface{}
+	Batch             *task.Batch
+	Comment           string
+	Delay             *string // delays the resolution of an autorunnable task
+	Tags              map[string]string
+	TTL               *string
+	Priority          *int
+	DependsOn         []string
+	NotifyBackends    []string
+}
+
 // CreateTask creates a task with the given inputs, and creates a resolution if autorunnable
-func CreateTask(c context.Context, dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, watcherUsernames []string, watcherGroups []string, resolverUsernames []string, resolverGroups []string, input map[string]interface{}, b *task.Batch, comment string, delay *string, tags map[string]string) (*task.Task, error) {
+// a nil ttl or priority falls back on the template's
+// the resolution of a task is kept on hold until the tasks it depends on are over
+// the requester's task creation quota, if any, must not be exceeded
+func CreateTask(c context.Context, dbp zesty.DBProvider, tt *tasktemplate.TaskTemplate, opts CreateTaskOptions) (*task.Task, error) {
 	reqUsername := auth.GetIdentity(c)
 	reqGroups := auth.GetGroups(c)
 
 	if tt.Blocked {
 		return nil, errors.NewNotValid(nil, "Template not available (blocked)")
 	}
-	delayed := delay != nil
-	t, err := task.Create(dbp, tt, reqUsername, reqGroups, watcherUsernames, watcherGroups, resolverUsernames, resolverGroups, input, tags, b, delayed)
+	if err := checkQuota(c, dbp, tt); err != nil {
+		return nil, err
+	}
+	// defaults are filled in before the task is created, to be part of its stored input
+	input := tt.FilterInputs(opts.Input)
+	if err := tt.ValidateInputs(input); err != nil {
+		return nil, err
+	}
+	if err := tt.ValidateInputSchema(input); err != nil {
+		return nil, err
+	}
+	t, err := task.Create(dbp, tt, reqUsername, task.CreateOptions{
+		RequesterGroups:   reqGroups,
+		WatcherUsernames:  opts.WatcherUsernames,
+		WatcherGroups:     opts.WatcherGroups,
+		ResolverUsernames: opts.ResolverUsernames,
+		ResolverGroups:    opts.ResolverGroups,
+		Input:             input,
+		Tags:              opts.Tags,
+		Batch:             opts.Batch,
+		Delayed:           opts.Delay != nil,
+		TTL:               opts.TTL,
+		Priority:          opts.Priority,
+		DependsOn:         opts.DependsOn,
+		NotifyBackends:    opts.NotifyBackends,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if comment != "" {
-		com, err := task.CreateComment(dbp, t, reqUsername, comment)
+	if opts.Comment != "" {
+		com, err := task.CreateComment(dbp, t, reqUsername, opts.Comment)
 		if err != nil {
 			return nil, err
 		}
@@ -55,8 +101,8 @@ func CreateTask(c context.Context, dbp zesty.DBProvider, tt *tasktemplate.TaskTe
 	}
 
 	var delayUntil *time.Time
-	if delay != nil {
-		delayDuration, err := time.ParseDuration(*delay)
+	if opts.Delay != nil {
+		delayDuration, err := time.ParseDuration(*opts.Delay)
 		if err != nil {
 			return nil, errors.NewNotValid(err, "delay")
 		}
@@ -111,18 +157,92 @@ func ShouldResumeParentTask(dbp zesty.DBProvider, t *task.Task) (*task.Task, err
 	if err != nil {
 		return nil, err
 	}
-	switch parentTask.State {
+
+	r, err := resumableResolution(dbp, parentTask)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	return parentTask, nil
+}
+
+// DependentTasksToResume returns the tasks depending on a task which reached a final state,
+// which were kept on hold and no longer wait for any other task
+func DependentTasksToResume(dbp zesty.DBProvider, t *task.Task) ([]*task.Task, error) {
+	switch t.State {
+	case task.StateDone, task.StateWontfix, task.StateCancelled:
+	default:
+		return nil, nil
+	}
+
+	return DeletedDependencyTasksToResume(dbp, t.PublicID)
+}
+
+// DeletedDependencyTasksToResume returns the tasks depending on a deleted task,
+// which were kept on hold and no longer wait for any other task:
+// a task which no longer exists is considered as over, whatever its state was
+func DeletedDependencyTasksToResume(dbp zesty.DBProvider, publicID string) ([]*task.Task, error) {
+	dependents, err := task.ListDependents(dbp, publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	return waitingTasksToResume(dbp, dependents)
+}
+
+// ReleasedTasksToResume returns every task kept on hold whose dependencies are all over,
+// to resume the ones which missed the end of their last dependency
+func ReleasedTasksToResume(dbp zesty.DBProvider) ([]*task.Task, error) {
+	released, err := task.ListReleasedDependents(dbp)
+	if err != nil {
+		return nil, err
+	}
+
+	return waitingTasksToResume(dbp, released)
+}
+
+func waitingTasksToResume(dbp zesty.DBProvider, dependents []*task.Task) ([]*task.Task, error) {
+	// Same race conditions as sibling tasks of a batch: when the last dependencies complete at the very same time,
+	// several attempts to resume a dependent task may be triggered, but a DB lock prevents it from being run twice.
+	toResume := make([]*task.Task, 0, len(dependents))
+	for _, dependent := range dependents {
+		r, err := resumableResolution(dbp, dependent)
+		if err != nil {
+			return nil, err
+		}
+		// only resume resolutions put on hold by the engine, not the ones blocked for another reason
+		if r == nil || r.State != resolution.StateWaiting {
+			continue
+		}
+
+		pending, err := dependent.PendingDependencies(dbp)
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) > 0 {
+			continue
+		}
+
+		toResume = append(toResume, dependent)
+	}
+
+	return toResume, nil
+}
+
+// resumableResolution returns the resolution of a task, if it can be automatically resumed
+func resumableResolution(dbp zesty.DBProvider, t *task.Task) (*resolution.Resolution, error) {
+	switch t.State {
 	case task.StateBlocked, task.StateRunning, task.StateWaiting:
 	default:
-		// not allowed to resume a parent task that is not either Waiting, Running or Blocked.
+		// not allowed to resume a task that is not either Waiting, Running or Blocked.
 		// Todo state should not be runned as it might need manual resolution from a granted resolver
 		return nil, nil
 	}
-	if parentTask.Resolution == nil {
+	if t.Resolution == nil {
 		return nil, nil
 	}
 
-	r, err := resolution.LoadFromPublicID(dbp, *parentTask.Resolution)
+	r, err := resolution.LoadFromPublicID(dbp, *t.Resolution)
 	if err != nil {
 		return nil, err
 	}
@@ -132,5 +252,25 @@ func ShouldResumeParentTask(dbp zesty.DBProvider, t *task.Task) (*task.Task, err
 		return nil, nil
 	}
 
-	return parentTask, nil
+	return r, nil
+}
+
+// DeleteTask deletes a task along with its comments and resolution,
+// then the outputs of its resolution kept in the step output store
+// failing to delete the stored outputs doesn't fail the deletion of the task
+func DeleteTask(c context.Context, dbp zesty.DBProvider, t *task.Task) error {
+	names, err := resolution.StoredOutputNames(dbp, t.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Delete(dbp); err != nil {
+		return err
+	}
+
+	if err := outputstore.Delete(c, names...); err != nil {
+		correlation.Logger(c).WithError(err).Warnf("failed to delete the stored outputs of task %s", t.PublicID)
+	}
+
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/cneill/utask"
 	"github.com/cneill/utask/pkg/constants"
@@ -45,13 +46,25 @@ func ValidateTags(tags map[string]string) error {
 		return nil
 	}
 	for k := range tags {
-		if k == constants.SubtaskTagParentTaskID {
+		if k == constants.SubtaskTagParentTaskID || k == constants.TagIdempotencyKey {
 			return errors.BadRequestf("tag name %q not allowed", k)
 		}
 	}
 	return nil
 }
 
+// ValidateTTL asserts that a task time-to-live is a strictly positive duration
+func ValidateTTL(ttl string) error {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return errors.NewBadRequest(err, "invalid ttl")
+	}
+	if d <= 0 {
+		return errors.BadRequestf("ttl must be a positive duration: %q", ttl)
+	}
+	return nil
+}
+
 // ListContainsString asserts that a string slice contains a given string
 func ListContainsString(list []string, item string) bool {
 	for _, i := range list {
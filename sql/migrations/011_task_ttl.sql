@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "ttl" TEXT;
+ALTER TABLE "task" ADD COLUMN "ttl" TEXT;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration011');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "ttl";
+ALTER TABLE "task" DROP COLUMN "ttl";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration011';
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "priority" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "task" ADD COLUMN "priority" INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX ON "task"(priority DESC);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration012');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "priority";
+ALTER TABLE "task" DROP COLUMN "priority";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration012';
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+ALTER TABLE "task" ADD COLUMN "depends_on" JSONB NOT NULL DEFAULT 'null';
+
+CREATE INDEX "task_depends_on_idx" ON "task" USING gin (depends_on jsonb_path_ops);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration013');
+
+-- +migrate Down
+
+DROP INDEX task_depends_on_idx;
+
+ALTER TABLE "task" DROP COLUMN "depends_on";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration013';
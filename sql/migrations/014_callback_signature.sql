@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "callback" ADD COLUMN "signature_secret" TEXT NOT NULL DEFAULT '';
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration014');
+
+-- +migrate Down
+
+ALTER TABLE "callback" DROP COLUMN "signature_secret";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration014';
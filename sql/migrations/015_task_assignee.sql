@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "task" ADD COLUMN "assignee" TEXT;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration015');
+
+-- +migrate Down
+
+ALTER TABLE "task" DROP COLUMN "assignee";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration015';
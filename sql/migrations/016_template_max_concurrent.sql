@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "max_concurrent" INTEGER;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration016');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "max_concurrent";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration016';
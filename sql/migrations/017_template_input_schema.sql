@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "input_schema" JSONB NOT NULL DEFAULT 'null';
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration017');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "input_schema";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration017';
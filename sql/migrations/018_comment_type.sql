@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "task_comment" ADD COLUMN "type" TEXT NOT NULL DEFAULT 'user';
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration018');
+
+-- +migrate Down
+
+ALTER TABLE "task_comment" DROP COLUMN "type";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration018';
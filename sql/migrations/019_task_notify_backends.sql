@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "task" ADD COLUMN "notify_backends" JSONB NOT NULL DEFAULT 'null';
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration019');
+
+-- +migrate Down
+
+ALTER TABLE "task" DROP COLUMN "notify_backends";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration019';
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "sla" TEXT;
+
+ALTER TABLE "task" ADD COLUMN "sla_deadline" TIMESTAMP with time zone;
+ALTER TABLE "task" ADD COLUMN "sla_breached" BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX "task_sla_deadline_idx" ON "task"(sla_deadline);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration020');
+
+-- +migrate Down
+
+DROP INDEX task_sla_deadline_idx;
+
+ALTER TABLE "task" DROP COLUMN "sla_breached";
+ALTER TABLE "task" DROP COLUMN "sla_deadline";
+
+ALTER TABLE "task_template" DROP COLUMN "sla";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration020';
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "reminder_threshold" TEXT;
+ALTER TABLE "task_template" ADD COLUMN "reminder_interval" TEXT;
+
+ALTER TABLE "task" ADD COLUMN "last_reminder" TIMESTAMP with time zone;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration021');
+
+-- +migrate Down
+
+ALTER TABLE "task" DROP COLUMN "last_reminder";
+
+ALTER TABLE "task_template" DROP COLUMN "reminder_interval";
+ALTER TABLE "task_template" DROP COLUMN "reminder_threshold";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration021';
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+CREATE TABLE "key_rotation" (
+    id BIGINT PRIMARY KEY CHECK (id = 1),
+    state TEXT NOT NULL,
+    phase TEXT NOT NULL DEFAULT '',
+    last_id BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    instance_id BIGINT,
+    started_at TIMESTAMP with time zone,
+    updated_at TIMESTAMP with time zone,
+    finished_at TIMESTAMP with time zone,
+    error TEXT
+);
+
+INSERT INTO "key_rotation" (id, state) VALUES (1, 'IDLE');
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration022');
+
+-- +migrate Down
+
+DROP TABLE "key_rotation";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration022';
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "max_step_executions" INTEGER;
+ALTER TABLE "resolution" ADD COLUMN "step_executions" INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration023');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "max_step_executions";
+ALTER TABLE "resolution" DROP COLUMN "step_executions";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration023';
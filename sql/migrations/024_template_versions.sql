@@ -0,0 +1,27 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "version" INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "task" ADD COLUMN "template_version" INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE "task_template_version" (
+    id_template BIGINT NOT NULL REFERENCES "task_template"(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    created TIMESTAMP with time zone DEFAULT now() NOT NULL,
+    template JSONB NOT NULL,
+    PRIMARY KEY (id_template, version)
+);
+
+-- existing templates and their tasks start from version 1
+INSERT INTO "task_template_version" (id_template, version, template)
+    SELECT id, 1, to_jsonb("task_template") FROM "task_template";
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration024');
+
+-- +migrate Down
+
+DROP TABLE "task_template_version";
+
+ALTER TABLE "task" DROP COLUMN "template_version";
+ALTER TABLE "task_template" DROP COLUMN "version";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration024';
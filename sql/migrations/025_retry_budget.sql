@@ -0,0 +1,15 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "retry_budget" INTEGER;
+ALTER TABLE "resolution" ADD COLUMN "retry_budget" INTEGER;
+ALTER TABLE "resolution" ADD COLUMN "step_retries" INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration025');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "retry_budget";
+ALTER TABLE "resolution" DROP COLUMN "retry_budget";
+ALTER TABLE "resolution" DROP COLUMN "step_retries";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration025';
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE "task" ADD COLUMN "revision" INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "resolution" ADD COLUMN "revision" INTEGER NOT NULL DEFAULT 1;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration026');
+
+-- +migrate Down
+
+ALTER TABLE "task" DROP COLUMN "revision";
+ALTER TABLE "resolution" DROP COLUMN "revision";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration026';
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+CREATE INDEX "task_requester_created_idx" ON "task"(requester_username, created, id_template);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration027');
+
+-- +migrate Down
+
+DROP INDEX "task_requester_created_idx";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration027';
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE "resolution" ADD COLUMN "encrypted_secrets" BYTEA;
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration028');
+
+-- +migrate Down
+
+ALTER TABLE "resolution" DROP COLUMN "encrypted_secrets";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration028';
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+ALTER TABLE "task_template" ADD COLUMN "task_resolver_usernames" JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE "task_template" ADD COLUMN "task_resolver_groups" JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE "task_template" ADD COLUMN "task_watcher_usernames" JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE "task_template" ADD COLUMN "task_watcher_groups" JSONB NOT NULL DEFAULT '[]';
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration029');
+
+-- +migrate Down
+
+ALTER TABLE "task_template" DROP COLUMN "task_resolver_usernames";
+ALTER TABLE "task_template" DROP COLUMN "task_resolver_groups";
+ALTER TABLE "task_template" DROP COLUMN "task_watcher_usernames";
+ALTER TABLE "task_template" DROP COLUMN "task_watcher_groups";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration029';
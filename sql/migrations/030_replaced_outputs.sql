@@ -0,0 +1,14 @@
+-- +migrate Up
+
+CREATE TABLE "replaced_output" (
+    name TEXT PRIMARY KEY,
+    replaced_at TIMESTAMP with time zone DEFAULT now() NOT NULL
+);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration030');
+
+-- +migrate Down
+
+DROP TABLE "replaced_output";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration030';
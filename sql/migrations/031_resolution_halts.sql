@@ -0,0 +1,15 @@
+-- +migrate Up
+
+CREATE TABLE "resolution_halt" (
+    id_resolution BIGINT PRIMARY KEY REFERENCES "resolution"(id) ON DELETE CASCADE,
+    state TEXT NOT NULL,
+    requested_at TIMESTAMP with time zone DEFAULT now() NOT NULL
+);
+
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration031');
+
+-- +migrate Down
+
+DROP TABLE "resolution_halt";
+
+DELETE FROM "utask_sql_migrations" WHERE current_migration_applied = 'v1.22.0-migration031';
@@ -1,16 +1,21 @@
 BEGIN;
 
 DROP TABLE IF EXISTS "task_template" CASCADE;
+DROP TABLE IF EXISTS "task_template_version" CASCADE;
 DROP TABLE IF EXISTS "batch" CASCADE;
 DROP TABLE IF EXISTS "task" CASCADE;
 DROP TABLE IF EXISTS "task_comment" CASCADE;
 DROP TABLE IF EXISTS "resolution" CASCADE;
 DROP TABLE IF EXISTS "runner_instance" CASCADE;
+DROP TABLE IF EXISTS "key_rotation" CASCADE;
+DROP TABLE IF EXISTS "replaced_output" CASCADE;
+DROP TABLE IF EXISTS "resolution_halt" CASCADE;
 DROP TABLE IF EXISTS "utask_sql_migrations" CASCADE;
 
 CREATE TABLE "task_template" (
     id BIGSERIAL PRIMARY KEY,
     name TEXT UNIQUE NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
     description TEXT NOT NULL,
     long_description TEXT,
     doc_link TEXT,
@@ -21,6 +26,10 @@ CREATE TABLE "task_template" (
     allowed_resolver_groups JSONB NOT NULL DEFAULT '[]',
     allowed_resolver_usernames JSONB NOT NULL DEFAULT '[]',
     allow_all_resolver_usernames BOOL NOT NULL DEFAULT false,
+    task_resolver_usernames JSONB NOT NULL DEFAULT '[]',
+    task_resolver_groups JSONB NOT NULL DEFAULT '[]',
+    task_watcher_usernames JSONB NOT NULL DEFAULT '[]',
+    task_watcher_groups JSONB NOT NULL DEFAULT '[]',
     auto_runnable BOOL NOT NULL DEFAULT false,
     blocked BOOL NOT NULL DEFAULT false,
     hidden BOOL NOT NULL DEFAULT false,
@@ -29,7 +38,24 @@ CREATE TABLE "task_template" (
     retry_max INTEGER,
     allow_task_start_over BOOL NOT NULL DEFAULT false,
     base_configurations JSONB NOT NULL,
-    tags JSONB NOT NULL DEFAULT 'null'
+    tags JSONB NOT NULL DEFAULT 'null',
+    ttl TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    max_concurrent INTEGER,
+    input_schema JSONB NOT NULL DEFAULT 'null',
+    sla TEXT,
+    reminder_threshold TEXT,
+    reminder_interval TEXT,
+    max_step_executions INTEGER,
+    retry_budget INTEGER
+);
+
+CREATE TABLE "task_template_version" (
+    id_template BIGINT NOT NULL REFERENCES "task_template"(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    created TIMESTAMP with time zone DEFAULT now() NOT NULL,
+    template JSONB NOT NULL,
+    PRIMARY KEY (id_template, version)
 );
 
 CREATE TABLE "batch" (
@@ -41,6 +67,7 @@ CREATE TABLE "task" (
     id BIGSERIAL PRIMARY KEY,
     public_id UUID UNIQUE NOT NULL,
     id_template BIGINT NOT NULL REFERENCES "task_template"(id),
+    template_version INTEGER NOT NULL DEFAULT 1,
     id_batch BIGINT REFERENCES "batch"(id),
     title TEXT NOT NULL,
     requester_username TEXT,
@@ -57,14 +84,25 @@ CREATE TABLE "task" (
     crypt_key BYTEA NOT NULL,
     encrypted_input BYTEA NOT NULL,
     encrypted_result BYTEA NOT NULL,
-    tags JSONB NOT NULL DEFAULT 'null'
+    tags JSONB NOT NULL DEFAULT 'null',
+    ttl TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    depends_on JSONB NOT NULL DEFAULT 'null',
+    assignee TEXT,
+    notify_backends JSONB NOT NULL DEFAULT 'null',
+    sla_deadline TIMESTAMP with time zone,
+    sla_breached BOOLEAN NOT NULL DEFAULT false,
+    last_reminder TIMESTAMP with time zone,
+    revision INTEGER NOT NULL DEFAULT 1
 );
 
 CREATE INDEX ON "task"(id_template);
 CREATE INDEX ON "task"(id_batch);
 CREATE INDEX ON "task"(requester_username);
+CREATE INDEX "task_requester_created_idx" ON "task"(requester_username, created, id_template);
 CREATE INDEX ON "task"(state);
 CREATE INDEX ON "task"(last_activity DESC);
+CREATE INDEX ON "task"(priority DESC);
 -- See section 8.14.4 relative to jsonb indexing:
 -- https://www.postgresql.org/docs/9.4/datatype-json.html
 CREATE INDEX ON "task" USING gin (watcher_usernames jsonb_path_ops);
@@ -72,6 +110,8 @@ CREATE INDEX ON "task" USING gin (watcher_groups);
 CREATE INDEX ON "task" USING gin (resolver_usernames jsonb_path_ops);
 CREATE INDEX ON "task" USING gin (resolver_groups);
 CREATE INDEX ON "task" USING gin (tags jsonb_path_ops);
+CREATE INDEX ON "task" USING gin (depends_on jsonb_path_ops);
+CREATE INDEX ON "task"(sla_deadline);
 
 CREATE TABLE "task_comment" (
     id BIGSERIAL PRIMARY KEY,
@@ -80,7 +120,8 @@ CREATE TABLE "task_comment" (
     username TEXT,
     created TIMESTAMP with time zone DEFAULT now() NOT NULL,
     updated TIMESTAMP with time zone DEFAULT now() NOT NULL,
-    content TEXT NOT NULL
+    content TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'user'
 );
 CREATE INDEX ON "task_comment"(id_task);
 
@@ -97,11 +138,16 @@ CREATE TABLE "resolution" (
     next_retry TIMESTAMP with time zone,
     run_count INTEGER NOT NULL,
     run_max INTEGER NOT NULL,
+    step_executions INTEGER NOT NULL DEFAULT 0,
+    step_retries INTEGER NOT NULL DEFAULT 0,
+    retry_budget INTEGER,
     crypt_key BYTEA NOT NULL,
     encrypted_resolver_input BYTEA,
     encrypted_steps BYTEA NOT NULL,
+    encrypted_secrets BYTEA,
     steps_compression_alg TEXT NOT NULL DEFAULT '',
-    base_configurations JSONB NOT NULL
+    base_configurations JSONB NOT NULL,
+    revision INTEGER NOT NULL DEFAULT 1
 );
 
 CREATE INDEX ON "resolution"(resolver_username);
@@ -125,15 +171,42 @@ CREATE TABLE "callback" (
     resolver_username TEXT NOT NULL,
     encrypted_schema BYTEA NOT NULL,
     encrypted_body BYTEA NOT NULL,
-    encrypted_secret BYTEA NOT NULL
+    encrypted_secret BYTEA NOT NULL,
+    signature_secret TEXT NOT NULL DEFAULT ''
 );
 CREATE INDEX ON "callback"(id_task);
 CREATE INDEX ON "callback"(id_resolution);
 
+CREATE TABLE "key_rotation" (
+    id BIGINT PRIMARY KEY CHECK (id = 1),
+    state TEXT NOT NULL,
+    phase TEXT NOT NULL DEFAULT '',
+    last_id BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    instance_id BIGINT,
+    started_at TIMESTAMP with time zone,
+    updated_at TIMESTAMP with time zone,
+    finished_at TIMESTAMP with time zone,
+    error TEXT
+);
+
+INSERT INTO "key_rotation" (id, state) VALUES (1, 'IDLE');
+
+CREATE TABLE "replaced_output" (
+    name TEXT PRIMARY KEY,
+    replaced_at TIMESTAMP with time zone DEFAULT now() NOT NULL
+);
+
+CREATE TABLE "resolution_halt" (
+    id_resolution BIGINT PRIMARY KEY REFERENCES "resolution"(id) ON DELETE CASCADE,
+    state TEXT NOT NULL,
+    requested_at TIMESTAMP with time zone DEFAULT now() NOT NULL
+);
+
 CREATE TABLE "utask_sql_migrations" (
     current_migration_applied TEXT PRIMARY KEY
 );
 
-INSERT INTO "utask_sql_migrations" VALUES ('v1.21.1-migration010');
+INSERT INTO "utask_sql_migrations" VALUES ('v1.22.0-migration031');
 
 END;
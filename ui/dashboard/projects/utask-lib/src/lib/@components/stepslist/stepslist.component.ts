@@ -120,7 +120,7 @@ export class StepsListComponent implements OnChanges {
                 }).catch(err => {
                     throw err;
                 }),
-                apiCallSubmit: (data: any) => this._api.resolution.updateStepAsYaml(this.resolution.id, step.name, data).toPromise()
+                apiCallSubmit: (data: any) => this._api.resolution.updateStepAsYaml(this.resolution.id, step.name, data, this.resolution.revision).toPromise()
             },
             nzOnOk: (data: ModalApiYamlEditComponent) => {
                 this._notif.info('', `The step has been edited.`);
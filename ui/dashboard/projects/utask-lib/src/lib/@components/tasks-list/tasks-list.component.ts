@@ -34,7 +34,7 @@ import get from 'lodash-es/get';
 import cloneDeep from 'lodash-es/cloneDeep';
 import moment from 'moment';
 import Task, { TaskType } from '../../@models/task.model';
-import { ParamsListTasks, ApiService, UTaskLibOptions } from '../../@services/api.service';
+import { ParamsListTasks, ApiService, UTaskLibOptions, TaskFeedEvent } from '../../@services/api.service';
 import Meta from '../../@models/meta.model';
 import { ResolutionService } from '../../@services/resolution.service';
 import { TaskService } from '../../@services/task.service';
@@ -119,6 +119,7 @@ export class TasksListComponent implements OnInit, OnDestroy, OnChanges, AfterVi
     firstLoad: boolean;
     hasMore: boolean;
     intervalLoadNewTasks: Subscription;
+    taskFeedSub: Subscription;
     newTasks: Task[] = [];
     intervalRefreshTasks: Subscription;
     tasksToRefresh: { [key: string]: number } = {};
@@ -159,7 +160,6 @@ export class TasksListComponent implements OnInit, OnDestroy, OnChanges, AfterVi
     }
 
     ngOnInit() {
-        this.initLoadNewTasks();
         this.initRefreshTasks();
     }
 
@@ -167,6 +167,7 @@ export class TasksListComponent implements OnInit, OnDestroy, OnChanges, AfterVi
         this.registrerScroll.complete();
         this.scroll.complete();
         this.cancelScrollSub();
+        this.cancelTaskFeed();
         this.cancelLoadNewTasks();
         this.cancelRefreshTasks();
     }
@@ -207,6 +208,7 @@ export class TasksListComponent implements OnInit, OnDestroy, OnChanges, AfterVi
 
     async registerInfiniteScroll() {
         this.cancelScrollSub();
+        this.subscribeTaskFeed();
         this.tasks = [];
         this.tasksActions = [];
         this.firstLoad = true;
@@ -295,7 +297,47 @@ export class TasksListComponent implements OnInit, OnDestroy, OnChanges, AfterVi
     // Manage fetch task
     // search params should not be listed in browser url if empty
 
+    // The updated tasks are pushed by the live task list,
+    // falling back to polling the new tasks when its websocket can't be used
+    subscribeTaskFeed() {
+        this.cancelTaskFeed();
+        this.cancelLoadNewTasks();
+        this._zone.runOutsideAngular(() => {
+            this.taskFeedSub = this._api.task.subscribe(this.params)
+                .subscribe(
+                    event => this._zone.run(() => this.receiveTaskFeedEvent(event)),
+                    () => this.initLoadNewTasks()
+                );
+        });
+    }
+
+    receiveTaskFeedEvent(event: TaskFeedEvent) {
+        if (event.type === 'resync') {
+            const lastActivity = this.tasks.length > 0
+                ? moment(this.tasks.sort((a, b) => a.last_activity > b.last_activity ? -1 : 1)[0].last_activity).toDate()
+                : new Date(0);
+            this.fetchNewTasks(lastActivity);
+            return;
+        }
+
+        const task = event.task;
+        this._taskService.registerTags(task);
+        if (this.tasks.find(t => t.id === task.id)) {
+            this.tasks = this.tasks.map(t => t.id === task.id ? task : t);
+            this.computeTaskActions();
+        } else {
+            // Like the polled ones, new tasks wait for the user to display them
+            this.newTasks = [task].concat(this.newTasks.filter(t => t.id !== task.id));
+        }
+        this._cd.markForCheck();
+    }
+
+    cancelTaskFeed() {
+        if (this.taskFeedSub) { this.taskFeedSub.unsubscribe(); }
+    }
+
     initLoadNewTasks() {
+        this.cancelLoadNewTasks();
         this._zone.runOutsideAngular(() => {
             this.intervalLoadNewTasks = interval(this.options.refreshTasks)
                 .pipe(filter(() => this.tasks.length > 0))
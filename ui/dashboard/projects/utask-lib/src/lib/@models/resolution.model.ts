@@ -10,6 +10,7 @@ export default class Resolution {
     next_retry: Date;
     run_count: number;
     run_max: number;
+    revision: number;
     base_configurations: any;
     task_id: string;
     task_title: string;
@@ -78,6 +78,7 @@ export default class Task {
     resolution: string;
     resolver_username: string;
     result: any;
+    revision: number;
     state: string;
     steps_done: number;
     steps_total: number;
@@ -2,6 +2,7 @@ import { Injectable, Inject } from '@angular/core';
 import Task, { TaskType, TaskState, ResolutionStep, Comment, Stats } from '../@models/task.model';
 import Function from '../@models/function.model';
 import { Observable } from 'rxjs';
+import { webSocket } from 'rxjs/webSocket';
 import { HttpClient, HttpResponse } from '@angular/common/http';
 import Meta from '../@models/meta.model';
 import Template from '../@models/template.model';
@@ -19,6 +20,11 @@ export class ParamsListTasks {
     }
 }
 
+export class TaskFeedEvent {
+    type: 'task' | 'resync';
+    task?: Task;
+}
+
 export class NewTask {
     comment: string;
     delay: string;
@@ -31,6 +37,7 @@ export class NewTask {
 
 export class UpdatedTask {
     input: any;
+    revision: number;
     tags: { [key: string]: string };
     watcher_usernames: string[];
     watcher_groups: string[];
@@ -66,6 +73,21 @@ export class ApiServiceTask {
         })
     }
 
+    // subscribe opens the live task list, pushing the tasks matching the params as they are updated
+    subscribe(params: ParamsListTasks): Observable<TaskFeedEvent> {
+        const url = new URL(`${this.base}task/subscribe`, window.location.href);
+        url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+        url.searchParams.set('type', params.type);
+        if (params.state) {
+            url.searchParams.set('state', params.state);
+        }
+        if (params.template) {
+            url.searchParams.set('template', params.template);
+        }
+        (params.tag || []).forEach(t => url.searchParams.append('tag', t));
+        return webSocket<TaskFeedEvent>(url.toString());
+    }
+
     add(body: NewTask) {
         return this.http.post(
             `${this.base}task`,
@@ -211,6 +233,7 @@ export class NewResolution {
 
 export class UpdatedResolution {
     resolver_inputs: any;
+    revision: number;
     steps: { [step: string]: ResolutionStep };
 }
 
@@ -264,13 +287,14 @@ export class ApiServiceResolution {
         );
     }
 
-    updateStepAsYaml(id: string, stepName: string, yaml: string) {
+    updateStepAsYaml(id: string, stepName: string, yaml: string, revision: number) {
         return this.http.put(
             `${this.base}resolution/${id}/step/${stepName}`,
             yaml,
             {
                 headers: {
                     accept: 'application/x-yaml',
+                    'If-Match': `"${revision}"`,
                 },
                 responseType: 'text',
                 observe: 'body'
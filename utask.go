@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/semaphore"
@@ -48,9 +50,10 @@ var (
 	FPort uint
 	// FDebug is a flag to toggle debug log
 	FDebug bool
-	// FMaintenanceMode is a flag to prevent all write operations on the API,
-	// except for admin actions (key rotation)
+	// FMaintenanceMode is a flag to start the instance in maintenance mode
 	FMaintenanceMode bool
+	// FMaintenanceScope is the scope of the maintenance mode the instance starts in
+	FMaintenanceScope string
 	// FLogsFormat represents the format used by the Logrus formatter.
 	FLogsFormat string
 )
@@ -58,6 +61,55 @@ var (
 // AppName returns the name of the application (from config)
 func AppName() string { return App }
 
+// scopes of the maintenance mode, telling which write operations on the API are refused
+const (
+	// MaintenanceScopeAll refuses all write operations, except for admin actions (key rotation)
+	MaintenanceScopeAll = "all"
+	// MaintenanceScopeCreate refuses the creation of new tasks
+	MaintenanceScopeCreate = "create"
+	// MaintenanceScopeExecute refuses to run resolutions
+	MaintenanceScopeExecute = "execute"
+)
+
+// maintenanceScope holds the scope of the current maintenance mode,
+// empty when not in maintenance mode; it can be changed at runtime
+var maintenanceScope atomic.Value
+
+// MaintenanceMode tells if the instance is in maintenance mode, whatever its scope
+func MaintenanceMode() bool { return MaintenanceScope() != "" }
+
+// MaintenanceScope returns the scope of the current maintenance mode, empty when not in maintenance mode
+func MaintenanceScope() string {
+	scope, _ := maintenanceScope.Load().(string)
+	return scope
+}
+
+// MaintenanceBlocks tells if the current maintenance mode refuses the operations of the given scope
+func MaintenanceBlocks(scope string) bool {
+	current := MaintenanceScope()
+	return current == MaintenanceScopeAll || (current != "" && current == scope)
+}
+
+// SetMaintenanceMode switches the instance in or out of maintenance mode, for all operations
+func SetMaintenanceMode(enabled bool) {
+	if enabled {
+		maintenanceScope.Store(MaintenanceScopeAll)
+	} else {
+		maintenanceScope.Store("")
+	}
+}
+
+// SetMaintenanceScope switches the instance in maintenance mode for the given scope,
+// or out of maintenance mode with an empty scope
+func SetMaintenanceScope(scope string) error {
+	switch scope {
+	case "", MaintenanceScopeAll, MaintenanceScopeCreate, MaintenanceScopeExecute:
+		maintenanceScope.Store(scope)
+		return nil
+	}
+	return fmt.Errorf("invalid maintenance scope %q, expected one of %s, %s, %s", scope, MaintenanceScopeAll, MaintenanceScopeCreate, MaintenanceScopeExecute)
+}
+
 const (
 	// DBName is the name of µTask DB, as registered on zesty
 	DBName = "uservice_task"
@@ -121,16 +173,21 @@ type Cfg struct {
 	AdminUsernames                             []string                 `json:"admin_usernames"`
 	AdminGroups                                []string                 `json:"admin_groups"`
 	CompletedTaskExpiration                    string                   `json:"completed_task_expiration"`
+	GarbageCollectorInterval                   string                   `json:"garbage_collector_interval"`
 	NotifyConfig                               map[string]NotifyBackend `json:"notify_config"`
 	NotifyActions                              NotifyActions            `json:"notify_actions"`
 	DatabaseConfig                             *DatabaseConfig          `json:"database_config"`
 	ConcealedSecrets                           []string                 `json:"concealed_secrets"`
+	PublicConfigItems                          []string                 `json:"public_config_items"`
 	ResourceLimits                             map[string]uint          `json:"resource_limits"`
 	ResourceAcquireTimeout                     string                   `json:"resource_acquire_timeout"`
 	resourceAcquireTimeoutDuration             time.Duration            `json:"-"`
 	MaxConcurrentExecutions                    *int                     `json:"max_concurrent_executions"`
 	MaxConcurrentExecutionsFromCrashed         *int                     `json:"max_concurrent_executions_from_crashed"`
 	MaxConcurrentExecutionsFromCrashedComputed int                      `json:"-"`
+	MaxConcurrentSteps                         *int                     `json:"max_concurrent_steps"`
+	StepResourceWeights                        map[string]uint          `json:"step_resource_weights"`
+	MaxStepExecutions                          *int                     `json:"max_step_executions"`
 	DelayBetweenCrashedTasksResolution         string                   `json:"delay_between_crashed_tasks_resolution"`
 	InstanceCollectorWaitDuration              time.Duration            `json:"-"`
 	BaseURL                                    string                   `json:"base_url"`
@@ -139,15 +196,27 @@ type Cfg struct {
 	DashboardSentryDSN                         string                   `json:"dashboard_sentry_dsn"`
 	StepsCompressionAlg                        string                   `json:"steps_compression_algorithm"`
 	ServerOptions                              ServerOpt                `json:"server_options"`
+	Archive                                    *ArchiveConfig           `json:"archive"`
+	StepOutputStore                            *StepOutputStoreConfig   `json:"step_output_store"`
+	OutboundProxy                              *OutboundProxyConfig     `json:"outbound_proxy"`
+	LeaderElection                             bool                     `json:"leader_election"`
+	ScriptLimits                               *ScriptLimitsConfig      `json:"script_limits"`
+	ScriptContainerRuntime                     string                   `json:"script_container_runtime"`
+	ScriptContainerMounts                      []string                 `json:"script_container_mounts"`
+	TaskQuota                                  *TaskQuotaConfig         `json:"task_quota"`
 
 	resourceSemaphores map[string]*semaphore.Weighted
 	executionSemaphore *semaphore.Weighted
+	stepSemaphore      *semaphore.Weighted
 	deadResources      map[string]struct{}
 }
 
 // ServerOpt holds the configuration for the http server
 type ServerOpt struct {
-	MaxBodyBytes int64 `json:"max_body_bytes"`
+	MaxBodyBytes           int64            `json:"max_body_bytes"`
+	MaxCompressedBodyBytes int64            `json:"max_compressed_body_bytes"` // limit of the compressed bodies, before decompression
+	RouteMaxBodyBytes      map[string]int64 `json:"route_max_body_bytes"`      // max_body_bytes overrides, by route path
+	AuditStdout            bool             `json:"audit_stdout"`
 }
 
 // NotifyBackend holds configuration for instantiating a notify client
@@ -176,6 +245,18 @@ type NotifyBackendSlack struct {
 	WebhookURL string `json:"webhook_url"`
 }
 
+// NotifyBackendMattermost holds configuration for instantiating a Mattermost notify client
+type NotifyBackendMattermost struct {
+	WebhookURL string `json:"webhook_url"`
+	Channel    string `json:"channel"` // optional, overrides the channel of the incoming webhook
+}
+
+// NotifyBackendTelegram holds configuration for instantiating a Telegram notify client
+type NotifyBackendTelegram struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+}
+
 // NotifyBackendWebhookCredentials holds the credentials for instantiating a Webhook notify client
 type NotifyBackendWebhookCredentials struct {
 	CredentialsName string `json:"credentials_name"`
@@ -188,8 +269,69 @@ type NotifyBackendWebhookCredentials struct {
 type NotifyBackendWebhook struct {
 	NotifyBackendWebhookCredentials
 
-	WebhookURL string            `json:"webhook_url"`
-	Headers    map[string]string `json:"headers"`
+	WebhookURL         string            `json:"webhook_url"`
+	Headers            map[string]string `json:"headers"`
+	Timeout            string            `json:"timeout"`              // default: 10s
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"` // skip the verification of the server certificate
+	RootCA             string            `json:"root_ca"`              // PEM encoded certificates to trust, on top of the system ones
+	PayloadTemplate    string            `json:"payload_template"`     // Go template rendering the body from the notify.Message
+	ContentType        string            `json:"content_type"`         // default: application/json
+}
+
+// ArchiveConfig holds configuration for archiving tasks to a cold storage before their deletion
+type ArchiveConfig struct {
+	Type         string          `json:"type"` // filesystem or s3
+	Config       json.RawMessage `json:"config"`
+	Compression  string          `json:"compression"`   // default: gzip
+	OnExpiration bool            `json:"on_expiration"` // archive tasks deleted by the garbage collector
+}
+
+// StepOutputStoreConfig holds configuration for storing the large step outputs outside of the DB
+type StepOutputStoreConfig struct {
+	Type           string          `json:"type"` // filesystem or s3, configured as for the archives
+	Config         json.RawMessage `json:"config"`
+	MaxOutputBytes int             `json:"max_output_bytes"` // larger step outputs are stored, default: 1MB
+}
+
+// ArchiveBackendFilesystem holds configuration for archiving tasks in a local directory
+type ArchiveBackendFilesystem struct {
+	Path string `json:"path"`
+}
+
+// ArchiveBackendS3 holds configuration for archiving tasks in an S3 compatible object storage
+type ArchiveBackendS3 struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// OutboundProxyConfig holds the proxy of the requests sent by the builtin network plugins,
+// overriding the standard environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY)
+type OutboundProxyConfig struct {
+	HTTPProxy  string   `json:"http_proxy"`
+	HTTPSProxy string   `json:"https_proxy"`
+	NoProxy    []string `json:"no_proxy"` // hosts, domains (".example.com"), IPs or CIDRs reached directly
+}
+
+// ScriptLimitsConfig holds the default resource limits of the scripts run by the script plugin,
+// overridden by the limits set by a step. Unset, the memory and cpu time are unlimited,
+// and the output capped to 10MB
+type ScriptLimitsConfig struct {
+	MaxMemoryBytes int64  `json:"max_memory_bytes"`
+	MaxCPUTime     string `json:"max_cpu_time"`
+	MaxOutputBytes int64  `json:"max_output_bytes"`
+}
+
+// TaskQuotaConfig caps the number of tasks a single requester can create over a rolling window,
+// admins being exempt. A zero maximum means no limit
+type TaskQuotaConfig struct {
+	Window              string         `json:"window"`                 // default: 1h
+	MaxTasks            int            `json:"max_tasks"`              // all templates included
+	MaxTasksPerTemplate int            `json:"max_tasks_per_template"` // for each template
+	Templates           map[string]int `json:"templates"`              // max_tasks_per_template overrides, by template name
 }
 
 // NotifyActions holds configuration of each actions
@@ -198,6 +340,11 @@ type NotifyActions struct {
 	TaskStateUpdateAction NotifyActionsParameters `json:"task_state_update,omitempty"`
 	TaskValidationAction  NotifyActionsParameters `json:"task_validation,omitempty"`
 	TaskStepUpdateAction  NotifyActionsParameters `json:"task_step_update,omitempty"`
+	TaskSLABreachAction   NotifyActionsParameters `json:"task_sla_breach,omitempty"`
+	// TaskResolverReminderAction reminds the resolvers of tasks blocked for too long, see the template's reminder_threshold
+	TaskResolverReminderAction NotifyActionsParameters `json:"task_resolver_reminder,omitempty"`
+	// TaskStepNotificationAction notifies about the steps reaching the states listed in their notify block
+	TaskStepNotificationAction NotifyActionsParameters `json:"task_step_notification,omitempty"`
 }
 
 // NotifyActionsParameters holds configuration needed to define each Notify actions
@@ -205,6 +352,9 @@ type NotifyActions struct {
 type NotifyActionsParameters struct {
 	Disabled       bool     `json:"disabled"`
 	NotifyBackends []string `json:"notify_backends"`
+	// DeduplicationWindow suppresses a notification identical to one sent less than this duration ago
+	// (same task, action and state)
+	DeduplicationWindow string `json:"deduplication_window,omitempty"`
 }
 
 // DatabaseConfig holds configuration to fine-tune DB connection
@@ -215,6 +365,20 @@ type DatabaseConfig struct {
 	ConfigName      string `json:"config_name"`
 }
 
+// IsConcealedSecret tells whether a configstore item is listed in concealed_secrets:
+// such items are kept away from the task engine, and must not be read by name by the plugins either
+func IsConcealedSecret(item string) bool {
+	if global == nil {
+		return false
+	}
+	for _, concealed := range global.ConcealedSecrets {
+		if item == concealed {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Cfg) buildLimits() {
 	c.resourceSemaphores = make(map[string]*semaphore.Weighted)
 	c.deadResources = make(map[string]struct{})
@@ -230,6 +394,10 @@ func (c *Cfg) buildLimits() {
 	if maxConcurrentExecutions := c.getMaxConcurrentExecutions(); maxConcurrentExecutions >= 0 {
 		c.executionSemaphore = semaphore.NewWeighted(int64(maxConcurrentExecutions))
 	}
+
+	if c.MaxConcurrentSteps != nil {
+		c.stepSemaphore = semaphore.NewWeighted(int64(*c.MaxConcurrentSteps))
+	}
 }
 
 func (c *Cfg) getMaxConcurrentExecutions() int {
@@ -355,6 +523,55 @@ func ReleaseExecutionSlot() {
 	global.executionSemaphore.Release(1)
 }
 
+// StepWeight returns the share of the step slots taken by a step declaring the given resources:
+// the heaviest weight configured for its resources, 1 by default
+func StepWeight(resources []string) int64 {
+	weight := int64(1)
+	if global == nil {
+		return weight
+	}
+	for _, r := range resources {
+		if w := int64(global.StepResourceWeights[r]); w > weight {
+			weight = w
+		}
+	}
+	// a step can't weigh more than the whole pool, it would never run
+	if global.MaxConcurrentSteps != nil && weight > int64(*global.MaxConcurrentSteps) {
+		weight = int64(*global.MaxConcurrentSteps)
+	}
+	return weight
+}
+
+// AcquireStepSlots takes weight slots from a global semaphore
+// putting a cap on the total amount of concurrent step executions in the instance
+func AcquireStepSlots(ctx context.Context, weight int64) error {
+	if global == nil {
+		return nil
+	}
+	if global.stepSemaphore == nil {
+		return nil
+	}
+
+	semaphoreCtx := ctx
+	if global.resourceAcquireTimeoutDuration != 0 {
+		ctx, cancelFunc := context.WithTimeout(ctx, global.resourceAcquireTimeoutDuration)
+		defer cancelFunc()
+		semaphoreCtx = ctx
+	}
+	return global.stepSemaphore.Acquire(semaphoreCtx, weight)
+}
+
+// ReleaseStepSlots frees up weight slots on the global step semaphore
+func ReleaseStepSlots(weight int64) {
+	if global == nil {
+		return
+	}
+	if global.stepSemaphore == nil {
+		return
+	}
+	global.stepSemaphore.Release(weight)
+}
+
 var global *Cfg
 
 // Config returns the global configuration data of this instance
@@ -409,6 +626,36 @@ func Config(store *configstore.Store) (*Cfg, error) {
 		if global.MaxConcurrentExecutionsFromCrashedComputed > global.getMaxConcurrentExecutions() {
 			return nil, errors.New("max_concurrent_executions_from_crashed can't be greater than max_concurrent_executions")
 		}
+
+		if global.MaxConcurrentSteps != nil && *global.MaxConcurrentSteps <= 0 {
+			return nil, errors.New("max_concurrent_steps must be positive")
+		}
+
+		if global.MaxStepExecutions != nil && *global.MaxStepExecutions <= 0 {
+			return nil, errors.New("max_step_executions must be positive")
+		}
+
+		if global.OutboundProxy != nil {
+			for key, proxyURL := range map[string]string{
+				"http_proxy":  global.OutboundProxy.HTTPProxy,
+				"https_proxy": global.OutboundProxy.HTTPSProxy,
+			} {
+				if proxyURL == "" {
+					continue
+				}
+				if _, err := url.Parse(proxyURL); err != nil {
+					return nil, fmt.Errorf("outbound_proxy: invalid %s: %s", key, err)
+				}
+			}
+		}
+
+		for _, item := range global.PublicConfigItems {
+			for _, concealed := range global.ConcealedSecrets {
+				if item == concealed {
+					return nil, fmt.Errorf("public_config_items: %q is a concealed secret", item)
+				}
+			}
+		}
 	}
 
 	return global, nil
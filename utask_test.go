@@ -0,0 +1,90 @@
+package utask
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withConfig(t *testing.T, cfg *Cfg) {
+	previous := global
+	cfg.buildLimits()
+	global = cfg
+	t.Cleanup(func() { global = previous })
+}
+
+func TestStepWeight(t *testing.T) {
+	previous := global
+	global = nil
+	defer func() { global = previous }()
+	assert.Equal(t, int64(1), StepWeight([]string{"heavy"}))
+
+	maxConcurrentSteps := 4
+	withConfig(t, &Cfg{
+		StepResourceWeights: map[string]uint{"light": 1, "heavy": 3, "huge": 10},
+	})
+	assert.Equal(t, int64(1), StepWeight(nil))
+	assert.Equal(t, int64(1), StepWeight([]string{"unknown"}))
+	assert.Equal(t, int64(3), StepWeight([]string{"light", "heavy"}))
+
+	// without a cap, the weight is used as configured
+	assert.Equal(t, int64(10), StepWeight([]string{"huge"}))
+
+	// a step weighing more than the pool takes all of it
+	global.MaxConcurrentSteps = &maxConcurrentSteps
+	assert.Equal(t, int64(3), StepWeight([]string{"heavy"}))
+	assert.Equal(t, int64(4), StepWeight([]string{"heavy", "huge"}))
+}
+
+func TestAcquireStepSlots(t *testing.T) {
+	ctx := context.Background()
+
+	// no cap configured, nothing to wait for
+	withConfig(t, &Cfg{})
+	require.NoError(t, AcquireStepSlots(ctx, 100))
+	ReleaseStepSlots(100)
+
+	maxConcurrentSteps := 2
+	withConfig(t, &Cfg{
+		MaxConcurrentSteps:             &maxConcurrentSteps,
+		resourceAcquireTimeoutDuration: 50 * time.Millisecond,
+	})
+
+	require.NoError(t, AcquireStepSlots(ctx, 1))
+	require.NoError(t, AcquireStepSlots(ctx, 1))
+
+	// the pool is full, the acquisition gives up after the timeout
+	start := time.Now()
+	assert.Error(t, AcquireStepSlots(ctx, 1))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// a heavier step waits for enough slots to be released
+	ReleaseStepSlots(1)
+	assert.Error(t, AcquireStepSlots(ctx, 2))
+	ReleaseStepSlots(1)
+	require.NoError(t, AcquireStepSlots(ctx, 2))
+	ReleaseStepSlots(2)
+
+	// a cancelled context stops the wait as well
+	global.resourceAcquireTimeoutDuration = 0
+	require.NoError(t, AcquireStepSlots(ctx, 2))
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, AcquireStepSlots(cancelledCtx, 1))
+	ReleaseStepSlots(2)
+}
+
+func TestIsConcealedSecret(t *testing.T) {
+	previous := global
+	global = nil
+	defer func() { global = previous }()
+	assert.False(t, IsConcealedSecret("database"))
+
+	withConfig(t, &Cfg{ConcealedSecrets: []string{"database", "encryption-key"}})
+	assert.True(t, IsConcealedSecret("database"))
+	assert.True(t, IsConcealedSecret("encryption-key"))
+	assert.False(t, IsConcealedSecret("oauth2-example"))
+}